@@ -17,20 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/cephfs"
 	"github.com/ceph/ceph-csi/internal/controller"
 	"github.com/ceph/ceph-csi/internal/controller/persistentvolume"
+	"github.com/ceph/ceph-csi/internal/controller/snapshotexpiry"
+	"github.com/ceph/ceph-csi/internal/controller/stalevolume"
+	"github.com/ceph/ceph-csi/internal/controller/volumeimport"
+	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
 	"github.com/ceph/ceph-csi/internal/liveness"
 	nfsdriver "github.com/ceph/ceph-csi/internal/nfs/driver"
 	rbddriver "github.com/ceph/ceph-csi/internal/rbd/driver"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"k8s.io/klog/v2"
 )
@@ -50,6 +57,10 @@ const (
 	pollTime     = 60 // seconds
 	probeTimeout = 3  // seconds
 
+	// shorter than the default terminationGracePeriodSeconds of pods, so
+	// that the driver can close its connections before it is killed.
+	defaultShutdownTimeout = 20 * time.Second
+
 	// use default namespace if namespace is not set.
 	defaultNS = "default"
 
@@ -70,6 +81,28 @@ func init() {
 	flag.StringVar(&conf.StagingPath, "stagingpath", defaultStagingPath, "staging path")
 	flag.StringVar(&conf.ClusterName, "clustername", "", "name of the cluster")
 	flag.BoolVar(&conf.SetMetadata, "setmetadata", false, "set metadata on the volume")
+	flag.BoolVar(&conf.StrictParameters, "strictparameters", false,
+		"reject CreateVolume and CreateSnapshot requests with unknown StorageClass or VolumeSnapshotClass parameters")
+	flag.BoolVar(&conf.EnforceSnapshotExpiry, "enforcesnapshotexpiry", false,
+		"delete VolumeSnapshots once the expiry stored in the metadata of their snapshot has passed")
+	flag.DurationVar(
+		&conf.StaleVolumeInterval,
+		"stalevolumeinterval",
+		0,
+		"time interval between listings of the volumes in the journals to find volumes without PV, disabled when 0")
+	flag.DurationVar(
+		&conf.StaleVolumeGracePeriod,
+		"stalevolumegraceperiod",
+		0,
+		"time after which volumes without PV are deleted if their PV had the Delete reclaim policy,"+
+			" they are only reported when 0")
+	flag.StringVar(&conf.VolumeImportAllowList, "volumeimportallowlist", "",
+		"comma separated list of hosts, IP addresses and CIDRs that VolumeImports can be downloaded from"+
+			" (by default all but loopback, private and link-local addresses)")
+	flag.DurationVar(&conf.VolumeImportTimeout, "volumeimporttimeout", time.Hour,
+		"time after which the download of a VolumeImport is given up")
+	flag.UintVar(&conf.MaxSnapshotsPerVolume, "maxsnapshotspervolume", 0,
+		"maximum number of snapshots of a volume, CreateSnapshot fails once it is reached (0 is unlimited)")
 	flag.StringVar(&conf.InstanceID, "instanceid", "", "Unique ID distinguishing this instance of Ceph CSI among other"+
 		" instances, when sharing Ceph clusters across CSI instances for provisioning")
 	flag.IntVar(&conf.PidLimit, "pidlimit", 0, "the PID limit to configure through cgroups")
@@ -98,6 +131,16 @@ func init() {
 		"fusemountoptions",
 		"",
 		"Comma separated string of mount options accepted by ceph-fuse mounter")
+	flag.StringVar(
+		&conf.MountOptionsPolicy,
+		"mountoptionspolicy",
+		"",
+		"JSON file with the default mount options per filesystem type and the denied mount options")
+	flag.BoolVar(
+		&conf.EnableVolumeMountGroup,
+		"enablevolumemountgroup",
+		false,
+		"apply the fsGroup of pods to the root of cephfs volumes, instead of the recursive change of ownership by kubelet")
 
 	// liveness/grpc metrics related flags
 	flag.IntVar(&conf.MetricsPort, "metricsport", 8080, "TCP port for liveness/grpc metrics requests")
@@ -108,14 +151,51 @@ func init() {
 		"path of prometheus endpoint where metrics will be available")
 	flag.DurationVar(&conf.PollTime, "polltime", time.Second*pollTime, "time interval in seconds between each poll")
 	flag.DurationVar(&conf.PoolTimeout, "timeout", time.Second*probeTimeout, "probe timeout in seconds")
-
+	flag.DurationVar(
+		&conf.MountHealthInterval,
+		"mounthealthinterval",
+		0,
+		"time interval between probes of the staged mounts on the node, disabled when 0")
+	flag.DurationVar(
+		&conf.VolumeStatsCacheTTL,
+		"volumestatscachettl",
+		0,
+		"time the results of NodeGetVolumeStats are cached on the node and refreshed in the background, disabled when 0")
+	flag.BoolVar(
+		&conf.LivenessClusterPing,
+		"livenessclusterping",
+		false,
+		"check the health of each Ceph cluster in the CSI config file with its credentials, on every liveness poll")
+	flag.DurationVar(
+		&conf.CephHealthInterval,
+		"cephhealthinterval",
+		0,
+		"time interval between collecting the health and pool usage of the Ceph clusters as metrics, disabled when 0")
+
+	flag.BoolVar(&conf.EnableMetrics, "enablemetrics", false, "enable metrics collection and start prometheus server")
 	flag.BoolVar(&conf.EnableGRPCMetrics, "enablegrpcmetrics", false, "[DEPRECATED] enable grpc metrics")
 	flag.StringVar(
 		&conf.HistogramOption,
 		"histogramoption",
 		"0.5,2,6",
-		"[DEPRECATED] Histogram option for grpc metrics, should be comma separated value, "+
+		"Histogram option for grpc metrics, should be comma separated value, "+
 			"ex:= 0.5,2,6 where start=0.5 factor=2, count=6")
+	flag.StringVar(
+		&conf.MetricsDisabledLabels,
+		"metricsdisabledlabels",
+		"",
+		"comma separated list of labels (cluster_id, pool), metrics with one of these labels are not recorded")
+	flag.IntVar(
+		&conf.MetricsSampleRatio,
+		"metricssampleratio",
+		1,
+		"record the metrics with a cluster_id or pool label for only one of every ratio clusters and pools")
+
+	flag.StringVar(
+		&conf.TracingEndpoint,
+		"tracingendpoint",
+		"",
+		"OTLP gRPC endpoint (host:port) to export traces to, tracing is disabled when empty")
 
 	flag.UintVar(
 		&conf.RbdHardMaxCloneDepth,
@@ -139,9 +219,77 @@ func init() {
 		"Minimum number of snapshots required on rbd image to start flattening")
 	flag.BoolVar(&conf.SkipForceFlatten, "skipforceflatten", false,
 		"skip image flattening if kernel support mapping of rbd images which has the deep-flatten feature")
+	flag.Int64Var(
+		&conf.MaxVolumesPerNode,
+		"maxvolumespernode",
+		0,
+		"maximum number of RBD volumes that can be mapped on the node, the detected limits are used when 0")
+	flag.DurationVar(
+		&conf.CreateVolumeCacheTTL,
+		"createvolumecachettl",
+		0,
+		"duration to cache CreateVolume responses for answering retries of completed requests (0 disables the cache)")
+	flag.DurationVar(
+		&conf.ShutdownTimeout,
+		"shutdowntimeout",
+		defaultShutdownTimeout,
+		"time to wait for gRPC procedures in flight to finish when the driver receives SIGTERM")
 
 	flag.BoolVar(&conf.Version, "version", false, "Print cephcsi version information")
 	flag.BoolVar(&conf.EnableProfiling, "enableprofiling", false, "enable go profiling")
+	flag.StringVar(
+		&conf.PprofAddress,
+		"pprofaddress",
+		"",
+		"local address (unix:///path/to/socket or localhost:port) to serve pprof profiles on, disabled when empty")
+	flag.IntVar(
+		&conf.GoroutineThreshold,
+		"goroutinethreshold",
+		0,
+		"log a warning with go-routine stacks when the number of go-routines exceeds the threshold, disabled when 0")
+	flag.DurationVar(
+		&conf.LeakWatchInterval,
+		"leakwatchinterval",
+		0,
+		"time interval between counting go-routines, rados connections and mapped devices to detect leaks, disabled when 0")
+	flag.DurationVar(
+		&conf.SlowOperationThreshold,
+		"slowoperationthreshold",
+		0,
+		"log a warning for gRPC procedures and internal operations that take longer than the threshold, disabled when 0")
+	flag.StringVar(
+		&conf.DiagnosticsDir,
+		"diagnosticsdir",
+		"",
+		"directory to write a diagnostics bundle to when a gRPC procedure panics, disabled when empty")
+
+	flag.BoolVar(
+		&conf.EnableEvents,
+		"enableevents",
+		false,
+		"emit Kubernetes Events on PVCs and Pods for actionable provisioning and attach failures")
+	flag.BoolVar(
+		&conf.EnableIntrospection,
+		"enableintrospection",
+		false,
+		"serve the gRPC health and reflection services on the CSI and CSI-Addons sockets")
+	flag.StringVar(
+		&conf.AuditLog,
+		"auditlog",
+		"",
+		"file to append an audit record of each volume and snapshot lifecycle operation to, 'stdout' to write to stdout")
+	flag.StringVar(&conf.LogFormat, "logformat", "text", "format of the log messages, can be 'text' or 'json'")
+	flag.StringVar(
+		&conf.LogControlSocket,
+		"logcontrolsocket",
+		"",
+		"path of the unix domain socket for changing the log verbosity at runtime, disabled when empty")
+	flag.StringVar(
+		&conf.AdminSocket,
+		"adminsocket",
+		"",
+		"path of the unix domain socket for admin commands, like flattening an image or listing the in-flight "+
+			"procedures, disabled when empty")
 
 	// CSI-Addons configuration
 	flag.StringVar(&conf.CSIAddonsEndpoint, "csi-addons-endpoint", "unix:///tmp/csi-addons.sock", "CSI-Addons endpoint")
@@ -189,6 +337,39 @@ func main() {
 		printVersion()
 		os.Exit(0)
 	}
+
+	if flag.NArg() > 0 {
+		runCommand(flag.Args())
+	}
+
+	switch conf.LogFormat {
+	case "text":
+	case "json":
+		log.SetJSONFormat(os.Stderr)
+	default:
+		logAndExit(fmt.Sprintf("invalid logformat %q, should be 'text' or 'json'", conf.LogFormat))
+	}
+	if conf.LogControlSocket != "" {
+		go util.StartLogControlServer(conf.LogControlSocket)
+	}
+	if conf.AdminSocket != "" {
+		csicommon.RegisterInflightCommand()
+		go util.StartAdminServer(conf.AdminSocket)
+	}
+	if conf.PprofAddress != "" {
+		go util.StartProfilingServer(conf.PprofAddress)
+	}
+	if conf.GoroutineThreshold > 0 {
+		go util.WatchGoroutines(conf.GoroutineThreshold)
+	}
+	if conf.LeakWatchInterval > 0 {
+		go util.StartLeakWatch(conf.LeakWatchInterval)
+	}
+	util.SetSlowOperationThreshold(conf.SlowOperationThreshold)
+	err := util.SetMetricsCardinality(strings.Split(conf.MetricsDisabledLabels, ","), conf.MetricsSampleRatio)
+	if err != nil {
+		logAndExit(err.Error())
+	}
 	log.DefaultLog("Driver version: %s and Git version: %s", util.DriverVersion, util.GitCommit)
 
 	if conf.Vtype == "" {
@@ -196,7 +377,7 @@ func main() {
 	}
 
 	dname := getDriverName()
-	err := util.ValidateDriverName(dname)
+	err = util.ValidateDriverName(dname)
 	if err != nil {
 		logAndExit(err.Error())
 	}
@@ -220,7 +401,12 @@ func main() {
 		}
 	}
 
-	if conf.EnableGRPCMetrics || conf.Vtype == livenessType {
+	if conf.EnableGRPCMetrics {
+		log.WarningLogMsg("--enablegrpcmetrics is deprecated, use --enablemetrics instead")
+		conf.EnableMetrics = true
+	}
+
+	if conf.EnableMetrics || conf.Vtype == livenessType {
 		// validate metrics endpoint
 		conf.MetricsIP = os.Getenv("POD_IP")
 
@@ -238,6 +424,38 @@ func main() {
 		log.FatalLogMsg("failed to write ceph configuration file (%v)", err)
 	}
 
+	if conf.TracingEndpoint != "" {
+		err = tracing.Init(context.TODO(), conf.TracingEndpoint, dname)
+		if err != nil {
+			logAndExit(err.Error())
+		}
+	}
+
+	if conf.EnableEvents {
+		err = csicommon.EnableEvents(dname, conf.NodeID)
+		if err != nil {
+			logAndExit(err.Error())
+		}
+	}
+	if conf.EnableIntrospection {
+		csicommon.EnableIntrospection()
+	}
+	if conf.VolumeStatsCacheTTL > 0 {
+		csicommon.EnableVolumeStatsCache(conf.VolumeStatsCacheTTL)
+	}
+	if conf.DiagnosticsDir != "" {
+		err = csicommon.EnableDiagnostics(conf.DiagnosticsDir)
+		if err != nil {
+			logAndExit(err.Error())
+		}
+	}
+	if conf.AuditLog != "" {
+		err = csicommon.EnableAuditLog(conf.AuditLog)
+		if err != nil {
+			logAndExit(err.Error())
+		}
+	}
+
 	log.DefaultLog("Starting driver type: %v with name: %v", conf.Vtype, dname)
 	switch conf.Vtype {
 	case rbdType:
@@ -259,10 +477,16 @@ func main() {
 
 	case controllerType:
 		cfg := controller.Config{
-			DriverName:  dname,
-			Namespace:   conf.DriverNamespace,
-			ClusterName: conf.ClusterName,
-			SetMetadata: conf.SetMetadata,
+			DriverName:             dname,
+			Namespace:              conf.DriverNamespace,
+			ClusterName:            conf.ClusterName,
+			SetMetadata:            conf.SetMetadata,
+			EnforceSnapshotExpiry:  conf.EnforceSnapshotExpiry,
+			InstanceID:             conf.InstanceID,
+			StaleVolumeInterval:    conf.StaleVolumeInterval,
+			StaleVolumeGracePeriod: conf.StaleVolumeGracePeriod,
+			VolumeImportAllowList:  conf.VolumeImportAllowList,
+			VolumeImportTimeout:    conf.VolumeImportTimeout,
 		}
 		// initialize all controllers before starting.
 		initControllers()
@@ -279,6 +503,9 @@ func main() {
 func initControllers() {
 	// Add list of controller here.
 	persistentvolume.Init()
+	volumeimport.Init()
+	snapshotexpiry.Init()
+	stalevolume.Init()
 }
 
 func validateCloneDepthFlag(conf *util.Config) {
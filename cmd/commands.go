@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ceph/ceph-csi/internal/cephfs"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// commands are the subcommands of cephcsi, they run a single task and exit
+// instead of starting a driver.
+var commands = map[string]func(args []string) error{
+	"dry-run":         runDryRun,
+	"inspect":         runInspect,
+	"journal":         runJournal,
+	"validate-config": runValidateConfig,
+}
+
+// runCommand runs the subcommand of cephcsi that is named by the first
+// argument, and exits.
+func runCommand(args []string) {
+	run, ok := commands[args[0]]
+	if !ok {
+		logAndExit(fmt.Sprintf("unknown command %q", args[0]))
+	}
+	err := run(args[1:])
+	if err != nil {
+		logAndExit(fmt.Sprintf("%s: %v", args[0], err))
+	}
+
+	os.Exit(0)
+}
+
+// secretsDirUsage is the usage of the --secretsdir flag of the commands.
+const secretsDirUsage = "directory with the userID and userKey (or adminID and adminKey) files," +
+	" defaults to the credentialsDir of the cluster in the CSI config file"
+
+// commandCredentials returns the credentials for the cluster, from the files
+// in secretsDir, or from the credentials directory of the cluster in the CSI
+// config file. The caller needs to delete the credentials.
+func commandCredentials(secretsDir, clusterID string) (*util.Credentials, error) {
+	var (
+		cr  *util.Credentials
+		err error
+	)
+	if secretsDir != "" {
+		cr, err = util.NewCredentialsFromDir(secretsDir)
+	} else {
+		cr, err = util.NewCredentialsFromFiles(util.CsiConfigFile, clusterID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the credentials of cluster %q: %w", clusterID, err)
+	}
+
+	return cr, nil
+}
+
+// initJournals initializes the journals of the driver type, for the
+// commands that use the journals.
+func initJournals() error {
+	switch conf.Vtype {
+	case rbdType:
+		rbd.InitJournals(conf.InstanceID)
+	case cephFSType:
+		cephfs.InitJournals(conf.InstanceID)
+	default:
+		return fmt.Errorf("the command needs --type=%s or --type=%s", rbdType, cephFSType)
+	}
+
+	return nil
+}
@@ -0,0 +1,439 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs"
+	rbddriver "github.com/ceph/ceph-csi/internal/rbd/driver"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// csiParameterPrefix is the prefix of the StorageClass parameters that
+	// the external-provisioner handles itself.
+	csiParameterPrefix = "csi.storage.k8s.io/"
+	// fsTypeParameter is the StorageClass parameter with the filesystem
+	// type of the volume.
+	fsTypeParameter = csiParameterPrefix + "fstype"
+	// defaultFsType is the --default-fstype of the external-provisioner in
+	// the deployments of Ceph-CSI.
+	defaultFsType = "ext4"
+)
+
+// dryRunOptions are the flags of the dry-run command.
+type dryRunOptions struct {
+	storageClass   string
+	pvc            string
+	parameters     string
+	size           string
+	accessMode     string
+	block          bool
+	fsType         string
+	name           string
+	sourceVolume   string
+	sourceSnapshot string
+	secretsDir     string
+}
+
+// runDryRun builds a CreateVolume request like the external-provisioner
+// does for a PVC, and walks the decisions of CreateVolume for it, without
+// creating anything. The report is printed, an error is returned when
+// CreateVolume would fail.
+func runDryRun(args []string) error {
+	opts := dryRunOptions{}
+	fs := flag.NewFlagSet("dry-run", flag.ExitOnError)
+	fs.StringVar(&opts.storageClass, "storageclass", "", "name of the StorageClass with the parameters of the volume")
+	fs.StringVar(&opts.pvc, "pvc", "", "<namespace>/<name> of a PVC to provision, sets the StorageClass, size, "+
+		"access mode, volume mode and data source")
+	fs.StringVar(&opts.parameters, "parameters", "",
+		"comma separated <key>=<value> parameters, added to those of the StorageClass")
+	fs.StringVar(&opts.size, "size", "1Gi", "size of the volume")
+	fs.StringVar(&opts.accessMode, "access-mode", string(v1.ReadWriteOnce), "access mode of the volume")
+	fs.BoolVar(&opts.block, "block", false, "the volume is a raw block volume")
+	fs.StringVar(&opts.fsType, "fstype", "", "filesystem of the volume, defaults to that of the StorageClass, or "+
+		defaultFsType)
+	fs.StringVar(&opts.name, "name", "pvc-dry-run", "request name of the volume")
+	fs.StringVar(&opts.sourceVolume, "source-volume", "", "handle of the volume to clone")
+	fs.StringVar(&opts.sourceSnapshot, "source-snapshot", "", "handle of the snapshot to restore")
+	fs.StringVar(&opts.secretsDir, "secretsdir", "", "directory with the userID and userKey (or adminID and "+
+		"adminKey) files, defaults to the provisioner secret of the StorageClass, or the credentialsDir of the "+
+		"cluster in the CSI config file")
+	output := fs.String("output", "text", "output format [text|json]")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cephcsi --type=<rbd|cephfs> dry-run [flags]")
+		fs.PrintDefaults()
+	}
+	// ExitOnError, Parse does not return an error
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+
+		return errors.New("dry-run does not take arguments")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", *output)
+	}
+	conf.DriverName = getDriverName()
+
+	err := initJournals()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	req, err := opts.createVolumeRequest(ctx)
+	if err != nil {
+		return err
+	}
+
+	var report *util.DryRunReport
+	if conf.Vtype == rbdType {
+		cs, csErr := rbddriver.NewDryRunControllerServer(&conf)
+		if csErr != nil {
+			return csErr
+		}
+		report = cs.DryRunCreateVolume(ctx, req)
+	} else {
+		cs, csErr := cephfs.NewDryRunControllerServer(&conf)
+		if csErr != nil {
+			return csErr
+		}
+		report = cs.DryRunCreateVolume(ctx, req)
+	}
+
+	err = report.Write(os.Stdout, *output)
+	if err != nil {
+		return err
+	}
+	if report.Failed() {
+		return errors.New(report.Outcome)
+	}
+
+	return nil
+}
+
+// createVolumeRequest returns the CreateVolume request for the options, with
+// the StorageClass and PVC that are read from Kubernetes.
+func (opts *dryRunOptions) createVolumeRequest(ctx context.Context) (*csi.CreateVolumeRequest, error) {
+	var (
+		client *kubernetes.Clientset
+		pvc    *v1.PersistentVolumeClaim
+		err    error
+	)
+	if opts.storageClass != "" || opts.pvc != "" {
+		client, err = k8s.NewK8sClient()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req := &csi.CreateVolumeRequest{
+		Name:       opts.name,
+		Parameters: map[string]string{},
+	}
+	if opts.pvc != "" {
+		pvc, err = getDryRunPVC(ctx, client, opts.pvc)
+		if err != nil {
+			return nil, err
+		}
+		err = opts.setFromPVC(ctx, client, pvc, req)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		size, qErr := resource.ParseQuantity(opts.size)
+		if qErr != nil {
+			return nil, fmt.Errorf("invalid size %q: %w", opts.size, qErr)
+		}
+		req.CapacityRange = &csi.CapacityRange{RequiredBytes: size.Value()}
+	}
+
+	var mountOptions []string
+	var secretName, secretNamespace string
+	if opts.storageClass != "" {
+		sc, scErr := client.StorageV1().StorageClasses().Get(ctx, opts.storageClass, metav1.GetOptions{})
+		if scErr != nil {
+			return nil, fmt.Errorf("failed to get StorageClass %s: %w", opts.storageClass, scErr)
+		}
+		mountOptions = sc.MountOptions
+		for key, value := range sc.Parameters {
+			switch key {
+			case csiParameterPrefix + "provisioner-secret-name":
+				secretName = value
+			case csiParameterPrefix + "provisioner-secret-namespace":
+				secretNamespace = value
+			case fsTypeParameter:
+				if opts.fsType == "" {
+					opts.fsType = value
+				}
+			}
+			// the external-provisioner handles the prefixed parameters
+			if !strings.HasPrefix(key, csiParameterPrefix) {
+				req.Parameters[key] = value
+			}
+		}
+	}
+	for _, kv := range splitList(opts.parameters) {
+		key, value, found := strings.Cut(kv, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid parameter %q, should be <key>=<value>", kv)
+		}
+		req.Parameters[key] = value
+	}
+	if pvc != nil {
+		for key, value := range k8s.PrepareVolumeMetadata(pvc.Name, pvc.Namespace, req.Name) {
+			req.Parameters[key] = value
+		}
+	}
+
+	req.VolumeCapabilities, err = opts.volumeCapabilities(mountOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = opts.setContentSource(req)
+	if err != nil {
+		return nil, err
+	}
+	req.Secrets, err = opts.secrets(ctx, client, req.Parameters["clusterID"], secretName, secretNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// getDryRunPVC returns the PVC of the <namespace>/<name> reference.
+func getDryRunPVC(ctx context.Context, client *kubernetes.Clientset, ref string) (*v1.PersistentVolumeClaim, error) {
+	namespace, name, found := strings.Cut(ref, "/")
+	if !found || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid PVC %q, should be <namespace>/<name>", ref)
+	}
+	pvc, err := client.CoreV1().PersistentVolumeClaims(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get PVC %s: %w", ref, err)
+	}
+
+	return pvc, nil
+}
+
+// setFromPVC sets the options and the request from the PVC, like the
+// external-provisioner, which names the PV after the UID of the PVC. Options
+// that are set on the command line are not changed.
+func (opts *dryRunOptions) setFromPVC(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	pvc *v1.PersistentVolumeClaim,
+	req *csi.CreateVolumeRequest,
+) error {
+	req.Name = "pvc-" + string(pvc.UID)
+	if opts.storageClass == "" && pvc.Spec.StorageClassName != nil {
+		opts.storageClass = *pvc.Spec.StorageClassName
+	}
+	if size, ok := pvc.Spec.Resources.Requests[v1.ResourceStorage]; ok {
+		req.CapacityRange = &csi.CapacityRange{RequiredBytes: size.Value()}
+	}
+	if len(pvc.Spec.AccessModes) != 0 {
+		opts.accessMode = string(pvc.Spec.AccessModes[0])
+	}
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock {
+		opts.block = true
+	}
+
+	ds := pvc.Spec.DataSource
+	if ds == nil || opts.sourceVolume != "" || opts.sourceSnapshot != "" {
+		return nil
+	}
+	switch ds.Kind {
+	case "PersistentVolumeClaim":
+		source, err := client.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(ctx, ds.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get data source PVC %s/%s: %w", pvc.Namespace, ds.Name, err)
+		}
+		pv, err := client.CoreV1().PersistentVolumes().Get(ctx, source.Spec.VolumeName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get PV of data source PVC %s/%s: %w", pvc.Namespace, ds.Name, err)
+		}
+		if pv.Spec.CSI == nil {
+			return fmt.Errorf("PV %s of data source PVC %s/%s is not a CSI volume", pv.Name, pvc.Namespace, ds.Name)
+		}
+		opts.sourceVolume = pv.Spec.CSI.VolumeHandle
+	case "VolumeSnapshot":
+		handle, err := getSnapshotHandle(ctx, pvc.Namespace, ds.Name)
+		if err != nil {
+			return err
+		}
+		opts.sourceSnapshot = handle
+	default:
+		return fmt.Errorf("data source %s %s of PVC %s/%s is not supported", ds.Kind, ds.Name, pvc.Namespace, pvc.Name)
+	}
+
+	return nil
+}
+
+var (
+	volumeSnapshotsResource = schema.GroupVersionResource{
+		Group:    "snapshot.storage.k8s.io",
+		Version:  "v1",
+		Resource: "volumesnapshots",
+	}
+	volumeSnapshotContentsResource = schema.GroupVersionResource{
+		Group:    "snapshot.storage.k8s.io",
+		Version:  "v1",
+		Resource: "volumesnapshotcontents",
+	}
+)
+
+// getSnapshotHandle returns the snapshot handle of the VolumeSnapshotContent
+// that the VolumeSnapshot is bound to.
+func getSnapshotHandle(ctx context.Context, namespace, name string) (string, error) {
+	c, err := k8s.NewDynamicClient()
+	if err != nil {
+		return "", err
+	}
+	obj, err := c.Resource(volumeSnapshotsResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get VolumeSnapshot %s/%s: %w", namespace, name, err)
+	}
+	vs := &snapapi.VolumeSnapshot{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, vs)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse VolumeSnapshot %s/%s: %w", namespace, name, err)
+	}
+	if vs.Status == nil || vs.Status.BoundVolumeSnapshotContentName == nil {
+		return "", fmt.Errorf("VolumeSnapshot %s/%s is not bound to a VolumeSnapshotContent", namespace, name)
+	}
+
+	contentName := *vs.Status.BoundVolumeSnapshotContentName
+	obj, err = c.Resource(volumeSnapshotContentsResource).Get(ctx, contentName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get VolumeSnapshotContent %s: %w", contentName, err)
+	}
+	content := &snapapi.VolumeSnapshotContent{}
+	err = runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse VolumeSnapshotContent %s: %w", contentName, err)
+	}
+	if content.Status == nil || content.Status.SnapshotHandle == nil {
+		return "", fmt.Errorf("VolumeSnapshotContent %s does not have a snapshot handle", contentName)
+	}
+
+	return *content.Status.SnapshotHandle, nil
+}
+
+// volumeCapabilities returns the capabilities of the access mode and the
+// volume mode, mapped like the external-provisioner does.
+func (opts *dryRunOptions) volumeCapabilities(mountOptions []string) ([]*csi.VolumeCapability, error) {
+	var mode csi.VolumeCapability_AccessMode_Mode
+	switch v1.PersistentVolumeAccessMode(opts.accessMode) {
+	case v1.ReadWriteOnce:
+		mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER
+	case v1.ReadWriteOncePod:
+		mode = csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER
+	case v1.ReadOnlyMany:
+		mode = csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY
+	case v1.ReadWriteMany:
+		mode = csi.VolumeCapability_AccessMode_MULTI_NODE_MULTI_WRITER
+	default:
+		return nil, fmt.Errorf("invalid access mode %q", opts.accessMode)
+	}
+
+	volCap := &csi.VolumeCapability{
+		AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode},
+	}
+	if opts.block {
+		volCap.AccessType = &csi.VolumeCapability_Block{Block: &csi.VolumeCapability_BlockVolume{}}
+	} else {
+		fsType := opts.fsType
+		if fsType == "" {
+			fsType = defaultFsType
+		}
+		volCap.AccessType = &csi.VolumeCapability_Mount{
+			Mount: &csi.VolumeCapability_MountVolume{FsType: fsType, MountFlags: mountOptions},
+		}
+	}
+
+	return []*csi.VolumeCapability{volCap}, nil
+}
+
+// setContentSource sets the volume or snapshot to clone or restore.
+func (opts *dryRunOptions) setContentSource(req *csi.CreateVolumeRequest) error {
+	switch {
+	case opts.sourceVolume != "" && opts.sourceSnapshot != "":
+		return errors.New("only one of --source-volume and --source-snapshot can be set")
+	case opts.sourceVolume != "":
+		req.VolumeContentSource = &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Volume{
+				Volume: &csi.VolumeContentSource_VolumeSource{VolumeId: opts.sourceVolume},
+			},
+		}
+	case opts.sourceSnapshot != "":
+		req.VolumeContentSource = &csi.VolumeContentSource{
+			Type: &csi.VolumeContentSource_Snapshot{
+				Snapshot: &csi.VolumeContentSource_SnapshotSource{SnapshotId: opts.sourceSnapshot},
+			},
+		}
+	}
+
+	return nil
+}
+
+// secrets returns the secrets of the request, from --secretsdir, the
+// provisioner secret of the StorageClass, or the credentials directory of
+// the cluster.
+func (opts *dryRunOptions) secrets(
+	ctx context.Context,
+	client *kubernetes.Clientset,
+	clusterID, name, namespace string,
+) (map[string]string, error) {
+	if opts.secretsDir != "" {
+		return util.ReadCredentialsDir(opts.secretsDir)
+	}
+
+	if name == "" {
+		return util.GetCredentialsFromFiles(util.CsiConfigFile, clusterID)
+	}
+	if strings.Contains(name+namespace, "${") {
+		return nil, fmt.Errorf("the provisioner secret %s/%s of the StorageClass is a template, use --secretsdir",
+			namespace, name)
+	}
+	secret, err := client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the provisioner secret %s/%s: %w", namespace, name, err)
+	}
+	secrets := make(map[string]string, len(secret.Data))
+	for key, value := range secret.Data {
+		secrets[key] = string(value)
+	}
+
+	return secrets, nil
+}
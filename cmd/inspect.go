@@ -0,0 +1,80 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// runInspect decodes a volume or snapshot handle, and prints the image,
+// snapshot or subvolume that it refers to, as found in the journal.
+func runInspect(args []string) error {
+	fs := flag.NewFlagSet("inspect", flag.ExitOnError)
+	snapshot := fs.Bool("snapshot", false, "the handle is the handle of a snapshot")
+	secretsDir := fs.String("secretsdir", "", secretsDirUsage)
+	output := fs.String("output", "text", "output format [text|json]")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cephcsi --type=<rbd|cephfs> inspect [flags] <handle>")
+		fs.PrintDefaults()
+	}
+	// ExitOnError, Parse does not return an error
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+
+		return errors.New("inspect needs a single volume or snapshot handle")
+	}
+	handle := fs.Arg(0)
+
+	info, err := util.NewHandleInfo(handle)
+	if err != nil {
+		return err
+	}
+
+	err = initJournals()
+	if err != nil {
+		return err
+	}
+	cr, err := commandCredentials(*secretsDir, info.ClusterID)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	if conf.Vtype == rbdType {
+		info, err = rbd.InspectHandle(context.Background(), handle, *snapshot, cr)
+	} else {
+		info, err = store.InspectHandle(context.Background(), handle, *snapshot, cr)
+	}
+	// the fields that are decoded from the handle help to find the
+	// journal, even when the lookup failed
+	if info != nil {
+		if wErr := info.Write(os.Stdout, *output); wErr != nil {
+			return wErr
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// runJournal checks the journals of a cluster for orphaned entries and
+// dangling images or subvolumes. "journal check" only reports the problems,
+// "journal repair" repairs them when --apply is passed, and is a dry-run
+// otherwise. Dangling images are only moved to the trash when they are passed
+// with --trash.
+func runJournal(args []string) error {
+	usage := "Usage: cephcsi --type=<rbd|cephfs> journal <check|repair> [flags]"
+	if len(args) == 0 || (args[0] != "check" && args[0] != "repair") {
+		fmt.Fprintln(os.Stderr, usage)
+
+		return errors.New("journal needs the check or repair action")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("journal "+action, flag.ExitOnError)
+	clusterID := fs.String("clusterid", "", "ID of the cluster in the CSI config file")
+	secretsDir := fs.String("secretsdir", "", secretsDirUsage)
+	output := fs.String("output", "text", "output format [text|json]")
+	minAge := fs.Duration("minage", time.Hour,
+		"minimum age of the reservations and images that are checked, younger ones may still be created or deleted")
+	apply := new(bool)
+	trashList := new(string)
+	if action == "repair" {
+		apply = fs.Bool("apply", false, "repair the problems, instead of only reporting what would be repaired")
+		trashList = fs.String("trash", "",
+			"comma separated list of dangling RBD images (<pool>/<name>) that are confirmed to be moved to the trash")
+	}
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	// ExitOnError, Parse does not return an error
+	_ = fs.Parse(args[1:])
+	if *clusterID == "" || fs.NArg() != 0 {
+		fs.Usage()
+
+		return errors.New("journal needs --clusterid")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", *output)
+	}
+	if action == "repair" && !*apply {
+		log.DefaultLog("dry-run, pass --apply to repair the problems")
+	}
+	trash, err := journal.ParseTrashList(*trashList)
+	if err != nil {
+		return err
+	}
+	opts := journal.CheckOptions{
+		Repair: *apply,
+		MinAge: *minAge,
+		Trash:  trash,
+	}
+
+	err = initJournals()
+	if err != nil {
+		return err
+	}
+	cr, err := commandCredentials(*secretsDir, *clusterID)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	var problems []journal.Problem
+	if conf.Vtype == rbdType {
+		problems, err = rbd.CheckJournal(context.Background(), *clusterID, cr, opts)
+	} else {
+		problems, err = store.CheckJournal(context.Background(), *clusterID, cr, opts)
+	}
+	// the problems that were found (and repaired) before a failure are
+	// reported as well
+	if wErr := writeProblems(os.Stdout, problems, *output); wErr != nil {
+		return wErr
+	}
+
+	return err
+}
+
+// writeProblems writes a line for each problem in the text format, or a JSON
+// array of the problems in the json format.
+func writeProblems(w io.Writer, problems []journal.Problem, format string) error {
+	if format == "json" {
+		if problems == nil {
+			problems = []journal.Problem{}
+		}
+
+		return json.NewEncoder(w).Encode(problems)
+	}
+
+	for i := range problems {
+		_, err := fmt.Fprintln(w, describeProblem(&problems[i]))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// describeProblem returns the kind of the problem, followed by the fields
+// that are set and whether it was repaired.
+func describeProblem(p *journal.Problem) string {
+	kind := string(p.Kind)
+	if p.Snapshot {
+		kind += " (snapshot)"
+	}
+	fields := []string{}
+	for _, f := range []struct{ name, value string }{
+		{"pool", p.Pool},
+		{"journal pool", p.JournalPool},
+		{"request name", p.RequestName},
+		{"UUID", p.UUID},
+		{"name", p.Name},
+	} {
+		if f.value != "" {
+			fields = append(fields, f.name+" "+f.value)
+		}
+	}
+	desc := kind + ": " + strings.Join(fields, ", ")
+	if p.Repaired {
+		desc += " (repaired)"
+	}
+	if p.Skipped != "" {
+		desc += " (not repaired: " + p.Skipped + ")"
+	}
+
+	return desc
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/kms"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// runValidateConfig checks the CSI config file and the KMS configuration,
+// and with --connect whether the clusters can be reached with their
+// credentials, and have the configured pools or filesystems. The findings
+// are printed, an error is returned when there are findings with the error
+// severity.
+func runValidateConfig(args []string) error {
+	fs := flag.NewFlagSet("validate-config", flag.ExitOnError)
+	csiConfig := fs.String("csiconfig", util.CsiConfigFile, "path of the CSI config file")
+	kmsConfig := fs.String("kmsconfig", "",
+		"path of the KMS config file, defaults to the config file or ConfigMap of the driver")
+	connect := fs.Bool("connect", false, "connect to each cluster, needs --type=rbd or --type=cephfs")
+	pools := fs.String("pools", "",
+		"comma separated RBD pools that need to exist in each cluster, besides those of the tenant quotas")
+	filesystems := fs.String("filesystems", "",
+		"comma separated filesystems that need to exist in each cluster, defaults to all filesystems")
+	secretsDir := fs.String("secretsdir", "", secretsDirUsage)
+	output := fs.String("output", "text", "output format [text|json]")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: cephcsi [--type=<rbd|cephfs>] validate-config [flags]")
+		fs.PrintDefaults()
+	}
+	// ExitOnError, Parse does not return an error
+	_ = fs.Parse(args)
+	if fs.NArg() != 0 {
+		fs.Usage()
+
+		return errors.New("validate-config does not take arguments")
+	}
+	if *output != "text" && *output != "json" {
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", *output)
+	}
+	if *connect && conf.Vtype != rbdType && conf.Vtype != cephFSType {
+		return fmt.Errorf("--connect needs --type=%s or --type=%s", rbdType, cephFSType)
+	}
+
+	clusters, findings := util.ValidateCSIConfig(*csiConfig)
+	findings = append(findings, validateKMSConfig(*kmsConfig)...)
+	if *connect {
+		for i := range clusters {
+			findings = append(findings, validateCluster(&clusters[i], *secretsDir, *pools, *filesystems)...)
+		}
+	}
+
+	err := findings.Write(os.Stdout, *output)
+	if err != nil {
+		return err
+	}
+	if !findings.Valid() {
+		return errors.New("the configuration is not valid")
+	}
+
+	return nil
+}
+
+// validateKMSConfig returns the findings of the KMS configuration at the
+// path, or of the driver when the path is empty, ordered by kmsID.
+func validateKMSConfig(path string) util.ConfigFindings {
+	const source = "kms-config"
+	var findings util.ConfigFindings
+	errs, err := kms.ValidateConfiguration(path)
+	if err != nil {
+		findings.Add(util.FindingError, source, "", "%v", err)
+
+		return findings
+	}
+
+	kmsIDs := make([]string, 0, len(errs))
+	for kmsID := range errs {
+		kmsIDs = append(kmsIDs, kmsID)
+	}
+	sort.Strings(kmsIDs)
+	for _, kmsID := range kmsIDs {
+		findings.Add(util.FindingError, source, "", "%s: %v", kmsID, errs[kmsID])
+	}
+
+	return findings
+}
+
+// validateCluster connects to the cluster, and checks that the pools (RBD)
+// or filesystems (CephFS) exist. Clusters without credentials are skipped
+// with a warning.
+func validateCluster(cluster *util.ClusterInfo, secretsDir, pools, filesystems string) util.ConfigFindings {
+	var findings util.ConfigFindings
+	dir := secretsDir
+	if dir == "" {
+		dir = cluster.CredentialsDir
+	}
+	if dir == "" || cluster.ClusterID == "" || len(cluster.Monitors) == 0 {
+		findings.Add(util.FindingWarning, "cluster", cluster.ClusterID,
+			"not connecting, the cluster needs a clusterID, monitors and credentials")
+
+		return findings
+	}
+	cr, err := util.NewCredentialsFromDir(dir)
+	if err != nil {
+		findings.Add(util.FindingError, "cluster", cluster.ClusterID, "%v", err)
+
+		return findings
+	}
+	defer cr.DeleteCredentials()
+
+	names := cluster.TenantQuotaPools()
+	if conf.Vtype == rbdType {
+		names = appendUnique(names, splitList(pools)...)
+
+		return append(findings, rbd.ValidateClusterPools(cluster, names, cr)...)
+	}
+	if filesystems != "" {
+		names = appendUnique(names, splitList(filesystems)...)
+	}
+
+	return append(findings, store.ValidateClusterFilesystems(cluster, names, cr)...)
+}
+
+// splitList returns the non-empty elements of the comma separated list.
+func splitList(list string) []string {
+	elements := []string{}
+	for _, e := range strings.Split(list, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			elements = append(elements, e)
+		}
+	}
+
+	return elements
+}
+
+// appendUnique appends the values that are not in the list yet.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		found := false
+		for _, e := range list {
+			if e == v {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+
+	return list
+}
@@ -0,0 +1,469 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// errMultiNodeFile is returned by the RBD provisioner for a multi node
+	// writer access mode with a filesystem volume.
+	errMultiNodeFile = "multi node access modes are only supported on rbd `block` type volumes"
+	// errEmptyReadOnly is returned by both provisioners for a read-only
+	// access mode without a data source.
+	errEmptyReadOnly = "readOnly accessMode is supported only with content source"
+	// errBlockNotSupported is returned by the CephFS provisioner for a block
+	// volume.
+	errBlockNotSupported = "block volume not supported"
+
+	// accessModeBlockSize is the size of the marker that is written to, and
+	// read from, a block volume with direct IO.
+	accessModeBlockSize = 512
+	accessModeMarker    = "access-mode-marker"
+)
+
+// accessModeTestCase is a combination of an access mode and a volume mode of
+// a PVC, and the expected behavior of the driver.
+type accessModeTestCase struct {
+	accessMode v1.PersistentVolumeAccessMode
+	volumeMode v1.PersistentVolumeMode
+	// fromSource creates the PVC as a clone of a PVC with data, read-only
+	// volumes can not be provisioned empty
+	fromSource bool
+	// rejected is part of the error of the provisioner when the driver does
+	// not support the combination, or empty when it does
+	rejected string
+}
+
+func (tc *accessModeTestCase) String() string {
+	source := ""
+	if tc.fromSource {
+		source = " from a data source"
+	}
+
+	return fmt.Sprintf("%s %s volume%s", tc.accessMode, tc.volumeMode, source)
+}
+
+// rbdAccessModes are the access modes of RBD volumes. Multiple writers are
+// only allowed for block volumes, the applications need to coordinate the
+// access.
+var rbdAccessModes = []accessModeTestCase{
+	{accessMode: v1.ReadWriteOnce, volumeMode: v1.PersistentVolumeFilesystem},
+	{accessMode: v1.ReadWriteOnce, volumeMode: v1.PersistentVolumeBlock},
+	{accessMode: v1.ReadWriteOncePod, volumeMode: v1.PersistentVolumeFilesystem},
+	{accessMode: v1.ReadWriteOncePod, volumeMode: v1.PersistentVolumeBlock},
+	{accessMode: v1.ReadWriteMany, volumeMode: v1.PersistentVolumeBlock},
+	{accessMode: v1.ReadWriteMany, volumeMode: v1.PersistentVolumeFilesystem, rejected: errMultiNodeFile},
+	{accessMode: v1.ReadOnlyMany, volumeMode: v1.PersistentVolumeFilesystem, fromSource: true},
+	{accessMode: v1.ReadOnlyMany, volumeMode: v1.PersistentVolumeBlock, fromSource: true},
+	{accessMode: v1.ReadOnlyMany, volumeMode: v1.PersistentVolumeFilesystem, rejected: errEmptyReadOnly},
+}
+
+// cephFSAccessModes are the access modes of CephFS volumes, which can not be
+// block volumes.
+var cephFSAccessModes = []accessModeTestCase{
+	{accessMode: v1.ReadWriteOnce, volumeMode: v1.PersistentVolumeFilesystem},
+	{accessMode: v1.ReadWriteOncePod, volumeMode: v1.PersistentVolumeFilesystem},
+	{accessMode: v1.ReadWriteMany, volumeMode: v1.PersistentVolumeFilesystem},
+	{accessMode: v1.ReadOnlyMany, volumeMode: v1.PersistentVolumeFilesystem, fromSource: true},
+	{accessMode: v1.ReadOnlyMany, volumeMode: v1.PersistentVolumeFilesystem, rejected: errEmptyReadOnly},
+	{accessMode: v1.ReadWriteOnce, volumeMode: v1.PersistentVolumeBlock, rejected: errBlockNotSupported},
+	{accessMode: v1.ReadWriteMany, volumeMode: v1.PersistentVolumeBlock, rejected: errBlockNotSupported},
+}
+
+// accessModeApps returns the number of applications that use the PVC at the
+// same time. The second application of a ReadWriteOncePod PVC should not
+// start.
+func accessModeApps(accessMode v1.PersistentVolumeAccessMode) int {
+	switch accessMode {
+	case v1.ReadWriteMany, v1.ReadOnlyMany:
+		return 2
+	default:
+		return 1
+	}
+}
+
+// accessModeWriteCommand returns the command that writes the marker to the
+// file, or to the start of the block device. The block device is written with
+// direct IO, so that applications on other nodes read the marker.
+func accessModeWriteCommand(target, marker string, block bool) string {
+	if block {
+		return fmt.Sprintf("printf '%%-%[1]ds' %[2]s | dd of=%[3]s bs=%[1]d count=1 oflag=direct status=none",
+			accessModeBlockSize, marker, target)
+	}
+
+	return fmt.Sprintf("printf %s > %s && sync", marker, target)
+}
+
+// accessModeReadCommand returns the command that reads the marker from the
+// file, or from the start of the block device.
+func accessModeReadCommand(target string, block bool) string {
+	if block {
+		return fmt.Sprintf("dd if=%s bs=%d count=1 iflag=direct status=none", target, accessModeBlockSize)
+	}
+
+	return "cat " + target
+}
+
+// accessModeTarget returns the device or the file in the volume of the app
+// that the marker is written to.
+func accessModeTarget(app *v1.Pod) (string, bool) {
+	container := app.Spec.Containers[0]
+	if len(container.VolumeDevices) != 0 {
+		return container.VolumeDevices[0].DevicePath, true
+	}
+
+	return container.VolumeMounts[0].MountPath + "/" + accessModeMarker, false
+}
+
+// writeAccessModeMarker writes the marker in the volume of the app.
+func writeAccessModeMarker(f *framework.Framework, app *v1.Pod, marker string) error {
+	target, block := accessModeTarget(app)
+	_, stdErr, err := execCommandInPodWithName(
+		f,
+		accessModeWriteCommand(target, marker, block),
+		app.Name,
+		app.Spec.Containers[0].Name,
+		app.Namespace)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to write %s in application %s: %v, stdErr: %s", target, app.Name, err, stdErr)
+	}
+
+	return nil
+}
+
+// checkAccessModeMarker reads the marker from the volume of the app.
+func checkAccessModeMarker(f *framework.Framework, app *v1.Pod, marker string) error {
+	target, block := accessModeTarget(app)
+	stdOut, stdErr, err := execCommandInPodWithName(
+		f,
+		accessModeReadCommand(target, block),
+		app.Name,
+		app.Spec.Containers[0].Name,
+		app.Namespace)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to read %s in application %s: %v, stdErr: %s", target, app.Name, err, stdErr)
+	}
+	if strings.TrimSpace(stdOut) != marker {
+		return fmt.Errorf("application %s read %q from %s, expected %q", app.Name, stdOut, target, marker)
+	}
+
+	return nil
+}
+
+// loadAccessModePVC returns the PVC of the test case.
+func loadAccessModePVC(
+	f *framework.Framework,
+	tc *accessModeTestCase,
+	pvcPath, name string,
+) (*v1.PersistentVolumeClaim, error) {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Name = name
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{tc.accessMode}
+	volumeMode := tc.volumeMode
+	pvc.Spec.VolumeMode = &volumeMode
+	pvc.Spec.DataSource = nil
+
+	return pvc, nil
+}
+
+// loadAccessModeApp returns an application that uses the PVC, as a device
+// for a block volume.
+func loadAccessModeApp(
+	f *framework.Framework,
+	pvc *v1.PersistentVolumeClaim,
+	appPath, rawAppPath, name string,
+) (*v1.Pod, error) {
+	path := appPath
+	if pvc.Spec.VolumeMode != nil && *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock {
+		path = rawAppPath
+	}
+	app, err := loadApp(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Name = name
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": name}
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+
+	return app, nil
+}
+
+// pvcRejected returns the condition that is met once the provisioner
+// records an event for the PVC with the error. The PVC should not be bound.
+func pvcRejected(pvc *v1.PersistentVolumeClaim, rejected string) stateCondition[*v1.EventList] {
+	return stateCondition[*v1.EventList]{
+		name: "rejected",
+		met: func(events *v1.EventList) (bool, error) {
+			for i := range events.Items {
+				if strings.Contains(events.Items[i].Message, rejected) {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+		describe: func(events *v1.EventList) string {
+			messages := make([]string, 0, len(events.Items))
+			for i := range events.Items {
+				messages = append(messages, events.Items[i].Reason+": "+events.Items[i].Message)
+			}
+
+			return fmt.Sprintf("events of PVC %s: %v", pvc.Name, messages)
+		},
+	}
+}
+
+// validateRejectedAccessMode creates the PVC of the test case, and checks
+// that the provisioner fails to create the volume with the expected error.
+func validateRejectedAccessMode(f *framework.Framework, tc *accessModeTestCase, pvcPath string) error {
+	pvc, err := loadAccessModePVC(f, tc, pvcPath, "access-mode-rejected")
+	if err != nil {
+		return err
+	}
+
+	return validateRejectedPVC(f, pvc, tc.rejected)
+}
+
+// validateRejectedPVC creates the PVC, and checks that the provisioner fails
+// to create the volume with the rejected error. The PVC is deleted
+// afterwards.
+func validateRejectedPVC(f *framework.Framework, pvc *v1.PersistentVolumeClaim, rejected string) error {
+	return validateRejectedPVCWithin(f, pvc, rejected, time.Duration(deployTimeout)*time.Minute)
+}
+
+// validateRejectedPVCWithin is validateRejectedPVC, where the provisioner
+// needs to fail with the rejected error within the timeout.
+func validateRejectedPVCWithin(
+	f *framework.Framework,
+	pvc *v1.PersistentVolumeClaim,
+	rejected string,
+	timeout time.Duration,
+) error {
+	pvcs := f.ClientSet.CoreV1().PersistentVolumeClaims(pvc.Namespace)
+	_, err := pvcs.Create(context.TODO(), pvc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create PVC %s: %w", pvc.Name, err)
+	}
+
+	_, err = waitForState(
+		"PVC "+pvc.Name,
+		func() (*v1.EventList, error) {
+			return f.ClientSet.CoreV1().Events(pvc.Namespace).List(context.TODO(), metav1.ListOptions{
+				FieldSelector: "involvedObject.kind=PersistentVolumeClaim,involvedObject.name=" + pvc.Name,
+			})
+		},
+		pvcRejected(pvc, rejected),
+		timeout)
+	if err != nil {
+		return err
+	}
+	claim, err := pvcs.Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get PVC %s: %w", pvc.Name, err)
+	}
+	if claim.Status.Phase != v1.ClaimPending {
+		return fmt.Errorf("PVC %s is %s, expected it to stay pending", pvc.Name, claim.Status.Phase)
+	}
+
+	err = pvcs.Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC %s: %w", pvc.Name, err)
+	}
+
+	return waitForDeletion("PVC "+pvc.Name, func() (*v1.PersistentVolumeClaim, error) {
+		return pvcs.Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	}, time.Duration(deployTimeout)*time.Minute)
+}
+
+// createAccessModeSource creates a ReadWriteOnce PVC with the marker, as data
+// source for a read-only PVC.
+func createAccessModeSource(
+	f *framework.Framework,
+	tc *accessModeTestCase,
+	pvcPath, appPath, rawAppPath string,
+) (*v1.PersistentVolumeClaim, error) {
+	source := accessModeTestCase{accessMode: v1.ReadWriteOnce, volumeMode: tc.volumeMode}
+	pvc, err := loadAccessModePVC(f, &source, pvcPath, "access-mode-source")
+	if err != nil {
+		return nil, err
+	}
+	app, err := loadAccessModeApp(f, pvc, appPath, rawAppPath, "access-mode-source")
+	if err != nil {
+		return nil, err
+	}
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source PVC and application: %w", err)
+	}
+	err = writeAccessModeMarker(f, app, accessModeMarker)
+	if err != nil {
+		return nil, err
+	}
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete application %s: %w", app.Name, err)
+	}
+
+	return pvc, nil
+}
+
+// validateAccessModeApps checks the IO of the applications of the test case.
+// All applications read the marker that each writer wrote, a read-only
+// volume has the marker of its data source and can not be written.
+func validateAccessModeApps(f *framework.Framework, tc *accessModeTestCase, apps []*v1.Pod) error {
+	if tc.accessMode == v1.ReadOnlyMany {
+		for _, app := range apps {
+			err := checkAccessModeMarker(f, app, accessModeMarker)
+			if err != nil {
+				return err
+			}
+			err = writeAccessModeMarker(f, app, app.Name)
+			if err == nil {
+				return fmt.Errorf("application %s could write to the %s", app.Name, tc)
+			}
+			e2elog.Logf("writing to the %s failed as expected: %v", tc, err)
+		}
+
+		return nil
+	}
+
+	for _, writer := range apps {
+		err := writeAccessModeMarker(f, writer, writer.Name)
+		if err != nil {
+			return err
+		}
+		for _, reader := range apps {
+			err = checkAccessModeMarker(f, reader, writer.Name)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// validateAccessMode creates the PVC of the test case for its applications,
+// and checks their IO. The second application of a ReadWriteOncePod PVC must
+// fail to start.
+func validateAccessMode(f *framework.Framework, tc *accessModeTestCase, pvcPath, appPath, rawAppPath string) error {
+	pvc, err := loadAccessModePVC(f, tc, pvcPath, "access-mode")
+	if err != nil {
+		return err
+	}
+	if tc.fromSource {
+		source, sourceErr := createAccessModeSource(f, tc, pvcPath, appPath, rawAppPath)
+		if sourceErr != nil {
+			return sourceErr
+		}
+		defer func() {
+			sourceErr = deletePVCAndValidatePV(f.ClientSet, source, deployTimeout)
+			if sourceErr != nil {
+				e2elog.Failf("failed to delete source PVC %s: %v", source.Name, sourceErr)
+			}
+		}()
+		pvc.Spec.DataSource = &v1.TypedLocalObjectReference{
+			Kind: "PersistentVolumeClaim",
+			Name: source.Name,
+		}
+	}
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		if tc.accessMode == v1.ReadWriteOncePod && rwopMayFail(err) {
+			e2elog.Logf("RWOP is not supported: %v", err)
+
+			return nil
+		}
+
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+
+	apps := make([]*v1.Pod, 0, accessModeApps(tc.accessMode))
+	for i := 0; i < cap(apps); i++ {
+		app, loadErr := loadAccessModeApp(f, pvc, appPath, rawAppPath, fmt.Sprintf("access-mode-%d", i))
+		if loadErr != nil {
+			return loadErr
+		}
+		err = createApp(f.ClientSet, app, deployTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to create application %s: %w", app.Name, err)
+		}
+		apps = append(apps, app)
+	}
+
+	err = validateAccessModeApps(f, tc, apps)
+	if err != nil {
+		return err
+	}
+
+	if tc.accessMode == v1.ReadWriteOncePod {
+		// deletes the first application and the PVC as well
+		return validateRWOPPodCreation(f, pvc, apps[0], apps[0].Name)
+	}
+	for _, app := range apps {
+		err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to delete application %s: %w", app.Name, err)
+		}
+	}
+	err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+
+	return nil
+}
+
+// validateAccessModes validates each test case of the matrix. The paths are
+// the PVC and the application of a filesystem volume, and the application of
+// a block volume, which is only needed when block volumes are supported.
+func validateAccessModes(
+	f *framework.Framework,
+	matrix []accessModeTestCase,
+	pvcPath, appPath, rawAppPath string,
+) error {
+	for i := range matrix {
+		tc := &matrix[i]
+		e2elog.Logf("validating %s", tc)
+		var err error
+		if tc.rejected != "" {
+			err = validateRejectedAccessMode(f, tc, pvcPath)
+		} else {
+			err = validateAccessMode(f, tc, pvcPath, appPath, rawAppPath)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc, err)
+		}
+	}
+
+	return nil
+}
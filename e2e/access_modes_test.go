@@ -0,0 +1,55 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestAccessModeCommands(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name  string
+		block bool
+		write string
+		read  string
+	}{
+		{
+			name:  "filesystem",
+			write: "printf app-0 > /mnt/marker && sync",
+			read:  "cat /mnt/marker",
+		},
+		{
+			name:  "block",
+			block: true,
+			write: "printf '%-512s' app-0 | dd of=/mnt/marker bs=512 count=1 oflag=direct status=none",
+			read:  "dd if=/mnt/marker bs=512 count=1 iflag=direct status=none",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := accessModeWriteCommand("/mnt/marker", "app-0", ts.block); got != ts.write {
+				t.Errorf("accessModeWriteCommand() = %q, want %q", got, ts.write)
+			}
+			if got := accessModeReadCommand("/mnt/marker", ts.block); got != ts.read {
+				t.Errorf("accessModeReadCommand() = %q, want %q", got, ts.read)
+			}
+		})
+	}
+}
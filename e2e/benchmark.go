@@ -0,0 +1,260 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+var (
+	// benchmarkCount is the number of PVCs and snapshots that the benchmark
+	// creates, the benchmark is disabled when it is 0.
+	benchmarkCount int
+	// benchmarkWorkers is the number of operations that the benchmark
+	// runs at the same time.
+	benchmarkWorkers int
+)
+
+// benchmarkOperations are the operations that the benchmark measures, in the
+// order they are executed on all PVCs.
+var benchmarkOperations = []string{
+	"create PVC",
+	"attach PVC",
+	"detach PVC",
+	"create snapshot",
+	"delete snapshot",
+	"delete PVC",
+}
+
+// latencyStats are the latency percentiles of an operation. The durations
+// are in nanoseconds in the JSON report.
+type latencyStats struct {
+	Operation string        `json:"operation"`
+	Count     int           `json:"count"`
+	Failed    int           `json:"failed"`
+	P50       time.Duration `json:"p50"`
+	P90       time.Duration `json:"p90"`
+	P99       time.Duration `json:"p99"`
+	Max       time.Duration `json:"max"`
+}
+
+// percentile returns the nearest-rank percentile p (0-100) of the sorted
+// durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+
+	return sorted[rank-1]
+}
+
+// newLatencyStats calculates the percentiles of the durations of the
+// operations that succeeded.
+func newLatencyStats(operation string, durations []time.Duration, failed int) latencyStats {
+	sorted := make([]time.Duration, len(durations))
+	copy(sorted, durations)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	return latencyStats{
+		Operation: operation,
+		Count:     len(sorted),
+		Failed:    failed,
+		P50:       percentile(sorted, 50),
+		P90:       percentile(sorted, 90),
+		P99:       percentile(sorted, 99),
+		Max:       percentile(sorted, 100),
+	}
+}
+
+// formatLatencyStats returns the stats as a table.
+func formatLatencyStats(stats []latencyStats) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%-16s %6s %6s %10s %10s %10s %10s\n", "operation", "count", "failed", "p50", "p90", "p99", "max")
+	for _, s := range stats {
+		fmt.Fprintf(&sb, "%-16s %6d %6d %10s %10s %10s %10s\n",
+			s.Operation,
+			s.Count,
+			s.Failed,
+			s.P50.Round(time.Millisecond),
+			s.P90.Round(time.Millisecond),
+			s.P99.Round(time.Millisecond),
+			s.Max.Round(time.Millisecond))
+	}
+
+	return sb.String()
+}
+
+// measureConcurrently calls fn for 0 to count-1, with at most concurrency
+// calls at the same time. It returns the durations of the calls that
+// succeeded, and the errors of the calls that failed.
+func measureConcurrently(count, concurrency int, fn func(i int) error) ([]time.Duration, []error) {
+	var (
+		mutex     sync.Mutex
+		wg        sync.WaitGroup
+		durations []time.Duration
+		errs      []error
+	)
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	tokens := make(chan struct{}, concurrency)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		tokens <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			start := time.Now()
+			err := fn(i)
+			elapsed := time.Since(start)
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+
+				return
+			}
+			durations = append(durations, elapsed)
+		}(i)
+	}
+	wg.Wait()
+
+	return durations, errs
+}
+
+// runBenchmark creates benchmarkCount PVCs, attaches each of them to an
+// application, detaches them, takes a snapshot of each PVC, and deletes the
+// snapshots and PVCs again. Each operation runs on all PVCs, benchmarkWorkers
+// at a time, before the next operation starts. The latency percentiles of the
+// operations are logged, and written to benchmark_<name>.json in
+// --report-dir. The VolumeSnapshotClass for the snapshot needs to exist.
+func runBenchmark(f *framework.Framework, name, pvcPath, appPath, snapshotPath string) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	snap := getSnapshot(snapshotPath)
+
+	pvcs := make([]*v1.PersistentVolumeClaim, benchmarkCount)
+	apps := make([]*v1.Pod, benchmarkCount)
+	snaps := make([]*snapapi.VolumeSnapshot, benchmarkCount)
+	for i := 0; i < benchmarkCount; i++ {
+		objName := fmt.Sprintf("benchmark-%d", i)
+		pvcs[i] = pvc.DeepCopy()
+		pvcs[i].Name = objName
+		pvcs[i].Namespace = f.UniqueName
+		apps[i] = app.DeepCopy()
+		apps[i].Name = objName
+		apps[i].Namespace = f.UniqueName
+		apps[i].Labels = map[string]string{"app": objName}
+		apps[i].Spec.Volumes[0].PersistentVolumeClaim.ClaimName = objName
+		snaps[i] = snap.DeepCopy()
+		snaps[i].Name = objName
+		snaps[i].Namespace = f.UniqueName
+		snaps[i].Spec.Source.PersistentVolumeClaimName = &pvcs[i].Name
+	}
+
+	operations := map[string]func(i int) error{
+		"create PVC": func(i int) error {
+			return createPVCAndvalidatePV(f.ClientSet, pvcs[i], deployTimeout)
+		},
+		"attach PVC": func(i int) error {
+			return createApp(f.ClientSet, apps[i], deployTimeout)
+		},
+		"detach PVC": func(i int) error {
+			return deletePod(apps[i].Name, apps[i].Namespace, f.ClientSet, deployTimeout)
+		},
+		"create snapshot": func(i int) error {
+			return createSnapshot(snaps[i], deployTimeout)
+		},
+		"delete snapshot": func(i int) error {
+			return deleteSnapshot(snaps[i], deployTimeout)
+		},
+		"delete PVC": func(i int) error {
+			return deletePVCAndValidatePV(f.ClientSet, pvcs[i], deployTimeout)
+		},
+	}
+
+	stats := make([]latencyStats, 0, len(benchmarkOperations))
+	var failures []string
+	for _, operation := range benchmarkOperations {
+		e2elog.Logf("benchmark %s: %s of %d objects, %d at a time", name, operation, benchmarkCount, benchmarkWorkers)
+		durations, errs := measureConcurrently(benchmarkCount, benchmarkWorkers, operations[operation])
+		stats = append(stats, newLatencyStats(operation, durations, len(errs)))
+		for _, opErr := range errs {
+			failures = append(failures, fmt.Sprintf("%s: %v", operation, opErr))
+		}
+	}
+
+	e2elog.Logf("benchmark %s with %d PVCs and a concurrency of %d:\n%s",
+		name, benchmarkCount, benchmarkWorkers, formatLatencyStats(stats))
+	err = writeBenchmarkReport(name, stats)
+	if err != nil {
+		e2elog.Logf("failed to write benchmark report: %v", err)
+	}
+
+	if len(failures) != 0 {
+		return fmt.Errorf("%d operations of the benchmark failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+
+	return nil
+}
+
+// writeBenchmarkReport writes the stats to benchmark_<name>.json in
+// --report-dir, so that CI jobs can compare them between runs.
+func writeBenchmarkReport(name string, stats []latencyStats) error {
+	if framework.TestContext.ReportDir == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal benchmark stats: %w", err)
+	}
+	path := filepath.Join(framework.TestContext.ReportDir, "benchmark_"+fileName(name)+".json")
+	err = os.WriteFile(path, data, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+
+	return nil
+}
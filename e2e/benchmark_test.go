@@ -0,0 +1,109 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNewLatencyStats(t *testing.T) {
+	t.Parallel()
+	durations := make([]time.Duration, 0, 100)
+	// unsorted 1s to 100s
+	for i := 100; i > 0; i-- {
+		durations = append(durations, time.Duration(i)*time.Second)
+	}
+
+	tests := []struct {
+		name      string
+		durations []time.Duration
+		expected  latencyStats
+	}{
+		{
+			name:      "no durations",
+			durations: nil,
+			expected:  latencyStats{Operation: "op"},
+		},
+		{
+			name:      "single duration",
+			durations: []time.Duration{time.Second},
+			expected: latencyStats{
+				Operation: "op",
+				Count:     1,
+				P50:       time.Second,
+				P90:       time.Second,
+				P99:       time.Second,
+				Max:       time.Second,
+			},
+		},
+		{
+			name:      "100 durations",
+			durations: durations,
+			expected: latencyStats{
+				Operation: "op",
+				Count:     100,
+				P50:       50 * time.Second,
+				P90:       90 * time.Second,
+				P99:       99 * time.Second,
+				Max:       100 * time.Second,
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			stats := newLatencyStats("op", ts.durations, 0)
+			if stats != ts.expected {
+				t.Errorf("newLatencyStats() = %+v, expected %+v", stats, ts.expected)
+			}
+		})
+	}
+}
+
+func TestMeasureConcurrently(t *testing.T) {
+	t.Parallel()
+	var running, maxRunning int32
+	durations, errs := measureConcurrently(10, 3, func(i int) error {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if i%5 == 0 {
+			return errors.New("failed")
+		}
+
+		return nil
+	})
+	if len(durations) != 8 {
+		t.Errorf("expected 8 durations, got %d", len(durations))
+	}
+	if len(errs) != 2 {
+		t.Errorf("expected 2 errors, got %d", len(errs))
+	}
+	if maxRunning > 3 {
+		t.Errorf("expected at most 3 concurrent calls, got %d", maxRunning)
+	}
+}
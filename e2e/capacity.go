@@ -0,0 +1,674 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	rbdDriverName      = "rbd.csi.ceph.com"
+	csiConfigMapName   = "ceph-csi-config"
+	capacitySCName     = "csi-rbd-capacity-sc"
+	capacityCredsDir   = "/etc/ceph-csi-credentials"
+	capacityCredsName  = "ceph-csi-credentials"
+	capacityDriverName = "csi.storage.k8s.io/drivername"
+
+	// capacityTolerance is the fraction that the capacity reported by the
+	// provisioner may differ from the "max_avail" of the pool, which
+	// changes while the cluster is in use.
+	capacityTolerance = 0.05
+)
+
+// capacityProvisionerArgs enable the storage capacity tracking of the
+// csi-provisioner sidecar. The CSIStorageCapacity objects are not owned by
+// the pod, they are removed when enableCapacityTracking() is reverted.
+var capacityProvisionerArgs = []string{
+	"--enable-capacity",
+	"--capacity-ownerref-level=-1",
+	"--capacity-poll-interval=10s",
+}
+
+// capacityState is the capacity of the pool in the CSIStorageCapacity
+// object of the provisioner, and in "ceph df".
+type capacityState struct {
+	reported  *resource.Quantity
+	available int64
+}
+
+// capacityReported is met once the provisioner reports the available bytes
+// of the pool.
+var capacityReported = stateCondition[capacityState]{
+	name: "reported",
+	met: func(state capacityState) (bool, error) {
+		if state.reported == nil {
+			return false, nil
+		}
+
+		return capacityMatches(state.reported.Value(), state.available), nil
+	},
+	describe: func(state capacityState) string {
+		if state.reported == nil {
+			return fmt.Sprintf("no capacity reported, %d bytes available", state.available)
+		}
+
+		return fmt.Sprintf("%s reported, %d bytes available", state.reported.String(), state.available)
+	},
+}
+
+// podUnschedulable is met once the scheduler failed to find a node for the
+// pod, because no node has enough free storage for its volumes.
+var podUnschedulable = stateCondition[*v1.Pod]{
+	name: "unschedulable because of insufficient storage",
+	met: func(pod *v1.Pod) (bool, error) {
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type != v1.PodScheduled {
+				continue
+			}
+			if cond.Status == v1.ConditionTrue {
+				return false, fmt.Errorf("pod %s was scheduled on node %s", pod.Name, pod.Spec.NodeName)
+			}
+
+			return cond.Reason == v1.PodReasonUnschedulable &&
+				strings.Contains(cond.Message, "did not have enough free storage"), nil
+		}
+
+		return false, nil
+	},
+	describe: func(pod *v1.Pod) string {
+		for _, cond := range pod.Status.Conditions {
+			if cond.Type == v1.PodScheduled {
+				return fmt.Sprintf("phase %q, scheduled %q, reason %q: %s",
+					pod.Status.Phase, cond.Status, cond.Reason, cond.Message)
+			}
+		}
+
+		return fmt.Sprintf("phase %q, not considered by the scheduler", pod.Status.Phase)
+	},
+}
+
+// capacityMatches returns whether the reported capacity is within the
+// capacityTolerance of the available bytes.
+func capacityMatches(reported, available int64) bool {
+	if available == 0 {
+		return reported == 0
+	}
+	diff := math.Abs(float64(reported - available))
+
+	return diff/float64(available) <= capacityTolerance
+}
+
+// parsePoolMaxAvail returns the "max_avail" of the pool in the JSON output
+// of "ceph df".
+func parsePoolMaxAvail(data []byte, pool string) (int64, error) {
+	var df struct {
+		Pools []struct {
+			Name  string `json:"name"`
+			Stats struct {
+				MaxAvail int64 `json:"max_avail"`
+			} `json:"stats"`
+		} `json:"pools"`
+	}
+	err := json.Unmarshal(data, &df)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse ceph df output %q: %w", string(data), err)
+	}
+	for i := range df.Pools {
+		if df.Pools[i].Name == pool {
+			return df.Pools[i].Stats.MaxAvail, nil
+		}
+	}
+
+	return 0, fmt.Errorf("pool %s not found in ceph df output", pool)
+}
+
+// getPoolMaxAvail returns the bytes that can still be stored in the pool,
+// with the verification client, or with the Rook toolbox.
+func getPoolMaxAvail(f *framework.Framework, pool string) (int64, error) {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return 0, err
+	}
+	if cv != nil {
+		return cv.poolMaxAvail(pool)
+	}
+
+	stdOut, stdErr, err := execCommandInToolBoxPod(f, "ceph df -f json", rookNamespace)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage of pool %s: %w, stdErr: %s", pool, err, stdErr)
+	}
+	if stdErr != "" {
+		return 0, fmt.Errorf("failed to get usage of pool %s: %s", pool, stdErr)
+	}
+
+	return parsePoolMaxAvail([]byte(stdOut), pool)
+}
+
+// getStorageCapacity returns the capacity that the provisioner reported for
+// the StorageClass, or nil when there is no CSIStorageCapacity for it yet.
+func getStorageCapacity(f *framework.Framework, scName string) (*resource.Quantity, error) {
+	capacities, err := f.ClientSet.StorageV1().CSIStorageCapacities(cephCSINamespace).List(
+		context.TODO(),
+		metav1.ListOptions{LabelSelector: capacityDriverName + "=" + rbdDriverName})
+	if err != nil {
+		return nil, err
+	}
+	for i := range capacities.Items {
+		if capacities.Items[i].StorageClassName == scName {
+			return capacities.Items[i].Capacity, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// setCSIDriverStorageCapacity enables or disables the capacity checks of the
+// scheduler for the volumes of the RBD driver.
+func setCSIDriverStorageCapacity(f *framework.Framework, enabled bool) error {
+	driver, err := f.ClientSet.StorageV1().CSIDrivers().Get(context.TODO(), rbdDriverName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get CSIDriver %s: %w", rbdDriverName, err)
+	}
+	driver.Spec.StorageCapacity = &enabled
+	_, err = f.ClientSet.StorageV1().CSIDrivers().Update(context.TODO(), driver, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update CSIDriver %s: %w", rbdDriverName, err)
+	}
+
+	return nil
+}
+
+// setCredentialsDir sets the credentialsDir of the clusters in the CSI config
+// file, and returns the previous content of the config file.
+func setCredentialsDir(f *framework.Framework, dir string) (string, error) {
+	cm, err := f.ClientSet.CoreV1().ConfigMaps(cephCSINamespace).Get(
+		context.TODO(),
+		csiConfigMapName,
+		metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get configmap %s: %w", csiConfigMapName, err)
+	}
+	previous := cm.Data["config.json"]
+
+	var clusters []util.ClusterInfo
+	err = json.Unmarshal([]byte(previous), &clusters)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse configmap %s: %w", csiConfigMapName, err)
+	}
+	for i := range clusters {
+		clusters[i].CredentialsDir = dir
+	}
+	data, err := json.Marshal(clusters)
+	if err != nil {
+		return "", err
+	}
+	err = setCSIConfig(f, string(data))
+	if err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// setCSIConfig replaces the content of the CSI config file.
+func setCSIConfig(f *framework.Framework, config string) error {
+	cm, err := f.ClientSet.CoreV1().ConfigMaps(cephCSINamespace).Get(
+		context.TODO(),
+		csiConfigMapName,
+		metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get configmap %s: %w", csiConfigMapName, err)
+	}
+	cm.Data["config.json"] = config
+	_, err = f.ClientSet.CoreV1().ConfigMaps(cephCSINamespace).Update(context.TODO(), cm, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update configmap %s: %w", csiConfigMapName, err)
+	}
+
+	return nil
+}
+
+// addCapacityTracking changes the pod template of the provisioner, so that
+// the csi-provisioner sidecar reports the capacity of the StorageClasses, and
+// the csi-rbdplugin container has the credentials for the GetCapacity
+// requests, which do not contain secrets.
+func addCapacityTracking(spec *v1.PodSpec) {
+	spec.Volumes = append(spec.Volumes, v1.Volume{
+		Name: capacityCredsName,
+		VolumeSource: v1.VolumeSource{
+			Secret: &v1.SecretVolumeSource{SecretName: rbdProvisionerSecretName},
+		},
+	})
+	for i := range spec.Containers {
+		container := &spec.Containers[i]
+		switch container.Name {
+		case "csi-provisioner":
+			container.Args = append(container.Args, capacityProvisionerArgs...)
+			container.Env = append(container.Env, v1.EnvVar{
+				Name: "NAMESPACE",
+				ValueFrom: &v1.EnvVarSource{
+					FieldRef: &v1.ObjectFieldSelector{FieldPath: "metadata.namespace"},
+				},
+			})
+		case "csi-rbdplugin":
+			container.VolumeMounts = append(container.VolumeMounts, v1.VolumeMount{
+				Name:      capacityCredsName,
+				MountPath: capacityCredsDir,
+				ReadOnly:  true,
+			})
+		}
+	}
+}
+
+// updateProvisionerTemplate replaces the pod template of the provisioner, and
+// waits until the new pods are running.
+func updateProvisionerTemplate(f *framework.Framework, update func(*appsv1.Deployment)) error {
+	deployment, err := f.ClientSet.AppsV1().Deployments(cephCSINamespace).Get(
+		context.TODO(),
+		rbdDeploymentName,
+		metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s: %w", rbdDeploymentName, err)
+	}
+	update(deployment)
+	_, err = f.ClientSet.AppsV1().Deployments(cephCSINamespace).Update(
+		context.TODO(),
+		deployment,
+		metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update deployment %s: %w", rbdDeploymentName, err)
+	}
+
+	return waitForDeploymentComplete(f.ClientSet, rbdDeploymentName, cephCSINamespace, deployTimeout)
+}
+
+// enableCapacityTracking configures the provisioner and the CSIDriver for
+// storage capacity tracking. The returned function restores the previous
+// configuration, and removes the CSIStorageCapacity objects.
+func enableCapacityTracking(f *framework.Framework) (func() error, error) {
+	deployment, err := f.ClientSet.AppsV1().Deployments(cephCSINamespace).Get(
+		context.TODO(),
+		rbdDeploymentName,
+		metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %w", rbdDeploymentName, err)
+	}
+	template := deployment.Spec.Template.DeepCopy()
+
+	config, err := setCredentialsDir(f, capacityCredsDir)
+	if err != nil {
+		return nil, err
+	}
+	restore := func() error {
+		restoreErr := setCSIDriverStorageCapacity(f, false)
+		if restoreErr != nil {
+			return restoreErr
+		}
+		restoreErr = updateProvisionerTemplate(f, func(d *appsv1.Deployment) {
+			d.Spec.Template = *template
+		})
+		if restoreErr != nil {
+			return restoreErr
+		}
+		restoreErr = setCSIConfig(f, config)
+		if restoreErr != nil {
+			return restoreErr
+		}
+
+		return f.ClientSet.StorageV1().CSIStorageCapacities(cephCSINamespace).DeleteCollection(
+			context.TODO(),
+			metav1.DeleteOptions{},
+			metav1.ListOptions{LabelSelector: capacityDriverName + "=" + rbdDriverName})
+	}
+
+	err = updateProvisionerTemplate(f, func(d *appsv1.Deployment) {
+		addCapacityTracking(&d.Spec.Template.Spec)
+	})
+	if err == nil {
+		err = setCSIDriverStorageCapacity(f, true)
+	}
+	if err != nil {
+		restoreErr := restore()
+		if restoreErr != nil {
+			e2elog.Logf("failed to restore the provisioner: %v", restoreErr)
+		}
+
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+// waitForStorageCapacity waits until the provisioner reports the available
+// bytes of the pool for the StorageClass, and returns the reported capacity.
+func waitForStorageCapacity(f *framework.Framework, scName, pool string) (*resource.Quantity, error) {
+	getState := func() (capacityState, error) {
+		available, err := getPoolMaxAvail(f, pool)
+		if err != nil {
+			return capacityState{}, err
+		}
+		reported, err := getStorageCapacity(f, scName)
+		if err != nil {
+			return capacityState{}, err
+		}
+
+		return capacityState{reported: reported, available: available}, nil
+	}
+
+	state, err := waitForState(
+		"capacity of StorageClass "+scName,
+		getState,
+		capacityReported,
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return state.reported, nil
+}
+
+// validateUnschedulableCapacity creates a PVC that is larger than the
+// reported capacity, and checks that the scheduler does not place its app on
+// a node. The PVC should not be provisioned.
+func validateUnschedulableCapacity(
+	f *framework.Framework,
+	capacity *resource.Quantity,
+	pvcPath, appPath string,
+) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Name = "capacity-exhausted"
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.StorageClassName = &[]string{capacitySCName}[0]
+	size := capacity.DeepCopy()
+	size.Add(resource.MustParse("1Gi"))
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = size
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Name = "capacity-exhausted"
+	app.Namespace = f.UniqueName
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+
+	pvcs := f.ClientSet.CoreV1().PersistentVolumeClaims(pvc.Namespace)
+	_, err = pvcs.Create(context.TODO(), pvc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create PVC %s: %w", pvc.Name, err)
+	}
+	pods := f.ClientSet.CoreV1().Pods(app.Namespace)
+	_, err = pods.Create(context.TODO(), app, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create application %s: %w", app.Name, err)
+	}
+
+	_, err = waitForState(
+		"pod "+app.Name,
+		func() (*v1.Pod, error) {
+			return pods.Get(context.TODO(), app.Name, metav1.GetOptions{})
+		},
+		podUnschedulable,
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return err
+	}
+	claim, err := pvcs.Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get PVC %s: %w", pvc.Name, err)
+	}
+	if claim.Status.Phase != v1.ClaimPending {
+		return fmt.Errorf("PVC %s of %s is %s, expected it to stay pending", pvc.Name, size.String(), claim.Status.Phase)
+	}
+
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application %s: %w", app.Name, err)
+	}
+	err = pvcs.Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC %s: %w", pvc.Name, err)
+	}
+
+	return waitForDeletion("PVC "+pvc.Name, func() (*v1.PersistentVolumeClaim, error) {
+		return pvcs.Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+	}, time.Duration(deployTimeout)*time.Minute)
+}
+
+// validateCapacityTracking enables storage capacity tracking, and checks that
+// the capacity reported for a delayed binding StorageClass matches the
+// available bytes of the pool. A PVC that fits in the pool is provisioned
+// for its app, and the app of a PVC that is larger than the pool can not be
+// scheduled.
+func validateCapacityTracking(f *framework.Framework, pvcPath, appPath string) error {
+	err := createRBDStorageClass(f.ClientSet, f, capacitySCName,
+		map[string]string{"volumeBindingMode": "WaitForFirstConsumer"}, nil, deletePolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass: %w", err)
+	}
+	defer func() {
+		scErr := f.ClientSet.StorageV1().StorageClasses().Delete(
+			context.TODO(),
+			capacitySCName,
+			metav1.DeleteOptions{})
+		if scErr != nil {
+			e2elog.Failf("failed to delete storageclass %s: %v", capacitySCName, scErr)
+		}
+	}()
+
+	restore, err := enableCapacityTracking(f)
+	if err != nil {
+		return fmt.Errorf("failed to enable capacity tracking: %w", err)
+	}
+	defer func() {
+		restoreErr := restore()
+		if restoreErr != nil {
+			e2elog.Failf("failed to disable capacity tracking: %v", restoreErr)
+		}
+	}()
+
+	capacity, err := waitForStorageCapacity(f, capacitySCName, defaultRBDPool)
+	if err != nil {
+		return err
+	}
+	e2elog.Logf("provisioner reports %s for StorageClass %s", capacity.String(), capacitySCName)
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.StorageClassName = &[]string{capacitySCName}[0]
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	// the PVC is bound once the app is scheduled
+	err = createPVCAndApp("", f, pvc, app, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application within the capacity: %w", err)
+	}
+	err = deletePVCAndApp("", f, pvc, app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC and application: %w", err)
+	}
+
+	return validateUnschedulableCapacity(f, capacity, pvcPath, appPath)
+}
+
+// zoneCapacityState is the capacity of a StorageClass that the provisioner
+// reported per zone, and the bytes that are available in the pool of each
+// zone.
+type zoneCapacityState struct {
+	reported  map[string]*resource.Quantity
+	available map[string]int64
+}
+
+// zoneCapacitiesReported is met once the provisioner reports the available
+// bytes of the pool of each zone, for that zone.
+var zoneCapacitiesReported = stateCondition[zoneCapacityState]{
+	name: "reported for all zones",
+	met: func(state zoneCapacityState) (bool, error) {
+		for zone, available := range state.available {
+			reported := state.reported[zone]
+			if reported == nil || !capacityMatches(reported.Value(), available) {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	},
+	describe: func(state zoneCapacityState) string {
+		zones := make([]string, 0, len(state.available))
+		for zone := range state.available {
+			zones = append(zones, zone)
+		}
+		sort.Strings(zones)
+
+		desc := make([]string, 0, len(zones))
+		for _, zone := range zones {
+			reported := "nothing"
+			if state.reported[zone] != nil {
+				reported = state.reported[zone].String()
+			}
+			desc = append(desc, fmt.Sprintf("zone %s: %s reported, %d bytes available",
+				zone, reported, state.available[zone]))
+		}
+
+		return strings.Join(desc, ", ")
+	},
+}
+
+// getZoneStorageCapacities returns the capacity that the provisioner reported
+// for the StorageClass in each zone of the RBD topology.
+func getZoneStorageCapacities(f *framework.Framework, scName string) (map[string]*resource.Quantity, error) {
+	capacities, err := f.ClientSet.StorageV1().CSIStorageCapacities(cephCSINamespace).List(
+		context.TODO(),
+		metav1.ListOptions{LabelSelector: capacityDriverName + "=" + rbdDriverName})
+	if err != nil {
+		return nil, err
+	}
+
+	reported := map[string]*resource.Quantity{}
+	for i := range capacities.Items {
+		capacity := &capacities.Items[i]
+		if capacity.StorageClassName != scName || capacity.NodeTopology == nil {
+			continue
+		}
+		zone := capacity.NodeTopology.MatchLabels[nodeCSIZoneLabel]
+		if zone != "" {
+			reported[zone] = capacity.Capacity
+		}
+	}
+
+	return reported, nil
+}
+
+// setPoolQuota sets the max_bytes quota of the pool, 0 removes the quota.
+func setPoolQuota(f *framework.Framework, pool string, maxBytes int64) error {
+	// the new quota is reported on stderr
+	_, stdErr, err := execCommandInToolBoxPod(f,
+		fmt.Sprintf("ceph osd pool set-quota %s max_bytes %d", pool, maxBytes),
+		rookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to set quota of pool %s: %w, stdErr: %s", pool, err, stdErr)
+	}
+
+	return nil
+}
+
+// validateZonalCapacity enables storage capacity tracking, and checks that
+// the provisioner reports the capacity of the pool of each of the zones for
+// the topology constrained StorageClass. The pools of the zones can share the
+// same OSDs, a quota of half of the available bytes is set on the pool of the
+// last zone so that a capacity of the wrong pool is detected.
+func validateZonalCapacity(f *framework.Framework, scName string, zonePools map[string]string, zones []string) error {
+	quotaPool := zonePools[zones[len(zones)-1]]
+	maxAvail, err := getPoolMaxAvail(f, quotaPool)
+	if err != nil {
+		return err
+	}
+	quota := maxAvail / 2
+	err = setPoolQuota(f, quotaPool, quota)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		quotaErr := setPoolQuota(f, quotaPool, 0)
+		if quotaErr != nil {
+			e2elog.Failf("failed to remove quota of pool %s: %v", quotaPool, quotaErr)
+		}
+	}()
+
+	restore, err := enableCapacityTracking(f)
+	if err != nil {
+		return fmt.Errorf("failed to enable capacity tracking: %w", err)
+	}
+	defer func() {
+		restoreErr := restore()
+		if restoreErr != nil {
+			e2elog.Failf("failed to disable capacity tracking: %v", restoreErr)
+		}
+	}()
+
+	getState := func() (zoneCapacityState, error) {
+		state := zoneCapacityState{available: map[string]int64{}}
+		for _, zone := range zones {
+			pool := zonePools[zone]
+			available, getErr := getPoolMaxAvail(f, pool)
+			if getErr != nil {
+				return state, getErr
+			}
+			if pool == quotaPool && quota < available {
+				available = quota
+			}
+			state.available[zone] = available
+		}
+		reported, getErr := getZoneStorageCapacities(f, scName)
+		state.reported = reported
+
+		return state, getErr
+	}
+	state, err := waitForState(
+		"capacity of StorageClass "+scName,
+		getState,
+		zoneCapacitiesReported,
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return err
+	}
+	e2elog.Logf("provisioner reports %s", zoneCapacitiesReported.describe(state))
+
+	return nil
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestParsePoolMaxAvail(t *testing.T) {
+	t.Parallel()
+	data := `{"stats":{"total_bytes":32212254720},"pools":[` +
+		`{"name":"device_health_metrics","id":1,"stats":{"stored":0,"max_avail":10173820928}},` +
+		`{"name":"replicapool","id":2,"stats":{"stored":4096,"max_avail":30521462784}}]}`
+
+	tests := []struct {
+		name    string
+		data    string
+		pool    string
+		want    int64
+		wantErr bool
+	}{
+		{
+			name: "pool in output",
+			data: data,
+			pool: "replicapool",
+			want: 30521462784,
+		},
+		{
+			name:    "pool not in output",
+			data:    data,
+			pool:    "missing",
+			wantErr: true,
+		},
+		{
+			name:    "invalid output",
+			data:    "Error EACCES: access denied",
+			pool:    "replicapool",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := parsePoolMaxAvail([]byte(ts.data), ts.pool)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("parsePoolMaxAvail() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("parsePoolMaxAvail() = %d, want %d", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCapacityMatches(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		reported  int64
+		available int64
+		want      bool
+	}{
+		{"equal", 1000, 1000, true},
+		{"within tolerance", 960, 1000, true},
+		{"above tolerance", 1100, 1000, false},
+		{"below tolerance", 900, 1000, false},
+		{"nothing available", 0, 0, true},
+		{"reported while nothing available", 10, 0, false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := capacityMatches(ts.reported, ts.available); got != ts.want {
+				t.Errorf("capacityMatches(%d, %d) = %t, want %t", ts.reported, ts.available, got, ts.want)
+			}
+		})
+	}
+}
+
+func TestZoneCapacitiesReported(t *testing.T) {
+	t.Parallel()
+	gib := func(n int64) *resource.Quantity {
+		return resource.NewQuantity(n<<30, resource.BinarySI)
+	}
+	available := map[string]int64{"zone-a": 10 << 30, "zone-b": 5 << 30}
+	tests := []struct {
+		name     string
+		reported map[string]*resource.Quantity
+		want     bool
+	}{
+		{"all zones", map[string]*resource.Quantity{"zone-a": gib(10), "zone-b": gib(5)}, true},
+		{"zone missing", map[string]*resource.Quantity{"zone-a": gib(10)}, false},
+		{"pools swapped", map[string]*resource.Quantity{"zone-a": gib(5), "zone-b": gib(10)}, false},
+		{"other zone", map[string]*resource.Quantity{"zone-a": gib(10), "zone-b": gib(5), "zone-c": gib(1)}, true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := zoneCapacitiesReported.met(zoneCapacityState{reported: ts.reported, available: available})
+			if err != nil {
+				t.Fatalf("met() failed: %v", err)
+			}
+			if got != ts.want {
+				t.Errorf("met() = %t, want %t", got, ts.want)
+			}
+		})
+	}
+}
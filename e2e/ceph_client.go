@@ -0,0 +1,367 @@
+//go:build cgo
+
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// radosVerifier is the cephVerifier that connects to the Ceph cluster with
+// go-ceph.
+type radosVerifier struct {
+	conn *rados.Conn
+}
+
+// newCephVerifier connects to the Ceph cluster, see getCephVerifier().
+func newCephVerifier(f *framework.Framework) (cephVerifier, error) {
+	secret, err := f.ClientSet.CoreV1().Secrets(cephCSINamespace).Get(
+		context.TODO(),
+		cephSecret,
+		metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", cephCSINamespace, cephSecret, err)
+	}
+	user := string(secret.Data["userID"])
+	key := string(secret.Data["userKey"])
+	if user == "" || key == "" {
+		return nil, fmt.Errorf("secret %s/%s does not contain userID and userKey", cephCSINamespace, cephSecret)
+	}
+
+	monitors := cephMonitors
+	if monitors == "" {
+		mons, monErr := getMons(rookNamespace, f.ClientSet)
+		if monErr != nil {
+			return nil, fmt.Errorf("failed to get monitors of the Rook cluster: %w", monErr)
+		}
+		monitors = strings.Join(mons, ",")
+	}
+
+	conn, err := rados.NewConnWithUser(user)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create connection for user %q: %w", user, err)
+	}
+	err = conn.SetConfigOption("mon_host", monitors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set monitors %q: %w", monitors, err)
+	}
+	err = conn.SetConfigOption("key", key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set key: %w", err)
+	}
+	err = conn.Connect()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %q as user %q: %w", monitors, user, err)
+	}
+	e2elog.Logf("verifying Ceph resources with a direct connection to %q as user %q", monitors, user)
+
+	return &radosVerifier{conn: conn}, nil
+}
+
+// ioContext returns an IOContext for the pool, in the radosNamespace that is
+// used by the tests.
+func (cv *radosVerifier) ioContext(pool string) (*rados.IOContext, error) {
+	ioctx, err := cv.conn.OpenIOContext(pool)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pool %q: %w", pool, err)
+	}
+	ioctx.SetNamespace(radosNamespace)
+
+	return ioctx, nil
+}
+
+func (cv *radosVerifier) listSubVolumes(filesystem, group string) ([]cephfsSubVolume, error) {
+	names, err := fsAdmin.NewFromConn(cv.conn).ListSubVolumes(filesystem, group)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subvolumes in %s/%s: %w", filesystem, group, err)
+	}
+
+	subVols := make([]cephfsSubVolume, 0, len(names))
+	for _, name := range names {
+		subVols = append(subVols, cephfsSubVolume{Name: name})
+	}
+
+	return subVols, nil
+}
+
+func (cv *radosVerifier) listSubVolumeSnapshots(filesystem, subvolume, group string) ([]cephfsSnapshot, error) {
+	names, err := fsAdmin.NewFromConn(cv.conn).ListSubVolumeSnapshots(filesystem, group, subvolume)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snapshots of subvolume %s/%s/%s: %w", filesystem, group, subvolume, err)
+	}
+
+	snaps := make([]cephfsSnapshot, 0, len(names))
+	for _, name := range names {
+		snaps = append(snaps, cephfsSnapshot{Name: name})
+	}
+
+	return snaps, nil
+}
+
+func (cv *radosVerifier) subVolumeGroupPath(filesystem, group string) (string, error) {
+	return fsAdmin.NewFromConn(cv.conn).SubVolumeGroupPath(filesystem, group)
+}
+
+func (cv *radosVerifier) subVolumePath(filesystem, group, subvolume string) (string, error) {
+	return fsAdmin.NewFromConn(cv.conn).SubVolumePath(filesystem, group, subvolume)
+}
+
+func (cv *radosVerifier) listRBDImages(pool string) ([]string, error) {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+
+	return librbd.GetImageNames(ioctx)
+}
+
+func (cv *radosVerifier) listRBDImagesInTrash(pool string) ([]trashInfo, error) {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+
+	trash, err := librbd.GetTrashList(ioctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trash of pool %q: %w", pool, err)
+	}
+
+	trashInfos := make([]trashInfo, 0, len(trash))
+	for i := range trash {
+		trashInfos = append(trashInfos, trashInfo{Name: trash[i].Name})
+	}
+
+	return trashInfos, nil
+}
+
+// getImageMeta returns the value of the metadata key of the image, the
+// rbdImageSpec is formatted like the spec of the rbd command.
+func (cv *radosVerifier) getImageMeta(rbdImageSpec, key string) (string, error) {
+	// <pool>/[<namespace>/]<image>
+	parts := strings.Split(rbdImageSpec, "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return "", fmt.Errorf("invalid image spec %q", rbdImageSpec)
+	}
+
+	ioctx, err := cv.conn.OpenIOContext(parts[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to open pool %q: %w", parts[0], err)
+	}
+	defer ioctx.Destroy()
+	if len(parts) == 3 {
+		ioctx.SetNamespace(parts[1])
+	}
+
+	image, err := librbd.OpenImageReadOnly(ioctx, parts[len(parts)-1], librbd.NoSnapshot)
+	if err != nil {
+		return "", fmt.Errorf("failed to open image %q: %w", rbdImageSpec, err)
+	}
+	defer image.Close()
+
+	return image.GetMetadata(key)
+}
+
+// getOmapValue returns the value of the key in the omap of the object.
+func (cv *radosVerifier) getOmapValue(pool, oid, key string) (string, error) {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return "", err
+	}
+	defer ioctx.Destroy()
+
+	values, err := ioctx.GetOmapValues(oid, "", key, 1)
+	if err != nil {
+		return "", fmt.Errorf("failed to get omap key %q of %q: %w", key, oid, err)
+	}
+	value, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("omap key %q of %q: %w", key, oid, errOmapKeyNotFound)
+	}
+
+	return string(value), nil
+}
+
+// createRBDImage creates an image with only the layering feature, like the
+// images that are created with the rbd command for static PVs.
+func (cv *radosVerifier) createRBDImage(pool, name string, size uint64) error {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	options := librbd.NewRbdImageOptions()
+	defer options.Destroy()
+	err = options.SetUint64(librbd.ImageOptionFeatures, librbd.FeatureLayering)
+	if err != nil {
+		return fmt.Errorf("failed to set image features: %w", err)
+	}
+
+	return librbd.CreateImage(ioctx, name, size, options)
+}
+
+func (cv *radosVerifier) resizeRBDImage(pool, name string, size uint64) error {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	image, err := librbd.OpenImage(ioctx, name, librbd.NoSnapshot)
+	if err != nil {
+		return fmt.Errorf("failed to open image %q: %w", name, err)
+	}
+	defer image.Close()
+
+	return image.Resize(size)
+}
+
+func (cv *radosVerifier) removeRBDImage(pool, name string) error {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	return librbd.RemoveImage(ioctx, name)
+}
+
+// createSubVolume creates the subvolume with the size in bytes, and the group
+// of the subvolume if it does not exist yet.
+func (cv *radosVerifier) createSubVolume(filesystem, group, subvolume string, size uint64) error {
+	fsa := fsAdmin.NewFromConn(cv.conn)
+	err := fsa.CreateSubVolumeGroup(filesystem, group, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create subvolumegroup %s/%s: %w", filesystem, group, err)
+	}
+
+	return fsa.CreateSubVolume(filesystem, group, subvolume, &fsAdmin.SubVolumeOptions{
+		Size: fsAdmin.ByteCount(size),
+	})
+}
+
+func (cv *radosVerifier) resizeSubVolume(filesystem, group, subvolume string, size uint64) error {
+	_, err := fsAdmin.NewFromConn(cv.conn).ResizeSubVolume(filesystem, group, subvolume, fsAdmin.ByteCount(size), true)
+
+	return err
+}
+
+func (cv *radosVerifier) removeSubVolume(filesystem, group, subvolume string) error {
+	return fsAdmin.NewFromConn(cv.conn).RemoveSubVolume(filesystem, group, subvolume)
+}
+
+func (cv *radosVerifier) removeSubVolumeGroup(filesystem, group string) error {
+	return fsAdmin.NewFromConn(cv.conn).RemoveSubVolumeGroup(filesystem, group)
+}
+
+// poolMaxAvail returns the "max_avail" of the pool in "ceph df".
+func (cv *radosVerifier) poolMaxAvail(pool string) (int64, error) {
+	out, info, err := cv.conn.MonCommand([]byte(`{"prefix": "df", "format": "json"}`))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get usage of pool %s: %w, info: %s", pool, err, info)
+	}
+
+	return parsePoolMaxAvail(out, pool)
+}
+
+// listBlocklist returns the blocklisted addresses of "ceph osd blocklist ls".
+func (cv *radosVerifier) listBlocklist() ([]string, error) {
+	out, info, err := cv.conn.MonCommand([]byte(`{"prefix": "osd blocklist ls", "format": "json"}`))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocklist: %w, info: %s", err, info)
+	}
+
+	return parseBlocklist(out)
+}
+
+// blocklistAddr adds the address of a client to the OSD blocklist, with "ceph
+// osd blocklist add".
+func (cv *radosVerifier) blocklistAddr(addr string) error {
+	return cv.blocklistCommand("add", addr)
+}
+
+// unblocklistAddr removes the address of a client from the OSD blocklist.
+func (cv *radosVerifier) unblocklistAddr(addr string) error {
+	return cv.blocklistCommand("rm", addr)
+}
+
+func (cv *radosVerifier) blocklistCommand(op, addr string) error {
+	cmd, err := json.Marshal(map[string]string{
+		"prefix":      "osd blocklist",
+		"blocklistop": op,
+		"addr":        addr,
+	})
+	if err != nil {
+		return err
+	}
+	_, info, err := cv.conn.MonCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to %s %s in blocklist: %w, info: %s", op, addr, err, info)
+	}
+
+	return nil
+}
+
+// objectsContaining returns the data objects of the image with the block name
+// prefix that contain the marker.
+func (cv *radosVerifier) objectsContaining(
+	pool, blockNamePrefix string,
+	objectSize int,
+	marker []byte,
+) ([]string, error) {
+	ioctx, err := cv.ioContext(pool)
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+
+	objects := []string{}
+	err = ioctx.ListObjects(func(oid string) {
+		objects = append(objects, oid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects of pool %q: %w", pool, err)
+	}
+
+	found := []string{}
+	data := make([]byte, objectSize)
+	for _, object := range dataObjects(objects, blockNamePrefix) {
+		n, readErr := ioctx.Read(object, data, 0)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read object %q: %w", object, readErr)
+		}
+		if bytes.Contains(data[:n], marker) {
+			found = append(found, object)
+		}
+	}
+
+	return found, nil
+}
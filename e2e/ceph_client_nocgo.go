@@ -0,0 +1,30 @@
+//go:build !cgo
+
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// newCephVerifier fails, the go-ceph verification client needs cgo.
+func newCephVerifier(f *framework.Framework) (cephVerifier, error) {
+	return nil, errors.New("--ceph-secret needs e2e tests that are built with cgo")
+}
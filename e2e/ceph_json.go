@@ -0,0 +1,120 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// cephCommandRetryTimeout is the time that a command which fails because the
+// Ceph cluster is temporarily unavailable is retried.
+const cephCommandRetryTimeout = 2 * time.Minute
+
+// transientCephErrors are the messages of the ceph, rbd and rados commands
+// for failures that go away when the command is retried, like a monitor
+// election or an MDS failover.
+var transientCephErrors = []string{
+	"EAGAIN",
+	"Resource temporarily unavailable",
+	"ETIMEDOUT",
+	"Connection timed out",
+	"error connecting to the cluster",
+}
+
+// isTransientCephError returns whether the stderr of a command is about a
+// failure that goes away when the command is retried.
+func isTransientCephError(stdErr string) bool {
+	for _, msg := range transientCephErrors {
+		if strings.Contains(stdErr, msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decodeCephJSON decodes the JSON output of a command into T. Commands that
+// have nothing to list may not print anything, which is the zero value of T.
+func decodeCephJSON[T any](stdOut string) (T, error) {
+	var result T
+	if strings.TrimSpace(stdOut) == "" {
+		return result, nil
+	}
+	err := json.Unmarshal([]byte(stdOut), &result)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse %q: %w", stdOut, err)
+	}
+
+	return result, nil
+}
+
+// cephJSON runs the ceph, rbd or rados command with --format=json in the
+// toolbox of the Rook cluster in rookNamespace, and decodes its output into
+// T.
+func cephJSON[T any](f *framework.Framework, cmd string) (T, error) {
+	return cephJSONInCluster[T](f, cmd, rookNamespace)
+}
+
+// cephJSONInCluster runs the command with --format=json in the toolbox of the
+// Rook cluster in the namespace, and decodes its output into T. The command
+// is retried while it fails with a transient error, any other output on
+// stderr is an error.
+func cephJSONInCluster[T any](f *framework.Framework, cmd, ns string) (T, error) {
+	var (
+		result         T
+		stdOut, stdErr string
+	)
+	cmd += " --format=json"
+	err := wait.PollImmediate(poll, cephCommandRetryTimeout, func() (bool, error) {
+		var execErr error
+		stdOut, stdErr, execErr = execCommandInToolBoxPod(f, cmd, ns)
+		if isTransientCephError(stdErr) {
+			e2elog.Logf("retrying %q in cluster %s: %s", cmd, ns, stdErr)
+
+			return false, nil
+		}
+		if execErr != nil {
+			return false, fmt.Errorf("failed to run %q in cluster %s: %w, stdErr: %s", cmd, ns, execErr, stdErr)
+		}
+		if stdErr != "" {
+			return false, fmt.Errorf("failed to run %q in cluster %s: %s", cmd, ns, stdErr)
+		}
+
+		return true, nil
+	})
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return result, fmt.Errorf("failed to run %q in cluster %s, last error: %s: %w", cmd, ns, stdErr, err)
+	}
+	if err != nil {
+		return result, err
+	}
+
+	result, err = decodeCephJSON[T](stdOut)
+	if err != nil {
+		return result, fmt.Errorf("output of %q: %w", cmd, err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIsTransientCephError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		stdErr   string
+		expected bool
+	}{
+		{stdErr: "Error EAGAIN: mds not available", expected: true},
+		{stdErr: "rbd: listing images failed: (11) Resource temporarily unavailable", expected: true},
+		{stdErr: "[errno 110] RADOS timed out (error connecting to the cluster)", expected: true},
+		{stdErr: "Error ENOENT: subvolume group 'csi' does not exist", expected: false},
+		{stdErr: "", expected: false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.stdErr, func(t *testing.T) {
+			t.Parallel()
+			if got := isTransientCephError(ts.stdErr); got != ts.expected {
+				t.Errorf("isTransientCephError(%q) = %v, expected %v", ts.stdErr, got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeCephJSON(t *testing.T) {
+	t.Parallel()
+
+	names, err := decodeCephJSON[[]cephfsSubVolume](`[{"name": "csi-vol-1111"}, {"name": "csi-vol-2222"}]`)
+	if err != nil {
+		t.Fatalf("decodeCephJSON() failed: %v", err)
+	}
+	expected := []cephfsSubVolume{{Name: "csi-vol-1111"}, {Name: "csi-vol-2222"}}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("decodeCephJSON() = %v, expected %v", names, expected)
+	}
+
+	metadata, err := decodeCephJSON[map[string]string]("\n")
+	if err != nil {
+		t.Fatalf("decodeCephJSON() of empty output failed: %v", err)
+	}
+	if len(metadata) != 0 {
+		t.Errorf("decodeCephJSON() of empty output = %v, expected no metadata", metadata)
+	}
+
+	_, err = decodeCephJSON[[]string]("rbd: error opening pool")
+	if err == nil {
+		t.Error("decodeCephJSON() of invalid output succeeded")
+	}
+}
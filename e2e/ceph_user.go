@@ -97,6 +97,13 @@ func cephFSProvisionerCaps() []string {
 }
 
 func createCephUser(f *framework.Framework, user string, caps []string) (string, error) {
+	user = resourceName(user)
+	registerCleanup("ceph user client."+user, func(f *framework.Framework) error {
+		_, _, err := execCommandInToolBoxPod(f, "ceph auth del client."+user, rookNamespace)
+
+		return err
+	})
+
 	cmd := fmt.Sprintf("ceph auth get-or-create-key client.%s %s", user, strings.Join(caps, " "))
 	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
 	if err != nil {
@@ -110,7 +117,7 @@ func createCephUser(f *framework.Framework, user string, caps []string) (string,
 }
 
 func deleteCephUser(f *framework.Framework, user string) error {
-	cmd := fmt.Sprintf("ceph auth del client.%s", user)
+	cmd := fmt.Sprintf("ceph auth del client.%s", resourceName(user))
 	_, _, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
 
 	return err
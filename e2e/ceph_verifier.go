@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+	"sync"
+
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+var (
+	// cli flags for the verification client.
+	cephSecret   string
+	cephMonitors string
+
+	cephVerifierOnce sync.Once
+	cephVerifierConn cephVerifier
+	errCephVerifier  error
+
+	errOmapKeyNotFound = errors.New("omap key not found")
+)
+
+// cephVerifier verifies the state of volumes and snapshots in the Ceph
+// cluster over a direct connection, instead of executing the ceph, rbd and
+// rados commands in the Rook toolbox pod. The connection is shared by all
+// tests. The client uses go-ceph, which needs cgo, e2e tests that are built
+// without cgo always use the Rook toolbox.
+type cephVerifier interface {
+	// CephFS subvolumes and snapshots
+	listSubVolumes(filesystem, group string) ([]cephfsSubVolume, error)
+	listSubVolumeSnapshots(filesystem, subvolume, group string) ([]cephfsSnapshot, error)
+	subVolumeGroupPath(filesystem, group string) (string, error)
+	subVolumePath(filesystem, group, subvolume string) (string, error)
+	createSubVolume(filesystem, group, subvolume string, size uint64) error
+	resizeSubVolume(filesystem, group, subvolume string, size uint64) error
+	removeSubVolume(filesystem, group, subvolume string) error
+	removeSubVolumeGroup(filesystem, group string) error
+
+	// RBD images and RADOS objects
+	listRBDImages(pool string) ([]string, error)
+	listRBDImagesInTrash(pool string) ([]trashInfo, error)
+	getImageMeta(rbdImageSpec, key string) (string, error)
+	getOmapValue(pool, oid, key string) (string, error)
+	createRBDImage(pool, name string, size uint64) error
+	resizeRBDImage(pool, name string, size uint64) error
+	removeRBDImage(pool, name string) error
+	objectsContaining(pool, blockNamePrefix string, objectSize int, marker []byte) ([]string, error)
+
+	// cluster state
+	poolMaxAvail(pool string) (int64, error)
+	listBlocklist() ([]string, error)
+	blocklistAddr(addr string) error
+	unblocklistAddr(addr string) error
+}
+
+// getCephVerifier returns the verification client when the e2e tests were
+// started with --ceph-secret, or nil when the Rook toolbox should be
+// used. The client connects to the monitors in --ceph-monitors, or to the
+// monitors of the Rook cluster, with the userID and userKey of the secret in
+// the cephcsi namespace.
+func getCephVerifier(f *framework.Framework) (cephVerifier, error) {
+	if cephSecret == "" {
+		return nil, nil
+	}
+
+	cephVerifierOnce.Do(func() {
+		cephVerifierConn, errCephVerifier = newCephVerifier(f)
+	})
+
+	return cephVerifierConn, errCephVerifier
+}
@@ -41,7 +41,8 @@ var (
 	cephFSContainerName   = "csi-cephfsplugin"
 	cephFSDirPath         = "../deploy/cephfs/kubernetes/"
 	cephFSExamplePath     = examplePath + "cephfs/"
-	subvolumegroup        = "e2e"
+	cephFSSubvolumegroup  = "e2e"
+	subvolumegroup        = cephFSSubvolumegroup
 	fileSystemName        = "myfs"
 )
 
@@ -83,9 +84,10 @@ func createORDeleteCephfsResources(action kubectlAction) {
 		},
 		// the provisioner itself
 		&yamlResourceNamespaced{
-			filename:   cephFSDirPath + cephFSProvisioner,
-			namespace:  cephCSINamespace,
-			oneReplica: true,
+			filename:    cephFSDirPath + cephFSProvisioner,
+			namespace:   cephCSINamespace,
+			oneReplica:  true,
+			metricsPort: cephFSMetricsPort,
 		},
 		// dependencies for the node-plugin
 		&yamlResourceNamespaced{
@@ -94,8 +96,9 @@ func createORDeleteCephfsResources(action kubectlAction) {
 		},
 		// the node-plugin itself
 		&yamlResourceNamespaced{
-			filename:  cephFSDirPath + cephFSNodePlugin,
-			namespace: cephCSINamespace,
+			filename:    cephFSDirPath + cephFSNodePlugin,
+			namespace:   cephCSINamespace,
+			metricsPort: cephFSMetricsPort,
 		},
 	}
 
@@ -147,6 +150,8 @@ func validateSubvolumePath(f *framework.Framework, pvcName, pvcNamespace, fileSy
 var _ = Describe(cephfsType, func() {
 	f := framework.NewDefaultFramework(cephfsType)
 	var c clientset.Interface
+	var leakDetector *journalLeakDetector
+	var reaper *orphanReaper
 	// deploy CephFS CSI
 	BeforeEach(func() {
 		if !testCephFS || upgradeTesting {
@@ -162,6 +167,8 @@ var _ = Describe(cephfsType, func() {
 			}
 			deployCephfsPlugin()
 		}
+		// nfs testing might have changed the subvolumegroup
+		subvolumegroup = resourceName(cephFSSubvolumegroup)
 		err := createConfigMap(cephFSDirPath, f.ClientSet, f)
 		if err != nil {
 			e2elog.Failf("failed to create configmap: %v", err)
@@ -192,6 +199,40 @@ var _ = Describe(cephfsType, func() {
 		if err != nil {
 			e2elog.Failf("timeout waiting for deployment update %s/%s: %v", cephCSINamespace, cephFSDeploymentName, err)
 		}
+
+		metadataPool, err := getCephFSMetadataPoolName(f, fileSystemName)
+		if err != nil {
+			e2elog.Failf("failed getting cephFS metadata pool name: %v", err)
+		}
+		leakDetector, err = newJournalLeakDetector(f, cephfsType, metadataPool)
+		if err != nil {
+			e2elog.Failf("failed to count journal entries: %v", err)
+		}
+		reaper = newOrphanReaper(cephfsType, metadataPool)
+	})
+
+	// JustAfterEach runs before the framework deletes the namespace of the
+	// spec and its clientset
+	JustAfterEach(func() {
+		if !testCephFS || upgradeTesting {
+			return
+		}
+		if CurrentGinkgoTestDescription().Failed {
+			if reaper != nil {
+				err := reaper.reap(f)
+				if err != nil {
+					e2elog.Failf("failed to remove the resources of the failed spec: %v", err)
+				}
+			}
+
+			return
+		}
+		if leakDetector != nil {
+			err := leakDetector.check(f)
+			if err != nil {
+				e2elog.Failf("%v", err)
+			}
+		}
 	})
 
 	AfterEach(func() {
@@ -325,6 +366,23 @@ var _ = Describe(cephfsType, func() {
 				}
 			})
 
+			By("restart, recreate and drain pods with generic ephemeral volumes", func() {
+				err := createCephfsStorageClass(f.ClientSet, f, true, nil)
+				if err != nil {
+					e2elog.Failf("failed to create CephFS storageclass: %v", err)
+				}
+				err = validateEphemeralVolumes(f, appEphemeralPath)
+				if err != nil {
+					e2elog.Failf("failed to validate generic ephemeral volumes: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+				err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete CephFS storageclass: %v", err)
+				}
+			})
+
 			By("verify RWOP volume support", func() {
 				err := createCephfsStorageClass(f.ClientSet, f, true, nil)
 				if err != nil {
@@ -380,6 +438,14 @@ var _ = Describe(cephfsType, func() {
 				}
 			})
 
+			By("validate mount, stats, expansion and retention of a CephFS static PVC", func() {
+				scPath := cephFSExamplePath + "secret.yaml"
+				err := validateCephFSStaticVolumeLifecycle(f, appPath, scPath)
+				if err != nil {
+					e2elog.Failf("failed to validate lifecycle of CephFS static pv: %v", err)
+				}
+			})
+
 			By("create a storageclass with pool and a PVC then bind it to an app", func() {
 				err := createCephfsStorageClass(f.ClientSet, f, true, nil)
 				if err != nil {
@@ -414,33 +480,9 @@ var _ = Describe(cephfsType, func() {
 				validateSubvolumeCount(f, 1, fileSystemName, subvolumegroup)
 				validateOmapCount(f, 1, cephfsType, metadataPool, volumesType)
 
-				pvcObj, err := getPersistentVolumeClaim(c, pvc.Namespace, pvc.Name)
+				err = validatePVCMetadata(f, pvc)
 				if err != nil {
-					e2elog.Logf("error getting pvc %q in namespace %q: %v", pvc.Name, pvc.Namespace, err)
-				}
-				if pvcObj.Spec.VolumeName == "" {
-					e2elog.Logf("pv name is empty %q in namespace %q: %v", pvc.Name, pvc.Namespace, err)
-				}
-				subvol, err := listCephFSSubVolumes(f, fileSystemName, subvolumegroup)
-				if err != nil {
-					e2elog.Failf("failed to list CephFS subvolumes: %v", err)
-				}
-				if len(subvol) == 0 {
-					e2elog.Failf("cephFS subvolumes list is empty %s", fileSystemName)
-				}
-				metadata, err := listCephFSSubvolumeMetadata(f, fileSystemName, subvol[0].Name, subvolumegroup)
-				if err != nil {
-					e2elog.Failf("failed to list subvolume metadata: %v", err)
-				}
-
-				if metadata.PVCNameKey != pvc.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvc.Name, metadata.PVCNameKey)
-				} else if metadata.PVCNamespaceKey != pvc.Namespace {
-					e2elog.Failf("expected pvcNamespace %q got %q", pvc.Namespace, metadata.PVCNamespaceKey)
-				} else if metadata.PVNameKey != pvcObj.Spec.VolumeName {
-					e2elog.Failf("expected pvName %q got %q", pvcObj.Spec.VolumeName, metadata.PVNameKey)
-				} else if metadata.ClusterNameKey != defaultClusterName {
-					e2elog.Failf("expected clusterName %q got %q", defaultClusterName, metadata.ClusterNameKey)
+					e2elog.Failf("failed to validate PVC metadata: %v", err)
 				}
 
 				err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
@@ -673,6 +715,102 @@ var _ = Describe(cephfsType, func() {
 				}
 			})
 
+			By("verifying that ceph-fuse mounts under IO break on nodeplugin restart and recover for new pods", func() {
+				err := createCephfsStorageClass(f.ClientSet, f, true, map[string]string{
+					"mounter": "fuse",
+				})
+				if err != nil {
+					e2elog.Failf("failed to create CephFS storageclass: %v", err)
+				}
+				replicas := int32(1)
+				pvc, depl, err := validatePVCAndDeploymentAppBinding(
+					f, pvcPath, deplPath, f.UniqueName, &replicas, deployTimeout,
+				)
+				if err != nil {
+					e2elog.Failf("failed to create PVC and Deployment: %v", err)
+				}
+				listOpt := metav1.ListOptions{
+					LabelSelector: fmt.Sprintf("app=%s", depl.Labels["app"]),
+				}
+				deplPods, err := listPods(f, depl.Namespace, &listOpt)
+				if err != nil {
+					e2elog.Failf("failed to list pods for Deployment: %v", err)
+				}
+				podName := deplPods[0].Name
+				containerName := depl.Spec.Template.Spec.Containers[0].Name
+				mountPath := depl.Spec.Template.Spec.Containers[0].VolumeMounts[0].MountPath
+				filePath := mountPath + "/" + ioTestFile
+
+				err = startBackgroundIO(f, podName, depl.Namespace, containerName, filePath)
+				if err != nil {
+					e2elog.Failf("%v", err)
+				}
+				err = waitForIOProgress(f, podName, depl.Namespace, containerName, filePath)
+				if err != nil {
+					e2elog.Failf("%v", err)
+				}
+
+				err = restartNodePlugin(f, cephFSDeamonSetName)
+				if err != nil {
+					e2elog.Failf("failed to restart nodeplugin: %v", err)
+				}
+				// ceph-fuse runs in the nodeplugin container, the mounts of
+				// running pods are not recovered (see
+				// docs/ceph-fuse-corruption.md).
+				_, stdErr, err := execCommandInContainerByPodName(
+					f, fmt.Sprintf("stat %s", mountPath), depl.Namespace, podName, containerName,
+				)
+				if err == nil || !strings.Contains(stdErr, "not connected") {
+					e2elog.Failf(
+						"expected stat to fail with 'Transport endpoint not connected' or 'Socket not connected'; got err %v, stderr %s",
+						err, stdErr,
+					)
+				}
+
+				// A new pod gets the corrupted mount recovered.
+				err = deletePod(podName, depl.Namespace, c, deployTimeout)
+				if err != nil {
+					e2elog.Failf(err.Error())
+				}
+				err = waitForDeploymentComplete(c, depl.Name, depl.Namespace, deployTimeout)
+				if err != nil {
+					e2elog.Failf(err.Error())
+				}
+				deplPods, err = listPods(f, depl.Namespace, &listOpt)
+				if err != nil {
+					e2elog.Failf("failed to list pods for Deployment: %v", err)
+				}
+				newPodName := ""
+				for i := range deplPods {
+					if deplPods[i].Name != podName && deplPods[i].DeletionTimestamp == nil {
+						newPodName = deplPods[i].Name
+
+						break
+					}
+				}
+				if newPodName == "" {
+					e2elog.Failf("no new replica found for pod %s", podName)
+				}
+				err = startBackgroundIO(f, newPodName, depl.Namespace, containerName, filePath)
+				if err != nil {
+					e2elog.Failf("%v", err)
+				}
+				err = waitForIOProgress(f, newPodName, depl.Namespace, containerName, filePath)
+				if err != nil {
+					e2elog.Failf("IO failed on recovered ceph-fuse mount: %v", err)
+				}
+
+				// Delete created resources.
+				err = deletePVCAndDeploymentApp(f, pvc, depl)
+				if err != nil {
+					e2elog.Failf("failed to delete PVC and Deployment: %v", err)
+				}
+				err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete CephFS storageclass: %v", err)
+				}
+			})
+
 			By("create a PVC and bind it to an app", func() {
 				err := createCephfsStorageClass(f.ClientSet, f, false, nil)
 				if err != nil {
@@ -756,6 +894,15 @@ var _ = Describe(cephfsType, func() {
 				}
 			})
 
+			By("evict the kernel client of a running app and recover the stale mount", func() {
+				err := validateStaleMountRecovery(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to recover stale mount: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
 			By("create PVC, delete backing subvolume and check pv deletion", func() {
 				pvc, err := loadPVC(pvcPath)
 				if err != nil {
@@ -790,9 +937,9 @@ var _ = Describe(cephfsType, func() {
 				clusterID1 := "clusterID-1"
 				clusterID2 := "clusterID-2"
 				clusterInfo[clusterID1] = map[string]string{}
-				clusterInfo[clusterID1]["subvolumeGroup"] = "subvolgrp1"
+				clusterInfo[clusterID1]["subvolumeGroup"] = resourceName("subvolgrp1")
 				clusterInfo[clusterID2] = map[string]string{}
-				clusterInfo[clusterID2]["subvolumeGroup"] = "subvolgrp2"
+				clusterInfo[clusterID2]["subvolumeGroup"] = resourceName("subvolgrp2")
 
 				err = createCustomConfigMap(f.ClientSet, cephFSDirPath, clusterInfo)
 				if err != nil {
@@ -814,7 +961,7 @@ var _ = Describe(cephfsType, func() {
 					e2elog.Failf("failed to delete storageclass: %v", err)
 				}
 				// verify subvolume group creation.
-				err = validateSubvolumegroup(f, "subvolgrp1")
+				err = validateSubvolumegroup(f, resourceName("subvolgrp1"))
 				if err != nil {
 					e2elog.Failf("failed to validate subvolume group: %v", err)
 				}
@@ -834,7 +981,7 @@ var _ = Describe(cephfsType, func() {
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
 				}
-				err = validateSubvolumegroup(f, "subvolgrp2")
+				err = validateSubvolumegroup(f, resourceName("subvolgrp2"))
 				if err != nil {
 					e2elog.Failf("failed to validate subvolume group: %v", err)
 				}
@@ -929,39 +1076,9 @@ var _ = Describe(cephfsType, func() {
 				if err != nil {
 					e2elog.Failf("failed to create snapshot (%s): %v", snap.Name, err)
 				}
-				_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
-				if err != nil {
-					e2elog.Failf("failed to get PV object for %s: %v", pvc.Name, err)
-				}
-				subVolumeName := pv.Spec.CSI.VolumeAttributes["subvolumeName"]
-				snaps, err := listCephFSSnapshots(f, fileSystemName, subVolumeName, subvolumegroup)
+				err = validateSnapshotMetadata(f, &snap)
 				if err != nil {
-					e2elog.Failf("failed to list subvolume snapshots: %v", err)
-				}
-				if len(snaps) == 0 {
-					e2elog.Failf("cephFS snapshots list is empty %s/%s", fileSystemName, subVolumeName)
-				}
-				content, err := getVolumeSnapshotContent(snap.Namespace, snap.Name)
-				if err != nil {
-					e2elog.Failf("failed to get snapshotcontent for %s in namespace %s: %v",
-						snap.Name, snap.Namespace, err)
-				}
-				metadata, err := listCephFSSnapshotMetadata(f,
-					fileSystemName, subVolumeName, snaps[0].Name, subvolumegroup)
-				if err != nil {
-					e2elog.Failf("failed to list subvolume snapshots metadata: %v", err)
-				}
-				if metadata.VolSnapNameKey != snap.Name {
-					e2elog.Failf("failed, snapname expected:%s got:%s",
-						snap.Name, metadata.VolSnapNameKey)
-				} else if metadata.VolSnapNamespaceKey != snap.Namespace {
-					e2elog.Failf("failed, snapnamespace expected:%s got:%s",
-						snap.Namespace, metadata.VolSnapNamespaceKey)
-				} else if metadata.VolSnapContentNameKey != content.Name {
-					e2elog.Failf("failed, contentname expected:%s got:%s",
-						content.Name, metadata.VolSnapContentNameKey)
-				} else if metadata.ClusterNameKey != defaultClusterName {
-					e2elog.Failf("expected clusterName %q got %q", defaultClusterName, metadata.ClusterNameKey)
+					e2elog.Failf("failed to validate snapshot metadata: %v", err)
 				}
 
 				// Delete the parent pvc before restoring
@@ -983,23 +1100,9 @@ var _ = Describe(cephfsType, func() {
 				if err != nil {
 					e2elog.Failf("failed to create pvc clone: %v", err)
 				}
-				pvcCloneObj, pvCloneObj, err := getPVCAndPV(f.ClientSet, pvcClone.Name, pvcClone.Namespace)
-				if err != nil {
-					e2elog.Logf("error getting pvc %q in namespace %q: %v", pvcClone.Name, pvcClone.Namespace, err)
-				}
-				subVolumeCloneName := pvCloneObj.Spec.CSI.VolumeAttributes["subvolumeName"]
-				cloneMetadata, err := listCephFSSubvolumeMetadata(f, fileSystemName, subVolumeCloneName, subvolumegroup)
+				err = validatePVCMetadata(f, pvcClone)
 				if err != nil {
-					e2elog.Failf("failed to list subvolume clone metadata: %v", err)
-				}
-				if cloneMetadata.PVCNameKey != pvcClone.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvcClone.Name, cloneMetadata.PVCNameKey)
-				} else if cloneMetadata.PVCNamespaceKey != pvcClone.Namespace {
-					e2elog.Failf("expected pvcNamespace %q got %q", pvcClone.Namespace, cloneMetadata.PVCNamespaceKey)
-				} else if cloneMetadata.PVNameKey != pvcCloneObj.Spec.VolumeName {
-					e2elog.Failf("expected pvName %q got %q", pvcCloneObj.Spec.VolumeName, cloneMetadata.PVNameKey)
-				} else if cloneMetadata.ClusterNameKey != defaultClusterName {
-					e2elog.Failf("expected clusterName %q got %q", defaultClusterName, cloneMetadata.ClusterNameKey)
+					e2elog.Failf("failed to validate metadata of restored PVC: %v", err)
 				}
 
 				// delete clone
@@ -1047,23 +1150,9 @@ var _ = Describe(cephfsType, func() {
 					e2elog.Failf("failed to delete pvc: %v", err)
 				}
 
-				pvcCloneObj, pvCloneObj, err := getPVCAndPV(f.ClientSet, pvcClone.Name, pvcClone.Namespace)
-				if err != nil {
-					e2elog.Logf("error getting pvc %q in namespace %q: %v", pvcClone.Name, pvcClone.Namespace, err)
-				}
-				subVolumeCloneName := pvCloneObj.Spec.CSI.VolumeAttributes["subvolumeName"]
-				cloneMetadata, err := listCephFSSubvolumeMetadata(f, fileSystemName, subVolumeCloneName, subvolumegroup)
+				err = validatePVCMetadata(f, pvcClone)
 				if err != nil {
-					e2elog.Failf("failed to list subvolume clone metadata: %v", err)
-				}
-				if cloneMetadata.PVCNameKey != pvcClone.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvc.Name, cloneMetadata.PVCNameKey)
-				} else if cloneMetadata.PVCNamespaceKey != pvcClone.Namespace {
-					e2elog.Failf("expected pvcNamespace %q got %q", pvc.Namespace, cloneMetadata.PVCNamespaceKey)
-				} else if cloneMetadata.PVNameKey != pvcCloneObj.Spec.VolumeName {
-					e2elog.Failf("expected pvName %q got %q", pvcCloneObj.Spec.VolumeName, cloneMetadata.PVNameKey)
-				} else if cloneMetadata.ClusterNameKey != defaultClusterName {
-					e2elog.Failf("expected clusterName %q got %q", defaultClusterName, cloneMetadata.ClusterNameKey)
+					e2elog.Failf("failed to validate metadata of PVC clone: %v", err)
 				}
 
 				err = deletePVCAndValidatePV(f.ClientSet, pvcClone, deployTimeout)
@@ -1739,6 +1828,22 @@ var _ = Describe(cephfsType, func() {
 				}
 			})
 
+			By("validate the supported and unsupported access modes", func() {
+				err := validateAccessModes(f, cephFSAccessModes, pvcPath, appPath, "")
+				if err != nil {
+					e2elog.Failf("failed to validate access modes: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+			})
+
+			By("run restricted workloads with an SELinux level", func() {
+				err := validateRestrictedWorkloads(f, cephFSDriverName, cephFSDeploymentName, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate restricted workloads: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+			})
+
 			By("restore snapshot to a bigger size PVC", func() {
 				err := validateBiggerPVCFromSnapshot(f,
 					pvcPath,
@@ -1768,6 +1873,184 @@ var _ = Describe(cephfsType, func() {
 				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
 			})
 
+			By("validate the metrics of the provisioner and the nodeplugin", func() {
+				if !deployCephFS || helmTest {
+					e2elog.Logf("skipping metrics validation, the driver is not deployed by the e2e tests")
+
+					return
+				}
+				err := validateOperationMetrics(f, cephFSDeploymentName, cephFSDeamonSetName, cephFSMetricsPort,
+					metadataPool, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate the metrics of successful operations: %v", err)
+				}
+
+				err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createCephfsStorageClass(f.ClientSet, f, false, map[string]string{"fsName": "fs-does-not-exist"})
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				err = validateErrorMetrics(f, cephFSDeploymentName, cephFSMetricsPort, pvcPath)
+				if err != nil {
+					e2elog.Failf("failed to validate the metrics of failed operations: %v", err)
+				}
+				err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createCephfsStorageClass(f.ClientSet, f, false, nil)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
+			By("restart the provisioner while creating snapshots and clones", func() {
+				err := createCephFSSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create CephFS snapshotclass: %v", err)
+				}
+				defer func() {
+					err = deleteResource(cephFSExamplePath + "snapshotclass.yaml")
+					if err != nil {
+						e2elog.Failf("failed to delete CephFS snapshotclass: %v", err)
+					}
+				}()
+
+				err = validateProvisionerRestartDuringCloning(
+					f,
+					cephFSDeploymentName,
+					cephfsType,
+					metadataPool,
+					pvcPath,
+					snapshotPath,
+					pvcClonePath,
+					pvcSmartClonePath)
+				if err != nil {
+					e2elog.Failf("failed to validate provisioner restart during cloning: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+				validateOmapCount(f, 0, cephfsType, metadataPool, snapsType)
+			})
+
+			By("restart the monitors while creating and mounting PVCs", func() {
+				if externalCluster != nil {
+					e2elog.Logf("skipping monitor failover, the monitors are not managed by Rook")
+
+					return
+				}
+				err := validateMonFailover(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate monitor failover: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
+			By("benchmark provisioning, attaching and snapshotting of PVCs", func() {
+				if benchmarkCount == 0 {
+					e2elog.Logf("skipping benchmark, no benchmark-count set")
+
+					return
+				}
+				err := createCephFSSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create CephFS snapshotclass: %v", err)
+				}
+				defer func() {
+					err = deleteResource(cephFSExamplePath + "snapshotclass.yaml")
+					if err != nil {
+						e2elog.Failf("failed to delete CephFS snapshotclass: %v", err)
+					}
+				}()
+
+				err = runBenchmark(f, "cephfs", pvcPath, appPath, snapshotPath)
+				if err != nil {
+					e2elog.Failf("benchmark failed: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+				validateOmapCount(f, 0, cephfsType, metadataPool, snapsType)
+			})
+
+			By("take many snapshots of one PVC, list and restore them", func() {
+				if snapshotScaleCount == 0 {
+					e2elog.Logf("skipping snapshot scale, no snapshot-scale-count set")
+
+					return
+				}
+				err := createCephFSSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create CephFS snapshotclass: %v", err)
+				}
+				defer func() {
+					err = deleteResource(cephFSExamplePath + "snapshotclass.yaml")
+					if err != nil {
+						e2elog.Failf("failed to delete CephFS snapshotclass: %v", err)
+					}
+				}()
+
+				driver := snapshotScaleDriver{
+					name:           "cephfs",
+					deploymentName: cephFSDeploymentName,
+					containerName:  cephFSContainerName,
+					secretName:     cephFSProvisionerSecretName,
+				}
+				err = runSnapshotScale(f, driver, pvcPath, appPath, snapshotPath, pvcClonePath, appClonePath)
+				if err != nil {
+					e2elog.Failf("snapshot scale failed: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+				validateOmapCount(f, 0, cephfsType, metadataPool, snapsType)
+			})
+
+			By("measure the attach-to-ready and first-write latency against the SLOs", func() {
+				if latencySLOSamples == 0 {
+					e2elog.Logf("skipping latency SLOs, no latency-slo-samples set")
+
+					return
+				}
+				for _, vt := range []latencyVolumeType{
+					{name: "cephfs", pvcPath: pvcPath, appPath: appPath},
+				} {
+					err := validateLatencySLOs(f, vt)
+					if err != nil {
+						e2elog.Failf("latency SLOs failed: %v", err)
+					}
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
+			By("create PVCs in a second filesystem and reject mismatched fsName and pool", func() {
+				if externalCluster != nil {
+					e2elog.Logf("skipping second filesystem, it is created by Rook")
+
+					return
+				}
+				err := validateCephFSBackends(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate StorageClasses of other filesystems: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
+			By("reject invalid StorageClass and VolumeSnapshotClass parameters", func() {
+				err := validateCephFSInvalidParameters(f, pvcPath, snapshotPath)
+				if err != nil {
+					e2elog.Failf("failed to validate invalid parameters: %v", err)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+			})
+
 			// FIXME: in case NFS testing is done, prevent deletion
 			// of the CephFS filesystem and related pool. This can
 			// probably be addressed in a nicer way, making sure
@@ -1786,16 +2069,8 @@ var _ = Describe(cephfsType, func() {
 					e2elog.Failf("failed to delete PVC: %v", err)
 				}
 			})
-			// delete cephFS provisioner secret
-			err := deleteCephUser(f, keyringCephFSProvisionerUsername)
-			if err != nil {
-				e2elog.Failf("failed to delete user %s: %v", keyringCephFSProvisionerUsername, err)
-			}
-			// delete cephFS plugin secret
-			err = deleteCephUser(f, keyringCephFSNodePluginUsername)
-			if err != nil {
-				e2elog.Failf("failed to delete user %s: %v", keyringCephFSNodePluginUsername, err)
-			}
+			// the Ceph users are shared with the NFS suite, and removed
+			// after all suites finished
 		})
 	})
 })
@@ -18,7 +18,6 @@ package e2e
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"regexp"
 	"strings"
@@ -26,6 +25,7 @@ import (
 
 	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -39,13 +39,26 @@ const (
 
 // validateSubvolumegroup validates whether subvolumegroup is present.
 func validateSubvolumegroup(f *framework.Framework, subvolgrp string) error {
-	cmd := fmt.Sprintf("ceph fs subvolumegroup getpath %s %s", fileSystemName, subvolgrp)
-	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	var stdOut string
+	cv, err := getCephVerifier(f)
 	if err != nil {
-		return fmt.Errorf("failed to exec command in toolbox: %w", err)
+		return err
 	}
-	if stdErr != "" {
-		return fmt.Errorf("failed to getpath for subvolumegroup %s : %v", subvolgrp, stdErr)
+	if cv != nil {
+		stdOut, err = cv.subVolumeGroupPath(fileSystemName, subvolgrp)
+		if err != nil {
+			return fmt.Errorf("failed to getpath for subvolumegroup %s : %w", subvolgrp, err)
+		}
+	} else {
+		var stdErr string
+		cmd := fmt.Sprintf("ceph fs subvolumegroup getpath %s %s", fileSystemName, subvolgrp)
+		stdOut, stdErr, err = execCommandInToolBoxPod(f, cmd, rookNamespace)
+		if err != nil {
+			return fmt.Errorf("failed to exec command in toolbox: %w", err)
+		}
+		if stdErr != "" {
+			return fmt.Errorf("failed to getpath for subvolumegroup %s : %v", subvolgrp, stdErr)
+		}
 	}
 	expectedGrpPath := "/volumes/" + subvolgrp
 	stdOut = strings.TrimSpace(stdOut)
@@ -127,7 +140,7 @@ func createCephfsSecret(f *framework.Framework, secretName, userName, userKey st
 	if secretName != "" {
 		sc.Name = secretName
 	}
-	sc.StringData["adminID"] = userName
+	sc.StringData["adminID"] = resourceName(userName)
 	sc.StringData["adminKey"] = userKey
 	delete(sc.StringData, "userID")
 	delete(sc.StringData, "userKey")
@@ -192,92 +205,16 @@ type cephfsSubVolume struct {
 }
 
 func listCephFSSubVolumes(f *framework.Framework, filesystem, groupname string) ([]cephfsSubVolume, error) {
-	var subVols []cephfsSubVolume
-	stdout, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf("ceph fs subvolume ls %s --group_name=%s --format=json", filesystem, groupname),
-		rookNamespace)
-	if err != nil {
-		return subVols, err
-	}
-	if stdErr != "" {
-		return subVols, fmt.Errorf("error listing subvolumes %v", stdErr)
-	}
-
-	err = json.Unmarshal([]byte(stdout), &subVols)
-	if err != nil {
-		return subVols, err
-	}
-
-	return subVols, nil
-}
-
-type cephfsSubvolumeMetadata struct {
-	PVCNameKey      string `json:"csi.storage.k8s.io/pvc/name"`
-	PVCNamespaceKey string `json:"csi.storage.k8s.io/pvc/namespace"`
-	PVNameKey       string `json:"csi.storage.k8s.io/pv/name"`
-	ClusterNameKey  string `json:"csi.ceph.com/cluster/name"`
-}
-
-func listCephFSSubvolumeMetadata(
-	f *framework.Framework,
-	filesystem,
-	subvolume,
-	groupname string,
-) (*cephfsSubvolumeMetadata, error) {
-	stdout, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf("ceph fs subvolume metadata ls %s %s --group_name=%s --format=json", filesystem, subvolume, groupname),
-		rookNamespace)
+	cv, err := getCephVerifier(f)
 	if err != nil {
 		return nil, err
 	}
-	if stdErr != "" {
-		return nil, fmt.Errorf("error listing subvolume metadata %v", stdErr)
+	if cv != nil {
+		return cv.listSubVolumes(filesystem, groupname)
 	}
 
-	metadata := &cephfsSubvolumeMetadata{}
-	err = json.Unmarshal([]byte(stdout), metadata)
-	if err != nil {
-		return metadata, err
-	}
-
-	return metadata, nil
-}
-
-type cephfsSnapshotMetadata struct {
-	VolSnapNameKey        string `json:"csi.storage.k8s.io/volumesnapshot/name"`
-	VolSnapNamespaceKey   string `json:"csi.storage.k8s.io/volumesnapshot/namespace"`
-	VolSnapContentNameKey string `json:"csi.storage.k8s.io/volumesnapshotcontent/name"`
-	ClusterNameKey        string `json:"csi.ceph.com/cluster/name"`
-}
-
-func listCephFSSnapshotMetadata(
-	f *framework.Framework,
-	filesystem,
-	subvolume,
-	snapname,
-	groupname string,
-) (*cephfsSnapshotMetadata, error) {
-	stdout, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf("ceph fs subvolume snapshot metadata ls %s %s %s --group_name=%s --format=json",
-			filesystem, subvolume, snapname, groupname),
-		rookNamespace)
-	if err != nil {
-		return nil, err
-	}
-	if stdErr != "" {
-		return nil, fmt.Errorf("error listing subvolume snapshots metadata %v", stdErr)
-	}
-
-	metadata := &cephfsSnapshotMetadata{}
-	err = json.Unmarshal([]byte(stdout), metadata)
-	if err != nil {
-		return metadata, err
-	}
-
-	return metadata, nil
+	return cephJSON[[]cephfsSubVolume](f,
+		fmt.Sprintf("ceph fs subvolume ls %s --group_name=%s", filesystem, groupname))
 }
 
 type cephfsSnapshot struct {
@@ -285,28 +222,28 @@ type cephfsSnapshot struct {
 }
 
 func listCephFSSnapshots(f *framework.Framework, filesystem, subvolume, groupname string) ([]cephfsSnapshot, error) {
-	var snaps []cephfsSnapshot
-	stdout, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf("ceph fs subvolume snapshot ls %s %s --group_name=%s --format=json", filesystem, subvolume, groupname),
-		rookNamespace)
+	cv, err := getCephVerifier(f)
 	if err != nil {
-		return snaps, err
+		return nil, err
 	}
-	if stdErr != "" {
-		return snaps, fmt.Errorf("error listing subolume snapshots %v", stdErr)
+	if cv != nil {
+		return cv.listSubVolumeSnapshots(filesystem, subvolume, groupname)
 	}
 
-	err = json.Unmarshal([]byte(stdout), &snaps)
-	if err != nil {
-		return snaps, err
-	}
-
-	return snaps, nil
+	return cephJSON[[]cephfsSnapshot](f,
+		fmt.Sprintf("ceph fs subvolume snapshot ls %s %s --group_name=%s", filesystem, subvolume, groupname))
 }
 
 // getSubvolumepath validates whether subvolumegroup is present.
 func getSubvolumePath(f *framework.Framework, filesystem, subvolgrp, subvolume string) (string, error) {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return "", err
+	}
+	if cv != nil {
+		return cv.subVolumePath(filesystem, subvolgrp, subvolume)
+	}
+
 	cmd := fmt.Sprintf("ceph fs subvolume getpath %s %s --group_name=%s", filesystem, subvolume, subvolgrp)
 	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
 	if err != nil {
@@ -373,3 +310,100 @@ func deleteBackingCephFSSubvolumeSnapshot(
 
 	return nil
 }
+
+// createSubVolume creates the subvolume with the size, like "4Gi", in the
+// group. The group is created when it does not exist.
+func createSubVolume(f *framework.Framework, filesystem, group, subvolume, size string) error {
+	quantity := resource.MustParse(size)
+	bytes := quantity.Value()
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		return cv.createSubVolume(filesystem, group, subvolume, uint64(bytes))
+	}
+
+	// the command succeeds when the group exists already
+	cmd := fmt.Sprintf("ceph fs subvolumegroup create %s %s", filesystem, group)
+	_, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to create subvolumegroup %s: %s", group, stdErr)
+	}
+
+	cmd = fmt.Sprintf("ceph fs subvolume create %s %s %s --size %d", filesystem, subvolume, group, bytes)
+	_, stdErr, err = execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to create subvolume %s: %s", subvolume, stdErr)
+	}
+
+	return nil
+}
+
+// resizeSubVolume changes the quota of the subvolume to the size, like
+// "8Gi".
+func resizeSubVolume(f *framework.Framework, filesystem, group, subvolume, size string) error {
+	quantity := resource.MustParse(size)
+	bytes := quantity.Value()
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		return cv.resizeSubVolume(filesystem, group, subvolume, uint64(bytes))
+	}
+
+	cmd := fmt.Sprintf("ceph fs subvolume resize %s %s %d --group_name=%s --no_shrink",
+		filesystem, subvolume, bytes, group)
+	_, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to resize subvolume %s: %s", subvolume, stdErr)
+	}
+
+	return nil
+}
+
+// removeSubVolume removes the subvolume, and the group when it is empty.
+func removeSubVolume(f *framework.Framework, filesystem, group, subvolume string) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		err = cv.removeSubVolume(filesystem, group, subvolume)
+		if err != nil {
+			return fmt.Errorf("failed to remove subvolume %s: %w", subvolume, err)
+		}
+
+		return cv.removeSubVolumeGroup(filesystem, group)
+	}
+
+	cmd := fmt.Sprintf("ceph fs subvolume rm %s %s %s", filesystem, subvolume, group)
+	_, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to remove subvolume %s: %s", subvolume, stdErr)
+	}
+
+	cmd = fmt.Sprintf("ceph fs subvolumegroup rm %s %s", filesystem, group)
+	_, stdErr, err = execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to remove subvolumegroup %s: %s", group, stdErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// reservationTimeout is the time to wait for the reservation of an operation
+// in the journal, before the provisioner is restarted anyway.
+const reservationTimeout = time.Minute
+
+// restartProvisioner deletes the pods of the provisioner deployment, and
+// waits until the recreated pods are running.
+func restartProvisioner(f *framework.Framework, deploymentName string) error {
+	selector, err := getDeploymentLabelSelector(f, cephCSINamespace, deploymentName)
+	if err != nil {
+		return err
+	}
+	err = deletePodWithLabel(selector, cephCSINamespace, false)
+	if err != nil {
+		return fmt.Errorf("failed to delete pods of deployment %s: %w", deploymentName, err)
+	}
+	err = waitForDeploymentComplete(f.ClientSet, deploymentName, cephCSINamespace, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for deployment %s: %w", deploymentName, err)
+	}
+
+	return nil
+}
+
+// waitForReservations waits until the directory of the journal has at least
+// count keys.
+func waitForReservations(f *framework.Framework, driver, pool string, journal csiJournal, count int) error {
+	cmd := fmt.Sprintf("rados listomapkeys %s %s", journal.directory, journalRadosOptions(driver, pool))
+
+	return wait.PollImmediate(time.Second, reservationTimeout, func() (bool, error) {
+		keys, err := listRadosLines(f, cmd)
+		if err != nil {
+			e2elog.Logf("failed to list reservations: %v", err)
+
+			return false, nil
+		}
+
+		return len(keys) >= count, nil
+	})
+}
+
+// restartProvisionerDuring runs the operation, and restarts the provisioner
+// once the operation reserved its entry in the journal, which means that the
+// CreateVolume or CreateSnapshot call is in progress. There should be count
+// reservations in the journal at that point. The operation is expected to
+// complete through the retries of the sidecars, and its error is returned.
+func restartProvisionerDuring(
+	f *framework.Framework,
+	deploymentName, driver, pool string,
+	journal csiJournal,
+	count int,
+	operation func() error,
+) error {
+	result := make(chan error, 1)
+	go func() {
+		result <- operation()
+	}()
+
+	err := waitForReservations(f, driver, pool, journal, count)
+	if err != nil {
+		e2elog.Logf("restarting the provisioner, no reservation found in %s: %v", journal.directory, err)
+	}
+	err = restartProvisioner(f, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	return <-result
+}
+
+// validateProvisionerRestartDuringCloning restarts the provisioner of the
+// driver while a snapshot of a PVC, a PVC from the snapshot and a clone of
+// the PVC are created, and checks that the operations complete and that the
+// journal stays consistent. When everything is deleted, no reservations,
+// images or subvolumes may be left.
+func validateProvisionerRestartDuringCloning(
+	f *framework.Framework,
+	deploymentName, driver, pool,
+	pvcPath, snapshotPath, pvcClonePath, pvcSmartClonePath string,
+) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+
+	snap := getSnapshot(snapshotPath)
+	snap.Namespace = f.UniqueName
+	snap.Spec.Source.PersistentVolumeClaimName = &pvc.Name
+	err = restartProvisionerDuring(f, deploymentName, driver, pool, snapshotJournal, 1, func() error {
+		return createSnapshot(&snap, deployTimeout)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot across provisioner restart: %w", err)
+	}
+	err = validateJournalConsistency(f, driver, pool)
+	if err != nil {
+		return err
+	}
+
+	pvcClone, err := loadPVC(pvcClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvcClone.Namespace = f.UniqueName
+	pvcClone.Spec.DataSource.Name = snap.Name
+	// the parent PVC has a reservation already
+	err = restartProvisionerDuring(f, deploymentName, driver, pool, volumeJournal, 2, func() error {
+		return createPVCAndvalidatePV(f.ClientSet, pvcClone, deployTimeout)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot across provisioner restart: %w", err)
+	}
+	err = validateJournalConsistency(f, driver, pool)
+	if err != nil {
+		return err
+	}
+
+	pvcSmartClone, err := loadPVC(pvcSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvcSmartClone.Namespace = f.UniqueName
+	pvcSmartClone.Spec.DataSource.Name = pvc.Name
+	err = restartProvisionerDuring(f, deploymentName, driver, pool, volumeJournal, 3, func() error {
+		return createPVCAndvalidatePV(f.ClientSet, pvcSmartClone, deployTimeout)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to clone PVC across provisioner restart: %w", err)
+	}
+	err = validateJournalConsistency(f, driver, pool)
+	if err != nil {
+		return err
+	}
+
+	err = deletePVCAndValidatePV(f.ClientSet, pvcSmartClone, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+	err = deletePVCAndValidatePV(f.ClientSet, pvcClone, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+	err = deleteSnapshot(&snap, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+	err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+
+	return validateJournalConsistency(f, driver, pool)
+}
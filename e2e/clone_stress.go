@@ -0,0 +1,357 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// cloneStressCount is the number of PVC-PVC clones, and the number of
+	// restores of a snapshot, that are created at the same time.
+	cloneStressCount  = 20
+	cloneStressPrefix = "clone-stress"
+
+	// the snapshot limits of the provisioner are lowered, so that the clones
+	// of the parent need to be flattened.
+	cloneStressMaxSnapshots = 8
+	cloneStressMinSnapshots = 4
+)
+
+// cloneDepthErrors are parts of the messages of errors about the depth of
+// clones, these are handled by the provisioner and should not be reported to
+// users.
+var cloneDepthErrors = []string{"flatten in progress", "flatten is in progress", "clone depth"}
+
+// setArgs sets the flags in the args, existing values are replaced and
+// missing flags are appended.
+func setArgs(args []string, flags map[string]string) []string {
+	updated := make([]string, 0, len(args)+len(flags))
+	for _, arg := range args {
+		name := strings.SplitN(strings.TrimPrefix(arg, "--"), "=", 2)[0]
+		if _, ok := flags[name]; ok {
+			continue
+		}
+		updated = append(updated, arg)
+	}
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		updated = append(updated, fmt.Sprintf("--%s=%s", name, flags[name]))
+	}
+
+	return updated
+}
+
+// cloneDepthEvents returns the messages of the warning events that report
+// errors about the depth of clones.
+func cloneDepthEvents(events []v1.Event) []string {
+	messages := []string{}
+	for i := range events {
+		if events[i].Type != v1.EventTypeWarning {
+			continue
+		}
+		for _, msg := range cloneDepthErrors {
+			if strings.Contains(events[i].Message, msg) {
+				messages = append(messages, events[i].InvolvedObject.Name+": "+events[i].Message)
+
+				break
+			}
+		}
+	}
+
+	return messages
+}
+
+// lowerSnapshotLimits sets the --maxsnapshotsonimage and
+// --minsnapshotsonimage of the RBD provisioner to cloneStressMaxSnapshots and
+// cloneStressMinSnapshots. The returned function restores the previous
+// configuration.
+func lowerSnapshotLimits(f *framework.Framework) (func() error, error) {
+	deployment, err := f.ClientSet.AppsV1().Deployments(cephCSINamespace).Get(
+		context.TODO(),
+		rbdDeploymentName,
+		metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get deployment %s: %w", rbdDeploymentName, err)
+	}
+	template := deployment.Spec.Template.DeepCopy()
+	restore := func() error {
+		return updateProvisionerTemplate(f, func(d *appsv1.Deployment) {
+			d.Spec.Template = *template
+		})
+	}
+
+	flags := map[string]string{
+		"maxsnapshotsonimage": fmt.Sprint(cloneStressMaxSnapshots),
+		"minsnapshotsonimage": fmt.Sprint(cloneStressMinSnapshots),
+	}
+	err = updateProvisionerTemplate(f, func(d *appsv1.Deployment) {
+		for i := range d.Spec.Template.Spec.Containers {
+			container := &d.Spec.Template.Spec.Containers[i]
+			if container.Name == "csi-rbdplugin" {
+				container.Args = setArgs(container.Args, flags)
+			}
+		}
+	})
+	if err != nil {
+		restoreErr := restore()
+		if restoreErr != nil {
+			e2elog.Logf("failed to restore the provisioner: %v", restoreErr)
+		}
+
+		return nil, err
+	}
+
+	return restore, nil
+}
+
+// countImageSnapshots returns the number of snapshots of the RBD image,
+// including the snapshots in the trash that still have clones.
+func countImageSnapshots(f *framework.Framework, rbdImageSpec string) (int, error) {
+	snaps, err := cephJSON[[]json.RawMessage](f, "rbd snap ls --all "+rbdImageSpec)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list snapshots of %s: %w", rbdImageSpec, err)
+	}
+
+	return len(snaps), nil
+}
+
+// validateCloneDepthEvents checks that none of the PVCs of the stress test
+// reported errors about the depth of clones.
+func validateCloneDepthEvents(f *framework.Framework) error {
+	events, err := f.ClientSet.CoreV1().Events(f.UniqueName).List(context.TODO(), metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=PersistentVolumeClaim",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list events: %w", err)
+	}
+	stressEvents := []v1.Event{}
+	for i := range events.Items {
+		if strings.HasPrefix(events.Items[i].InvolvedObject.Name, cloneStressPrefix) {
+			stressEvents = append(stressEvents, events.Items[i])
+		}
+	}
+	if messages := cloneDepthEvents(stressEvents); len(messages) != 0 {
+		return fmt.Errorf("clone depth errors were reported: %s", strings.Join(messages, "; "))
+	}
+
+	return nil
+}
+
+// validateSnapshotLimit creates one more clone of the parent, which flattens
+// the clones when the parent has too many snapshots, and checks that the
+// number of snapshots stays within the limit of the provisioner.
+func validateSnapshotLimit(f *framework.Framework, parent *v1.PersistentVolumeClaim, pvcSmartClonePath string) error {
+	pvc, err := loadPVC(pvcSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Name = cloneStressPrefix + "-flatten"
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.DataSource.Name = parent.Name
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC %s: %w", pvc.Name, err)
+	}
+
+	imageData, err := getImageInfoFromPVC(parent.Namespace, parent.Name, f)
+	if err != nil {
+		return err
+	}
+	rbdImageSpec := imageSpec(defaultRBDPool, imageData.imageName)
+	snaps, err := countImageSnapshots(f, rbdImageSpec)
+	if err != nil {
+		return err
+	}
+	// the clone that was just created adds a snapshot after the check
+	if snaps > cloneStressMaxSnapshots+1 {
+		return fmt.Errorf("image %s has %d snapshots, the provisioner allows %d",
+			rbdImageSpec, snaps, cloneStressMaxSnapshots)
+	}
+	e2elog.Logf("image %s has %d snapshots", rbdImageSpec, snaps)
+
+	return deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+}
+
+// validateConcurrentClones creates cloneStressCount PVC-PVC clones of a
+// parent PVC and cloneStressCount restores of its snapshot at the same time,
+// while the provisioner flattens the clones after a few snapshots on the
+// parent. All clones need to contain the data of the parent, and no errors
+// about the depth of the clones may be reported to the user.
+// nolint:gocyclo,cyclop // the steps are sequential
+func validateConcurrentClones(
+	f *framework.Framework,
+	pvcPath, appPath, snapshotPath, pvcClonePath, appClonePath, pvcSmartClonePath, appSmartClonePath string,
+) error {
+	restore, err := lowerSnapshotLimits(f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		restoreErr := restore()
+		if restoreErr != nil {
+			e2elog.Failf("failed to restore the provisioner: %v", restoreErr)
+		}
+	}()
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	err = createPVCAndApp(cloneStressPrefix+"-parent", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create parent PVC and application: %w", err)
+	}
+	ds := newDataset(cloneStressPrefix, 2, 64)
+	err = ds.write(f, app)
+	if err != nil {
+		return err
+	}
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	snap := getSnapshot(snapshotPath)
+	snap.Name = cloneStressPrefix + "-snapshot"
+	snap.Namespace = f.UniqueName
+	snap.Spec.Source.PersistentVolumeClaimName = &pvc.Name
+	err = createSnapshot(&snap, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	restorePVC, err := loadPVC(pvcClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	restorePVC.Namespace = f.UniqueName
+	restorePVC.Spec.DataSource.Name = snap.Name
+	restoreApp, err := loadApp(appClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	restoreApp.Namespace = f.UniqueName
+	clonePVC, err := loadPVC(pvcSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	clonePVC.Namespace = f.UniqueName
+	clonePVC.Spec.DataSource.Name = pvc.Name
+	cloneApp, err := loadApp(appSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	cloneApp.Namespace = f.UniqueName
+
+	total := 2 * cloneStressCount
+	pvcs := make([]*v1.PersistentVolumeClaim, total)
+	apps := make([]*v1.Pod, total)
+	for i := 0; i < cloneStressCount; i++ {
+		pvcs[i], apps[i] = clonePVC.DeepCopy(), cloneApp.DeepCopy()
+		pvcs[cloneStressCount+i], apps[cloneStressCount+i] = restorePVC.DeepCopy(), restoreApp.DeepCopy()
+	}
+	names := make([]string, total)
+	for i := range names {
+		kind := "clone"
+		if i >= cloneStressCount {
+			kind = "restore"
+		}
+		names[i] = fmt.Sprintf("%s-%s-%d", cloneStressPrefix, kind, i%cloneStressCount)
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	errs := make([]error, total)
+	wg.Add(total)
+	for i := 0; i < total; i++ {
+		go func(n int) {
+			defer wg.Done()
+			errs[n] = createPVCAndApp(names[n], f, pvcs[n], apps[n], deployTimeout)
+			if errs[n] == nil {
+				errs[n] = ds.verify(f, apps[n])
+			}
+		}(i)
+	}
+	wg.Wait()
+	e2elog.Logf("created %d clones and restores in %v", total, time.Since(start))
+
+	failed := 0
+	for i, cErr := range errs {
+		if cErr != nil {
+			// not using Failf() as it aborts the test and does not log other errors
+			e2elog.Logf("failed to create and verify %s: %v", names[i], cErr)
+			failed++
+		}
+	}
+	if failed == 0 {
+		err = validateSnapshotLimit(f, pvc, pvcSmartClonePath)
+	}
+	if err == nil && failed == 0 {
+		err = validateCloneDepthEvents(f)
+	}
+
+	wg.Add(total)
+	for i := 0; i < total; i++ {
+		go func(n int) {
+			defer wg.Done()
+			errs[n] = deletePVCAndApp("", f, pvcs[n], apps[n])
+		}(i)
+	}
+	wg.Wait()
+	for i, dErr := range errs {
+		if dErr != nil {
+			e2elog.Logf("failed to delete %s: %v", names[i], dErr)
+			failed++
+		}
+	}
+	if failed != 0 {
+		return fmt.Errorf("creating, verifying or deleting clones failed, %d errors were logged", failed)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = deleteSnapshot(&snap, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete snapshot: %w", err)
+	}
+
+	return deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+}
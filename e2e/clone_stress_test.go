@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSetArgs(t *testing.T) {
+	t.Parallel()
+	flags := map[string]string{
+		"minsnapshotsonimage": "4",
+		"maxsnapshotsonimage": "8",
+	}
+
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{
+			name: "flags appended",
+			args: []string{"--type=rbd", "--v=5"},
+			want: []string{"--type=rbd", "--v=5", "--maxsnapshotsonimage=8", "--minsnapshotsonimage=4"},
+		},
+		{
+			name: "flags replaced",
+			args: []string{"--type=rbd", "--maxsnapshotsonimage=450", "--v=5", "--minsnapshotsonimage=250"},
+			want: []string{"--type=rbd", "--v=5", "--maxsnapshotsonimage=8", "--minsnapshotsonimage=4"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := setArgs(ts.args, flags); !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("setArgs() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCloneDepthEvents(t *testing.T) {
+	t.Parallel()
+	event := func(eventType, name, message string) v1.Event {
+		return v1.Event{
+			Type:           eventType,
+			InvolvedObject: v1.ObjectReference{Name: name},
+			Message:        message,
+		}
+	}
+
+	tests := []struct {
+		name   string
+		events []v1.Event
+		want   []string
+	}{
+		{
+			name: "no depth errors",
+			events: []v1.Event{
+				event(v1.EventTypeNormal, "clone-1", "Successfully provisioned volume pvc-1"),
+				event(v1.EventTypeWarning, "clone-2",
+					"failed to provision volume with StorageClass \"csi-rbd-sc\": "+
+						"rpc error: code = ResourceExhausted desc = rbd image replicapool/csi-vol-1 has 9 snapshots"),
+			},
+			want: []string{},
+		},
+		{
+			name: "flatten in progress",
+			events: []v1.Event{
+				event(v1.EventTypeWarning, "clone-3",
+					"rpc error: code = Aborted desc = flatten in progress: flatten is in progress for image csi-vol-2"),
+			},
+			want: []string{"clone-3: rpc error: code = Aborted desc = " +
+				"flatten in progress: flatten is in progress for image csi-vol-2"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := cloneDepthEvents(ts.events); !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("cloneDepthEvents() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// crossSCClonePool is the pool of the StorageClass of the clones that are
+	// created in another pool than their parent.
+	crossSCClonePool = "cross-sc-clone"
+
+	errEncryptedFromUnencrypted = "cannot create encrypted volume from unencrypted volume"
+	errUnencryptedFromEncrypted = "cannot create unencrypted volume from encrypted volume"
+)
+
+// crossSCCloneTestCase is a PVC-PVC clone in a StorageClass with other
+// parameters than the StorageClass of the parent.
+type crossSCCloneTestCase struct {
+	name string
+	// parent and clone are the parameters of the StorageClasses
+	parent map[string]string
+	clone  map[string]string
+	// pool and dataPool of the image of the clone
+	pool     string
+	dataPool string
+	// rejected is the error of the provisioner, when the clone is not
+	// supported
+	rejected string
+}
+
+var crossSCClones = []crossSCCloneTestCase{
+	{
+		name:  "different pool",
+		clone: map[string]string{"pool": crossSCClonePool},
+		pool:  crossSCClonePool,
+	},
+	{
+		name:     "different data pool",
+		clone:    map[string]string{"dataPool": erasureCodedPool},
+		pool:     defaultRBDPool,
+		dataPool: erasureCodedPool,
+	},
+	{
+		name:     "encrypted clone of an unencrypted volume",
+		clone:    map[string]string{"encrypted": "true"},
+		rejected: errEncryptedFromUnencrypted,
+	},
+	{
+		name:     "unencrypted clone of an encrypted volume",
+		parent:   map[string]string{"encrypted": "true"},
+		rejected: errUnencryptedFromEncrypted,
+	},
+}
+
+// validateCrossSCClone creates a parent PVC in a StorageClass with the
+// parameters of the parent, and clones it with a StorageClass with the
+// parameters of the clone. Supported clones need to have the data of the
+// parent, and to be stored in the pool and data pool of their StorageClass.
+// The provisioner needs to reject the other clones with a precise error.
+func validateCrossSCClone(
+	f *framework.Framework,
+	tc *crossSCCloneTestCase,
+	pvcPath, appPath, pvcSmartClonePath, appSmartClonePath string,
+) error {
+	parentSC := resourceName("cross-sc-parent")
+	cloneSC := resourceName("cross-sc-clone")
+	for name, params := range map[string]map[string]string{parentSC: tc.parent, cloneSC: tc.clone} {
+		err := createRBDStorageClass(f.ClientSet, f, name, nil, params, deletePolicy)
+		if err != nil {
+			return fmt.Errorf("failed to create storageclass %s: %w", name, err)
+		}
+	}
+	defer func() {
+		for _, name := range []string{parentSC, cloneSC} {
+			scErr := retryKubectlArgs(
+				cephCSINamespace,
+				kubectlDelete,
+				deployTimeout,
+				"sc",
+				name,
+				"--ignore-not-found=true")
+			if scErr != nil {
+				e2elog.Failf("failed to delete storageclass %s: %v", name, scErr)
+			}
+		}
+	}()
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.StorageClassName = &parentSC
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	err = createPVCAndApp("cross-sc-parent", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create parent PVC and application: %w", err)
+	}
+	ds := newDataset("cross-sc", 2, 64)
+	err = ds.write(f, app)
+	if err != nil {
+		return err
+	}
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	clone, err := loadPVC(pvcSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	clone.Name = "cross-sc-clone"
+	clone.Namespace = f.UniqueName
+	clone.Spec.StorageClassName = &cloneSC
+	clone.Spec.DataSource.Name = pvc.Name
+
+	if tc.rejected != "" {
+		err = validateRejectedPVC(f, clone, tc.rejected)
+	} else {
+		err = validateCrossSCCloneData(f, tc, ds, clone, appSmartClonePath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+}
+
+// validateCrossSCCloneData creates the clone with an app, and checks its data
+// and where the image of the clone is stored.
+func validateCrossSCCloneData(
+	f *framework.Framework,
+	tc *crossSCCloneTestCase,
+	ds *dataset,
+	clone *v1.PersistentVolumeClaim,
+	appSmartClonePath string,
+) error {
+	app, err := loadApp(appSmartClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	err = createPVCAndApp(clone.Name, f, clone, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create clone and application: %w", err)
+	}
+	err = ds.verify(f, app)
+	if err != nil {
+		return err
+	}
+	err = checkPVCImageInPool(f, clone, tc.pool)
+	if err != nil {
+		return fmt.Errorf("image of clone %s not in pool %s: %w", clone.Name, tc.pool, err)
+	}
+	if tc.dataPool != "" {
+		err = checkPVCDataPoolForImageInPool(f, clone, tc.pool, tc.dataPool)
+		if err != nil {
+			return err
+		}
+	}
+
+	return deletePVCAndApp("", f, clone, app)
+}
+
+// validateCrossSCClones clones PVCs into StorageClasses with another pool,
+// data pool or encryption setting than the StorageClass of their parent.
+func validateCrossSCClones(
+	f *framework.Framework,
+	pvcPath, appPath, pvcSmartClonePath, appSmartClonePath string,
+) error {
+	err := createRBDPool(f, crossSCClonePool)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		poolErr := deletePool(crossSCClonePool, false, f)
+		if poolErr != nil {
+			e2elog.Failf("failed to delete pool %s: %v", crossSCClonePool, poolErr)
+		}
+	}()
+
+	for i := range crossSCClones {
+		tc := &crossSCClones[i]
+		e2elog.Logf("validating clone with %s", tc.name)
+		err = validateCrossSCClone(f, tc, pvcPath, appPath, pvcSmartClonePath, appSmartClonePath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,372 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csi-addons/spec/lib/go/fence"
+	"github.com/csi-addons/spec/lib/go/replication"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// csiAddonsSocket is the UNIX domain socket of the CSI-Addons server in the
+// csi-rbdplugin container of the provisioner.
+const csiAddonsSocket = "/csi/csi-addons.sock"
+
+// socketBridge is a python script that copies stdin to the UNIX domain socket
+// in argv[1], and the data from the socket to stdout. There is no CSI-Addons
+// sidecar in the deployment, the bridge is used to connect to the CSI-Addons
+// server in the provisioner over the exec API of Kubernetes.
+const socketBridge = `
+import socket, sys, threading
+s = socket.socket(socket.AF_UNIX)
+s.connect(sys.argv[1])
+def send():
+    while True:
+        data = sys.stdin.buffer.read1(65536)
+        if not data:
+            break
+        s.sendall(data)
+    s.shutdown(socket.SHUT_WR)
+threading.Thread(target=send, daemon=True).start()
+while True:
+    data = s.recv(65536)
+    if not data:
+        break
+    sys.stdout.buffer.write(data)
+    sys.stdout.buffer.flush()
+`
+
+// execConn is a net.Conn over the stdin and stdout of a command that is
+// executed in a container.
+type execConn struct {
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+
+	closeOnce sync.Once
+}
+
+func (c *execConn) Read(b []byte) (int, error) {
+	return c.stdout.Read(b)
+}
+
+func (c *execConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close closes stdin, which makes the command exit.
+func (c *execConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.stdin.Close()
+		c.stdout.Close()
+	})
+
+	return nil
+}
+
+func (c *execConn) LocalAddr() net.Addr                { return execAddr{} }
+func (c *execConn) RemoteAddr() net.Addr               { return execAddr{} }
+func (c *execConn) SetDeadline(_ time.Time) error      { return nil }
+func (c *execConn) SetReadDeadline(_ time.Time) error  { return nil }
+func (c *execConn) SetWriteDeadline(_ time.Time) error { return nil }
+
+type execAddr struct{}
+
+func (execAddr) Network() string { return "exec" }
+func (execAddr) String() string  { return "exec" }
+
+// dialExec executes the command in the container of the pod, and returns a
+// connection to its stdin and stdout.
+func dialExec(f *framework.Framework, ns, podName, containerName string, command []string) (net.Conn, error) {
+	config, err := framework.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	req := f.ClientSet.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(podName).
+		Namespace(ns).
+		SubResource("exec").
+		VersionedParams(&v1.PodExecOptions{
+			Container: containerName,
+			Command:   command,
+			Stdin:     true,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+	exec, err := remotecommand.NewSPDYExecutor(config, "POST", req.URL())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create executor: %w", err)
+	}
+
+	stdinReader, stdinWriter := io.Pipe()
+	stdoutReader, stdoutWriter := io.Pipe()
+	stderr := &strings.Builder{}
+	go func() {
+		streamErr := exec.Stream(remotecommand.StreamOptions{
+			Stdin:  stdinReader,
+			Stdout: stdoutWriter,
+			Stderr: stderr,
+		})
+		if streamErr != nil {
+			e2elog.Logf("command %v in pod %s/%s failed: %v, stderr: %s", command, ns, podName, streamErr, stderr)
+			stdoutWriter.CloseWithError(streamErr)
+
+			return
+		}
+		stdoutWriter.Close()
+	}()
+
+	return &execConn{stdin: stdinWriter, stdout: stdoutReader}, nil
+}
+
+// replicationClient calls the replication procedures of the CSI-Addons
+// server of the RBD provisioner, in the same way as the VolumeReplication
+// controller does.
+type replicationClient struct {
+	conn   *grpc.ClientConn
+	client replication.ControllerClient
+	// secrets are the credentials of the provisioner
+	secrets map[string]string
+}
+
+// getRunningDeploymentPod returns the name of a running pod of the deployment
+// in cephCSINamespace.
+func getRunningDeploymentPod(f *framework.Framework, deploymentName string) (string, error) {
+	selector, err := getDeploymentLabelSelector(f, cephCSINamespace, deploymentName)
+	if err != nil {
+		return "", err
+	}
+	pods, err := listPods(f, cephCSINamespace, &metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return "", fmt.Errorf("failed to list pods of deployment %s: %w", deploymentName, err)
+	}
+	for i := range pods {
+		if pods[i].Status.Phase == v1.PodRunning {
+			return pods[i].Name, nil
+		}
+	}
+
+	return "", fmt.Errorf("no running pod of deployment %s", deploymentName)
+}
+
+// getSecretData returns the data of the secret in cephCSINamespace, like the
+// credentials that the sidecars pass to the CSI procedures.
+func getSecretData(f *framework.Framework, secretName string) (map[string]string, error) {
+	secret, err := f.ClientSet.CoreV1().Secrets(cephCSINamespace).Get(
+		context.TODO(),
+		secretName,
+		metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s: %w", secretName, err)
+	}
+	data := make(map[string]string, len(secret.Data))
+	for k, v := range secret.Data {
+		data[k] = string(v)
+	}
+
+	return data, nil
+}
+
+// dialCSIAddons connects to the CSI-Addons server of a running RBD
+// provisioner pod, and returns the connection and the credentials of the
+// provisioner.
+func dialCSIAddons(f *framework.Framework) (*grpc.ClientConn, map[string]string, error) {
+	podName, err := getRunningDeploymentPod(f, rbdDeploymentName)
+	if err != nil {
+		return nil, nil, err
+	}
+	secrets, err := getSecretData(f, rbdProvisionerSecretName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	conn, err := grpc.Dial(
+		"passthrough:///csi-addons",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			return dialExec(f, cephCSINamespace, podName, "csi-rbdplugin",
+				[]string{"python3", "-c", socketBridge, csiAddonsSocket})
+		}))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to CSI-Addons server in pod %s: %w", podName, err)
+	}
+
+	return conn, secrets, nil
+}
+
+// newReplicationClient connects to the CSI-Addons server of a running RBD
+// provisioner pod. Close() needs to be called when the client is not needed
+// anymore.
+func newReplicationClient(f *framework.Framework) (*replicationClient, error) {
+	conn, secrets, err := dialCSIAddons(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replicationClient{
+		conn:    conn,
+		client:  replication.NewControllerClient(conn),
+		secrets: secrets,
+	}, nil
+}
+
+func (rc *replicationClient) Close() error {
+	return rc.conn.Close()
+}
+
+// replicationParameters are the parameters of the VolumeReplicationClass
+// that is used by the tests.
+func replicationParameters() map[string]string {
+	return map[string]string{
+		"mirroringMode": "snapshot",
+	}
+}
+
+func (rc *replicationClient) enableVolumeReplication(volumeID string) error {
+	_, err := rc.client.EnableVolumeReplication(context.TODO(), &replication.EnableVolumeReplicationRequest{
+		VolumeId:   volumeID,
+		Parameters: replicationParameters(),
+		Secrets:    rc.secrets,
+	})
+
+	return err
+}
+
+func (rc *replicationClient) disableVolumeReplication(volumeID string) error {
+	_, err := rc.client.DisableVolumeReplication(context.TODO(), &replication.DisableVolumeReplicationRequest{
+		VolumeId:   volumeID,
+		Parameters: replicationParameters(),
+		Secrets:    rc.secrets,
+	})
+
+	return err
+}
+
+func (rc *replicationClient) promoteVolume(volumeID string, force bool) error {
+	_, err := rc.client.PromoteVolume(context.TODO(), &replication.PromoteVolumeRequest{
+		VolumeId:   volumeID,
+		Force:      force,
+		Parameters: replicationParameters(),
+		Secrets:    rc.secrets,
+	})
+
+	return err
+}
+
+func (rc *replicationClient) demoteVolume(volumeID string) error {
+	_, err := rc.client.DemoteVolume(context.TODO(), &replication.DemoteVolumeRequest{
+		VolumeId:   volumeID,
+		Parameters: replicationParameters(),
+		Secrets:    rc.secrets,
+	})
+
+	return err
+}
+
+// resyncVolume requests a resync of the volume, and returns true when the
+// volume is ready to use.
+func (rc *replicationClient) resyncVolume(volumeID string, force bool) (bool, error) {
+	resp, err := rc.client.ResyncVolume(context.TODO(), &replication.ResyncVolumeRequest{
+		VolumeId:   volumeID,
+		Force:      force,
+		Parameters: replicationParameters(),
+		Secrets:    rc.secrets,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return resp.GetReady(), nil
+}
+
+// fenceClient calls the network fence procedures of the CSI-Addons server of
+// the RBD provisioner, in the same way as the NetworkFence controller does.
+type fenceClient struct {
+	conn   *grpc.ClientConn
+	client fence.FenceControllerClient
+	// secrets are the credentials of the provisioner
+	secrets map[string]string
+}
+
+// newFenceClient connects to the CSI-Addons server of a running RBD
+// provisioner pod. Close() needs to be called when the client is not needed
+// anymore.
+func newFenceClient(f *framework.Framework) (*fenceClient, error) {
+	conn, secrets, err := dialCSIAddons(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fenceClient{
+		conn:    conn,
+		client:  fence.NewFenceControllerClient(conn),
+		secrets: secrets,
+	}, nil
+}
+
+func (fc *fenceClient) Close() error {
+	return fc.conn.Close()
+}
+
+// fenceCIDRs converts the CIDR blocks to the CIDRs of a fence request.
+func fenceCIDRs(cidrs []string) []*fence.CIDR {
+	fenceCidrs := make([]*fence.CIDR, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		fenceCidrs = append(fenceCidrs, &fence.CIDR{Cidr: cidr})
+	}
+
+	return fenceCidrs
+}
+
+// fenceClusterNetwork blocklists the clients in the CIDR blocks in the
+// cluster.
+func (fc *fenceClient) fenceClusterNetwork(clusterID string, cidrs []string) error {
+	_, err := fc.client.FenceClusterNetwork(context.TODO(), &fence.FenceClusterNetworkRequest{
+		Parameters: map[string]string{"clusterID": clusterID},
+		Secrets:    fc.secrets,
+		Cidrs:      fenceCIDRs(cidrs),
+	})
+
+	return err
+}
+
+// unfenceClusterNetwork removes the clients in the CIDR blocks from the
+// blocklist of the cluster.
+func (fc *fenceClient) unfenceClusterNetwork(clusterID string, cidrs []string) error {
+	_, err := fc.client.UnfenceClusterNetwork(context.TODO(), &fence.UnfenceClusterNetworkRequest{
+		Parameters: map[string]string{"clusterID": clusterID},
+		Secrets:    fc.secrets,
+		Cidrs:      fenceCIDRs(cidrs),
+	})
+
+	return err
+}
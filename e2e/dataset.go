@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// dataset is a number of files with random content in a directory of a
+// volume. The checksums of the files are recorded when they are written, so
+// that the content of a restored snapshot, a clone, a failed over or an
+// expanded volume can be verified.
+type dataset struct {
+	// dir is the directory of the files, relative to the mount path
+	dir string
+	// files is the number of files
+	files int
+	// fileSizeKiB is the size of each file
+	fileSizeKiB int
+	// checksums are the sha512sums of the files, by name
+	checksums map[string]string
+}
+
+// newDataset returns a dataset of files in dir, which is not written yet.
+func newDataset(dir string, files, fileSizeKiB int) *dataset {
+	return &dataset{
+		dir:         dir,
+		files:       files,
+		fileSizeKiB: fileSizeKiB,
+	}
+}
+
+// dirIn returns the directory of the dataset in the volume of the app.
+func (ds *dataset) dirIn(app *v1.Pod) string {
+	return path.Join(app.Spec.Containers[0].VolumeMounts[0].MountPath, ds.dir)
+}
+
+// checksumCommand returns the command that prints the checksums of the
+// files of the dataset in the directory.
+func checksumCommand(dir string) string {
+	return fmt.Sprintf("cd %s && sha512sum file-*", dir)
+}
+
+// write writes the files of the dataset in the volume of the app, and
+// records their checksums. Existing files are overwritten.
+func (ds *dataset) write(f *framework.Framework, app *v1.Pod) error {
+	dir := ds.dirIn(app)
+	cmd := fmt.Sprintf("mkdir -p %[1]s && for i in $(seq 1 %[2]d); do "+
+		"dd if=/dev/urandom of=%[1]s/file-$i bs=1K count=%[3]d status=none || exit 1; "+
+		"done && sync && %[4]s",
+		dir, ds.files, ds.fileSizeKiB, checksumCommand(dir))
+	stdOut, stdErr, err := execCommandInContainerByPodName(
+		f, cmd, app.Namespace, app.Name, app.Spec.Containers[0].Name)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to write dataset in %s of pod %s: %v, stdErr: %s", dir, app.Name, err, stdErr)
+	}
+
+	checksums, err := parseChecksums(stdOut)
+	if err != nil {
+		return err
+	}
+	if len(checksums) != ds.files {
+		return fmt.Errorf("wrote %d files in %s of pod %s, expected %d", len(checksums), dir, app.Name, ds.files)
+	}
+	ds.checksums = checksums
+
+	return nil
+}
+
+// verify checks that the files in the volume of the app have the content
+// that was written by write(). The app can use a different volume than the
+// one the dataset was written to, like a clone of it.
+func (ds *dataset) verify(f *framework.Framework, app *v1.Pod) error {
+	if ds.checksums == nil {
+		return fmt.Errorf("dataset %s was not written", ds.dir)
+	}
+
+	dir := ds.dirIn(app)
+	stdOut, stdErr, err := execCommandInContainerByPodName(
+		f, checksumCommand(dir), app.Namespace, app.Name, app.Spec.Containers[0].Name)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to read dataset in %s of pod %s: %v, stdErr: %s", dir, app.Name, err, stdErr)
+	}
+	checksums, err := parseChecksums(stdOut)
+	if err != nil {
+		return err
+	}
+
+	problems := compareChecksums(ds.checksums, checksums)
+	if len(problems) != 0 {
+		return fmt.Errorf("dataset in %s of pod %s is corrupted: %s", dir, app.Name, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// parseChecksums parses the output of sha512sum into the checksums of the
+// files, by name.
+func parseChecksums(out string) (map[string]string, error) {
+	checksums := map[string]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("failed to parse checksum %q", line)
+		}
+		checksums[fields[1]] = fields[0]
+	}
+
+	return checksums, nil
+}
+
+// compareChecksums returns the files that are missing, have a different
+// checksum, or were not expected.
+func compareChecksums(expected, actual map[string]string) []string {
+	problems := []string{}
+	for name, sum := range expected {
+		got, ok := actual[name]
+		switch {
+		case !ok:
+			problems = append(problems, name+" is missing")
+		case got != sum:
+			problems = append(problems, name+" has different content")
+		}
+	}
+	for name := range actual {
+		if _, ok := expected[name]; !ok {
+			problems = append(problems, name+" is unexpected")
+		}
+	}
+	sort.Strings(problems)
+
+	return problems
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseChecksums(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		out      string
+		expected map[string]string
+		wantErr  bool
+	}{
+		{
+			name: "sha512sum output",
+			out:  "1111  file-1\n2222  file-2\n",
+			expected: map[string]string{
+				"file-1": "1111",
+				"file-2": "2222",
+			},
+		},
+		{
+			name:     "no output",
+			out:      "",
+			expected: map[string]string{},
+		},
+		{
+			name:    "unexpected output",
+			out:     "sha512sum: file-*: No such file or directory",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			checksums, err := parseChecksums(ts.out)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("parseChecksums() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if !ts.wantErr && !reflect.DeepEqual(checksums, ts.expected) {
+				t.Errorf("parseChecksums() = %v, expected %v", checksums, ts.expected)
+			}
+		})
+	}
+}
+
+func TestCompareChecksums(t *testing.T) {
+	t.Parallel()
+	expected := map[string]string{
+		"file-1": "1111",
+		"file-2": "2222",
+	}
+	tests := []struct {
+		name     string
+		actual   map[string]string
+		problems []string
+	}{
+		{
+			name: "intact",
+			actual: map[string]string{
+				"file-1": "1111",
+				"file-2": "2222",
+			},
+			problems: []string{},
+		},
+		{
+			name: "corrupted and missing",
+			actual: map[string]string{
+				"file-1": "3333",
+			},
+			problems: []string{"file-1 has different content", "file-2 is missing"},
+		},
+		{
+			name: "unexpected file",
+			actual: map[string]string{
+				"file-1": "1111",
+				"file-2": "2222",
+				"file-3": "3333",
+			},
+			problems: []string{"file-3 is unexpected"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			problems := compareChecksums(expected, ts.actual)
+			if !reflect.DeepEqual(problems, ts.problems) {
+				t.Errorf("compareChecksums() = %q, expected %q", problems, ts.problems)
+			}
+		})
+	}
+}
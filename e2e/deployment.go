@@ -58,6 +58,21 @@ func execCommandInPodWithName(
 	return f.ExecWithOptions(podOpt)
 }
 
+// getDeploymentLabelSelector returns the label selector of the pods of the
+// deployment, the labels are not the same for helm and non-helm deployments.
+func getDeploymentLabelSelector(f *framework.Framework, ns, deploymentName string) (string, error) {
+	deployment, err := f.ClientSet.AppsV1().Deployments(ns).Get(context.TODO(), deploymentName, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get deployment %s in namespace %s: %w", deploymentName, ns, err)
+	}
+	s, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse selector of deployment %s in namespace %s: %w", deploymentName, ns, err)
+	}
+
+	return s.String(), nil
+}
+
 // loadAppDeployment loads the deployment app config and return deployment
 // object.
 func loadAppDeployment(path string) (*appsv1.Deployment, error) {
@@ -237,6 +252,9 @@ type yamlResourceNamespaced struct {
 	// enable topology support (for RBD)
 	enableTopology bool
 	domainLabel    string
+
+	// start the metrics endpoint of the driver on the port
+	metricsPort int
 }
 
 func (yrn *yamlResourceNamespaced) Do(action kubectlAction) error {
@@ -257,6 +275,10 @@ func (yrn *yamlResourceNamespaced) Do(action kubectlAction) error {
 		data = addTopologyDomainsToDSYaml(data, yrn.domainLabel)
 	}
 
+	if yrn.metricsPort != 0 {
+		data = enableMetricsInTemplate(data, yrn.metricsPort)
+	}
+
 	err = retryKubectlInput(yrn.namespace, action, data, deployTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to %s resource %q in namespace %q: %w", action, yrn.filename, yrn.namespace, err)
@@ -0,0 +1,423 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// drPeerSecretName is the secret with the credentials of the admin of
+	// the Rook cluster in peerRookNamespace.
+	drPeerSecretName = "cephcsi-rbd-peer-secret"
+	// drPeerStorageClass is the StorageClass of the static PV of the
+	// promoted image in the peer cluster, it does not need to exist.
+	drPeerStorageClass = "dr-peer"
+)
+
+// drScenario is the disaster recovery of a replicated PVC. The stages fail
+// the volume over to the peer cluster, run a workload on the promoted image
+// there, and fail the volume back with the data of that workload. Every stage
+// checks the mirroring state of the image in both clusters before it returns.
+type drScenario struct {
+	f        *framework.Framework
+	rc       *replicationClient
+	pool     string
+	pvc      *v1.PersistentVolumeClaim
+	pv       *v1.PersistentVolume
+	app      *v1.Pod
+	image    string
+	volumeID string
+	// primaryData is written before the failover, peerData by the workload
+	// in the peer cluster
+	primaryData *dataset
+	peerData    *dataset
+}
+
+// newDRScenario creates the PVC and writes the data of the primary cluster
+// to it. The app is deleted afterwards, as the image can not be in use while
+// it is demoted and resynced.
+func newDRScenario(f *framework.Framework, pvcPath, appPath string) (*drScenario, error) {
+	s := &drScenario{
+		f:           f,
+		pool:        defaultRBDPool,
+		primaryData: newDataset("primary", 4, 1024),
+		peerData:    newDataset("failover", 2, 1024),
+	}
+	err := setupMirrorPeers(f, s.pool)
+	if err != nil {
+		return nil, err
+	}
+
+	s.pvc, err = loadPVC(pvcPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load PVC: %w", err)
+	}
+	s.pvc.Namespace = f.UniqueName
+	s.app, err = loadApp(appPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load application: %w", err)
+	}
+	s.app.Namespace = f.UniqueName
+	s.app.Labels = map[string]string{"app": "rbd-mirror"}
+	s.app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = s.pvc.Name
+	err = createPVCAndApp("", f, s.pvc, s.app, deployTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	err = s.primaryData.write(f, s.app)
+	if err != nil {
+		return nil, err
+	}
+	err = deletePod(s.app.Name, s.app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	imageData, err := getImageInfoFromPVC(s.pvc.Namespace, s.pvc.Name, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image of PVC: %w", err)
+	}
+	s.image = imageData.imageName
+	s.volumeID = imageData.csiVolumeHandle
+	_, s.pv, err = getPVCAndPV(f.ClientSet, s.pvc.Name, s.pvc.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	s.rc, err = newReplicationClient(f)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// close closes the connection to the CSI-Addons server.
+func (s *drScenario) close() {
+	err := s.rc.Close()
+	if err != nil {
+		e2elog.Logf("failed to close connection to the CSI-Addons server: %v", err)
+	}
+}
+
+// replicate enables replication of the volume, and waits until the peer
+// cluster has a non-primary copy of the image with all of its data.
+func (s *drScenario) replicate() error {
+	err := s.rc.enableVolumeReplication(s.volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to enable replication: %w", err)
+	}
+	err = waitForImageMirroring(s.f, rookNamespace, s.pool, s.image, true)
+	if err != nil {
+		return err
+	}
+	err = waitForImageMirroring(s.f, peerRookNamespace, s.pool, s.image, false)
+	if err != nil {
+		return err
+	}
+
+	return waitForMirrorImageReplayed(s.f, peerRookNamespace, s.pool, s.image)
+}
+
+// failover promotes the image in the peer cluster, as it would be done by the
+// driver of the peer site when the primary site is lost. The volume in the
+// primary cluster is demoted and resynced, so that it follows the peer.
+func (s *drScenario) failover() error {
+	err := execCommandInToolBoxPodAndCheck(
+		s.f,
+		"rbd mirror image promote --force "+imageSpec(s.pool, s.image),
+		peerRookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to promote image in cluster %s: %w", peerRookNamespace, err)
+	}
+	err = waitForImageMirroring(s.f, peerRookNamespace, s.pool, s.image, true)
+	if err != nil {
+		return err
+	}
+	err = s.rc.demoteVolume(s.volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to demote volume: %w", err)
+	}
+	err = waitForImageMirroring(s.f, rookNamespace, s.pool, s.image, false)
+	if err != nil {
+		return err
+	}
+
+	return waitForResync(s.rc, s.volumeID, false)
+}
+
+// runPeerWorkload mounts the promoted image in the peer cluster with a static
+// PV in an app from appPath. The app needs to see the data of the primary
+// cluster, and writes the data that needs to be failed back.
+func (s *drScenario) runPeerWorkload(appPath string) error {
+	peerID, previous, err := addPeerCluster(s.f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		configErr := setCSIConfig(s.f, previous)
+		if configErr != nil {
+			e2elog.Failf("failed to remove peer cluster from the CSI config: %v", configErr)
+		}
+	}()
+	err = createPeerSecret(s.f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		secretErr := s.f.ClientSet.CoreV1().Secrets(cephCSINamespace).Delete(
+			context.TODO(),
+			drPeerSecretName,
+			metav1.DeleteOptions{})
+		if secretErr != nil {
+			e2elog.Failf("failed to delete secret %s: %v", drPeerSecretName, secretErr)
+		}
+	}()
+
+	attrs := map[string]string{
+		"clusterID":     peerID,
+		"pool":          s.pool,
+		"staticVolume":  strconv.FormatBool(true),
+		"imageFeatures": staticPVImageFeature,
+	}
+	if radosNamespace != "" {
+		attrs["radosNamespace"] = radosNamespace
+	}
+	name := "dr-peer-" + s.pvc.Name
+	size := s.pvc.Spec.Resources.Requests[v1.ResourceStorage]
+	pv := getStaticPV(name, s.image, size.String(), drPeerSecretName, cephCSINamespace, drPeerStorageClass,
+		rbdDriverName, false, attrs, nil, retainPolicy)
+	// the image has the filesystem of the PVC
+	pv.Spec.CSI.FSType = s.pv.Spec.CSI.FSType
+	pvc := getStaticPVC(name, name, size.String(), s.pvc.Namespace, drPeerStorageClass, false)
+	err = createStaticPVAndPVC(s.f, pv, pvc)
+	if err != nil {
+		return err
+	}
+	app, _, err := createStaticApp(s.f, appPath, pvc)
+	if err != nil {
+		return err
+	}
+	err = s.primaryData.verify(s.f, app)
+	if err != nil {
+		return fmt.Errorf("data of the promoted image in cluster %s: %w", peerRookNamespace, err)
+	}
+	err = s.peerData.write(s.f, app)
+	if err != nil {
+		return err
+	}
+	err = deletePod(app.Name, app.Namespace, s.f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	return deleteStaticPVAndPVC(s.f, pv, pvc)
+}
+
+// failback demotes the image in the peer cluster, resyncs the volume until
+// it has the data of the peer, and promotes it again. The peer cluster needs
+// to follow the volume afterwards.
+func (s *drScenario) failback() error {
+	err := execCommandInToolBoxPodAndCheck(s.f, "rbd mirror image demote "+imageSpec(s.pool, s.image), peerRookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to demote image in cluster %s: %w", peerRookNamespace, err)
+	}
+	err = waitForImageMirroring(s.f, peerRookNamespace, s.pool, s.image, false)
+	if err != nil {
+		return err
+	}
+	err = waitForResync(s.rc, s.volumeID, true)
+	if err != nil {
+		return err
+	}
+	err = s.rc.promoteVolume(s.volumeID, false)
+	if err != nil {
+		return fmt.Errorf("failed to promote volume: %w", err)
+	}
+	err = waitForImageMirroring(s.f, rookNamespace, s.pool, s.image, true)
+	if err != nil {
+		return err
+	}
+
+	return waitForMirrorImageReplayed(s.f, peerRookNamespace, s.pool, s.image)
+}
+
+// verify starts the app on the failed back PVC, which needs to have the data
+// of the primary cluster and the data that was written in the peer cluster.
+func (s *drScenario) verify() error {
+	err := createApp(s.f.ClientSet, s.app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+	err = s.primaryData.verify(s.f, s.app)
+	if err != nil {
+		return err
+	}
+
+	return s.peerData.verify(s.f, s.app)
+}
+
+// disableReplication disables replication of the volume, which removes the
+// image from the peer cluster, and deletes the PVC and the app.
+func (s *drScenario) disableReplication() error {
+	err := s.rc.disableVolumeReplication(s.volumeID)
+	if err != nil {
+		return fmt.Errorf("failed to disable replication: %w", err)
+	}
+	err = waitForPeerImageDeleted(s.f, s.pool, s.image)
+	if err != nil {
+		return err
+	}
+	err = deletePVCAndApp("", s.f, s.pvc, s.app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC and application: %w", err)
+	}
+
+	return nil
+}
+
+// withCluster returns the CSI config file with the cluster, which replaces a
+// cluster with the same ID.
+func withCluster(config string, cluster util.ClusterInfo) (string, error) {
+	var clusters []util.ClusterInfo
+	err := json.Unmarshal([]byte(config), &clusters)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse CSI config %q: %w", config, err)
+	}
+	updated := []util.ClusterInfo{}
+	for i := range clusters {
+		if clusters[i].ClusterID != cluster.ClusterID {
+			updated = append(updated, clusters[i])
+		}
+	}
+	updated = append(updated, cluster)
+	data, err := json.Marshal(updated)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
+
+// addPeerCluster adds the Rook cluster in peerRookNamespace to the CSI config
+// file. It returns the ID of the peer cluster, and the previous content of the
+// config file.
+func addPeerCluster(f *framework.Framework) (string, string, error) {
+	fsID, stdErr, err := execCommandInToolBoxPod(f, "ceph fsid", peerRookNamespace)
+	if err != nil || stdErr != "" {
+		return "", "", fmt.Errorf("failed to get fsid of cluster %s: %v, stderr: %s", peerRookNamespace, err, stdErr)
+	}
+	mons, err := getMons(peerRookNamespace, f.ClientSet)
+	if err != nil {
+		return "", "", err
+	}
+	peer := util.ClusterInfo{
+		ClusterID: strings.TrimSpace(fsID),
+		Monitors:  mons,
+	}
+	peer.RBD.RadosNamespace = radosNamespace
+
+	cm, err := f.ClientSet.CoreV1().ConfigMaps(cephCSINamespace).Get(
+		context.TODO(),
+		csiConfigMapName,
+		metav1.GetOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get configmap %s: %w", csiConfigMapName, err)
+	}
+	previous := cm.Data["config.json"]
+	config, err := withCluster(previous, peer)
+	if err != nil {
+		return "", "", err
+	}
+	err = setCSIConfig(f, config)
+	if err != nil {
+		return "", "", err
+	}
+
+	return peer.ClusterID, previous, nil
+}
+
+// createPeerSecret creates the drPeerSecretName secret with the key of the
+// admin of the Rook cluster in peerRookNamespace.
+func createPeerSecret(f *framework.Framework) error {
+	key, stdErr, err := execCommandInToolBoxPod(f, "ceph auth get-key client.admin", peerRookNamespace)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to get admin key of cluster %s: %v, stderr: %s", peerRookNamespace, err, stdErr)
+	}
+	sc, err := getSecret(rbdExamplePath + "secret.yaml")
+	if err != nil {
+		return err
+	}
+	sc.Name = drPeerSecretName
+	sc.Namespace = cephCSINamespace
+	sc.StringData["userID"] = "admin"
+	sc.StringData["userKey"] = strings.TrimSpace(key)
+	_, err = f.ClientSet.CoreV1().Secrets(cephCSINamespace).Create(context.TODO(), &sc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create secret %s: %w", drPeerSecretName, err)
+	}
+
+	return nil
+}
+
+// validateVolumeReplication runs the stages of the disaster recovery of a
+// replicated PVC one after the other. The CSI-Addons server is called in the
+// same way as by the VolumeReplication operator. The peer cluster is not
+// managed by Ceph-CSI, the image is promoted and demoted there with the rbd
+// command, as it would be done by the driver of the peer site.
+func validateVolumeReplication(pvcPath, appPath string, f *framework.Framework) error {
+	s, err := newDRScenario(f, pvcPath, appPath)
+	if err != nil {
+		return err
+	}
+	defer s.close()
+
+	stages := []struct {
+		name string
+		run  func() error
+	}{
+		{name: "replicate the volume to the peer cluster", run: s.replicate},
+		{name: "fail over to the peer cluster", run: s.failover},
+		{name: "run a workload on the promoted image", run: func() error {
+			return s.runPeerWorkload(appPath)
+		}},
+		{name: "fail back from the peer cluster", run: s.failback},
+		{name: "verify the data of the failed back volume", run: s.verify},
+		{name: "disable replication of the volume", run: s.disableReplication},
+	}
+	for _, stage := range stages {
+		e2elog.Logf("DR scenario: %s", stage.name)
+		err = stage.run()
+		if err != nil {
+			return fmt.Errorf("%s: %w", stage.name, err)
+		}
+	}
+
+	return nil
+}
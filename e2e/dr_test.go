@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+func TestWithCluster(t *testing.T) {
+	t.Parallel()
+	peer := util.ClusterInfo{ClusterID: "peer", Monitors: []string{"mon-b:6789"}}
+	tests := []struct {
+		name     string
+		config   string
+		expected []string
+	}{
+		{
+			name:     "added",
+			config:   `[{"clusterID":"primary","monitors":["mon-a:6789"]}]`,
+			expected: []string{"primary", "peer"},
+		},
+		{
+			name:     "replaced",
+			config:   `[{"clusterID":"peer","monitors":["old:6789"]},{"clusterID":"primary"}]`,
+			expected: []string{"primary", "peer"},
+		},
+		{
+			name:     "empty config",
+			config:   `[]`,
+			expected: []string{"peer"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			config, err := withCluster(ts.config, peer)
+			if err != nil {
+				t.Fatalf("withCluster() failed: %v", err)
+			}
+			var clusters []util.ClusterInfo
+			err = json.Unmarshal([]byte(config), &clusters)
+			if err != nil {
+				t.Fatalf("failed to parse %q: %v", config, err)
+			}
+			ids := []string{}
+			for i := range clusters {
+				ids = append(ids, clusters[i].ClusterID)
+			}
+			if !reflect.DeepEqual(ids, ts.expected) {
+				t.Errorf("withCluster() has clusters %v, expected %v", ids, ts.expected)
+			}
+			if last := clusters[len(clusters)-1]; !reflect.DeepEqual(last.Monitors, peer.Monitors) {
+				t.Errorf("withCluster() has monitors %v for the peer, expected %v", last.Monitors, peer.Monitors)
+			}
+		})
+	}
+
+	_, err := withCluster("not json", peer)
+	if err == nil {
+		t.Error("withCluster() of an invalid config succeeded")
+	}
+}
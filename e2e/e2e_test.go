@@ -23,6 +23,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -49,6 +50,27 @@ func init() {
 	flag.StringVar(&fileSystemName, "filesystem", "myfs", "CephFS filesystem to use")
 	flag.StringVar(&clusterID, "clusterid", "", "Ceph cluster ID to use (defaults to `ceph fsid` detection)")
 	flag.StringVar(&nfsDriverName, "nfs-driver", "nfs.csi.ceph.com", "name of the driver for NFS-volumes")
+	flag.StringVar(&peerRookNamespace, "peer-rook-namespace", "",
+		"namespace of a second Rook cluster that pools are mirrored to, enables the mirroring tests")
+	flag.IntVar(&benchmarkCount, "benchmark-count", 0,
+		"number of PVCs and snapshots to create in the benchmark, 0 disables the benchmark")
+	flag.IntVar(&benchmarkWorkers, "benchmark-workers", 5, "number of benchmark operations that run at the same time")
+	flag.IntVar(&snapshotScaleCount, "snapshot-scale-count", 0,
+		"number of snapshots to take of one PVC in the snapshot scale suite, 0 disables the suite")
+	flag.IntVar(&latencySLOSamples, "latency-slo-samples", 0,
+		"number of volumes of each type to measure the latency SLOs on, 0 disables the latency SLOs")
+	flag.DurationVar(&attachToReadySLO, "attach-to-ready-slo", 2*time.Minute,
+		"longest p90 latency from creating a pod with a volume until it is ready")
+	flag.DurationVar(&firstWriteSLO, "first-write-slo", 10*time.Second,
+		"longest p90 latency of the first write to a volume in a ready pod")
+	flag.StringVar(&resourcePrefix, "resource-prefix", "",
+		"prefix for the names of StorageClasses, Ceph users and other shared resources, for running concurrently")
+	flag.StringVar(&cephSecret, "ceph-secret", "",
+		"secret with userID and userKey to verify resources in the Ceph cluster without the Rook toolbox")
+	flag.StringVar(&cephMonitors, "ceph-monitors", "",
+		"comma separated Ceph monitors for --ceph-secret (defaults to the monitors of the Rook cluster)")
+	flag.StringVar(&externalClusterConfig, "ceph-cluster-config", "",
+		"cluster-access config with the monitors and admin key of a Ceph cluster that is not deployed by Rook")
 	setDefaultKubeconfig()
 
 	// Register framework flags, then handle flags
@@ -88,4 +110,24 @@ func handleFlags() {
 		testNFS = testCephFS
 		deployNFS = deployCephFS
 	}
+
+	// the NFS server and the peer cluster for mirroring are deployed by
+	// Rook.
+	if externalClusterConfig != "" {
+		var err error
+		externalCluster, err = loadClusterAccess(externalClusterConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if peerRookNamespace != "" {
+			log.Fatal("--peer-rook-namespace can not be used with --ceph-cluster-config")
+		}
+		testNFS = false
+		deployNFS = false
+	}
+
+	// the helm chart creates the StorageClasses with their default names
+	if helmTest && resourcePrefix != "" {
+		log.Fatal("--resource-prefix can not be used with --helm-test")
+	}
 }
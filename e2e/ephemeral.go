@@ -0,0 +1,479 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// ephemeralPVCName returns the name of the PVC that Kubernetes creates for
+// the generic ephemeral volume of the pod.
+func ephemeralPVCName(pod *v1.Pod, volume string) string {
+	return pod.Name + "-" + volume
+}
+
+// isOwnedByPod returns whether the pod controls the PVC, which makes the
+// garbage collector delete the PVC together with the pod.
+func isOwnedByPod(pvc *v1.PersistentVolumeClaim, pod *v1.Pod) bool {
+	owner := metav1.GetControllerOf(pvc)
+
+	return owner != nil && owner.Kind == "Pod" && owner.UID == pod.UID
+}
+
+// isPodReady returns whether the pod is ready, and not being deleted.
+func isPodReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// replacementPod returns the ready pod that is not the replaced pod, or nil
+// while the replaced pod still exists.
+func replacementPod(pods []v1.Pod, replaced types.UID) *v1.Pod {
+	var ready *v1.Pod
+	for i := range pods {
+		if pods[i].UID == replaced {
+			return nil
+		}
+		if ready == nil && isPodReady(&pods[i]) {
+			ready = &pods[i]
+		}
+	}
+
+	return ready
+}
+
+// podReplaced returns the condition that is met once the replaced pod is gone
+// and another pod is ready. An empty UID waits for the first ready pod.
+func podReplaced(replaced types.UID) stateCondition[[]v1.Pod] {
+	return stateCondition[[]v1.Pod]{
+		name: "replaced",
+		met: func(pods []v1.Pod) (bool, error) {
+			return replacementPod(pods, replaced) != nil, nil
+		},
+		describe: func(pods []v1.Pod) string {
+			states := make([]string, 0, len(pods))
+			for i := range pods {
+				states = append(states, fmt.Sprintf("%s on %q: %s, ready=%t",
+					pods[i].Name, pods[i].Spec.NodeName, pods[i].Status.Phase, isPodReady(&pods[i])))
+			}
+
+			return "[" + strings.Join(states, "; ") + "]"
+		},
+	}
+}
+
+// containerRestarted returns the condition that is met once the first
+// container of the pod restarted more often than restarts, and the pod is
+// ready again.
+func containerRestarted(restarts int32) stateCondition[*v1.Pod] {
+	return stateCondition[*v1.Pod]{
+		name: "restarted",
+		met: func(pod *v1.Pod) (bool, error) {
+			if len(pod.Status.ContainerStatuses) == 0 {
+				return false, nil
+			}
+
+			return pod.Status.ContainerStatuses[0].RestartCount > restarts && isPodReady(pod), nil
+		},
+		describe: func(pod *v1.Pod) string {
+			if len(pod.Status.ContainerStatuses) == 0 {
+				return "no container status"
+			}
+
+			return fmt.Sprintf("%d restarts, ready=%t", pod.Status.ContainerStatuses[0].RestartCount, isPodReady(pod))
+		},
+	}
+}
+
+// getEphemeralPVC returns the PVC of the first volume of the pod, which needs
+// to be bound and controlled by the pod.
+func getEphemeralPVC(f *framework.Framework, pod *v1.Pod) (*v1.PersistentVolumeClaim, error) {
+	name := ephemeralPVCName(pod, pod.Spec.Volumes[0].Name)
+	pvc, err := waitForState(
+		fmt.Sprintf("PVC %s/%s", pod.Namespace, name),
+		func() (*v1.PersistentVolumeClaim, error) {
+			return f.ClientSet.CoreV1().PersistentVolumeClaims(pod.Namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		},
+		pvcBound,
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	if !isOwnedByPod(pvc, pod) {
+		return nil, fmt.Errorf("PVC %s is not controlled by pod %s (%s)", pvc.Name, pod.Name, pod.UID)
+	}
+
+	return pvc, nil
+}
+
+// waitForPVCDeletion waits until the PVC is deleted.
+func waitForPVCDeletion(f *framework.Framework, pvc *v1.PersistentVolumeClaim) error {
+	return waitForDeletion(
+		fmt.Sprintf("PVC %s/%s", pvc.Namespace, pvc.Name),
+		func() (*v1.PersistentVolumeClaim, error) {
+			return f.ClientSet.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(
+				context.TODO(), pvc.Name, metav1.GetOptions{})
+		},
+		time.Duration(deployTimeout)*time.Minute)
+}
+
+// loadEphemeralApp loads the app with a generic ephemeral volume, with the
+// name.
+func loadEphemeralApp(f *framework.Framework, appPath, name string) (*v1.Pod, error) {
+	app, err := loadApp(appPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load application: %w", err)
+	}
+	if len(app.Spec.Volumes) == 0 || app.Spec.Volumes[0].Ephemeral == nil {
+		return nil, fmt.Errorf("application %s has no generic ephemeral volume", appPath)
+	}
+	app.Name = name
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": name}
+
+	return app, nil
+}
+
+// validateEphemeralContainerRestart restarts the container of a pod with a
+// generic ephemeral volume. The restarted container needs to use the same
+// PVC, with its data.
+func validateEphemeralContainerRestart(f *framework.Framework, appPath string) error {
+	app, err := loadEphemeralApp(f, appPath, "ephemeral-restart")
+	if err != nil {
+		return err
+	}
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+	pods := f.ClientSet.CoreV1().Pods(app.Namespace)
+	pod, err := pods.Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", app.Name, err)
+	}
+	pvc, err := getEphemeralPVC(f, pod)
+	if err != nil {
+		return err
+	}
+	ds := newDataset("ephemeral", 2, 64)
+	err = ds.write(f, pod)
+	if err != nil {
+		return err
+	}
+
+	var restarts int32
+	if len(pod.Status.ContainerStatuses) != 0 {
+		restarts = pod.Status.ContainerStatuses[0].RestartCount
+	}
+	// the exec session ends with the container
+	_, stdErr, err := execCommandInPodWithName(f, "kill 1", pod.Name, pod.Spec.Containers[0].Name, pod.Namespace)
+	if err != nil {
+		e2elog.Logf("stopping the container of %s returned %v, stdErr: %s", pod.Name, err, stdErr)
+	}
+	_, err = waitForState(
+		fmt.Sprintf("pod %s/%s", pod.Namespace, pod.Name),
+		func() (*v1.Pod, error) {
+			return pods.Get(context.TODO(), pod.Name, metav1.GetOptions{})
+		},
+		containerRestarted(restarts),
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return err
+	}
+	restartedPVC, err := getEphemeralPVC(f, pod)
+	if err != nil {
+		return err
+	}
+	if restartedPVC.UID != pvc.UID {
+		return fmt.Errorf("PVC %s was recreated when the container of %s restarted", pvc.Name, pod.Name)
+	}
+	err = ds.verify(f, pod)
+	if err != nil {
+		return fmt.Errorf("data of %s after container restart: %w", pod.Name, err)
+	}
+
+	err = deletePod(pod.Name, pod.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	return waitForPVCDeletion(f, pvc)
+}
+
+// ephemeralDeployment returns a deployment with the pod of the app as
+// template. The pods of the deployment get their own ephemeral volume.
+func ephemeralDeployment(app *v1.Pod) *appsv1.Deployment {
+	replicas := int32(1)
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      app.Name,
+			Namespace: app.Namespace,
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{MatchLabels: app.Labels},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: app.Labels},
+				Spec:       *app.Spec.DeepCopy(),
+			},
+		},
+	}
+}
+
+// waitForDeploymentPod waits until the replaced pod of the deployment is gone
+// and another pod is ready, and returns that pod.
+func waitForDeploymentPod(f *framework.Framework, deploy *appsv1.Deployment, replaced types.UID) (*v1.Pod, error) {
+	selector := metav1.FormatLabelSelector(deploy.Spec.Selector)
+	pods, err := waitForState(
+		"pods of deployment "+deploy.Name,
+		func() ([]v1.Pod, error) {
+			list, listErr := f.ClientSet.CoreV1().Pods(deploy.Namespace).List(context.TODO(),
+				metav1.ListOptions{LabelSelector: selector})
+			if listErr != nil {
+				return nil, listErr
+			}
+
+			return list.Items, nil
+		},
+		podReplaced(replaced),
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+
+	return replacementPod(pods, replaced), nil
+}
+
+// validateEphemeralReplacement writes data to the ephemeral volume of the pod
+// of the deployment, and replaces the pod with replace. The replacement pod
+// needs to get a new, empty, ephemeral volume, while the PVC of the replaced
+// pod is deleted with it.
+func validateEphemeralReplacement(
+	f *framework.Framework,
+	deploy *appsv1.Deployment,
+	replace func(pod *v1.Pod) error,
+) (*v1.Pod, error) {
+	pod, err := waitForDeploymentPod(f, deploy, "")
+	if err != nil {
+		return nil, err
+	}
+	pvc, err := getEphemeralPVC(f, pod)
+	if err != nil {
+		return nil, err
+	}
+	ds := newDataset("ephemeral", 2, 64)
+	err = ds.write(f, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	err = replace(pod)
+	if err != nil {
+		return nil, err
+	}
+	replacement, err := waitForDeploymentPod(f, deploy, pod.UID)
+	if err != nil {
+		return nil, err
+	}
+	e2elog.Logf("pod %s on node %s replaced %s on node %s", replacement.Name, replacement.Spec.NodeName,
+		pod.Name, pod.Spec.NodeName)
+	_, err = getEphemeralPVC(f, replacement)
+	if err != nil {
+		return nil, err
+	}
+	err = waitForPVCDeletion(f, pvc)
+	if err != nil {
+		return nil, fmt.Errorf("PVC of replaced pod %s: %w", pod.Name, err)
+	}
+
+	cmd := "test ! -e " + ds.dirIn(replacement)
+	_, stdErr, err := execCommandInPodWithName(f, cmd, replacement.Name, replacement.Spec.Containers[0].Name,
+		replacement.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("ephemeral volume of %s has the data of %s: %w, stdErr: %s", replacement.Name,
+			pod.Name, err, stdErr)
+	}
+
+	return replacement, nil
+}
+
+// deleteEphemeralDeployment deletes the deployment, and waits until the PVC
+// of its pod is deleted.
+func deleteEphemeralDeployment(f *framework.Framework, deploy *appsv1.Deployment, pod *v1.Pod) error {
+	err := deleteDeploymentApp(f.ClientSet, deploy.Name, deploy.Namespace, deployTimeout)
+	if err != nil {
+		return err
+	}
+
+	return waitForPVCDeletion(f, &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      ephemeralPVCName(pod, pod.Spec.Volumes[0].Name),
+			Namespace: pod.Namespace,
+		},
+	})
+}
+
+// validateEphemeralPodRecreate deletes the pod of a deployment with a generic
+// ephemeral volume, which is replaced by a pod with a new volume.
+func validateEphemeralPodRecreate(f *framework.Framework, appPath string) error {
+	app, err := loadEphemeralApp(f, appPath, "ephemeral-recreate")
+	if err != nil {
+		return err
+	}
+	deploy := ephemeralDeployment(app)
+	err = createDeploymentApp(f.ClientSet, deploy, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+	pod, err := validateEphemeralReplacement(f, deploy, func(pod *v1.Pod) error {
+		return deletePod(pod.Name, pod.Namespace, f.ClientSet, deployTimeout)
+	})
+	if err != nil {
+		return err
+	}
+
+	return deleteEphemeralDeployment(f, deploy, pod)
+}
+
+// evictPod evicts the pod through the eviction API, like "kubectl drain".
+func evictPod(f *framework.Framework, pod *v1.Pod) error {
+	err := f.ClientSet.CoreV1().Pods(pod.Namespace).EvictV1(context.TODO(), &policyv1.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      pod.Name,
+			Namespace: pod.Namespace,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to evict pod %s: %w", pod.Name, err)
+	}
+
+	return nil
+}
+
+// validateEphemeralNodeDrain drains the node of the pod of a deployment with
+// a generic ephemeral volume, by cordoning it and evicting the pod. The
+// replacement pod needs to run on another node with a new volume. The node
+// that is drained does not run the pods that the test executes commands in.
+func validateEphemeralNodeDrain(f *framework.Framework, appPath string) error {
+	drained, replacement, err := pickFailoverNodes(f)
+	if err != nil {
+		return err
+	}
+	if drained == "" {
+		e2elog.Logf("skipping node drain, the cluster needs two ready nodes")
+
+		return nil
+	}
+
+	app, err := loadEphemeralApp(f, appPath, "ephemeral-drain")
+	if err != nil {
+		return err
+	}
+	// the pod prefers the node that is drained, and can move to the
+	// replacement node only
+	nodeTerm := func(nodes ...string) v1.NodeSelectorTerm {
+		return v1.NodeSelectorTerm{
+			MatchFields: []v1.NodeSelectorRequirement{{
+				Key:      "metadata.name",
+				Operator: v1.NodeSelectorOpIn,
+				Values:   nodes,
+			}},
+		}
+	}
+	app.Spec.Affinity = &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{nodeTerm(drained, replacement)},
+			},
+			PreferredDuringSchedulingIgnoredDuringExecution: []v1.PreferredSchedulingTerm{{
+				Weight:     100,
+				Preference: nodeTerm(drained),
+			}},
+		},
+	}
+	deploy := ephemeralDeployment(app)
+	err = createDeploymentApp(f.ClientSet, deploy, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create deployment: %w", err)
+	}
+
+	err = setNodeUnschedulable(f, drained, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nodeErr := setNodeUnschedulable(f, drained, false)
+		if nodeErr != nil {
+			e2elog.Failf("failed to uncordon node %s: %v", drained, nodeErr)
+		}
+	}()
+	pod, err := validateEphemeralReplacement(f, deploy, func(pod *v1.Pod) error {
+		if pod.Spec.NodeName != drained {
+			e2elog.Logf("pod %s runs on %s instead of the drained node %s", pod.Name, pod.Spec.NodeName, drained)
+		}
+
+		return evictPod(f, pod)
+	})
+	if err != nil {
+		return err
+	}
+	if pod.Spec.NodeName == drained {
+		return fmt.Errorf("pod %s runs on the drained node %s", pod.Name, drained)
+	}
+
+	return deleteEphemeralDeployment(f, deploy, pod)
+}
+
+// validateEphemeralVolumes restarts the container of a pod with a generic
+// ephemeral volume, and replaces the pod of a deployment with a generic
+// ephemeral volume by deleting it and by draining its node.
+func validateEphemeralVolumes(f *framework.Framework, appPath string) error {
+	err := validateEphemeralContainerRestart(f, appPath)
+	if err != nil {
+		return fmt.Errorf("container restart: %w", err)
+	}
+	err = validateEphemeralPodRecreate(f, appPath)
+	if err != nil {
+		return fmt.Errorf("pod recreation: %w", err)
+	}
+	err = validateEphemeralNodeDrain(f, appPath)
+	if err != nil {
+		return fmt.Errorf("node drain: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func readyPod(name string, uid types.UID, ready bool) v1.Pod {
+	status := v1.ConditionFalse
+	if ready {
+		status = v1.ConditionTrue
+	}
+
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, UID: uid},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: status}},
+		},
+	}
+}
+
+func TestIsOwnedByPod(t *testing.T) {
+	t.Parallel()
+	pod := readyPod("app", "pod-uid", true)
+	controller := true
+	tests := []struct {
+		name     string
+		owners   []metav1.OwnerReference
+		expected bool
+	}{
+		{
+			name:     "controlled by the pod",
+			owners:   []metav1.OwnerReference{{Kind: "Pod", Name: "app", UID: "pod-uid", Controller: &controller}},
+			expected: true,
+		},
+		{
+			name:     "controlled by a pod with the same name",
+			owners:   []metav1.OwnerReference{{Kind: "Pod", Name: "app", UID: "other-uid", Controller: &controller}},
+			expected: false,
+		},
+		{
+			name:     "not controlled",
+			owners:   []metav1.OwnerReference{{Kind: "Pod", Name: "app", UID: "pod-uid"}},
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			pvc := &v1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{
+				Name:            ephemeralPVCName(&pod, "mypvc"),
+				OwnerReferences: ts.owners,
+			}}
+			if got := isOwnedByPod(pvc, &pod); got != ts.expected {
+				t.Errorf("isOwnedByPod() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestReplacementPod(t *testing.T) {
+	t.Parallel()
+	deleting := readyPod("terminating", "terminating-uid", true)
+	deleting.DeletionTimestamp = &metav1.Time{}
+	tests := []struct {
+		name     string
+		pods     []v1.Pod
+		replaced types.UID
+		expected string
+	}{
+		{
+			name:     "first ready pod",
+			pods:     []v1.Pod{readyPod("a", "a-uid", false), readyPod("b", "b-uid", true)},
+			replaced: "",
+			expected: "b",
+		},
+		{
+			name:     "replaced pod still exists",
+			pods:     []v1.Pod{readyPod("a", "a-uid", true), readyPod("b", "b-uid", true)},
+			replaced: "a-uid",
+			expected: "",
+		},
+		{
+			name:     "replacement is ready",
+			pods:     []v1.Pod{readyPod("b", "b-uid", true)},
+			replaced: "a-uid",
+			expected: "b",
+		},
+		{
+			name:     "only a pod that is being deleted",
+			pods:     []v1.Pod{deleting},
+			replaced: "a-uid",
+			expected: "",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := ""
+			if pod := replacementPod(ts.pods, ts.replaced); pod != nil {
+				got = pod.Name
+			}
+			if got != ts.expected {
+				t.Errorf("replacementPod() = %q, expected %q", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestContainerRestarted(t *testing.T) {
+	t.Parallel()
+	restarted := readyPod("app", "uid", true)
+	restarted.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 1}}
+	notReady := readyPod("app", "uid", false)
+	notReady.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 1}}
+	running := readyPod("app", "uid", true)
+	running.Status.ContainerStatuses = []v1.ContainerStatus{{RestartCount: 0}}
+	tests := []struct {
+		name     string
+		pod      v1.Pod
+		expected bool
+	}{
+		{name: "restarted and ready", pod: restarted, expected: true},
+		{name: "restarted but not ready", pod: notReady, expected: false},
+		{name: "not restarted", pod: running, expected: false},
+		{name: "no container status", pod: readyPod("app", "uid", true), expected: false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			pod := ts.pod
+			met, err := containerRestarted(0).met(&pod)
+			if err != nil {
+				t.Fatalf("containerRestarted() failed: %v", err)
+			}
+			if met != ts.expected {
+				t.Errorf("containerRestarted() = %v, expected %v", met, ts.expected)
+			}
+		})
+	}
+}
@@ -17,10 +17,12 @@ limitations under the License.
 package e2e
 
 import (
+	"errors"
 	"strings"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	utilnet "k8s.io/apimachinery/pkg/util/net"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 func isRetryableAPIError(err error) bool {
@@ -61,6 +63,42 @@ func isRetryableAPIError(err error) bool {
 	return false
 }
 
+// transientExecErrors are the messages of errors that the kube-apiserver or
+// the kubelet return when the stream of a command that is executed in a pod
+// can not be set up, or breaks.
+var transientExecErrors = []string{
+	"error dialing backend",
+	"error sending request",
+	"container not found",
+	"http2: client connection lost",
+	"stream error",
+	"websocket: close",
+	"i/o timeout",
+}
+
+// isTransientExecError checks if executing a command in a pod failed because
+// of the connection to the pod, and not because the command failed. The
+// command may not have run at all, and can be retried. A command that ran
+// and exited with a non-zero status is never transient.
+func isTransientExecError(err error) bool {
+	var exitErr utilexec.ExitError
+	if errors.As(err, &exitErr) {
+		return false
+	}
+
+	if isRetryableAPIError(err) {
+		return true
+	}
+
+	for _, msg := range transientExecErrors {
+		if strings.Contains(err.Error(), msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
 //nolint:lll // sample output cannot be split into multiple lines.
 /*
 getStdErr will extract the stderror and returns the actual error message
@@ -17,8 +17,13 @@ limitations under the License.
 package e2e
 
 import (
+	"errors"
 	"fmt"
 	"testing"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilexec "k8s.io/client-go/util/exec"
 )
 
 // nolint:lll // error string cannot be split into multiple lines as is a
@@ -87,3 +92,53 @@ Error from server (AlreadyExists): error when creating "STDIN": deployments.apps
 		})
 	}
 }
+
+func TestIsTransientExecError(t *testing.T) {
+	t.Parallel()
+	exitErr := utilexec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+	tests := []struct {
+		name      string
+		err       error
+		transient bool
+	}{
+		{
+			name:      "command failed",
+			err:       exitErr,
+			transient: false,
+		},
+		{
+			name:      "wrapped command failure",
+			err:       fmt.Errorf("failed to execute command: %w", exitErr),
+			transient: false,
+		},
+		{
+			name:      "kubelet not reachable",
+			err:       errors.New("error dialing backend: dial tcp 192.168.39.67:10250: i/o timeout"),
+			transient: true,
+		},
+		{
+			name:      "container restarted",
+			err:       errors.New(`container not found ("rook-ceph-tools")`),
+			transient: true,
+		},
+		{
+			name:      "internal error of the API server",
+			err:       apierrors.NewInternalError(errors.New("etcd unavailable")),
+			transient: true,
+		},
+		{
+			name:      "pod not found",
+			err:       apierrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "csi-rbdplugin-x"),
+			transient: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isTransientExecError(ts.err); got != ts.transient {
+				t.Errorf("isTransientExecError(%v) = %t, expected %t", ts.err, got, ts.transient)
+			}
+		})
+	}
+}
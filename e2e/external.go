@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	externalToolboxName  = "ceph-csi-e2e-tools"
+	defaultExternalImage = "quay.io/ceph/ceph:v17"
+)
+
+var (
+	// externalClusterConfig is the path to the cluster-access config of a
+	// Ceph cluster that is not deployed by Rook.
+	externalClusterConfig string
+	externalCluster       *cephClusterAccess
+
+	externalToolboxOnce sync.Once
+	errExternalToolbox  error
+
+	errNoMonitors = errors.New("no monitors in the cluster-access config")
+	errNoAdminKey = errors.New("no adminKey in the cluster-access config")
+)
+
+// cephClusterAccess describes how to reach a Ceph cluster that is not
+// deployed by Rook, like a cephadm cluster on bare metal.
+type cephClusterAccess struct {
+	// Monitors are the addresses of the monitors, like "192.168.1.1:6789".
+	Monitors []string `json:"monitors"`
+	// AdminKey is the key of client.admin.
+	AdminKey string `json:"adminKey"`
+	// Image contains the ceph, rbd and rados commands.
+	Image string `json:"image,omitempty"`
+}
+
+// loadClusterAccess reads and validates the cluster-access config.
+func loadClusterAccess(path string) (*cephClusterAccess, error) {
+	ca := &cephClusterAccess{}
+	err := unmarshal(path, ca)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cluster-access config %q: %w", path, err)
+	}
+	if len(ca.Monitors) == 0 {
+		return nil, errNoMonitors
+	}
+	if ca.AdminKey == "" {
+		return nil, errNoAdminKey
+	}
+	if ca.Image == "" {
+		ca.Image = defaultExternalImage
+	}
+
+	return ca, nil
+}
+
+// cephConf returns the ceph.conf and keyring for client.admin.
+func (ca *cephClusterAccess) cephConf() (string, string) {
+	conf := fmt.Sprintf("[global]\nmon_host = %s\n", strings.Join(ca.Monitors, ","))
+	keyring := fmt.Sprintf("[client.admin]\nkey = %s\n", ca.AdminKey)
+
+	return conf, keyring
+}
+
+// ensureExternalToolbox deploys a pod with the ceph, rbd and rados commands
+// and the admin credentials of the external cluster, once. It has the label of
+// the Rook toolbox, so that all helpers that execute commands in the toolbox
+// use it. The pod is removed when all suites finished.
+func ensureExternalToolbox(f *framework.Framework) error {
+	if externalCluster == nil {
+		return nil
+	}
+
+	externalToolboxOnce.Do(func() {
+		errExternalToolbox = deployExternalToolbox(f.ClientSet, externalCluster)
+		registerCleanup(externalToolboxName, func(f *framework.Framework) error {
+			return deleteExternalToolbox(f.ClientSet)
+		})
+	})
+
+	return errExternalToolbox
+}
+
+func deployExternalToolbox(c kubernetes.Interface, ca *cephClusterAccess) error {
+	err := createNamespace(c, rookNamespace)
+	if err != nil {
+		return err
+	}
+
+	conf, keyring := ca.cephConf()
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      externalToolboxName,
+			Namespace: rookNamespace,
+		},
+		StringData: map[string]string{
+			"ceph.conf": conf,
+			"keyring":   keyring,
+		},
+	}
+	_, err = c.CoreV1().Secrets(rookNamespace).Create(context.TODO(), secret, metav1.CreateOptions{})
+	if err != nil && !apierrs.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create secret %s/%s: %w", rookNamespace, externalToolboxName, err)
+	}
+
+	label := strings.SplitN(rookToolBoxPodLabel, "=", 2)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      externalToolboxName,
+			Namespace: rookNamespace,
+			Labels:    map[string]string{label[0]: label[1]},
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:            externalToolboxName,
+				Image:           ca.Image,
+				ImagePullPolicy: v1.PullIfNotPresent,
+				Command:         []string{"/bin/sleep", "infinity"},
+				VolumeMounts: []v1.VolumeMount{{
+					Name:      "ceph-config",
+					MountPath: "/etc/ceph",
+					ReadOnly:  true,
+				}},
+			}},
+			Volumes: []v1.Volume{{
+				Name: "ceph-config",
+				VolumeSource: v1.VolumeSource{
+					Secret: &v1.SecretVolumeSource{SecretName: externalToolboxName},
+				},
+			}},
+		},
+	}
+	_, err = c.CoreV1().Pods(rookNamespace).Create(context.TODO(), pod, metav1.CreateOptions{})
+	if err != nil && !apierrs.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create pod %s/%s: %w", rookNamespace, externalToolboxName, err)
+	}
+	e2elog.Logf("executing Ceph commands for the cluster with monitors %v in pod %s/%s",
+		ca.Monitors, rookNamespace, externalToolboxName)
+
+	return waitForPodInRunningState(externalToolboxName, rookNamespace, c, deployTimeout, noError)
+}
+
+func deleteExternalToolbox(c kubernetes.Interface) error {
+	err := c.CoreV1().Pods(rookNamespace).Delete(context.TODO(), externalToolboxName, metav1.DeleteOptions{})
+	if err != nil && !apierrs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete pod %s/%s: %w", rookNamespace, externalToolboxName, err)
+	}
+	err = c.CoreV1().Secrets(rookNamespace).Delete(context.TODO(), externalToolboxName, metav1.DeleteOptions{})
+	if err != nil && !apierrs.IsNotFound(err) {
+		return fmt.Errorf("failed to delete secret %s/%s: %w", rookNamespace, externalToolboxName, err)
+	}
+
+	return nil
+}
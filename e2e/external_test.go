@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadClusterAccess(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		config  string
+		want    *cephClusterAccess
+		wantErr error
+	}{
+		{
+			name: "default image",
+			config: "monitors:\n- 192.168.1.1:6789\n- 192.168.1.2:6789\n" +
+				"adminKey: AQBsA1RjAAAAABAAGzlf2ONwNGsYOk2vmSdP2g==\n",
+			want: &cephClusterAccess{
+				Monitors: []string{"192.168.1.1:6789", "192.168.1.2:6789"},
+				AdminKey: "AQBsA1RjAAAAABAAGzlf2ONwNGsYOk2vmSdP2g==",
+				Image:    defaultExternalImage,
+			},
+		},
+		{
+			name:   "image",
+			config: "monitors: [\"mon.example.com:3300\"]\nadminKey: key\nimage: quay.io/ceph/ceph:v16\n",
+			want: &cephClusterAccess{
+				Monitors: []string{"mon.example.com:3300"},
+				AdminKey: "key",
+				Image:    "quay.io/ceph/ceph:v16",
+			},
+		},
+		{
+			name:    "no monitors",
+			config:  "adminKey: key\n",
+			wantErr: errNoMonitors,
+		},
+		{
+			name:    "no admin key",
+			config:  "monitors:\n- 192.168.1.1:6789\n",
+			wantErr: errNoAdminKey,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			path := filepath.Join(t.TempDir(), "cluster.yaml")
+			err := os.WriteFile(path, []byte(ts.config), 0o600)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadClusterAccess(path)
+			if !errors.Is(err, ts.wantErr) {
+				t.Fatalf("loadClusterAccess() error = %v, want %v", err, ts.wantErr)
+			}
+			if ts.want == nil {
+				return
+			}
+			if got.AdminKey != ts.want.AdminKey || got.Image != ts.want.Image ||
+				len(got.Monitors) != len(ts.want.Monitors) {
+				t.Fatalf("loadClusterAccess() = %+v, want %+v", got, ts.want)
+			}
+			for i := range got.Monitors {
+				if got.Monitors[i] != ts.want.Monitors[i] {
+					t.Errorf("loadClusterAccess() monitors = %v, want %v", got.Monitors, ts.want.Monitors)
+				}
+			}
+		})
+	}
+}
+
+func TestCephConf(t *testing.T) {
+	t.Parallel()
+	ca := &cephClusterAccess{
+		Monitors: []string{"192.168.1.1:6789", "192.168.1.2:6789"},
+		AdminKey: "key",
+	}
+	conf, keyring := ca.cephConf()
+	if want := "[global]\nmon_host = 192.168.1.1:6789,192.168.1.2:6789\n"; conf != want {
+		t.Errorf("cephConf() conf = %q, want %q", conf, want)
+	}
+	if want := "[client.admin]\nkey = key\n"; keyring != want {
+		t.Errorf("cephConf() keyring = %q, want %q", keyring, want)
+	}
+}
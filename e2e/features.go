@@ -0,0 +1,189 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// version is the major.minor version of the Kubernetes or Ceph cluster that
+// the tests run against.
+type version struct {
+	major int
+	minor int
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// atLeast returns whether the version is major.minor or newer.
+func (v version) atLeast(want version) bool {
+	return v.major > want.major || (v.major == want.major && v.minor >= want.minor)
+}
+
+// cephFeature is a feature of Ceph that the tests depend on, and the first
+// version of Ceph that has it.
+type cephFeature struct {
+	name  string
+	since version
+}
+
+var (
+	// subvolumeMetadata is needed for the metadata that the provisioner
+	// sets on CephFS subvolumes.
+	subvolumeMetadata = cephFeature{name: "subvolume metadata", since: version{major: 17, minor: 2}}
+	// subvolumeSnapshotMetadata is needed for the metadata that the
+	// provisioner sets on CephFS subvolume snapshots.
+	subvolumeSnapshotMetadata = cephFeature{name: "subvolume snapshot metadata", since: version{major: 17, minor: 2}}
+)
+
+var (
+	// k8sServerVersion and cephClusterVersion are detected once, the
+	// clusters are not upgraded while the tests run.
+	k8sServerVersion   *version
+	cephClusterVersion *version
+
+	cephVersionRegexp = regexp.MustCompile(`^ceph version (\d+)\.(\d+)\.\d+`)
+)
+
+// parseK8sVersion parses the major and minor version that the Kubernetes API
+// server reports. Some distributions add a "+" to the minor version.
+func parseK8sVersion(major, minor string) (version, error) {
+	maj, err := strconv.Atoi(major)
+	if err != nil {
+		return version{}, fmt.Errorf("invalid major version %q: %w", major, err)
+	}
+	min, err := strconv.Atoi(strings.TrimSuffix(minor, "+"))
+	if err != nil {
+		return version{}, fmt.Errorf("invalid minor version %q: %w", minor, err)
+	}
+
+	return version{major: maj, minor: min}, nil
+}
+
+// parseCephVersion parses a version like
+// "ceph version 17.2.3 (dff484dfc9e19a9819f375586300b3b79d80034d) quincy (stable)".
+func parseCephVersion(s string) (version, error) {
+	m := cephVersionRegexp.FindStringSubmatch(s)
+	if m == nil {
+		return version{}, fmt.Errorf("invalid Ceph version %q", s)
+	}
+	// the regexp only matches digits
+	maj, _ := strconv.Atoi(m[1])
+	min, _ := strconv.Atoi(m[2])
+
+	return version{major: maj, minor: min}, nil
+}
+
+// oldestCephVersion returns the oldest version that the daemons of the Ceph
+// cluster run, as reported by "ceph versions". During an upgrade, only the
+// features of the oldest daemons can be used.
+func oldestCephVersion(overall map[string]int) (version, error) {
+	if len(overall) == 0 {
+		return version{}, fmt.Errorf("no Ceph daemons reported a version")
+	}
+	var oldest *version
+	for s := range overall {
+		v, err := parseCephVersion(s)
+		if err != nil {
+			return version{}, err
+		}
+		if oldest == nil || !v.atLeast(*oldest) {
+			oldest = &v
+		}
+	}
+
+	return *oldest, nil
+}
+
+// getK8sVersion returns the version of the Kubernetes API server.
+func getK8sVersion(c kubernetes.Interface) (version, error) {
+	if k8sServerVersion != nil {
+		return *k8sServerVersion, nil
+	}
+	info, err := c.Discovery().ServerVersion()
+	if err != nil {
+		return version{}, fmt.Errorf("failed to get server version: %w", err)
+	}
+	v, err := parseK8sVersion(info.Major, info.Minor)
+	if err != nil {
+		return version{}, err
+	}
+	k8sServerVersion = &v
+
+	return v, nil
+}
+
+// getCephVersion returns the oldest version of the daemons of the Ceph
+// cluster.
+func getCephVersion(f *framework.Framework) (version, error) {
+	if cephClusterVersion != nil {
+		return *cephClusterVersion, nil
+	}
+	versions, err := cephJSON[struct {
+		Overall map[string]int `json:"overall"`
+	}](f, "ceph versions")
+	if err != nil {
+		return version{}, err
+	}
+	v, err := oldestCephVersion(versions.Overall)
+	if err != nil {
+		return version{}, err
+	}
+	cephClusterVersion = &v
+
+	return v, nil
+}
+
+// hasCephFeature returns whether the Ceph cluster has the feature. If the
+// version of the Ceph cluster can not be detected, the calling test case is
+// marked as `FAILED` and gets aborted.
+func hasCephFeature(f *framework.Framework, feature cephFeature) bool {
+	v, err := getCephVersion(f)
+	if err != nil {
+		e2elog.Failf("failed to detect Ceph version: %v", err)
+	}
+
+	return v.atLeast(feature.since)
+}
+
+// skipUnlessCephFeature skips the test case if the Ceph cluster does not have
+// the feature.
+func skipUnlessCephFeature(f *framework.Framework, feature cephFeature) {
+	if !hasCephFeature(f, feature) {
+		Skip(fmt.Sprintf("Ceph cluster %s does not support %s, which needs Ceph %s",
+			cephClusterVersion, feature.name, feature.since))
+	}
+}
+
+// nolint:deadcode,unused // Unused code will be used in future.
+// skipUnlessK8sVersion skips the test case if the Kubernetes cluster is older
+// than major.minor.
+func skipUnlessK8sVersion(c kubernetes.Interface, major, minor int) {
+	if !k8sVersionGreaterEquals(c, major, minor) {
+		Skip(fmt.Sprintf("Kubernetes cluster %s is older than %d.%d", k8sServerVersion, major, minor))
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestParseK8sVersion(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		major    string
+		minor    string
+		expected version
+		wantErr  bool
+	}{
+		{major: "1", minor: "24", expected: version{major: 1, minor: 24}},
+		{major: "1", minor: "23+", expected: version{major: 1, minor: 23}},
+		{major: "1", minor: "", wantErr: true},
+		{major: "", minor: "24", wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.major+"."+ts.minor, func(t *testing.T) {
+			t.Parallel()
+			got, err := parseK8sVersion(ts.major, ts.minor)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("parseK8sVersion() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.expected {
+				t.Errorf("parseK8sVersion() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestOldestCephVersion(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		overall  map[string]int
+		expected version
+		wantErr  bool
+	}{
+		{
+			name: "one version",
+			overall: map[string]int{
+				"ceph version 17.2.3 (dff484dfc9e19a9819f375586300b3b79d80034d) quincy (stable)": 9,
+			},
+			expected: version{major: 17, minor: 2},
+		},
+		{
+			name: "during an upgrade",
+			overall: map[string]int{
+				"ceph version 17.2.3 (dff484dfc9e19a9819f375586300b3b79d80034d) quincy (stable)":   3,
+				"ceph version 16.2.10 (45fa1a083152e41a408d15505f594ec5f1b4fe17) pacific (stable)": 6,
+			},
+			expected: version{major: 16, minor: 2},
+		},
+		{
+			name:    "no daemons",
+			overall: map[string]int{},
+			wantErr: true,
+		},
+		{
+			name:    "invalid version",
+			overall: map[string]int{"ceph version unknown": 1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := oldestCephVersion(ts.overall)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("oldestCephVersion() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.expected {
+				t.Errorf("oldestCephVersion() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestVersionAtLeast(t *testing.T) {
+	t.Parallel()
+	v := version{major: 17, minor: 2}
+	for _, want := range []version{{16, 2}, {17, 0}, {17, 2}} {
+		if !v.atLeast(want) {
+			t.Errorf("%s.atLeast(%s) = false, expected true", v, want)
+		}
+	}
+	for _, want := range []version{{17, 3}, {18, 0}} {
+		if v.atLeast(want) {
+			t.Errorf("%s.atLeast(%s) = true, expected false", v, want)
+		}
+	}
+}
@@ -0,0 +1,336 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+const (
+	// rejectionTimeout is the time that the provisioner and snapshotter
+	// may take to reject invalid parameters. They are validated before the
+	// drivers create anything in the Ceph cluster.
+	rejectionTimeout = 2 * time.Minute
+
+	// malformedClusterID is a clusterID that is not in the CSI config.
+	malformedClusterID = "malformed/cluster-id"
+)
+
+// invalidParamsTestCase is a StorageClass or VolumeSnapshotClass with
+// parameters that the driver needs to reject.
+type invalidParamsTestCase struct {
+	name   string
+	params map[string]string
+	// rejected is the description of the InvalidArgument error
+	rejected string
+}
+
+// invalidArgument returns the part of the error of the provisioner or
+// snapshotter for an InvalidArgument error with the description.
+func invalidArgument(desc string) string {
+	return "code = InvalidArgument desc = " + desc
+}
+
+// oversizedNamePrefix is a volumeNamePrefix or snapshotNamePrefix that is
+// one character too long.
+var oversizedNamePrefix = strings.Repeat("x", util.MaxNamePrefixLength+1)
+
+var rbdInvalidStorageClasses = []invalidParamsTestCase{
+	{
+		name:     "unknown image feature",
+		params:   map[string]string{"imageFeatures": "layering,bogus"},
+		rejected: "invalid feature bogus",
+	},
+	{
+		name:     "image feature without the feature it depends on",
+		params:   map[string]string{"imageFeatures": "layering,fast-diff"},
+		rejected: "feature fast-diff requires object-map to be set",
+	},
+	{
+		name:     "image feature that needs rbd-nbd",
+		params:   map[string]string{"imageFeatures": "layering,exclusive-lock,journaling"},
+		rejected: "feature journaling requires rbd-nbd for mounter",
+	},
+	{
+		name:     "unknown mounter",
+		params:   map[string]string{"mounter": "fuse"},
+		rejected: `unknown mounter "fuse"`,
+	},
+	{
+		name:     "malformed clusterID",
+		params:   map[string]string{"clusterID": malformedClusterID},
+		rejected: "failed to fetch monitor list using clusterID (" + malformedClusterID + ")",
+	},
+	{
+		name:     "missing pool",
+		params:   map[string]string{"pool": ""},
+		rejected: "missing or empty pool name to provision volume from",
+	},
+	{
+		name:     "oversized volumeNamePrefix",
+		params:   map[string]string{"volumeNamePrefix": oversizedNamePrefix},
+		rejected: fmt.Sprintf("volumeNamePrefix is %d characters long", len(oversizedNamePrefix)),
+	},
+}
+
+var cephFSInvalidStorageClasses = []invalidParamsTestCase{
+	{
+		name:     "unknown mounter",
+		params:   map[string]string{"mounter": "rbd-nbd"},
+		rejected: "unknown mounter 'rbd-nbd'",
+	},
+	{
+		name:     "malformed clusterID",
+		params:   map[string]string{"clusterID": malformedClusterID},
+		rejected: "failed to fetch monitor list using clusterID (" + malformedClusterID + ")",
+	},
+	{
+		name:     "empty fsName",
+		params:   map[string]string{"fsName": ""},
+		rejected: "parameter 'fsName' cannot be empty",
+	},
+	{
+		name:     "oversized volumeNamePrefix",
+		params:   map[string]string{"volumeNamePrefix": oversizedNamePrefix},
+		rejected: fmt.Sprintf("volumeNamePrefix is %d characters long", len(oversizedNamePrefix)),
+	},
+}
+
+var invalidSnapshotClasses = []invalidParamsTestCase{
+	{
+		name:     "malformed clusterID",
+		params:   map[string]string{"clusterID": malformedClusterID},
+		rejected: "failed to fetch monitor list using clusterID (" + malformedClusterID + ")",
+	},
+	{
+		name:     "oversized snapshotNamePrefix",
+		params:   map[string]string{"snapshotNamePrefix": oversizedNamePrefix},
+		rejected: fmt.Sprintf("snapshotNamePrefix is %d characters long", len(oversizedNamePrefix)),
+	},
+}
+
+// snapshotRejected returns the condition that is met once the snapshotter
+// reported the rejected error on the VolumeSnapshot.
+func snapshotRejected(rejected string) stateCondition[*snapapi.VolumeSnapshot] {
+	return stateCondition[*snapapi.VolumeSnapshot]{
+		name: "rejected",
+		met: func(snap *snapapi.VolumeSnapshot) (bool, error) {
+			if snap.Status == nil {
+				return false, nil
+			}
+			if snap.Status.ReadyToUse != nil && *snap.Status.ReadyToUse {
+				return false, fmt.Errorf("snapshot %s is ready to use, expected %q", snap.Name, rejected)
+			}
+
+			return snap.Status.Error != nil && snap.Status.Error.Message != nil &&
+				strings.Contains(*snap.Status.Error.Message, rejected), nil
+		},
+		describe: snapshotReady.describe,
+	}
+}
+
+// validateRejectionLogged checks that the driver in the provisioner of the
+// deployment logged the rejection in the window. The sidecar reports the
+// error on the PVC, the log shows that the request reached the driver.
+func validateRejectionLogged(
+	f *framework.Framework,
+	deploymentName, containerName, rejected string,
+	w logWindow,
+) error {
+	selector, err := getDeploymentLabelSelector(f, cephCSINamespace, deploymentName)
+	if err != nil {
+		return err
+	}
+	re := regexp.MustCompile("GRPC error: .*" + regexp.QuoteMeta(invalidArgument(rejected)))
+	_, err = waitForDriverLog(f.ClientSet, selector, containerName, re, w, rejectionTimeout)
+
+	return err
+}
+
+// validateInvalidSnapshotClass creates a VolumeSnapshotClass with the
+// parameters of the test case, and checks that the snapshotter fails to take
+// a snapshot of the PVC with the error of the test case within
+// rejectionTimeout.
+func validateInvalidSnapshotClass(
+	f *framework.Framework,
+	tc *invalidParamsTestCase,
+	pvc *v1.PersistentVolumeClaim,
+	scPath, secretName, snapshotPath string,
+) error {
+	scName := resourceName("invalid-params")
+	err := createSnapshotClassWithParameters(f, scPath, scName, secretName, tc.params)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		scErr := deleteSnapshotClass(scName)
+		if scErr != nil {
+			e2elog.Failf("failed to delete volumesnapshotclass %s: %v", scName, scErr)
+		}
+	}()
+
+	snap := getSnapshot(snapshotPath)
+	snap.Name = "invalid-params"
+	snap.Namespace = pvc.Namespace
+	snap.Spec.VolumeSnapshotClassName = &scName
+	snap.Spec.Source.PersistentVolumeClaimName = &pvc.Name
+	sclient, err := newSnapshotClient()
+	if err != nil {
+		return err
+	}
+	_, err = sclient.VolumeSnapshots(snap.Namespace).Create(context.TODO(), &snap, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create volumesnapshot: %w", err)
+	}
+	_, err = waitForState(
+		fmt.Sprintf("snapshot %s/%s", snap.Namespace, snap.Name),
+		func() (*snapapi.VolumeSnapshot, error) {
+			return sclient.VolumeSnapshots(snap.Namespace).Get(context.TODO(), snap.Name, metav1.GetOptions{})
+		},
+		snapshotRejected(invalidArgument(tc.rejected)),
+		rejectionTimeout)
+	if err != nil {
+		return err
+	}
+
+	return deleteSnapshot(&snap, deployTimeout)
+}
+
+// validateInvalidSnapshotClasses takes snapshots of a new PVC with each
+// VolumeSnapshotClass of invalidSnapshotClasses.
+func validateInvalidSnapshotClasses(f *framework.Framework, pvcPath, scPath, secretName, snapshotPath string) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+
+	for i := range invalidSnapshotClasses {
+		tc := &invalidSnapshotClasses[i]
+		e2elog.Logf("validating VolumeSnapshotClass with %s", tc.name)
+		err = validateInvalidSnapshotClass(f, tc, pvc, scPath, secretName, snapshotPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+	}
+
+	return deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+}
+
+// validateRBDInvalidParameters checks that the RBD provisioner rejects each
+// StorageClass of rbdInvalidStorageClasses, and the snapshotter each
+// VolumeSnapshotClass of invalidSnapshotClasses, within rejectionTimeout.
+func validateRBDInvalidParameters(f *framework.Framework, pvcPath, snapshotPath string) error {
+	scName := resourceName("invalid-params")
+	for i := range rbdInvalidStorageClasses {
+		tc := &rbdInvalidStorageClasses[i]
+		e2elog.Logf("validating StorageClass with %s", tc.name)
+		err := createRBDStorageClass(f.ClientSet, f, scName, nil, tc.params, deletePolicy)
+		if err != nil {
+			return fmt.Errorf("failed to create storageclass %s: %w", scName, err)
+		}
+		pvc, err := loadPVC(pvcPath)
+		if err != nil {
+			return fmt.Errorf("failed to load PVC: %w", err)
+		}
+		pvc.Namespace = f.UniqueName
+		pvc.Spec.StorageClassName = &scName
+		w := newLogWindow()
+		err = validateRejectedPVCWithin(f, pvc, invalidArgument(tc.rejected), rejectionTimeout)
+		if err == nil {
+			err = validateRejectionLogged(f, rbdDeploymentName, "csi-rbdplugin", tc.rejected, w)
+		}
+		scErr := retryKubectlArgs(cephCSINamespace, kubectlDelete, deployTimeout, "sc", scName, "--ignore-not-found=true")
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+		if scErr != nil {
+			return fmt.Errorf("failed to delete storageclass %s: %w", scName, scErr)
+		}
+	}
+
+	return validateInvalidSnapshotClasses(f, pvcPath, rbdExamplePath+"snapshotclass.yaml", rbdProvisionerSecretName,
+		snapshotPath)
+}
+
+// validateCephFSInvalidParameters checks that the CephFS snapshotter rejects
+// each VolumeSnapshotClass of invalidSnapshotClasses, and the provisioner
+// each StorageClass of cephFSInvalidStorageClasses, within rejectionTimeout.
+// The default StorageClass is restored afterwards.
+func validateCephFSInvalidParameters(f *framework.Framework, pvcPath, snapshotPath string) error {
+	// the snapshots are taken of a PVC of the default StorageClass
+	err := validateInvalidSnapshotClasses(f, pvcPath, cephFSExamplePath+"snapshotclass.yaml",
+		cephFSProvisionerSecretName, snapshotPath)
+	if err != nil {
+		return err
+	}
+
+	err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete storageclass: %w", err)
+	}
+	defer func() {
+		scErr := createCephfsStorageClass(f.ClientSet, f, false, nil)
+		if scErr != nil {
+			e2elog.Failf("failed to create storageclass: %v", scErr)
+		}
+	}()
+
+	for i := range cephFSInvalidStorageClasses {
+		tc := &cephFSInvalidStorageClasses[i]
+		e2elog.Logf("validating StorageClass with %s", tc.name)
+		err = createCephfsStorageClass(f.ClientSet, f, false, tc.params)
+		if err != nil {
+			return fmt.Errorf("failed to create storageclass: %w", err)
+		}
+		pvc, err := loadPVC(pvcPath)
+		if err != nil {
+			return fmt.Errorf("failed to load PVC: %w", err)
+		}
+		pvc.Namespace = f.UniqueName
+		w := newLogWindow()
+		err = validateRejectedPVCWithin(f, pvc, invalidArgument(tc.rejected), rejectionTimeout)
+		if err == nil {
+			err = validateRejectionLogged(f, cephFSDeploymentName, cephFSContainerName, tc.rejected, w)
+		}
+		scErr := deleteResource(cephFSExamplePath + "storageclass.yaml")
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+		if scErr != nil {
+			return fmt.Errorf("failed to delete storageclass: %w", scErr)
+		}
+	}
+
+	return nil
+}
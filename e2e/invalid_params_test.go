@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+)
+
+func TestInvalidParamsTestCases(t *testing.T) {
+	t.Parallel()
+	cases := append(append([]invalidParamsTestCase{}, rbdInvalidStorageClasses...), cephFSInvalidStorageClasses...)
+	cases = append(cases, invalidSnapshotClasses...)
+	for _, tc := range cases {
+		if len(tc.params) == 0 || tc.rejected == "" {
+			t.Errorf("%s needs parameters and an error of the driver", tc.name)
+		}
+	}
+}
+
+func TestSnapshotRejected(t *testing.T) {
+	t.Parallel()
+	rejected := invalidArgument("snapshotNamePrefix is 220 characters long")
+	message := "Failed to check and update snapshot content: failed to take snapshot of the volume: " +
+		"rpc error: " + rejected + ", it can not be longer than 219 characters"
+	otherMessage := "rpc error: code = Internal desc = connection refused"
+	ready := true
+	notReady := false
+	tests := []struct {
+		name     string
+		status   *snapapi.VolumeSnapshotStatus
+		expected bool
+		wantErr  bool
+	}{
+		{
+			name:     "no status yet",
+			status:   nil,
+			expected: false,
+		},
+		{
+			name: "rejected with the error",
+			status: &snapapi.VolumeSnapshotStatus{
+				ReadyToUse: &notReady,
+				Error:      &snapapi.VolumeSnapshotError{Message: &message},
+			},
+			expected: true,
+		},
+		{
+			name: "failed with another error",
+			status: &snapapi.VolumeSnapshotStatus{
+				Error: &snapapi.VolumeSnapshotError{Message: &otherMessage},
+			},
+			expected: false,
+		},
+		{
+			name:    "ready to use",
+			status:  &snapapi.VolumeSnapshotStatus{ReadyToUse: &ready},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			snap := &snapapi.VolumeSnapshot{Status: ts.status}
+			met, err := snapshotRejected(rejected).met(snap)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("snapshotRejected() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if met != ts.expected {
+				t.Errorf("snapshotRejected() = %v, expected %v", met, ts.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// csiJournal describes the CSI journal of the volumes or the snapshots of a
+// driver. The directory object maps the request names to UUIDs, there is an
+// object with the attributes of each UUID, and the image, subvolume or
+// snapshot in the backend is named after the UUID.
+type csiJournal struct {
+	directory    string
+	objectPrefix string
+	namePrefix   string
+	// nameKey is the key of the request name in the object of a UUID
+	nameKey string
+}
+
+var (
+	volumeJournal = csiJournal{
+		directory:    "csi.volumes.default",
+		objectPrefix: "csi.volume.",
+		namePrefix:   "csi-vol-",
+		nameKey:      "csi.volname",
+	}
+	snapshotJournal = csiJournal{
+		directory:    "csi.snaps.default",
+		objectPrefix: "csi.snap.",
+		namePrefix:   "csi-snap-",
+		nameKey:      "csi.snapname",
+	}
+)
+
+// tempCloneSuffix is the suffix of the intermediate image of an RBD clone,
+// which has the UUID of the clone.
+const tempCloneSuffix = "-temp"
+
+// check returns the inconsistencies between the keys of the directory, the
+// objects in the pool (or rados namespace) of the journal, and the names of
+// the images, subvolumes or snapshots in the backend. Objects and names that
+// do not belong to the journal are ignored.
+func (j csiJournal) check(keys, objects, names []string) []string {
+	problems := []string{}
+
+	uuids := map[string]bool{}
+	for _, obj := range objects {
+		if obj == j.directory || !strings.HasPrefix(obj, j.objectPrefix) {
+			continue
+		}
+		uuids[strings.TrimPrefix(obj, j.objectPrefix)] = true
+	}
+
+	reservations := 0
+	for _, key := range keys {
+		if strings.HasPrefix(key, j.objectPrefix) {
+			reservations++
+		}
+	}
+	if reservations != len(uuids) {
+		problems = append(problems, fmt.Sprintf("%s has %d keys, but there are %d %s<uuid> objects",
+			j.directory, reservations, len(uuids), j.objectPrefix))
+	}
+
+	backend := map[string]bool{}
+	for _, name := range names {
+		if !strings.HasPrefix(name, j.namePrefix) {
+			continue
+		}
+		uuid := strings.TrimSuffix(strings.TrimPrefix(name, j.namePrefix), tempCloneSuffix)
+		backend[uuid] = true
+		if !uuids[uuid] {
+			problems = append(problems, fmt.Sprintf("%s has no journal object %s%s", name, j.objectPrefix, uuid))
+		}
+	}
+	for uuid := range uuids {
+		if !backend[uuid] {
+			problems = append(problems, fmt.Sprintf("journal object %s%s has no %s%s", j.objectPrefix, uuid, j.namePrefix, uuid))
+		}
+	}
+	sort.Strings(problems)
+
+	return problems
+}
+
+// journalRadosOptions returns the options of the rados command for the pool
+// (and namespace) of the journal of the driver.
+func journalRadosOptions(driver, pool string) string {
+	if driver == cephfsType {
+		return fmt.Sprintf("--pool=%s --namespace csi", pool)
+	}
+
+	return rbdOptions(pool)
+}
+
+// listRadosLines runs the rados command in the toolbox, and returns the lines
+// of its output. A missing object is treated as an empty list.
+func listRadosLines(f *framework.Framework, cmd string) ([]string, error) {
+	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		if strings.Contains(stdErr, "No such file or directory") {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to run %q: %w, stdErr: %s", cmd, err, stdErr)
+	}
+	if stdErr != "" {
+		return nil, fmt.Errorf("failed to run %q: %s", cmd, stdErr)
+	}
+
+	return strings.Fields(stdOut), nil
+}
+
+// validateJournalConsistency checks that every reservation in the CSI journal
+// of the driver has its object and image or subvolume, and that there are no
+// images, subvolumes or snapshots without a reservation. For CephFS the pool
+// is the metadata pool of the filesystem. It should be called when no
+// CreateVolume or CreateSnapshot is in progress.
+func validateJournalConsistency(f *framework.Framework, driver, pool string) error {
+	opts := journalRadosOptions(driver, pool)
+	objects, err := listRadosLines(f, "rados ls "+opts)
+	if err != nil {
+		return err
+	}
+
+	var volumeNames, snapshotNames []string
+	switch driver {
+	case rbdType:
+		images, listErr := listRBDImages(f, pool)
+		if listErr != nil {
+			return fmt.Errorf("failed to list images in pool %s: %w", pool, listErr)
+		}
+		// snapshots are images as well
+		volumeNames = images
+		snapshotNames = images
+	case cephfsType:
+		subvols, listErr := listCephFSSubVolumes(f, fileSystemName, subvolumegroup)
+		if listErr != nil {
+			return fmt.Errorf("failed to list subvolumes: %w", listErr)
+		}
+		for _, sv := range subvols {
+			volumeNames = append(volumeNames, sv.Name)
+			snaps, snapErr := listCephFSSnapshots(f, fileSystemName, sv.Name, subvolumegroup)
+			if snapErr != nil {
+				return fmt.Errorf("failed to list snapshots of subvolume %s: %w", sv.Name, snapErr)
+			}
+			for _, snap := range snaps {
+				snapshotNames = append(snapshotNames, snap.Name)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported driver %q", driver)
+	}
+
+	problems := []string{}
+	for _, j := range []struct {
+		journal csiJournal
+		names   []string
+	}{
+		{volumeJournal, volumeNames},
+		{snapshotJournal, snapshotNames},
+	} {
+		keys, listErr := listRadosLines(f, fmt.Sprintf("rados listomapkeys %s %s", j.journal.directory, opts))
+		if listErr != nil {
+			return listErr
+		}
+		problems = append(problems, j.journal.check(keys, objects, j.names)...)
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("journal of %s in pool %s is inconsistent: %s", driver, pool, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCSIJournalCheck(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		journal  csiJournal
+		keys     []string
+		objects  []string
+		names    []string
+		expected []string
+	}{
+		{
+			name:     "empty journal",
+			journal:  volumeJournal,
+			expected: []string{},
+		},
+		{
+			name:    "consistent volumes with a temporary clone image",
+			journal: volumeJournal,
+			keys:    []string{"csi.volume.pvc-1", "csi.volume.pvc-2"},
+			objects: []string{
+				"csi.volumes.default",
+				"csi.volume.1111",
+				"csi.volume.2222",
+				"csi.snap.3333",
+				"rbd_directory",
+			},
+			names:    []string{"csi-vol-1111", "csi-vol-2222", "csi-vol-2222-temp", "csi-snap-3333", "static-image"},
+			expected: []string{},
+		},
+		{
+			name:     "orphan image",
+			journal:  volumeJournal,
+			keys:     []string{"csi.volume.pvc-1"},
+			objects:  []string{"csi.volumes.default", "csi.volume.1111"},
+			names:    []string{"csi-vol-1111", "csi-vol-2222"},
+			expected: []string{"csi-vol-2222 has no journal object csi.volume.2222"},
+		},
+		{
+			name:    "orphan reservation",
+			journal: snapshotJournal,
+			keys:    []string{"csi.snap.snapshot-1", "csi.snap.snapshot-2"},
+			objects: []string{"csi.snaps.default", "csi.snap.1111"},
+			names:   []string{"csi-snap-1111"},
+			expected: []string{
+				"csi.snaps.default has 2 keys, but there are 1 csi.snap.<uuid> objects",
+			},
+		},
+		{
+			name:    "orphan journal object",
+			journal: snapshotJournal,
+			keys:    []string{"csi.snap.snapshot-1"},
+			objects: []string{"csi.snaps.default", "csi.snap.1111"},
+			expected: []string{
+				"journal object csi.snap.1111 has no csi-snap-1111",
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			problems := ts.journal.check(ts.keys, ts.objects, ts.names)
+			if !reflect.DeepEqual(problems, ts.expected) {
+				t.Errorf("check() = %q, expected %q", problems, ts.expected)
+			}
+		})
+	}
+}
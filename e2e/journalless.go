@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// journalLessMetaKey is the metadata of the images of journal-less volumes,
+// with the request name of the volume.
+const journalLessMetaKey = "rbd.csi.ceph.com/journal-less"
+
+// validateJournalLessVolume creates a PVC with a journal-less StorageClass
+// and mounts it in an application. The image is marked with the request
+// name, and is not reserved in the journal. Deleting the PVC deletes the
+// image.
+func validateJournalLessVolume(f *framework.Framework) error {
+	err := deleteResource(rbdExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete storageclass: %w", err)
+	}
+	err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil,
+		map[string]string{"journalLess": "true"}, deletePolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create journal-less storageclass: %w", err)
+	}
+	defer func() {
+		err = deleteResource(rbdExamplePath + "storageclass.yaml")
+		if err != nil {
+			e2elog.Failf("failed to delete storageclass: %v", err)
+		}
+		err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+		if err != nil {
+			e2elog.Failf("failed to create storageclass: %v", err)
+		}
+	}()
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+
+	imageData, err := getImageInfoFromPVC(pvc.Namespace, pvc.Name, f)
+	if err != nil {
+		return fmt.Errorf("failed to get image of PVC: %w", err)
+	}
+	requestName, err := getImageMeta(imageSpec(defaultRBDPool, imageData.imageName), journalLessMetaKey, f)
+	if err != nil {
+		return fmt.Errorf("failed to get %s of image %s: %w", journalLessMetaKey, imageData.imageName, err)
+	}
+	if requestName != imageData.pvName {
+		return fmt.Errorf("image %s has request name %q, want %q", imageData.imageName, requestName, imageData.pvName)
+	}
+	validateRBDImageCount(f, 1, defaultRBDPool)
+	validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+
+	err = deletePVCAndApp("", f, pvc, app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC and application: %w", err)
+	}
+	validateRBDImageCount(f, 0, defaultRBDPool)
+	validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+
+	return nil
+}
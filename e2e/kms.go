@@ -64,6 +64,12 @@ var (
 	secretsMetadataKMS = &simpleKMS{
 		provider: "secrets-metadata",
 	}
+	awsSTSMetadataKMS = &simpleKMS{
+		provider: "aws-sts-metadata",
+	}
+	kmipKMS = &simpleKMS{
+		provider: "kmip",
+	}
 
 	vaultKMS = &vaultConfig{
 		simpleKMS: &simpleKMS{
@@ -0,0 +1,232 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// kmsTestCase is an entry in the matrix of the KMS configurations that the
+// encryption of RBD volumes is tested with.
+type kmsTestCase struct {
+	name string
+	// kmsID is the encryptionKMSID in kms-config.yaml, the passphrase is
+	// stored in the metadata of the image when it is empty
+	kmsID string
+	// kms validates the passphrase in the KMS
+	kms kmsConfig
+	// requiredSecret is the Secret in the cephcsi namespace with the
+	// credentials of a KMS that is not deployed by the e2e tests. The test
+	// case is skipped when the Secret does not exist.
+	requiredSecret string
+	// setup creates the resources that the KMS needs in the namespace of
+	// the test, and returns a function that removes them again
+	setup func(f *framework.Framework) (func() error, error)
+}
+
+// kmsMatrix contains the KMS configurations from kms-config.yaml that are
+// tested with validateKMSTestCase().
+var kmsMatrix = []kmsTestCase{
+	{
+		name: "passphrase in the image metadata",
+		kms:  noKMS,
+	},
+	{
+		name:  "SecretsMetadataKMS",
+		kmsID: "secrets-metadata-test",
+		kms:   secretsMetadataKMS,
+	},
+	{
+		name:  "user secrets based SecretsMetadataKMS",
+		kmsID: "user-ns-secrets-metadata-test",
+		kms:   secretsMetadataKMS,
+		setup: func(f *framework.Framework) (func() error, error) {
+			return createUserSecret(cephCSINamespace)
+		},
+	},
+	{
+		name:  "user secrets based SecretsMetadataKMS with tenant namespace",
+		kmsID: "user-secrets-metadata-test",
+		kms:   secretsMetadataKMS,
+		setup: func(f *framework.Framework) (func() error, error) {
+			return createUserSecret(f.UniqueName)
+		},
+	},
+	{
+		name:  "VaultKMS",
+		kmsID: "vault-test",
+		kms:   vaultKMS,
+	},
+	{
+		name:  "VaultTokensKMS",
+		kmsID: "vault-tokens-test",
+		kms:   vaultTokensKMS,
+		setup: createTenantToken,
+	},
+	{
+		name:  "VaultTenantSA KMS",
+		kmsID: "vault-tenant-sa-test",
+		kms:   vaultTenantSAKMS,
+		setup: func(f *framework.Framework) (func() error, error) {
+			err := createTenantServiceAccount(f.ClientSet, f.UniqueName)
+			if err != nil {
+				return nil, err
+			}
+
+			return func() error {
+				return createORDeleteTenantServiceAccount(kubectlDelete, f.UniqueName)
+			}, nil
+		},
+	},
+	{
+		name:           "AWS STS metadata KMS",
+		kmsID:          "aws-sts-metadata-test",
+		kms:            awsSTSMetadataKMS,
+		requiredSecret: "ceph-csi-aws-credentials",
+	},
+	{
+		name:           "KMIP KMS",
+		kmsID:          "kmip-test",
+		kms:            kmipKMS,
+		requiredSecret: "ceph-csi-kmip-credentials",
+	},
+}
+
+// createUserSecret creates the Secret with the passphrase for the user secrets
+// based SecretsMetadataKMS in the namespace.
+func createUserSecret(namespace string) (func() error, error) {
+	err := retryKubectlFile(namespace, kubectlCreate, vaultExamplePath+vaultUserSecret, deployTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create user Secret: %w", err)
+	}
+
+	return func() error {
+		return retryKubectlFile(
+			namespace,
+			kubectlDelete,
+			vaultExamplePath+vaultUserSecret,
+			deployTimeout,
+			"--ignore-not-found=true")
+	}, nil
+}
+
+// createTenantToken creates the Secret with the Vault token of the tenant in
+// the namespace of the test.
+func createTenantToken(f *framework.Framework) (func() error, error) {
+	token, err := getSecret(vaultExamplePath + "tenant-token.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tenant token from secret: %w", err)
+	}
+	_, err = f.ClientSet.CoreV1().Secrets(f.UniqueName).Create(context.TODO(), &token, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Secret with tenant token: %w", err)
+	}
+
+	return func() error {
+		return f.ClientSet.CoreV1().Secrets(f.UniqueName).Delete(context.TODO(), token.Name, metav1.DeleteOptions{})
+	}, nil
+}
+
+// skipReason returns why the test case can not run, or an empty string when
+// it can.
+func (tc *kmsTestCase) skipReason(f *framework.Framework) (string, error) {
+	if tc.requiredSecret == "" {
+		return "", nil
+	}
+
+	_, err := f.ClientSet.CoreV1().Secrets(cephCSINamespace).Get(
+		context.TODO(),
+		tc.requiredSecret,
+		metav1.GetOptions{})
+	if apierrs.IsNotFound(err) {
+		return fmt.Sprintf("Secret %s/%s with the KMS credentials does not exist",
+			cephCSINamespace, tc.requiredSecret), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get Secret %s/%s: %w", cephCSINamespace, tc.requiredSecret, err)
+	}
+
+	return "", nil
+}
+
+// validateKMSTestCase replaces the default StorageClass with one that
+// encrypts the volumes with the KMS of the test case, and validates that a
+// volume is encrypted, and that the passphrase is stored in the KMS and
+// removed again when the volume is deleted. The default StorageClass is
+// restored afterwards.
+func validateKMSTestCase(f *framework.Framework, tc *kmsTestCase, pvcPath, appPath string) error {
+	reason, err := tc.skipReason(f)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		e2elog.Logf("skipping encryption with %s: %s", tc.name, reason)
+
+		return nil
+	}
+
+	err = deleteResource(rbdExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete storageclass: %w", err)
+	}
+	defer func() {
+		scErr := deleteResource(rbdExamplePath + "storageclass.yaml")
+		if scErr != nil {
+			e2elog.Failf("failed to delete storageclass: %v", scErr)
+		}
+		scErr = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+		if scErr != nil {
+			e2elog.Failf("failed to create storageclass: %v", scErr)
+		}
+	}()
+	scOpts := map[string]string{
+		"encrypted": "true",
+	}
+	if tc.kmsID != "" {
+		scOpts["encryptionKMSID"] = tc.kmsID
+	}
+	err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass: %w", err)
+	}
+
+	if tc.setup != nil {
+		cleanup, setupErr := tc.setup(f)
+		if setupErr != nil {
+			return setupErr
+		}
+		defer func() {
+			cleanupErr := cleanup()
+			if cleanupErr != nil {
+				e2elog.Failf("failed to remove resources of %s: %v", tc.name, cleanupErr)
+			}
+		}()
+	}
+
+	err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, tc.kms, f)
+	if err != nil {
+		return fmt.Errorf("failed to validate encrypted pvc: %w", err)
+	}
+
+	return nil
+}
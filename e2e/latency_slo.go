@@ -0,0 +1,227 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	attachToReadyOperation = "attach to ready"
+	firstWriteOperation    = "first write"
+)
+
+var (
+	// latencySLOSamples is the number of volumes of each volume type that
+	// the latency SLOs are measured on, the SLOs are not checked when it is
+	// 0.
+	latencySLOSamples int
+	// attachToReadySLO is the longest time that the p90 of the time from
+	// creating a pod until it is ready may take.
+	attachToReadySLO time.Duration
+	// firstWriteSLO is the longest time that the p90 of the first write to
+	// a volume in a ready pod may take.
+	firstWriteSLO time.Duration
+)
+
+// latencyVolumeType is a kind of volume that the latency SLOs are measured
+// on, like a filesystem or block volume of a driver.
+type latencyVolumeType struct {
+	name    string
+	pvcPath string
+	appPath string
+}
+
+// attachToReady returns the time from the creation of the pod until it
+// became ready, as recorded by the API server. Unlike measuring how long
+// waiting for the pod takes, this does not depend on the poll interval.
+func attachToReady(pod *v1.Pod) (time.Duration, error) {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady && condition.Status == v1.ConditionTrue {
+			return condition.LastTransitionTime.Sub(pod.CreationTimestamp.Time), nil
+		}
+	}
+
+	return 0, fmt.Errorf("pod %s/%s is not ready", pod.Namespace, pod.Name)
+}
+
+// firstWriteCommand returns the command that writes the first block to the
+// volume of the app with direct IO.
+func firstWriteCommand(app *v1.Pod) string {
+	container := app.Spec.Containers[0]
+	if len(container.VolumeDevices) != 0 {
+		return fmt.Sprintf("dd if=/dev/zero of=%s bs=4k count=1 oflag=direct conv=notrunc status=none",
+			container.VolumeDevices[0].DevicePath)
+	}
+
+	return fmt.Sprintf("dd if=/dev/zero of=%s/first-write bs=4k count=1 oflag=direct conv=fsync status=none",
+		container.VolumeMounts[0].MountPath)
+}
+
+// latencySLOViolations returns the operations whose p90 latency is above
+// their SLO, or that failed.
+func latencySLOViolations(stats []latencyStats, slos map[string]time.Duration) []string {
+	var violations []string
+	for _, s := range stats {
+		if s.Failed != 0 {
+			violations = append(violations, fmt.Sprintf("%s failed %d times", s.Operation, s.Failed))
+		}
+		slo, ok := slos[s.Operation]
+		if ok && s.P90 > slo {
+			violations = append(violations, fmt.Sprintf("p90 of %s is %s, above the SLO of %s",
+				s.Operation, s.P90.Round(time.Millisecond), slo))
+		}
+	}
+
+	return violations
+}
+
+// latencySamples are the latencies that were measured on the volumes of a
+// volume type, and the number of volumes that an operation failed for.
+type latencySamples struct {
+	ready       []time.Duration
+	write       []time.Duration
+	readyFailed int
+	writeFailed int
+}
+
+// measure creates a PVC and an app that uses it, and records the time until
+// the app was ready, and the time that the first write to the volume took,
+// which includes running the command in the app. When the app does not get
+// ready, both operations count as failed.
+func (ls *latencySamples) measure(f *framework.Framework, pvc *v1.PersistentVolumeClaim, app *v1.Pod) error {
+	ready, err := measureAttachToReady(f, pvc, app)
+	if err != nil {
+		ls.readyFailed++
+		ls.writeFailed++
+
+		return err
+	}
+	ls.ready = append(ls.ready, ready)
+	defer func() {
+		deleteErr := deletePVCAndApp("", f, pvc, app)
+		if deleteErr != nil {
+			e2elog.Logf("failed to delete PVC and application %s: %v", app.Name, deleteErr)
+		}
+	}()
+
+	start := time.Now()
+	_, stdErr, err := execCommandInPodWithName(f, firstWriteCommand(app), app.Name,
+		app.Spec.Containers[0].Name, app.Namespace)
+	if err != nil {
+		ls.writeFailed++
+
+		return fmt.Errorf("first write in %s failed: %w, stdErr: %s", app.Name, err, stdErr)
+	}
+	ls.write = append(ls.write, time.Since(start))
+
+	return nil
+}
+
+// measureAttachToReady creates the PVC and the app, and returns the time
+// until the app was ready. The PVC and the app are deleted again when the app
+// does not get ready.
+func measureAttachToReady(f *framework.Framework, pvc *v1.PersistentVolumeClaim, app *v1.Pod) (time.Duration, error) {
+	ready, err := createAndGetReady(f, pvc, app)
+	if err != nil {
+		deleteErr := deletePVCAndApp("", f, pvc, app)
+		if deleteErr != nil {
+			e2elog.Logf("failed to delete PVC and application %s: %v", app.Name, deleteErr)
+		}
+
+		return 0, err
+	}
+
+	return ready, nil
+}
+
+// createAndGetReady creates the PVC and the app, and returns the time until
+// the app was ready.
+func createAndGetReady(f *framework.Framework, pvc *v1.PersistentVolumeClaim, app *v1.Pod) (time.Duration, error) {
+	err := createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create PVC and application %s: %w", app.Name, err)
+	}
+	pod, err := f.ClientSet.CoreV1().Pods(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get pod %s: %w", app.Name, err)
+	}
+
+	return attachToReady(pod)
+}
+
+// validateLatencySLOs measures the attach-to-ready and first-write latency
+// of latencySLOSamples volumes of the volume type, one after the other. The
+// latency percentiles are logged and written to
+// benchmark_latency-slo-<type>.json in --report-dir, and an error is
+// returned when the p90 of an operation is above its SLO.
+func validateLatencySLOs(f *framework.Framework, vt latencyVolumeType) error {
+	pvc, err := loadPVC(vt.pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	app, err := loadApp(vt.appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+
+	samples := &latencySamples{}
+	for i := 0; i < latencySLOSamples; i++ {
+		objName := fmt.Sprintf("latency-slo-%d", i)
+		samplePVC := pvc.DeepCopy()
+		samplePVC.Name = objName
+		samplePVC.Namespace = f.UniqueName
+		sampleApp := app.DeepCopy()
+		sampleApp.Name = objName
+		sampleApp.Namespace = f.UniqueName
+		sampleApp.Labels = map[string]string{"app": objName}
+		sampleApp.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = objName
+
+		err = samples.measure(f, samplePVC, sampleApp)
+		if err != nil {
+			e2elog.Logf("latency of %s volume %d: %v", vt.name, i, err)
+		}
+	}
+
+	stats := []latencyStats{
+		newLatencyStats(attachToReadyOperation, samples.ready, samples.readyFailed),
+		newLatencyStats(firstWriteOperation, samples.write, samples.writeFailed),
+	}
+	e2elog.Logf("latency of %d %s volumes:\n%s", latencySLOSamples, vt.name, formatLatencyStats(stats))
+	err = writeBenchmarkReport("latency-slo-"+vt.name, stats)
+	if err != nil {
+		e2elog.Logf("failed to write latency report: %v", err)
+	}
+
+	violations := latencySLOViolations(stats, map[string]time.Duration{
+		attachToReadyOperation: attachToReadySLO,
+		firstWriteOperation:    firstWriteSLO,
+	})
+	if len(violations) != 0 {
+		return fmt.Errorf("%s volumes do not meet the latency SLOs: %s", vt.name, strings.Join(violations, "; "))
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAttachToReady(t *testing.T) {
+	t.Parallel()
+	created := time.Date(2022, 9, 1, 10, 0, 0, 0, time.UTC)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns", CreationTimestamp: metav1.NewTime(created)},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{
+				{
+					Type:               v1.PodScheduled,
+					Status:             v1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(created.Add(time.Second)),
+				},
+				{
+					Type:               v1.PodReady,
+					Status:             v1.ConditionTrue,
+					LastTransitionTime: metav1.NewTime(created.Add(12 * time.Second)),
+				},
+			},
+		},
+	}
+	ready, err := attachToReady(pod)
+	if err != nil {
+		t.Fatalf("attachToReady() failed: %v", err)
+	}
+	if ready != 12*time.Second {
+		t.Errorf("attachToReady() = %s, expected 12s", ready)
+	}
+
+	pod.Status.Conditions[1].Status = v1.ConditionFalse
+	_, err = attachToReady(pod)
+	if err == nil {
+		t.Error("attachToReady() of a pod that is not ready succeeded")
+	}
+}
+
+func TestFirstWriteCommand(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		container v1.Container
+		expected  string
+	}{
+		{
+			name:      "filesystem",
+			container: v1.Container{VolumeMounts: []v1.VolumeMount{{MountPath: "/var/lib/www/html"}}},
+			expected: "dd if=/dev/zero of=/var/lib/www/html/first-write bs=4k count=1 " +
+				"oflag=direct conv=fsync status=none",
+		},
+		{
+			name:      "block",
+			container: v1.Container{VolumeDevices: []v1.VolumeDevice{{DevicePath: "/dev/xvda"}}},
+			expected:  "dd if=/dev/zero of=/dev/xvda bs=4k count=1 oflag=direct conv=notrunc status=none",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			app := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{ts.container}}}
+			if got := firstWriteCommand(app); got != ts.expected {
+				t.Errorf("firstWriteCommand() = %q, expected %q", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestLatencySLOViolations(t *testing.T) {
+	t.Parallel()
+	slos := map[string]time.Duration{
+		attachToReadyOperation: time.Minute,
+		firstWriteOperation:    time.Second,
+	}
+	tests := []struct {
+		name     string
+		stats    []latencyStats
+		expected []string
+	}{
+		{
+			name: "within the SLOs",
+			stats: []latencyStats{
+				{Operation: attachToReadyOperation, Count: 5, P90: 30 * time.Second},
+				{Operation: firstWriteOperation, Count: 5, P90: time.Second},
+			},
+		},
+		{
+			name: "slow first write",
+			stats: []latencyStats{
+				{Operation: attachToReadyOperation, Count: 5, P90: 30 * time.Second},
+				{Operation: firstWriteOperation, Count: 5, P90: 1500 * time.Millisecond},
+			},
+			expected: []string{"p90 of first write is 1.5s, above the SLO of 1s"},
+		},
+		{
+			name: "failed attach",
+			stats: []latencyStats{
+				{Operation: attachToReadyOperation, Count: 4, Failed: 1, P90: 30 * time.Second},
+				{Operation: firstWriteOperation, Count: 4, P90: time.Second},
+			},
+			expected: []string{"attach to ready failed 1 times"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := latencySLOViolations(ts.stats, slos); !reflect.DeepEqual(got, ts.expected) {
+				t.Errorf("latencySLOViolations() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
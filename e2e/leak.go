@@ -0,0 +1,112 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+// journalLeakDetector counts the entries in the CSI journals of a driver when
+// a suite starts, so that the entries that the suite did not remove can be
+// reported when it ends.
+type journalLeakDetector struct {
+	driver string
+	pool   string
+	// opts are the rados options at the start of the suite, the suite may
+	// change the rados namespace
+	opts    string
+	entries map[string]int
+}
+
+// newJournalLeakDetector counts the entries in the CSI journals of the driver
+// in the pool. For CephFS and NFS the pool is the metadata pool of the
+// filesystem.
+func newJournalLeakDetector(f *framework.Framework, driver, pool string) (*journalLeakDetector, error) {
+	d := &journalLeakDetector{
+		driver: driver,
+		pool:   pool,
+		opts:   journalRadosOptions(driver, pool),
+	}
+	entries, err := d.count(f)
+	if err != nil {
+		return nil, err
+	}
+	d.entries = entries
+
+	return d, nil
+}
+
+// count returns the number of keys in the directory objects of the journals,
+// and the number of objects with the attributes of a reservation.
+func (d *journalLeakDetector) count(f *framework.Framework) (map[string]int, error) {
+	objects, err := listRadosLines(f, "rados ls "+d.opts)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := map[string]int{}
+	for _, j := range []csiJournal{volumeJournal, snapshotJournal} {
+		keys, listErr := listRadosLines(f, fmt.Sprintf("rados listomapkeys %s %s", j.directory, d.opts))
+		if listErr != nil {
+			return nil, listErr
+		}
+		entries[j.directory+" keys"] = len(keys)
+
+		reservations := 0
+		for _, obj := range objects {
+			if obj != j.directory && strings.HasPrefix(obj, j.objectPrefix) {
+				reservations++
+			}
+		}
+		entries[j.objectPrefix+"<uuid> objects"] = reservations
+	}
+
+	return entries, nil
+}
+
+// check returns an error when there are more entries in the journals than at
+// the start of the suite.
+func (d *journalLeakDetector) check(f *framework.Framework) error {
+	entries, err := d.count(f)
+	if err != nil {
+		return err
+	}
+	leaks := journalLeaks(d.entries, entries)
+	if len(leaks) != 0 {
+		return fmt.Errorf("%s leaked journal entries in pool %s: %s", d.driver, d.pool, strings.Join(leaks, "; "))
+	}
+
+	return nil
+}
+
+// journalLeaks returns the entries that have a higher count after the suite
+// than before it.
+func journalLeaks(before, after map[string]int) []string {
+	leaks := []string{}
+	for name, count := range after {
+		if count > before[name] {
+			leaks = append(leaks, fmt.Sprintf("%s: %d before, %d after", name, before[name], count))
+		}
+	}
+	sort.Strings(leaks)
+
+	return leaks
+}
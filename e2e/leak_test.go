@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestJournalLeaks(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		before   map[string]int
+		after    map[string]int
+		expected []string
+	}{
+		{
+			name:     "no entries",
+			before:   map[string]int{"csi.volumes.default keys": 0},
+			after:    map[string]int{"csi.volumes.default keys": 0},
+			expected: []string{},
+		},
+		{
+			name:     "entries of an earlier suite",
+			before:   map[string]int{"csi.volumes.default keys": 2, "csi.volume.<uuid> objects": 2},
+			after:    map[string]int{"csi.volumes.default keys": 1, "csi.volume.<uuid> objects": 2},
+			expected: []string{},
+		},
+		{
+			name:   "leaked reservations",
+			before: map[string]int{"csi.volumes.default keys": 1, "csi.snaps.default keys": 0},
+			after: map[string]int{
+				"csi.volumes.default keys":  3,
+				"csi.volume.<uuid> objects": 2,
+				"csi.snaps.default keys":    0,
+			},
+			expected: []string{
+				"csi.volume.<uuid> objects: 0 before, 2 after",
+				"csi.volumes.default keys: 1 before, 3 after",
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			leaks := journalLeaks(ts.before, ts.after)
+			if !reflect.DeepEqual(leaks, ts.expected) {
+				t.Errorf("journalLeaks() = %q, expected %q", leaks, ts.expected)
+			}
+		})
+	}
+}
@@ -16,8 +16,10 @@ package e2e
 import (
 	"context"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -76,3 +78,156 @@ func getPreviousPodLogs(c clientset.Interface, namespace, podName, containerName
 
 	return string(logs), err
 }
+
+// logWindow is the time range of the logs that an assertion looks at. A zero
+// until is open ended.
+type logWindow struct {
+	since time.Time
+	until time.Time
+}
+
+// newLogWindow returns a window that starts now, and is open ended. It is
+// created before the operation whose logs are asserted.
+func newLogWindow() logWindow {
+	return logWindow{since: time.Now()}
+}
+
+// contains returns whether the time is in the window.
+func (w logWindow) contains(t time.Time) bool {
+	if t.Before(w.since) {
+		return false
+	}
+
+	return w.until.IsZero() || !t.After(w.until)
+}
+
+// linesInWindow returns the lines of logs with the timestamps of the kubelet
+// that were logged in the window, without the timestamps. Lines without a
+// timestamp continue the previous line.
+func linesInWindow(logs string, w logWindow) []string {
+	var (
+		lines    []string
+		inWindow bool
+	)
+	for _, line := range strings.Split(logs, "\n") {
+		if line == "" {
+			continue
+		}
+		stamp, text, found := strings.Cut(line, " ")
+		t, err := time.Parse(time.RFC3339Nano, stamp)
+		if !found || err != nil {
+			if inWindow {
+				lines = append(lines, line)
+			}
+
+			continue
+		}
+		inWindow = w.contains(t)
+		if inWindow {
+			lines = append(lines, text)
+		}
+	}
+
+	return lines
+}
+
+// matchLines returns the lines that match the regular expression.
+func matchLines(lines []string, re *regexp.Regexp) []string {
+	var matched []string
+	for _, line := range lines {
+		if re.MatchString(line) {
+			matched = append(matched, line)
+		}
+	}
+
+	return matched
+}
+
+// getContainerLogsInWindow returns the lines that the container of the pod
+// logged in the window. The logs are requested with timestamps, SinceTime
+// only has a resolution of seconds.
+func getContainerLogsInWindow(c clientset.Interface, pod *v1.Pod, container string, w logWindow) ([]string, error) {
+	since := metav1.NewTime(w.since.Truncate(time.Second))
+	logs, err := c.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &v1.PodLogOptions{
+		Container:  container,
+		SinceTime:  &since,
+		Timestamps: true,
+	}).Do(context.TODO()).Raw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of %s/%s:%s: %w", pod.Namespace, pod.Name, container, err)
+	}
+
+	return linesInWindow(string(logs), w), nil
+}
+
+// matchDriverLogs returns the lines that the container of the pods with the
+// label in cephCSINamespace logged in the window, and that match the regular
+// expression. Each line is prefixed with the name of its pod.
+func matchDriverLogs(
+	c clientset.Interface,
+	label, container string,
+	re *regexp.Regexp,
+	w logWindow,
+) ([]string, error) {
+	pods, err := c.CoreV1().Pods(cephCSINamespace).List(context.TODO(), metav1.ListOptions{LabelSelector: label})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods with selector %s: %w", label, err)
+	}
+	var matched []string
+	for i := range pods.Items {
+		lines, logErr := getContainerLogsInWindow(c, &pods.Items[i], container, w)
+		if logErr != nil {
+			return nil, logErr
+		}
+		for _, line := range matchLines(lines, re) {
+			matched = append(matched, pods.Items[i].Name+": "+line)
+		}
+	}
+
+	return matched, nil
+}
+
+// waitForDriverLog waits until a pod of the driver with the label logged a
+// line in the container that matches the regular expression in the window,
+// and returns the matching lines. Logs show that a code path was taken when
+// the state in Kubernetes and Ceph does not change, like for rejected
+// requests.
+func waitForDriverLog(
+	c clientset.Interface,
+	label, container string,
+	re *regexp.Regexp,
+	w logWindow,
+	timeout time.Duration,
+) ([]string, error) {
+	return waitForState(
+		fmt.Sprintf("logs of %s in pods %q", container, label),
+		func() ([]string, error) {
+			return matchDriverLogs(c, label, container, re, w)
+		},
+		stateCondition[[]string]{
+			name: "matching " + re.String(),
+			met: func(matched []string) (bool, error) {
+				return len(matched) != 0, nil
+			},
+			describe: func(matched []string) string {
+				return fmt.Sprintf("%d matching lines", len(matched))
+			},
+		},
+		timeout)
+}
+
+// assertNoDriverLog returns an error when a pod of the driver with the label
+// logged a line in the container that matches the regular expression in the
+// window.
+func assertNoDriverLog(c clientset.Interface, label, container string, re *regexp.Regexp, w logWindow) error {
+	matched, err := matchDriverLogs(c, label, container, re, w)
+	if err != nil {
+		return err
+	}
+	if len(matched) != 0 {
+		return fmt.Errorf("%d lines of %s in pods %q match %s: %s", len(matched), container, label, re,
+			strings.Join(matched, "; "))
+	}
+
+	return nil
+}
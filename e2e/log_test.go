@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestLinesInWindow(t *testing.T) {
+	t.Parallel()
+	logs := "2022-06-01T10:00:00.100000000Z I0601 first\n" +
+		"2022-06-01T10:00:01.500000000Z E0601 GRPC error: rpc error: code = InvalidArgument desc = bogus\n" +
+		"continued line\n" +
+		"2022-06-01T10:00:02.000000000Z I0601 last\n"
+	at := func(s string) time.Time {
+		parsed, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", s, err)
+		}
+
+		return parsed
+	}
+	tests := []struct {
+		name     string
+		window   logWindow
+		expected []string
+	}{
+		{
+			name:   "open ended",
+			window: logWindow{since: at("2022-06-01T10:00:01Z")},
+			expected: []string{
+				"E0601 GRPC error: rpc error: code = InvalidArgument desc = bogus",
+				"continued line",
+				"I0601 last",
+			},
+		},
+		{
+			name:     "bounded",
+			window:   logWindow{since: at("2022-06-01T10:00:00Z"), until: at("2022-06-01T10:00:01Z")},
+			expected: []string{"I0601 first"},
+		},
+		{
+			name:     "after the logs",
+			window:   logWindow{since: at("2022-06-01T11:00:00Z")},
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := linesInWindow(logs, ts.window); !reflect.DeepEqual(got, ts.expected) {
+				t.Errorf("linesInWindow() = %q, expected %q", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestMatchLines(t *testing.T) {
+	t.Parallel()
+	lines := []string{
+		"I0601 GRPC call: /csi.v1.Controller/CreateVolume",
+		"E0601 GRPC error: rpc error: code = InvalidArgument desc = invalid feature bogus",
+	}
+	re := regexp.MustCompile("GRPC error: .*" + regexp.QuoteMeta(invalidArgument("invalid feature bogus")))
+	expected := lines[1:]
+	if got := matchLines(lines, re); !reflect.DeepEqual(got, expected) {
+		t.Errorf("matchLines() = %q, expected %q", got, expected)
+	}
+	if got := matchLines(lines, regexp.MustCompile("panic")); got != nil {
+		t.Errorf("matchLines() = %q, expected no lines", got)
+	}
+}
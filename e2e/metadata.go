@@ -0,0 +1,250 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// cephMetadata is the metadata that the provisioner sets with --setmetadata
+// on the image or subvolume of a PVC, or on the image or subvolume snapshot
+// of a VolumeSnapshot.
+type cephMetadata struct {
+	// set are the keys with their expected value
+	set map[string]string
+	// unset are the keys that may not be set
+	unset []string
+}
+
+// pvcMetadata returns the metadata of the volume of the bound PVC.
+func pvcMetadata(pvc *v1.PersistentVolumeClaim) cephMetadata {
+	return cephMetadata{
+		set: map[string]string{
+			pvcNameKey:      pvc.Name,
+			pvcNamespaceKey: pvc.Namespace,
+			pvNameKey:       pvc.Spec.VolumeName,
+			clusterNameKey:  defaultClusterName,
+		},
+		// restored volumes may not keep the metadata of the snapshot
+		unset: []string{volSnapNameKey, volSnapNamespaceKey, volSnapContentNameKey},
+	}
+}
+
+// snapshotMetadata returns the metadata of the snapshot of the
+// VolumeSnapshot.
+func snapshotMetadata(snap *snapapi.VolumeSnapshot, content *snapapi.VolumeSnapshotContent) cephMetadata {
+	return cephMetadata{
+		set: map[string]string{
+			volSnapNameKey:        snap.Name,
+			volSnapNamespaceKey:   snap.Namespace,
+			volSnapContentNameKey: content.Name,
+			clusterNameKey:        defaultClusterName,
+		},
+		// RBD snapshots are images, they may not keep the metadata of the
+		// parent PVC
+		unset: []string{pvcNameKey, pvcNamespaceKey, pvNameKey},
+	}
+}
+
+// mismatches returns the keys of the metadata that do not have their
+// expected value, sorted by key.
+func (m cephMetadata) mismatches(metadata map[string]string) []string {
+	problems := []string{}
+	for key, expected := range m.set {
+		value, ok := metadata[key]
+		switch {
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s is not set, expected %q", key, expected))
+		case value != expected:
+			problems = append(problems, fmt.Sprintf("%s is %q, expected %q", key, value, expected))
+		}
+	}
+	for _, key := range m.unset {
+		if value, ok := metadata[key]; ok {
+			problems = append(problems, fmt.Sprintf("%s is %q, expected it to be unset", key, value))
+		}
+	}
+	sort.Strings(problems)
+
+	return problems
+}
+
+// subvolumeGroupFromPath returns the subvolume group of the subvolumePath
+// (/volumes/<group>/<subvolume>/<uuid>) in the attributes of a CephFS PV.
+func subvolumeGroupFromPath(subvolumePath string) (string, error) {
+	parts := strings.Split(strings.Trim(subvolumePath, "/"), "/")
+	if len(parts) < 3 || parts[0] != "volumes" || parts[1] == "" {
+		return "", fmt.Errorf("unexpected subvolumePath %q", subvolumePath)
+	}
+
+	return parts[1], nil
+}
+
+// rbdPoolSpecFromPV returns the pool, and the rados namespace if any, of the
+// image of the RBD PV.
+func rbdPoolSpecFromPV(pv *v1.PersistentVolume) string {
+	attrs := pv.Spec.CSI.VolumeAttributes
+	if attrs["radosNamespace"] != "" {
+		return attrs["pool"] + "/" + attrs["radosNamespace"]
+	}
+
+	return attrs["pool"]
+}
+
+// hasProvisionerMetadata returns whether the provisioner set metadata on the
+// image or subvolume of the PV. Static PVs and PVs of other drivers do not
+// have any.
+func hasProvisionerMetadata(pv *v1.PersistentVolume) bool {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.VolumeAttributes["staticVolume"] == "true" {
+		return false
+	}
+
+	return pv.Spec.CSI.Driver == rbdDriverName || pv.Spec.CSI.Driver == cephFSDriverName
+}
+
+// getPVMetadata returns the metadata of the image or subvolume of the PV.
+func getPVMetadata(f *framework.Framework, pv *v1.PersistentVolume) (map[string]string, error) {
+	attrs := pv.Spec.CSI.VolumeAttributes
+	if pv.Spec.CSI.Driver == rbdDriverName {
+		return cephJSON[map[string]string](f,
+			fmt.Sprintf("rbd image-meta list %s/%s", rbdPoolSpecFromPV(pv), attrs["imageName"]))
+	}
+	group, err := subvolumeGroupFromPath(attrs["subvolumePath"])
+	if err != nil {
+		return nil, err
+	}
+
+	return cephJSON[map[string]string](f,
+		fmt.Sprintf("ceph fs subvolume metadata ls %s %s --group_name=%s",
+			attrs["fsName"], attrs["subvolumeName"], group))
+}
+
+// getSnapshotMetadata returns the metadata of the image or subvolume
+// snapshot of the VolumeSnapshotContent, which is a snapshot of the PV.
+func getSnapshotMetadata(
+	f *framework.Framework,
+	content *snapapi.VolumeSnapshotContent,
+	pv *v1.PersistentVolume,
+) (map[string]string, error) {
+	snapID := regexp.MustCompile(`(\w+\-?){5}$`).FindString(*content.Status.SnapshotHandle)
+	snapName := "csi-snap-" + snapID
+	attrs := pv.Spec.CSI.VolumeAttributes
+	switch content.Spec.Driver {
+	case rbdDriverName:
+		return cephJSON[map[string]string](f,
+			fmt.Sprintf("rbd image-meta list %s/%s", rbdPoolSpecFromPV(pv), snapName))
+	case cephFSDriverName:
+		group, err := subvolumeGroupFromPath(attrs["subvolumePath"])
+		if err != nil {
+			return nil, err
+		}
+
+		return cephJSON[map[string]string](f,
+			fmt.Sprintf("ceph fs subvolume snapshot metadata ls %s %s %s --group_name=%s",
+				attrs["fsName"], attrs["subvolumeName"], snapName, group))
+	}
+
+	return nil, fmt.Errorf("snapshots of driver %s have no metadata", content.Spec.Driver)
+}
+
+// metadataMatches returns the condition that is met once the metadata has the
+// expected values.
+func metadataMatches(expected cephMetadata) stateCondition[map[string]string] {
+	return stateCondition[map[string]string]{
+		name: "carrying the metadata of the provisioner",
+		met: func(metadata map[string]string) (bool, error) {
+			return len(expected.mismatches(metadata)) == 0, nil
+		},
+		describe: func(metadata map[string]string) string {
+			return strings.Join(expected.mismatches(metadata), ", ")
+		},
+	}
+}
+
+// validatePVCMetadata checks the metadata on the image or subvolume of the
+// bound PVC. The metadata of a PV that is bound to a new PVC is updated
+// asynchronously, so this waits for the expected values.
+func validatePVCMetadata(f *framework.Framework, pvc *v1.PersistentVolumeClaim) error {
+	pvc, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return err
+	}
+	if !hasProvisionerMetadata(pv) {
+		return nil
+	}
+	if pv.Spec.CSI.Driver == cephFSDriverName && !hasCephFeature(f, subvolumeMetadata) {
+		e2elog.Logf("not validating metadata of PV %s, the Ceph cluster does not support %s",
+			pv.Name, subvolumeMetadata.name)
+
+		return nil
+	}
+
+	_, err = waitForState(
+		"volume of PVC "+pvc.Namespace+"/"+pvc.Name,
+		func() (map[string]string, error) {
+			return getPVMetadata(f, pv)
+		},
+		metadataMatches(pvcMetadata(pvc)),
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return fmt.Errorf("metadata of PV %s: %w", pv.Name, err)
+	}
+
+	return nil
+}
+
+// validateSnapshotMetadata checks the metadata on the image or subvolume
+// snapshot of the VolumeSnapshot that is ready to use.
+func validateSnapshotMetadata(f *framework.Framework, snap *snapapi.VolumeSnapshot) error {
+	content, err := getVolumeSnapshotContent(snap.Namespace, snap.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get snapshotcontent for %s in namespace %s: %w",
+			snap.Name, snap.Namespace, err)
+	}
+	_, pv, err := getPVCAndPV(f.ClientSet, *snap.Spec.Source.PersistentVolumeClaimName, snap.Namespace)
+	if err != nil {
+		return err
+	}
+	if content.Spec.Driver == cephFSDriverName && !hasCephFeature(f, subvolumeSnapshotMetadata) {
+		e2elog.Logf("not validating metadata of VolumeSnapshotContent %s, the Ceph cluster does not support %s",
+			content.Name, subvolumeSnapshotMetadata.name)
+
+		return nil
+	}
+
+	_, err = waitForState(
+		"snapshot "+snap.Namespace+"/"+snap.Name,
+		func() (map[string]string, error) {
+			return getSnapshotMetadata(f, content, pv)
+		},
+		metadataMatches(snapshotMetadata(snap, content)),
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return fmt.Errorf("metadata of VolumeSnapshotContent %s: %w", content.Name, err)
+	}
+
+	return nil
+}
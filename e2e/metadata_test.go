@@ -0,0 +1,146 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCephMetadataMismatches(t *testing.T) {
+	t.Parallel()
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd-pvc", Namespace: "ns"},
+		Spec:       v1.PersistentVolumeClaimSpec{VolumeName: "pvc-1234"},
+	}
+	expected := pvcMetadata(pvc)
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		problems []string
+	}{
+		{
+			name: "all set",
+			metadata: map[string]string{
+				pvcNameKey:      "rbd-pvc",
+				pvcNamespaceKey: "ns",
+				pvNameKey:       "pvc-1234",
+				clusterNameKey:  defaultClusterName,
+				"other":         "value",
+			},
+			problems: []string{},
+		},
+		{
+			name: "old PVC name and metadata of the snapshot",
+			metadata: map[string]string{
+				pvcNameKey:      "old-pvc",
+				pvcNamespaceKey: "ns",
+				pvNameKey:       "pvc-1234",
+				clusterNameKey:  defaultClusterName,
+				volSnapNameKey:  "snap",
+			},
+			problems: []string{
+				`csi.storage.k8s.io/pvc/name is "old-pvc", expected "rbd-pvc"`,
+				`csi.storage.k8s.io/volumesnapshot/name is "snap", expected it to be unset`,
+			},
+		},
+		{
+			name:     "no metadata",
+			metadata: map[string]string{},
+			problems: []string{
+				`csi.ceph.com/cluster/name is not set, expected "k8s-cluster-1"`,
+				`csi.storage.k8s.io/pv/name is not set, expected "pvc-1234"`,
+				`csi.storage.k8s.io/pvc/name is not set, expected "rbd-pvc"`,
+				`csi.storage.k8s.io/pvc/namespace is not set, expected "ns"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			problems := expected.mismatches(ts.metadata)
+			if !reflect.DeepEqual(problems, ts.problems) {
+				t.Errorf("mismatches() = %q, expected %q", problems, ts.problems)
+			}
+		})
+	}
+}
+
+func TestSubvolumeGroupFromPath(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		path    string
+		group   string
+		wantErr bool
+	}{
+		{"/volumes/csi/csi-vol-1234/5678", "csi", false},
+		{"/volumes/e2e-subvolgrp1/csi-vol-1234/5678", "e2e-subvolgrp1", false},
+		{"/volumes//csi-vol-1234", "", true},
+		{"/csi-vol-1234", "", true},
+		{"", "", true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.path, func(t *testing.T) {
+			t.Parallel()
+			group, err := subvolumeGroupFromPath(ts.path)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("subvolumeGroupFromPath() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if group != ts.group {
+				t.Errorf("subvolumeGroupFromPath() = %q, expected %q", group, ts.group)
+			}
+		})
+	}
+}
+
+func TestHasProvisionerMetadata(t *testing.T) {
+	t.Parallel()
+	csiPV := func(driver string, attrs map[string]string) *v1.PersistentVolume {
+		return &v1.PersistentVolume{
+			Spec: v1.PersistentVolumeSpec{
+				PersistentVolumeSource: v1.PersistentVolumeSource{
+					CSI: &v1.CSIPersistentVolumeSource{Driver: driver, VolumeAttributes: attrs},
+				},
+			},
+		}
+	}
+	tests := []struct {
+		name     string
+		pv       *v1.PersistentVolume
+		expected bool
+	}{
+		{"rbd", csiPV(rbdDriverName, nil), true},
+		{"cephfs", csiPV(cephFSDriverName, map[string]string{"subvolumeName": "csi-vol-1"}), true},
+		{"static", csiPV(rbdDriverName, map[string]string{"staticVolume": "true"}), false},
+		{"other driver", csiPV("nfs.csi.ceph.com", nil), false},
+		{"in-tree", &v1.PersistentVolume{}, false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := hasProvisionerMetadata(ts.pv); got != ts.expected {
+				t.Errorf("hasProvisionerMetadata() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// Ports of the metrics endpoints of the RBD and CephFS driver containers,
+// see enableMetricsInTemplate(). The nodeplugins use the host network, so
+// the ports need to differ from each other and from the liveness sidecars.
+const (
+	rbdMetricsPort    = 8090
+	cephFSMetricsPort = 8091
+)
+
+var driverTypeArg = regexp.MustCompile(`(\n(\s+)- "--type=(?:rbd|cephfs)")`)
+
+// enableMetricsInTemplate starts the metrics endpoint of the driver
+// container, on the port.
+func enableMetricsInTemplate(data string, port int) string {
+	return driverTypeArg.ReplaceAllString(data,
+		fmt.Sprintf("$1\n${2}- \"--enablemetrics=true\"\n${2}- \"--metricsport=%d\"", port))
+}
+
+// metricSeries selects the series of a metric that have all the labels, and
+// none of the excluded labels.
+type metricSeries struct {
+	name     string
+	labels   map[string]string
+	excluded map[string]string
+}
+
+func (s metricSeries) String() string {
+	selectors := []string{}
+	for k, v := range s.labels {
+		selectors = append(selectors, fmt.Sprintf("%s=%q", k, v))
+	}
+	for k, v := range s.excluded {
+		selectors = append(selectors, fmt.Sprintf("%s!=%q", k, v))
+	}
+	sort.Strings(selectors)
+
+	return s.name + "{" + strings.Join(selectors, ",") + "}"
+}
+
+// matches returns whether the series of the metric has the labels.
+func (s metricSeries) matches(m *dto.Metric) bool {
+	labels := map[string]string{}
+	for _, l := range m.GetLabel() {
+		labels[l.GetName()] = l.GetValue()
+	}
+	for k, v := range s.labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for k, v := range s.excluded {
+		if labels[k] == v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// value returns the sum of the selected series in the metrics. Histograms
+// and summaries contribute the number of observations.
+func (s metricSeries) value(metrics []map[string]*dto.MetricFamily) float64 {
+	total := 0.0
+	for _, families := range metrics {
+		family, ok := families[s.name]
+		if !ok {
+			continue
+		}
+		for _, m := range family.GetMetric() {
+			if !s.matches(m) {
+				continue
+			}
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				total += m.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				total += m.GetGauge().GetValue()
+			case dto.MetricType_HISTOGRAM:
+				total += float64(m.GetHistogram().GetSampleCount())
+			case dto.MetricType_SUMMARY:
+				total += float64(m.GetSummary().GetSampleCount())
+			case dto.MetricType_UNTYPED:
+				total += m.GetUntyped().GetValue()
+			}
+		}
+	}
+
+	return total
+}
+
+// parseMetrics parses metrics in the Prometheus text format.
+func parseMetrics(data []byte) (map[string]*dto.MetricFamily, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse metrics: %w", err)
+	}
+
+	return families, nil
+}
+
+// scrapeMetrics returns the metrics of all pods in the cephcsi namespace with
+// the label selector, the endpoint of each pod is read through the API server
+// proxy.
+func scrapeMetrics(f *framework.Framework, selector string, port int) ([]map[string]*dto.MetricFamily, error) {
+	pods, err := f.ClientSet.CoreV1().Pods(cephCSINamespace).List(context.TODO(), metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pods with selector %q: %w", selector, err)
+	}
+	if len(pods.Items) == 0 {
+		return nil, fmt.Errorf("no pods with selector %q", selector)
+	}
+
+	metrics := make([]map[string]*dto.MetricFamily, 0, len(pods.Items))
+	for i := range pods.Items {
+		data, proxyErr := f.ClientSet.CoreV1().
+			Pods(cephCSINamespace).
+			ProxyGet("http", pods.Items[i].Name, strconv.Itoa(port), "/metrics", nil).
+			DoRaw(context.TODO())
+		if proxyErr != nil {
+			return nil, fmt.Errorf("failed to get metrics of pod %s: %w", pods.Items[i].Name, proxyErr)
+		}
+		families, parseErr := parseMetrics(data)
+		if parseErr != nil {
+			return nil, fmt.Errorf("pod %s: %w", pods.Items[i].Name, parseErr)
+		}
+		metrics = append(metrics, families)
+	}
+
+	return metrics, nil
+}
+
+// metricsEndpoint is the metrics endpoint of the pods of a provisioner or
+// nodeplugin, and the series that need to increase during an operation.
+type metricsEndpoint struct {
+	selector string
+	port     int
+	series   []metricSeries
+}
+
+// validateMetricsIncrease runs the operation, and checks that all series of
+// the endpoints have a higher value afterwards. Counters are not updated at
+// the same time as the Kubernetes resources, so the metrics are read until
+// the series increased.
+func validateMetricsIncrease(f *framework.Framework, endpoints []metricsEndpoint, operation func() error) error {
+	before := make([][]float64, len(endpoints))
+	for i, ep := range endpoints {
+		metrics, err := scrapeMetrics(f, ep.selector, ep.port)
+		if err != nil {
+			return err
+		}
+		for _, s := range ep.series {
+			before[i] = append(before[i], s.value(metrics))
+		}
+	}
+
+	err := operation()
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(deployTimeout) * time.Minute
+	for i, ep := range endpoints {
+		var unchanged []string
+		err = wait.PollImmediate(poll, timeout, func() (bool, error) {
+			metrics, scrapeErr := scrapeMetrics(f, ep.selector, ep.port)
+			if scrapeErr != nil {
+				e2elog.Logf("failed to scrape metrics: %v", scrapeErr)
+
+				return false, nil
+			}
+			unchanged = nil
+			for j, s := range ep.series {
+				if s.value(metrics) <= before[i][j] {
+					unchanged = append(unchanged, fmt.Sprintf("%s (%g)", s, before[i][j]))
+				}
+			}
+
+			return len(unchanged) == 0, nil
+		})
+		if err != nil {
+			return fmt.Errorf("metrics of pods %q did not increase: %s: %w", ep.selector, strings.Join(unchanged, ", "), err)
+		}
+	}
+
+	return nil
+}
+
+// procedureResults returns the series of csi_procedure_results_total for the
+// gRPC method of the CSI service, in the class of results.
+func procedureResults(service, method, class string) metricSeries {
+	return metricSeries{
+		name: "csi_procedure_results_total",
+		labels: map[string]string{
+			"method": "/csi.v1." + service + "/" + method,
+			"class":  class,
+		},
+	}
+}
+
+// procedureFailures returns the series of csi_procedure_results_total for the
+// gRPC method of the CSI service that did not succeed.
+func procedureFailures(service, method string) metricSeries {
+	return metricSeries{
+		name:     "csi_procedure_results_total",
+		labels:   map[string]string{"method": "/csi.v1." + service + "/" + method},
+		excluded: map[string]string{"class": "success"},
+	}
+}
+
+// validateOperationMetrics creates a PVC and an app that uses it, and checks
+// that the results of the CSI procedures and the journal operations in the
+// pool are counted by the provisioner and the nodeplugin of the driver.
+func validateOperationMetrics(
+	f *framework.Framework,
+	deploymentName, daemonSetName string,
+	port int,
+	journalPool, pvcPath, appPath string,
+) error {
+	provisioner, err := getDeploymentLabelSelector(f, cephCSINamespace, deploymentName)
+	if err != nil {
+		return err
+	}
+	nodeplugin, err := getDaemonSetLabelSelector(f, cephCSINamespace, daemonSetName)
+	if err != nil {
+		return err
+	}
+
+	endpoints := []metricsEndpoint{
+		{
+			selector: provisioner,
+			port:     port,
+			series: []metricSeries{
+				procedureResults("Controller", "CreateVolume", "success"),
+				procedureResults("Controller", "DeleteVolume", "success"),
+				{
+					name:   "csi_journal_omap_operations_total",
+					labels: map[string]string{"pool": journalPool, "operation": "set"},
+				},
+			},
+		},
+		{
+			selector: nodeplugin,
+			port:     port,
+			series: []metricSeries{
+				procedureResults("Node", "NodeStageVolume", "success"),
+				procedureResults("Node", "NodePublishVolume", "success"),
+				procedureResults("Node", "NodeUnpublishVolume", "success"),
+				procedureResults("Node", "NodeUnstageVolume", "success"),
+			},
+		},
+	}
+
+	return validateMetricsIncrease(f, endpoints, func() error {
+		return validatePVCAndAppBinding(pvcPath, appPath, f)
+	})
+}
+
+// validateErrorMetrics creates a PVC that the provisioner of the driver fails
+// to create with the current StorageClass, and checks that the failures of
+// CreateVolume are counted. The PVC is deleted afterwards.
+func validateErrorMetrics(f *framework.Framework, deploymentName string, port int, pvcPath string) error {
+	provisioner, err := getDeploymentLabelSelector(f, cephCSINamespace, deploymentName)
+	if err != nil {
+		return err
+	}
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+
+	endpoints := []metricsEndpoint{
+		{
+			selector: provisioner,
+			port:     port,
+			series:   []metricSeries{procedureFailures("Controller", "CreateVolume")},
+		},
+	}
+	err = validateMetricsIncrease(f, endpoints, func() error {
+		// the PVC is never bound, do not wait for it
+		return createPVCAndvalidatePV(f.ClientSet, pvc, 0)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = f.ClientSet.CoreV1().PersistentVolumeClaims(pvc.Namespace).Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC %s: %w", pvc.Name, err)
+	}
+
+	return nil
+}
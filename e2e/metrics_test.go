@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestEnableMetricsInTemplate(t *testing.T) {
+	t.Parallel()
+	template := `
+          args:
+            - "--nodeid=$(NODE_ID)"
+            - "--type=rbd"
+            - "--controllerserver=true"
+        - name: csi-rbdplugin-controller
+          args:
+            - "--type=controller"
+        - name: liveness-prometheus
+          args:
+            - "--type=liveness"
+            - "--metricsport=8680"
+`
+	expected := `
+          args:
+            - "--nodeid=$(NODE_ID)"
+            - "--type=rbd"
+            - "--enablemetrics=true"
+            - "--metricsport=8090"
+            - "--controllerserver=true"
+        - name: csi-rbdplugin-controller
+          args:
+            - "--type=controller"
+        - name: liveness-prometheus
+          args:
+            - "--type=liveness"
+            - "--metricsport=8680"
+`
+	data := enableMetricsInTemplate(template, rbdMetricsPort)
+	if data != expected {
+		t.Errorf("enableMetricsInTemplate() = %s, expected %s", data, expected)
+	}
+}
+
+func TestMetricSeriesValue(t *testing.T) {
+	t.Parallel()
+	pods := []string{
+		`# TYPE csi_procedure_results_total counter
+csi_procedure_results_total{class="success",method="/csi.v1.Controller/CreateVolume"} 3
+csi_procedure_results_total{class="retryable",method="/csi.v1.Controller/CreateVolume"} 2
+csi_procedure_results_total{class="terminal",method="/csi.v1.Controller/CreateVolume"} 1
+csi_procedure_results_total{class="success",method="/csi.v1.Controller/DeleteVolume"} 3
+# TYPE csi_operation_duration_seconds histogram
+csi_operation_duration_seconds_bucket{operation="mount",le="+Inf"} 4
+csi_operation_duration_seconds_sum{operation="mount"} 1.5
+csi_operation_duration_seconds_count{operation="mount"} 4
+`,
+		`# TYPE csi_procedure_results_total counter
+csi_procedure_results_total{class="success",method="/csi.v1.Controller/CreateVolume"} 1
+`,
+	}
+	metrics := make([]map[string]*dto.MetricFamily, 0, len(pods))
+	for _, pod := range pods {
+		families, err := parseMetrics([]byte(pod))
+		if err != nil {
+			t.Fatalf("parseMetrics() failed: %v", err)
+		}
+		metrics = append(metrics, families)
+	}
+
+	tests := []struct {
+		name     string
+		series   metricSeries
+		expected float64
+	}{
+		{
+			name:     "successes of all pods",
+			series:   procedureResults("Controller", "CreateVolume", "success"),
+			expected: 4,
+		},
+		{
+			name:     "failures",
+			series:   procedureFailures("Controller", "CreateVolume"),
+			expected: 3,
+		},
+		{
+			name:     "method without results",
+			series:   procedureResults("Node", "NodeStageVolume", "success"),
+			expected: 0,
+		},
+		{
+			name: "observations of a histogram",
+			series: metricSeries{
+				name:   "csi_operation_duration_seconds",
+				labels: map[string]string{"operation": "mount"},
+			},
+			expected: 4,
+		},
+		{
+			name:     "missing metric",
+			series:   metricSeries{name: "csi_commands_total"},
+			expected: 0,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			value := ts.series.value(metrics)
+			if value != ts.expected {
+				t.Errorf("%s = %g, expected %g", ts.series, value, ts.expected)
+			}
+		})
+	}
+}
@@ -21,12 +21,21 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
 )
 
+// rbdInTreePluginName is the name of the in-tree RBD plugin, the kubelet
+// lists it in the migrated-plugins annotation of its CSINode when the inline
+// volumes of the plugin are served by the CSI driver.
+const rbdInTreePluginName = "kubernetes.io/rbd"
+
 // composeIntreeMigVolID create a volID similar to intree migration volID
 // the migration volID format looks like below
 // mig-mons-<hash>-image-<UUID_<poolhash>
@@ -87,7 +96,7 @@ func createRBDMigrationSecret(f *framework.Framework, secretName, userName, user
 	// if its admin, we dont need to change anything in the migration secret, the CSI driver
 	// will use the key from existing secret and continue.
 	if userName != "admin" {
-		sec.StringData["adminId"] = userName
+		sec.StringData["adminId"] = resourceName(userName)
 	}
 	sec.StringData["key"] = userKey
 	sec.Namespace = cephCSINamespace
@@ -244,3 +253,152 @@ func tearDownMigrationSetup(f *framework.Framework) error {
 
 	return nil
 }
+
+// isPluginMigrated returns whether the CSINode lists the in-tree plugin as
+// migrated to its CSI driver.
+func isPluginMigrated(csiNode *storagev1.CSINode, plugin string) bool {
+	for _, migrated := range strings.Split(csiNode.Annotations[v1.MigratedPluginsAnnotationKey], ",") {
+		if strings.TrimSpace(migrated) == plugin {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isRBDInlineMigrationEnabled returns whether the kubelets of all nodes
+// migrated the in-tree RBD plugin.
+func isRBDInlineMigrationEnabled(f *framework.Framework) (bool, error) {
+	csiNodes, err := f.ClientSet.StorageV1().CSINodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return false, fmt.Errorf("failed to list CSINodes: %w", err)
+	}
+	for i := range csiNodes.Items {
+		if !isPluginMigrated(&csiNodes.Items[i], rbdInTreePluginName) {
+			return false, nil
+		}
+	}
+
+	return len(csiNodes.Items) != 0, nil
+}
+
+// getInlineVolumeAttachment returns the VolumeAttachment of the CSI driver
+// for an inline volume on the node, or nil.
+func getInlineVolumeAttachment(f *framework.Framework, node string) (*storagev1.VolumeAttachment, error) {
+	list, err := f.ClientSet.StorageV1().VolumeAttachments().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		va := &list.Items[i]
+		if va.Spec.Attacher == rbdDriverName && va.Spec.NodeName == node && va.Spec.Source.InlineVolumeSpec != nil {
+			return va, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// validateRBDInlineMigration mounts an image in a pod through an inline
+// in-tree RBD volume. When the RBD plugin is migrated, the volume is attached
+// with a VolumeAttachment of the CSI driver that carries the translated
+// inline volume, and staged by the nodeplugin with the migration secret in
+// the namespace of the pod. The migration needs to be set up with
+// setupMigrationCMSecretAndSC. Without the migration of the in-tree plugin
+// in the cluster, the validation is skipped.
+func validateRBDInlineMigration(f *framework.Framework, appPath string) error {
+	enabled, err := isRBDInlineMigrationEnabled(f)
+	if err != nil {
+		return err
+	}
+	if !enabled {
+		e2elog.Logf("skipping inline migration, the kubelets did not migrate %s", rbdInTreePluginName)
+
+		return nil
+	}
+
+	rbdImageName := intreeVolPrefix + "4d6f3c1e-2b7a-4e85-9f0c-5a8e7d9b1c23"
+	cmd := fmt.Sprintf("rbd create %s --size=%s --image-feature=layering %s",
+		rbdImageName, staticPVSize, rbdOptions(defaultRBDPool))
+	err = execCommandInToolBoxPodAndCheck(f, cmd, rookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to create rbd image %s: %w", rbdImageName, err)
+	}
+	defer func() {
+		rmErr := execCommandInToolBoxPodAndCheck(f,
+			fmt.Sprintf("rbd rm %s %s", rbdImageName, rbdOptions(defaultRBDPool)),
+			rookNamespace)
+		if rmErr != nil {
+			e2elog.Failf("failed to remove rbd image %s: %v", rbdImageName, rmErr)
+		}
+	}()
+
+	// inline volumes refer to a secret in the namespace of the pod
+	secret, err := f.ClientSet.CoreV1().Secrets(cephCSINamespace).Get(context.TODO(),
+		rbdMigrationNodePluginSecretName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get secret %s: %w", rbdMigrationNodePluginSecretName, err)
+	}
+	inlineSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Namespace: f.UniqueName},
+		Data:       secret.Data,
+	}
+	_, err = f.ClientSet.CoreV1().Secrets(f.UniqueName).Create(context.TODO(), inlineSecret, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create secret %s: %w", inlineSecret.Name, err)
+	}
+
+	mons, err := getMons(rookNamespace, f.ClientSet)
+	if err != nil {
+		return fmt.Errorf("failed to get mons: %w", err)
+	}
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Name = "inline-migration"
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": app.Name}
+	app.Spec.Volumes[0].VolumeSource = v1.VolumeSource{
+		RBD: &v1.RBDVolumeSource{
+			CephMonitors: mons,
+			RBDImage:     rbdImageName,
+			RBDPool:      defaultRBDPool,
+			FSType:       "ext4",
+			RadosUser:    resourceName(keyringRBDNodePluginUsername),
+			SecretRef:    &v1.LocalObjectReference{Name: inlineSecret.Name},
+		},
+	}
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create application with inline volume: %w", err)
+	}
+	pod, err := f.ClientSet.CoreV1().Pods(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", app.Name, err)
+	}
+	va, err := getInlineVolumeAttachment(f, pod.Spec.NodeName)
+	if err != nil {
+		return fmt.Errorf("failed to list VolumeAttachments: %w", err)
+	}
+	if va == nil {
+		return fmt.Errorf("inline volume of %s is not attached by %s", app.Name, rbdDriverName)
+	}
+	err = newDataset("inline-migration", 2, 64).write(f, pod)
+	if err != nil {
+		return err
+	}
+
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application: %w", err)
+	}
+
+	// the image can only be removed once it is detached
+	return waitForDeletion(
+		"VolumeAttachment "+va.Name,
+		func() (*storagev1.VolumeAttachment, error) {
+			return f.ClientSet.StorageV1().VolumeAttachments().Get(context.TODO(), va.Name, metav1.GetOptions{})
+		},
+		time.Duration(deployTimeout)*time.Minute)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsPluginMigrated(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		expected    bool
+	}{
+		{
+			name:        "rbd migrated",
+			annotations: map[string]string{v1.MigratedPluginsAnnotationKey: "kubernetes.io/cinder, kubernetes.io/rbd"},
+			expected:    true,
+		},
+		{
+			name:        "other plugins migrated",
+			annotations: map[string]string{v1.MigratedPluginsAnnotationKey: "kubernetes.io/cinder"},
+			expected:    false,
+		},
+		{
+			name:        "no annotation",
+			annotations: nil,
+			expected:    false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			csiNode := &storagev1.CSINode{ObjectMeta: metav1.ObjectMeta{Annotations: ts.annotations}}
+			if got := isPluginMigrated(csiNode, rbdInTreePluginName); got != ts.expected {
+				t.Errorf("isPluginMigrated() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// peerRookNamespace is the namespace of the Rook cluster that the pools of
+// the Rook cluster in rookNamespace are mirrored to. The mirroring tests are
+// skipped when it is not set.
+var peerRookNamespace string
+
+// imageMirroring is the mirroring state of an image, as reported by
+// "rbd info --format=json".
+type imageMirroring struct {
+	Mode     string `json:"mode"`
+	State    string `json:"state"`
+	GlobalID string `json:"global_id"`
+	Primary  bool   `json:"primary"`
+}
+
+// mirrorImageStatus is the status of a mirrored image, as reported by "rbd
+// mirror image status --format=json".
+type mirrorImageStatus struct {
+	State       string `json:"state"`
+	Description string `json:"description"`
+}
+
+// setupMirrorPeers enables mirroring of images in the pool in the Rook
+// clusters in rookNamespace and peerRookNamespace, and bootstraps the peers
+// in both directions if the pool is not peered yet. The rbd-mirror daemon
+// needs to run in both clusters, see "rook.sh deploy-peer".
+func setupMirrorPeers(f *framework.Framework, pool string) error {
+	for _, ns := range []string{rookNamespace, peerRookNamespace} {
+		// enabling mirroring again succeeds, with a message on stderr
+		_, _, err := execCommandInToolBoxPod(f, "rbd mirror pool enable "+pool+" image", ns)
+		if err != nil {
+			return fmt.Errorf("failed to enable mirroring of pool %s in cluster %s: %w", pool, ns, err)
+		}
+		if radosNamespace == "" {
+			continue
+		}
+		if ns == peerRookNamespace {
+			// the namespace is only created in the primary cluster by the
+			// tests, creating an existing namespace fails
+			_, _, err = execCommandInToolBoxPod(f, "rbd namespace create "+pool+"/"+radosNamespace, ns)
+			if err != nil {
+				e2elog.Logf("failed to create rados namespace %s/%s in cluster %s: %v", pool, radosNamespace, ns, err)
+			}
+		}
+		_, _, err = execCommandInToolBoxPod(f, "rbd mirror pool enable "+pool+"/"+radosNamespace+" image", ns)
+		if err != nil {
+			return fmt.Errorf("failed to enable mirroring of namespace %s/%s in cluster %s: %w",
+				pool, radosNamespace, ns, err)
+		}
+	}
+
+	type mirrorPoolInfo struct {
+		Peers []struct {
+			UUID string `json:"uuid"`
+		} `json:"peers"`
+	}
+	info, err := cephJSON[mirrorPoolInfo](f, "rbd mirror pool info "+pool)
+	if err != nil {
+		return fmt.Errorf("failed to get mirroring info of pool %s: %w", pool, err)
+	}
+	if len(info.Peers) != 0 {
+		return nil
+	}
+
+	token, stdErr, err := execCommandInToolBoxPod(
+		f,
+		fmt.Sprintf("rbd mirror pool peer bootstrap create --site-name %s %s", rookNamespace, pool),
+		rookNamespace)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to create bootstrap token for pool %s: %v, stderr: %s", pool, err, stdErr)
+	}
+	err = execCommandInToolBoxPodAndCheck(
+		f,
+		fmt.Sprintf("echo %s > /tmp/peer-token && "+
+			"rbd mirror pool peer bootstrap import --site-name %s --direction rx-tx %s /tmp/peer-token",
+			strings.TrimSpace(token), peerRookNamespace, pool),
+		peerRookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to import bootstrap token for pool %s: %w", pool, err)
+	}
+
+	return nil
+}
+
+// execCommandInToolBoxPodAndCheck executes the command in the toolbox of the
+// Rook cluster in the namespace, and returns an error when it fails or
+// writes to stderr.
+func execCommandInToolBoxPodAndCheck(f *framework.Framework, cmd, ns string) error {
+	_, stdErr, err := execCommandInToolBoxPod(f, cmd, ns)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("command %q failed: %s", cmd, stdErr)
+	}
+
+	return nil
+}
+
+// getImageMirroring returns the mirroring state of the image in the Rook
+// cluster in the namespace.
+func getImageMirroring(f *framework.Framework, ns, pool, image string) (imageMirroring, error) {
+	type mirroringInfo struct {
+		Mirroring imageMirroring `json:"mirroring"`
+	}
+	info, err := cephJSONInCluster[mirroringInfo](f, "rbd info "+imageSpec(pool, image), ns)
+	if err != nil {
+		return info.Mirroring, fmt.Errorf("failed to get info of image %s: %w", imageSpec(pool, image), err)
+	}
+
+	return info.Mirroring, nil
+}
+
+// waitForImageMirroring waits until mirroring of the image in the Rook
+// cluster in the namespace is enabled, and the image is primary or not.
+func waitForImageMirroring(f *framework.Framework, ns, pool, image string, primary bool) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	var mirroring imageMirroring
+	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		var mirrorErr error
+		mirroring, mirrorErr = getImageMirroring(f, ns, pool, image)
+		if mirrorErr != nil {
+			e2elog.Logf("%v", mirrorErr)
+
+			return false, nil
+		}
+
+		return mirroring.State == "enabled" && mirroring.Primary == primary, nil
+	})
+	if err != nil {
+		return fmt.Errorf("image %s in cluster %s did not get mirroring enabled with primary=%t, last state %+v: %w",
+			imageSpec(pool, image), ns, primary, mirroring, err)
+	}
+
+	return nil
+}
+
+// waitForMirrorImageReplayed waits until the non-primary image in the Rook
+// cluster in the namespace replayed the latest mirror snapshot of the primary
+// image.
+func waitForMirrorImageReplayed(f *framework.Framework, ns, pool, image string) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	var status mirrorImageStatus
+	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		var statusErr error
+		status, statusErr = cephJSONInCluster[mirrorImageStatus](f,
+			"rbd mirror image status "+imageSpec(pool, image), ns)
+		if statusErr != nil {
+			e2elog.Logf("failed to get mirror status of image %s: %v", imageSpec(pool, image), statusErr)
+
+			return false, nil
+		}
+
+		return status.State == "up+replaying" && strings.Contains(status.Description, `"replay_state":"idle"`), nil
+	})
+	if err != nil {
+		return fmt.Errorf("image %s in cluster %s was not replayed, last status %+v: %w",
+			imageSpec(pool, image), ns, status, err)
+	}
+
+	return nil
+}
+
+// waitForPeerImageDeleted waits until the image is removed from the Rook
+// cluster in peerRookNamespace, after mirroring was disabled.
+func waitForPeerImageDeleted(f *framework.Framework, pool, image string) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		images, err := cephJSONInCluster[[]string](f, "rbd ls "+rbdOptions(pool), peerRookNamespace)
+		if err != nil {
+			e2elog.Logf("failed to list images: %v", err)
+
+			return false, nil
+		}
+		for _, name := range images {
+			if name == image {
+				return false, nil
+			}
+		}
+
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("image %s was not removed from cluster %s: %w", imageSpec(pool, image), peerRookNamespace, err)
+	}
+
+	return nil
+}
+
+// waitForResync requests a resync of the volume until it succeeds, and when
+// ready is set, until the volume is reported ready to use.
+func waitForResync(rc *replicationClient, volumeID string, ready bool) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		isReady, err := rc.resyncVolume(volumeID, true)
+		if err != nil {
+			// the image is recreated while it is resynced
+			e2elog.Logf("resync of volume %s not completed: %v", volumeID, err)
+
+			return false, nil
+		}
+
+		return isReady || !ready, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to resync volume %s: %w", volumeID, err)
+	}
+
+	return nil
+}
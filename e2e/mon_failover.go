@@ -0,0 +1,260 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// monPodLabel is the label of the pods of the monitors of Rook, each
+	// monitor has its own deployment.
+	monPodLabel = "app=rook-ceph-mon"
+
+	// monFailoverTimeout bounds the time that the operations which are in
+	// progress while the monitors restart may take, including the retries of
+	// the sidecars and the drivers.
+	monFailoverTimeout = 10 * time.Minute
+)
+
+// monQuorumStatus is the part of the output of "ceph quorum_status" about the
+// monitors that form the quorum.
+type monQuorumStatus struct {
+	Quorum []string `json:"quorum_names"`
+	Leader string   `json:"quorum_leader_name"`
+	MonMap struct {
+		Mons []struct {
+			Name string `json:"name"`
+		} `json:"mons"`
+	} `json:"monmap"`
+}
+
+// mons returns the names of all monitors in the monmap.
+func (s monQuorumStatus) mons() []string {
+	names := make([]string, 0, len(s.MonMap.Mons))
+	for i := range s.MonMap.Mons {
+		names = append(names, s.MonMap.Mons[i].Name)
+	}
+
+	return names
+}
+
+// monsInQuorum is met once all monitors of the monmap are in quorum.
+var monsInQuorum = stateCondition[monQuorumStatus]{
+	name: "in quorum",
+	met: func(s monQuorumStatus) (bool, error) {
+		return len(s.MonMap.Mons) != 0 && len(s.Quorum) == len(s.MonMap.Mons), nil
+	},
+	describe: func(s monQuorumStatus) string {
+		return fmt.Sprintf("quorum [%s] of [%s]", strings.Join(s.Quorum, " "), strings.Join(s.mons(), " "))
+	},
+}
+
+// monsToRestart returns the monitors that are restarted one set after
+// another: the leader alone, which makes the other monitors elect a new
+// leader, and then all monitors at once, which makes the cluster unavailable
+// until they form a quorum again. The leader of a single monitor is all
+// monitors, it is restarted once.
+func monsToRestart(s monQuorumStatus) [][]string {
+	sets := [][]string{{s.Leader}}
+	if len(s.MonMap.Mons) > 1 {
+		sets = append(sets, s.mons())
+	}
+
+	return sets
+}
+
+// getMonQuorumStatus returns the quorum of the monitors. Commands fail while
+// there is no quorum, which is reported as an empty quorum.
+func getMonQuorumStatus(f *framework.Framework) (monQuorumStatus, error) {
+	status, err := cephJSON[monQuorumStatus](f, "ceph quorum_status")
+	if err != nil {
+		e2elog.Logf("failed to get the quorum of the monitors: %v", err)
+
+		return monQuorumStatus{}, nil
+	}
+
+	return status, nil
+}
+
+// restartMons deletes the pods of the monitors, without waiting for the
+// recreated pods.
+func restartMons(mons []string) error {
+	for _, mon := range mons {
+		err := deletePodWithLabel(fmt.Sprintf("%s,mon=%s", monPodLabel, mon), rookNamespace, false)
+		if err != nil {
+			return fmt.Errorf("failed to delete pod of monitor %s: %w", mon, err)
+		}
+	}
+
+	return nil
+}
+
+// waitForMons waits until the deployments of the monitors are complete, and
+// all monitors are in quorum again.
+func waitForMons(f *framework.Framework, mons []string) error {
+	for _, mon := range mons {
+		err := waitForDeploymentComplete(f.ClientSet, "rook-ceph-mon-"+mon, rookNamespace, deployTimeout)
+		if err != nil {
+			return fmt.Errorf("timeout waiting for monitor %s: %w", mon, err)
+		}
+	}
+	_, err := waitForState(
+		"monitors",
+		func() (monQuorumStatus, error) {
+			return getMonQuorumStatus(f)
+		},
+		monsInQuorum,
+		monFailoverTimeout)
+
+	return err
+}
+
+// restartMonsDuring starts the operations, restarts the monitors while they
+// are in progress, and waits for the operations and the monitors. The first
+// error of the operations is returned, or an error when they did not complete
+// within monFailoverTimeout.
+func restartMonsDuring(f *framework.Framework, mons []string, operations ...func() error) error {
+	results := make(chan error, len(operations))
+	start := time.Now()
+	for _, operation := range operations {
+		go func(operation func() error) {
+			results <- operation()
+		}(operation)
+	}
+
+	e2elog.Logf("restarting monitors %v", mons)
+	err := restartMons(mons)
+	var opErr error
+	for range operations {
+		if result := <-results; opErr == nil {
+			opErr = result
+		}
+	}
+	elapsed := time.Since(start)
+	if err != nil {
+		return err
+	}
+	// the specs that follow need the monitors, even if an operation failed
+	err = waitForMons(f, mons)
+	if opErr != nil {
+		return fmt.Errorf("operation failed while restarting monitors %v: %w", mons, opErr)
+	}
+	if err != nil {
+		return err
+	}
+	if elapsed > monFailoverTimeout {
+		return fmt.Errorf("operations took %v while restarting monitors %v, expected at most %v",
+			elapsed.Round(time.Second), mons, monFailoverTimeout)
+	}
+	e2elog.Logf("operations completed in %v while restarting monitors %v", elapsed.Round(time.Second), mons)
+
+	return nil
+}
+
+// loadMonFailoverPVCAndApp returns a PVC and an app that uses it, with the
+// name.
+func loadMonFailoverPVCAndApp(
+	f *framework.Framework,
+	pvcPath, appPath, name string,
+) (*v1.PersistentVolumeClaim, *v1.Pod, error) {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Name = name
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Name = name
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": name}
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+
+	return pvc, app, nil
+}
+
+// validateOperationsDuringMonRestart creates a PVC with an app, and mounts an
+// existing PVC in another app, while the monitors restart. Both apps need to
+// be able to write to their volume afterwards.
+func validateOperationsDuringMonRestart(f *framework.Framework, pvcPath, appPath string, mons []string) error {
+	mountedPVC, mountedApp, err := loadMonFailoverPVCAndApp(f, pvcPath, appPath, "mon-failover-mount")
+	if err != nil {
+		return err
+	}
+	err = createPVCAndvalidatePV(f.ClientSet, mountedPVC, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+	createdPVC, createdApp, err := loadMonFailoverPVCAndApp(f, pvcPath, appPath, "mon-failover-create")
+	if err != nil {
+		return err
+	}
+
+	timeout := int(monFailoverTimeout / time.Minute)
+	err = restartMonsDuring(f, mons,
+		func() error {
+			return createApp(f.ClientSet, mountedApp, timeout)
+		},
+		func() error {
+			return createPVCAndApp("", f, createdPVC, createdApp, timeout)
+		})
+	if err != nil {
+		return err
+	}
+
+	for _, app := range []*v1.Pod{mountedApp, createdApp} {
+		err = newDataset("mon-failover", 2, 64).write(f, app)
+		if err != nil {
+			return fmt.Errorf("failed to write to the volume of %s: %w", app.Name, err)
+		}
+	}
+
+	err = deletePVCAndApp("", f, createdPVC, createdApp)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC and application: %w", err)
+	}
+
+	return deletePVCAndApp("", f, mountedPVC, mountedApp)
+}
+
+// validateMonFailover restarts the leader of the monitors, and then all
+// monitors, while PVCs are created and mounted. The provisioner and the
+// nodeplugin need to retry until the monitors are back, and complete the
+// operations within monFailoverTimeout.
+func validateMonFailover(f *framework.Framework, pvcPath, appPath string) error {
+	status, err := cephJSON[monQuorumStatus](f, "ceph quorum_status")
+	if err != nil {
+		return err
+	}
+	for _, mons := range monsToRestart(status) {
+		err = validateOperationsDuringMonRestart(f, pvcPath, appPath, mons)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
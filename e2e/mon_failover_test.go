@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMonsInQuorum(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		status   string
+		expected bool
+	}{
+		{
+			name: "all monitors in quorum",
+			status: `{"quorum_names": ["a", "b", "c"], "quorum_leader_name": "a",
+				"monmap": {"mons": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}}`,
+			expected: true,
+		},
+		{
+			name: "restarted monitor not in quorum yet",
+			status: `{"quorum_names": ["b", "c"], "quorum_leader_name": "b",
+				"monmap": {"mons": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}}`,
+			expected: false,
+		},
+		{
+			name:     "no quorum",
+			status:   `{}`,
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			var status monQuorumStatus
+			err := json.Unmarshal([]byte(ts.status), &status)
+			if err != nil {
+				t.Fatalf("failed to parse status: %v", err)
+			}
+			met, err := monsInQuorum.met(status)
+			if err != nil {
+				t.Fatalf("monsInQuorum failed: %v", err)
+			}
+			if met != ts.expected {
+				t.Errorf("monsInQuorum = %v, expected %v for %s", met, ts.expected, monsInQuorum.describe(status))
+			}
+		})
+	}
+}
+
+func TestMonsToRestart(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		status   string
+		expected [][]string
+	}{
+		{
+			name: "three monitors",
+			status: `{"quorum_names": ["a", "b", "c"], "quorum_leader_name": "b",
+				"monmap": {"mons": [{"name": "a"}, {"name": "b"}, {"name": "c"}]}}`,
+			expected: [][]string{{"b"}, {"a", "b", "c"}},
+		},
+		{
+			name:     "single monitor",
+			status:   `{"quorum_names": ["a"], "quorum_leader_name": "a", "monmap": {"mons": [{"name": "a"}]}}`,
+			expected: [][]string{{"a"}},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			var status monQuorumStatus
+			err := json.Unmarshal([]byte(ts.status), &status)
+			if err != nil {
+				t.Fatalf("failed to parse status: %v", err)
+			}
+			if got := monsToRestart(status); !reflect.DeepEqual(got, ts.expected) {
+				t.Errorf("monsToRestart() = %v, expected %v", got, ts.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,393 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// secondFilesystem is the CephFS filesystem that is created next to
+	// fileSystemName. Rook names its data pool <name>-replicated.
+	secondFilesystem = "second-fs"
+	// extraRBDPool is the pool that is created next to defaultRBDPool.
+	extraRBDPool = "extra-pool"
+	// missingBackend is the name of a filesystem and pool that do not exist.
+	missingBackend = "does-not-exist"
+
+	errFilesystemNotFound = "volume not found"
+	errInvalidPoolLayout  = "pool layout"
+	errPoolNotFound       = "pool not found"
+)
+
+// backendTestCase is a StorageClass that points at a filesystem or pool of
+// the Ceph cluster.
+type backendTestCase struct {
+	name   string
+	params map[string]string
+	// backend is the filesystem or pool that the volume is stored in
+	backend string
+	// rejected is the error of the provisioner, when the parameters do not
+	// match the Ceph cluster
+	rejected string
+}
+
+// cephFSBackends returns the StorageClasses of the CephFS backend tests,
+// with the second filesystem named fsName.
+func cephFSBackends(fsName string) []backendTestCase {
+	return []backendTestCase{
+		{
+			name:    "second filesystem",
+			params:  map[string]string{"fsName": fsName},
+			backend: fsName,
+		},
+		{
+			name:    "data pool of the second filesystem",
+			params:  map[string]string{"fsName": fsName, "pool": fsName + "-replicated"},
+			backend: fsName,
+		},
+		{
+			name:     "filesystem that does not exist",
+			params:   map[string]string{"fsName": missingBackend},
+			rejected: errFilesystemNotFound,
+		},
+		{
+			name:     "data pool of another filesystem",
+			params:   map[string]string{"fsName": fsName, "pool": fileSystemName + "-replicated"},
+			rejected: errInvalidPoolLayout,
+		},
+	}
+}
+
+// rbdBackends returns the StorageClasses of the RBD backend tests, with the
+// extra pool named pool.
+func rbdBackends(pool string) []backendTestCase {
+	return []backendTestCase{
+		{
+			name:    "extra pool",
+			params:  map[string]string{"pool": pool},
+			backend: pool,
+		},
+		{
+			name:     "pool that does not exist",
+			params:   map[string]string{"pool": missingBackend},
+			rejected: errPoolNotFound,
+		},
+	}
+}
+
+// cephFSStatus is the output of "ceph fs status <name>".
+type cephFSStatus struct {
+	MDSMap []struct {
+		Name  string `json:"name"`
+		State string `json:"state"`
+	} `json:"mdsmap"`
+}
+
+// filesystemActive returns the condition that is met once an MDS of the
+// filesystem is active.
+func filesystemActive() stateCondition[cephFSStatus] {
+	return stateCondition[cephFSStatus]{
+		name: "active",
+		met: func(status cephFSStatus) (bool, error) {
+			for _, mds := range status.MDSMap {
+				if mds.State == "active" {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+		describe: func(status cephFSStatus) string {
+			states := make([]string, 0, len(status.MDSMap))
+			for _, mds := range status.MDSMap {
+				states = append(states, mds.Name+": "+mds.State)
+			}
+
+			return fmt.Sprintf("MDS %v", states)
+		},
+	}
+}
+
+// cephFilesystemManifest returns the CephFilesystem of Rook with one active
+// MDS, and pools without replicas.
+func cephFilesystemManifest(name, namespace string) string {
+	return fmt.Sprintf(`apiVersion: ceph.rook.io/v1
+kind: CephFilesystem
+metadata:
+  name: %s
+  namespace: %s
+spec:
+  metadataPool:
+    replicated:
+      size: 1
+      requireSafeReplicaSize: false
+  dataPools:
+    - name: replicated
+      replicated:
+        size: 1
+        requireSafeReplicaSize: false
+  preserveFilesystemOnDelete: false
+  metadataServer:
+    activeCount: 1
+`, name, namespace)
+}
+
+// createCephFilesystem creates a CephFilesystem in the Rook cluster, and
+// waits until its MDS is active.
+func createCephFilesystem(f *framework.Framework, name string) error {
+	err := retryKubectlInput(rookNamespace, kubectlCreate, cephFilesystemManifest(name, rookNamespace), deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create CephFilesystem %s: %w", name, err)
+	}
+
+	_, err = waitForState(
+		"filesystem "+name,
+		func() (cephFSStatus, error) {
+			return cephJSON[cephFSStatus](f, "ceph fs status "+name)
+		},
+		filesystemActive(),
+		time.Duration(deployTimeout)*time.Minute)
+
+	return err
+}
+
+// deleteCephFilesystem deletes the CephFilesystem, and waits until Rook
+// removed the filesystem from the Ceph cluster.
+func deleteCephFilesystem(f *framework.Framework, name string) error {
+	err := retryKubectlInput(rookNamespace, kubectlDelete, cephFilesystemManifest(name, rookNamespace), deployTimeout,
+		"--ignore-not-found=true")
+	if err != nil {
+		return fmt.Errorf("failed to delete CephFilesystem %s: %w", name, err)
+	}
+
+	return waitForDeletion("filesystem "+name, func() (*cephfsFilesystem, error) {
+		filesystems, listErr := listCephFSFileSystems(f)
+		if listErr != nil {
+			return nil, listErr
+		}
+		for i := range filesystems {
+			if filesystems[i].Name == name {
+				return &filesystems[i], nil
+			}
+		}
+
+		// not listed anymore, the filesystem is deleted
+		return nil, nil
+	}, time.Duration(deployTimeout)*time.Minute)
+}
+
+// validateCephFSBackend creates a PVC with an app in the StorageClass of the
+// test case, and checks that the subvolume is in the filesystem of the test
+// case. The provisioner needs to reject parameters that do not match the
+// Ceph cluster with a precise error.
+func validateCephFSBackend(f *framework.Framework, tc *backendTestCase, pvcPath, appPath string) error {
+	err := createCephfsStorageClass(f.ClientSet, f, false, tc.params)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass: %w", err)
+	}
+	defer func() {
+		scErr := deleteResource(cephFSExamplePath + "storageclass.yaml")
+		if scErr != nil {
+			e2elog.Failf("failed to delete storageclass: %v", scErr)
+		}
+	}()
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	if tc.rejected != "" {
+		return validateRejectedPVC(f, pvc, tc.rejected)
+	}
+
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	ds := newDataset("backend", 2, 64)
+	err = ds.write(f, app)
+	if err != nil {
+		return err
+	}
+	err = ds.verify(f, app)
+	if err != nil {
+		return err
+	}
+	_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return err
+	}
+	err = checkSubvolumeInFilesystem(f, pv, tc.backend)
+	if err != nil {
+		return err
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
+
+// checkSubvolumeInFilesystem checks that the subvolume of the PV is stored in
+// the filesystem.
+func checkSubvolumeInFilesystem(f *framework.Framework, pv *v1.PersistentVolume, fsName string) error {
+	attrs := pv.Spec.CSI.VolumeAttributes
+	if attrs["fsName"] != fsName {
+		return fmt.Errorf("PV %s is in filesystem %q, expected %q", pv.Name, attrs["fsName"], fsName)
+	}
+	subvolumes, err := listCephFSSubVolumes(f, fsName, subvolumegroup)
+	if err != nil {
+		return err
+	}
+	for _, subvolume := range subvolumes {
+		if subvolume.Name == attrs["subvolumeName"] {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("subvolume %s of PV %s not found in filesystem %s", attrs["subvolumeName"], pv.Name, fsName)
+}
+
+// validateCephFSBackends creates a second CephFS filesystem, and provisions
+// volumes with StorageClasses that point at it, or at filesystems and pools
+// that do not match. The default StorageClass is restored afterwards.
+func validateCephFSBackends(f *framework.Framework, pvcPath, appPath string) error {
+	fsName := resourceName(secondFilesystem)
+	err := createCephFilesystem(f, fsName)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		fsErr := deleteCephFilesystem(f, fsName)
+		if fsErr != nil {
+			e2elog.Failf("failed to delete filesystem %s: %v", fsName, fsErr)
+		}
+	}()
+
+	err = deleteResource(cephFSExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete storageclass: %w", err)
+	}
+	defer func() {
+		scErr := createCephfsStorageClass(f.ClientSet, f, false, nil)
+		if scErr != nil {
+			e2elog.Failf("failed to create storageclass: %v", scErr)
+		}
+	}()
+
+	backends := cephFSBackends(fsName)
+	for i := range backends {
+		tc := &backends[i]
+		e2elog.Logf("validating StorageClass with %s", tc.name)
+		err = validateCephFSBackend(f, tc, pvcPath, appPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRBDBackend creates a PVC with an app in a StorageClass with the
+// parameters of the test case, and checks that the image is in the pool of
+// the test case. The provisioner needs to reject parameters that do not
+// match the Ceph cluster with a precise error.
+func validateRBDBackend(f *framework.Framework, tc *backendTestCase, pvcPath, appPath string) error {
+	scName := resourceName("rbd-backend")
+	err := createRBDStorageClass(f.ClientSet, f, scName, nil, tc.params, deletePolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass %s: %w", scName, err)
+	}
+	defer func() {
+		scErr := retryKubectlArgs(cephCSINamespace, kubectlDelete, deployTimeout, "sc", scName, "--ignore-not-found=true")
+		if scErr != nil {
+			e2elog.Failf("failed to delete storageclass %s: %v", scName, scErr)
+		}
+	}()
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.StorageClassName = &scName
+	if tc.rejected != "" {
+		return validateRejectedPVC(f, pvc, tc.rejected)
+	}
+
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	ds := newDataset("backend", 2, 64)
+	err = ds.write(f, app)
+	if err != nil {
+		return err
+	}
+	err = ds.verify(f, app)
+	if err != nil {
+		return err
+	}
+	err = checkPVCImageInPool(f, pvc, tc.backend)
+	if err != nil {
+		return fmt.Errorf("image of PVC %s not in pool %s: %w", pvc.Name, tc.backend, err)
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
+
+// validateRBDBackends creates an extra RBD pool, and provisions volumes with
+// StorageClasses that point at it, or at pools that do not exist.
+func validateRBDBackends(f *framework.Framework, pvcPath, appPath string) error {
+	pool := resourceName(extraRBDPool)
+	err := createRBDPool(f, pool)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		poolErr := deletePool(pool, false, f)
+		if poolErr != nil {
+			e2elog.Failf("failed to delete pool %s: %v", pool, poolErr)
+		}
+	}()
+
+	backends := rbdBackends(pool)
+	for i := range backends {
+		tc := &backends[i]
+		e2elog.Logf("validating StorageClass with %s", tc.name)
+		err = validateRBDBackend(f, tc, pvcPath, appPath)
+		if err != nil {
+			return fmt.Errorf("%s: %w", tc.name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestFilesystemActive(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		status   string
+		expected bool
+	}{
+		{
+			name: "active MDS",
+			status: `{"mdsmap": [{"name": "second-fs-a", "state": "active"},
+				{"name": "second-fs-b", "state": "standby-replay"}]}`,
+			expected: true,
+		},
+		{
+			name:     "MDS replaying the journal",
+			status:   `{"mdsmap": [{"name": "second-fs-a", "state": "replay"}]}`,
+			expected: false,
+		},
+		{
+			name:     "no MDS",
+			status:   `{"mdsmap": []}`,
+			expected: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			var status cephFSStatus
+			err := json.Unmarshal([]byte(ts.status), &status)
+			if err != nil {
+				t.Fatalf("failed to parse status: %v", err)
+			}
+			met, err := filesystemActive().met(status)
+			if err != nil {
+				t.Fatalf("filesystemActive() failed: %v", err)
+			}
+			if met != ts.expected {
+				t.Errorf("filesystemActive() = %v, expected %v for %s", met, ts.expected,
+					filesystemActive().describe(status))
+			}
+		})
+	}
+}
+
+func TestBackendTestCases(t *testing.T) {
+	t.Parallel()
+	for _, tc := range append(cephFSBackends("second-fs"), rbdBackends("extra-pool")...) {
+		if (tc.backend == "") == (tc.rejected == "") {
+			t.Errorf("%s needs either a backend or an error of the provisioner", tc.name)
+		}
+	}
+}
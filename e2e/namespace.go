@@ -92,5 +92,7 @@ func replaceNamespaceInTemplate(filePath string) (string, error) {
 		return "", err
 	}
 
-	return strings.ReplaceAll(string(read), "namespace: default", fmt.Sprintf("namespace: %s", cephCSINamespace)), nil
+	data := strings.ReplaceAll(string(read), "namespace: default", fmt.Sprintf("namespace: %s", cephCSINamespace))
+
+	return replaceResourceNamesInTemplate(data), nil
 }
@@ -0,0 +1,524 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// fenceTestCIDR is in TEST-NET-1 (RFC 5737), there are no clients with
+	// an address in it.
+	fenceTestCIDR = "192.0.2.10/32"
+
+	// kubeletOutage is the time that the kubelet of a failed node is
+	// stopped. The kubelet is started again by systemd, also when the test
+	// fails or is aborted.
+	kubeletOutage = 5 * time.Minute
+	// kubeletOutageUnit is the transient systemd unit that stops and starts
+	// the kubelet.
+	kubeletOutageUnit = "ceph-csi-e2e-kubelet-outage"
+
+	nodeHostnameLabel = "kubernetes.io/hostname"
+)
+
+// blocklistEntry is an entry of "ceph osd blocklist ls".
+type blocklistEntry struct {
+	Addr  string `json:"addr"`
+	Until string `json:"until"`
+}
+
+// parseBlocklist returns the addresses in the JSON output of "ceph osd
+// blocklist ls".
+func parseBlocklist(data []byte) ([]string, error) {
+	var entries []blocklistEntry
+	err := json.Unmarshal(data, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse blocklist %q: %w", string(data), err)
+	}
+	addrs := make([]string, 0, len(entries))
+	for i := range entries {
+		addrs = append(addrs, entries[i].Addr)
+	}
+	sort.Strings(addrs)
+
+	return addrs, nil
+}
+
+// isBlocklisted returns whether a client with the IP address is blocklisted.
+// The addresses in the blocklist are formatted like "<ip>:<port>/<nonce>",
+// an IPv6 address is in brackets.
+func isBlocklisted(addrs []string, ip string) bool {
+	for _, addr := range addrs {
+		if strings.HasPrefix(addr, ip+":") || strings.HasPrefix(addr, "["+ip+"]:") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// listBlocklist returns the blocklisted addresses of the cluster, with the
+// verification client, or with the Rook toolbox.
+func listBlocklist(f *framework.Framework) ([]string, error) {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return nil, err
+	}
+	if cv != nil {
+		return cv.listBlocklist()
+	}
+
+	stdOut, stdErr, err := execCommandInToolBoxPod(f, "ceph osd blocklist ls -f json", rookNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blocklist: %w, stdErr: %s", err, stdErr)
+	}
+	// the number of entries is reported on stderr
+	if stdErr != "" && !strings.HasPrefix(stdErr, "listed ") {
+		return nil, fmt.Errorf("failed to list blocklist: %s", stdErr)
+	}
+
+	return parseBlocklist([]byte(stdOut))
+}
+
+// ipBlocklisted is met once the clients with the IP address are, or are not,
+// blocklisted.
+func ipBlocklisted(ip string, listed bool) stateCondition[[]string] {
+	name := "blocklisted"
+	if !listed {
+		name = "removed from the blocklist"
+	}
+
+	return stateCondition[[]string]{
+		name: name,
+		met: func(addrs []string) (bool, error) {
+			return isBlocklisted(addrs, ip) == listed, nil
+		},
+		describe: func(addrs []string) string {
+			return fmt.Sprintf("blocklist %v", addrs)
+		},
+	}
+}
+
+// waitForBlocklist waits until the clients with the IP address are, or are
+// not, blocklisted.
+func waitForBlocklist(f *framework.Framework, ip string, listed bool) error {
+	_, err := waitForState(
+		"IP "+ip,
+		func() ([]string, error) {
+			return listBlocklist(f)
+		},
+		ipBlocklisted(ip, listed),
+		time.Duration(deployTimeout)*time.Minute)
+
+	return err
+}
+
+// nodeReady returns the condition that is met once the kubelet of the node
+// does, or does not, report that the node is ready.
+func nodeReady(ready bool) stateCondition[*v1.Node] {
+	name := "ready"
+	if !ready {
+		name = "not ready"
+	}
+
+	return stateCondition[*v1.Node]{
+		name: name,
+		met: func(node *v1.Node) (bool, error) {
+			return isNodeReady(node) == ready, nil
+		},
+		describe: func(node *v1.Node) string {
+			for _, cond := range node.Status.Conditions {
+				if cond.Type == v1.NodeReady {
+					return fmt.Sprintf("ready %q, reason %q: %s", cond.Status, cond.Reason, cond.Message)
+				}
+			}
+
+			return "no ready condition"
+		},
+	}
+}
+
+// isNodeReady returns whether the node reports that it is ready.
+func isNodeReady(node *v1.Node) bool {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type == v1.NodeReady {
+			return cond.Status == v1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+// waitForNodeReady waits until the node is, or is not, ready.
+func waitForNodeReady(f *framework.Framework, name string, ready bool, timeout time.Duration) error {
+	_, err := waitForState(
+		"node "+name,
+		func() (*v1.Node, error) {
+			return f.ClientSet.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+		},
+		nodeReady(ready),
+		timeout)
+
+	return err
+}
+
+// nodeInternalIP returns the internal IP address of the node.
+func nodeInternalIP(node *v1.Node) (string, error) {
+	for _, addr := range node.Status.Addresses {
+		if addr.Type == v1.NodeInternalIP {
+			return addr.Address, nil
+		}
+	}
+
+	return "", fmt.Errorf("node %s does not have an internal IP address", node.Name)
+}
+
+// setNodeUnschedulable cordons or uncordons the node.
+func setNodeUnschedulable(f *framework.Framework, name string, unschedulable bool) error {
+	node, err := f.ClientSet.CoreV1().Nodes().Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", name, err)
+	}
+	node.Spec.Unschedulable = unschedulable
+	_, err = f.ClientSet.CoreV1().Nodes().Update(context.TODO(), node, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update node %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// stopKubelet stops the kubelet of the node for the kubeletOutage, which
+// lets the node fail from the point of view of Kubernetes, while the kernel
+// RBD clients of the node keep running. The command is executed in the host
+// namespaces through the privileged nodeplugin of the node.
+func stopKubelet(f *framework.Framework, node string) error {
+	cmd := fmt.Sprintf("nsenter --target 1 --mount --uts --ipc --net --pid -- "+
+		"systemd-run --unit=%s --collect sh -c 'systemctl stop kubelet; sleep %d; systemctl start kubelet'",
+		kubeletOutageUnit, int(kubeletOutage.Seconds()))
+	stdErr, err := execCommandInDaemonsetPod(f, cmd, rbdDaemonsetName, node, "csi-rbdplugin", cephCSINamespace)
+	if err != nil {
+		return fmt.Errorf("failed to stop kubelet on node %s: %w, stdErr: %s", node, err, stdErr)
+	}
+
+	return nil
+}
+
+// pickFailoverNodes returns a node that can fail, and a node for the
+// replacement pod. The failed node can not run the pods that the test
+// executes commands in, like the provisioner and the toolbox, because the
+// exec API is served by the kubelet. Empty names are returned if the cluster
+// does not have the nodes.
+func pickFailoverNodes(f *framework.Framework) (string, string, error) {
+	nodes, err := f.ClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to list nodes: %w", err)
+	}
+	selector, err := getDeploymentLabelSelector(f, cephCSINamespace, rbdDeploymentName)
+	if err != nil {
+		return "", "", err
+	}
+	busy := map[string]bool{}
+	for _, pods := range []struct{ ns, selector string }{
+		{cephCSINamespace, selector},
+		{rookNamespace, rookToolBoxPodLabel},
+	} {
+		list, listErr := listPods(f, pods.ns, &metav1.ListOptions{LabelSelector: pods.selector})
+		if listErr != nil {
+			return "", "", fmt.Errorf("failed to list pods with %s: %w", pods.selector, listErr)
+		}
+		for i := range list {
+			busy[list[i].Spec.NodeName] = true
+		}
+	}
+
+	var failing, replacement string
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if node.Spec.Unschedulable || !isNodeReady(node) {
+			continue
+		}
+		if failing == "" && !busy[node.Name] {
+			failing = node.Name
+
+			continue
+		}
+		if replacement == "" {
+			replacement = node.Name
+		}
+	}
+	if failing == "" || replacement == "" {
+		return "", "", nil
+	}
+
+	return failing, replacement, nil
+}
+
+// forceDeleteApp deletes the pod of a failed node without waiting for the
+// kubelet, and removes the VolumeAttachment of the PV on the node.
+func forceDeleteApp(f *framework.Framework, app *v1.Pod, pvName string) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	pods := f.ClientSet.CoreV1().Pods(app.Namespace)
+	err := pods.Delete(context.TODO(), app.Name, *metav1.NewDeleteOptions(0))
+	if err != nil {
+		return fmt.Errorf("failed to delete application %s: %w", app.Name, err)
+	}
+	err = waitForDeletion("pod "+app.Name, func() (*v1.Pod, error) {
+		return pods.Get(context.TODO(), app.Name, metav1.GetOptions{})
+	}, timeout)
+	if err != nil {
+		return err
+	}
+
+	vas := f.ClientSet.StorageV1().VolumeAttachments()
+	list, err := vas.List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list VolumeAttachments: %w", err)
+	}
+	for i := range list.Items {
+		va := &list.Items[i]
+		if va.Spec.NodeName != app.Spec.NodeName || va.Spec.Source.PersistentVolumeName == nil ||
+			*va.Spec.Source.PersistentVolumeName != pvName {
+			continue
+		}
+		err = vas.Delete(context.TODO(), va.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to delete VolumeAttachment %s: %w", va.Name, err)
+		}
+		err = waitForDeletion("VolumeAttachment "+va.Name, func() (*storagev1.VolumeAttachment, error) {
+			return vas.Get(context.TODO(), va.Name, metav1.GetOptions{})
+		}, timeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateNetworkFence fences a CIDR block through the CSI-Addons server of
+// the provisioner, and checks that the IP address is blocklisted until the
+// CIDR block is unfenced again.
+func validateNetworkFence(f *framework.Framework) error {
+	clusterID, err := getClusterID(f)
+	if err != nil {
+		return fmt.Errorf("failed to get clusterID: %w", err)
+	}
+	fc, err := newFenceClient(f)
+	if err != nil {
+		return err
+	}
+	defer fc.Close()
+
+	ip := strings.TrimSuffix(fenceTestCIDR, "/32")
+	err = fc.fenceClusterNetwork(clusterID, []string{fenceTestCIDR})
+	if err != nil {
+		return fmt.Errorf("failed to fence %s: %w", fenceTestCIDR, err)
+	}
+	err = waitForBlocklist(f, ip, true)
+	if err != nil {
+		return err
+	}
+	err = fc.unfenceClusterNetwork(clusterID, []string{fenceTestCIDR})
+	if err != nil {
+		return fmt.Errorf("failed to unfence %s: %w", fenceTestCIDR, err)
+	}
+
+	return waitForBlocklist(f, ip, false)
+}
+
+// validateNodeFailover simulates the failure of the node of an app with a
+// ReadWriteOnce PVC. The node is cordoned and its kubelet is stopped, and its
+// IP address is fenced, so that its kernel RBD client can not write to the
+// image anymore. A replacement app on another node needs to take over the
+// volume with the data that the first app wrote. The node is unfenced and
+// uncordoned once its kubelet is back.
+func validateNodeFailover(f *framework.Framework, pvcPath, appPath string) error {
+	failing, replacement, err := pickFailoverNodes(f)
+	if err != nil {
+		return err
+	}
+	if failing == "" {
+		e2elog.Logf("skipping node failover, there are no two ready nodes without the provisioner and toolbox")
+
+		return nil
+	}
+	e2elog.Logf("failing node %s, replacement node %s", failing, replacement)
+
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	app.Spec.NodeSelector = map[string]string{nodeHostnameLabel: failing}
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	app, err = f.ClientSet.CoreV1().Pods(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get application: %w", err)
+	}
+	data := newDataset("failover", 4, 1024)
+	err = data.write(f, app)
+	if err != nil {
+		return err
+	}
+
+	_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return fmt.Errorf("failed to get PV: %w", err)
+	}
+	node, err := f.ClientSet.CoreV1().Nodes().Get(context.TODO(), failing, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get node %s: %w", failing, err)
+	}
+	ip, err := nodeInternalIP(node)
+	if err != nil {
+		return err
+	}
+	cidr := ip + "/32"
+	if strings.Contains(ip, ":") {
+		cidr = ip + "/128"
+	}
+	clusterID := pv.Spec.CSI.VolumeAttributes["clusterID"]
+
+	err = setNodeUnschedulable(f, failing, true)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nodeErr := setNodeUnschedulable(f, failing, false)
+		if nodeErr != nil {
+			e2elog.Failf("failed to uncordon node %s: %v", failing, nodeErr)
+		}
+	}()
+	err = stopKubelet(f, failing)
+	if err != nil {
+		return err
+	}
+	recovered := false
+	recoveryTimeout := kubeletOutage + time.Duration(deployTimeout)*time.Minute
+	defer func() {
+		if recovered {
+			return
+		}
+		nodeErr := waitForNodeReady(f, failing, true, recoveryTimeout)
+		if nodeErr != nil {
+			e2elog.Failf("node %s did not recover: %v", failing, nodeErr)
+		}
+	}()
+	err = waitForNodeReady(f, failing, false, time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	fc, err := newFenceClient(f)
+	if err != nil {
+		return err
+	}
+	defer fc.Close()
+	err = fc.fenceClusterNetwork(clusterID, []string{cidr})
+	if err != nil {
+		return fmt.Errorf("failed to fence node %s: %w", failing, err)
+	}
+	fenced := true
+	defer func() {
+		if !fenced {
+			return
+		}
+		fenceErr := fc.unfenceClusterNetwork(clusterID, []string{cidr})
+		if fenceErr != nil {
+			e2elog.Failf("failed to unfence node %s: %v", failing, fenceErr)
+		}
+	}()
+	err = waitForBlocklist(f, ip, true)
+	if err != nil {
+		return err
+	}
+
+	err = forceDeleteApp(f, app, pv.Name)
+	if err != nil {
+		return err
+	}
+	app, err = loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Name += "-replacement"
+	app.Namespace = f.UniqueName
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+	app.Spec.NodeSelector = map[string]string{nodeHostnameLabel: replacement}
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("replacement application did not take over the volume: %w", err)
+	}
+	err = data.verify(f, app)
+	if err != nil {
+		return err
+	}
+	err = data.write(f, app)
+	if err != nil {
+		return fmt.Errorf("replacement application can not write to the volume: %w", err)
+	}
+
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete replacement application: %w", err)
+	}
+
+	// the kubelet of the failed node unmaps the image of the deleted app
+	// once it is back, which needs the node to be unfenced
+	err = fc.unfenceClusterNetwork(clusterID, []string{cidr})
+	if err != nil {
+		return fmt.Errorf("failed to unfence node %s: %w", failing, err)
+	}
+	fenced = false
+	err = waitForBlocklist(f, ip, false)
+	if err != nil {
+		return err
+	}
+	err = waitForNodeReady(f, failing, true, recoveryTimeout)
+	if err != nil {
+		return fmt.Errorf("node %s did not recover: %w", failing, err)
+	}
+	recovered = true
+
+	err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestIsBlocklisted(t *testing.T) {
+	t.Parallel()
+	data := `[{"addr":"192.168.39.10:0/3710147553","until":"2022-09-01T10:00:00.000000+0000"},` +
+		`{"addr":"192.0.2.10:0/0","until":"2027-09-01T10:00:00.000000+0000"},` +
+		`{"addr":"[fd00::10]:0/0","until":"2027-09-01T10:00:00.000000+0000"}]`
+	addrs, err := parseBlocklist([]byte(data))
+	if err != nil {
+		t.Fatalf("parseBlocklist() failed: %v", err)
+	}
+
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"192.0.2.10", true},
+		{"192.168.39.10", true},
+		{"192.0.2.1", false},
+		{"fd00::10", true},
+		{"fd00::1", false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.ip, func(t *testing.T) {
+			t.Parallel()
+			if got := isBlocklisted(addrs, ts.ip); got != ts.want {
+				t.Errorf("isBlocklisted(%v, %s) = %t, want %t", addrs, ts.ip, got, ts.want)
+			}
+		})
+	}
+
+	_, err = parseBlocklist([]byte("listed 0 entries"))
+	if err == nil {
+		t.Error("parseBlocklist() of invalid output did not fail")
+	}
+}
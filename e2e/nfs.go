@@ -45,6 +45,10 @@ var (
 	nfsDirPath         = "../deploy/nfs/kubernetes/"
 	nfsExamplePath     = examplePath + "nfs/"
 	nfsPoolName        = ".nfs"
+	nfsClusterName     = "my-nfs"
+	// nfsServerName is the deployment that Rook creates for the first
+	// NFS-Ganesha server of the CephNFS object.
+	nfsServerName = "rook-ceph-nfs-" + nfsClusterName + "-a"
 
 	// FIXME: some tests change the subvolumegroup to "e2e".
 	defaultSubvolumegroup = "csi"
@@ -140,8 +144,8 @@ func createNFSStorageClass(
 	if err != nil {
 		return err
 	}
-	sc.Parameters["nfsCluster"] = "my-nfs"
-	sc.Parameters["server"] = "rook-ceph-nfs-my-nfs-a." + rookNamespace + ".svc.cluster.local"
+	sc.Parameters["nfsCluster"] = nfsClusterName
+	sc.Parameters["server"] = nfsServerName + "." + rookNamespace + ".svc.cluster.local"
 
 	// standard CephFS parameters
 	sc.Parameters["fsName"] = fileSystemName
@@ -237,6 +241,8 @@ func unmountNFSVolume(f *framework.Framework, appName, pvcName string) error {
 var _ = Describe("nfs", func() {
 	f := framework.NewDefaultFramework("nfs")
 	var c clientset.Interface
+	var leakDetector *journalLeakDetector
+	var reaper *orphanReaper
 	// deploy CephFS CSI
 	BeforeEach(func() {
 		if !testNFS || upgradeTesting || helmTest {
@@ -254,7 +260,7 @@ var _ = Describe("nfs", func() {
 		}
 
 		// cephfs testing might have changed the default subvolumegroup
-		subvolumegroup = defaultSubvolumegroup
+		subvolumegroup = resourceName(defaultSubvolumegroup)
 		err := createConfigMap(nfsDirPath, f.ClientSet, f)
 		if err != nil {
 			e2elog.Failf("failed to create configmap: %v", err)
@@ -277,6 +283,40 @@ var _ = Describe("nfs", func() {
 		if err != nil {
 			e2elog.Failf("failed to create node secret: %v", err)
 		}
+
+		metadataPool, err := getCephFSMetadataPoolName(f, fileSystemName)
+		if err != nil {
+			e2elog.Failf("failed getting cephFS metadata pool name: %v", err)
+		}
+		leakDetector, err = newJournalLeakDetector(f, cephfsType, metadataPool)
+		if err != nil {
+			e2elog.Failf("failed to count journal entries: %v", err)
+		}
+		reaper = newOrphanReaper(cephfsType, metadataPool)
+	})
+
+	// JustAfterEach runs before the framework deletes the namespace of the
+	// spec and its clientset
+	JustAfterEach(func() {
+		if !testNFS || upgradeTesting || helmTest {
+			return
+		}
+		if CurrentGinkgoTestDescription().Failed {
+			if reaper != nil {
+				err := reaper.reap(f)
+				if err != nil {
+					e2elog.Failf("failed to remove the resources of the failed spec: %v", err)
+				}
+			}
+
+			return
+		}
+		if leakDetector != nil {
+			err := leakDetector.check(f)
+			if err != nil {
+				e2elog.Failf("%v", err)
+			}
+		}
 	})
 
 	AfterEach(func() {
@@ -392,13 +432,13 @@ var _ = Describe("nfs", func() {
 				if err != nil {
 					e2elog.Failf("failed to create application: %v", err)
 				}
-				validateSubvolumeCount(f, 1, fileSystemName, defaultSubvolumegroup)
+				validateSubvolumeCount(f, 1, fileSystemName, subvolumegroup)
 
 				err = validateRWOPPodCreation(f, pvc, app, baseAppName)
 				if err != nil {
 					e2elog.Failf("failed to validate RWOP pod creation: %v", err)
 				}
-				validateSubvolumeCount(f, 0, fileSystemName, defaultSubvolumegroup)
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
 				err = deleteResource(nfsExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete NFS storageclass: %v", err)
@@ -458,13 +498,13 @@ var _ = Describe("nfs", func() {
 					if err != nil {
 						e2elog.Failf("failed to create PVC or application: %v", err)
 					}
-					err = validateSubvolumePath(f, pvc.Name, pvc.Namespace, fileSystemName, defaultSubvolumegroup)
+					err = validateSubvolumePath(f, pvc.Name, pvc.Namespace, fileSystemName, subvolumegroup)
 					if err != nil {
 						e2elog.Failf("failed to validate subvolumePath: %v", err)
 					}
 				}
 
-				validateSubvolumeCount(f, totalCount, fileSystemName, defaultSubvolumegroup)
+				validateSubvolumeCount(f, totalCount, fileSystemName, subvolumegroup)
 				// delete PVC and app
 				for i := 0; i < totalCount; i++ {
 					name := fmt.Sprintf("%s%d", f.UniqueName, i)
@@ -474,7 +514,7 @@ var _ = Describe("nfs", func() {
 					}
 
 				}
-				validateSubvolumeCount(f, 0, fileSystemName, defaultSubvolumegroup)
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
 			})
 
 			By("check data persist after recreating pod", func() {
@@ -548,17 +588,6 @@ var _ = Describe("nfs", func() {
 				}
 			})
 
-			// delete nfs provisioner secret
-			err := deleteCephUser(f, keyringCephFSProvisionerUsername)
-			if err != nil {
-				e2elog.Failf("failed to delete user %s: %v", keyringCephFSProvisionerUsername, err)
-			}
-			// delete nfs plugin secret
-			err = deleteCephUser(f, keyringCephFSNodePluginUsername)
-			if err != nil {
-				e2elog.Failf("failed to delete user %s: %v", keyringCephFSNodePluginUsername, err)
-			}
-
 			By("Resize PVC and check application directory size", func() {
 				err := resizePVCAndValidateSize(pvcPath, appPath, f)
 				if err != nil {
@@ -566,6 +595,29 @@ var _ = Describe("nfs", func() {
 				}
 			})
 
+			By("create a ReadWriteMany PVC and read and write it from multiple apps", func() {
+				err := validateNFSMultiPodIO(f, pvcPath, appPath, 3)
+				if err != nil {
+					e2elog.Failf("failed to validate IO of multiple apps: %v", err)
+				}
+			})
+
+			By("validate the NFS-export of a PVC with custom StorageClass parameters", func() {
+				err := validateNFSExportParameters(f, map[string]string{
+					"volumeNamePrefix": "nfs-e2e-",
+				}, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate NFS-export: %v", err)
+				}
+			})
+
+			By("restart the NFS-server and check the IO of an app recovers", func() {
+				err := validateNFSServerRestart(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate NFS-server restart: %v", err)
+				}
+			})
+
 			By("create a PVC clone and bind it to an app", func() {
 				var wg sync.WaitGroup
 				totalCount := 3
@@ -0,0 +1,314 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// nfsServerLabel selects the pods of the NFS-Ganesha servers of the CephNFS
+// object.
+var nfsServerLabel = "app=rook-ceph-nfs,ceph_nfs=" + nfsClusterName
+
+// nfsExport is an NFS-export as listed by "ceph nfs export ls --detailed".
+type nfsExport struct {
+	Pseudo string `json:"pseudo"`
+	Path   string `json:"path"`
+	FSAL   struct {
+		Name   string `json:"name"`
+		FSName string `json:"fs_name"`
+	} `json:"fsal"`
+}
+
+// listNFSExports returns the NFS-exports of the NFS-cluster.
+func listNFSExports(f *framework.Framework, nfsCluster string) ([]nfsExport, error) {
+	cmd := fmt.Sprintf("ceph nfs export ls %s --detailed --format=json", nfsCluster)
+	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list NFS-exports: %w, stdErr: %s", err, stdErr)
+	}
+	if stdErr != "" {
+		return nil, fmt.Errorf("failed to list NFS-exports: %s", stdErr)
+	}
+
+	return parseNFSExports(stdOut)
+}
+
+// parseNFSExports parses the JSON output of "ceph nfs export ls --detailed".
+func parseNFSExports(data string) ([]nfsExport, error) {
+	var exports []nfsExport
+	err := json.Unmarshal([]byte(data), &exports)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse NFS-exports %q: %w", data, err)
+	}
+
+	return exports, nil
+}
+
+// findNFSExport returns the NFS-export with the pseudo path, or nil when
+// there is none.
+func findNFSExport(exports []nfsExport, pseudo string) *nfsExport {
+	for i := range exports {
+		if exports[i].Pseudo == pseudo {
+			return &exports[i]
+		}
+	}
+
+	return nil
+}
+
+// checkNFSExport verifies that the NFS-export of a volume exports the path
+// of its subvolume through CephFS.
+func checkNFSExport(exports []nfsExport, share, path, fsName string) error {
+	export := findNFSExport(exports, share)
+	if export == nil {
+		return fmt.Errorf("NFS-export %s does not exist", share)
+	}
+	if export.Path != path {
+		return fmt.Errorf("NFS-export %s has path %q, expected %q", share, export.Path, path)
+	}
+	if export.FSAL.Name != "CEPH" || export.FSAL.FSName != fsName {
+		return fmt.Errorf("NFS-export %s uses FSAL %s with filesystem %q, expected CEPH with filesystem %q",
+			share, export.FSAL.Name, export.FSAL.FSName, fsName)
+	}
+
+	return nil
+}
+
+// validateNFSExport checks that the NFS-export of the PV of the PVC exists,
+// and that the volume attributes of the PV match the parameters of the
+// StorageClass. It returns the pseudo path of the NFS-export.
+func validateNFSExport(
+	f *framework.Framework,
+	pvc *v1.PersistentVolumeClaim,
+	params map[string]string,
+) (string, error) {
+	_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return "", fmt.Errorf("failed to get PV: %w", err)
+	}
+	attrs := pv.Spec.CSI.VolumeAttributes
+	for key, value := range params {
+		if attrs[key] != value {
+			return "", fmt.Errorf("PV %s has attribute %s=%q, expected %q", pv.Name, key, attrs[key], value)
+		}
+	}
+	if prefix, ok := params["volumeNamePrefix"]; ok && !strings.HasPrefix(attrs["subvolumeName"], prefix) {
+		return "", fmt.Errorf("subvolume %s of PV %s does not have prefix %q", attrs["subvolumeName"], pv.Name, prefix)
+	}
+
+	exports, err := listNFSExports(f, attrs["nfsCluster"])
+	if err != nil {
+		return "", err
+	}
+	err = checkNFSExport(exports, attrs["share"], attrs["subvolumePath"], attrs["fsName"])
+	if err != nil {
+		return "", err
+	}
+
+	return attrs["share"], nil
+}
+
+// validateNFSExportParameters creates a PVC with the StorageClass parameters
+// for an app, and checks the NFS-export of the volume. The NFS-export should
+// be removed together with the PVC.
+func validateNFSExportParameters(f *framework.Framework, params map[string]string, pvcPath, appPath string) error {
+	err := deleteResource(nfsExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete NFS storageclass: %w", err)
+	}
+	defer func() {
+		scErr := deleteResource(nfsExamplePath + "storageclass.yaml")
+		if scErr != nil {
+			e2elog.Failf("failed to delete NFS storageclass: %v", scErr)
+		}
+		scErr = createNFSStorageClass(f.ClientSet, f, false, nil)
+		if scErr != nil {
+			e2elog.Failf("failed to create NFS storageclass: %v", scErr)
+		}
+	}()
+	err = createNFSStorageClass(f.ClientSet, f, true, params)
+	if err != nil {
+		return fmt.Errorf("failed to create NFS storageclass: %w", err)
+	}
+
+	pvc, app, err := createPVCAndAppBinding(pvcPath, appPath, f, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC or application: %w", err)
+	}
+	share, err := validateNFSExport(f, pvc, params)
+	if err != nil {
+		return err
+	}
+	err = deletePVCAndApp("", f, pvc, app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC or application: %w", err)
+	}
+
+	exports, err := listNFSExports(f, nfsClusterName)
+	if err != nil {
+		return err
+	}
+	if findNFSExport(exports, share) != nil {
+		return fmt.Errorf("NFS-export %s still exists after deleting PVC %s", share, pvc.Name)
+	}
+
+	return nil
+}
+
+// validateNFSMultiPodIO creates a ReadWriteMany PVC for several apps. Every
+// app writes a file, which needs to be readable by all other apps.
+func validateNFSMultiPodIO(f *framework.Framework, pvcPath, appPath string, count int) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{v1.ReadWriteMany}
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+
+	apps := make([]*v1.Pod, 0, count)
+	for i := 0; i < count; i++ {
+		app, loadErr := loadApp(appPath)
+		if loadErr != nil {
+			return fmt.Errorf("failed to load application: %w", loadErr)
+		}
+		app.Name = fmt.Sprintf("%s-%d", app.Name, i)
+		app.Namespace = f.UniqueName
+		app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+		err = createApp(f.ClientSet, app, deployTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to create application %s: %w", app.Name, err)
+		}
+		apps = append(apps, app)
+	}
+
+	for _, app := range apps {
+		filePath := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/" + app.Name
+		cmd := fmt.Sprintf("echo %s > %s", app.Name, filePath)
+		_, stdErr, execErr := execCommandInPodWithName(f, cmd, app.Name, app.Spec.Containers[0].Name, app.Namespace)
+		if execErr != nil || stdErr != "" {
+			return fmt.Errorf("failed to write %s in application %s: %v, stdErr: %s", filePath, app.Name, execErr, stdErr)
+		}
+	}
+	for _, writer := range apps {
+		for _, reader := range apps {
+			filePath := reader.Spec.Containers[0].VolumeMounts[0].MountPath + "/" + writer.Name
+			stdOut, stdErr, execErr := execCommandInPodWithName(
+				f,
+				"cat "+filePath,
+				reader.Name,
+				reader.Spec.Containers[0].Name,
+				reader.Namespace)
+			if execErr != nil || stdErr != "" {
+				return fmt.Errorf("failed to read %s in application %s: %v, stdErr: %s",
+					filePath, reader.Name, execErr, stdErr)
+			}
+			if strings.TrimSpace(stdOut) != writer.Name {
+				return fmt.Errorf("application %s read %q from %s, expected %q",
+					reader.Name, stdOut, filePath, writer.Name)
+			}
+		}
+	}
+
+	for _, app := range apps {
+		err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+		if err != nil {
+			return fmt.Errorf("failed to delete application %s: %w", app.Name, err)
+		}
+	}
+	err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+
+	return nil
+}
+
+// restartNFSServer deletes the pods of the NFS-Ganesha server, and waits
+// until the recreated pods are running.
+func restartNFSServer(f *framework.Framework) error {
+	err := deletePodWithLabel(nfsServerLabel, rookNamespace, false)
+	if err != nil {
+		return fmt.Errorf("failed to delete pods of NFS-server %s: %w", nfsServerName, err)
+	}
+	err = waitForDeploymentComplete(f.ClientSet, nfsServerName, rookNamespace, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for NFS-server %s: %w", nfsServerName, err)
+	}
+
+	return nil
+}
+
+// validateNFSServerRestart writes a file in an app, and restarts the
+// NFS-Ganesha server. The NFS-client of the app reconnects once the server
+// is back and its grace period ended, after which the file is expected to be
+// readable and new files can be written.
+func validateNFSServerRestart(f *framework.Framework, pvcPath, appPath string) error {
+	pvc, app, err := createPVCAndAppBinding(pvcPath, appPath, f, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC or application: %w", err)
+	}
+	container := app.Spec.Containers[0]
+	mountPath := container.VolumeMounts[0].MountPath
+	cmd := fmt.Sprintf("echo before > %s/before", mountPath)
+	_, stdErr, err := execCommandInPodWithName(f, cmd, app.Name, container.Name, app.Namespace)
+	if err != nil || stdErr != "" {
+		return fmt.Errorf("failed to write file before NFS-server restart: %v, stdErr: %s", err, stdErr)
+	}
+
+	err = restartNFSServer(f)
+	if err != nil {
+		return err
+	}
+
+	// the IO blocks until the NFS-server is back, so retry with a timeout
+	// instead of hanging in a single exec
+	cmd = fmt.Sprintf("timeout 60 sh -c 'cat %[1]s/before && echo after > %[1]s/after && cat %[1]s/after'", mountPath)
+	timeout := time.Duration(deployTimeout) * time.Minute
+	err = wait.PollImmediate(poll, timeout, func() (bool, error) {
+		stdOut, stdErr, execErr := execCommandInPodWithName(f, cmd, app.Name, container.Name, app.Namespace)
+		if execErr != nil || stdErr != "" {
+			e2elog.Logf("IO after NFS-server restart failed: %v, stdErr: %s", execErr, stdErr)
+
+			return false, nil
+		}
+
+		return strings.Join(strings.Fields(stdOut), " ") == "before after", nil
+	})
+	if err != nil {
+		return fmt.Errorf("IO did not recover after NFS-server restart: %w", err)
+	}
+
+	err = deletePVCAndApp("", f, pvc, app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC or application: %w", err)
+	}
+
+	return nil
+}
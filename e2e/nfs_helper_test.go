@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestCheckNFSExport(t *testing.T) {
+	t.Parallel()
+	exports, err := parseNFSExports(`[
+		{
+			"export_id": 1,
+			"path": "/volumes/csi/csi-vol-1111/2222",
+			"cluster_id": "my-nfs",
+			"pseudo": "/0001-1111",
+			"fsal": {"name": "CEPH", "user_id": "nfs.my-nfs.1", "fs_name": "myfs"}
+		},
+		{
+			"export_id": 2,
+			"path": "/",
+			"pseudo": "/rgw",
+			"fsal": {"name": "RGW"}
+		}
+	]`)
+	if err != nil {
+		t.Fatalf("parseNFSExports() failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		share   string
+		path    string
+		fsName  string
+		wantErr bool
+	}{
+		{
+			name:   "matching export",
+			share:  "/0001-1111",
+			path:   "/volumes/csi/csi-vol-1111/2222",
+			fsName: "myfs",
+		},
+		{
+			name:    "missing export",
+			share:   "/0001-3333",
+			path:    "/volumes/csi/csi-vol-3333/4444",
+			fsName:  "myfs",
+			wantErr: true,
+		},
+		{
+			name:    "different path",
+			share:   "/0001-1111",
+			path:    "/volumes/csi/csi-vol-3333/4444",
+			fsName:  "myfs",
+			wantErr: true,
+		},
+		{
+			name:    "different filesystem",
+			share:   "/0001-1111",
+			path:    "/volumes/csi/csi-vol-1111/2222",
+			fsName:  "otherfs",
+			wantErr: true,
+		},
+		{
+			name:    "not a CephFS export",
+			share:   "/rgw",
+			path:    "/",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := checkNFSExport(exports, ts.share, ts.path, ts.fsName)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("checkNFSExport() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// ioTestFile is the file in the volume that startBackgroundIO() writes to.
+const ioTestFile = "io-test"
+
+// startBackgroundIO starts a process in the container of the pod that appends
+// a line to the file every second, and syncs it to the backend. The process
+// keeps running after this function returns, so that the volume is under IO
+// while the nodeplugin is restarted.
+func startBackgroundIO(f *framework.Framework, podName, namespace, containerName, filePath string) error {
+	cmd := fmt.Sprintf(
+		"nohup sh -c 'while true; do date >> %s && sync %s; sleep 1; done' >/dev/null 2>&1 &",
+		filePath,
+		filePath)
+	_, stdErr, err := execCommandInContainerByPodName(f, cmd, namespace, podName, containerName)
+	if err != nil {
+		return fmt.Errorf("failed to start IO on %s in pod %s/%s: %w", filePath, namespace, podName, err)
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to start IO on %s in pod %s/%s: %s", filePath, namespace, podName, stdErr)
+	}
+
+	return nil
+}
+
+// countLines returns the number of lines in the file in the container of the
+// pod.
+func countLines(f *framework.Framework, podName, namespace, containerName, filePath string) (int, error) {
+	stdOut, stdErr, err := execCommandInContainerByPodName(
+		f,
+		fmt.Sprintf("wc -l < %s", filePath),
+		namespace,
+		podName,
+		containerName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count lines of %s: %w", filePath, err)
+	}
+	if stdErr != "" {
+		return 0, fmt.Errorf("failed to count lines of %s: %s", filePath, stdErr)
+	}
+
+	return strconv.Atoi(strings.TrimSpace(stdOut))
+}
+
+// waitForIOProgress waits until the IO that was started with
+// startBackgroundIO() appended to the file, which shows that writes to the
+// volume reach the backend.
+func waitForIOProgress(f *framework.Framework, podName, namespace, containerName, filePath string) error {
+	start, err := countLines(f, podName, namespace, containerName, filePath)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(deployTimeout) * time.Minute
+	var count int
+	err = wait.PollImmediate(poll, timeout, func() (bool, error) {
+		var countErr error
+		count, countErr = countLines(f, podName, namespace, containerName, filePath)
+		if countErr != nil {
+			e2elog.Logf("%v", countErr)
+
+			return false, nil
+		}
+
+		return count > start, nil
+	})
+	if err != nil {
+		return fmt.Errorf("no IO progress on %s in pod %s/%s, %d lines before and %d after waiting: %w",
+			filePath, namespace, podName, start, count, err)
+	}
+
+	return nil
+}
+
+// restartNodePlugin deletes the pods of the nodeplugin DaemonSet, and waits
+// until the recreated pods are running.
+func restartNodePlugin(f *framework.Framework, daemonSetName string) error {
+	selector, err := getDaemonSetLabelSelector(f, cephCSINamespace, daemonSetName)
+	if err != nil {
+		return fmt.Errorf("failed to get the labels of daemonset %s: %w", daemonSetName, err)
+	}
+	err = deletePodWithLabel(selector, cephCSINamespace, false)
+	if err != nil {
+		return fmt.Errorf("failed to delete pods of daemonset %s: %w", daemonSetName, err)
+	}
+	err = waitForDaemonSets(daemonSetName, cephCSINamespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for pods of daemonset %s: %w", daemonSetName, err)
+	}
+
+	return nil
+}
+
+// waitForRBDNBDProcess waits until an rbd-nbd process is running in the
+// csi-rbdplugin container of the nodeplugin pods that match the opt. After a
+// restart of the nodeplugin, the rbd-nbd processes are started again by the
+// volume healer.
+func waitForRBDNBDProcess(f *framework.Framework, opt *metav1.ListOptions) error {
+	timeout := time.Duration(deployTimeout) * time.Minute
+	var reason string
+	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		runningAttachCmd, stdErr, err := execCommandInContainer(
+			f,
+			"pstree --arguments | grep [r]bd-nbd",
+			cephCSINamespace,
+			"csi-rbdplugin",
+			opt)
+		// if the rbd-nbd process is not running the 'grep' command
+		// will return with exit code 1
+		if err != nil {
+			if strings.Contains(err.Error(), "command terminated with exit code 1") {
+				reason = fmt.Sprintf("rbd-nbd process is not running yet: %v", err)
+			} else if stdErr != "" {
+				reason = fmt.Sprintf("failed to run ps cmd : %v, stdErr: %v", err, stdErr)
+			}
+			e2elog.Logf("%s", reason)
+
+			return false, nil
+		}
+		e2elog.Logf("attach command running after restart, runningAttachCmd: %v", runningAttachCmd)
+
+		return true, nil
+	})
+
+	if errors.Is(err, wait.ErrWaitTimeout) {
+		return fmt.Errorf("timed out waiting for the rbd-nbd process: %s", reason)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to poll: %w", err)
+	}
+
+	return nil
+}
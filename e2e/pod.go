@@ -157,16 +157,30 @@ func getCommandInPodOpts(
 }
 
 // execCommandInDaemonsetPod executes commands inside given container of a
-// daemonset pod on a particular node.
+// daemonset pod on a particular node. The pod is looked up again when the
+// command is retried, as the daemonset may have replaced it.
 //
 // stderr is returned as a string, and err will be set on a failure.
 func execCommandInDaemonsetPod(
 	f *framework.Framework,
 	c, daemonsetName, nodeName, containerName, ns string,
 ) (string, error) {
+	_ /* stdout */, stderr, err := execWithPodRetry(f, func() (framework.ExecOptions, error) {
+		return getCommandInDaemonsetPodOpts(f, c, daemonsetName, nodeName, containerName, ns)
+	})
+
+	return stderr, err
+}
+
+// getCommandInDaemonsetPodOpts returns the options to execute the command in
+// the container of the daemonset pod on the node.
+func getCommandInDaemonsetPodOpts(
+	f *framework.Framework,
+	c, daemonsetName, nodeName, containerName, ns string,
+) (framework.ExecOptions, error) {
 	selector, err := getDaemonSetLabelSelector(f, ns, daemonsetName)
 	if err != nil {
-		return "", err
+		return framework.ExecOptions{}, err
 	}
 
 	opt := &metav1.ListOptions{
@@ -174,7 +188,7 @@ func execCommandInDaemonsetPod(
 	}
 	pods, err := listPods(f, ns, opt)
 	if err != nil {
-		return "", err
+		return framework.ExecOptions{}, err
 	}
 
 	podName := ""
@@ -184,7 +198,9 @@ func execCommandInDaemonsetPod(
 		}
 	}
 	if podName == "" {
-		return "", fmt.Errorf("%s daemonset pod on node %s in namespace %s not found", daemonsetName, nodeName, ns)
+		return framework.ExecOptions{}, fmt.Errorf(
+			"%s daemonset pod on node %s in namespace %s: %w",
+			daemonsetName, nodeName, ns, errPodNotFound)
 	}
 
 	cmd := []string{"/bin/sh", "-c", c}
@@ -197,9 +213,7 @@ func execCommandInDaemonsetPod(
 		CaptureStderr: true,
 	}
 
-	_ /* stdout */, stderr, err := execWithRetry(f, &podOpt)
-
-	return stderr, err
+	return podOpt, nil
 }
 
 // listPods returns slice of pods matching given ListOptions and namespace.
@@ -212,14 +226,50 @@ func listPods(f *framework.Framework, ns string, opt *metav1.ListOptions) ([]v1.
 	return podList.Items, err
 }
 
+// errPodNotFound is returned when the pod to execute a command in does not
+// exist (yet).
+var errPodNotFound = errors.New("pod not found")
+
+// execWithRetry executes the command with the options, and retries when the
+// command could not be executed because of a transient error.
 func execWithRetry(f *framework.Framework, opts *framework.ExecOptions) (string, string, error) {
+	return execWithPodRetry(f, func() (framework.ExecOptions, error) {
+		return *opts, nil
+	})
+}
+
+// execWithPodRetry executes a command with the options that getOpts returns,
+// and retries with new options when the pod could not be found, or when the
+// command could not be executed because of a transient error, see
+// isTransientExecError(). A command that failed is not retried.
+func execWithPodRetry(
+	f *framework.Framework,
+	getOpts func() (framework.ExecOptions, error),
+) (string, string, error) {
 	timeout := time.Duration(deployTimeout) * time.Minute
-	var stdOut, stdErr string
+	var (
+		stdOut, stdErr string
+		lastErr        error
+	)
 	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
+		opts, optsErr := getOpts()
+		if optsErr != nil {
+			if isRetryableAPIError(optsErr) || errors.Is(optsErr, errPodNotFound) {
+				lastErr = optsErr
+
+				return false, nil
+			}
+
+			return false, fmt.Errorf("failed to find pod: %w", optsErr)
+		}
+
 		var execErr error
-		stdOut, stdErr, execErr = f.ExecWithOptions(*opts)
+		stdOut, stdErr, execErr = f.ExecWithOptions(opts)
 		if execErr != nil {
-			if isRetryableAPIError(execErr) {
+			if isTransientExecError(execErr) {
+				e2elog.Logf("retrying command %q in pod %s/%s: %v", opts.Command, opts.Namespace, opts.PodName, execErr)
+				lastErr = execErr
+
 				return false, nil
 			}
 
@@ -230,6 +280,9 @@ func execWithRetry(f *framework.Framework, opts *framework.ExecOptions) (string,
 
 		return true, nil
 	})
+	if errors.Is(err, wait.ErrWaitTimeout) && lastErr != nil {
+		err = fmt.Errorf("failed to execute command, last error: %w", lastErr)
+	}
 
 	return stdOut, stdErr, err
 }
@@ -287,16 +340,22 @@ func execCommandInContainerByPodName(
 	return stdOut, stdErr, err
 }
 
+// execCommandInToolBoxPod executes the command in the Rook toolbox. The
+// toolbox pod is looked up again when the command is retried, as it may
+// have been replaced. With --ceph-cluster-config, the toolbox is deployed by
+// the e2e tests for the external cluster.
 func execCommandInToolBoxPod(f *framework.Framework, c, ns string) (string, string, error) {
-	opt := &metav1.ListOptions{
-		LabelSelector: rookToolBoxPodLabel,
-	}
-	podOpt, err := getCommandInPodOpts(f, c, ns, "", opt)
+	err := ensureExternalToolbox(f)
 	if err != nil {
 		return "", "", err
 	}
 
-	stdOut, stdErr, err := execWithRetry(f, &podOpt)
+	opt := &metav1.ListOptions{
+		LabelSelector: rookToolBoxPodLabel,
+	}
+	stdOut, stdErr, err := execWithPodRetry(f, func() (framework.ExecOptions, error) {
+		return getCommandInPodOpts(f, c, ns, "", opt)
+	})
 	if stdErr != "" {
 		e2elog.Logf("stdErr occurred: %v", stdErr)
 	}
@@ -448,7 +507,11 @@ func calculateSHA512sum(f *framework.Framework, app *v1.Pod, filePath string, op
 		return "", fmt.Errorf("error: sha512sum could not be calculated %v", stdErr)
 	}
 	// extract checksum from sha512sum output.
-	checkSum := strings.Split(sha512sumOut, "")[0]
+	fields := strings.Fields(sha512sumOut)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("error: sha512sum of %s returned no output", filePath)
+	}
+	checkSum := fields[0]
 	e2elog.Logf("Calculated checksum  %s", checkSum)
 
 	return checkSum, nil
@@ -0,0 +1,356 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	cephFSDriverName = "cephfs.csi.ceph.com"
+
+	podSecurityEnforceLabel        = "pod-security.kubernetes.io/enforce"
+	podSecurityEnforceVersionLabel = "pod-security.kubernetes.io/enforce-version"
+
+	// restrictedAppImage runs as any user, the nginx image of the example
+	// applications needs to run as root.
+	restrictedAppImage = "quay.io/centos/centos:latest"
+	restrictedAppUser  = 1000
+	// restrictedAppSELinuxLevel is the MCS level of the applications, the
+	// volume needs to be labeled with it to be accessible.
+	restrictedAppSELinuxLevel = "s0:c123,c456"
+)
+
+// createRestrictedNamespace creates a namespace in which the pods need to
+// meet the restricted Pod Security Standard.
+func createRestrictedNamespace(f *framework.Framework) (string, error) {
+	name := f.UniqueName + "-restricted"
+	ns := &v1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+			Labels: map[string]string{
+				podSecurityEnforceLabel:        "restricted",
+				podSecurityEnforceVersionLabel: "latest",
+			},
+		},
+	}
+	_, err := f.ClientSet.CoreV1().Namespaces().Create(context.TODO(), ns, metav1.CreateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to create namespace %s: %w", name, err)
+	}
+
+	return name, nil
+}
+
+// podSecurityEnforced checks whether the Pod Security admission of the
+// cluster rejects a privileged pod in the namespace. Clusters without the
+// admission plugin accept it.
+func podSecurityEnforced(f *framework.Framework, ns string) (bool, error) {
+	privileged := true
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "privileged",
+			Namespace: ns,
+		},
+		Spec: v1.PodSpec{
+			Containers: []v1.Container{{
+				Name:            "privileged",
+				Image:           restrictedAppImage,
+				SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+			}},
+		},
+	}
+	_, err := f.ClientSet.CoreV1().Pods(ns).Create(context.TODO(), pod, metav1.CreateOptions{
+		DryRun: []string{metav1.DryRunAll},
+	})
+	if apierrs.IsForbidden(err) {
+		e2elog.Logf("privileged pod rejected as expected: %v", err)
+
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create privileged pod: %w", err)
+	}
+
+	return false, nil
+}
+
+// makeRestricted changes the app, so that it meets the restricted Pod
+// Security Standard, and runs with the SELinux level.
+func makeRestricted(app *v1.Pod, level string) {
+	nonRoot := true
+	noEscalation := false
+	user := int64(restrictedAppUser)
+	app.Spec.SecurityContext = &v1.PodSecurityContext{
+		RunAsNonRoot:   &nonRoot,
+		RunAsUser:      &user,
+		RunAsGroup:     &user,
+		FSGroup:        &user,
+		SeccompProfile: &v1.SeccompProfile{Type: v1.SeccompProfileTypeRuntimeDefault},
+		SELinuxOptions: &v1.SELinuxOptions{Level: level},
+	}
+	for i := range app.Spec.Containers {
+		container := &app.Spec.Containers[i]
+		container.Image = restrictedAppImage
+		container.Command = []string{"/bin/sleep", "infinity"}
+		container.Ports = nil
+		container.SecurityContext = &v1.SecurityContext{
+			AllowPrivilegeEscalation: &noEscalation,
+			Capabilities:             &v1.Capabilities{Drop: []v1.Capability{"ALL"}},
+		}
+	}
+}
+
+// restrictedProcessProblems returns the reasons why the status of a process,
+// as in /proc/self/status, is not the one of an unprivileged process that can
+// not gain privileges.
+func restrictedProcessProblems(status string, user int) []string {
+	fields := map[string]string{}
+	for _, line := range strings.Split(status, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if found {
+			fields[key] = strings.TrimSpace(value)
+		}
+	}
+
+	problems := []string{}
+	uids := strings.Fields(fields["Uid"])
+	if len(uids) == 0 || uids[0] != fmt.Sprint(user) {
+		problems = append(problems, fmt.Sprintf("runs as user %q, expected %d", fields["Uid"], user))
+	}
+	if fields["NoNewPrivs"] != "1" {
+		problems = append(problems, fmt.Sprintf("NoNewPrivs is %q", fields["NoNewPrivs"]))
+	}
+	for _, caps := range []string{"CapEff", "CapPrm", "CapBnd"} {
+		if strings.Trim(fields[caps], "0") != "" {
+			problems = append(problems, fmt.Sprintf("%s is %q", caps, fields[caps]))
+		}
+	}
+
+	return problems
+}
+
+// selinuxLevel returns the MCS level of an SELinux context like
+// "system_u:object_r:container_file_t:s0:c123,c456".
+func selinuxLevel(seContext string) string {
+	parts := strings.SplitN(strings.TrimSpace(strings.TrimRight(seContext, "\x00")), ":", 4)
+	if len(parts) != 4 {
+		return ""
+	}
+
+	return parts[3]
+}
+
+// validateRestrictedApp checks that the app runs as an unprivileged user,
+// can write to its volume, and that the volume has the SELinux level of the
+// app when SELinux is enabled on the node.
+func validateRestrictedApp(f *framework.Framework, app *v1.Pod) error {
+	container := app.Spec.Containers[0].Name
+	exec := func(cmd string) (string, error) {
+		stdOut, stdErr, err := execCommandInPodWithName(f, cmd, app.Name, container, app.Namespace)
+		if err != nil || stdErr != "" {
+			return "", fmt.Errorf("command %q failed in application %s: %v, stdErr: %s", cmd, app.Name, err, stdErr)
+		}
+
+		return stdOut, nil
+	}
+
+	status, err := exec("cat /proc/self/status")
+	if err != nil {
+		return err
+	}
+	if problems := restrictedProcessProblems(status, restrictedAppUser); len(problems) != 0 {
+		return fmt.Errorf("application %s is not restricted: %s", app.Name, strings.Join(problems, "; "))
+	}
+
+	mountPath := app.Spec.Containers[0].VolumeMounts[0].MountPath
+	_, err = exec(fmt.Sprintf("echo restricted > %[1]s/restricted && cat %[1]s/restricted", mountPath))
+	if err != nil {
+		return fmt.Errorf("unprivileged user can not write to the volume: %w", err)
+	}
+
+	processContext, err := exec("cat /proc/self/attr/current")
+	if err != nil || selinuxLevel(processContext) == "" {
+		e2elog.Logf("skipping SELinux label check, SELinux is not enabled on the node of %s: %v", app.Name, err)
+
+		return nil
+	}
+	if level := selinuxLevel(processContext); level != restrictedAppSELinuxLevel {
+		return fmt.Errorf("application %s runs with SELinux level %q, expected %q",
+			app.Name, level, restrictedAppSELinuxLevel)
+	}
+	volumeContext, err := exec("stat -c %C " + mountPath)
+	if err != nil {
+		return err
+	}
+	if level := selinuxLevel(volumeContext); level != restrictedAppSELinuxLevel {
+		return fmt.Errorf("volume of application %s has SELinux context %q, expected level %q",
+			app.Name, strings.TrimSpace(volumeContext), restrictedAppSELinuxLevel)
+	}
+
+	return nil
+}
+
+// setCSIDriverSELinuxMount enables or disables the "-o context" mount option
+// for the volumes of the driver. The kubelet only passes the mount option
+// for ReadWriteOncePod volumes, when the SELinuxMountReadWriteOncePod feature
+// gate is enabled.
+func setCSIDriverSELinuxMount(f *framework.Framework, driverName string, enabled bool) error {
+	driver, err := f.ClientSet.StorageV1().CSIDrivers().Get(context.TODO(), driverName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get CSIDriver %s: %w", driverName, err)
+	}
+	driver.Spec.SELinuxMount = &enabled
+	_, err = f.ClientSet.StorageV1().CSIDrivers().Update(context.TODO(), driver, metav1.UpdateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to update CSIDriver %s: %w", driverName, err)
+	}
+
+	return nil
+}
+
+// validateUnprivilegedProvisioner checks that only the nodeplugin needs to
+// be privileged, and that none of the containers of the provisioner are.
+func validateUnprivilegedProvisioner(f *framework.Framework, deploymentName string) error {
+	deployment, err := f.ClientSet.AppsV1().Deployments(cephCSINamespace).Get(
+		context.TODO(),
+		deploymentName,
+		metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get deployment %s: %w", deploymentName, err)
+	}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		sc := container.SecurityContext
+		if sc != nil && sc.Privileged != nil && *sc.Privileged {
+			return fmt.Errorf("container %s of deployment %s is privileged", container.Name, deploymentName)
+		}
+	}
+
+	return nil
+}
+
+// validateRestrictedWorkloads runs apps that meet the restricted Pod
+// Security Standard with an SELinux level in a namespace that enforces the
+// standard, with a ReadWriteOnce PVC, and a ReadWriteOncePod PVC while the
+// CSIDriver supports "-o context". The provisioner of the driver may not be
+// privileged.
+func validateRestrictedWorkloads(
+	f *framework.Framework,
+	driverName, deploymentName, pvcPath, appPath string,
+) error {
+	err := validateUnprivilegedProvisioner(f, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	ns, err := createRestrictedNamespace(f)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		nsErr := deleteNamespace(f.ClientSet, ns)
+		if nsErr != nil {
+			e2elog.Failf("failed to delete namespace %s: %v", ns, nsErr)
+		}
+	}()
+	enforced, err := podSecurityEnforced(f, ns)
+	if err != nil {
+		return err
+	}
+	if !enforced {
+		e2elog.Logf("Pod Security admission is not enabled, the restricted profile is only applied to the pods")
+	}
+
+	for _, tc := range []struct {
+		accessMode   v1.PersistentVolumeAccessMode
+		seLinuxMount bool
+	}{
+		{accessMode: v1.ReadWriteOnce},
+		{accessMode: v1.ReadWriteOncePod, seLinuxMount: true},
+	} {
+		if tc.seLinuxMount {
+			err = setCSIDriverSELinuxMount(f, driverName, true)
+			if err != nil {
+				return err
+			}
+		}
+		err = validateRestrictedPVC(f, ns, tc.accessMode, pvcPath, appPath)
+		if tc.seLinuxMount {
+			mountErr := setCSIDriverSELinuxMount(f, driverName, false)
+			if mountErr != nil {
+				return mountErr
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s PVC: %w", tc.accessMode, err)
+		}
+	}
+
+	return nil
+}
+
+// validateRestrictedPVC creates a PVC with the access mode for a restricted
+// app in the namespace, and validates the app.
+func validateRestrictedPVC(
+	f *framework.Framework,
+	ns string,
+	accessMode v1.PersistentVolumeAccessMode,
+	pvcPath, appPath string,
+) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = ns
+	pvc.Spec.AccessModes = []v1.PersistentVolumeAccessMode{accessMode}
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = ns
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+	makeRestricted(app, restrictedAppSELinuxLevel)
+
+	err = createPVCAndvalidatePV(f.ClientSet, pvc, deployTimeout)
+	if err != nil {
+		if accessMode == v1.ReadWriteOncePod && rwopMayFail(err) {
+			e2elog.Logf("RWOP is not supported: %v", err)
+
+			return nil
+		}
+
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create restricted application: %w", err)
+	}
+	err = validateRestrictedApp(f, app)
+	if err != nil {
+		return err
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
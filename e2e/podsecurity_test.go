@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestRestrictedProcessProblems(t *testing.T) {
+	t.Parallel()
+	restricted := "Name:\tcat\nUid:\t1000\t1000\t1000\t1000\nNoNewPrivs:\t1\n" +
+		"CapPrm:\t0000000000000000\nCapEff:\t0000000000000000\nCapBnd:\t0000000000000000\n"
+	root := "Name:\tcat\nUid:\t0\t0\t0\t0\nNoNewPrivs:\t0\n" +
+		"CapPrm:\t00000000a80425fb\nCapEff:\t00000000a80425fb\nCapBnd:\t00000000a80425fb\n"
+
+	tests := []struct {
+		name     string
+		status   string
+		problems int
+	}{
+		{"restricted", restricted, 0},
+		{"root with capabilities", root, 5},
+		{"empty status", "", 2},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := restrictedProcessProblems(ts.status, 1000)
+			if len(got) != ts.problems {
+				t.Errorf("restrictedProcessProblems() = %v, want %d problems", got, ts.problems)
+			}
+		})
+	}
+}
+
+func TestSELinuxLevel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		context string
+		want    string
+	}{
+		{"process", "system_u:system_r:container_t:s0:c123,c456\x00", "s0:c123,c456"},
+		{"file", "system_u:object_r:container_file_t:s0:c123,c456\n", "s0:c123,c456"},
+		{"without level", "unconfined", ""},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := selinuxLevel(ts.context); got != ts.want {
+				t.Errorf("selinuxLevel(%q) = %q, want %q", ts.context, got, ts.want)
+			}
+		})
+	}
+}
@@ -45,9 +45,7 @@ func loadPVC(path string) (*v1.PersistentVolumeClaim, error) {
 
 func createPVCAndvalidatePV(c kubernetes.Interface, pvc *v1.PersistentVolumeClaim, t int) error {
 	timeout := time.Duration(t) * time.Minute
-	pv := &v1.PersistentVolume{}
-	var err error
-	_, err = c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	_, err := c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create pvc: %w", err)
 	}
@@ -56,51 +54,31 @@ func createPVCAndvalidatePV(c kubernetes.Interface, pvc *v1.PersistentVolumeClai
 	}
 	name := pvc.Name
 	namespace := pvc.Namespace
-	start := time.Now()
-	e2elog.Logf("Waiting up to %v to be in Bound state", pvc)
-
-	return wait.PollImmediate(poll, timeout, func() (bool, error) {
-		e2elog.Logf("waiting for PVC %s (%d seconds elapsed)", name, int(time.Since(start).Seconds()))
-		pvc, err = c.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
-		if err != nil {
-			e2elog.Logf("Error getting pvc %q in namespace %q: %v", name, namespace, err)
-			if isRetryableAPIError(err) {
-				return false, nil
-			}
-			if apierrs.IsNotFound(err) {
-				return false, nil
-			}
-
-			return false, fmt.Errorf("failed to get pvc: %w", err)
-		}
-
-		if pvc.Spec.VolumeName == "" {
-			return false, nil
-		}
-
-		pv, err = c.CoreV1().PersistentVolumes().Get(context.TODO(), pvc.Spec.VolumeName, metav1.GetOptions{})
-		if err != nil {
-			if isRetryableAPIError(err) {
-				return false, nil
-			}
-			if apierrs.IsNotFound(err) {
-				return false, nil
-			}
-
-			return false, fmt.Errorf("failed to get pv: %w", err)
-		}
-		err = e2epv.WaitOnPVandPVC(
-			c,
-			&framework.TimeoutContext{ClaimBound: timeout, PVBound: timeout},
-			namespace,
-			pv,
-			pvc)
-		if err != nil {
-			return false, fmt.Errorf("failed to wait for the pv and pvc to bind: %w", err)
-		}
+	pvc, err = waitForState(
+		fmt.Sprintf("PVC %s/%s", namespace, name),
+		func() (*v1.PersistentVolumeClaim, error) {
+			return c.CoreV1().PersistentVolumeClaims(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		},
+		pvcBound,
+		timeout)
+	if err != nil {
+		return err
+	}
+	pv, err := getPersistentVolume(c, pvc.Spec.VolumeName)
+	if err != nil {
+		return err
+	}
+	err = e2epv.WaitOnPVandPVC(
+		c,
+		&framework.TimeoutContext{ClaimBound: timeout, PVBound: timeout},
+		namespace,
+		pv,
+		pvc)
+	if err != nil {
+		return fmt.Errorf("failed to wait for the pv and pvc to bind: %w", err)
+	}
 
-		return true, nil
-	})
+	return nil
 }
 
 func createPVCAndPV(c kubernetes.Interface, pvc *v1.PersistentVolumeClaim, pv *v1.PersistentVolume) error {
@@ -127,68 +105,22 @@ func deletePVCAndPV(c kubernetes.Interface, pvc *v1.PersistentVolumeClaim, pv *v
 	}
 
 	timeout := time.Duration(t) * time.Minute
-	start := time.Now()
-
-	pvcToDelete := pvc
-	err = wait.PollImmediate(poll, timeout, func() (bool, error) {
-		// Check that the PVC is deleted.
-		e2elog.Logf(
-			"waiting for PVC %s in state %s to be deleted (%d seconds elapsed)",
-			pvcToDelete.Name,
-			pvcToDelete.Status.String(),
-			int(time.Since(start).Seconds()))
-		pvcToDelete, err = c.CoreV1().
-			PersistentVolumeClaims(pvc.Namespace).
-			Get(context.TODO(), pvc.Name, metav1.GetOptions{})
-		if err == nil {
-			if pvcToDelete.Status.Phase == "" {
-				// this is unexpected, an empty Phase is not defined
-				// FIXME: see https://github.com/ceph/ceph-csi/issues/1874
-				e2elog.Logf("PVC %s is in a weird state: %s", pvcToDelete.Name, pvcToDelete.String())
-			}
-
-			return false, nil
-		}
-		if isRetryableAPIError(err) {
-			return false, nil
-		}
-		if !apierrs.IsNotFound(err) {
-			return false, fmt.Errorf(
-				"get on deleted PVC %v failed with error other than \"not found\": %w",
-				pvc.Name,
-				err)
-		}
-
-		return true, nil
-	})
+	err = waitForDeletion(
+		fmt.Sprintf("PVC %s/%s", pvc.Namespace, pvc.Name),
+		func() (*v1.PersistentVolumeClaim, error) {
+			return c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+		},
+		timeout)
 	if err != nil {
-		return fmt.Errorf("failed to poll: %w", err)
+		return err
 	}
 
-	start = time.Now()
-	pvToDelete := pv
-
-	return wait.PollImmediate(poll, timeout, func() (bool, error) {
-		// Check that the PV is deleted.
-		e2elog.Logf(
-			"waiting for PV %s in state %s to be deleted (%d seconds elapsed)",
-			pvToDelete.Name,
-			pvToDelete.Status.String(),
-			int(time.Since(start).Seconds()))
-
-		pvToDelete, err = c.CoreV1().PersistentVolumes().Get(context.TODO(), pv.Name, metav1.GetOptions{})
-		if err == nil {
-			return false, nil
-		}
-		if isRetryableAPIError(err) {
-			return false, nil
-		}
-		if !apierrs.IsNotFound(err) {
-			return false, fmt.Errorf("delete PV %v failed with error other than \"not found\": %w", pv.Name, err)
-		}
-
-		return true, nil
-	})
+	return waitForDeletion(
+		"PV "+pv.Name,
+		func() (*v1.PersistentVolume, error) {
+			return c.CoreV1().PersistentVolumes().Get(context.TODO(), pv.Name, metav1.GetOptions{})
+		},
+		timeout)
 }
 
 // getPersistentVolumeClaim returns the PersistentVolumeClaim with the given
@@ -327,6 +259,12 @@ func getBoundPV(client kubernetes.Interface, pvc *v1.PersistentVolumeClaim) (*v1
 }
 
 func checkPVSelectorValuesForPVC(f *framework.Framework, pvc *v1.PersistentVolumeClaim) error {
+	return checkPVTopology(f, pvc, regionValue, zoneValue)
+}
+
+// checkPVTopology checks that the node affinity of the PV that is bound to
+// the PVC restricts it to the region and zone.
+func checkPVTopology(f *framework.Framework, pvc *v1.PersistentVolumeClaim, region, zone string) error {
 	pv, err := getBoundPV(f.ClientSet, pvc)
 	if err != nil {
 		return err
@@ -345,7 +283,7 @@ func checkPVSelectorValuesForPVC(f *framework.Framework, pvc *v1.PersistentVolum
 				return errors.New("found multiple occurrences of topology key for region")
 			}
 			rFound = true
-			if expression.Values[0] != regionValue {
+			if expression.Values[0] != region {
 				return errors.New("topology value for region label mismatch")
 			}
 		case nodeCSIZoneLabel:
@@ -353,7 +291,7 @@ func checkPVSelectorValuesForPVC(f *framework.Framework, pvc *v1.PersistentVolum
 				return errors.New("found multiple occurrences of topology key for zone")
 			}
 			zFound = true
-			if expression.Values[0] != zoneValue {
+			if expression.Values[0] != zone {
 				return errors.New("topology value for zone label mismatch")
 			}
 		default:
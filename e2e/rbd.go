@@ -18,10 +18,8 @@ package e2e
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strings"
-	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 
@@ -29,7 +27,6 @@ import (
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
-	"k8s.io/apimachinery/pkg/util/wait"
 	clientset "k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/test/e2e/framework"
 	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
@@ -149,6 +146,7 @@ func createORDeleteRbdResources(action kubectlAction) {
 			namespace:      cephCSINamespace,
 			oneReplica:     true,
 			enableTopology: true,
+			metricsPort:    rbdMetricsPort,
 		},
 		// dependencies for the node-plugin
 		&yamlResourceNamespaced{
@@ -160,6 +158,7 @@ func createORDeleteRbdResources(action kubectlAction) {
 			filename:    rbdDirPath + rbdNodePlugin,
 			namespace:   cephCSINamespace,
 			domainLabel: nodeRegionLabel + "," + nodeZoneLabel,
+			metricsPort: rbdMetricsPort,
 		},
 	}
 
@@ -186,56 +185,12 @@ func validateRBDImageCount(f *framework.Framework, count int, pool string) {
 	}
 }
 
-func formatImageMetaGetCmd(pool, image, key string) string {
-	return fmt.Sprintf("rbd image-meta get %s --image=%s %s", rbdOptions(pool), image, key)
-}
-
-// checkGetKeyError check for error conditions returned by get image-meta key,
-// returns true if key exists.
-func checkGetKeyError(err error, stdErr string) bool {
-	if err == nil || !strings.Contains(err.Error(), "command terminated with exit code 2") ||
-		!strings.Contains(stdErr, "failed to get metadata") {
-		return true
-	}
-
-	return false
-}
-
-// checkClusternameInMetadata check for cluster name metadata on RBD image.
-// nolint:nilerr // intentionally returning nil on error in the retry loop.
-func checkClusternameInMetadata(f *framework.Framework, ns, pool, image string) {
-	t := time.Duration(deployTimeout) * time.Minute
-	var (
-		coName  string
-		stdErr  string
-		execErr error
-	)
-	err := wait.PollImmediate(poll, t, func() (bool, error) {
-		coName, stdErr, execErr = execCommandInToolBoxPod(f,
-			fmt.Sprintf("rbd image-meta get %s --image=%s %s", rbdOptions(pool), image, clusterNameKey),
-			ns)
-		if execErr != nil || stdErr != "" {
-			e2elog.Logf("failed to get cluster name %s/%s %s: err=%v stdErr=%q",
-				rbdOptions(pool), image, clusterNameKey, execErr, stdErr)
-
-			return false, nil
-		}
-
-		return true, nil
-	})
-	if err != nil {
-		e2elog.Failf("could not get cluster name %s/%s %s: %v", rbdOptions(pool), image, clusterNameKey, err)
-	}
-	coName = strings.TrimSuffix(coName, "\n")
-	if coName != defaultClusterName {
-		e2elog.Failf("expected coName %q got %q", defaultClusterName, coName)
-	}
-}
-
 var _ = Describe("RBD", func() {
 	f := framework.NewDefaultFramework(rbdType)
 	var c clientset.Interface
 	var kernelRelease string
+	var leakDetector *journalLeakDetector
+	var reaper *orphanReaper
 	// deploy RBD CSI
 	BeforeEach(func() {
 		if !testRBD || upgradeTesting {
@@ -319,6 +274,36 @@ var _ = Describe("RBD", func() {
 		if err != nil {
 			e2elog.Failf("timeout waiting for deployment update %s/%s: %v", cephCSINamespace, rbdDeploymentName, err)
 		}
+
+		leakDetector, err = newJournalLeakDetector(f, rbdType, defaultRBDPool)
+		if err != nil {
+			e2elog.Failf("failed to count journal entries: %v", err)
+		}
+		reaper = newOrphanReaper(rbdType, defaultRBDPool)
+	})
+
+	// JustAfterEach runs before the framework deletes the namespace of the
+	// spec and its clientset
+	JustAfterEach(func() {
+		if !testRBD || upgradeTesting {
+			return
+		}
+		if CurrentGinkgoTestDescription().Failed {
+			if reaper != nil {
+				err := reaper.reap(f)
+				if err != nil {
+					e2elog.Failf("failed to remove the resources of the failed spec: %v", err)
+				}
+			}
+
+			return
+		}
+		if leakDetector != nil {
+			err := leakDetector.check(f)
+			if err != nil {
+				e2elog.Failf("%v", err)
+			}
+		}
 	})
 
 	AfterEach(func() {
@@ -435,55 +420,11 @@ var _ = Describe("RBD", func() {
 				validateRBDImageCount(f, 1, defaultRBDPool)
 				validateOmapCount(f, 1, rbdType, defaultRBDPool, volumesType)
 
-				imageList, err := listRBDImages(f, defaultRBDPool)
+				err = validatePVCMetadata(f, pvc)
 				if err != nil {
-					e2elog.Failf("failed to list rbd images: %v", err)
-				}
-
-				pvcName, stdErr, err := execCommandInToolBoxPod(f,
-					formatImageMetaGetCmd(defaultRBDPool, imageList[0], pvcNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get PVC name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey, err, stdErr)
-				}
-				pvcName = strings.TrimSuffix(pvcName, "\n")
-				if pvcName != pvc.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvc.Name, pvcName)
+					e2elog.Failf("failed to validate PVC metadata: %v", err)
 				}
 
-				pvcNamespace, stdErr, err := execCommandInToolBoxPod(f,
-					formatImageMetaGetCmd(defaultRBDPool, imageList[0], pvcNamespaceKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get PVC namespace %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNamespaceKey, err, stdErr)
-				}
-				pvcNamespace = strings.TrimSuffix(pvcNamespace, "\n")
-				if pvcNamespace != pvc.Namespace {
-					e2elog.Failf("expected pvcNamespace %q got %q", pvc.Namespace, pvcNamespace)
-				}
-				pvcObj, err := getPersistentVolumeClaim(c, pvc.Namespace, pvc.Name)
-				if err != nil {
-					e2elog.Logf("error getting pvc %q in namespace %q: %v", pvc.Name, pvc.Namespace, err)
-				}
-				if pvcObj.Spec.VolumeName == "" {
-					e2elog.Logf("pv name is empty %q in namespace %q: %v", pvc.Name, pvc.Namespace, err)
-				}
-				pvName, stdErr, err := execCommandInToolBoxPod(f,
-					formatImageMetaGetCmd(defaultRBDPool, imageList[0], pvNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get PV name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvNameKey, err, stdErr)
-				}
-				pvName = strings.TrimSuffix(pvName, "\n")
-				if pvName != pvcObj.Spec.VolumeName {
-					e2elog.Failf("expected pvName %q got %q", pvcObj.Spec.VolumeName, pvName)
-				}
-
-				checkClusternameInMetadata(f, rookNamespace, defaultRBDPool, imageList[0])
-
 				err = deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
 				if err != nil {
 					e2elog.Failf("failed to delete pvc: %v", err)
@@ -507,22 +448,9 @@ var _ = Describe("RBD", func() {
 				validateRBDImageCount(f, 1, defaultRBDPool)
 				validateOmapCount(f, 1, rbdType, defaultRBDPool, volumesType)
 
-				imageList, err := listRBDImages(f, defaultRBDPool)
+				err = validatePVCMetadata(f, pvc)
 				if err != nil {
-					e2elog.Failf("failed to list rbd images: %v", err)
-				}
-
-				pvcName, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get PVC name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey, err, stdErr)
-				}
-				pvcName = strings.TrimSuffix(pvcName, "\n")
-				if pvcName != pvc.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvc.Name, pvcName)
+					e2elog.Failf("failed to validate PVC metadata: %v", err)
 				}
 
 				pvcObj, err := c.CoreV1().PersistentVolumeClaims(pvc.Namespace).Get(
@@ -586,17 +514,10 @@ var _ = Describe("RBD", func() {
 				validateRBDImageCount(f, 1, defaultRBDPool)
 				validateOmapCount(f, 1, rbdType, defaultRBDPool, volumesType)
 
-				pvcName, stdErr, err = execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get PVC name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey, err, stdErr)
-				}
-				pvcName = strings.TrimSuffix(pvcName, "\n")
-				if pvcName != pvcObj.Name {
-					e2elog.Failf("expected pvcName %q got %q", pvcObj.Name, pvcName)
+				// the PVC metadata on the image needs to be updated to the new PVC
+				err = validatePVCMetadata(f, pvcObj)
+				if err != nil {
+					e2elog.Failf("failed to validate metadata of new PVC: %v", err)
 				}
 
 				patchBytes = []byte(`{"spec":{"persistentVolumeReclaimPolicy": "Delete"}}`)
@@ -657,83 +578,11 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 1, rbdType, defaultRBDPool, volumesType)
 				validateOmapCount(f, 1, rbdType, defaultRBDPool, snapsType)
 
-				imageList, err := listRBDImages(f, defaultRBDPool)
+				err = validateSnapshotMetadata(f, &snap)
 				if err != nil {
-					e2elog.Failf("failed to list rbd images: %v", err)
-				}
-
-				volSnapName, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get volume snapshot name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapNameKey, err, stdErr)
-				}
-				volSnapName = strings.TrimSuffix(volSnapName, "\n")
-				if volSnapName != snap.Name {
-					e2elog.Failf("expected volSnapName %q got %q", snap.Name, volSnapName)
-				}
-
-				volSnapNamespace, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapNamespaceKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get volume snapshot namespace %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapNamespaceKey, err, stdErr)
-				}
-				volSnapNamespace = strings.TrimSuffix(volSnapNamespace, "\n")
-				if volSnapNamespace != snap.Namespace {
-					e2elog.Failf("expected volSnapNamespace %q got %q", snap.Namespace, volSnapNamespace)
+					e2elog.Failf("failed to validate snapshot metadata: %v", err)
 				}
 
-				content, err := getVolumeSnapshotContent(snap.Namespace, snap.Name)
-				if err != nil {
-					e2elog.Failf("failed to get snapshotcontent for %s in namespace %s: %v",
-						snap.Name, snap.Namespace, err)
-				}
-				volSnapContentName, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapContentNameKey),
-					rookNamespace)
-				if err != nil || stdErr != "" {
-					e2elog.Failf("failed to get snapshotcontent name %s/%s %s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], volSnapContentNameKey, err, stdErr)
-				}
-				volSnapContentName = strings.TrimSuffix(volSnapContentName, "\n")
-				if volSnapContentName != content.Name {
-					e2elog.Failf("expected volSnapContentName %q got %q", content.Name, volSnapContentName)
-				}
-
-				// make sure we had unset the PVC metadata on the rbd image created
-				// for the snapshot
-				pvcName, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey),
-					rookNamespace)
-				if checkGetKeyError(err, stdErr) {
-					e2elog.Failf("PVC name found on %s/%s %s=%s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNameKey, pvcName, err, stdErr)
-				}
-				pvcNamespace, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNamespaceKey),
-					rookNamespace)
-				if checkGetKeyError(err, stdErr) {
-					e2elog.Failf("PVC namespace found on %s/%s %s=%s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvcNamespaceKey, pvcNamespace, err, stdErr)
-				}
-				pvName, stdErr, err := execCommandInToolBoxPod(f,
-					fmt.Sprintf("rbd image-meta get %s --image=%s %s",
-						rbdOptions(defaultRBDPool), imageList[0], pvNameKey),
-					rookNamespace)
-				if checkGetKeyError(err, stdErr) {
-					e2elog.Failf("PV name found on %s/%s %s=%s: err=%v stdErr=%q",
-						rbdOptions(defaultRBDPool), imageList[0], pvNameKey, pvName, err, stdErr)
-				}
-				checkClusternameInMetadata(f, rookNamespace, defaultRBDPool, imageList[0])
-
 				err = deleteSnapshot(&snap, deployTimeout)
 				if err != nil {
 					e2elog.Failf("failed to delete snapshot: %v", err)
@@ -774,6 +623,20 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
+			By("restart, recreate and drain pods with generic ephemeral volumes", func() {
+				err := validateEphemeralVolumes(f, appEphemeralPath)
+				if err != nil {
+					e2elog.Failf("failed to validate generic ephemeral volumes: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				err = waitToRemoveImagesFromTrash(f, defaultRBDPool, deployTimeout)
+				if err != nil {
+					e2elog.Failf("failed to validate rbd images in pool %s trash: %v", defaultRBDPool, err)
+				}
+			})
+
 			By("validate RBD migration PVC", func() {
 				err := setupMigrationCMSecretAndSC(f, "")
 				if err != nil {
@@ -835,6 +698,32 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
+			By("validate RBD migration of inline volumes", func() {
+				// inline volumes do not use the StorageClass
+				scName := "inline-migration-sc"
+				err := setupMigrationCMSecretAndSC(f, scName)
+				if err != nil {
+					e2elog.Failf("failed to setup migration prerequisites: %v", err)
+				}
+				err = validateRBDInlineMigration(f, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate rbd migration of inline volumes: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				err = tearDownMigrationSetup(f)
+				if err != nil {
+					e2elog.Failf("failed to tear down migration setup: %v", err)
+				}
+				err = retryKubectlArgs(cephCSINamespace, kubectlDelete, deployTimeout, "sc", scName)
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass %s: %v", scName, err)
+				}
+				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+			})
+
 			By("create a PVC and validate owner", func() {
 				err := validateImageOwner(pvcPath, f)
 				if err != nil {
@@ -1761,38 +1650,9 @@ var _ = Describe("RBD", func() {
 				}
 				e2elog.Logf("rbd-nbd package version: %v", rpmv)
 
-				timeout := time.Duration(deployTimeout) * time.Minute
-				var reason string
-				err = wait.PollImmediate(poll, timeout, func() (bool, error) {
-					var runningAttachCmd string
-					runningAttachCmd, stdErr, err = execCommandInContainer(
-						f,
-						"pstree --arguments | grep [r]bd-nbd",
-						cephCSINamespace,
-						"csi-rbdplugin",
-						&opt)
-					// if the rbd-nbd process is not running the 'grep' command
-					// will return with exit code 1
-					if err != nil {
-						if strings.Contains(err.Error(), "command terminated with exit code 1") {
-							reason = fmt.Sprintf("rbd-nbd process is not running yet: %v", err)
-						} else if stdErr != "" {
-							reason = fmt.Sprintf("failed to run ps cmd : %v, stdErr: %v", err, stdErr)
-						}
-						e2elog.Logf("%s", reason)
-
-						return false, nil
-					}
-					e2elog.Logf("attach command running after restart, runningAttachCmd: %v", runningAttachCmd)
-
-					return true, nil
-				})
-
-				if errors.Is(err, wait.ErrWaitTimeout) {
-					e2elog.Failf("timed out waiting for the rbd-nbd process: %s", reason)
-				}
+				err = waitForRBDNBDProcess(f, &opt)
 				if err != nil {
-					e2elog.Failf("failed to poll: %v", err)
+					e2elog.Failf("%v", err)
 				}
 
 				// Writes on kernel < 5.4 are failing due to a bug in NBD driver,
@@ -1829,7 +1689,14 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
-			By("create a PVC and bind it to an app using rbd-nbd mounter with encryption", func() {
+			By("continue IO on rbd-nbd volume across nodeplugin restart", func() {
+				// Writes on kernel < 5.4 are failing due to a bug in NBD driver,
+				// see the previous test.
+				if !util.CheckKernelSupport(kernelRelease, nbdZeroIOtimeoutSupport) {
+					e2elog.Logf("kernel %q does not meet recommendation, skipping IO test", kernelRelease)
+
+					return
+				}
 				err := deleteResource(rbdExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
@@ -1844,209 +1711,65 @@ var _ = Describe("RBD", func() {
 						"mounter":         "rbd-nbd",
 						"mapOptions":      nbdMapOptions,
 						"cephLogStrategy": e2eDefaultCephLogStrategy,
-						"encrypted":       "true",
 					},
 					deletePolicy)
 				if err != nil {
 					e2elog.Failf("failed to create storageclass: %v", err)
 				}
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, noKMS, f)
-				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
-				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-			})
-
-			By("create a PVC and bind it to an app with encrypted RBD volume", func() {
-				err := deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(
-					f.ClientSet,
-					f,
-					defaultSCName,
-					nil,
-					map[string]string{"encrypted": "true"},
-					deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, noKMS, f)
-				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
-				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-			})
-
-			By("Resize Encrypted Block PVC and check Device size", func() {
-				err := deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(
-					f.ClientSet,
-					f,
-					defaultSCName,
-					nil,
-					map[string]string{"encrypted": "true"},
-					deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-
-				// FileSystem PVC resize
-				err = resizePVCAndValidateSize(pvcPath, appPath, f)
-				if err != nil {
-					e2elog.Failf("failed to resize filesystem PVC: %v", err)
-				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-
-				// Block PVC resize
-				err = resizePVCAndValidateSize(rawPvcPath, rawAppPath, f)
-				if err != nil {
-					e2elog.Failf("failed to resize block PVC: %v", err)
-				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-			})
-
-			By("create a PVC and bind it to an app with encrypted RBD volume with VaultKMS", func() {
-				err := deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				scOpts := map[string]string{
-					"encrypted":       "true",
-					"encryptionKMSID": "vault-test",
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, vaultKMS, f)
-				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
-				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+				pvc, err := loadPVC(pvcPath)
 				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
+					e2elog.Failf("failed to load PVC: %v", err)
 				}
-			})
+				pvc.Namespace = f.UniqueName
 
-			By("create a PVC and bind it to an app with encrypted RBD volume with VaultTokensKMS", func() {
-				err := deleteResource(rbdExamplePath + "storageclass.yaml")
+				app, err := loadApp(appPath)
 				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
+					e2elog.Failf("failed to load application: %v", err)
 				}
-				scOpts := map[string]string{
-					"encrypted":       "true",
-					"encryptionKMSID": "vault-tokens-test",
+				app.Namespace = f.UniqueName
+				app.Labels = map[string]string{
+					"app": app.Name,
 				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
+				app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+				err = createPVCAndApp("", f, pvc, app, deployTimeout)
 				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
+					e2elog.Failf("failed to create PVC and application: %v", err)
 				}
 
-				// name(space) of the Tenant
-				tenant := f.UniqueName
-
-				// create the Secret with Vault Token in the Tenants namespace
-				token, err := getSecret(vaultExamplePath + "tenant-token.yaml")
-				if err != nil {
-					e2elog.Failf("failed to load tenant token from secret: %v", err)
-				}
-				_, err = c.CoreV1().Secrets(tenant).Create(context.TODO(), &token, metav1.CreateOptions{})
+				containerName := app.Spec.Containers[0].Name
+				filePath := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/" + ioTestFile
+				err = startBackgroundIO(f, app.Name, app.Namespace, containerName, filePath)
 				if err != nil {
-					e2elog.Failf("failed to create Secret with tenant token: %v", err)
+					e2elog.Failf("%v", err)
 				}
-
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, vaultTokensKMS, f)
+				err = waitForIOProgress(f, app.Name, app.Namespace, containerName, filePath)
 				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
+					e2elog.Failf("%v", err)
 				}
-				// validate created backend rbd images
-				validateRBDImageCount(f, 0, defaultRBDPool)
-				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 
-				// delete the Secret of the Tenant
-				err = c.CoreV1().Secrets(tenant).Delete(context.TODO(), token.Name, metav1.DeleteOptions{})
+				err = restartNodePlugin(f, rbdDaemonsetName)
 				if err != nil {
-					e2elog.Failf("failed to delete Secret with tenant token: %v", err)
+					e2elog.Failf("failed to restart nodeplugin: %v", err)
 				}
-
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
-				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
-				}
-			})
-
-			By("create a PVC and bind it to an app with encrypted RBD volume with VaultTenantSA KMS", func() {
-				err := deleteResource(rbdExamplePath + "storageclass.yaml")
+				selector, err := getDaemonSetLabelSelector(f, cephCSINamespace, rbdDaemonsetName)
 				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				scOpts := map[string]string{
-					"encrypted":       "true",
-					"encryptionKMSID": "vault-tenant-sa-test",
+					e2elog.Failf("failed to get the labels: %v", err)
 				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
+				err = waitForRBDNBDProcess(f, &metav1.ListOptions{LabelSelector: selector})
 				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
+					e2elog.Failf("%v", err)
 				}
 
-				err = createTenantServiceAccount(f.ClientSet, f.UniqueName)
+				// the IO that was blocked while the rbd-nbd process was not
+				// running continues once the healer attached the volume again
+				err = waitForIOProgress(f, app.Name, app.Namespace, containerName, filePath)
 				if err != nil {
-					e2elog.Failf("failed to create ServiceAccount: %v", err)
+					e2elog.Failf("IO did not continue after nodeplugin restart: %v", err)
 				}
-				defer deleteTenantServiceAccount(f.UniqueName)
 
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, vaultTenantSAKMS, f)
+				err = deletePVCAndApp("", f, pvc, app)
 				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
+					e2elog.Failf("failed to delete PVC and application: %v", err)
 				}
 				// validate created backend rbd images
 				validateRBDImageCount(f, 0, defaultRBDPool)
@@ -2061,16 +1784,24 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
-			By("create a PVC and bind it to an app with encrypted RBD volume with SecretsMetadataKMS", func() {
+			By("create a PVC and bind it to an app using rbd-nbd mounter with encryption", func() {
 				err := deleteResource(rbdExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
 				}
-				scOpts := map[string]string{
-					"encrypted":       "true",
-					"encryptionKMSID": "secrets-metadata-test",
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
+				// Storage class with rbd-nbd mounter
+				err = createRBDStorageClass(
+					f.ClientSet,
+					f,
+					defaultSCName,
+					nil,
+					map[string]string{
+						"mounter":         "rbd-nbd",
+						"mapOptions":      nbdMapOptions,
+						"cephLogStrategy": e2eDefaultCephLogStrategy,
+						"encrypted":       "true",
+					},
+					deletePolicy)
 				if err != nil {
 					e2elog.Failf("failed to create storageclass: %v", err)
 				}
@@ -2091,110 +1822,62 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
-			By("test RBD volume encryption with user secrets based SecretsMetadataKMS", func() {
+			for i := range kmsMatrix {
+				tc := &kmsMatrix[i]
+				By("create a PVC and bind it to an app with encrypted RBD volume with "+tc.name, func() {
+					err := validateKMSTestCase(f, tc, pvcPath, appPath)
+					if err != nil {
+						e2elog.Failf("failed to validate encryption with %s: %v", tc.name, err)
+					}
+					// validate created backend rbd images
+					validateRBDImageCount(f, 0, defaultRBDPool)
+					validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				})
+			}
+
+			By("Resize Encrypted Block PVC and check Device size", func() {
 				err := deleteResource(rbdExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
 				}
-				scOpts := map[string]string{
-					"encrypted":       "true",
-					"encryptionKMSID": "user-ns-secrets-metadata-test",
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
+				err = createRBDStorageClass(
+					f.ClientSet,
+					f,
+					defaultSCName,
+					nil,
+					map[string]string{"encrypted": "true"},
+					deletePolicy)
 				if err != nil {
 					e2elog.Failf("failed to create storageclass: %v", err)
 				}
 
-				// user provided namespace where secret will be created
-				namespace := cephCSINamespace
-
-				// create user Secret
-				err = retryKubectlFile(namespace, kubectlCreate, vaultExamplePath+vaultUserSecret, deployTimeout)
-				if err != nil {
-					e2elog.Failf("failed to create user Secret: %v", err)
-				}
-
-				err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, noKMS, f)
+				// FileSystem PVC resize
+				err = resizePVCAndValidateSize(pvcPath, appPath, f)
 				if err != nil {
-					e2elog.Failf("failed to validate encrypted pvc: %v", err)
+					e2elog.Failf("failed to resize filesystem PVC: %v", err)
 				}
 				// validate created backend rbd images
 				validateRBDImageCount(f, 0, defaultRBDPool)
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 
-				// delete user secret
-				err = retryKubectlFile(namespace,
-					kubectlDelete,
-					vaultExamplePath+vaultUserSecret,
-					deployTimeout,
-					"--ignore-not-found=true")
-				if err != nil {
-					e2elog.Failf("failed to delete user Secret: %v", err)
-				}
-
-				err = deleteResource(rbdExamplePath + "storageclass.yaml")
-				if err != nil {
-					e2elog.Failf("failed to delete storageclass: %v", err)
-				}
-				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+				// Block PVC resize
+				err = resizePVCAndValidateSize(rawPvcPath, rawAppPath, f)
 				if err != nil {
-					e2elog.Failf("failed to create storageclass: %v", err)
+					e2elog.Failf("failed to resize block PVC: %v", err)
 				}
-			})
-
-			By(
-				"test RBD volume encryption with user secrets based SecretsMetadataKMS with tenant namespace",
-				func() {
-					err := deleteResource(rbdExamplePath + "storageclass.yaml")
-					if err != nil {
-						e2elog.Failf("failed to delete storageclass: %v", err)
-					}
-					scOpts := map[string]string{
-						"encrypted":       "true",
-						"encryptionKMSID": "user-secrets-metadata-test",
-					}
-					err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, scOpts, deletePolicy)
-					if err != nil {
-						e2elog.Failf("failed to create storageclass: %v", err)
-					}
-
-					// PVC creation namespace where secret will be created
-					namespace := f.UniqueName
-
-					// create user Secret
-					err = retryKubectlFile(namespace, kubectlCreate, vaultExamplePath+vaultUserSecret, deployTimeout)
-					if err != nil {
-						e2elog.Failf("failed to create user Secret: %v", err)
-					}
-
-					err = validateEncryptedPVCAndAppBinding(pvcPath, appPath, noKMS, f)
-					if err != nil {
-						e2elog.Failf("failed to validate encrypted pvc: %v", err)
-					}
-					// validate created backend rbd images
-					validateRBDImageCount(f, 0, defaultRBDPool)
-					validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
-
-					// delete user secret
-					err = retryKubectlFile(
-						namespace,
-						kubectlDelete,
-						vaultExamplePath+vaultUserSecret,
-						deployTimeout,
-						"--ignore-not-found=true")
-					if err != nil {
-						e2elog.Failf("failed to delete user Secret: %v", err)
-					}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 
-					err = deleteResource(rbdExamplePath + "storageclass.yaml")
-					if err != nil {
-						e2elog.Failf("failed to delete storageclass: %v", err)
-					}
-					err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
-					if err != nil {
-						e2elog.Failf("failed to create storageclass: %v", err)
-					}
-				})
+				err = deleteResource(rbdExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+			})
 
 			By(
 				"create a PVC and Bind it to an app with journaling/exclusive-lock image-features and rbd-nbd mounter",
@@ -2292,7 +1975,7 @@ var _ = Describe("RBD", func() {
 			})
 
 			By("Validate PVC restore from vaultKMS to vaultTenantSAKMS", func() {
-				restoreSCName := "restore-sc"
+				restoreSCName := resourceName("restore-sc")
 				err := deleteResource(rbdExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
@@ -2347,7 +2030,7 @@ var _ = Describe("RBD", func() {
 			})
 
 			By("Validate PVC-PVC clone with different SC from vaultKMS to vaultTenantSAKMS", func() {
-				restoreSCName := "restore-sc"
+				restoreSCName := resourceName("restore-sc")
 				err := deleteResource(rbdExamplePath + "storageclass.yaml")
 				if err != nil {
 					e2elog.Failf("failed to delete storageclass: %v", err)
@@ -2483,10 +2166,6 @@ var _ = Describe("RBD", func() {
 				}
 			})
 			By("create a Block mode PVC-PVC clone and bind it to an app", func() {
-				_, err := f.ClientSet.Discovery().ServerVersion()
-				if err != nil {
-					e2elog.Failf("failed to get server version: %v", err)
-				}
 				validatePVCClone(
 					defaultCloneCount,
 					rawPvcPath,
@@ -2588,6 +2267,54 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 			})
 
+			By("expand PVCs while the application writes to them", func() {
+				// the default storageclass uses xfs after the resize tests
+				err := resizePVCUnderIO(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to resize xfs PVC under IO: %v", err)
+				}
+				err = resizePVCUnderIO(f, rawPvcPath, rawAppPath)
+				if err != nil {
+					e2elog.Failf("failed to resize block PVC under IO: %v", err)
+				}
+
+				err = deleteResource(rbdExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createRBDStorageClass(
+					f.ClientSet,
+					f,
+					defaultSCName,
+					nil,
+					map[string]string{"csi.storage.k8s.io/fstype": "ext4"},
+					deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				err = resizePVCUnderIO(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to resize ext4 PVC under IO: %v", err)
+				}
+				err = deleteResource(rbdExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createRBDStorageClass(
+					f.ClientSet,
+					f,
+					defaultSCName,
+					nil,
+					map[string]string{"csi.storage.k8s.io/fstype": "xfs"},
+					deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
 			By("Test unmount after nodeplugin restart", func() {
 				pvc, err := loadPVC(pvcPath)
 				if err != nil {
@@ -2715,6 +2442,16 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 			})
 
+			By("validate mount, stats, expansion and retention of an RBD static PVC", func() {
+				err := validateRBDStaticVolumeLifecycle(f, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate lifecycle of rbd static pv: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
 			By("validate failure of RBD static PVC without imageFeatures parameter", func() {
 				err := validateRBDStaticPV(f, rawAppPath, true, true)
 				if err != nil {
@@ -2862,6 +2599,28 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 			})
 
+			By("creating apps in multiple zones, using a topology constrained StorageClass", func() {
+				zonalPool := "zonal-rbd-pool"
+				err := createPool(f, zonalPool)
+				if err != nil {
+					e2elog.Failf("failed to create pool %s: %v", zonalPool, err)
+				}
+				zonePools := map[string]string{
+					fakeZones[0]: rbdTopologyPool,
+					fakeZones[1]: zonalPool,
+				}
+				err = validateZonalProvisioning(f, zonePools, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate provisioning in multiple zones: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				err = deletePool(zonalPool, false, f)
+				if err != nil {
+					e2elog.Failf("failed to delete pool %s: %v", zonalPool, err)
+				}
+			})
+
 			// Mount pvc to pod with invalid mount option,expected that
 			// mounting will fail
 			By("Mount pvc to pod with invalid mount option", func() {
@@ -2932,7 +2691,7 @@ var _ = Describe("RBD", func() {
 				if err != nil {
 					e2elog.Failf("failed to create snapshotclass: %v", err)
 				}
-				cloneSC := "clone-storageclass"
+				cloneSC := resourceName("clone-storageclass")
 				param := map[string]string{
 					"pool": clonePool,
 				}
@@ -2977,6 +2736,33 @@ var _ = Describe("RBD", func() {
 				}
 			})
 
+			By("clone PVCs into StorageClasses with another pool, data pool or encryption", func() {
+				err := validateCrossSCClones(f, pvcPath, appPath, pvcSmartClonePath, appSmartClonePath)
+				if err != nil {
+					e2elog.Failf("failed to validate clones in other StorageClasses: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("create PVCs in an extra pool and reject pools that do not exist", func() {
+				err := validateRBDBackends(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate StorageClasses of other pools: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("reject invalid StorageClass and VolumeSnapshotClass parameters", func() {
+				err := validateRBDInvalidParameters(f, pvcPath, snapshotPath)
+				if err != nil {
+					e2elog.Failf("failed to validate invalid parameters: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
 			By("create ROX PVC clone and mount it to multiple pods", func() {
 				err := createRBDSnapshotClass(f)
 				if err != nil {
@@ -3117,6 +2903,26 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 			})
 
+			By("validate the supported and unsupported access modes", func() {
+				err := validateAccessModes(f, rbdAccessModes, pvcPath, appPath, rawAppPath)
+				if err != nil {
+					e2elog.Failf("failed to validate access modes: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("run restricted workloads with an SELinux level", func() {
+				err := validateRestrictedWorkloads(f, rbdDriverName, rbdDeploymentName, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate restricted workloads: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
 			By("validate PVC mounting if snapshot and parent PVC are deleted", func() {
 				err := createRBDSnapshotClass(f)
 				if err != nil {
@@ -3506,7 +3312,7 @@ var _ = Describe("RBD", func() {
 					}
 				}
 
-				updateConfigMap("e2e-ns")
+				updateConfigMap(resourceName("e2e-ns"))
 				// create rbd provisioner secret
 				key, err := createCephUser(
 					f,
@@ -4214,6 +4020,232 @@ var _ = Describe("RBD", func() {
 				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
 			})
 
+			By("create and delete a journal-less volume", func() {
+				err := validateJournalLessVolume(f)
+				if err != nil {
+					e2elog.Failf("failed to validate journal-less volume: %v", err)
+				}
+			})
+
+			By("validate the metrics of the provisioner and the nodeplugin", func() {
+				if !deployRBD || helmTest {
+					e2elog.Logf("skipping metrics validation, the driver is not deployed by the e2e tests")
+
+					return
+				}
+				err := validateOperationMetrics(f, rbdDeploymentName, rbdDaemonsetName, rbdMetricsPort,
+					defaultRBDPool, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate the metrics of successful operations: %v", err)
+				}
+
+				err = deleteResource(rbdExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil,
+					map[string]string{"pool": "pool-does-not-exist"}, deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				err = validateErrorMetrics(f, rbdDeploymentName, rbdMetricsPort, pvcPath)
+				if err != nil {
+					e2elog.Failf("failed to validate the metrics of failed operations: %v", err)
+				}
+				err = deleteResource(rbdExamplePath + "storageclass.yaml")
+				if err != nil {
+					e2elog.Failf("failed to delete storageclass: %v", err)
+				}
+				err = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+				if err != nil {
+					e2elog.Failf("failed to create storageclass: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("validate the storage capacity tracking of the provisioner", func() {
+				if !deployRBD || helmTest {
+					e2elog.Logf("skipping capacity tracking validation, the driver is not deployed by the e2e tests")
+
+					return
+				}
+				err := validateCapacityTracking(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate storage capacity tracking: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("create clones and restores of one parent at the same time", func() {
+				if !deployRBD || helmTest {
+					e2elog.Logf("skipping concurrent clones, the driver is not deployed by the e2e tests")
+
+					return
+				}
+				err := validateConcurrentClones(f, pvcPath, appPath, snapshotPath, pvcClonePath, appClonePath,
+					pvcSmartClonePath, appSmartClonePath)
+				if err != nil {
+					e2elog.Failf("failed to validate concurrent clones: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("restart the provisioner while creating snapshots and clones", func() {
+				err := createRBDSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create VolumeSnapshotClass: %v", err)
+				}
+				defer func() {
+					err = deleteRBDSnapshotClass()
+					if err != nil {
+						e2elog.Failf("failed to delete VolumeSnapshotClass: %v", err)
+					}
+				}()
+
+				err = validateProvisionerRestartDuringCloning(
+					f,
+					rbdDeploymentName,
+					rbdType,
+					defaultRBDPool,
+					pvcPath,
+					snapshotPath,
+					pvcClonePath,
+					pvcSmartClonePath)
+				if err != nil {
+					e2elog.Failf("failed to validate provisioner restart during cloning: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, snapsType)
+			})
+
+			By("restart the monitors while creating and mounting PVCs", func() {
+				if externalCluster != nil {
+					e2elog.Logf("skipping monitor failover, the monitors are not managed by Rook")
+
+					return
+				}
+				err := validateMonFailover(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate monitor failover: %v", err)
+				}
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("benchmark provisioning, attaching and snapshotting of PVCs", func() {
+				if benchmarkCount == 0 {
+					e2elog.Logf("skipping benchmark, no benchmark-count set")
+
+					return
+				}
+				err := createRBDSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create VolumeSnapshotClass: %v", err)
+				}
+				defer func() {
+					err = deleteRBDSnapshotClass()
+					if err != nil {
+						e2elog.Failf("failed to delete VolumeSnapshotClass: %v", err)
+					}
+				}()
+
+				err = runBenchmark(f, "rbd", pvcPath, appPath, snapshotPath)
+				if err != nil {
+					e2elog.Failf("benchmark failed: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, snapsType)
+			})
+
+			By("take many snapshots of one PVC, list and restore them", func() {
+				if snapshotScaleCount == 0 {
+					e2elog.Logf("skipping snapshot scale, no snapshot-scale-count set")
+
+					return
+				}
+				err := createRBDSnapshotClass(f)
+				if err != nil {
+					e2elog.Failf("failed to create VolumeSnapshotClass: %v", err)
+				}
+				defer func() {
+					err = deleteRBDSnapshotClass()
+					if err != nil {
+						e2elog.Failf("failed to delete VolumeSnapshotClass: %v", err)
+					}
+				}()
+
+				driver := snapshotScaleDriver{
+					name:           "rbd",
+					deploymentName: rbdDeploymentName,
+					containerName:  "csi-rbdplugin",
+					secretName:     rbdProvisionerSecretName,
+				}
+				err = runSnapshotScale(f, driver, pvcPath, appPath, snapshotPath, pvcClonePath, appClonePath)
+				if err != nil {
+					e2elog.Failf("snapshot scale failed: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, snapsType)
+			})
+
+			By("measure the attach-to-ready and first-write latency against the SLOs", func() {
+				if latencySLOSamples == 0 {
+					e2elog.Logf("skipping latency SLOs, no latency-slo-samples set")
+
+					return
+				}
+				for _, vt := range []latencyVolumeType{
+					{name: "rbd-filesystem", pvcPath: pvcPath, appPath: appPath},
+					{name: "rbd-block", pvcPath: rawPvcPath, appPath: rawAppPath},
+				} {
+					err := validateLatencySLOs(f, vt)
+					if err != nil {
+						e2elog.Failf("latency SLOs failed: %v", err)
+					}
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("fence a failed node and take over its volume on another node", func() {
+				err := validateNetworkFence(f)
+				if err != nil {
+					e2elog.Failf("failed to validate network fence: %v", err)
+				}
+				err = validateNodeFailover(f, pvcPath, appPath)
+				if err != nil {
+					e2elog.Failf("failed to validate node failover: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
+			By("replicate a PVC to the peer cluster, fail over, run a workload on the peer and fail back", func() {
+				if peerRookNamespace == "" {
+					e2elog.Logf("skipping mirroring test, no peer cluster configured")
+
+					return
+				}
+				err := validateVolumeReplication(pvcPath, appPath, f)
+				if err != nil {
+					e2elog.Failf("failed to validate volume replication: %v", err)
+				}
+				// validate created backend rbd images
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+			})
+
 			// Make sure this should be last testcase in this file, because
 			// it deletes pool
 			By("Create a PVC and delete PVC when backend pool deleted", func() {
@@ -18,8 +18,8 @@ package e2e
 
 import (
 	"context"
+	"encoding/hex"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"regexp"
 	"strings"
@@ -31,6 +31,7 @@ import (
 	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
 	v1 "k8s.io/api/core/v1"
 	scv1 "k8s.io/api/storage/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
@@ -231,7 +232,7 @@ func createRBDSecret(f *framework.Framework, secretName, userName, userKey strin
 	if secretName != "" {
 		sc.Name = secretName
 	}
-	sc.StringData["userID"] = userName
+	sc.StringData["userID"] = resourceName(userName)
 	sc.StringData["userKey"] = userKey
 	sc.Namespace = cephCSINamespace
 	_, err = f.ClientSet.CoreV1().Secrets(cephCSINamespace).Create(context.TODO(), &sc, metav1.CreateOptions{})
@@ -276,6 +277,14 @@ func getImageInfoFromPVC(pvcNamespace, pvcName string, f *framework.Framework) (
 }
 
 func getImageMeta(rbdImageSpec, metaKey string, f *framework.Framework) (string, error) {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return "", err
+	}
+	if cv != nil {
+		return cv.getImageMeta(rbdImageSpec, metaKey)
+	}
+
 	cmd := fmt.Sprintf("rbd image-meta get %s %s", rbdImageSpec, metaKey)
 	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
 	if err != nil {
@@ -310,20 +319,10 @@ func validateImageOwner(pvcPath string, f *framework.Framework) error {
 		return err
 	}
 
-	stdOut, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf(
-			"rados %s getomapval csi.volume.%s %s",
-			rbdOptions(defaultRBDPool),
-			imageData.imageID,
-			ownerKey),
-		rookNamespace)
+	stdOut, err := getImageJournalValue(f, defaultRBDPool, imageData.imageID, ownerKey)
 	if err != nil {
 		return err
 	}
-	if stdErr != "" {
-		return fmt.Errorf("failed to getomapval %v", stdErr)
-	}
 
 	if radosNamespace != "" {
 		e2elog.Logf(
@@ -342,6 +341,32 @@ func validateImageOwner(pvcPath string, f *framework.Framework) error {
 	return deletePVCAndValidatePV(f.ClientSet, pvc, deployTimeout)
 }
 
+// getImageJournalValue returns the value of the key in the journal of the
+// image with the imageID.
+func getImageJournalValue(f *framework.Framework, pool, imageID, key string) (string, error) {
+	oid := "csi.volume." + imageID
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return "", err
+	}
+	if cv != nil {
+		return cv.getOmapValue(pool, oid, key)
+	}
+
+	stdOut, stdErr, err := execCommandInToolBoxPod(
+		f,
+		fmt.Sprintf("rados %s getomapval %s %s", rbdOptions(pool), oid, key),
+		rookNamespace)
+	if err != nil {
+		return "", err
+	}
+	if stdErr != "" {
+		return "", fmt.Errorf("failed to getomapval %v", stdErr)
+	}
+
+	return stdOut, nil
+}
+
 func logErrors(f *framework.Framework, msg string, wgErrs []error) int {
 	failures := 0
 	for i, err := range wgErrs {
@@ -497,6 +522,14 @@ func validateEncryptedPVCAndAppBinding(pvcPath, appPath string, kms kmsConfig, f
 	if err != nil {
 		return err
 	}
+	err = validateLUKSHeader(f, rbdImageSpec)
+	if err != nil {
+		return err
+	}
+	err = validatePlaintextAbsent(f, rbdImageSpec, app)
+	if err != nil {
+		return err
+	}
 
 	if kms != noKMS && kms.canGetPassphrase() {
 		// check new passphrase created
@@ -583,24 +616,129 @@ func validateEncryptedImage(f *framework.Framework, rbdImageSpec, pvName, appNam
 	return nil
 }
 
-func listRBDImages(f *framework.Framework, pool string) ([]string, error) {
-	var imgInfos []string
+// luksMagic is the start of the header of a LUKS device.
+const luksMagic = "LUKS\xba\xbe"
+
+// validateLUKSHeader reads the first data object of the RBD image, and checks
+// that it starts with a LUKS header. This proves that the data is stored
+// encrypted in the Ceph cluster, independent of how the volume is mounted.
+// Clones may not have the object before it is written, only use it for
+// images that were formatted by Ceph-CSI.
+func validateLUKSHeader(f *framework.Framework, rbdImageSpec string) error {
+	info, err := cephJSON[imageInfo](f, "rbd info "+rbdImageSpec)
+	if err != nil {
+		return fmt.Errorf("failed to get rbd info of %s: %w", rbdImageSpec, err)
+	}
 
-	stdout, stdErr, err := execCommandInToolBoxPod(f,
-		fmt.Sprintf("rbd ls --format=json %s", rbdOptions(pool)), rookNamespace)
+	pool := strings.SplitN(rbdImageSpec, "/", 2)[0]
+	object := info.BlockNamePrefix + ".0000000000000000"
+	stdOut, stdErr, err := execCommandInToolBoxPod(
+		f,
+		// rados fails with EPIPE when head exits, only the output matters
+		fmt.Sprintf("rados %s get %s - 2>/dev/null | head -c %d | od -An -tx1",
+			rbdOptions(pool), object, len(luksMagic)),
+		rookNamespace)
+	if err != nil {
+		return fmt.Errorf("failed to read object %s of image %s: %w", object, rbdImageSpec, err)
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to read object %s of image %s: %v", object, rbdImageSpec, stdErr)
+	}
+	header := strings.Join(strings.Fields(stdOut), "")
+	if header != hex.EncodeToString([]byte(luksMagic)) {
+		return fmt.Errorf("image %s does not start with a LUKS header, got %q", rbdImageSpec, header)
+	}
+
+	return nil
+}
+
+// plaintextFileSize is the size of the file with the plaintext marker, it
+// spans multiple blocks of the filesystem.
+const plaintextFileSize = 1024 * 1024
+
+// dataObjects returns the names of the data objects of the image with the
+// block name prefix.
+func dataObjects(objects []string, blockNamePrefix string) []string {
+	data := []string{}
+	for _, object := range objects {
+		if strings.HasPrefix(object, blockNamePrefix+".") {
+			data = append(data, object)
+		}
+	}
+
+	return data
+}
+
+// validatePlaintextAbsent writes a file with a plaintext marker to the volume
+// of the app, and reads all data objects of the RBD image in the Ceph
+// cluster. None of them may contain the marker. Unlike validateLUKSHeader,
+// this proves that the data is encrypted, and not only the header written.
+func validatePlaintextAbsent(f *framework.Framework, rbdImageSpec string, app *v1.Pod) error {
+	parts := strings.Split(rbdImageSpec, "/")
+	pool, image := parts[0], parts[len(parts)-1]
+	marker := "ceph-csi-e2e-plaintext-" + image
+
+	mountPath := app.Spec.Containers[0].VolumeMounts[0].MountPath
+	cmd := fmt.Sprintf("yes %s | head -c %d > %s/plaintext && sync", marker, plaintextFileSize, mountPath)
+	_, stdErr, err := execCommandInPodWithName(f, cmd, app.Name, app.Spec.Containers[0].Name, app.Namespace)
 	if err != nil {
-		return imgInfos, err
+		return fmt.Errorf("failed to write plaintext marker: %w", err)
 	}
 	if stdErr != "" {
-		return imgInfos, fmt.Errorf("failed to list images %v", stdErr)
+		return fmt.Errorf("failed to write plaintext marker: %s", stdErr)
 	}
 
-	err = json.Unmarshal([]byte(stdout), &imgInfos)
+	info, err := getImageInfo(f, image, pool)
 	if err != nil {
-		return imgInfos, err
+		return err
 	}
 
-	return imgInfos, nil
+	var objects []string
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		objects, err = cv.objectsContaining(pool, info.BlockNamePrefix, info.ObjectSize, []byte(marker))
+		if err != nil {
+			return err
+		}
+	} else {
+		var stdOut string
+		opts := rbdOptions(pool)
+		stdOut, stdErr, err = execCommandInToolBoxPod(
+			f,
+			// rados fails with EPIPE when grep exits, only the output of grep matters
+			fmt.Sprintf("for o in $(rados %[1]s ls | grep '^%[2]s\\.'); do "+
+				"rados %[1]s get $o - 2>/dev/null | grep -qa %[3]s && echo $o; done",
+				opts, info.BlockNamePrefix, marker),
+			rookNamespace)
+		if err != nil {
+			return fmt.Errorf("failed to read data objects of image %s: %w", rbdImageSpec, err)
+		}
+		if stdErr != "" {
+			return fmt.Errorf("failed to read data objects of image %s: %v", rbdImageSpec, stdErr)
+		}
+		objects = strings.Fields(stdOut)
+	}
+
+	if len(objects) != 0 {
+		return fmt.Errorf("plaintext marker of image %s found in objects %v", rbdImageSpec, objects)
+	}
+
+	return nil
+}
+
+func listRBDImages(f *framework.Framework, pool string) ([]string, error) {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return nil, err
+	}
+	if cv != nil {
+		return cv.listRBDImages(pool)
+	}
+
+	return cephJSON[[]string](f, "rbd ls "+rbdOptions(pool))
 }
 
 func deleteBackingRBDImage(f *framework.Framework, pvc *v1.PersistentVolumeClaim) error {
@@ -615,23 +753,26 @@ func deleteBackingRBDImage(f *framework.Framework, pvc *v1.PersistentVolumeClaim
 	return err
 }
 
-//nolint:unused // required for reclaimspace e2e.
 // rbdDuImage contains the disk-usage statistics of an RBD image.
+//
+//nolint:unused // required for reclaimspace e2e.
 type rbdDuImage struct {
 	Name            string `json:"name"`
 	ProvisionedSize uint64 `json:"provisioned_size"`
 	UsedSize        uint64 `json:"used_size"`
 }
 
-//nolint:unused // required for reclaimspace e2e.
 // rbdDuImageList contains the list of images returned by 'rbd du'.
+//
+//nolint:unused // required for reclaimspace e2e.
 type rbdDuImageList struct {
 	Images []*rbdDuImage `json:"images"`
 }
 
-//nolint:deadcode,unused // required for reclaimspace e2e.
 // getRbdDu runs 'rbd du' on the RBD image and returns a rbdDuImage struct with
 // the result.
+//
+//nolint:deadcode,unused // required for reclaimspace e2e.
 func getRbdDu(f *framework.Framework, pvc *v1.PersistentVolumeClaim) (*rbdDuImage, error) {
 	rdil := rbdDuImageList{}
 
@@ -660,11 +801,12 @@ func getRbdDu(f *framework.Framework, pvc *v1.PersistentVolumeClaim) (*rbdDuImag
 	return nil, fmt.Errorf("image %s not found", imageData.imageName)
 }
 
-//nolint:deadcode,unused // required for reclaimspace e2e.
 // sparsifyBackingRBDImage runs `rbd sparsify` on the RBD image. Once done, all
 // data blocks that contain zeros are discarded/trimmed/unmapped and do not
 // take up any space anymore. This can be used to verify that an empty, but
 // allocated (with zerofill) extents have been released.
+//
+//nolint:deadcode,unused // required for reclaimspace e2e.
 func sparsifyBackingRBDImage(f *framework.Framework, pvc *v1.PersistentVolumeClaim) error {
 	imageData, err := getImageInfoFromPVC(pvc.Namespace, pvc.Name, f)
 	if err != nil {
@@ -725,6 +867,25 @@ func createPool(f *framework.Framework, name string) error {
 	return err
 }
 
+// createRBDPool creates a pool for RBD images, and the rados namespace of
+// the tests in it when they use one.
+func createRBDPool(f *framework.Framework, name string) error {
+	err := createPool(f, name)
+	if err != nil {
+		return fmt.Errorf("failed to create pool %s: %w", name, err)
+	}
+	if radosNamespace != "" {
+		_, stdErr, nsErr := execCommandInToolBoxPod(f,
+			fmt.Sprintf("rbd pool init %[1]s && rbd namespace create %[2]s", name, rbdOptions(name)),
+			rookNamespace)
+		if nsErr != nil || stdErr != "" {
+			return fmt.Errorf("failed to create rbd namespace in pool %s: %v, stdErr: %s", name, nsErr, stdErr)
+		}
+	}
+
+	return nil
+}
+
 func getPVCImageInfoInPool(f *framework.Framework, pvc *v1.PersistentVolumeClaim, pool string) (string, error) {
 	imageData, err := getImageInfoFromPVC(pvc.Namespace, pvc.Name, f)
 	if err != nil {
@@ -900,45 +1061,26 @@ type trashInfo struct {
 
 // listRBDImagesInTrash lists images in the trash.
 func listRBDImagesInTrash(f *framework.Framework, poolName string) ([]trashInfo, error) {
-	var trashInfos []trashInfo
-
-	stdout, stdErr, err := execCommandInToolBoxPod(f,
-		fmt.Sprintf("rbd trash ls --format=json %s", rbdOptions(poolName)), rookNamespace)
+	cv, err := getCephVerifier(f)
 	if err != nil {
-		return trashInfos, err
-	}
-	if stdErr != "" {
-		return trashInfos, fmt.Errorf("failed to list images in trash %v", stdErr)
+		return nil, err
 	}
-
-	err = json.Unmarshal([]byte(stdout), &trashInfos)
-	if err != nil {
-		return trashInfos, err
+	if cv != nil {
+		return cv.listRBDImagesInTrash(poolName)
 	}
 
-	return trashInfos, nil
+	return cephJSON[[]trashInfo](f, "rbd trash ls "+rbdOptions(poolName))
 }
 
 func waitToRemoveImagesFromTrash(f *framework.Framework, poolName string, t int) error {
-	var errReason error
 	timeout := time.Duration(t) * time.Minute
-	err := wait.PollImmediate(poll, timeout, func() (bool, error) {
-		imagesInTrash, err := listRBDImagesInTrash(f, poolName)
-		if err != nil {
-			return false, err
-		}
-		if len(imagesInTrash) == 0 {
-			return true, nil
-		}
-		errReason = fmt.Errorf("found %d images found in trash. Image details %v", len(imagesInTrash), imagesInTrash)
-		e2elog.Logf(errReason.Error())
-
-		return false, nil
-	})
-
-	if errors.Is(err, wait.ErrWaitTimeout) {
-		err = errReason
-	}
+	_, err := waitForState(
+		"trash of pool "+poolName,
+		func() ([]trashInfo, error) {
+			return listRBDImagesInTrash(f, poolName)
+		},
+		emptyList[trashInfo]("empty"),
+		timeout)
 
 	return err
 }
@@ -949,29 +1091,18 @@ type imageInfo struct {
 	StripeUnit  int    `json:"stripe_unit"`
 	StripeCount int    `json:"stripe_count"`
 	ObjectSize  int    `json:"object_size"`
+	// BlockNamePrefix is the prefix of the names of the data objects
+	BlockNamePrefix string `json:"block_name_prefix"`
 }
 
 // getImageInfo queries rbd about the given image and returns its metadata, and returns
 // error if provided image is not found.
 func getImageInfo(f *framework.Framework, imageName, poolName string) (imageInfo, error) {
 	// rbd --format=json info [image-spec | snap-spec]
-	var imgInfo imageInfo
-
-	stdOut, stdErr, err := execCommandInToolBoxPod(
-		f,
-		fmt.Sprintf("rbd info %s %s --format json", rbdOptions(poolName), imageName),
-		rookNamespace)
+	imgInfo, err := cephJSON[imageInfo](f, fmt.Sprintf("rbd info %s %s", rbdOptions(poolName), imageName))
 	if err != nil {
 		return imgInfo, fmt.Errorf("failed to get rbd info: %w", err)
 	}
-	if stdErr != "" {
-		return imgInfo, fmt.Errorf("failed to get rbd info: %v", stdErr)
-	}
-	err = json.Unmarshal([]byte(stdOut), &imgInfo)
-	if err != nil {
-		return imgInfo, fmt.Errorf("unmarshal failed: %w. raw buffer response: %s",
-			err, stdOut)
-	}
 
 	return imgInfo, nil
 }
@@ -1008,3 +1139,63 @@ func validateStripe(f *framework.Framework,
 
 	return nil
 }
+
+// createRBDImage creates an image with the layering feature and the size,
+// like "4Gi", in the pool.
+func createRBDImage(f *framework.Framework, pool, name, size string) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		quantity := resource.MustParse(size)
+
+		return cv.createRBDImage(pool, name, uint64(quantity.Value()))
+	}
+
+	cmd := fmt.Sprintf("rbd create %s --size=%s --image-feature=layering %s", name, size, rbdOptions(pool))
+	_, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if err != nil {
+		return err
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to create rbd image %s: %v", name, stdErr)
+	}
+
+	return nil
+}
+
+// resizeRBDImage changes the size of the image in the pool to the size, like
+// "8Gi".
+func resizeRBDImage(f *framework.Framework, pool, name, size string) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		quantity := resource.MustParse(size)
+
+		return cv.resizeRBDImage(pool, name, uint64(quantity.Value()))
+	}
+
+	cmd := fmt.Sprintf("rbd resize %s --size=%s %s", name, size, rbdOptions(pool))
+	_, _, err = execCommandInToolBoxPod(f, cmd, rookNamespace)
+
+	return err
+}
+
+// removeRBDImage removes the image from the pool.
+func removeRBDImage(f *framework.Framework, pool, name string) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		return cv.removeRBDImage(pool, name)
+	}
+
+	cmd := fmt.Sprintf("rbd rm %s %s", name, rbdOptions(pool))
+	_, _, err = execCommandInToolBoxPod(f, cmd, rookNamespace)
+
+	return err
+}
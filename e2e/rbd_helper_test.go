@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDataObjects(t *testing.T) {
+	t.Parallel()
+	objects := []string{
+		"rbd_directory",
+		"rbd_header.10b6d4a4b5c5",
+		"rbd_data.10b6d4a4b5c5.0000000000000000",
+		"rbd_data.10b6d4a4b5c5.00000000000000ff",
+		"rbd_data.10b6d4a4b5c51.0000000000000000",
+		"rbd_data.2f4a1b8c9d3e.0000000000000000",
+	}
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "objects of the image",
+			prefix: "rbd_data.10b6d4a4b5c5",
+			want: []string{
+				"rbd_data.10b6d4a4b5c5.0000000000000000",
+				"rbd_data.10b6d4a4b5c5.00000000000000ff",
+			},
+		},
+		{
+			name:   "image without objects",
+			prefix: "rbd_data.5e8f7a6b4c3d",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := dataObjects(objects, ts.prefix); !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("dataObjects() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,415 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// journalOwnerKey is the key of a reservation in the RBD journals that holds
+// the namespace of the PVC. CephFS does not set it.
+const journalOwnerKey = "csi.volume.owner"
+
+// reservation is a UUID in a CSI journal, the image, subvolume or snapshot
+// in the backend is named after it.
+type reservation struct {
+	journal csiJournal
+	uuid    string
+}
+
+func (r reservation) String() string {
+	return r.journal.namePrefix + r.uuid
+}
+
+// reservationOf returns the reservation that the image, subvolume or
+// snapshot is named after, and false for names that are not from a journal.
+func reservationOf(name string) (reservation, bool) {
+	for _, j := range []csiJournal{volumeJournal, snapshotJournal} {
+		if !strings.HasPrefix(name, j.namePrefix) {
+			continue
+		}
+		uuid := strings.TrimSuffix(strings.TrimPrefix(name, j.namePrefix), tempCloneSuffix)
+		if uuid == "" {
+			return reservation{}, false
+		}
+
+		return reservation{journal: j, uuid: uuid}, true
+	}
+
+	return reservation{}, false
+}
+
+// reservationsIn returns the reservations of the journal objects in the
+// objects of a pool.
+func reservationsIn(objects []string) []reservation {
+	reservations := []reservation{}
+	for _, j := range []csiJournal{volumeJournal, snapshotJournal} {
+		for _, obj := range objects {
+			if obj != j.directory && strings.HasPrefix(obj, j.objectPrefix) {
+				reservations = append(reservations, reservation{journal: j, uuid: strings.TrimPrefix(obj, j.objectPrefix)})
+			}
+		}
+	}
+
+	return reservations
+}
+
+// metadataNamespace returns the namespace of the PVC or VolumeSnapshot in the
+// metadata of an image, subvolume or snapshot.
+func metadataNamespace(metadata map[string]string) string {
+	if ns := metadata[pvcNamespaceKey]; ns != "" {
+		return ns
+	}
+
+	return metadata[volSnapNamespaceKey]
+}
+
+// orphanReaper removes the images, subvolumes, snapshots and journal entries
+// that a failed spec left behind, so that the specs that follow do not fail
+// on them. Only the resources of the namespace of the spec are removed.
+type orphanReaper struct {
+	driver string
+	// pool of the journal, the metadata pool of the filesystem for CephFS
+	pool string
+	// sources are the subvolumes of the CephFS snapshots
+	sources map[string]string
+}
+
+func newOrphanReaper(driver, pool string) *orphanReaper {
+	return &orphanReaper{
+		driver: driver,
+		pool:   pool,
+	}
+}
+
+// reap deletes the pods, VolumeSnapshots and PVCs of the namespace of the
+// spec, and gives the provisioner the chance to delete their volumes. What is
+// left of them in the Ceph cluster is removed afterwards.
+func (r *orphanReaper) reap(f *framework.Framework) error {
+	err := deleteNamespaceVolumes(f)
+	if err != nil {
+		return err
+	}
+	r.sources = map[string]string{}
+	orphans, err := r.orphans(f, f.UniqueName)
+	if err != nil {
+		return err
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+	e2elog.Logf("removing %s left behind by %s: %v", r.driver, f.UniqueName, orphans)
+
+	// clones and restores need to be removed before their parents, a
+	// removal that fails is retried as long as others succeed
+	pending := orphans
+	for len(pending) != 0 {
+		failed := []reservation{}
+		var lastErr error
+		for _, o := range pending {
+			rmErr := r.removeBackend(f, o)
+			if rmErr != nil {
+				failed = append(failed, o)
+				lastErr = rmErr
+			}
+		}
+		if len(failed) == len(pending) {
+			return fmt.Errorf("failed to remove %v: %w", failed, lastErr)
+		}
+		pending = failed
+	}
+
+	for _, o := range orphans {
+		err = r.removeJournal(f, o)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// orphans returns the reservations of the namespace, found by the owner in the
+// journal or the metadata on the image, subvolume or snapshot.
+func (r *orphanReaper) orphans(f *framework.Framework, namespace string) ([]reservation, error) {
+	owners, err := r.backendOwners(f)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := listRadosLines(f, "rados ls "+journalRadosOptions(r.driver, r.pool))
+	if err != nil {
+		return nil, err
+	}
+	for _, res := range reservationsIn(objects) {
+		if owners[res] != "" || r.driver != rbdType {
+			continue
+		}
+		owners[res], err = r.journalValue(f, res, journalOwnerKey)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	orphans := []reservation{}
+	for res, owner := range owners {
+		if owner == namespace {
+			orphans = append(orphans, res)
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		return orphans[i].String() < orphans[j].String()
+	})
+
+	return orphans, nil
+}
+
+// backendOwners returns the namespace in the metadata of each image,
+// subvolume and snapshot in the backend.
+func (r *orphanReaper) backendOwners(f *framework.Framework) (map[reservation]string, error) {
+	owners := map[reservation]string{}
+	if r.driver == rbdType {
+		images, err := listRBDImages(f, r.pool)
+		if err != nil {
+			return nil, err
+		}
+		for _, image := range images {
+			res, ok := reservationOf(image)
+			if !ok {
+				continue
+			}
+			metadata, metaErr := cephJSON[map[string]string](f,
+				fmt.Sprintf("rbd image-meta list %s --image=%s", rbdOptions(r.pool), image))
+			if metaErr != nil {
+				return nil, metaErr
+			}
+			if ns := metadataNamespace(metadata); ns != "" {
+				owners[res] = ns
+			}
+		}
+
+		return owners, nil
+	}
+
+	subvols, err := listCephFSSubVolumes(f, fileSystemName, subvolumegroup)
+	if err != nil {
+		return nil, err
+	}
+	for _, sv := range subvols {
+		metadata, metaErr := cephJSON[map[string]string](f,
+			fmt.Sprintf("ceph fs subvolume metadata ls %s %s --group_name=%s",
+				fileSystemName, sv.Name, subvolumegroup))
+		if metaErr != nil {
+			return nil, metaErr
+		}
+		if res, ok := reservationOf(sv.Name); ok && metadataNamespace(metadata) != "" {
+			owners[res] = metadataNamespace(metadata)
+		}
+
+		snaps, snapErr := listCephFSSnapshots(f, fileSystemName, sv.Name, subvolumegroup)
+		if snapErr != nil {
+			return nil, snapErr
+		}
+		for _, snap := range snaps {
+			res, ok := reservationOf(snap.Name)
+			if !ok {
+				continue
+			}
+			r.sources[res.uuid] = sv.Name
+			metadata, metaErr = cephJSON[map[string]string](f,
+				fmt.Sprintf("ceph fs subvolume snapshot metadata ls %s %s %s --group_name=%s",
+					fileSystemName, sv.Name, snap.Name, subvolumegroup))
+			if metaErr != nil {
+				return nil, metaErr
+			}
+			if ns := metadataNamespace(metadata); ns != "" {
+				owners[res] = ns
+			}
+		}
+	}
+
+	return owners, nil
+}
+
+// removeBackend removes the image, subvolume or snapshot of the reservation.
+// For RBD this includes the intermediate image of a clone.
+func (r *orphanReaper) removeBackend(f *framework.Framework, res reservation) error {
+	name := res.String()
+	if r.driver == rbdType {
+		names := []string{name}
+		if res.journal == volumeJournal {
+			names = append(names, name+tempCloneSuffix)
+		}
+		for _, image := range names {
+			_, err := runInToolbox(f, fmt.Sprintf(
+				"rbd snap purge --no-progress %[1]s --image=%[2]s && rbd rm --no-progress %[1]s --image=%[2]s",
+				rbdOptions(r.pool), image))
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if res.journal == snapshotJournal {
+		source := r.sources[res.uuid]
+		if source == "" {
+			var err error
+			source, err = r.journalValue(f, res, "csi.source")
+			if err != nil || source == "" {
+				return err
+			}
+		}
+		_, err := runInToolbox(f, fmt.Sprintf("ceph fs subvolume snapshot rm %s %s %s --group_name=%s --force",
+			fileSystemName, source, name, subvolumegroup))
+
+		return err
+	}
+
+	_, err := runInToolbox(f, fmt.Sprintf("ceph fs subvolume rm %s %s --group_name=%s --force",
+		fileSystemName, name, subvolumegroup))
+
+	return err
+}
+
+// removeJournal removes the key of the reservation from the directory of the
+// journal, and the object of the reservation.
+func (r *orphanReaper) removeJournal(f *framework.Framework, res reservation) error {
+	opts := journalRadosOptions(r.driver, r.pool)
+	requestName, err := r.journalValue(f, res, res.journal.nameKey)
+	if err != nil {
+		return err
+	}
+	if requestName != "" {
+		_, err = runInToolbox(f, fmt.Sprintf("rados %s rmomapkey %s %s%s",
+			opts, res.journal.directory, res.journal.objectPrefix, requestName))
+		if err != nil {
+			return err
+		}
+	}
+	_, err = runInToolbox(f, fmt.Sprintf("rados %s rm %s%s", opts, res.journal.objectPrefix, res.uuid))
+
+	return err
+}
+
+// journalValue returns the value of the key in the object of the reservation,
+// or an empty string when the object or the key does not exist.
+func (r *orphanReaper) journalValue(f *framework.Framework, res reservation, key string) (string, error) {
+	return runInToolbox(f, fmt.Sprintf("rados %s getomapval %s%s %s /dev/stdout",
+		journalRadosOptions(r.driver, r.pool), res.journal.objectPrefix, res.uuid, key))
+}
+
+// runInToolbox runs the command in the toolbox, and returns its output. Errors
+// about missing objects are ignored, they were removed already. The commands
+// log progress on stderr, only their exit code tells whether they failed.
+func runInToolbox(f *framework.Framework, cmd string) (string, error) {
+	stdOut, stdErr, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	if isMissingError(stdErr) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to run %q: %v, stdErr: %s", cmd, err, stdErr)
+	}
+
+	return strings.TrimSpace(stdOut), nil
+}
+
+// isMissingError returns whether the stderr of a ceph, rados or rbd command is
+// about an object, key, image or subvolume that does not exist.
+func isMissingError(stdErr string) bool {
+	for _, msg := range []string{"No such file or directory", "No such key", "does not exist"} {
+		if strings.Contains(stdErr, msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteNamespaceVolumes deletes the pods, VolumeSnapshots and PVCs in the
+// namespace of the spec, and waits until the provisioner deleted their PVs.
+// PVs that are retained are deleted as well.
+func deleteNamespaceVolumes(f *framework.Framework) error {
+	ns := f.UniqueName
+	err := retryKubectlArgs(ns, kubectlDelete, deployTimeout,
+		"pods,volumesnapshots,pvc", "--all", "--ignore-not-found=true")
+	if err != nil {
+		return fmt.Errorf("failed to delete pods, volumesnapshots and PVCs in %s: %w", ns, err)
+	}
+
+	pvs, err := namespacePVs(f, ns)
+	if err != nil {
+		return err
+	}
+	for i := range pvs {
+		if pvs[i].Spec.PersistentVolumeReclaimPolicy != v1.PersistentVolumeReclaimRetain {
+			continue
+		}
+		err = f.ClientSet.CoreV1().PersistentVolumes().Delete(context.TODO(), pvs[i].Name, metav1.DeleteOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to delete retained PV %s: %w", pvs[i].Name, err)
+		}
+	}
+
+	_, err = waitForState(
+		"PVs of "+ns,
+		func() ([]v1.PersistentVolume, error) {
+			return namespacePVs(f, ns)
+		},
+		stateCondition[[]v1.PersistentVolume]{
+			name: "deleted",
+			met: func(pvs []v1.PersistentVolume) (bool, error) {
+				return len(pvs) == 0, nil
+			},
+			describe: func(pvs []v1.PersistentVolume) string {
+				return fmt.Sprintf("%d PVs", len(pvs))
+			},
+		},
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		// the provisioner retries deleting the volumes that are removed
+		// from the Ceph cluster next
+		e2elog.Logf("PVs of %s are not deleted: %v", ns, err)
+	}
+
+	return nil
+}
+
+// namespacePVs returns the PVs that are bound to PVCs in the namespace.
+func namespacePVs(f *framework.Framework, ns string) ([]v1.PersistentVolume, error) {
+	pvList, err := f.ClientSet.CoreV1().PersistentVolumes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list PVs: %w", err)
+	}
+	pvs := []v1.PersistentVolume{}
+	for i := range pvList.Items {
+		if ref := pvList.Items[i].Spec.ClaimRef; ref != nil && ref.Namespace == ns {
+			pvs = append(pvs, pvList.Items[i])
+		}
+	}
+
+	return pvs, nil
+}
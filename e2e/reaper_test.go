@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReservationOf(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		backend  string
+		expected reservation
+		ok       bool
+	}{
+		{
+			name:     "volume",
+			backend:  "csi-vol-1111",
+			expected: reservation{journal: volumeJournal, uuid: "1111"},
+			ok:       true,
+		},
+		{
+			name:     "temporary clone image",
+			backend:  "csi-vol-1111-temp",
+			expected: reservation{journal: volumeJournal, uuid: "1111"},
+			ok:       true,
+		},
+		{
+			name:     "snapshot",
+			backend:  "csi-snap-2222",
+			expected: reservation{journal: snapshotJournal, uuid: "2222"},
+			ok:       true,
+		},
+		{
+			name:    "static image",
+			backend: "static-image",
+		},
+		{
+			name:    "prefix only",
+			backend: "csi-vol-",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			res, ok := reservationOf(ts.backend)
+			if ok != ts.ok || res != ts.expected {
+				t.Errorf("reservationOf(%q) = %v, %v, expected %v, %v", ts.backend, res, ok, ts.expected, ts.ok)
+			}
+		})
+	}
+}
+
+func TestReservationsIn(t *testing.T) {
+	t.Parallel()
+	objects := []string{
+		"csi.volumes.default",
+		"csi.volume.1111",
+		"csi.snaps.default",
+		"csi.snap.2222",
+		"rbd_directory",
+	}
+	expected := []reservation{
+		{journal: volumeJournal, uuid: "1111"},
+		{journal: snapshotJournal, uuid: "2222"},
+	}
+	if got := reservationsIn(objects); !reflect.DeepEqual(got, expected) {
+		t.Errorf("reservationsIn() = %v, expected %v", got, expected)
+	}
+}
+
+func TestMetadataNamespace(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		metadata map[string]string
+		expected string
+	}{
+		{
+			name:     "volume",
+			metadata: map[string]string{pvcNamespaceKey: "ns-1", pvcNameKey: "pvc"},
+			expected: "ns-1",
+		},
+		{
+			name:     "snapshot",
+			metadata: map[string]string{volSnapNamespaceKey: "ns-2", volSnapNameKey: "snap"},
+			expected: "ns-2",
+		},
+		{
+			name:     "static volume",
+			metadata: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := metadataNamespace(ts.metadata); got != ts.expected {
+				t.Errorf("metadataNamespace() = %q, expected %q", got, ts.expected)
+			}
+		})
+	}
+}
+
+func TestIsMissingError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		stdErr   string
+		expected bool
+	}{
+		{stdErr: "error getting omap value: (2) No such file or directory", expected: true},
+		{stdErr: "Error ENOENT: subvolume 'csi-vol-1111' does not exist", expected: true},
+		{stdErr: "error: No such key: csi.volume.owner", expected: true},
+		{stdErr: "rbd: error: image still has watchers", expected: false},
+		{stdErr: "", expected: false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.stdErr, func(t *testing.T) {
+			t.Parallel()
+			if got := isMissingError(ts.stdErr); got != ts.expected {
+				t.Errorf("isMissingError(%q) = %v, expected %v", ts.stdErr, got, ts.expected)
+			}
+		})
+	}
+}
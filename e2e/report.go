@@ -0,0 +1,213 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	"github.com/onsi/ginkgo/v2/reporters"
+	"github.com/onsi/ginkgo/v2/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientset "k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+	frameworkPod "k8s.io/kubernetes/test/e2e/framework/pod"
+)
+
+// artifactsDir is the directory in --report-dir where the artifacts of the
+// failed specs are collected.
+const artifactsDir = "artifacts"
+
+// toolboxDiagnostics are the commands that are run in the Rook toolbox to
+// collect the state of the Ceph cluster when a spec fails.
+var toolboxDiagnostics = []string{
+	"ceph status",
+	"ceph health detail",
+	"ceph df",
+	"ceph osd pool ls detail",
+	"ceph fs status",
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// fileName returns the text with all characters that are not safe in a file
+// name replaced.
+func fileName(text string) string {
+	const maxLength = 100
+
+	name := unsafeFileNameChars.ReplaceAllString(text, "_")
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+
+	return name
+}
+
+// ReportAfterSuite writes a JUnit XML report for each of the suites (the
+// top-level Describe containers) to --report-dir.
+var _ = ReportAfterSuite("JUnit XML reports", func(report Report) {
+	if framework.TestContext.ReportDir == "" {
+		return
+	}
+
+	suites := []string{}
+	specs := map[string][]types.SpecReport{}
+	for i := range report.SpecReports {
+		// BeforeSuite and AfterSuite nodes are not in a container
+		suite := "setup"
+		if len(report.SpecReports[i].ContainerHierarchyTexts) != 0 {
+			suite = report.SpecReports[i].ContainerHierarchyTexts[0]
+		}
+		if _, ok := specs[suite]; !ok {
+			suites = append(suites, suite)
+		}
+		specs[suite] = append(specs[suite], report.SpecReports[i])
+	}
+
+	for _, suite := range suites {
+		suiteReport := report
+		suiteReport.SuiteDescription = suite
+		suiteReport.SpecReports = specs[suite]
+		suiteReport.SuiteSucceeded = len(suiteReport.SpecReports.WithState(types.SpecStateFailureStates)) == 0
+
+		path := filepath.Join(framework.TestContext.ReportDir, "junit_"+fileName(suite)+".xml")
+		err := reporters.GenerateJUnitReport(suiteReport, path)
+		if err != nil {
+			e2elog.Logf("failed to write JUnit report %s: %v", path, err)
+		}
+	}
+})
+
+// JustAfterEach collects the artifacts of a failed spec before the AfterEach
+// of the suite removes its resources.
+var _ = JustAfterEach(func() {
+	if framework.TestContext.ReportDir == "" || !CurrentSpecReport().Failed() {
+		return
+	}
+
+	collectArtifacts(CurrentSpecReport().FullText())
+})
+
+// collectArtifacts writes the logs of the pods in the cephcsi namespace, the
+// description of the resources in the cephcsi namespace and the namespaces of
+// the tests, and the diagnostics from the Rook toolbox to a directory for the
+// spec in --report-dir.
+func collectArtifacts(spec string) {
+	dir := filepath.Join(framework.TestContext.ReportDir, artifactsDir, fileName(spec))
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		e2elog.Logf("failed to create artifacts directory %s: %v", dir, err)
+
+		return
+	}
+
+	c, err := framework.LoadClientset()
+	if err != nil {
+		e2elog.Logf("failed to load clientset for collecting artifacts: %v", err)
+
+		return
+	}
+
+	collectPodLogs(c, cephCSINamespace, dir)
+
+	namespaces := []string{cephCSINamespace}
+	nsList, err := c.CoreV1().Namespaces().List(context.TODO(), metav1.ListOptions{
+		LabelSelector: "e2e-run=" + string(framework.RunID),
+	})
+	if err != nil {
+		e2elog.Logf("failed to list namespaces of the tests: %v", err)
+	} else {
+		for i := range nsList.Items {
+			namespaces = append(namespaces, nsList.Items[i].Name)
+		}
+	}
+	for _, ns := range namespaces {
+		describe, describeErr := framework.RunKubectl(ns, "describe", "all,pvc,volumesnapshot")
+		if describeErr != nil {
+			describe += fmt.Sprintf("\nfailed to describe resources: %v\n", describeErr)
+		}
+		events, eventsErr := framework.RunKubectl(ns, "get", "events", "--sort-by=.lastTimestamp")
+		if eventsErr != nil {
+			events += fmt.Sprintf("\nfailed to get events: %v\n", eventsErr)
+		}
+		writeArtifact(dir, "describe_"+ns+".txt", describe+"\n"+events)
+	}
+	describe, err := framework.RunKubectl("", "describe", "pv,storageclass,volumesnapshotclass,volumeattachment")
+	if err != nil {
+		describe += fmt.Sprintf("\nfailed to describe resources: %v\n", err)
+	}
+	writeArtifact(dir, "describe_cluster.txt", describe)
+
+	f := &framework.Framework{BaseName: "artifacts", ClientSet: c}
+	diagnostics := ""
+	for _, cmd := range toolboxDiagnostics {
+		stdOut, stdErr, cmdErr := execCommandInToolBoxPod(f, cmd, rookNamespace)
+		diagnostics += fmt.Sprintf("$ %s\n%s%s", cmd, stdOut, stdErr)
+		if cmdErr != nil {
+			diagnostics += fmt.Sprintf("failed to run command: %v\n", cmdErr)
+		}
+		diagnostics += "\n"
+	}
+	writeArtifact(dir, "toolbox.txt", diagnostics)
+
+	e2elog.Logf("collected artifacts of the failed spec in %s", dir)
+}
+
+// collectPodLogs writes the logs of all containers of the pods in the
+// namespace to the directory. The logs of the previous instance of restarted
+// containers are written as well.
+func collectPodLogs(c clientset.Interface, ns, dir string) {
+	podList, err := c.CoreV1().Pods(ns).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		e2elog.Logf("failed to list pods in namespace %s: %v", ns, err)
+
+		return
+	}
+
+	for i := range podList.Items {
+		pod := &podList.Items[i]
+		for _, cs := range pod.Status.ContainerStatuses {
+			logs, logErr := frameworkPod.GetPodLogs(c, ns, pod.Name, cs.Name)
+			if logErr != nil {
+				logs = fmt.Sprintf("failed to get logs: %v\n", logErr)
+			}
+			writeArtifact(dir, fmt.Sprintf("%s_%s.log", pod.Name, cs.Name), logs)
+
+			if cs.RestartCount == 0 {
+				continue
+			}
+			logs, logErr = getPreviousPodLogs(c, ns, pod.Name, cs.Name)
+			if logErr != nil {
+				logs = fmt.Sprintf("failed to get logs: %v\n", logErr)
+			}
+			writeArtifact(dir, fmt.Sprintf("%s_%s.previous.log", pod.Name, cs.Name), logs)
+		}
+	}
+}
+
+func writeArtifact(dir, name, content string) {
+	path := filepath.Join(dir, fileName(name))
+	err := os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		e2elog.Logf("failed to write artifact %s: %v", path, err)
+	}
+}
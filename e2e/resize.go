@@ -121,11 +121,17 @@ func resizePVCAndValidateSize(pvcPath, appPath string, f *framework.Framework) e
 	if err != nil {
 		return fmt.Errorf("failed to get pvc: %w", err)
 	}
+	// the data needs to be intact after the filesystem is grown
+	data := newDataset("resize", 4, 1024)
 	if *pvc.Spec.VolumeMode == v1.PersistentVolumeFilesystem {
 		err = checkDirSize(app, f, &opt, size)
 		if err != nil {
 			return err
 		}
+		err = data.write(f, app)
+		if err != nil {
+			return err
+		}
 	}
 
 	if *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock {
@@ -149,6 +155,10 @@ func resizePVCAndValidateSize(pvcPath, appPath string, f *framework.Framework) e
 		if err != nil {
 			return err
 		}
+		err = data.verify(f, app)
+		if err != nil {
+			return err
+		}
 	}
 
 	if *pvc.Spec.VolumeMode == v1.PersistentVolumeBlock {
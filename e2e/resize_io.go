@@ -0,0 +1,296 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/cloud-provider/volume/helpers"
+	"k8s.io/kubernetes/test/e2e/framework"
+)
+
+const (
+	resizeIOSize         = "1Gi"
+	resizeIOExpandedSize = "5Gi"
+
+	// startDirectIO() writes to the volume until ioStopFile exists. It
+	// counts the writes in ioCountFile, and logs failed writes in
+	// ioErrorsFile.
+	ioCountFile  = "/tmp/io-count"
+	ioErrorsFile = "/tmp/io-errors"
+	ioStopFile   = "/tmp/io-stop"
+	ioDoneFile   = "/tmp/io-done"
+	// ioWriteMiB is the size of each write, the writes go round-robin to
+	// ioWriteSlots offsets within the original size of the volume.
+	ioWriteMiB   = 16
+	ioWriteSlots = 32
+
+	kubeletVolumeCapacityMetric = "kubelet_volume_stats_capacity_bytes"
+)
+
+// startDirectIO starts a process in the app that writes to the target, a
+// file or a block device, with direct IO until ioStopFile exists. Like
+// startBackgroundIO(), the process keeps running after this function returns.
+func startDirectIO(f *framework.Framework, app *v1.Pod, target string) error {
+	script := fmt.Sprintf("i=0; while [ ! -e %[2]s ]; do "+
+		"dd if=/dev/urandom of=%[1]s bs=1M count=%[6]d seek=$(( (i %% %[7]d) * %[6]d )) "+
+		"oflag=direct conv=fsync,notrunc status=none || echo \"write $i failed\" >> %[3]s; "+
+		"i=$((i + 1)); echo $i > %[4]s; done; touch %[5]s",
+		target, ioStopFile, ioErrorsFile, ioCountFile, ioDoneFile, ioWriteMiB, ioWriteSlots)
+	_, err := execInApp(f, app, fmt.Sprintf("nohup sh -c '%s' >/dev/null 2>&1 &", script))
+	if err != nil {
+		return fmt.Errorf("failed to start IO on %s: %w", target, err)
+	}
+
+	return nil
+}
+
+// execInApp executes the command in the first container of the app.
+func execInApp(f *framework.Framework, app *v1.Pod, cmd string) (string, error) {
+	container := app.Spec.Containers[0].Name
+	stdOut, stdErr, err := execCommandInContainerByPodName(f, cmd, app.Namespace, app.Name, container)
+	if err != nil || stdErr != "" {
+		return "", fmt.Errorf("command %q failed in container %s of %s: %v, stdErr: %s",
+			cmd, container, app.Name, err, stdErr)
+	}
+
+	return strings.TrimSpace(stdOut), nil
+}
+
+// ioProgressed returns the condition that is met once startDirectIO() did
+// more writes than done.
+func ioProgressed(done int) stateCondition[int] {
+	return stateCondition[int]{
+		name: fmt.Sprintf("past %d writes", done),
+		met: func(writes int) (bool, error) {
+			return writes > done, nil
+		},
+		describe: func(writes int) string {
+			return fmt.Sprintf("%d writes", writes)
+		},
+	}
+}
+
+// waitForWrites waits until startDirectIO() did more writes than done, and
+// returns the number of writes.
+func waitForWrites(f *framework.Framework, app *v1.Pod, done int) (int, error) {
+	return waitForState(
+		"io of "+app.Name,
+		func() (int, error) {
+			out, err := execInApp(f, app, "cat "+ioCountFile+" 2>/dev/null || echo 0")
+			if err != nil {
+				return 0, err
+			}
+
+			return strconv.Atoi(out)
+		},
+		ioProgressed(done),
+		time.Duration(deployTimeout)*time.Minute)
+}
+
+// stopIO stops startDirectIO(), and returns the failed writes.
+func stopIO(f *framework.Framework, app *v1.Pod) (string, error) {
+	_, err := execInApp(f, app, "touch "+ioStopFile)
+	if err != nil {
+		return "", err
+	}
+	_, err = waitForState(
+		"io of "+app.Name,
+		func() (bool, error) {
+			out, execErr := execInApp(f, app, fmt.Sprintf("test -e %s && echo done || true", ioDoneFile))
+
+			return out == "done", execErr
+		},
+		stateCondition[bool]{
+			name: "stopped",
+			met: func(stopped bool) (bool, error) {
+				return stopped, nil
+			},
+		},
+		time.Duration(deployTimeout)*time.Minute)
+	if err != nil {
+		return "", err
+	}
+
+	return execInApp(f, app, "cat "+ioErrorsFile+" 2>/dev/null || true")
+}
+
+// kubeletVolumeCapacity returns the capacity of the volume of the PVC that
+// the kubelet got with NodeGetVolumeStats, and whether it is reported.
+func kubeletVolumeCapacity(families map[string]*dto.MetricFamily, namespace, pvcName string) (int64, bool) {
+	series := metricSeries{
+		name: kubeletVolumeCapacityMetric,
+		labels: map[string]string{
+			"namespace":             namespace,
+			"persistentvolumeclaim": pvcName,
+		},
+	}
+	family, ok := families[series.name]
+	if !ok {
+		return 0, false
+	}
+	for _, m := range family.GetMetric() {
+		if series.matches(m) {
+			return int64(series.value([]map[string]*dto.MetricFamily{families})), true
+		}
+	}
+
+	return 0, false
+}
+
+// capacityInGiB returns the condition that is met once the capacity rounds up
+// to the size in GiB.
+func capacityInGiB(size string) stateCondition[int64] {
+	return stateCondition[int64]{
+		name: "reporting a capacity of " + size,
+		met: func(capacity int64) (bool, error) {
+			if capacity == 0 {
+				return false, nil
+			}
+			actual, err := helpers.RoundUpToGiB(*resource.NewQuantity(capacity, resource.BinarySI))
+			if err != nil {
+				return false, err
+			}
+			expected, err := helpers.RoundUpToGiB(resource.MustParse(size))
+			if err != nil {
+				return false, err
+			}
+
+			return actual == expected, nil
+		},
+		describe: func(capacity int64) string {
+			return fmt.Sprintf("capacity %d bytes", capacity)
+		},
+	}
+}
+
+// waitForKubeletVolumeCapacity waits until the kubelet on the node of the
+// app reports the size as capacity of the volume of the PVC. The kubelet
+// collects the volume stats periodically.
+func waitForKubeletVolumeCapacity(
+	f *framework.Framework,
+	app *v1.Pod,
+	pvc *v1.PersistentVolumeClaim,
+	size string,
+) error {
+	pod, err := f.ClientSet.CoreV1().Pods(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get pod %s: %w", app.Name, err)
+	}
+	node := pod.Spec.NodeName
+
+	_, err = waitForState(
+		fmt.Sprintf("kubelet on node %s", node),
+		func() (int64, error) {
+			data, getErr := f.ClientSet.CoreV1().RESTClient().Get().
+				Resource("nodes").
+				Name(node).
+				SubResource("proxy").
+				Suffix("metrics").
+				DoRaw(context.TODO())
+			if getErr != nil {
+				return 0, getErr
+			}
+			families, parseErr := parseMetrics(data)
+			if parseErr != nil {
+				return 0, parseErr
+			}
+			capacity, _ := kubeletVolumeCapacity(families, pvc.Namespace, pvc.Name)
+
+			return capacity, nil
+		},
+		capacityInGiB(size),
+		time.Duration(deployTimeout)*time.Minute)
+
+	return err
+}
+
+// resizePVCUnderIO expands the PVC while the app writes to its volume with
+// direct IO. None of the writes may fail, the app needs to see the new size,
+// and the kubelet needs to report it as capacity of the volume.
+func resizePVCUnderIO(f *framework.Framework, pvcPath, appPath string) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	pvc.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(resizeIOSize)
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": "resize-io"}
+	err = createPVCAndApp("resize-io", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	block := len(app.Spec.Containers[0].VolumeDevices) != 0
+	target := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/io-load"
+	if block {
+		target = app.Spec.Containers[0].VolumeDevices[0].DevicePath
+	}
+	err = startDirectIO(f, app, target)
+	if err != nil {
+		return err
+	}
+
+	writes, err := waitForWrites(f, app, 0)
+	if err != nil {
+		return err
+	}
+	err = expandPVCSize(f.ClientSet, pvc, resizeIOExpandedSize, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to expand PVC: %w", err)
+	}
+	opt := metav1.ListOptions{LabelSelector: "app=resize-io"}
+	if block {
+		err = checkDeviceSize(app, f, &opt, resizeIOExpandedSize)
+	} else {
+		err = checkDirSize(app, f, &opt, resizeIOExpandedSize)
+	}
+	if err != nil {
+		return err
+	}
+	// the writes need to continue on the expanded volume
+	_, err = waitForWrites(f, app, writes)
+	if err != nil {
+		return err
+	}
+	failed, err := stopIO(f, app)
+	if err != nil {
+		return err
+	}
+	if failed != "" {
+		return fmt.Errorf("writes failed while the PVC was expanded: %s", failed)
+	}
+
+	err = waitForKubeletVolumeCapacity(f, app, pvc, resizeIOExpandedSize)
+	if err != nil {
+		return err
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestKubeletVolumeCapacity(t *testing.T) {
+	t.Parallel()
+	families, err := parseMetrics([]byte(`# TYPE kubelet_volume_stats_capacity_bytes gauge
+kubelet_volume_stats_capacity_bytes{namespace="ns-a",persistentvolumeclaim="rbd-pvc"} 5.20093696e+09
+kubelet_volume_stats_capacity_bytes{namespace="ns-b",persistentvolumeclaim="rbd-pvc"} 1.02330368e+09
+`))
+	if err != nil {
+		t.Fatalf("parseMetrics() failed: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		namespace string
+		pvc       string
+		capacity  int64
+		reported  bool
+	}{
+		{"reported", "ns-a", "rbd-pvc", 5200936960, true},
+		{"same PVC in other namespace", "ns-b", "rbd-pvc", 1023303680, true},
+		{"not reported", "ns-a", "other-pvc", 0, false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			capacity, reported := kubeletVolumeCapacity(families, ts.namespace, ts.pvc)
+			if capacity != ts.capacity || reported != ts.reported {
+				t.Errorf("kubeletVolumeCapacity() = %d, %v, expected %d, %v",
+					capacity, reported, ts.capacity, ts.reported)
+			}
+		})
+	}
+
+	_, reported := kubeletVolumeCapacity(nil, "ns-a", "rbd-pvc")
+	if reported {
+		t.Errorf("kubeletVolumeCapacity() reported a capacity without metrics")
+	}
+}
+
+func TestCapacityInGiB(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		capacity int64
+		size     string
+		met      bool
+	}{
+		{"not reported yet", 0, "5Gi", false},
+		{"filesystem overhead", 5200936960, "5Gi", true},
+		{"exact size", 5368709120, "5Gi", true},
+		{"size before expansion", 1023303680, "5Gi", false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			met, err := capacityInGiB(ts.size).met(ts.capacity)
+			if err != nil {
+				t.Fatalf("met() failed: %v", err)
+			}
+			if met != ts.met {
+				t.Errorf("met(%d) = %v, expected %v", ts.capacity, met, ts.met)
+			}
+		})
+	}
+}
@@ -77,36 +77,15 @@ func createSnapshot(snap *snapapi.VolumeSnapshot, t int) error {
 	e2elog.Logf("snapshot with name %v created in %v namespace", snap.Name, snap.Namespace)
 
 	timeout := time.Duration(t) * time.Minute
-	name := snap.Name
-	start := time.Now()
-	e2elog.Logf("waiting for %v to be in ready state", snap)
+	_, err = waitForState(
+		fmt.Sprintf("snapshot %s/%s", snap.Namespace, snap.Name),
+		func() (*snapapi.VolumeSnapshot, error) {
+			return sclient.VolumeSnapshots(snap.Namespace).Get(context.TODO(), snap.Name, metav1.GetOptions{})
+		},
+		snapshotReady,
+		timeout)
 
-	return wait.PollImmediate(poll, timeout, func() (bool, error) {
-		e2elog.Logf("waiting for snapshot %s (%d seconds elapsed)", snap.Name, int(time.Since(start).Seconds()))
-		snaps, err := sclient.
-			VolumeSnapshots(snap.Namespace).
-			Get(context.TODO(), name, metav1.GetOptions{})
-		if err != nil {
-			e2elog.Logf("Error getting snapshot in namespace: '%s': %v", snap.Namespace, err)
-			if isRetryableAPIError(err) {
-				return false, nil
-			}
-			if apierrs.IsNotFound(err) {
-				return false, nil
-			}
-
-			return false, fmt.Errorf("failed to get volumesnapshot: %w", err)
-		}
-		if snaps.Status == nil || snaps.Status.ReadyToUse == nil {
-			return false, nil
-		}
-		if *snaps.Status.ReadyToUse {
-			return true, nil
-		}
-		e2elog.Logf("snapshot %s in %v state", snap.Name, *snaps.Status.ReadyToUse)
-
-		return false, nil
-	})
+	return err
 }
 
 func deleteSnapshot(snap *snapapi.VolumeSnapshot, t int) error {
@@ -123,31 +102,13 @@ func deleteSnapshot(snap *snapapi.VolumeSnapshot, t int) error {
 	}
 
 	timeout := time.Duration(t) * time.Minute
-	name := snap.Name
-	start := time.Now()
-	e2elog.Logf("Waiting up to %v to be deleted", snap)
 
-	return wait.PollImmediate(poll, timeout, func() (bool, error) {
-		e2elog.Logf("deleting snapshot %s (%d seconds elapsed)", name, int(time.Since(start).Seconds()))
-		_, err := sclient.
-			VolumeSnapshots(snap.Namespace).
-			Get(context.TODO(), name, metav1.GetOptions{})
-		if err == nil {
-			return false, nil
-		}
-
-		if isRetryableAPIError(err) {
-			return false, nil
-		}
-		if !apierrs.IsNotFound(err) {
-			return false, fmt.Errorf(
-				"get on deleted snapshot %v failed : other than \"not found\": %w",
-				name,
-				err)
-		}
-
-		return true, nil
-	})
+	return waitForDeletion(
+		fmt.Sprintf("snapshot %s/%s", snap.Namespace, snap.Name),
+		func() (*snapapi.VolumeSnapshot, error) {
+			return sclient.VolumeSnapshots(snap.Namespace).Get(context.TODO(), snap.Name, metav1.GetOptions{})
+		},
+		timeout)
 }
 
 func createRBDSnapshotClass(f *framework.Framework) error {
@@ -171,6 +132,56 @@ func createRBDSnapshotClass(f *framework.Framework) error {
 	return err
 }
 
+// createSnapshotClassWithParameters creates the VolumeSnapshotClass of the
+// file with another name, the snapshotter secret, and the parameters. Empty
+// parameters are removed.
+func createSnapshotClassWithParameters(
+	f *framework.Framework,
+	scPath, name, secretName string,
+	parameters map[string]string,
+) error {
+	sc := getSnapshotClass(scPath)
+	sc.Name = name
+	sc.Parameters["csi.storage.k8s.io/snapshotter-secret-namespace"] = cephCSINamespace
+	sc.Parameters["csi.storage.k8s.io/snapshotter-secret-name"] = secretName
+
+	fsID, err := getClusterID(f)
+	if err != nil {
+		return fmt.Errorf("failed to get clusterID: %w", err)
+	}
+	sc.Parameters["clusterID"] = fsID
+	for k, v := range parameters {
+		sc.Parameters[k] = v
+		if v == "" {
+			delete(sc.Parameters, k)
+		}
+	}
+	sclient, err := newSnapshotClient()
+	if err != nil {
+		return err
+	}
+	_, err = sclient.VolumeSnapshotClasses().Create(context.TODO(), &sc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create volumesnapshotclass %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// deleteSnapshotClass deletes the VolumeSnapshotClass with the name.
+func deleteSnapshotClass(name string) error {
+	sclient, err := newSnapshotClient()
+	if err != nil {
+		return err
+	}
+	err = sclient.VolumeSnapshotClasses().Delete(context.TODO(), name, metav1.DeleteOptions{})
+	if apierrs.IsNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
 func deleteRBDSnapshotClass() error {
 	scPath := fmt.Sprintf("%s/%s", rbdExamplePath, "snapshotclass.yaml")
 	sc := getSnapshotClass(scPath)
@@ -335,6 +346,10 @@ func validateBiggerPVCFromSnapshot(f *framework.Framework,
 	if err != nil {
 		return fmt.Errorf("failed to create snapshot: %w", err)
 	}
+	err = validateSnapshotMetadata(f, &snap)
+	if err != nil {
+		return err
+	}
 	err = deletePVCAndApp("", f, pvc, app)
 	if err != nil {
 		return fmt.Errorf("failed to delete pvc and application: %w", err)
@@ -373,42 +388,6 @@ func validateBiggerPVCFromSnapshot(f *framework.Framework,
 			return fmt.Errorf("failed to validate device size: %w", err)
 		}
 
-		// make sure we had unset snapshot metadata on CreateVolume
-		// from snapshot
-		var (
-			volSnapName        string
-			volSnapNamespace   string
-			volSnapContentName string
-			stdErr             string
-			imageList          []string
-		)
-		imageList, err = listRBDImages(f, defaultRBDPool)
-		if err != nil {
-			e2elog.Failf("failed to list rbd images: %v", err)
-		}
-		e2elog.Logf("list of rbd images: %v", imageList)
-		volSnapName, stdErr, err = execCommandInToolBoxPod(f,
-			formatImageMetaGetCmd(defaultRBDPool, imageList[0], volSnapNameKey),
-			rookNamespace)
-		if checkGetKeyError(err, stdErr) {
-			e2elog.Failf("found volume snapshot name %s/%s %s=%s: err=%v stdErr=%q",
-				rbdOptions(defaultRBDPool), imageList[0], volSnapNameKey, volSnapName, err, stdErr)
-		}
-		volSnapNamespace, stdErr, err = execCommandInToolBoxPod(f,
-			formatImageMetaGetCmd(defaultRBDPool, imageList[0], volSnapNamespaceKey),
-			rookNamespace)
-		if checkGetKeyError(err, stdErr) {
-			e2elog.Failf("found volume snapshot namespace %s/%s %s=%s: err=%v stdErr=%q",
-				rbdOptions(defaultRBDPool), imageList[0], volSnapNamespaceKey, volSnapNamespace, err, stdErr)
-		}
-		volSnapContentName, stdErr, err = execCommandInToolBoxPod(f,
-			formatImageMetaGetCmd(defaultRBDPool, imageList[0], volSnapContentNameKey),
-			rookNamespace)
-		if checkGetKeyError(err, stdErr) {
-			e2elog.Failf("found snapshotcontent name %s/%s %s=%s: err=%v stdErr=%q",
-				rbdOptions(defaultRBDPool), imageList[0], volSnapContentNameKey,
-				volSnapContentName, err, stdErr)
-		}
 	}
 	err = deletePVCAndApp("", f, pvcClone, appClone)
 	if err != nil {
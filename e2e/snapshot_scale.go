@@ -0,0 +1,448 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+const (
+	// csiProvisionerSocket is the UNIX domain socket of the CSI server in
+	// the container of the driver in the provisioner.
+	csiProvisionerSocket = "/csi/csi-provisioner.sock"
+
+	// snapshotListPageSize is the number of snapshots that are requested
+	// per page when listing the snapshots of the volume.
+	snapshotListPageSize = 25
+)
+
+// snapshotScaleCount is the number of snapshots that are taken of one PVC,
+// the snapshot scale suite is disabled when it is 0.
+var snapshotScaleCount int
+
+// listAllPages calls list with the token of the previous page, starting with
+// an empty token, until list returns no token. It returns the listed items
+// and the number of pages. Items that are listed twice, and tokens that are
+// returned twice, are an error.
+func listAllPages(list func(token string) ([]string, string, error)) ([]string, int, error) {
+	var (
+		items  []string
+		pages  int
+		token  string
+		seen   = map[string]bool{}
+		tokens = map[string]bool{}
+	)
+	for {
+		page, next, err := list(token)
+		if err != nil {
+			return nil, pages, fmt.Errorf("failed to list page %d: %w", pages+1, err)
+		}
+		pages++
+		for _, item := range page {
+			if seen[item] {
+				return nil, pages, fmt.Errorf("%s is listed again on page %d", item, pages)
+			}
+			seen[item] = true
+			items = append(items, item)
+		}
+		if next == "" {
+			return items, pages, nil
+		}
+		if tokens[next] {
+			return nil, pages, fmt.Errorf("token %q of page %d was returned before", next, pages)
+		}
+		tokens[next] = true
+		token = next
+	}
+}
+
+// compareListed returns an error when the listed items are not the expected
+// items.
+func compareListed(expected, listed []string) error {
+	want := make(map[string]bool, len(expected))
+	for _, item := range expected {
+		want[item] = true
+	}
+	var unexpected []string
+	for _, item := range listed {
+		if !want[item] {
+			unexpected = append(unexpected, item)
+		}
+		delete(want, item)
+	}
+	missing := make([]string, 0, len(want))
+	for item := range want {
+		missing = append(missing, item)
+	}
+	sort.Strings(missing)
+	if len(missing) != 0 || len(unexpected) != 0 {
+		return fmt.Errorf("missing [%s], unexpected [%s]", strings.Join(missing, " "), strings.Join(unexpected, " "))
+	}
+
+	return nil
+}
+
+// expectedPages returns the number of pages of the items, with at most
+// pageSize items per page. An empty list is one page.
+func expectedPages(items, pageSize int) int {
+	if items == 0 {
+		return 1
+	}
+
+	return (items + pageSize - 1) / pageSize
+}
+
+// dialProvisioner connects to the CSI server of a running provisioner pod of
+// the deployment.
+func dialProvisioner(f *framework.Framework, deploymentName, containerName string) (*grpc.ClientConn, error) {
+	podName, err := getRunningDeploymentPod(f, deploymentName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(
+		"passthrough:///csi",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			return dialExec(f, cephCSINamespace, podName, containerName,
+				[]string{"python3", "-c", socketBridge, csiProvisionerSocket})
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to CSI server in pod %s: %w", podName, err)
+	}
+
+	return conn, nil
+}
+
+// hasControllerCapability returns whether the controller advertises the RPC.
+func hasControllerCapability(client csi.ControllerClient, rpc csi.ControllerServiceCapability_RPC_Type) (bool, error) {
+	resp, err := client.ControllerGetCapabilities(context.TODO(), &csi.ControllerGetCapabilitiesRequest{})
+	if err != nil {
+		return false, fmt.Errorf("ControllerGetCapabilities failed: %w", err)
+	}
+	for _, capability := range resp.GetCapabilities() {
+		if capability.GetRpc().GetType() == rpc {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// validateCSIListSnapshots pages through the snapshots of the volume with
+// ListSnapshots of the provisioner, which need to be the snapshot handles.
+// ListSnapshots needs to be Unimplemented when the controller does not
+// advertise LIST_SNAPSHOTS, the snapshotter does not call it then.
+func validateCSIListSnapshots(
+	f *framework.Framework,
+	deploymentName, containerName, secretName, volumeID string,
+	handles []string,
+) error {
+	conn, err := dialProvisioner(f, deploymentName, containerName)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	client := csi.NewControllerClient(conn)
+	supported, err := hasControllerCapability(client, csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS)
+	if err != nil {
+		return err
+	}
+	secrets, err := getSecretData(f, secretName)
+	if err != nil {
+		return err
+	}
+
+	if !supported {
+		_, err = client.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{
+			SourceVolumeId: volumeID,
+			MaxEntries:     snapshotListPageSize,
+			Secrets:        secrets,
+		})
+		if status.Code(err) != codes.Unimplemented {
+			return fmt.Errorf("ListSnapshots without LIST_SNAPSHOTS returned %v, expected %v", err, codes.Unimplemented)
+		}
+		e2elog.Logf("%s does not advertise LIST_SNAPSHOTS, skipping pagination of ListSnapshots", deploymentName)
+
+		return nil
+	}
+
+	listed, pages, err := listAllPages(func(token string) ([]string, string, error) {
+		resp, listErr := client.ListSnapshots(context.TODO(), &csi.ListSnapshotsRequest{
+			SourceVolumeId: volumeID,
+			MaxEntries:     snapshotListPageSize,
+			StartingToken:  token,
+			Secrets:        secrets,
+		})
+		if listErr != nil {
+			return nil, "", listErr
+		}
+		if len(resp.GetEntries()) > snapshotListPageSize {
+			return nil, "", fmt.Errorf("%d snapshots on a page of at most %d", len(resp.GetEntries()),
+				snapshotListPageSize)
+		}
+		ids := make([]string, 0, len(resp.GetEntries()))
+		for _, entry := range resp.GetEntries() {
+			ids = append(ids, entry.GetSnapshot().GetSnapshotId())
+		}
+
+		return ids, resp.GetNextToken(), nil
+	})
+	if err != nil {
+		return fmt.Errorf("ListSnapshots of volume %s: %w", volumeID, err)
+	}
+	if want := expectedPages(len(handles), snapshotListPageSize); pages != want {
+		return fmt.Errorf("ListSnapshots returned %d pages, expected %d", pages, want)
+	}
+	err = compareListed(handles, listed)
+	if err != nil {
+		return fmt.Errorf("ListSnapshots of volume %s: %w", volumeID, err)
+	}
+
+	return nil
+}
+
+// validateSnapshotPages pages through the VolumeSnapshots with the label, in
+// the same way as the snapshot controller lists them, and checks that they
+// are the snapshots with the names.
+func validateSnapshotPages(namespace, label string, names []string) error {
+	sclient, err := newSnapshotClient()
+	if err != nil {
+		return err
+	}
+	listed, pages, err := listAllPages(func(token string) ([]string, string, error) {
+		list, listErr := sclient.VolumeSnapshots(namespace).List(context.TODO(), metav1.ListOptions{
+			LabelSelector: label,
+			Limit:         snapshotListPageSize,
+			Continue:      token,
+		})
+		if listErr != nil {
+			return nil, "", listErr
+		}
+		page := make([]string, 0, len(list.Items))
+		for i := range list.Items {
+			page = append(page, list.Items[i].Name)
+		}
+
+		return page, list.Continue, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list volumesnapshots: %w", err)
+	}
+	if want := expectedPages(len(names), snapshotListPageSize); pages != want {
+		return fmt.Errorf("listing volumesnapshots returned %d pages, expected %d", pages, want)
+	}
+
+	return compareListed(names, listed)
+}
+
+// snapshotHandles returns the handles of the snapshots in the CSI driver.
+func snapshotHandles(snaps []*snapapi.VolumeSnapshot) ([]string, error) {
+	handles := make([]string, 0, len(snaps))
+	for _, snap := range snaps {
+		content, err := getVolumeSnapshotContent(snap.Namespace, snap.Name)
+		if err != nil {
+			return nil, err
+		}
+		if content.Status == nil || content.Status.SnapshotHandle == nil {
+			return nil, fmt.Errorf("volumesnapshotcontent %s has no snapshot handle", content.Name)
+		}
+		handles = append(handles, *content.Status.SnapshotHandle)
+	}
+
+	return handles, nil
+}
+
+// snapshotScaleDriver is the provisioner of the driver that the snapshot
+// scale suite runs against.
+type snapshotScaleDriver struct {
+	name           string
+	deploymentName string
+	containerName  string
+	secretName     string
+}
+
+// runSnapshotScale takes snapshotScaleCount snapshots of one PVC,
+// benchmarkWorkers at a time, after writing a dataset that only the oldest
+// snapshot contains. The snapshots need to be listed completely when paging
+// through the VolumeSnapshots and through ListSnapshots of the driver, the
+// oldest snapshot needs to restore its dataset, and all snapshots are deleted
+// again. The latencies of creating and deleting the snapshots are logged and
+// written to benchmark_snapshot-scale-<name>.json in --report-dir. The
+// VolumeSnapshotClass for the snapshots needs to exist.
+// nolint:gocyclo,cyclop // the steps need to run in order on the same volume
+func runSnapshotScale(
+	f *framework.Framework,
+	driver snapshotScaleDriver,
+	pvcPath, appPath, snapshotPath, pvcClonePath, appClonePath string,
+) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": "snapshot-scale"}
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return err
+	}
+
+	label := "snapshot-scale=" + driver.name
+	snap := getSnapshot(snapshotPath)
+	snaps := make([]*snapapi.VolumeSnapshot, snapshotScaleCount)
+	names := make([]string, snapshotScaleCount)
+	for i := range snaps {
+		snaps[i] = snap.DeepCopy()
+		snaps[i].Name = fmt.Sprintf("snapshot-scale-%d", i)
+		snaps[i].Namespace = f.UniqueName
+		snaps[i].Labels = map[string]string{"snapshot-scale": driver.name}
+		snaps[i].Spec.Source.PersistentVolumeClaimName = &pvc.Name
+		names[i] = snaps[i].Name
+	}
+
+	// the dataset is overwritten after the oldest snapshot is taken
+	oldest := newDataset("snapshot-scale", 2, 64)
+	err = oldest.write(f, app)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = createSnapshot(snaps[0], deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create oldest snapshot: %w", err)
+	}
+	createDurations := []time.Duration{time.Since(start)}
+	err = newDataset("snapshot-scale", 2, 64).write(f, app)
+	if err != nil {
+		return err
+	}
+
+	e2elog.Logf("snapshot scale %s: creating %d snapshots, %d at a time", driver.name, snapshotScaleCount,
+		benchmarkWorkers)
+	durations, createErrs := measureConcurrently(snapshotScaleCount-1, benchmarkWorkers, func(i int) error {
+		return createSnapshot(snaps[i+1], deployTimeout)
+	})
+	createDurations = append(createDurations, durations...)
+	stats := []latencyStats{newLatencyStats("create snapshot", createDurations, len(createErrs))}
+
+	if len(createErrs) == 0 {
+		err = validateSnapshotPages(f.UniqueName, label, names)
+		if err != nil {
+			return err
+		}
+		handles, handlesErr := snapshotHandles(snaps)
+		if handlesErr != nil {
+			return handlesErr
+		}
+		err = validateCSIListSnapshots(f, driver.deploymentName, driver.containerName, driver.secretName,
+			pv.Spec.CSI.VolumeHandle, handles)
+		if err != nil {
+			return err
+		}
+
+		err = validateOldestSnapshotRestore(f, snaps[0], oldest, pvcClonePath, appClonePath)
+		if err != nil {
+			return err
+		}
+	}
+
+	e2elog.Logf("snapshot scale %s: deleting %d snapshots, %d at a time", driver.name, snapshotScaleCount,
+		benchmarkWorkers)
+	start = time.Now()
+	durations, deleteErrs := measureConcurrently(snapshotScaleCount, benchmarkWorkers, func(i int) error {
+		return deleteSnapshot(snaps[i], deployTimeout)
+	})
+	cleanup := time.Since(start)
+	stats = append(stats, newLatencyStats("delete snapshot", durations, len(deleteErrs)))
+	e2elog.Logf("snapshot scale %s with %d snapshots of one PVC and a concurrency of %d, cleanup took %v:\n%s",
+		driver.name, snapshotScaleCount, benchmarkWorkers, cleanup.Round(time.Second), formatLatencyStats(stats))
+	err = writeBenchmarkReport("snapshot-scale-"+driver.name, stats)
+	if err != nil {
+		e2elog.Logf("failed to write snapshot scale report: %v", err)
+	}
+
+	var failures []string
+	for _, createErr := range createErrs {
+		failures = append(failures, fmt.Sprintf("create snapshot: %v", createErr))
+	}
+	for _, deleteErr := range deleteErrs {
+		failures = append(failures, fmt.Sprintf("delete snapshot: %v", deleteErr))
+	}
+	if len(failures) != 0 {
+		return fmt.Errorf("%d snapshot operations failed: %s", len(failures), strings.Join(failures, "; "))
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
+
+// validateOldestSnapshotRestore restores the oldest snapshot, which needs to
+// contain the dataset.
+func validateOldestSnapshotRestore(
+	f *framework.Framework,
+	snap *snapapi.VolumeSnapshot,
+	ds *dataset,
+	pvcClonePath, appClonePath string,
+) error {
+	pvcClone, err := loadPVC(pvcClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvcClone.Namespace = f.UniqueName
+	pvcClone.Spec.DataSource.Name = snap.Name
+	appClone, err := loadApp(appClonePath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	appClone.Namespace = f.UniqueName
+	appClone.Labels = map[string]string{"app": "snapshot-scale-restore"}
+	appClone.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvcClone.Name
+	err = createPVCAndApp("", f, pvcClone, appClone, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to restore snapshot %s: %w", snap.Name, err)
+	}
+	err = ds.verify(f, appClone)
+	if err != nil {
+		return fmt.Errorf("restore of oldest snapshot %s: %w", snap.Name, err)
+	}
+
+	return deletePVCAndApp("", f, pvcClone, appClone)
+}
@@ -0,0 +1,160 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// fakePages returns a list function that returns the pages, with the index
+// of the next page as token.
+func fakePages(pages [][]string, tokens []string) func(token string) ([]string, string, error) {
+	return func(token string) ([]string, string, error) {
+		i := 0
+		if token != "" {
+			var err error
+			i, err = strconv.Atoi(token)
+			if err != nil {
+				return nil, "", err
+			}
+		}
+
+		return pages[i], tokens[i], nil
+	}
+}
+
+func TestListAllPages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name          string
+		pages         [][]string
+		tokens        []string
+		expected      []string
+		expectedPages int
+		wantErr       bool
+	}{
+		{
+			name:          "single page",
+			pages:         [][]string{{"a", "b"}},
+			tokens:        []string{""},
+			expected:      []string{"a", "b"},
+			expectedPages: 1,
+		},
+		{
+			name:          "three pages",
+			pages:         [][]string{{"a", "b"}, {"c", "d"}, {"e"}},
+			tokens:        []string{"1", "2", ""},
+			expected:      []string{"a", "b", "c", "d", "e"},
+			expectedPages: 3,
+		},
+		{
+			name:          "empty list",
+			pages:         [][]string{{}},
+			tokens:        []string{""},
+			expected:      nil,
+			expectedPages: 1,
+		},
+		{
+			name:    "item listed twice",
+			pages:   [][]string{{"a", "b"}, {"b", "c"}},
+			tokens:  []string{"1", ""},
+			wantErr: true,
+		},
+		{
+			name:    "token returned twice",
+			pages:   [][]string{{"a"}, {"b"}, {}},
+			tokens:  []string{"1", "1", ""},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			items, pages, err := listAllPages(fakePages(ts.pages, ts.tokens))
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("listAllPages() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if ts.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(items, ts.expected) || pages != ts.expectedPages {
+				t.Errorf("listAllPages() = %v in %d pages, expected %v in %d pages",
+					items, pages, ts.expected, ts.expectedPages)
+			}
+		})
+	}
+}
+
+func TestCompareListed(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		expected []string
+		listed   []string
+		wantErr  bool
+	}{
+		{
+			name:     "same items in another order",
+			expected: []string{"a", "b", "c"},
+			listed:   []string{"c", "a", "b"},
+		},
+		{
+			name:     "missing item",
+			expected: []string{"a", "b", "c"},
+			listed:   []string{"a", "c"},
+			wantErr:  true,
+		},
+		{
+			name:     "unexpected item",
+			expected: []string{"a"},
+			listed:   []string{"a", "z"},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := compareListed(ts.expected, ts.listed)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("compareListed() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpectedPages(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		items    int
+		expected int
+	}{
+		{items: 0, expected: 1},
+		{items: 1, expected: 1},
+		{items: 25, expected: 1},
+		{items: 26, expected: 2},
+		{items: 300, expected: 12},
+	}
+	for _, ts := range tests {
+		if got := expectedPages(ts.items, 25); got != ts.expected {
+			t.Errorf("expectedPages(%d, 25) = %d, expected %d", ts.items, got, ts.expected)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// csiNodeSocket is the UNIX domain socket of the CSI server in the
+// csi-cephfsplugin container of the nodeplugin.
+const csiNodeSocket = "/csi/csi.sock"
+
+// cephfsClientSession is a session of a CephFS client with the MDS, as
+// reported by "ceph tell mds.<fs>:0 client ls".
+type cephfsClientSession struct {
+	ID int64
+	// Addr is the address of the client, as used in the OSD blocklist
+	Addr string
+	// Root is the path of the filesystem that the client mounted
+	Root   string
+	Kernel bool
+}
+
+// parseClientSessions parses the JSON output of "client ls".
+func parseClientSessions(data []byte) ([]cephfsClientSession, error) {
+	var sessions []struct {
+		ID       int64             `json:"id"`
+		Inst     string            `json:"inst"`
+		Metadata map[string]string `json:"client_metadata"`
+	}
+	err := json.Unmarshal(data, &sessions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse client sessions %q: %w", string(data), err)
+	}
+
+	parsed := make([]cephfsClientSession, 0, len(sessions))
+	for i := range sessions {
+		// "client.4305 v1:10.244.0.1:0/3097940273"
+		fields := strings.Fields(sessions[i].Inst)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected instance %q of client session %d", sessions[i].Inst, sessions[i].ID)
+		}
+		addr := strings.TrimPrefix(strings.TrimPrefix(fields[1], "v1:"), "v2:")
+		_, kernel := sessions[i].Metadata["kernel_version"]
+		parsed = append(parsed, cephfsClientSession{
+			ID:     sessions[i].ID,
+			Addr:   addr,
+			Root:   sessions[i].Metadata["root"],
+			Kernel: kernel,
+		})
+	}
+
+	return parsed, nil
+}
+
+// findKernelSession returns the session of the kernel client that mounted
+// the root.
+func findKernelSession(sessions []cephfsClientSession, root string) (cephfsClientSession, error) {
+	for i := range sessions {
+		if sessions[i].Kernel && sessions[i].Root == root {
+			return sessions[i], nil
+		}
+	}
+
+	return cephfsClientSession{}, fmt.Errorf("no kernel client has %s mounted", root)
+}
+
+// listClientSessions returns the client sessions of the first MDS of the
+// filesystem.
+func listClientSessions(f *framework.Framework, fsName string) ([]cephfsClientSession, error) {
+	stdOut, stdErr, err := execCommandInToolBoxPod(f,
+		fmt.Sprintf("ceph tell mds.%s:0 client ls --format=json", fsName),
+		rookNamespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list client sessions: %w, stdErr: %s", err, stdErr)
+	}
+
+	return parseClientSessions([]byte(stdOut))
+}
+
+// evictClient evicts the client from the filesystem. The verification client
+// can not send commands to the MDS, it blocklists the address of the client
+// instead, which makes the MDS close the session as well.
+func evictClient(f *framework.Framework, fsName string, session cephfsClientSession) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		return cv.blocklistAddr(session.Addr)
+	}
+
+	return execCommandInToolBoxPodAndCheck(f,
+		fmt.Sprintf("ceph tell mds.%s:0 client evict id=%d", fsName, session.ID),
+		rookNamespace)
+}
+
+// removeFromBlocklist removes the address of an evicted client from the OSD
+// blocklist.
+func removeFromBlocklist(f *framework.Framework, addr string) error {
+	cv, err := getCephVerifier(f)
+	if err != nil {
+		return err
+	}
+	if cv != nil {
+		return cv.unblocklistAddr(addr)
+	}
+
+	// "un-blocklisting" is reported on stderr
+	_, _, err = execCommandInToolBoxPod(f, "ceph osd blocklist rm "+addr, rookNamespace)
+
+	return err
+}
+
+// dialNodePlugin connects to the CSI server of the CephFS nodeplugin on the
+// node.
+func dialNodePlugin(f *framework.Framework, nodeName string) (*grpc.ClientConn, error) {
+	opts, err := getCommandInDaemonsetPodOpts(f, "", cephFSDeamonSetName, nodeName, cephFSContainerName,
+		cephCSINamespace)
+	if err != nil {
+		return nil, err
+	}
+	podName := opts.PodName
+
+	conn, err := grpc.Dial(
+		"passthrough:///csi",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(_ context.Context, _ string) (net.Conn, error) {
+			return dialExec(f, cephCSINamespace, podName, cephFSContainerName,
+				[]string{"python3", "-c", socketBridge, csiNodeSocket})
+		}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to CSI server in pod %s: %w", podName, err)
+	}
+
+	return conn, nil
+}
+
+// getVolumeCondition returns the condition of the volume of the PV in the
+// app, as reported by NodeGetVolumeStats of the nodeplugin.
+func getVolumeCondition(f *framework.Framework, app *v1.Pod, pv *v1.PersistentVolume) (*csi.VolumeCondition, error) {
+	pod, err := f.ClientSet.CoreV1().Pods(app.Namespace).Get(context.TODO(), app.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s: %w", app.Name, err)
+	}
+	conn, err := dialNodePlugin(f, pod.Spec.NodeName)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	resp, err := csi.NewNodeClient(conn).NodeGetVolumeStats(context.TODO(), &csi.NodeGetVolumeStatsRequest{
+		VolumeId: pv.Spec.CSI.VolumeHandle,
+		VolumePath: fmt.Sprintf("/var/lib/kubelet/pods/%s/volumes/kubernetes.io~csi/%s/mount",
+			pod.UID, pv.Name),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("NodeGetVolumeStats of %s failed: %w", pv.Name, err)
+	}
+	if resp.GetVolumeCondition() == nil {
+		return nil, fmt.Errorf("NodeGetVolumeStats of %s did not report a volume condition", pv.Name)
+	}
+
+	return resp.GetVolumeCondition(), nil
+}
+
+// volumeConditionIs returns the condition that is met once the volume is
+// reported abnormal, or healthy.
+func volumeConditionIs(abnormal bool) stateCondition[*csi.VolumeCondition] {
+	name := "healthy"
+	if abnormal {
+		name = "abnormal"
+	}
+
+	return stateCondition[*csi.VolumeCondition]{
+		name: name,
+		met: func(condition *csi.VolumeCondition) (bool, error) {
+			return condition.GetAbnormal() == abnormal, nil
+		},
+		describe: func(condition *csi.VolumeCondition) string {
+			return fmt.Sprintf("abnormal=%t: %s", condition.GetAbnormal(), condition.GetMessage())
+		},
+	}
+}
+
+// waitForVolumeCondition waits until the nodeplugin reports the volume of the
+// PV in the app as abnormal, or healthy. The results of NodeGetVolumeStats
+// are cached by the nodeplugin.
+func waitForVolumeCondition(f *framework.Framework, app *v1.Pod, pv *v1.PersistentVolume, abnormal bool) error {
+	_, err := waitForState(
+		"volume of "+app.Name,
+		func() (*csi.VolumeCondition, error) {
+			return getVolumeCondition(f, app, pv)
+		},
+		volumeConditionIs(abnormal),
+		time.Duration(deployTimeout)*time.Minute)
+
+	return err
+}
+
+// validateStaleMountRecovery evicts the CephFS kernel client of a running
+// app. The nodeplugin needs to report the volume as abnormal, and the volume
+// needs to be usable again with its data once the app is restarted, which
+// unmounts the stale mount.
+func validateStaleMountRecovery(f *framework.Framework, pvcPath, appPath string) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	app.Labels = map[string]string{"app": "stale-mount"}
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+	err = createPVCAndApp("", f, pvc, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+	ds := newDataset("stale-mount", 2, 64)
+	err = ds.write(f, app)
+	if err != nil {
+		return err
+	}
+	_, pv, err := getPVCAndPV(f.ClientSet, pvc.Name, pvc.Namespace)
+	if err != nil {
+		return err
+	}
+	err = waitForVolumeCondition(f, app, pv, false)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := listClientSessions(f, fileSystemName)
+	if err != nil {
+		return err
+	}
+	session, err := findKernelSession(sessions, pv.Spec.CSI.VolumeAttributes["subvolumePath"])
+	if err != nil {
+		return err
+	}
+	e2elog.Logf("evicting client %d (%s) of pod %s", session.ID, session.Addr, app.Name)
+	err = evictClient(f, fileSystemName, session)
+	if err != nil {
+		return fmt.Errorf("failed to evict client %d: %w", session.ID, err)
+	}
+	defer func() {
+		blocklistErr := removeFromBlocklist(f, session.Addr)
+		if blocklistErr != nil {
+			e2elog.Failf("failed to remove %s from the blocklist: %v", session.Addr, blocklistErr)
+		}
+	}()
+	err = waitForVolumeCondition(f, app, pv, true)
+	if err != nil {
+		return err
+	}
+
+	// the stale mount needs to be unmounted when the app is deleted, and a
+	// new client mounts the volume for the restarted app
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete application with stale mount: %w", err)
+	}
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to restart application: %w", err)
+	}
+	err = ds.verify(f, app)
+	if err != nil {
+		return err
+	}
+	err = waitForVolumeCondition(f, app, pv, false)
+	if err != nil {
+		return err
+	}
+
+	return deletePVCAndApp("", f, pvc, app)
+}
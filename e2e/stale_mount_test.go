@@ -0,0 +1,100 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseClientSessions(t *testing.T) {
+	t.Parallel()
+	data := []byte(`[
+	{
+		"id": 4305,
+		"inst": "client.4305 v1:10.244.0.1:0/3097940273",
+		"client_metadata": {
+			"root": "/volumes/csi/csi-vol-1111/2222",
+			"kernel_version": "5.15.0",
+			"hostname": "node-1"
+		}
+	},
+	{
+		"id": 4310,
+		"inst": "client.4310 10.244.0.2:0/1234",
+		"client_metadata": {
+			"root": "/volumes/csi/csi-vol-3333/4444",
+			"ceph_version": "ceph version 17.2.3"
+		}
+	}
+]`)
+	expected := []cephfsClientSession{
+		{ID: 4305, Addr: "10.244.0.1:0/3097940273", Root: "/volumes/csi/csi-vol-1111/2222", Kernel: true},
+		{ID: 4310, Addr: "10.244.0.2:0/1234", Root: "/volumes/csi/csi-vol-3333/4444", Kernel: false},
+	}
+	sessions, err := parseClientSessions(data)
+	if err != nil {
+		t.Fatalf("parseClientSessions() failed: %v", err)
+	}
+	if !reflect.DeepEqual(sessions, expected) {
+		t.Errorf("parseClientSessions() = %+v, expected %+v", sessions, expected)
+	}
+
+	_, err = parseClientSessions([]byte(`[{"id": 1, "inst": "client.1"}]`))
+	if err == nil {
+		t.Error("parseClientSessions() of a session without address succeeded")
+	}
+}
+
+func TestFindKernelSession(t *testing.T) {
+	t.Parallel()
+	sessions := []cephfsClientSession{
+		{ID: 1, Root: "/volumes/csi/csi-vol-1111/2222", Kernel: false},
+		{ID: 2, Root: "/volumes/csi/csi-vol-1111/2222", Kernel: true},
+		{ID: 3, Root: "/volumes/csi/csi-vol-3333/4444", Kernel: true},
+	}
+	tests := []struct {
+		name     string
+		root     string
+		expected int64
+		found    bool
+	}{
+		{
+			name:     "kernel client of the root",
+			root:     "/volumes/csi/csi-vol-1111/2222",
+			expected: 2,
+			found:    true,
+		},
+		{
+			name: "unmounted root",
+			root: "/volumes/csi/csi-vol-5555/6666",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			session, err := findKernelSession(sessions, ts.root)
+			if (err == nil) != ts.found {
+				t.Fatalf("findKernelSession(%q) error = %v, expected found=%t", ts.root, err, ts.found)
+			}
+			if session.ID != ts.expected {
+				t.Errorf("findKernelSession(%q) = %d, expected %d", ts.root, session.ID, ts.expected)
+			}
+		})
+	}
+}
@@ -18,13 +18,17 @@ package e2e
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/kubernetes/test/e2e/framework"
 )
 
@@ -322,6 +326,33 @@ func validateRBDStaticMigrationPVC(f *framework.Framework, appPath, scName strin
 	return err
 }
 
+// createCephFSStaticSecret creates the Secret with the userID and userKey of
+// the admin in the cephcsi namespace, static CephFS PVs do not use the adminID
+// and adminKey of the provisioner.
+func createCephFSStaticSecret(f *framework.Framework, scPath, secretName string) (*v1.Secret, error) {
+	secret, err := getSecret(scPath)
+	if err != nil {
+		return nil, err
+	}
+	adminKey, e, err := execCommandInToolBoxPod(f, "ceph auth get-key client.admin", rookNamespace)
+	if err != nil {
+		return nil, err
+	}
+	if e != "" {
+		return nil, fmt.Errorf("failed to get adminKey %s", e)
+	}
+	secret.StringData["userID"] = adminUser
+	secret.StringData["userKey"] = adminKey
+	secret.Name = secretName
+	secret.Namespace = cephCSINamespace
+	_, err = f.ClientSet.CoreV1().Secrets(cephCSINamespace).Create(context.TODO(), &secret, metav1.CreateOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create secret: %w", err)
+	}
+
+	return &secret, nil
+}
+
 // nolint:gocyclo,cyclop // reduce complexity
 func validateCephFsStaticPV(f *framework.Framework, appPath, scPath string) error {
 	opt := make(map[string]string)
@@ -339,8 +370,12 @@ func validateCephFsStaticPV(f *framework.Framework, appPath, scPath string) erro
 
 	c := f.ClientSet
 
+	err := ensureExternalToolbox(f)
+	if err != nil {
+		return err
+	}
 	listOpt := metav1.ListOptions{
-		LabelSelector: "app=rook-ceph-tools",
+		LabelSelector: rookToolBoxPodLabel,
 	}
 
 	fsID, err := getClusterID(f)
@@ -384,26 +419,10 @@ func validateCephFsStaticPV(f *framework.Framework, appPath, scPath string) erro
 	// remove new line present in rootPath
 	rootPath = strings.Trim(rootPath, "\n")
 
-	// create secret
-	secret, err := getSecret(scPath)
+	secret, err := createCephFSStaticSecret(f, scPath, secretName)
 	if err != nil {
 		return err
 	}
-	adminKey, e, err := execCommandInPod(f, "ceph auth get-key client.admin", rookNamespace, &listOpt)
-	if err != nil {
-		return err
-	}
-	if e != "" {
-		return fmt.Errorf("failed to get adminKey %s", e)
-	}
-	secret.StringData["userID"] = adminUser
-	secret.StringData["userKey"] = adminKey
-	secret.Name = secretName
-	secret.Namespace = cephCSINamespace
-	_, err = c.CoreV1().Secrets(cephCSINamespace).Create(context.TODO(), &secret, metav1.CreateOptions{})
-	if err != nil {
-		return fmt.Errorf("failed to create secret: %w", err)
-	}
 
 	opt["clusterID"] = fsID
 	opt["fsName"] = fileSystemName
@@ -496,13 +515,7 @@ func validateRBDStaticResize(
 ) error {
 	// resize rbd image
 	size := staticPVNewSize
-	cmd := fmt.Sprintf(
-		"rbd resize %s --size=%s %s",
-		rbdImageName,
-		size,
-		rbdOptions(defaultRBDPool))
-
-	_, _, err := execCommandInToolBoxPod(f, cmd, rookNamespace)
+	err := resizeRBDImage(f, defaultRBDPool, rbdImageName, size)
 	if err != nil {
 		return err
 	}
@@ -520,3 +533,344 @@ func validateRBDStaticResize(
 
 	return deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
 }
+
+// staticVolume is a volume in the Ceph cluster that is used through a static
+// PV with the Retain policy.
+type staticVolume struct {
+	// newPV and newPVC return the PV and PVC for the volume, they are
+	// created again after the first PV was deleted
+	newPV  func() *v1.PersistentVolume
+	newPVC func() *v1.PersistentVolumeClaim
+	// expand grows the volume in the Ceph cluster to expandedSize
+	expand       func() error
+	expandedSize string
+	// exists returns whether the volume exists in the Ceph cluster
+	exists func() (bool, error)
+}
+
+// createStaticPVAndPVC creates the PV and the PVC that binds to it.
+func createStaticPVAndPVC(f *framework.Framework, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) error {
+	_, err := f.ClientSet.CoreV1().PersistentVolumes().Create(context.TODO(), pv, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create PV: %w", err)
+	}
+	_, err = f.ClientSet.CoreV1().PersistentVolumeClaims(pvc.Namespace).Create(context.TODO(), pvc, metav1.CreateOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to create PVC: %w", err)
+	}
+
+	return nil
+}
+
+// deleteStaticPVAndPVC deletes the PVC and the PV, and waits until both are
+// gone. The PV has the Retain policy, so it is not removed together with the
+// PVC.
+func deleteStaticPVAndPVC(f *framework.Framework, pv *v1.PersistentVolume, pvc *v1.PersistentVolumeClaim) error {
+	c := f.ClientSet.CoreV1()
+	err := c.PersistentVolumeClaims(pvc.Namespace).Delete(context.TODO(), pvc.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC: %w", err)
+	}
+	err = c.PersistentVolumes().Delete(context.TODO(), pv.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete PV: %w", err)
+	}
+
+	timeout := time.Duration(deployTimeout) * time.Minute
+
+	return wait.PollImmediate(poll, timeout, func() (bool, error) {
+		_, err = c.PersistentVolumeClaims(pvc.Namespace).Get(context.TODO(), pvc.Name, metav1.GetOptions{})
+		if err == nil || isRetryableAPIError(err) {
+			return false, nil
+		}
+		if !apierrs.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get PVC %s: %w", pvc.Name, err)
+		}
+		_, err = c.PersistentVolumes().Get(context.TODO(), pv.Name, metav1.GetOptions{})
+		if err == nil || isRetryableAPIError(err) {
+			return false, nil
+		}
+		if !apierrs.IsNotFound(err) {
+			return false, fmt.Errorf("failed to get PV %s: %w", pv.Name, err)
+		}
+
+		return true, nil
+	})
+}
+
+// createStaticApp creates the app from appPath with the PVC, and returns the
+// options to select it.
+func createStaticApp(
+	f *framework.Framework,
+	appPath string,
+	pvc *v1.PersistentVolumeClaim,
+) (*v1.Pod, *metav1.ListOptions, error) {
+	app, err := loadApp(appPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load app: %w", err)
+	}
+	app.Namespace = pvc.Namespace
+	app.Labels = map[string]string{appKey: appLabel}
+	app.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = pvc.Name
+	err = createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create app: %w", err)
+	}
+
+	return app, &metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", appKey, appLabel)}, nil
+}
+
+// checkFileInApp checks that the file in the volume of the app has the data.
+func checkFileInApp(f *framework.Framework, app *v1.Pod, opt *metav1.ListOptions, file, data string) error {
+	path := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/" + file
+	stdOut, stdErr, err := execCommandInPod(f, "cat "+path, app.Namespace, opt)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to read %s: %s", path, stdErr)
+	}
+	if strings.TrimSpace(stdOut) != data {
+		return fmt.Errorf("%s contains %q, expected %q", path, stdOut, data)
+	}
+
+	return nil
+}
+
+// validateStaticVolumeLifecycle checks that the static volume can be
+// mounted and written to, that the kubelet reports its stats, and that the
+// filesystem grows when the volume is expanded in the Ceph cluster. When the
+// PVC and PV are deleted, the volume needs to be kept, and a new PV for it
+// needs to have the data that was written. The volume is not removed from
+// the Ceph cluster.
+func validateStaticVolumeLifecycle(f *framework.Framework, vol *staticVolume, appPath string) error {
+	const (
+		file = "static"
+		data = "written through the first static PV"
+	)
+
+	pv := vol.newPV()
+	pvc := vol.newPVC()
+	err := createStaticPVAndPVC(f, pv, pvc)
+	if err != nil {
+		return err
+	}
+	app, opt, err := createStaticApp(f, appPath, pvc)
+	if err != nil {
+		return err
+	}
+
+	path := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/" + file
+	_, stdErr, err := execCommandInPod(f, fmt.Sprintf("echo %q > %s", data, path), app.Namespace, opt)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if stdErr != "" {
+		return fmt.Errorf("failed to write %s: %s", path, stdErr)
+	}
+	if !isOpenShift {
+		err = getMetricsForPVC(f, pvc, deployTimeout)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the filesystem of an RBD image is resized when it is staged again
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete app: %w", err)
+	}
+	err = vol.expand()
+	if err != nil {
+		return fmt.Errorf("failed to expand volume: %w", err)
+	}
+	app, opt, err = createStaticApp(f, appPath, pvc)
+	if err != nil {
+		return err
+	}
+	err = checkDirSize(app, f, opt, vol.expandedSize)
+	if err != nil {
+		return fmt.Errorf("failed to check size of expanded volume: %w", err)
+	}
+	err = checkFileInApp(f, app, opt, file, data)
+	if err != nil {
+		return err
+	}
+
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete app: %w", err)
+	}
+	err = deleteStaticPVAndPVC(f, pv, pvc)
+	if err != nil {
+		return err
+	}
+	exists, err := vol.exists()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errors.New("volume was removed together with the static PV")
+	}
+
+	pv = vol.newPV()
+	pvc = vol.newPVC()
+	err = createStaticPVAndPVC(f, pv, pvc)
+	if err != nil {
+		return err
+	}
+	app, opt, err = createStaticApp(f, appPath, pvc)
+	if err != nil {
+		return err
+	}
+	err = checkFileInApp(f, app, opt, file, data)
+	if err != nil {
+		return fmt.Errorf("data was not retained: %w", err)
+	}
+	err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to delete app: %w", err)
+	}
+
+	return deleteStaticPVAndPVC(f, pv, pvc)
+}
+
+// validateRBDStaticVolumeLifecycle runs validateStaticVolumeLifecycle() with
+// an image that is created for it.
+func validateRBDStaticVolumeLifecycle(f *framework.Framework, appPath string) error {
+	const (
+		rbdImageName = "test-static-lifecycle"
+		pvName       = "pv-static-lifecycle"
+		pvcName      = "pvc-static-lifecycle"
+		// minikube creates default class in cluster, we need to set dummy
+		// storageclass on PV and PVC to avoid storageclass name mismatch
+		sc = "storage-class"
+	)
+
+	fsID, err := getClusterID(f)
+	if err != nil {
+		return fmt.Errorf("failed to get clusterID: %w", err)
+	}
+	err = createRBDImage(f, defaultRBDPool, rbdImageName, staticPVSize)
+	if err != nil {
+		return err
+	}
+
+	opt := map[string]string{
+		"clusterID":     fsID,
+		"pool":          defaultRBDPool,
+		"imageFeatures": staticPVImageFeature,
+		"staticVolume":  strconv.FormatBool(true),
+	}
+	if radosNamespace != "" {
+		opt["radosNamespace"] = radosNamespace
+	}
+	vol := &staticVolume{
+		newPV: func() *v1.PersistentVolume {
+			return getStaticPV(pvName, rbdImageName, staticPVSize, rbdNodePluginSecretName, cephCSINamespace,
+				sc, "rbd.csi.ceph.com", false, opt, nil, retainPolicy)
+		},
+		newPVC: func() *v1.PersistentVolumeClaim {
+			return getStaticPVC(pvcName, pvName, staticPVSize, f.UniqueName, sc, false)
+		},
+		expand: func() error {
+			return resizeRBDImage(f, defaultRBDPool, rbdImageName, staticPVNewSize)
+		},
+		expandedSize: staticPVNewSize,
+		exists: func() (bool, error) {
+			images, listErr := listRBDImages(f, defaultRBDPool)
+			if listErr != nil {
+				return false, listErr
+			}
+			for _, image := range images {
+				if image == rbdImageName {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+	}
+
+	err = validateStaticVolumeLifecycle(f, vol, appPath)
+	if err != nil {
+		return err
+	}
+
+	return removeRBDImage(f, defaultRBDPool, rbdImageName)
+}
+
+// validateCephFSStaticVolumeLifecycle runs validateStaticVolumeLifecycle()
+// with a subvolume that is created for it.
+func validateCephFSStaticVolumeLifecycle(f *framework.Framework, appPath, scPath string) error {
+	const (
+		subvolume  = "testStaticLifecycle"
+		groupName  = "testStaticGroup"
+		pvName     = "pv-static-lifecycle"
+		pvcName    = "pvc-static-lifecycle"
+		sc         = "storage-class"
+		secretName = "cephfs-static-lifecycle" // #nosec
+	)
+
+	fsID, err := getClusterID(f)
+	if err != nil {
+		return fmt.Errorf("failed to get clusterID: %w", err)
+	}
+	err = createSubVolume(f, fileSystemName, groupName, subvolume, staticPVSize)
+	if err != nil {
+		return err
+	}
+	rootPath, err := getSubvolumePath(f, fileSystemName, groupName, subvolume)
+	if err != nil {
+		return err
+	}
+	secret, err := createCephFSStaticSecret(f, scPath, secretName)
+	if err != nil {
+		return err
+	}
+
+	opt := map[string]string{
+		"clusterID":    fsID,
+		"fsName":       fileSystemName,
+		"staticVolume": strconv.FormatBool(true),
+		"rootPath":     rootPath,
+	}
+	vol := &staticVolume{
+		newPV: func() *v1.PersistentVolume {
+			return getStaticPV(pvName, pvName, staticPVSize, secretName, cephCSINamespace,
+				sc, "cephfs.csi.ceph.com", false, opt, nil, retainPolicy)
+		},
+		newPVC: func() *v1.PersistentVolumeClaim {
+			return getStaticPVC(pvcName, pvName, staticPVSize, f.UniqueName, sc, false)
+		},
+		expand: func() error {
+			return resizeSubVolume(f, fileSystemName, groupName, subvolume, staticPVNewSize)
+		},
+		expandedSize: staticPVNewSize,
+		exists: func() (bool, error) {
+			subvols, listErr := listCephFSSubVolumes(f, fileSystemName, groupName)
+			if listErr != nil {
+				return false, listErr
+			}
+			for _, sv := range subvols {
+				if sv.Name == subvolume {
+					return true, nil
+				}
+			}
+
+			return false, nil
+		},
+	}
+
+	err = validateStaticVolumeLifecycle(f, vol, appPath)
+	if err != nil {
+		return err
+	}
+
+	err = f.ClientSet.CoreV1().Secrets(cephCSINamespace).Delete(context.TODO(), secret.Name, metav1.DeleteOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %w", err)
+	}
+
+	return removeSubVolume(f, fileSystemName, groupName, subvolume)
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"regexp"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// resourcePrefix is prepended to the names of the resources that are shared
+// by all users of the Kubernetes and Ceph clusters, so that e2e runs with a
+// different prefix (and --cephcsi-namespace) can run concurrently.
+var resourcePrefix string
+
+// clusterWideExampleNames are the names of the StorageClasses and
+// VolumeSnapshotClasses in the examples. These are not namespaced, and get
+// prefixed when the examples are loaded.
+var clusterWideExampleNames = regexp.MustCompile(
+	`(?m)(:\s*)(csi-rbd-sc|csi-cephfs-sc|csi-nfs-sc|` +
+		`csi-rbdplugin-snapclass|csi-cephfsplugin-snapclass|csi-nfsplugin-snapclass)[ \t]*$`)
+
+// resourceName returns the name with the --resource-prefix. It is used for
+// StorageClasses, VolumeSnapshotClasses, Ceph users, subvolumegroups and
+// rados namespaces.
+func resourceName(name string) string {
+	if resourcePrefix == "" || name == "" {
+		return name
+	}
+
+	return resourcePrefix + "-" + name
+}
+
+// replaceResourceNamesInTemplate prefixes the names of the cluster wide
+// resources in the examples, and the references to them.
+func replaceResourceNamesInTemplate(data string) string {
+	if resourcePrefix == "" {
+		return data
+	}
+
+	return clusterWideExampleNames.ReplaceAllString(data, "${1}"+resourcePrefix+"-${2}")
+}
+
+// cleanupFunc removes a resource after all suites finished. The framework
+// is not bound to a test, only its ClientSet can be used.
+type cleanupFunc func(f *framework.Framework) error
+
+// cleanups contain the resources that were created in the Ceph cluster, and
+// need to be removed when the e2e run finishes. Resources that are used by
+// multiple suites, like the Ceph users of the CephFS and NFS suites, are
+// registered once by name, so that one suite does not remove them while
+// another still uses them.
+var cleanups = struct {
+	sync.Mutex
+	names []string
+	funcs map[string]cleanupFunc
+}{
+	funcs: make(map[string]cleanupFunc),
+}
+
+// registerCleanup adds the cleanup of the resource with the name, if it was
+// not registered yet.
+func registerCleanup(name string, fn cleanupFunc) {
+	cleanups.Lock()
+	defer cleanups.Unlock()
+
+	if _, ok := cleanups.funcs[name]; ok {
+		return
+	}
+	cleanups.names = append(cleanups.names, name)
+	cleanups.funcs[name] = fn
+}
+
+// runCleanups removes all registered resources in the reverse order of their
+// registration. Failures are logged, and do not stop the remaining cleanups.
+func runCleanups(f *framework.Framework) {
+	cleanups.Lock()
+	names := cleanups.names
+	funcs := cleanups.funcs
+	cleanups.names = nil
+	cleanups.funcs = make(map[string]cleanupFunc)
+	cleanups.Unlock()
+
+	for i := len(names) - 1; i >= 0; i-- {
+		e2elog.Logf("cleaning up %s", names[i])
+		err := funcs[names[i]](f)
+		if err != nil {
+			e2elog.Logf("failed to clean up %s: %v", names[i], err)
+		}
+	}
+}
+
+var _ = AfterSuite(func() {
+	c, err := framework.LoadClientset()
+	if err != nil {
+		e2elog.Logf("failed to load clientset for cleaning up: %v", err)
+
+		return
+	}
+
+	runCleanups(&framework.Framework{BaseName: "cleanup", ClientSet: c})
+})
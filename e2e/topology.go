@@ -0,0 +1,268 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/test/e2e/framework"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// fakeZones are the zones that labelNodesIntoZones() spreads the nodes over.
+// A cluster with a single node only has a node in the first zone.
+var fakeZones = []string{zoneValue + "-a", zoneValue + "-b"}
+
+// labelNodesIntoZones sets the zone label of the nodes to one of the zones,
+// in turn, and returns the zone of each node.
+func labelNodesIntoZones(f *framework.Framework, zones []string) (map[string]string, error) {
+	nodes, err := f.ClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	names := make([]string, 0, len(nodes.Items))
+	for i := range nodes.Items {
+		names = append(names, nodes.Items[i].Name)
+	}
+	sort.Strings(names)
+
+	nodeZones := make(map[string]string, len(names))
+	for i, name := range names {
+		nodeZones[name] = zones[i%len(zones)]
+		framework.AddOrUpdateLabelOnNode(f.ClientSet, name, nodeZoneLabel, nodeZones[name])
+	}
+
+	return nodeZones, nil
+}
+
+// refreshNodeTopology restarts the RBD nodeplugin, so that it reports the
+// zones of the nodes in its topology. The CSI zone label set by the kubelet
+// is removed first, the kubelet refuses to register a driver with a topology
+// that conflicts with the existing labels.
+func refreshNodeTopology(f *framework.Framework, nodeZones map[string]string) error {
+	err := deleteNodeLabel(f.ClientSet, nodeCSIZoneLabel)
+	if err != nil {
+		return err
+	}
+	err = restartNodePlugin(f, rbdDaemonsetName)
+	if err != nil {
+		return err
+	}
+
+	timeout := time.Duration(deployTimeout) * time.Minute
+	for node, zone := range nodeZones {
+		var current string
+		err = wait.PollImmediate(poll, timeout, func() (bool, error) {
+			n, getErr := f.ClientSet.CoreV1().Nodes().Get(context.TODO(), node, metav1.GetOptions{})
+			if getErr != nil {
+				if isRetryableAPIError(getErr) {
+					return false, nil
+				}
+
+				return false, fmt.Errorf("failed to get node %s: %w", node, getErr)
+			}
+			current = n.Labels[nodeCSIZoneLabel]
+
+			return current == zone, nil
+		})
+		if err != nil {
+			return fmt.Errorf("node %s has label %s=%q, expected %q: %w", node, nodeCSIZoneLabel, current, zone, err)
+		}
+	}
+
+	return nil
+}
+
+// zonalTopologyConstraint returns the topologyConstrainedPools parameter of
+// a StorageClass that places the images of each zone in the pool of the zone.
+func zonalTopologyConstraint(zonePools map[string]string) (string, error) {
+	type domainSegment struct {
+		DomainLabel string `json:"domainLabel"`
+		Value       string `json:"value"`
+	}
+	type topologyConstrainedPool struct {
+		PoolName       string          `json:"poolName"`
+		DomainSegments []domainSegment `json:"domainSegments"`
+	}
+
+	zones := make([]string, 0, len(zonePools))
+	for zone := range zonePools {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	pools := make([]topologyConstrainedPool, 0, len(zones))
+	for _, zone := range zones {
+		pools = append(pools, topologyConstrainedPool{
+			PoolName: zonePools[zone],
+			DomainSegments: []domainSegment{
+				{DomainLabel: "region", Value: regionValue},
+				{DomainLabel: "zone", Value: zone},
+			},
+		})
+	}
+	data, err := json.Marshal(pools)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal topology constrained pools: %w", err)
+	}
+
+	return string(data), nil
+}
+
+// validateZonalProvisioning spreads the nodes over the zones of zonePools,
+// and creates a PVC with a delayed binding StorageClass for an app in each
+// zone that has a node. The image of each PVC needs to be in the pool of the
+// zone, and the PV needs to be restricted to the zone. When the driver is
+// deployed by the e2e tests, the capacity of each zone is validated as well.
+// The nodes are moved back to zoneValue afterwards.
+func validateZonalProvisioning(f *framework.Framework, zonePools map[string]string, pvcPath, appPath string) error {
+	zones := make([]string, 0, len(zonePools))
+	for zone := range zonePools {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+
+	nodeZones, err := labelNodesIntoZones(f, zones)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		labelErr := createNodeLabel(f, nodeZoneLabel, zoneValue)
+		if labelErr != nil {
+			e2elog.Failf("failed to create node label: %v", labelErr)
+		}
+		for node := range nodeZones {
+			nodeZones[node] = zoneValue
+		}
+		labelErr = refreshNodeTopology(f, nodeZones)
+		if labelErr != nil {
+			e2elog.Failf("failed to restore the topology of the nodeplugin: %v", labelErr)
+		}
+	}()
+	err = refreshNodeTopology(f, nodeZones)
+	if err != nil {
+		return err
+	}
+
+	constraint, err := zonalTopologyConstraint(zonePools)
+	if err != nil {
+		return err
+	}
+	err = deleteResource(rbdExamplePath + "storageclass.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to delete storageclass: %w", err)
+	}
+	defer func() {
+		scErr := deleteResource(rbdExamplePath + "storageclass.yaml")
+		if scErr != nil {
+			e2elog.Failf("failed to delete storageclass: %v", scErr)
+		}
+		scErr = createRBDStorageClass(f.ClientSet, f, defaultSCName, nil, nil, deletePolicy)
+		if scErr != nil {
+			e2elog.Failf("failed to create storageclass: %v", scErr)
+		}
+	}()
+	err = createRBDStorageClass(f.ClientSet, f, defaultSCName,
+		map[string]string{"volumeBindingMode": "WaitForFirstConsumer"},
+		map[string]string{"topologyConstrainedPools": constraint}, deletePolicy)
+	if err != nil {
+		return fmt.Errorf("failed to create storageclass: %w", err)
+	}
+
+	usedZones := map[string]bool{}
+	for _, zone := range nodeZones {
+		usedZones[zone] = true
+	}
+	zonesWithNodes := make([]string, 0, len(zones))
+	for _, zone := range zones {
+		if !usedZones[zone] {
+			e2elog.Logf("skipping zone %s, there is no node in it", zone)
+
+			continue
+		}
+		zonesWithNodes = append(zonesWithNodes, zone)
+	}
+
+	if deployRBD && !helmTest {
+		err = validateZonalCapacity(f, defaultSCName, zonePools, zonesWithNodes)
+		if err != nil {
+			return fmt.Errorf("failed to validate capacity of the zones: %w", err)
+		}
+	}
+	for _, zone := range zonesWithNodes {
+		err = validateZonalPVC(f, zone, zonePools[zone], pvcPath, appPath)
+		if err != nil {
+			return fmt.Errorf("zone %s: %w", zone, err)
+		}
+	}
+
+	return nil
+}
+
+// validateZonalPVC creates a PVC for an app that is scheduled in the zone,
+// and checks that the image is created in the pool and that the PV can only
+// be used in the zone.
+func validateZonalPVC(f *framework.Framework, zone, pool, pvcPath, appPath string) error {
+	pvc, err := loadPVC(pvcPath)
+	if err != nil {
+		return fmt.Errorf("failed to load PVC: %w", err)
+	}
+	pvc.Namespace = f.UniqueName
+	app, err := loadApp(appPath)
+	if err != nil {
+		return fmt.Errorf("failed to load application: %w", err)
+	}
+	app.Namespace = f.UniqueName
+	app.Spec.NodeSelector = map[string]string{nodeZoneLabel: zone}
+
+	// the PVC is bound once the app is scheduled
+	err = createPVCAndApp("", f, pvc, app, 0)
+	if err != nil {
+		return fmt.Errorf("failed to create PVC and application: %w", err)
+	}
+
+	err = checkPVTopology(f, pvc, regionValue, zone)
+	if err != nil {
+		return err
+	}
+	err = checkPVCImageInPool(f, pvc, pool)
+	if err != nil {
+		return fmt.Errorf("failed to check image in pool %s: %w", pool, err)
+	}
+	err = checkPVCImageJournalInPool(f, pvc, pool)
+	if err != nil {
+		return fmt.Errorf("failed to check image journal in pool %s: %w", pool, err)
+	}
+
+	err = deleteJournalInfoInPool(f, pvc, defaultRBDPool)
+	if err != nil {
+		return fmt.Errorf("failed to delete omap data: %w", err)
+	}
+	err = deletePVCAndApp("", f, pvc, app)
+	if err != nil {
+		return fmt.Errorf("failed to delete PVC and application: %w", err)
+	}
+
+	return nil
+}
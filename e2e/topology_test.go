@@ -0,0 +1,41 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"testing"
+)
+
+func TestZonalTopologyConstraint(t *testing.T) {
+	t.Parallel()
+	zonePools := map[string]string{
+		"testzone-b": "pool-b",
+		"testzone-a": "pool-a",
+	}
+	expected := `[{"poolName":"pool-a","domainSegments":[{"domainLabel":"region","value":"testregion"},` +
+		`{"domainLabel":"zone","value":"testzone-a"}]},` +
+		`{"poolName":"pool-b","domainSegments":[{"domainLabel":"region","value":"testregion"},` +
+		`{"domainLabel":"zone","value":"testzone-b"}]}]`
+
+	constraint, err := zonalTopologyConstraint(zonePools)
+	if err != nil {
+		t.Fatalf("zonalTopologyConstraint() failed: %v", err)
+	}
+	if constraint != expected {
+		t.Errorf("zonalTopologyConstraint() = %s, expected %s", constraint, expected)
+	}
+}
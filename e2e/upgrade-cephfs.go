@@ -40,6 +40,9 @@ var _ = Describe("CephFS Upgrade Testing", func() {
 		pvcClone *v1.PersistentVolumeClaim
 		app      *v1.Pod
 		appClone *v1.Pod
+		// upgradedPVCClone is a clone of pvc that is created by the
+		// earlier release.
+		upgradedPVCClone *v1.PersistentVolumeClaim
 		// cwd stores the initial working directory.
 		cwd string
 		err error
@@ -49,9 +52,10 @@ var _ = Describe("CephFS Upgrade Testing", func() {
 		newCheckSum string
 	)
 	const (
-		pvcSize  = "2Gi"
-		appKey   = "app"
-		appLabel = "cephfs-upgrade-testing"
+		pvcSize       = "2Gi"
+		pvcExpandSize = "5Gi"
+		appKey        = "app"
+		appLabel      = "cephfs-upgrade-testing"
 	)
 	// deploy cephFS CSI
 	BeforeEach(func() {
@@ -244,27 +248,29 @@ var _ = Describe("CephFS Upgrade Testing", func() {
 				if err != nil {
 					e2elog.Failf("failed to create snapshot %v", err)
 				}
-				err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+				// Create a clone of the pvc, it is used after the upgrade
+				upgradedPVCClone, err = loadPVC(cephFSExamplePath + "pvc-clone.yaml")
 				if err != nil {
-					e2elog.Failf("failed to delete application: %v", err)
+					e2elog.Failf("failed to load pvc: %v", err)
 				}
-				deleteCephfsPlugin()
-
-				// switch back to current changes.
-				err = os.Chdir(cwd)
+				upgradedPVCClone.Name = "cephfs-pvc-upgraded-clone"
+				upgradedPVCClone.Namespace = f.UniqueName
+				upgradedPVCClone.Spec.DataSource.Name = pvc.Name
+				upgradedPVCClone.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(pvcSize)
+				err = createPVCAndvalidatePV(f.ClientSet, upgradedPVCClone, deployTimeout)
 				if err != nil {
-					e2elog.Failf("failed to d chdir: %v", err)
+					e2elog.Failf("failed to create pvc clone: %v", err)
 				}
-				deployCephfsPlugin()
 
-				err = waitForDeploymentComplete(f.ClientSet, cephFSDeploymentName, cephCSINamespace, deployTimeout)
+				err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
 				if err != nil {
-					e2elog.Failf("timeout waiting for upgraded deployment %s: %v", cephFSDeploymentName, err)
+					e2elog.Failf("failed to delete application: %v", err)
 				}
 
-				err = waitForDaemonSets(cephFSDeamonSetName, cephCSINamespace, f.ClientSet, deployTimeout)
+				// switch back to current changes.
+				err = deployCurrentCSI(f, cwd, "cephfs")
 				if err != nil {
-					e2elog.Failf("timeout waiting for upgraded daemonset %s: %v", cephFSDeamonSetName, err)
+					e2elog.Failf("failed to upgrade to the current changes: %v", err)
 				}
 
 				app.Labels = label
@@ -382,8 +388,48 @@ var _ = Describe("CephFS Upgrade Testing", func() {
 				}
 			})
 
+			By("validate and resize the clone created by an earlier release", func() {
+				appClone, err = loadApp(cephFSExamplePath + "pod-clone.yaml")
+				if err != nil {
+					e2elog.Failf("failed to load application: %v", err)
+				}
+				label := map[string]string{appKey: "validate-upgraded-clone"}
+				appClone.Namespace = f.UniqueName
+				appClone.Name = "app-upgraded-clone"
+				appClone.Labels = label
+				appClone.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = upgradedPVCClone.Name
+				opt := metav1.ListOptions{
+					LabelSelector: fmt.Sprintf("%s=%s", appKey, label[appKey]),
+				}
+				err = createAppAndValidateChecksum(f, appClone, &opt, checkSum)
+				if err != nil {
+					e2elog.Failf("failed to validate clone created by an earlier release: %v", err)
+				}
+
+				upgradedPVCClone, err = getPersistentVolumeClaim(f.ClientSet, f.UniqueName, upgradedPVCClone.Name)
+				if err != nil {
+					e2elog.Failf("failed to get pvc: %v", err)
+				}
+				err = expandPVCSize(f.ClientSet, upgradedPVCClone, pvcExpandSize, deployTimeout)
+				if err != nil {
+					e2elog.Failf("failed to expand pvc: %v", err)
+				}
+				err = waitForPodInRunningState(appClone.Name, appClone.Namespace, f.ClientSet, deployTimeout, noError)
+				if err != nil {
+					e2elog.Failf("timeout waiting for pod to be in running state: %v", err)
+				}
+				err = checkDirSize(appClone, f, &opt, pvcExpandSize)
+				if err != nil {
+					e2elog.Failf("failed to check directory size: %v", err)
+				}
+
+				err = deletePVCAndApp("", f, upgradedPVCClone, appClone)
+				if err != nil {
+					e2elog.Failf("failed to delete pvc and application: %v", err)
+				}
+			})
+
 			By("Resize pvc and verify expansion", func() {
-				pvcExpandSize := "5Gi"
 				label := make(map[string]string)
 
 				label[appKey] = appLabel
@@ -417,6 +463,16 @@ var _ = Describe("CephFS Upgrade Testing", func() {
 			if err != nil {
 				e2elog.Failf("failed to delete pvc and application: %v", err)
 			}
+
+			By("validate resources of the earlier release are removed from the cluster", func() {
+				metadataPool, getErr := getCephFSMetadataPoolName(f, fileSystemName)
+				if getErr != nil {
+					e2elog.Failf("failed getting cephFS metadata pool name: %v", getErr)
+				}
+				validateSubvolumeCount(f, 0, fileSystemName, subvolumegroup)
+				validateOmapCount(f, 0, cephfsType, metadataPool, volumesType)
+				validateOmapCount(f, 0, cephfsType, metadataPool, snapsType)
+			})
 			// delete cephFS provisioner secret
 			err = deleteCephUser(f, keyringCephFSProvisionerUsername)
 			if err != nil {
@@ -40,13 +40,18 @@ var _ = Describe("RBD Upgrade Testing", func() {
 		c   clientset.Interface
 		pvc *v1.PersistentVolumeClaim
 		app *v1.Pod
+		// upgradedPVCClone is a clone of pvc that is created by the
+		// earlier release.
+		upgradedPVCClone *v1.PersistentVolumeClaim
 		// checkSum stores the md5sum of a file to verify uniqueness.
 		checkSum string
 	)
 	const (
-		pvcSize  = "2Gi"
-		appKey   = "app"
-		appLabel = "rbd-upgrade-testing"
+		pvcSize       = "2Gi"
+		pvcExpandSize = "5Gi"
+		appKey        = "app"
+		appLabel      = "rbd-upgrade-testing"
+		snapshotName  = "rbd-pvc-snapshot"
 	)
 
 	// deploy rbd CSI
@@ -257,7 +262,7 @@ var _ = Describe("RBD Upgrade Testing", func() {
 				// Create snapshot of the pvc
 				snapshotPath := rbdExamplePath + "snapshot.yaml"
 				snap := getSnapshot(snapshotPath)
-				snap.Name = "rbd-pvc-snapshot"
+				snap.Name = snapshotName
 				snap.Namespace = f.UniqueName
 				snap.Spec.Source.PersistentVolumeClaimName = &pvc.Name
 				err = createSnapshot(&snap, deployTimeout)
@@ -265,27 +270,28 @@ var _ = Describe("RBD Upgrade Testing", func() {
 					e2elog.Failf("failed to create snapshot %v", err)
 				}
 
-				err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
+				// Create a clone of the pvc, it is used after the upgrade
+				upgradedPVCClone, err = loadPVC(rbdExamplePath + "pvc-clone.yaml")
 				if err != nil {
-					e2elog.Failf("failed to delete application: %v", err)
+					e2elog.Failf("failed to load pvc: %v", err)
 				}
-				deleteRBDPlugin()
-
-				err = os.Chdir(cwd)
+				upgradedPVCClone.Name = "rbd-pvc-upgraded-clone"
+				upgradedPVCClone.Namespace = f.UniqueName
+				upgradedPVCClone.Spec.DataSource.Name = pvc.Name
+				upgradedPVCClone.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(pvcSize)
+				err = createPVCAndvalidatePV(f.ClientSet, upgradedPVCClone, deployTimeout)
 				if err != nil {
-					e2elog.Failf("failed to change directory: %v", err)
+					e2elog.Failf("failed to create pvc clone: %v", err)
 				}
 
-				deployRBDPlugin()
-
-				err = waitForDeploymentComplete(f.ClientSet, rbdDeploymentName, cephCSINamespace, deployTimeout)
+				err = deletePod(app.Name, app.Namespace, f.ClientSet, deployTimeout)
 				if err != nil {
-					e2elog.Failf("timeout waiting for upgraded deployment %s: %v", rbdDeploymentName, err)
+					e2elog.Failf("failed to delete application: %v", err)
 				}
 
-				err = waitForDaemonSets(rbdDaemonsetName, cephCSINamespace, f.ClientSet, deployTimeout)
+				err = deployCurrentCSI(f, cwd, "rbd")
 				if err != nil {
-					e2elog.Failf("timeout waiting for upgraded daemonset %s: %v", rbdDaemonsetName, err)
+					e2elog.Failf("failed to upgrade to the current changes: %v", err)
 				}
 
 				// validate if the app gets bound to a pvc created by
@@ -307,7 +313,7 @@ var _ = Describe("RBD Upgrade Testing", func() {
 				}
 				pvcClone.Namespace = f.UniqueName
 				pvcClone.Spec.Resources.Requests[v1.ResourceStorage] = resource.MustParse(pvcSize)
-				pvcClone.Spec.DataSource.Name = "rbd-pvc-snapshot"
+				pvcClone.Spec.DataSource.Name = snapshotName
 				appClone, err := loadApp(appClonePath)
 				if err != nil {
 					e2elog.Failf("failed to load application: %v", err)
@@ -392,8 +398,59 @@ var _ = Describe("RBD Upgrade Testing", func() {
 				}
 			})
 
+			By("validate and resize the clone created by an earlier release", func() {
+				appClone, err := loadApp(rbdExamplePath + "pod-clone.yaml")
+				if err != nil {
+					e2elog.Failf("failed to load application: %v", err)
+				}
+				label := map[string]string{appKey: "validate-upgraded-clone"}
+				appClone.Namespace = f.UniqueName
+				appClone.Name = "app-upgraded-clone"
+				appClone.Labels = label
+				appClone.Spec.Volumes[0].PersistentVolumeClaim.ClaimName = upgradedPVCClone.Name
+				opt := metav1.ListOptions{
+					LabelSelector: fmt.Sprintf("%s=%s", appKey, label[appKey]),
+				}
+				err = createAppAndValidateChecksum(f, appClone, &opt, checkSum)
+				if err != nil {
+					e2elog.Failf("failed to validate clone created by an earlier release: %v", err)
+				}
+
+				upgradedPVCClone, err = getPersistentVolumeClaim(f.ClientSet, f.UniqueName, upgradedPVCClone.Name)
+				if err != nil {
+					e2elog.Failf("failed to get pvc: %v", err)
+				}
+				err = expandPVCSize(f.ClientSet, upgradedPVCClone, pvcExpandSize, deployTimeout)
+				if err != nil {
+					e2elog.Failf("failed to expand pvc: %v", err)
+				}
+				err = waitForPodInRunningState(appClone.Name, appClone.Namespace, f.ClientSet, deployTimeout, noError)
+				if err != nil {
+					e2elog.Failf("timeout waiting for pod to be in running state: %v", err)
+				}
+				err = checkDirSize(appClone, f, &opt, pvcExpandSize)
+				if err != nil {
+					e2elog.Failf("failed to check directory size: %v", err)
+				}
+
+				err = deletePVCAndApp("", f, upgradedPVCClone, appClone)
+				if err != nil {
+					e2elog.Failf("failed to delete pvc and application: %v", err)
+				}
+			})
+
+			By("delete the snapshot created by an earlier release", func() {
+				snap := getSnapshot(rbdExamplePath + "snapshot.yaml")
+				snap.Name = snapshotName
+				snap.Namespace = f.UniqueName
+				snap.Spec.Source.PersistentVolumeClaimName = &pvc.Name
+				err := deleteSnapshot(&snap, deployTimeout)
+				if err != nil {
+					e2elog.Failf("failed to delete snapshot %v", err)
+				}
+			})
+
 			By("Resize pvc and verify expansion", func() {
-				pvcExpandSize := "5Gi"
 				label := make(map[string]string)
 
 				label[appKey] = appLabel
@@ -429,6 +486,12 @@ var _ = Describe("RBD Upgrade Testing", func() {
 					e2elog.Failf("failed to delete pvc and application: %v", err)
 				}
 			})
+
+			By("validate resources of the earlier release are removed from the cluster", func() {
+				validateRBDImageCount(f, 0, defaultRBDPool)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, volumesType)
+				validateOmapCount(f, 0, rbdType, defaultRBDPool, snapsType)
+			})
 			// delete RBD provisioner secret
 			err := deleteCephUser(f, keyringRBDProvisionerUsername)
 			if err != nil {
@@ -21,6 +21,12 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/test/e2e/framework"
 )
 
 // upgradeCSI deploys a desired ceph-csi release version.
@@ -58,3 +64,71 @@ func upgradeAndDeployCSI(version, testtype string) error {
 
 	return nil
 }
+
+// deployCurrentCSI replaces the release that was deployed by
+// upgradeAndDeployCSI() with the changes in the working directory cwd, and
+// waits until the provisioner and nodeplugin pods of the new deployment are
+// running.
+func deployCurrentCSI(f *framework.Framework, cwd, testtype string) error {
+	var (
+		deletePlugin   func()
+		deployPlugin   func()
+		deploymentName string
+		daemonSetName  string
+	)
+	switch testtype {
+	case "cephfs":
+		deletePlugin, deployPlugin = deleteCephfsPlugin, deployCephfsPlugin
+		deploymentName, daemonSetName = cephFSDeploymentName, cephFSDeamonSetName
+	case "rbd":
+		deletePlugin, deployPlugin = deleteRBDPlugin, deployRBDPlugin
+		deploymentName, daemonSetName = rbdDeploymentName, rbdDaemonsetName
+	default:
+		return errors.New("incorrect test type, can be cephfs/rbd")
+	}
+
+	// the earlier release is removed with its own deployment files
+	deletePlugin()
+	err := os.Chdir(cwd)
+	if err != nil {
+		return fmt.Errorf("unable to switch directory : %w", err)
+	}
+	deployPlugin()
+
+	err = waitForDeploymentComplete(f.ClientSet, deploymentName, cephCSINamespace, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for upgraded deployment %s: %w", deploymentName, err)
+	}
+	err = waitForDaemonSets(daemonSetName, cephCSINamespace, f.ClientSet, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("timeout waiting for upgraded daemonset %s: %w", daemonSetName, err)
+	}
+
+	return nil
+}
+
+// createAppAndValidateChecksum creates the app and verifies that the checksum
+// of the testClone file in its volume matches checkSum. It is used to check
+// the contents of volumes that were provisioned by an earlier release.
+func createAppAndValidateChecksum(
+	f *framework.Framework,
+	app *v1.Pod,
+	opt *metav1.ListOptions,
+	checkSum string) error {
+	err := createApp(f.ClientSet, app, deployTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to create application: %w", err)
+	}
+
+	mountPath := app.Spec.Containers[0].VolumeMounts[0].MountPath
+	testFilePath := filepath.Join(mountPath, "testClone")
+	newCheckSum, err := calculateSHA512sum(f, app, testFilePath, opt)
+	if err != nil {
+		return fmt.Errorf("failed to calculate checksum: %w", err)
+	}
+	if strings.Compare(newCheckSum, checkSum) != 0 {
+		return fmt.Errorf("the checksum of files did not match, expected %s received %s", checkSum, newCheckSum)
+	}
+
+	return nil
+}
@@ -105,25 +105,7 @@ type cephfsFilesystem struct {
 
 // listCephFSFileSystems list CephFS filesystems in json format.
 func listCephFSFileSystems(f *framework.Framework) ([]cephfsFilesystem, error) {
-	var fsList []cephfsFilesystem
-
-	stdout, stdErr, err := execCommandInToolBoxPod(
-		f,
-		"ceph fs ls --format=json",
-		rookNamespace)
-	if err != nil {
-		return fsList, err
-	}
-	if stdErr != "" {
-		return fsList, fmt.Errorf("error listing fs %v", stdErr)
-	}
-
-	err = json.Unmarshal([]byte(stdout), &fsList)
-	if err != nil {
-		return fsList, err
-	}
-
-	return fsList, nil
+	return cephJSON[[]cephfsFilesystem](f, "ceph fs ls")
 }
 
 // getCephFSMetadataPoolName get CephFS pool name from filesystem name.
@@ -234,7 +216,13 @@ func validateOmapCount(f *framework.Framework, count int, driver, pool, mode str
 	}
 }
 
+// getMons returns the monitors of the Rook cluster in the namespace, or the
+// monitors of the --ceph-cluster-config.
 func getMons(ns string, c kubernetes.Interface) ([]string, error) {
+	if externalCluster != nil {
+		return externalCluster.Monitors, nil
+	}
+
 	opt := metav1.ListOptions{
 		LabelSelector: "app=rook-ceph-mon",
 	}
@@ -329,7 +317,7 @@ func unmarshal(fileName string, obj interface{}) error {
 	if err != nil {
 		return err
 	}
-	data, err := utilyaml.ToJSON(f)
+	data, err := utilyaml.ToJSON([]byte(replaceResourceNamesInTemplate(string(f))))
 	if err != nil {
 		return err
 	}
@@ -357,6 +345,12 @@ func createPVCAndApp(
 	if err != nil {
 		return err
 	}
+	if pvcTimeout != 0 && !upgradeTesting {
+		err = validatePVCMetadata(f, pvc)
+		if err != nil {
+			return err
+		}
+	}
 	err = createApp(f.ClientSet, app, deployTimeout)
 
 	return err
@@ -373,6 +367,12 @@ func createPVCAndDeploymentApp(
 	if err != nil {
 		return err
 	}
+	if pvcTimeout != 0 && !upgradeTesting {
+		err = validatePVCMetadata(f, pvc)
+		if err != nil {
+			return err
+		}
+	}
 	err = createDeploymentApp(f.ClientSet, app, deployTimeout)
 
 	return err
@@ -595,7 +595,7 @@ func validateNormalUserPVCAccess(pvcPath string, f *framework.Framework) error {
 	return err
 }
 
-// writeDataInPod fill zero content to a file in the provided POD volume.
+// writeDataInPod fill random content to a file in the provided POD volume.
 func writeDataInPod(app *v1.Pod, opt *metav1.ListOptions, f *framework.Framework) error {
 	app.Namespace = f.UniqueName
 
@@ -604,13 +604,14 @@ func writeDataInPod(app *v1.Pod, opt *metav1.ListOptions, f *framework.Framework
 		return err
 	}
 
-	// write data to PVC. The idea here is to fill some content in the file
-	// instead of filling and reverifying the md5sum/data integrity
+	// write random data to PVC, so that the checksum of the file tells the
+	// content of a restored snapshot or a clone from the content of another
+	// volume
 	filePath := app.Spec.Containers[0].VolumeMounts[0].MountPath + "/test"
 	// While writing more data we are encountering issues in E2E timeout, so keeping it low for now
 	_, writeErr, err := execCommandInPod(
 		f,
-		fmt.Sprintf("dd if=/dev/zero of=%s bs=1M count=10 status=none", filePath),
+		fmt.Sprintf("dd if=/dev/urandom of=%s bs=1M count=10 status=none", filePath),
 		app.Namespace,
 		opt)
 	if err != nil {
@@ -1076,6 +1077,9 @@ func validatePVCSnapshot(
 		go func(n int, s snapapi.VolumeSnapshot) {
 			s.Name = fmt.Sprintf("%s%d", f.UniqueName, n)
 			wgErrs[n] = createSnapshot(&s, deployTimeout)
+			if wgErrs[n] == nil {
+				wgErrs[n] = validateSnapshotMetadata(f, &s)
+			}
 			if wgErrs[n] == nil && kms != noKMS {
 				if kms.canGetPassphrase() {
 					content, sErr := getVolumeSnapshotContent(s.Namespace, s.Name)
@@ -1479,7 +1483,6 @@ func validateController(
 	return deleteResource(rbdExamplePath + "storageclass.yaml")
 }
 
-// nolint:deadcode,unused // Unused code will be used in future.
 // k8sVersionGreaterEquals checks the ServerVersion of the Kubernetes cluster
 // and compares it to the major.minor version passed. In case the version of
 // the cluster is equal or higher to major.minor, `true` is returned, `false`
@@ -1487,18 +1490,15 @@ func validateController(
 // If fetching the ServerVersion of the Kubernetes cluster fails, the calling
 // test case is marked as `FAILED` and gets aborted.
 func k8sVersionGreaterEquals(c kubernetes.Interface, major, minor int) bool {
-	v, err := c.Discovery().ServerVersion()
+	v, err := getK8sVersion(c)
 	if err != nil {
-		e2elog.Failf("failed to get server version: %v", err)
+		e2elog.Failf("failed to detect Kubernetes version: %v", err)
 		// Failf() marks the case as failure, and returns from the
 		// Go-routine that runs the case. This function will not have a
 		// return value.
 	}
 
-	maj := fmt.Sprintf("%d", major)
-	min := fmt.Sprintf("%d", minor)
-
-	return (v.Major > maj) || (v.Major == maj && v.Minor >= min)
+	return v.atLeast(version{major: major, minor: minor})
 }
 
 // waitForJobCompletion polls the status of the given job and waits until the
@@ -0,0 +1,202 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	e2elog "k8s.io/kubernetes/test/e2e/framework/log"
+)
+
+// stateBackoff is the interval between the checks of waitForState(). It
+// starts at poll, and grows up to a few times poll. The jitter prevents the
+// parallel waits of a test from hitting the API server at the same time.
+var stateBackoff = wait.Backoff{
+	Duration: poll,
+	Factor:   1.5,
+	Jitter:   0.2,
+	Steps:    math.MaxInt32,
+	Cap:      4 * poll,
+}
+
+// stateCondition describes the awaited state of an object of type T.
+type stateCondition[T any] struct {
+	// name of the state, like "bound" or "ready to use"
+	name string
+	// met returns whether the observed state is the awaited one. An error
+	// stops the wait.
+	met func(T) (bool, error)
+	// describe optionally summarizes the observed state, it is logged and
+	// included in the error on timeout
+	describe func(T) string
+}
+
+// stateGetter returns the current state of an object. Retryable API errors
+// and a missing object are retried.
+type stateGetter[T any] func() (T, error)
+
+// waitForState calls get until the state it returns meets the condition, or
+// the timeout passes. The last observed state (or error) is included in the
+// error on timeout, which wraps wait.ErrWaitTimeout.
+func waitForState[T any](object string, get stateGetter[T], cond stateCondition[T], timeout time.Duration) (T, error) {
+	return waitForStateWithBackoff(stateBackoff, object, get, cond, timeout)
+}
+
+// waitForStateWithBackoff is waitForState() with the intervals of backoff.
+func waitForStateWithBackoff[T any](
+	backoff wait.Backoff,
+	object string,
+	get stateGetter[T],
+	cond stateCondition[T],
+	timeout time.Duration,
+) (T, error) {
+	var (
+		state    T
+		observed = "nothing"
+		start    = time.Now()
+		deadline = start.Add(timeout)
+	)
+	e2elog.Logf("waiting up to %v for %s to be %s", timeout, object, cond.name)
+	for {
+		current, err := get()
+		switch {
+		case err == nil:
+			state = current
+			observed = describeState(cond, current)
+			done, condErr := cond.met(current)
+			if condErr != nil {
+				return state, fmt.Errorf("%s can not become %s (%s): %w", object, cond.name, observed, condErr)
+			}
+			if done {
+				return state, nil
+			}
+		case isRetryableAPIError(err) || apierrs.IsNotFound(err):
+			observed = err.Error()
+		default:
+			return state, fmt.Errorf("failed to get %s: %w", object, err)
+		}
+
+		elapsed := time.Since(start)
+		if elapsed >= timeout {
+			return state, fmt.Errorf("timed out after %v waiting for %s to be %s, last observed: %s: %w",
+				timeout, object, cond.name, observed, wait.ErrWaitTimeout)
+		}
+		e2elog.Logf("%s is not %s yet (%d seconds elapsed): %s", object, cond.name, int(elapsed.Seconds()), observed)
+
+		interval := backoff.Step()
+		if remaining := time.Until(deadline); interval > remaining {
+			interval = remaining
+		}
+		time.Sleep(interval)
+	}
+}
+
+// describeState returns the summary of the state for the condition.
+func describeState[T any](cond stateCondition[T], state T) string {
+	if cond.describe != nil {
+		return cond.describe(state)
+	}
+
+	return fmt.Sprintf("%+v", state)
+}
+
+// pvcBound is met once the PVC is bound to a PV.
+var pvcBound = stateCondition[*v1.PersistentVolumeClaim]{
+	name: "bound",
+	met: func(pvc *v1.PersistentVolumeClaim) (bool, error) {
+		if pvc.Status.Phase == v1.ClaimLost {
+			return false, fmt.Errorf("PVC %s lost its PV %s", pvc.Name, pvc.Spec.VolumeName)
+		}
+
+		return pvc.Status.Phase == v1.ClaimBound && pvc.Spec.VolumeName != "", nil
+	},
+	describe: func(pvc *v1.PersistentVolumeClaim) string {
+		return fmt.Sprintf("phase %q, volume %q", pvc.Status.Phase, pvc.Spec.VolumeName)
+	},
+}
+
+// snapshotReady is met once the VolumeSnapshot is ready to be restored.
+var snapshotReady = stateCondition[*snapapi.VolumeSnapshot]{
+	name: "ready to use",
+	met: func(snap *snapapi.VolumeSnapshot) (bool, error) {
+		if snap.Status == nil || snap.Status.ReadyToUse == nil {
+			return false, nil
+		}
+
+		return *snap.Status.ReadyToUse, nil
+	},
+	describe: func(snap *snapapi.VolumeSnapshot) string {
+		if snap.Status == nil {
+			return "no status"
+		}
+		description := "readyToUse unset"
+		if snap.Status.ReadyToUse != nil {
+			description = fmt.Sprintf("readyToUse %t", *snap.Status.ReadyToUse)
+		}
+		if snap.Status.Error != nil && snap.Status.Error.Message != nil {
+			description += ", error: " + *snap.Status.Error.Message
+		}
+
+		return description
+	},
+}
+
+// waitForDeletion waits until get returns a "not found" error for the object.
+func waitForDeletion[T any](object string, get stateGetter[*T], timeout time.Duration) error {
+	getOrNil := func() (*T, error) {
+		obj, err := get()
+		if apierrs.IsNotFound(err) {
+			return nil, nil
+		}
+
+		return obj, err
+	}
+	_, err := waitForState(object, getOrNil, stateCondition[*T]{
+		name: "deleted",
+		met: func(obj *T) (bool, error) {
+			return obj == nil, nil
+		},
+		describe: func(obj *T) string {
+			if obj == nil {
+				return "not found"
+			}
+
+			return "still exists"
+		},
+	}, timeout)
+
+	return err
+}
+
+// emptyList is met once the list returned by the getter is empty.
+func emptyList[T any](name string) stateCondition[[]T] {
+	return stateCondition[[]T]{
+		name: name,
+		met: func(items []T) (bool, error) {
+			return len(items) == 0, nil
+		},
+		describe: func(items []T) string {
+			return fmt.Sprintf("%d items: %+v", len(items), items)
+		},
+	}
+}
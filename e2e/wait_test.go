@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package e2e
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+func TestWaitForState(t *testing.T) {
+	t.Parallel()
+	backoff := wait.Backoff{Duration: time.Millisecond, Factor: 2, Jitter: 0.5, Steps: 100, Cap: 10 * time.Millisecond}
+	notFound := apierrs.NewNotFound(schema.GroupResource{Resource: "counters"}, "counter")
+	errFailed := errors.New("failed")
+	atLeast := func(n int) stateCondition[int] {
+		return stateCondition[int]{
+			name: "large enough",
+			met: func(i int) (bool, error) {
+				if i < 0 {
+					return false, errFailed
+				}
+
+				return i >= n, nil
+			},
+		}
+	}
+
+	tests := []struct {
+		name string
+		// results returned by the getter in order, the last one repeats
+		values  []int
+		errs    []error
+		cond    stateCondition[int]
+		want    int
+		wantErr string
+		timeout bool
+	}{
+		{
+			name:   "met after some calls",
+			values: []int{0, 1, 2, 3},
+			errs:   []error{nil, nil, nil, nil},
+			cond:   atLeast(3),
+			want:   3,
+		},
+		{
+			name:   "missing object is retried",
+			values: []int{0, 5},
+			errs:   []error{notFound, nil},
+			cond:   atLeast(3),
+			want:   5,
+		},
+		{
+			name:    "timeout reports the last observed state",
+			values:  []int{1, 2},
+			errs:    []error{nil, nil},
+			cond:    atLeast(3),
+			want:    2,
+			wantErr: "last observed: 2",
+			timeout: true,
+		},
+		{
+			name:    "condition error stops the wait",
+			values:  []int{1, -1},
+			errs:    []error{nil, nil},
+			cond:    atLeast(3),
+			want:    -1,
+			wantErr: "failed",
+		},
+		{
+			name:    "getter error stops the wait",
+			values:  []int{1, 0},
+			errs:    []error{nil, errFailed},
+			cond:    atLeast(3),
+			want:    1,
+			wantErr: "failed to get counter",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			calls := 0
+			get := func() (int, error) {
+				i := calls
+				if i >= len(ts.values) {
+					i = len(ts.values) - 1
+				}
+				calls++
+
+				return ts.values[i], ts.errs[i]
+			}
+			got, err := waitForStateWithBackoff(backoff, "counter", get, ts.cond, 50*time.Millisecond)
+			if got != ts.want {
+				t.Errorf("waitForStateWithBackoff() = %d, want %d", got, ts.want)
+			}
+			switch {
+			case ts.wantErr == "" && err != nil:
+				t.Errorf("waitForStateWithBackoff() unexpected error: %v", err)
+			case ts.wantErr != "" && (err == nil || !strings.Contains(err.Error(), ts.wantErr)):
+				t.Errorf("waitForStateWithBackoff() error = %v, want %q", err, ts.wantErr)
+			}
+			if ts.timeout != errors.Is(err, wait.ErrWaitTimeout) {
+				t.Errorf("waitForStateWithBackoff() error = %v, timeout expected: %t", err, ts.timeout)
+			}
+		})
+	}
+}
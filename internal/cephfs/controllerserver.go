@@ -50,14 +50,29 @@ type ControllerServer struct {
 	// for that same snapshot (as defined by SnapshotID/snapshot name) return an Aborted error
 	SnapshotLocks *util.VolumeLocks
 
+	// A map storing all source volumes with an ongoing CreateSnapshot, so
+	// that snapshots of the same volume are created one after another
+	SnapshotSourceLocks *util.VolumeLocks
+
 	// A map storing all volumes/snapshots with ongoing operations.
 	OperationLocks *util.OperationLock
 
+	// MaxSnapshotsPerVolume is the default maximum number of snapshots of a
+	// volume, 0 is unlimited
+	MaxSnapshotsPerVolume uint
+
+	// A cache of recent CreateVolume responses, used to answer retries of
+	// completed requests without checking the reservation again
+	CreateVolumeCache *util.CreateVolumeCache
+
 	// Cluster name
 	ClusterName string
 
 	// Set metadata on volume
 	SetMetadata bool
+
+	// StrictParameters rejects requests with unknown parameters
+	StrictParameters bool
 }
 
 // createBackingVolume creates the backing subvolume and on any error cleans up any created entities.
@@ -169,6 +184,19 @@ func (cs *ControllerServer) checkContentSource(
 
 			return nil, nil, nil, status.Error(codes.Internal, err.Error())
 		}
+		err = k8s.CheckDataSourceReferenceGrant(ctx, req.GetParameters())
+		if err != nil {
+			volOpt.Destroy()
+			log.ErrorLog(ctx, "restoring snapshot %s is not allowed: %v", snapshotID, err)
+			if errors.Is(err, k8s.ErrNoReferenceGrant) {
+				return nil, nil, nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+			if errors.Is(err, k8s.ErrNoPVCMetadata) {
+				return nil, nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+			}
+
+			return nil, nil, nil, status.Error(codes.Internal, err.Error())
+		}
 
 		return volOpt, nil, sid, nil
 	case *csi.VolumeContentSource_Volume:
@@ -201,18 +229,18 @@ func checkValidCreateVolumeRequest(
 ) error {
 	switch {
 	case pvID != nil:
-		if vol.Size < parentVol.Size {
-			return fmt.Errorf(
-				"cannot clone from volume %s: volume size %d is smaller than source volume size %d",
-				pvID.VolumeID,
-				parentVol.Size,
-				vol.Size)
+		err := util.CheckContentSourceSize(vol.Size, parentVol.Size, "volume "+pvID.VolumeID)
+		if err != nil {
+			return err
 		}
 
 		if vol.BackingSnapshot {
 			return errors.New("cloning snapshot-backed volumes is currently not supported")
 		}
 	case sID != nil:
+		// the size of the subvolume at the time of the snapshot is not
+		// recorded, parentVol.Size is the current quota of the subvolume,
+		// which is larger than the snapshot after the subvolume was expanded
 		if vol.BackingSnapshot {
 			volCaps := req.GetVolumeCapabilities()
 			for _, volCap := range volCaps {
@@ -240,6 +268,12 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, err
 	}
 
+	if resp := cs.CreateVolumeCache.Get(req); resp != nil {
+		log.DebugLog(ctx, "cephfs: returning cached response for request name %s", req.GetName())
+
+		return resp, nil
+	}
+
 	// Configuration
 	secret := req.GetSecrets()
 	requestName := req.GetName()
@@ -282,6 +316,10 @@ func (cs *ControllerServer) CreateVolume(
 
 	err = checkValidCreateVolumeRequest(volOptions, parentVol, pvID, sID, req)
 	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
@@ -295,11 +333,13 @@ func (cs *ControllerServer) CreateVolume(
 	}
 	// TODO return error message if requested vol size greater than found volume return error
 
-	metadata := k8s.GetVolumeMetadata(req.GetParameters())
+	metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetVolumeMetadata(req.GetParameters()))
 	if vID != nil {
 		volClient := core.NewSubVolume(volOptions.GetConnection(), &volOptions.SubVolume,
 			volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
-		if sID != nil || pvID != nil && !volOptions.BackingSnapshot {
+		// the clone of an interrupted request may not have been expanded to
+		// the requested size yet, snapshot-backed volumes have no subvolume
+		if (sID != nil || pvID != nil) && !volOptions.BackingSnapshot {
 			err = volClient.ExpandVolume(ctx, volOptions.Size)
 			if err != nil {
 				purgeErr := volClient.PurgeVolume(ctx, false)
@@ -333,6 +373,7 @@ func (cs *ControllerServer) CreateVolume(
 		volumeContext := k8s.RemoveCSIPrefixedParameters(req.GetParameters())
 		volumeContext["subvolumeName"] = vID.FsSubvolName
 		volumeContext["subvolumePath"] = volOptions.RootPath
+		util.AddTopologySegment(volumeContext, volOptions.Topology)
 		volume := &csi.Volume{
 			VolumeId:      vID.VolumeID,
 			CapacityBytes: volOptions.Size,
@@ -347,8 +388,26 @@ func (cs *ControllerServer) CreateVolume(
 			}
 		}
 
-		return &csi.CreateVolumeResponse{Volume: volume}, nil
+		resp := &csi.CreateVolumeResponse{Volume: volume}
+		cs.CreateVolumeCache.Add(req, resp)
+
+		return resp, nil
+	}
+
+	err = cs.reserveTenantQuota(ctx, volOptions, cr, volOptions.Size)
+	if err != nil {
+		if errors.Is(err, util.ErrTenantQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
 	}
+	defer func() {
+		// a clone that is in progress is created by the retry
+		if err != nil && !cerrors.IsCloneRetryError(err) && !volOptions.BackingSnapshot {
+			store.ReleaseTenantQuota(ctx, volOptions, cr, volOptions.Size)
+		}
+	}()
 
 	// Reservation
 	vID, err = store.ReserveVol(ctx, volOptions, secret)
@@ -419,6 +478,7 @@ func (cs *ControllerServer) CreateVolume(
 	volumeContext := k8s.RemoveCSIPrefixedParameters(req.GetParameters())
 	volumeContext["subvolumeName"] = vID.FsSubvolName
 	volumeContext["subvolumePath"] = volOptions.RootPath
+	util.AddTopologySegment(volumeContext, volOptions.Topology)
 	volume := &csi.Volume{
 		VolumeId:      vID.VolumeID,
 		CapacityBytes: volOptions.Size,
@@ -433,7 +493,10 @@ func (cs *ControllerServer) CreateVolume(
 		}
 	}
 
-	return &csi.CreateVolumeResponse{Volume: volume}, nil
+	resp := &csi.CreateVolumeResponse{Volume: volume}
+	cs.CreateVolumeCache.Add(req, resp)
+
+	return resp, nil
 }
 
 // DeleteVolume deletes the volume in backend and its reservation.
@@ -466,6 +529,9 @@ func (cs *ControllerServer) DeleteVolume(
 	}
 	defer cs.OperationLocks.ReleaseDeleteLock(req.GetVolumeId())
 
+	// the volume may not be returned for new CreateVolume requests anymore
+	cs.CreateVolumeCache.Forget(string(volID))
+
 	// Find the volume using the provided VolumeID
 	volOptions, vID, err := store.NewVolumeOptionsFromVolID(ctx, string(volID), nil, secrets,
 		cs.ClusterName, cs.SetMetadata)
@@ -556,7 +622,10 @@ func (cs *ControllerServer) cleanUpBackingVolume(
 			if !errors.Is(err, cerrors.ErrVolumeNotFound) {
 				return status.Error(codes.Internal, err.Error())
 			}
+
+			return nil
 		}
+		store.ReleaseTenantQuota(ctx, volOptions, cr, volOptions.Size)
 
 		return nil
 	}
@@ -633,6 +702,43 @@ func (cs *ControllerServer) ValidateVolumeCapabilities(
 	}, nil
 }
 
+// GetCapacity returns the space that is available in the data pool of the
+// filesystem in the parameters. This is the pool of the StorageClass, or the
+// default data pool of the filesystem. The request does not contain secrets,
+// so the credentials of the cluster need to be configured in the credentials
+// directory of the CSI config file.
+func (cs *ControllerServer) GetCapacity(
+	ctx context.Context,
+	req *csi.GetCapacityRequest,
+) (*csi.GetCapacityResponse, error) {
+	clusterID := req.GetParameters()["clusterID"]
+	if clusterID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required parameter clusterID")
+	}
+	fsName := req.GetParameters()["fsName"]
+	if fsName == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required parameter fsName")
+	}
+	pool := req.GetParameters()["pool"]
+
+	available, err := util.GetFilesystemAvailableBytes(clusterID, fsName, pool)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get available capacity of filesystem %s in cluster %s: %v", fsName, clusterID, err)
+		if errors.Is(err, util.ErrNoCredentials) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, util.ErrPoolNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+	}, nil
+}
+
 // ControllerExpandVolume expands CephFS Volumes on demand based on resizer request.
 func (cs *ControllerServer) ControllerExpandVolume(
 	ctx context.Context,
@@ -684,10 +790,26 @@ func (cs *ControllerServer) ControllerExpandVolume(
 
 	RoundOffSize := util.RoundOffCephFSVolSize(req.GetCapacityRange().GetRequiredBytes())
 
+	var delta int64
+	if RoundOffSize > volOptions.Size {
+		delta = RoundOffSize - volOptions.Size
+		err = cs.reserveTenantQuota(ctx, volOptions, cr, delta)
+		if err != nil {
+			if errors.Is(err, util.ErrTenantQuotaExceeded) {
+				return nil, status.Error(codes.ResourceExhausted, err.Error())
+			}
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	volClient := core.NewSubVolume(volOptions.GetConnection(),
 		&volOptions.SubVolume, volOptions.ClusterID, cs.ClusterName, cs.SetMetadata)
 	if err = volClient.ResizeVolume(ctx, RoundOffSize); err != nil {
 		log.ErrorLog(ctx, "failed to expand volume %s: %v", fsutil.VolumeID(volIdentifier.FsSubvolName), err)
+		if delta != 0 {
+			store.ReleaseTenantQuota(ctx, volOptions, cr, delta)
+		}
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -716,7 +838,7 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	clusterData, err := store.GetClusterInformation(req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(util.ParameterErrorCode(err), err.Error())
 	}
 
 	requestName := req.GetName()
@@ -729,6 +851,16 @@ func (cs *ControllerServer) CreateSnapshot(
 	}
 	defer cs.SnapshotLocks.Release(requestName)
 
+	// Snapshots of the same subvolume are created one after another, the
+	// existence check below finds the snapshot of a retried request once the
+	// one in flight completed
+	if acquired := cs.SnapshotSourceLocks.Acquire(ctx, sourceVolID); !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, sourceVolID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, sourceVolID)
+	}
+	defer cs.SnapshotSourceLocks.Release(sourceVolID)
+
 	if err = cs.OperationLocks.GetSnapshotCreateLock(sourceVolID); err != nil {
 		log.ErrorLog(ctx, err.Error())
 
@@ -769,7 +901,7 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	cephfsSnap, genSnapErr := store.GenSnapFromOptions(ctx, req)
 	if genSnapErr != nil {
-		return nil, status.Error(codes.Internal, genSnapErr.Error())
+		return nil, status.Error(util.ParameterErrorCode(genSnapErr), genSnapErr.Error())
 	}
 
 	// lock out parallel snapshot create operations
@@ -849,6 +981,15 @@ func (cs *ControllerServer) CreateSnapshot(
 		}, nil
 	}
 
+	err = cs.checkSnapshotLimit(ctx, volClient, sourceVolID, req.GetParameters())
+	if err != nil {
+		if errors.Is(err, util.ErrSnapshotLimitExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
 	// Reservation
 	sID, err := store.ReserveSnap(ctx, parentVolOptions, vid.FsSubvolName, cephfsSnap, cr)
 	if err != nil {
@@ -879,6 +1020,78 @@ func (cs *ControllerServer) CreateSnapshot(
 	}, nil
 }
 
+// checkTenantQuota returns util.ErrTenantQuotaExceeded when the new
+// subvolume does not fit in the quota of its owner in the filesystem.
+// Snapshot-backed volumes do not use any space of the filesystem. The usage
+// of the owner is not modified, reserveTenantQuota needs to be called to
+// create the subvolume.
+func (cs *ControllerServer) checkTenantQuota(
+	ctx context.Context,
+	volOptions *store.VolumeOptions,
+	cr *util.Credentials,
+) error {
+	if volOptions.Owner == "" || volOptions.BackingSnapshot {
+		return nil
+	}
+
+	quota, err := util.GetTenantQuota(util.CsiConfigFile, volOptions.ClusterID, volOptions.Owner, volOptions.FsName)
+	if err != nil || quota == 0 {
+		return err
+	}
+
+	used, err := store.GetTenantUsage(ctx, volOptions, cr)
+	if err != nil {
+		return err
+	}
+	log.DebugLog(ctx, "tenant %s uses %d of %d bytes in filesystem %s", volOptions.Owner, used, quota,
+		volOptions.FsName)
+
+	return util.CheckTenantQuota(volOptions.Owner, volOptions.FsName, used, volOptions.Size, quota)
+}
+
+// reserveTenantQuota adds size bytes to the usage of the owner of the
+// subvolume in the filesystem, and returns util.ErrTenantQuotaExceeded when
+// they do not fit in the quota of the owner.
+func (cs *ControllerServer) reserveTenantQuota(
+	ctx context.Context,
+	volOptions *store.VolumeOptions,
+	cr *util.Credentials,
+	size int64,
+) error {
+	if volOptions.Owner == "" || volOptions.BackingSnapshot {
+		return nil
+	}
+
+	quota, err := util.GetTenantQuota(util.CsiConfigFile, volOptions.ClusterID, volOptions.Owner, volOptions.FsName)
+	if err != nil {
+		return err
+	}
+
+	return store.ReserveTenantQuota(ctx, volOptions, cr, size, quota)
+}
+
+// checkSnapshotLimit returns util.ErrSnapshotLimitExceeded when the
+// subvolume has the maximum number of snapshots of the parameters already.
+// Snapshots that were not created by Ceph-CSI are counted too.
+func (cs *ControllerServer) checkSnapshotLimit(
+	ctx context.Context,
+	volClient core.SubVolumeClient,
+	volID string,
+	parameters map[string]string,
+) error {
+	limit, err := util.GetMaxSnapshotsPerVolume(parameters, cs.MaxSnapshotsPerVolume)
+	if err != nil || limit == 0 {
+		return err
+	}
+
+	snaps, err := volClient.ListSnapshots(ctx)
+	if err != nil {
+		return err
+	}
+
+	return util.CheckSnapshotLimit(volID, len(snaps), limit)
+}
+
 func (cs *ControllerServer) doSnapshot(
 	ctx context.Context,
 	volOpt *store.VolumeOptions,
@@ -947,6 +1160,18 @@ func (cs *ControllerServer) validateSnapshotReq(ctx context.Context, req *csi.Cr
 	if req.SourceVolumeId == "" {
 		return status.Error(codes.NotFound, "source Volume ID cannot be empty")
 	}
+	// only the RBD snapshots expire, see internal/controller/snapshotexpiry
+	if _, ok := req.GetParameters()[k8s.SnapshotRetentionKey]; ok {
+		return status.Errorf(codes.InvalidArgument, "%s is not supported for CephFS snapshots", k8s.SnapshotRetentionKey)
+	}
+	if _, err := util.GetMaxSnapshotsPerVolume(req.GetParameters(), cs.MaxSnapshotsPerVolume); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if cs.StrictParameters {
+		if err := k8s.CheckParameters(req.GetParameters(), snapshotParameters); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
 
 	return nil
 }
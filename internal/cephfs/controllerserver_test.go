@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestCheckValidCreateVolumeRequest(t *testing.T) {
+	t.Parallel()
+
+	const gib = 1024 * 1024 * 1024
+	tests := []struct {
+		name     string
+		size     int64
+		parent   int64
+		pvID     *store.VolumeIdentifier
+		sID      *store.SnapshotIdentifier
+		wantCode codes.Code
+	}{
+		{
+			name:     "clone of the same size",
+			size:     gib,
+			parent:   gib,
+			pvID:     &store.VolumeIdentifier{VolumeID: "csi-vol-1"},
+			wantCode: codes.OK,
+		},
+		{
+			name:     "clone smaller than the source",
+			size:     gib,
+			parent:   2 * gib,
+			pvID:     &store.VolumeIdentifier{VolumeID: "csi-vol-1"},
+			wantCode: codes.OutOfRange,
+		},
+		{
+			// the parent was expanded after the snapshot was taken, the
+			// restore has the size of the snapshot
+			name:     "restore of a snapshot after the parent was expanded",
+			size:     gib,
+			parent:   2 * gib,
+			sID:      &store.SnapshotIdentifier{SnapshotID: "csi-snap-1"},
+			wantCode: codes.OK,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			vol := &store.VolumeOptions{}
+			vol.Size = ts.size
+			parentVol := &store.VolumeOptions{}
+			parentVol.Size = ts.parent
+			err := checkValidCreateVolumeRequest(vol, parentVol, ts.pvID, ts.sID, &csi.CreateVolumeRequest{})
+			if code := status.Code(err); code != ts.wantCode {
+				t.Errorf("checkValidCreateVolumeRequest() = %v, want code %v", err, ts.wantCode)
+			}
+		})
+	}
+}
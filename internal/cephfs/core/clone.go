@@ -20,8 +20,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/ceph/go-ceph/cephfs/admin"
@@ -65,6 +67,8 @@ func (s *subVolumeClient) CreateCloneFromSubvolume(
 	ctx context.Context,
 	parentvolOpt *SubVolume,
 ) error {
+	defer util.ObserveOperation(ctx, "cephfs", s.clusterID, util.OpClone, time.Now())
+
 	snapshotID := s.VolID
 	snapClient := NewSnapshot(s.conn, snapshotID, s.clusterID, s.clusterName, s.enableMetadata, parentvolOpt)
 	err := snapClient.CreateSnapshot(ctx)
@@ -197,6 +201,8 @@ func (s *subVolumeClient) CleanupSnapshotFromSubvolume(
 func (s *subVolumeClient) CreateCloneFromSnapshot(
 	ctx context.Context, snap Snapshot,
 ) error {
+	defer util.ObserveOperation(ctx, "cephfs", s.clusterID, util.OpClone, time.Now())
+
 	snapID := snap.SnapshotID
 	snapClient := NewSnapshot(s.conn, snapID, s.clusterID, s.clusterName, s.enableMetadata, snap.SubVolume)
 	err := snapClient.CloneSnapshot(ctx, s.SubVolume)
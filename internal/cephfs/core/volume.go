@@ -22,6 +22,7 @@ import (
 	"fmt"
 	"path"
 	"strings"
+	"time"
 
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
@@ -56,6 +57,8 @@ type SubVolumeClient interface {
 	CreateVolume(ctx context.Context) error
 	// GetSubVolumeInfo returns the subvolume information.
 	GetSubVolumeInfo(ctx context.Context) (*Subvolume, error)
+	// ListSnapshots returns the names of the snapshots of the subvolume.
+	ListSnapshots(ctx context.Context) ([]string, error)
 	// ExpandVolume expands the volume if the requested size is greater than
 	// the subvolume size.
 	ExpandVolume(ctx context.Context, bytesQuota int64) error
@@ -188,6 +191,28 @@ func (s *subVolumeClient) GetSubVolumeInfo(ctx context.Context) (*Subvolume, err
 	return &subvol, nil
 }
 
+// ListSnapshots returns the names of the snapshots of the subvolume.
+func (s *subVolumeClient) ListSnapshots(ctx context.Context) ([]string, error) {
+	fsa, err := s.conn.GetFSAdmin()
+	if err != nil {
+		log.ErrorLog(ctx, "could not get FSAdmin: %s", err)
+
+		return nil, err
+	}
+
+	snaps, err := fsa.ListSubVolumeSnapshots(s.FsName, s.SubvolumeGroup, s.VolID)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to list snapshots of subvolume %s in fs %s: %s", s.VolID, s.FsName, err)
+		if errors.Is(err, rados.ErrNotFound) {
+			return nil, cerrors.ErrVolumeNotFound
+		}
+
+		return nil, err
+	}
+
+	return snaps, nil
+}
+
 type operationState int64
 
 const (
@@ -220,6 +245,8 @@ func newLocalClusterState(clusterID string) {
 
 // CreateVolume creates a subvolume.
 func (s *subVolumeClient) CreateVolume(ctx context.Context) error {
+	defer util.ObserveOperation(ctx, "cephfs", s.clusterID, util.OpVolumeCreate, time.Now())
+
 	newLocalClusterState(s.clusterID)
 
 	ca, err := s.conn.GetFSAdmin()
@@ -280,8 +307,8 @@ func (s *subVolumeClient) ExpandVolume(ctx context.Context, bytesQuota int64) er
 		return err
 	}
 	// resize if the requested size is greater than the current size.
-	if s.Size > info.BytesQuota {
-		log.DebugLog(ctx, "clone %s size %d is greater than requested size %d", s.VolID, info.BytesQuota, bytesQuota)
+	if bytesQuota > info.BytesQuota {
+		log.DebugLog(ctx, "clone %s size %d is smaller than requested size %d", s.VolID, info.BytesQuota, bytesQuota)
 		err = s.ResizeVolume(ctx, bytesQuota)
 	}
 
@@ -17,6 +17,8 @@ limitations under the License.
 package cephfs
 
 import (
+	"errors"
+
 	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
 	"github.com/ceph/ceph-csi/internal/cephfs/store"
 	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
@@ -46,6 +48,17 @@ func NewDriver() *Driver {
 	return &Driver{}
 }
 
+// InitJournals initializes the volume and snapshot journals of the store,
+// with the instance ID as suffix of the omap names when it is set.
+func InitJournals(instance string) {
+	// Use passed in instance ID, if provided for omap suffix naming
+	if instance != "" {
+		CSIInstanceID = instance
+	}
+	store.VolJournal = journal.NewCSIVolumeJournalWithNamespace(CSIInstanceID, fsutil.RadosNamespace)
+	store.SnapJournal = journal.NewCSISnapshotJournalWithNamespace(CSIInstanceID, fsutil.RadosNamespace)
+}
+
 // NewIdentityServer initialize a identity server for ceph CSI driver.
 func NewIdentityServer(d *csicommon.CSIDriver) *IdentityServer {
 	return &IdentityServer{
@@ -58,11 +71,33 @@ func NewControllerServer(d *csicommon.CSIDriver) *ControllerServer {
 	return &ControllerServer{
 		DefaultControllerServer: csicommon.NewDefaultControllerServer(d),
 		VolumeLocks:             util.NewVolumeLocks(),
-		SnapshotLocks:           util.NewVolumeLocks(),
+		SnapshotLocks:           util.NewSnapshotLocks(),
+		SnapshotSourceLocks:     util.NewSnapshotSourceLocks(),
 		OperationLocks:          util.NewOperationLock(),
 	}
 }
 
+// NewDryRunControllerServer returns a controller server for dry-runs of
+// CreateVolume, configured like the controller server of a driver that is
+// started with conf. The journals need to be initialized with InitJournals().
+func NewDryRunControllerServer(conf *util.Config) (*ControllerServer, error) {
+	// the controller server does not use the node ID
+	cd := csicommon.NewCSIDriver(conf.DriverName, util.DriverVersion, "dry-run")
+	if cd == nil {
+		return nil, errors.New("failed to initialize CSI Driver")
+	}
+	cd.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+	})
+
+	cs := NewControllerServer(cd)
+	cs.ClusterName = conf.ClusterName
+	cs.SetMetadata = conf.SetMetadata
+	cs.StrictParameters = conf.StrictParameters
+
+	return cs, nil
+}
+
 // NewNodeServer initialize a node server for ceph CSI driver.
 func NewNodeServer(
 	d *csicommon.CSIDriver,
@@ -70,12 +105,16 @@ func NewNodeServer(
 	topology map[string]string,
 	kernelMountOptions string,
 	fuseMountOptions string,
+	volumeMountGroup bool,
+	mountOptionsPolicy *util.MountOptionsPolicy,
 ) *NodeServer {
 	return &NodeServer{
 		DefaultNodeServer:  csicommon.NewDefaultNodeServer(d, t, topology),
 		VolumeLocks:        util.NewVolumeLocks(),
 		kernelMountOptions: kernelMountOptions,
 		fuseMountOptions:   fuseMountOptions,
+		volumeMountGroup:   volumeMountGroup,
+		mountOptionsPolicy: mountOptionsPolicy,
 	}
 }
 
@@ -90,14 +129,8 @@ func (fs *Driver) Run(conf *util.Config) {
 		log.FatalLogMsg("cephfs: failed to load ceph mounters: %v", err)
 	}
 
-	// Use passed in instance ID, if provided for omap suffix naming
-	if conf.InstanceID != "" {
-		CSIInstanceID = conf.InstanceID
-	}
-	// Create an instance of the volume journal
-	store.VolJournal = journal.NewCSIVolumeJournalWithNamespace(CSIInstanceID, fsutil.RadosNamespace)
-
-	store.SnapJournal = journal.NewCSISnapshotJournalWithNamespace(CSIInstanceID, fsutil.RadosNamespace)
+	// Create an instance of the volume and snapshot journal
+	InitJournals(conf.InstanceID)
 	// Initialize default library driver
 
 	fs.cd = csicommon.NewCSIDriver(conf.DriverName, util.DriverVersion, conf.NodeID)
@@ -112,6 +145,7 @@ func (fs *Driver) Run(conf *util.Config) {
 			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 			csi.ControllerServiceCapability_RPC_SINGLE_NODE_MULTI_WRITER,
+			csi.ControllerServiceCapability_RPC_GET_CAPACITY,
 		})
 
 		fs.cd.AddVolumeCapabilityAccessModes([]csi.VolumeCapability_AccessMode_Mode{
@@ -130,22 +164,52 @@ func (fs *Driver) Run(conf *util.Config) {
 		if err != nil {
 			log.FatalLogMsg(err.Error())
 		}
-		fs.ns = NewNodeServer(fs.cd, conf.Vtype, topology, conf.KernelMountOptions, conf.FuseMountOptions)
+		var policy *util.MountOptionsPolicy
+		policy, err = util.LoadMountOptionsPolicy(conf.MountOptionsPolicy)
+		if err != nil {
+			log.FatalLogMsg(err.Error())
+		}
+		fs.ns = NewNodeServer(
+			fs.cd, conf.Vtype, topology, conf.KernelMountOptions, conf.FuseMountOptions, conf.EnableVolumeMountGroup,
+			policy)
 	}
 
 	if conf.IsControllerServer {
 		fs.cs = NewControllerServer(fs.cd)
 		fs.cs.ClusterName = conf.ClusterName
 		fs.cs.SetMetadata = conf.SetMetadata
+		fs.cs.StrictParameters = conf.StrictParameters
+		fs.cs.MaxSnapshotsPerVolume = conf.MaxSnapshotsPerVolume
+		fs.cs.CreateVolumeCache = util.NewCreateVolumeCache(conf.CreateVolumeCacheTTL)
 	}
 	if !conf.IsControllerServer && !conf.IsNodeServer {
 		topology, err = util.GetTopologyFromDomainLabels(conf.DomainLabels, conf.NodeID, conf.DriverName)
 		if err != nil {
 			log.FatalLogMsg(err.Error())
 		}
-		fs.ns = NewNodeServer(fs.cd, conf.Vtype, topology, conf.KernelMountOptions, conf.FuseMountOptions)
+		var policy *util.MountOptionsPolicy
+		policy, err = util.LoadMountOptionsPolicy(conf.MountOptionsPolicy)
+		if err != nil {
+			log.FatalLogMsg(err.Error())
+		}
+		fs.ns = NewNodeServer(
+			fs.cd, conf.Vtype, topology, conf.KernelMountOptions, conf.FuseMountOptions, conf.EnableVolumeMountGroup,
+			policy)
 		fs.cs = NewControllerServer(fs.cd)
 	}
+	if conf.AdminSocket != "" {
+		var (
+			cache      *util.CreateVolumeCache
+			statsCache *csicommon.VolumeStatsCache
+		)
+		if fs.cs != nil {
+			cache = fs.cs.CreateVolumeCache
+		}
+		if fs.ns != nil {
+			statsCache = fs.ns.StatsCache
+		}
+		util.RegisterAdminCommand("invalidate-cache", util.NewInvalidateCacheCommand(cache, statsCache))
+	}
 
 	server := csicommon.NewNonBlockingGRPCServer()
 	srv := csicommon.Servers{
@@ -155,17 +219,24 @@ func (fs *Driver) Run(conf *util.Config) {
 		// passing nil for replication server as cephFS does not support mirroring.
 		RS: nil,
 	}
-	server.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableGRPCMetrics)
-	if conf.EnableGRPCMetrics {
-		log.WarningLogMsg("EnableGRPCMetrics is deprecated")
+	server.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableMetrics)
+	if conf.EnableMetrics {
 		go util.StartMetricsServer(conf)
 	}
 	if conf.EnableProfiling {
-		if !conf.EnableGRPCMetrics {
+		if !conf.EnableMetrics {
 			go util.StartMetricsServer(conf)
 		}
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
+	if conf.IsControllerServer && conf.CephHealthInterval > 0 {
+		go util.StartCephHealthCollector(conf.CephHealthInterval, conf.DriverName)
+	}
+	if conf.IsNodeServer && conf.MountHealthInterval > 0 {
+		go util.StartMountHealthProbe(conf.DriverName, conf.MountHealthInterval)
+	}
+	go csicommon.StopOnSignal(server, conf.ShutdownTimeout)
 	server.Wait()
+	util.CloseConnections()
 }
@@ -0,0 +1,189 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/store"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DryRunCreateVolume walks the decisions of CreateVolume for the request,
+// without reserving, creating or repairing anything, and returns a report of
+// the steps that were checked, and what CreateVolume would do. The lock of
+// the request name is not taken, a parallel CreateVolume of the same request
+// name may change the outcome.
+func (cs *ControllerServer) DryRunCreateVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
+) *util.DryRunReport {
+	report := util.NewDryRunReport(req.GetName())
+
+	err := cs.validateCreateVolumeRequest(req)
+	if err != nil {
+		report.Fail("validate-request", err)
+
+		return report
+	}
+	report.Pass("validate-request", "the name, capabilities and parameters are valid")
+
+	cr, err := util.NewAdminCredentials(req.GetSecrets())
+	if err != nil {
+		report.Fail("credentials", status.Error(codes.InvalidArgument, err.Error()))
+
+		return report
+	}
+	defer cr.DeleteCredentials()
+	report.Pass("credentials", "user %s", cr.ID)
+
+	// NewVolumeOptions connects to the cluster too
+	volOptions, err := store.NewVolumeOptions(ctx, req.GetName(), cs.ClusterName, cs.SetMetadata, req, cr)
+	if err != nil {
+		report.Fail("parse-parameters", status.Error(codes.InvalidArgument, err.Error()))
+
+		return report
+	}
+	defer volOptions.Destroy()
+	if req.GetCapacityRange() != nil {
+		volOptions.Size = util.RoundOffCephFSVolSize(req.GetCapacityRange().GetRequiredBytes())
+	}
+	report.Pass("parse-parameters", "%s", describeDryRunVolume(volOptions))
+
+	parentVol, pvID, sID, err := cs.checkContentSource(ctx, req, cr)
+	if err != nil {
+		report.Fail("content-source", err)
+
+		return report
+	}
+	if parentVol != nil {
+		defer parentVol.Destroy()
+	}
+	err = checkValidCreateVolumeRequest(volOptions, parentVol, pvID, sID, req)
+	if err != nil {
+		if _, ok := status.FromError(err); !ok {
+			err = status.Error(codes.InvalidArgument, err.Error())
+		}
+		report.Fail("content-source", err)
+
+		return report
+	}
+	switch {
+	case sID != nil:
+		report.Pass("content-source", "restore snapshot %s", sID.FsSnapshotName)
+	case pvID != nil:
+		report.Pass("content-source", "clone volume %s", pvID.VolumeID)
+	}
+
+	reservation, err := store.LookupVolReservation(ctx, volOptions, cr)
+	if err != nil {
+		report.Fail("reservation", status.Error(codes.Internal, err.Error()))
+
+		return report
+	}
+	if reservation != nil {
+		report.Pass("reservation", "the request name is reserved with UUID %s in pool %s",
+			reservation.ImageUUID, volOptions.MetadataPool)
+		report.Succeed("CreateVolume would verify the subvolume of the reservation (UUID %s), and return it, "+
+			"or undo the reservation and create a new subvolume when the subvolume is missing",
+			reservation.ImageUUID)
+
+		return report
+	}
+	report.Pass("reservation", "the request name is not reserved in pool %s", volOptions.MetadataPool)
+
+	if volOptions.BackingSnapshot {
+		report.Succeed("CreateVolume would reserve the request name for a snapshot-backed volume of snapshot %s",
+			volOptions.BackingSnapshotID)
+
+		return report
+	}
+
+	groupExists, err := store.CheckLayout(volOptions)
+	switch {
+	case err != nil:
+		report.Fail("layout", status.Error(codes.Internal, err.Error()))
+
+		return report
+	case groupExists:
+		report.Pass("layout", "subvolumegroup %s exists", volOptions.SubvolumeGroup)
+	default:
+		report.Pass("layout", "subvolumegroup %s does not exist, it would be created", volOptions.SubvolumeGroup)
+	}
+
+	err = cs.checkTenantQuota(ctx, volOptions, cr)
+	switch {
+	case errors.Is(err, util.ErrTenantQuotaExceeded):
+		report.Fail("tenant-quota", status.Error(codes.ResourceExhausted, err.Error()))
+
+		return report
+	case err != nil:
+		report.Fail("tenant-quota", status.Error(codes.Internal, err.Error()))
+
+		return report
+	case volOptions.Owner != "":
+		report.Pass("tenant-quota", "the volume fits in the quota of tenant %s", volOptions.Owner)
+	}
+
+	// subvolumes are thin provisioned, their quota is not reserved in the
+	// data pool
+	available, err := volOptions.GetConnection().FilesystemAvailableBytes(volOptions.FsName, volOptions.Pool)
+	switch {
+	case err != nil:
+		report.Warn("capacity", "failed to get the available capacity of filesystem %s: %v", volOptions.FsName, err)
+	case available < volOptions.Size:
+		report.Warn("capacity", "filesystem %s has %d bytes available, less than the size of the volume",
+			volOptions.FsName, available)
+	default:
+		report.Pass("capacity", "filesystem %s has %d bytes available", volOptions.FsName, available)
+	}
+
+	namePrefix := volOptions.NamePrefix
+	if namePrefix == "" {
+		namePrefix = "csi-vol-"
+	}
+	report.Succeed("CreateVolume would reserve the request name, and create subvolume %s<UUID> in filesystem %s",
+		namePrefix, volOptions.FsName)
+
+	return report
+}
+
+// describeDryRunVolume returns the properties of the subvolume that
+// CreateVolume would create for the parameters.
+func describeDryRunVolume(volOptions *store.VolumeOptions) string {
+	props := []string{
+		"cluster " + volOptions.ClusterID,
+		"filesystem " + volOptions.FsName,
+		"subvolumegroup " + volOptions.SubvolumeGroup,
+		fmt.Sprintf("size %d bytes", volOptions.Size),
+	}
+	if volOptions.Pool != "" {
+		props = append(props, "pool "+volOptions.Pool)
+	}
+	if volOptions.BackingSnapshot {
+		props = append(props, "snapshot-backed")
+	}
+
+	return strings.Join(props, ", ")
+}
@@ -100,7 +100,7 @@ func validateFsType(mountpoint, fsType string, mis []mountutil.MountInfo) bool {
 //    path must not be a corrupted mountpoint (see getMountState()). If either
 //    of those checks fail, mount recovery is performed.
 // 2. Recovery preconditions:
-//    * NodeStageMountinfo is present for this volume,
+//    * NodeStageMountinfo is present for this volume, and not of a kernel mount,
 //    * if staging target path and target path are mountpoints, they must be
 //      managed by ceph-fuse,
 //    * VolumeOptions.Mounter must evaluate to "fuse".
@@ -149,6 +149,15 @@ func (ns *NodeServer) tryRestoreFuseMountsInNodePublish(
 		return nil
 	}
 
+	if nsMountinfo.Mounter != "" && !mounter.IsFuse(nsMountinfo.Mounter) {
+		// The volume was staged by the kernel client, there is nothing to
+		// restore.
+		log.WarningLog(ctx, "cephfs: cannot proceed with mount recovery of volume staged with %s mounter",
+			nsMountinfo.Mounter)
+
+		return nil
+	}
+
 	// Check that the existing stage and publish mounts for this volume are
 	// managed by ceph-fuse, and that the mounter is of the FuseMounter type.
 	// Then try to restore them.
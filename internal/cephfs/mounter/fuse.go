@@ -28,6 +28,7 @@ import (
 	"github.com/ceph/ceph-csi/internal/cephfs/store"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 )
 
 const (
@@ -109,6 +110,9 @@ func (m *FuseMounter) Mount(
 	cr *util.Credentials,
 	volOptions *store.VolumeOptions,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.FuseMounter.Mount")
+	defer span.End()
+
 	if err := util.CreateMountPoint(mountPoint); err != nil {
 		return err
 	}
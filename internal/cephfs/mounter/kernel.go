@@ -22,6 +22,7 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/cephfs/store"
 	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 )
 
 const (
@@ -74,6 +75,9 @@ func (m *KernelMounter) Mount(
 	cr *util.Credentials,
 	volOptions *store.VolumeOptions,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "cephfs.KernelMounter.Mount")
+	defer span.End()
+
 	if err := util.CreateMountPoint(mountPoint); err != nil {
 		return err
 	}
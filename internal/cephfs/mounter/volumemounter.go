@@ -137,6 +137,24 @@ func New(volOptions *store.VolumeOptions) (VolumeMounter, error) {
 	return nil, fmt.Errorf("unknown mounter '%s'", chosenMounter)
 }
 
+// TypeOf returns the name of the mounter as used in the mounter option of
+// volumes, "fuse" or "kernel".
+func TypeOf(mnt VolumeMounter) string {
+	switch mnt.(type) {
+	case *FuseMounter:
+		return volumeMounterFuse
+	case *KernelMounter:
+		return volumeMounterKernel
+	}
+
+	return ""
+}
+
+// IsFuse returns whether the mounter name is the one of ceph-fuse.
+func IsFuse(name string) bool {
+	return name == volumeMounterFuse
+}
+
 func BindMount(ctx context.Context, from, to string, readOnly bool, mntOptions []string) error {
 	mntOptionSli := strings.Join(mntOptions, ",")
 	if err := execCommandErr(ctx, "mount", "-o", mntOptionSli, from, to); err != nil {
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"syscall"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// volumeMountGroupMode are the permissions that are added to the root of the
+// volume for the volume mount group. The setgid bit makes new files and
+// directories inherit the group of the root.
+const volumeMountGroupMode = os.ModeSetgid | 0o070
+
+// getVolumeMountGroup returns the GID of the VolumeMountGroup of the
+// capability, false is returned when the capability has no mount group.
+func getVolumeMountGroup(volCap *csi.VolumeCapability) (int, bool, error) {
+	group := volCap.GetMount().GetVolumeMountGroup()
+	if group == "" {
+		return 0, false, nil
+	}
+
+	gid, err := strconv.Atoi(group)
+	if err != nil || gid < 0 {
+		return 0, false, fmt.Errorf("invalid volume mount group %q, it needs to be a GID", group)
+	}
+
+	return gid, true, nil
+}
+
+// isReadOnlyCapability returns whether the access mode of the capability
+// only allows reading.
+func isReadOnlyCapability(volCap *csi.VolumeCapability) bool {
+	mode := volCap.GetAccessMode().GetMode()
+
+	return mode == csi.VolumeCapability_AccessMode_MULTI_NODE_READER_ONLY ||
+		mode == csi.VolumeCapability_AccessMode_SINGLE_NODE_READER_ONLY
+}
+
+// setVolumeMountGroup changes the group of the root of the volume at the path
+// to the GID, and lets the group read, write and add files. Unlike the
+// recursive change of ownership by kubelet, existing files and directories in
+// the volume are not changed, which takes no time for huge volumes.
+func setVolumeMountGroup(path string, gid int) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if ok && int(st.Gid) == gid && fi.Mode()&volumeMountGroupMode == volumeMountGroupMode {
+		return nil
+	}
+
+	err = os.Chown(path, -1, gid)
+	if err != nil {
+		return fmt.Errorf("failed to change the group of %s to %d: %w", path, gid, err)
+	}
+	err = os.Chmod(path, fi.Mode()|volumeMountGroupMode)
+	if err != nil {
+		return fmt.Errorf("failed to change the permissions of %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// applyVolumeMountGroup sets the VolumeMountGroup of the capability on the
+// volume at the path, if the node server advertises the VOLUME_MOUNT_GROUP
+// capability. Read-only volumes are not changed.
+func (ns *NodeServer) applyVolumeMountGroup(
+	ctx context.Context,
+	path string,
+	volCap *csi.VolumeCapability,
+	readOnly bool,
+) error {
+	if !ns.volumeMountGroup {
+		return nil
+	}
+
+	gid, ok, err := getVolumeMountGroup(volCap)
+	if err != nil || !ok {
+		return err
+	}
+	if readOnly || isReadOnlyCapability(volCap) {
+		log.DebugLog(ctx, "cephfs: not applying volume mount group %d to read-only volume at %s", gid, path)
+
+		return nil
+	}
+
+	log.DebugLog(ctx, "cephfs: applying volume mount group %d to %s", gid, path)
+
+	return setVolumeMountGroup(path, gid)
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestGetVolumeMountGroup(t *testing.T) {
+	t.Parallel()
+
+	mount := func(group string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{VolumeMountGroup: group},
+			},
+		}
+	}
+	tests := []struct {
+		name    string
+		volCap  *csi.VolumeCapability
+		gid     int
+		ok      bool
+		wantErr bool
+	}{
+		{
+			name:   "no capability",
+			volCap: nil,
+		},
+		{
+			name:   "no mount group",
+			volCap: mount(""),
+		},
+		{
+			name:   "mount group",
+			volCap: mount("2000"),
+			gid:    2000,
+			ok:     true,
+		},
+		{
+			name:    "group name",
+			volCap:  mount("users"),
+			wantErr: true,
+		},
+		{
+			name:    "negative group",
+			volCap:  mount("-1"),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			gid, ok, err := getVolumeMountGroup(ts.volCap)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("getVolumeMountGroup() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if gid != ts.gid || ok != ts.ok {
+				t.Errorf("getVolumeMountGroup() = %d, %t, want %d, %t", gid, ok, ts.gid, ts.ok)
+			}
+		})
+	}
+}
+
+func TestSetVolumeMountGroup(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	err := os.Chmod(dir, 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gid := os.Getgid()
+
+	// the second call finds the group and permissions already applied
+	for i := 0; i < 2; i++ {
+		err = setVolumeMountGroup(dir, gid)
+		if err != nil {
+			t.Fatalf("setVolumeMountGroup() error = %v", err)
+		}
+		fi, sErr := os.Stat(dir)
+		if sErr != nil {
+			t.Fatal(sErr)
+		}
+		if mode := fi.Mode(); mode&volumeMountGroupMode != volumeMountGroupMode || mode.Perm() != 0o775 {
+			t.Errorf("setVolumeMountGroup() mode = %v, want setgid and 0775", mode)
+		}
+		if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Gid) != gid {
+			t.Errorf("setVolumeMountGroup() gid = %d, want %d", st.Gid, gid)
+		}
+	}
+}
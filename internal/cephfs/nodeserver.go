@@ -23,6 +23,7 @@ import (
 	"os"
 	"path"
 	"strings"
+	"time"
 
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	"github.com/ceph/ceph-csi/internal/cephfs/mounter"
@@ -46,6 +47,24 @@ type NodeServer struct {
 	VolumeLocks        *util.VolumeLocks
 	kernelMountOptions string
 	fuseMountOptions   string
+	// volumeMountGroup is set when the node server applies the
+	// VolumeMountGroup of the capability to the volumes
+	volumeMountGroup bool
+	// mountOptionsPolicy adds default mount options to the volumes, and
+	// rejects denied options, nil when there is no policy
+	mountOptionsPolicy *util.MountOptionsPolicy
+}
+
+// applyMountOptionsPolicy checks the comma separated mount options of a volume
+// against the mount options policy, and adds the default options of the
+// fsType.
+func (ns *NodeServer) applyMountOptionsPolicy(fsType, options string) (string, error) {
+	opts, err := ns.mountOptionsPolicy.Apply(fsType, strings.Split(options, ","))
+	if err != nil {
+		return "", err
+	}
+
+	return util.MountOptionsAdd("", opts...), nil
 }
 
 func getCredentialsForVolume(
@@ -139,6 +158,15 @@ func (ns *NodeServer) NodeStageVolume(
 	}
 	defer ns.VolumeLocks.Release(req.GetVolumeId())
 
+	// the data pool of a topology constrained volume is only accessible from
+	// the topology segment that CreateVolume picked it for
+	err := util.CheckTopologySegment(req.GetVolumeContext(), ns.Driver.GetTopology())
+	if err != nil {
+		log.ErrorLog(ctx, "cephfs: can not stage volume %s on this node: %v", volID, err)
+
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+
 	volOptions, err := ns.getVolumeOptions(ctx, volID, req.GetVolumeContext(), req.GetSecrets())
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -186,6 +214,11 @@ func (ns *NodeServer) NodeStageVolume(
 	if isMnt {
 		log.DebugLog(ctx, "cephfs: volume %s is already mounted to %s, skipping", volID, stagingTargetPath)
 
+		err = ns.applyVolumeMountGroup(ctx, stagingTargetPath, req.GetVolumeCapability(), volOptions.BackingSnapshot)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
@@ -205,23 +238,39 @@ func (ns *NodeServer) NodeStageVolume(
 
 	log.DebugLog(ctx, "cephfs: successfully mounted volume %s to %s", volID, stagingTargetPath)
 
+	err = ns.applyVolumeMountGroup(ctx, stagingTargetPath, req.GetVolumeCapability(), volOptions.BackingSnapshot)
+	if err != nil {
+		log.ErrorLog(ctx, "cephfs: failed to apply volume mount group to volume %s: %v", volID, err)
+
+		// Try to clean node stage mount.
+		if unmountErr := mounter.UnmountAll(ctx, stagingTargetPath); unmountErr != nil {
+			log.ErrorLog(ctx, "cephfs: failed to unmount %s in volume mount group clean up: %v",
+				stagingTargetPath, unmountErr)
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// The NodeStageMountinfo record keeps the mounter of the volume across
+	// restarts of the nodeplugin. FUSE mount recovery needs the secrets too,
+	// they are not stored for kernel mounts.
+	nsMountinfo := &fsutil.NodeStageMountinfo{
+		VolumeCapability: req.GetVolumeCapability(),
+		Mounter:          mounter.TypeOf(mnt),
+	}
 	if _, isFuse := mnt.(*mounter.FuseMounter); isFuse {
-		// FUSE mount recovery needs NodeStageMountinfo records.
-
-		if err = fsutil.WriteNodeStageMountinfo(volID, &fsutil.NodeStageMountinfo{
-			VolumeCapability: req.GetVolumeCapability(),
-			Secrets:          req.GetSecrets(),
-		}); err != nil {
-			log.ErrorLog(ctx, "cephfs: failed to write NodeStageMountinfo for volume %s: %v", volID, err)
-
-			// Try to clean node stage mount.
-			if unmountErr := mounter.UnmountAll(ctx, stagingTargetPath); unmountErr != nil {
-				log.ErrorLog(ctx, "cephfs: failed to unmount %s in WriteNodeStageMountinfo clean up: %v",
-					stagingTargetPath, unmountErr)
-			}
+		nsMountinfo.Secrets = req.GetSecrets()
+	}
+	if err = fsutil.WriteNodeStageMountinfo(volID, nsMountinfo); err != nil {
+		log.ErrorLog(ctx, "cephfs: failed to write NodeStageMountinfo for volume %s: %v", volID, err)
 
-			return nil, status.Error(codes.Internal, err.Error())
+		// Try to clean node stage mount.
+		if unmountErr := mounter.UnmountAll(ctx, stagingTargetPath); unmountErr != nil {
+			log.ErrorLog(ctx, "cephfs: failed to unmount %s in WriteNodeStageMountinfo clean up: %v",
+				stagingTargetPath, unmountErr)
 		}
+
+		return nil, status.Error(codes.Internal, err.Error())
 	}
 
 	return &csi.NodeStageVolumeResponse{}, nil
@@ -236,6 +285,8 @@ func (ns *NodeServer) mount(
 	secrets map[string]string,
 	volCap *csi.VolumeCapability,
 ) error {
+	defer util.ObserveOperation(ctx, "cephfs", volOptions.ClusterID, util.OpMount, time.Now())
+
 	cr, err := getCredentialsForVolume(volOptions, secrets)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get ceph credentials for volume %s: %v", volID, err)
@@ -248,8 +299,16 @@ func (ns *NodeServer) mount(
 
 	switch mnt.(type) {
 	case *mounter.FuseMounter:
+		volOptions.FuseMountOptions, err = ns.applyMountOptionsPolicy("ceph-fuse", volOptions.FuseMountOptions)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
 		volOptions.FuseMountOptions = util.MountOptionsAdd(volOptions.FuseMountOptions, ns.fuseMountOptions)
 	case *mounter.KernelMounter:
+		volOptions.KernelMountOptions, err = ns.applyMountOptionsPolicy("ceph", volOptions.KernelMountOptions)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
 		volOptions.KernelMountOptions = util.MountOptionsAdd(volOptions.KernelMountOptions, ns.kernelMountOptions)
 	}
 
@@ -394,6 +453,9 @@ func (ns *NodeServer) NodePublishVolume(
 	if err := util.ValidateNodePublishVolumeRequest(req); err != nil {
 		return nil, err
 	}
+	if err := ns.mountOptionsPolicy.CheckVolumeCapability(req.GetVolumeCapability()); err != nil {
+		return nil, err
+	}
 
 	stagingTargetPath := req.GetStagingTargetPath()
 	targetPath := req.GetTargetPath()
@@ -451,6 +513,14 @@ func (ns *NodeServer) NodePublishVolume(
 		return &csi.NodePublishVolumeResponse{}, nil
 	}
 
+	// pods with a different fsGroup can publish the same staged volume
+	err = ns.applyVolumeMountGroup(ctx, stagingTargetPath, req.GetVolumeCapability(), req.GetReadonly())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to apply volume mount group to volume %s: %v", volID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
 	// It's not, mount now
 
 	if err = mounter.BindMount(
@@ -482,6 +552,7 @@ func (ns *NodeServer) NodeUnpublishVolume(
 	// considering kubelet make sure node operations like unpublish/unstage...etc can not be called
 	// at same time, an explicit locking at time of nodeunpublish is not required.
 	targetPath := req.GetTargetPath()
+	ns.StatsCache.Forget(targetPath)
 	isMnt, err := util.IsMountPoint(ns.Mounter, targetPath)
 	if err != nil {
 		log.ErrorLog(ctx, "stat failed: %v", err)
@@ -591,7 +662,7 @@ func (ns *NodeServer) NodeGetCapabilities(
 	ctx context.Context,
 	req *csi.NodeGetCapabilitiesRequest,
 ) (*csi.NodeGetCapabilitiesResponse, error) {
-	return &csi.NodeGetCapabilitiesResponse{
+	resp := &csi.NodeGetCapabilitiesResponse{
 		Capabilities: []*csi.NodeServiceCapability{
 			{
 				Type: &csi.NodeServiceCapability_Rpc{
@@ -614,8 +685,26 @@ func (ns *NodeServer) NodeGetCapabilities(
 					},
 				},
 			},
+			{
+				Type: &csi.NodeServiceCapability_Rpc{
+					Rpc: &csi.NodeServiceCapability_RPC{
+						Type: csi.NodeServiceCapability_RPC_VOLUME_CONDITION,
+					},
+				},
+			},
 		},
-	}, nil
+	}
+	if ns.volumeMountGroup {
+		resp.Capabilities = append(resp.Capabilities, &csi.NodeServiceCapability{
+			Type: &csi.NodeServiceCapability_Rpc{
+				Rpc: &csi.NodeServiceCapability_RPC{
+					Type: csi.NodeServiceCapability_RPC_VOLUME_MOUNT_GROUP,
+				},
+			},
+		})
+	}
+
+	return resp, nil
 }
 
 // NodeGetVolumeStats returns volume stats.
@@ -631,13 +720,36 @@ func (ns *NodeServer) NodeGetVolumeStats(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	return ns.StatsCache.Get(ctx, targetPath, ns.getVolumeStats)
+}
+
+// getVolumeStats returns the stats of the filesystem that is published on the
+// targetPath.
+func (ns *NodeServer) getVolumeStats(
+	ctx context.Context,
+	targetPath string,
+) (*csi.NodeGetVolumeStatsResponse, error) {
+	// the stat() of a stale mount blocks, only healthy mounts have stats
+	condition := util.MountCondition(targetPath)
+	if condition.GetAbnormal() {
+		log.WarningLog(ctx, "cephfs: %s", condition.GetMessage())
+
+		return &csi.NodeGetVolumeStatsResponse{VolumeCondition: condition}, nil
+	}
+
 	stat, err := os.Stat(targetPath)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "failed to get stat for targetpath %q: %v", targetPath, err)
 	}
 
 	if stat.Mode().IsDir() {
-		return csicommon.FilesystemNodeGetVolumeStats(ctx, ns.Mounter, targetPath)
+		resp, err := csicommon.FilesystemNodeGetVolumeStats(ctx, ns.Mounter, targetPath)
+		if err != nil {
+			return nil, err
+		}
+		resp.VolumeCondition = condition
+
+		return resp, nil
 	}
 
 	return nil, status.Errorf(codes.InvalidArgument, "targetpath %q is not a directory or device", targetPath)
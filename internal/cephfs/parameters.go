@@ -0,0 +1,44 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cephfs
+
+import (
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// volumeParameters are the parameters of a StorageClass that CreateVolume
+// accepts with strict parameter validation.
+var volumeParameters = []string{
+	"clusterID",
+	"fsName",
+	"pool",
+	"mounter",
+	"volumeNamePrefix",
+	"snapshotNamePrefix",
+	"backingSnapshot",
+	"kernelMountOptions",
+	"fuseMountOptions",
+	"topologyConstrainedPools",
+}
+
+// snapshotParameters are the parameters of a VolumeSnapshotClass that
+// CreateSnapshot accepts with strict parameter validation.
+var snapshotParameters = []string{
+	"clusterID",
+	"snapshotNamePrefix",
+	util.MaxSnapshotsPerVolumeKey,
+}
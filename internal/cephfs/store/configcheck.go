@@ -0,0 +1,106 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// clusterSource is the source of the findings of the checks against a
+// cluster.
+const clusterSource = "cluster"
+
+// ValidateClusterFilesystems connects to the cluster with the credentials,
+// and checks that the filesystems exist (all filesystems of the cluster when
+// none are passed), and whether the subvolumegroup of the cluster exists in
+// each of them.
+func ValidateClusterFilesystems(
+	cluster *util.ClusterInfo,
+	filesystems []string,
+	cr *util.Credentials,
+) util.ConfigFindings {
+	var findings util.ConfigFindings
+	conn := &util.ClusterConnection{}
+	err := conn.Connect(strings.Join(cluster.Monitors, ","), cr)
+	if err != nil {
+		findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "failed to connect: %v", err)
+
+		return findings
+	}
+	defer conn.Destroy()
+
+	fsa, err := conn.GetFSAdmin()
+	if err != nil {
+		findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "%v", err)
+
+		return findings
+	}
+	fsInfos, err := fsa.ListFileSystems()
+	if err != nil {
+		findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "failed to list filesystems: %v", err)
+
+		return findings
+	}
+	if len(fsInfos) == 0 {
+		findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "the cluster has no filesystems")
+
+		return findings
+	}
+	existing := map[string]bool{}
+	for i := range fsInfos {
+		existing[fsInfos[i].Name] = true
+		if len(filesystems) == 0 {
+			filesystems = append(filesystems, fsInfos[i].Name)
+		}
+	}
+
+	group := cluster.SubvolumeGroup()
+	for _, fsName := range filesystems {
+		if !existing[fsName] {
+			findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "filesystem %q does not exist", fsName)
+
+			continue
+		}
+		groups, err := fsa.ListSubVolumeGroups(fsName)
+		if err != nil {
+			findings.Add(util.FindingError, clusterSource, cluster.ClusterID,
+				"failed to list the subvolumegroups of filesystem %q: %v", fsName, err)
+
+			continue
+		}
+		if !contains(groups, group) {
+			findings.Add(util.FindingWarning, clusterSource, cluster.ClusterID,
+				"subvolumegroup %q does not exist in filesystem %q, it is created with the first volume",
+				group, fsName)
+		}
+	}
+
+	return findings
+}
+
+// contains returns whether the value is in the list.
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
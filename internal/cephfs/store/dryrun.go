@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// LookupVolReservation returns the reservation of the request name of the
+// volume in the journal, or nil if the request name is not reserved. Unlike
+// CheckVolExists, stale reservations are not cleaned up.
+func LookupVolReservation(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	cr *util.Credentials,
+) (*journal.Reservation, error) {
+	j, err := VolJournal.Connect(volOptions.Monitors, fsutil.RadosNamespace, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer j.Destroy()
+
+	return j.LookupReservation(ctx, volOptions.MetadataPool, volOptions.RequestName)
+}
+
+// CheckLayout checks that the pool of the volume, if any, is a data pool of
+// its filesystem, and returns whether the subvolumegroup of the volume exists
+// already. CreateVolume creates a missing subvolumegroup.
+func CheckLayout(volOptions *VolumeOptions) (bool, error) {
+	fsa, err := volOptions.GetConnection().GetFSAdmin()
+	if err != nil {
+		return false, err
+	}
+
+	if volOptions.Pool != "" {
+		fsInfos, err := fsa.ListFileSystems()
+		if err != nil {
+			return false, fmt.Errorf("failed to list filesystems: %w", err)
+		}
+		found := false
+		for i := range fsInfos {
+			if fsInfos[i].Name == volOptions.FsName {
+				found = contains(fsInfos[i].DataPools, volOptions.Pool)
+
+				break
+			}
+		}
+		if !found {
+			return false, fmt.Errorf("pool %q is not a data pool of filesystem %q", volOptions.Pool, volOptions.FsName)
+		}
+	}
+
+	groups, err := fsa.ListSubVolumeGroups(volOptions.FsName)
+	if err != nil {
+		return false, fmt.Errorf("failed to list the subvolumegroups of filesystem %q: %w", volOptions.FsName, err)
+	}
+
+	return contains(groups, volOptions.SubvolumeGroup), nil
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/cephfs/core"
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
@@ -251,6 +252,8 @@ func updateTopologyConstraints(volOpts *VolumeOptions) error {
 // ReserveVol is a helper routine to request a UUID reservation for the CSI VolumeName and,
 // to generate the volume identifier for the reserved UUID.
 func ReserveVol(ctx context.Context, volOptions *VolumeOptions, secret map[string]string) (*VolumeIdentifier, error) {
+	defer util.ObserveOperation(ctx, "cephfs", volOptions.ClusterID, util.OpJournalReserve, time.Now())
+
 	var (
 		vid       VolumeIdentifier
 		imageUUID string
@@ -278,7 +281,7 @@ func ReserveVol(ctx context.Context, volOptions *VolumeOptions, secret map[strin
 	imageUUID, vid.FsSubvolName, err = j.ReserveName(
 		ctx, volOptions.MetadataPool, util.InvalidPoolID,
 		volOptions.MetadataPool, util.InvalidPoolID, volOptions.RequestName,
-		volOptions.NamePrefix, "", "", volOptions.ReservedID, "", volOptions.BackingSnapshotID)
+		volOptions.NamePrefix, "", "", volOptions.ReservedID, volOptions.Owner, volOptions.BackingSnapshotID)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/util"
+)
+
+// InspectHandle looks up the subvolume of a volume handle, or the snapshot
+// of a snapshot handle, in the journal of its filesystem and describes it.
+// VolJournal and SnapJournal need to be initialized.
+func InspectHandle(
+	ctx context.Context,
+	handle string,
+	snapshot bool,
+	cr *util.Credentials,
+) (*util.HandleInfo, error) {
+	info, err := util.NewHandleInfo(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	vo := &VolumeOptions{ClusterID: info.ClusterID, FscID: info.LocationID}
+	vo.Monitors, err = util.Mons(util.CsiConfigFile, vo.ClusterID)
+	if err != nil {
+		return info, fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", vo.ClusterID, err)
+	}
+	info.SubvolumeGroup, err = util.CephFSSubvolumeGroup(util.CsiConfigFile, vo.ClusterID)
+	if err != nil {
+		return info, fmt.Errorf("failed to fetch subvolumegroup using clusterID (%s): %w", vo.ClusterID, err)
+	}
+
+	err = vo.Connect(cr)
+	if err != nil {
+		return info, err
+	}
+	defer vo.Destroy()
+
+	fs := core.NewFileSystem(vo.conn)
+	info.FsName, err = fs.GetFsName(ctx, vo.FscID)
+	if err != nil {
+		return info, err
+	}
+	// the journal is stored in the metadata pool of the filesystem
+	info.Pool, err = fs.GetMetadataPool(ctx, info.FsName)
+	if err != nil {
+		return info, err
+	}
+	info.RadosNamespace = fsutil.RadosNamespace
+
+	jc := VolJournal
+	if snapshot {
+		jc = SnapJournal
+	}
+	j, err := jc.Connect(vo.Monitors, fsutil.RadosNamespace, cr)
+	if err != nil {
+		return info, err
+	}
+	defer j.Destroy()
+
+	attrs, err := j.GetImageAttributes(ctx, info.Pool, info.UUID, snapshot)
+	if err != nil {
+		return info, fmt.Errorf("failed to find %s in the journal: %w", handle, err)
+	}
+	info.Name = attrs.ImageName
+	info.Source = attrs.SourceName
+	if attrs.BackingSnapshotID != "" {
+		info.Source = attrs.BackingSnapshotID
+	}
+	info.RequestName = attrs.RequestName
+	info.Owner = attrs.Owner
+
+	return info, nil
+}
@@ -0,0 +1,263 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	fsAdmin "github.com/ceph/go-ceph/cephfs/admin"
+	"github.com/ceph/go-ceph/rados"
+)
+
+// fsJournalChecker compares the journals in the metadata pool of a
+// filesystem with its subvolumes and their snapshots.
+type fsJournalChecker struct {
+	fsa     *fsAdmin.FSAdmin
+	fs      fsAdmin.FSPoolInfo
+	opts    journal.CheckOptions
+	journal *journal.Connection
+	// now is the time the check started, to compare the ages with
+	now time.Time
+	// subvolumes are the subvolume groups of the subvolumes, by name
+	subvolumes map[string]string
+	// reserved are the names of the subvolumes of the reservations
+	reserved map[string]bool
+	problems []journal.Problem
+}
+
+// CheckJournal checks the volume and snapshot journals in the metadata pools
+// of all filesystems of the cluster against their subvolumes and snapshots.
+// Reservations without a subvolume or snapshot are orphaned entries,
+// subvolumes that are named like the subvolumes of reservations but that are
+// not reserved are dangling. When the options repair the problems, orphaned
+// entries are removed from the journal. Dangling subvolumes are only reported, they can not be
+// moved to a trash like RBD images. Reservations and subvolumes that are
+// younger than the minimum age of the options are skipped, they may still be
+// created or deleted. VolJournal and SnapJournal need to be initialized.
+func CheckJournal(
+	ctx context.Context,
+	clusterID string,
+	cr *util.Credentials,
+	opts journal.CheckOptions,
+) ([]journal.Problem, error) {
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	conn := &util.ClusterConnection{}
+	err = conn.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	fsa, err := conn.GetFSAdmin()
+	if err != nil {
+		return nil, err
+	}
+	filesystems, err := fsa.ListFileSystems()
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []journal.Problem{}
+	now := time.Now()
+	for _, fs := range filesystems {
+		c := &fsJournalChecker{
+			fsa:        fsa,
+			fs:         fs,
+			opts:       opts,
+			now:        now,
+			subvolumes: map[string]string{},
+			reserved:   map[string]bool{},
+		}
+		err = c.check(ctx, monitors, cr)
+		problems = append(problems, c.problems...)
+		if err != nil {
+			return problems, err
+		}
+	}
+
+	return problems, nil
+}
+
+// check lists the subvolumes of the filesystem, and checks the reservations
+// of the volume and snapshot journals.
+func (c *fsJournalChecker) check(ctx context.Context, monitors string, cr *util.Credentials) error {
+	groups, err := c.fsa.ListSubVolumeGroups(c.fs.Name)
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
+		names, err := c.fsa.ListSubVolumes(c.fs.Name, group)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			c.subvolumes[name] = group
+		}
+	}
+
+	for _, jc := range []*journal.Config{VolJournal, SnapJournal} {
+		c.journal, err = jc.Connect(monitors, fsutil.RadosNamespace, cr)
+		if err != nil {
+			return err
+		}
+		err = c.checkReservations(ctx, jc == SnapJournal)
+		c.journal.Destroy()
+		if err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(c.subvolumes))
+	for name := range c.subvolumes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if c.reserved[name] || !journal.IsReservedName(name, journal.ReservedNamePrefixes) {
+			continue
+		}
+		info, err := c.fsa.SubVolumeInfo(c.fs.Name, c.subvolumes[name], name)
+		if errors.Is(err, rados.ErrNotFound) {
+			// deleted since it was listed
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if c.opts.Young(info.CreatedAt.Time, c.now) {
+			continue
+		}
+		c.problems = append(c.problems, journal.Problem{
+			Kind: journal.DanglingImage,
+			Pool: c.fs.MetadataPool,
+			Name: name,
+		})
+	}
+
+	return nil
+}
+
+// checkReservations adds an orphaned entry for each reservation of the
+// journal without attributes, or without its subvolume or snapshot.
+func (c *fsJournalChecker) checkReservations(ctx context.Context, snapshot bool) error {
+	pool := c.fs.MetadataPool
+	reservations, _, err := c.journal.ListReservations(ctx, pool, "", 0)
+	if err != nil {
+		return err
+	}
+
+	for _, rsv := range reservations {
+		problem := journal.Problem{
+			Pool:        pool,
+			JournalPool: pool,
+			RequestName: rsv.RequestName,
+			UUID:        rsv.ImageUUID,
+			Snapshot:    snapshot,
+		}
+		attrs, err := c.journal.GetImageAttributes(ctx, pool, rsv.ImageUUID, snapshot)
+		switch {
+		case errors.Is(err, util.ErrKeyNotFound):
+		case err != nil:
+			return err
+		default:
+			problem.Name = attrs.ImageName
+			exists, eErr := c.reservedExists(attrs, snapshot)
+			if eErr != nil {
+				return eErr
+			}
+			if exists {
+				continue
+			}
+		}
+
+		err = c.orphaned(ctx, problem)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reservedExists returns whether the subvolume or snapshot of the
+// reservation exists. Snapshot-backed volumes do not have a subvolume.
+func (c *fsJournalChecker) reservedExists(attrs *journal.ImageAttributes, snapshot bool) (bool, error) {
+	if !snapshot {
+		if attrs.BackingSnapshotID != "" {
+			return true, nil
+		}
+		_, ok := c.subvolumes[attrs.ImageName]
+		c.reserved[attrs.ImageName] = true
+
+		return ok, nil
+	}
+
+	group, ok := c.subvolumes[attrs.SourceName]
+	if !ok {
+		return false, nil
+	}
+	snapshots, err := c.fsa.ListSubVolumeSnapshots(c.fs.Name, group, attrs.SourceName)
+	if err != nil {
+		return false, err
+	}
+	for _, name := range snapshots {
+		if name == attrs.ImageName {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// orphaned adds the orphaned entry, and removes it from the journal when
+// the problems are repaired. Reservations that were modified within the
+// minimum age are skipped, their subvolume may not be created yet.
+func (c *fsJournalChecker) orphaned(ctx context.Context, problem journal.Problem) error {
+	modTime, err := c.journal.ReservationModTime(problem.JournalPool, problem.Pool, problem.UUID)
+	if err != nil {
+		return err
+	}
+	if c.opts.Young(modTime, c.now) {
+		log.DebugLog(ctx, "skipping reservation %q modified at %v", problem.RequestName, modTime)
+
+		return nil
+	}
+	problem.Kind = journal.OrphanedEntry
+	if c.opts.Repair {
+		// the UUID is enough to remove the omap of the reservation
+		err := c.journal.UndoReservation(ctx, problem.JournalPool, problem.Pool, problem.UUID, problem.RequestName)
+		if err != nil {
+			return err
+		}
+		log.DefaultLog("removed reservation %q from the journal of filesystem %s", problem.RequestName, c.fs.Name)
+		problem.Repaired = true
+	}
+	c.problems = append(c.problems, problem)
+
+	return nil
+}
@@ -0,0 +1,153 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package store
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ceph/ceph-csi/internal/cephfs/core"
+	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
+	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// GetTenantUsage returns the bytes that the owner of volOptions uses in its
+// filesystem. The usage is counted in the volume journal, and scanned if the
+// usage of the owner is not counted yet.
+func GetTenantUsage(ctx context.Context, volOptions *VolumeOptions, cr *util.Credentials) (int64, error) {
+	j, err := VolJournal.Connect(volOptions.Monitors, fsutil.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	used, counted, err := j.GetTenantUsage(ctx, volOptions.MetadataPool, volOptions.Owner)
+	if err != nil || counted {
+		return used, err
+	}
+
+	return scanTenantUsage(ctx, j, volOptions)
+}
+
+// ReserveTenantQuota adds size bytes to the usage of the owner of volOptions
+// in its filesystem, and returns util.ErrTenantQuotaExceeded when they do not
+// fit in the quota. The usage of an owner is counted from the first
+// reservation while the owner has a quota, until then nothing is stored.
+func ReserveTenantQuota(
+	ctx context.Context,
+	volOptions *VolumeOptions,
+	cr *util.Credentials,
+	size, quota int64,
+) error {
+	j, err := VolJournal.Connect(volOptions.Monitors, fsutil.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	owner := volOptions.Owner
+
+	return j.UpdateTenantUsage(ctx, volOptions.MetadataPool, owner, func(used int64, counted bool) (int64, bool, error) {
+		if !counted {
+			if quota == 0 {
+				return 0, false, nil
+			}
+			var err error
+			used, err = scanTenantUsage(ctx, j, volOptions)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+		if quota != 0 {
+			log.DebugLog(ctx, "tenant %s uses %d of %d bytes in filesystem %s", owner, used, quota,
+				volOptions.FsName)
+			err := util.CheckTenantQuota(owner, volOptions.FsName, used, size, quota)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		return used + size, true, nil
+	})
+}
+
+// ReleaseTenantQuota subtracts size bytes from the usage of the owner of
+// volOptions in its filesystem, after its subvolume was purged or failed to
+// be created or resized. Failures are logged, as the subvolume is gone
+// already.
+func ReleaseTenantQuota(ctx context.Context, volOptions *VolumeOptions, cr *util.Credentials, size int64) {
+	if volOptions.Owner == "" {
+		return
+	}
+
+	j, err := VolJournal.Connect(volOptions.Monitors, fsutil.RadosNamespace, cr)
+	if err == nil {
+		defer j.Destroy()
+		err = j.AddTenantUsage(ctx, volOptions.MetadataPool, volOptions.Owner, -size)
+	}
+	if err != nil {
+		log.WarningLog(ctx, "failed to release %d bytes of tenant %s in filesystem %s: %v",
+			size, volOptions.Owner, volOptions.FsName, err)
+	}
+}
+
+// scanTenantUsage returns the total size of the subvolumes of the owner of
+// volOptions in its filesystem. The owner of a subvolume is stored in the
+// volume journal, snapshot-backed volumes do not use any space and are not
+// counted. The subvolumes are scanned once per tenant and filesystem, to
+// initialize the usage that is counted in the journal after that.
+func scanTenantUsage(ctx context.Context, j *journal.Connection, volOptions *VolumeOptions) (int64, error) {
+	reservations, _, err := j.ListReservations(ctx, volOptions.MetadataPool, "", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	for _, rsv := range reservations {
+		attrs, err := j.GetImageAttributes(ctx, volOptions.MetadataPool, rsv.ImageUUID, false)
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			// the reservation is being created or deleted
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if attrs.Owner != volOptions.Owner || attrs.BackingSnapshotID != "" {
+			continue
+		}
+
+		volClient := core.NewSubVolume(volOptions.GetConnection(), &core.SubVolume{
+			VolID:          attrs.ImageName,
+			FsName:         volOptions.FsName,
+			SubvolumeGroup: volOptions.SubvolumeGroup,
+		}, volOptions.ClusterID, "", false)
+		info, err := volClient.GetSubVolumeInfo(ctx)
+		if errors.Is(err, cerrors.ErrVolumeNotFound) {
+			// the subvolume is in another subvolumegroup, or not created yet
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		used += info.BytesQuota
+	}
+
+	return used, nil
+}
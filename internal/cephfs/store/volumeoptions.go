@@ -30,6 +30,7 @@ import (
 	cerrors "github.com/ceph/ceph-csi/internal/cephfs/errors"
 	fsutil "github.com/ceph/ceph-csi/internal/cephfs/util"
 	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
 	"github.com/ceph/ceph-csi/internal/util/log"
 )
 
@@ -41,7 +42,9 @@ type VolumeOptions struct {
 	ClusterID    string
 	MetadataPool string
 	// ReservedID represents the ID reserved for a subvolume
-	ReservedID           string
+	ReservedID string
+	// Owner is the creator (tenant, Kubernetes Namespace) of the volume
+	Owner                string
 	Monitors             string `json:"monitors"`
 	RootPath             string `json:"rootPath"`
 	Mounter              string `json:"mounter"`
@@ -153,13 +156,11 @@ func extractMounter(dest *string, options map[string]string) error {
 func GetClusterInformation(options map[string]string) (*util.ClusterInfo, error) {
 	clusterID, ok := options["clusterID"]
 	if !ok {
-		err := fmt.Errorf("clusterID must be set")
-
-		return nil, err
+		return nil, util.ErrClusterIDNotSet
 	}
 
 	if err := validateNonEmptyField(clusterID, "clusterID"); err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %v", util.ErrClusterIDNotSet, err)
 	}
 
 	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
@@ -219,6 +220,7 @@ func NewVolumeOptions(
 	opts.ClusterID = clusterData.ClusterID
 	opts.Monitors = strings.Join(clusterData.Monitors, ",")
 	opts.SubvolumeGroup = clusterData.CephFS.SubvolumeGroup
+	opts.Owner = k8s.GetOwner(volOptions)
 
 	if err = extractOptionalOption(&opts.Pool, "pool", volOptions); err != nil {
 		return nil, err
@@ -244,6 +246,10 @@ func NewVolumeOptions(
 		return nil, err
 	}
 
+	if err = util.ValidateNamePrefix("volumeNamePrefix", opts.NamePrefix); err != nil {
+		return nil, err
+	}
+
 	if err = extractOptionalOption(&backingSnapshotBool, "backingSnapshot", volOptions); err != nil {
 		return nil, err
 	}
@@ -381,6 +387,7 @@ func NewVolumeOptionsFromVolID(
 		return nil, nil, err
 	}
 	volOptions.RequestName = imageAttributes.RequestName
+	volOptions.Owner = imageAttributes.Owner
 	vid.FsSubvolName = imageAttributes.ImageName
 
 	if volOpt != nil {
@@ -783,6 +790,9 @@ func GenSnapFromOptions(ctx context.Context, req *csi.CreateSnapshotRequest) (*S
 		return nil, err
 	}
 	if namePrefix, ok := snapOptions["snapshotNamePrefix"]; ok {
+		if err = util.ValidateNamePrefix("snapshotNamePrefix", namePrefix); err != nil {
+			return nil, err
+		}
 		cephfsSnap.NamePrefix = namePrefix
 	}
 
@@ -29,7 +29,8 @@ import (
 )
 
 // This file provides functionality to store various mount information
-// in a file. It's currently used to restore ceph-fuse mounts.
+// in a file. It's used to restore ceph-fuse mounts, and to find the mounter
+// of a staged volume after a restart of the nodeplugin.
 // Mount info is stored in `/csi/mountinfo`.
 
 const (
@@ -44,6 +45,7 @@ type nodeStageMountinfoRecord struct {
 	VolumeCapabilityProtoJSON string            `json:",omitempty"`
 	MountOptions              []string          `json:",omitempty"`
 	Secrets                   map[string]string `json:",omitempty"`
+	Mounter                   string            `json:",omitempty"`
 }
 
 // NodeStageMountinfo describes mountinfo of a volume.
@@ -51,6 +53,9 @@ type NodeStageMountinfo struct {
 	VolumeCapability *csi.VolumeCapability
 	Secrets          map[string]string
 	MountOptions     []string
+	// Mounter is the mounter that staged the volume, "fuse" or "kernel".
+	// It is empty for records that were written by older versions.
+	Mounter string
 }
 
 func fmtNodeStageMountinfoFilename(volID VolumeID) string {
@@ -67,6 +72,7 @@ func (mi *NodeStageMountinfo) toNodeStageMountinfoRecord() (*nodeStageMountinfoR
 		VolumeCapabilityProtoJSON: string(bs),
 		MountOptions:              mi.MountOptions,
 		Secrets:                   mi.Secrets,
+		Mounter:                   mi.Mounter,
 	}, nil
 }
 
@@ -80,6 +86,7 @@ func (r *nodeStageMountinfoRecord) toNodeStageMountinfo() (*NodeStageMountinfo,
 		VolumeCapability: volCapability,
 		MountOptions:     r.MountOptions,
 		Secrets:          r.Secrets,
+		Mounter:          r.Mounter,
 	}, nil
 }
 
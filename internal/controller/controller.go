@@ -17,6 +17,7 @@ package controller
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 
@@ -39,6 +40,23 @@ type Config struct {
 	Namespace   string
 	ClusterName string
 	SetMetadata bool
+	// EnforceSnapshotExpiry deletes VolumeSnapshots once the expiry that is
+	// stored in the metadata of their snapshot has passed
+	EnforceSnapshotExpiry bool
+	// InstanceID is the instance ID of the journals
+	InstanceID string
+	// StaleVolumeInterval is the time between listings of the volumes in
+	// the journals, to find volumes without PV, disabled when 0
+	StaleVolumeInterval time.Duration
+	// StaleVolumeGracePeriod is the time after which volumes without PV
+	// are deleted, they are only reported when 0
+	StaleVolumeGracePeriod time.Duration
+	// VolumeImportAllowList is the comma separated list of hosts, IP
+	// addresses and CIDRs that VolumeImports are downloaded from
+	VolumeImportAllowList string
+	// VolumeImportTimeout is the time after which the download of a
+	// VolumeImport is given up
+	VolumeImportTimeout time.Duration
 }
 
 // ControllerList holds the list of managers need to be started.
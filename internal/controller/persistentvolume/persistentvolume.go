@@ -19,6 +19,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 
 	ctrl "github.com/ceph/ceph-csi/internal/controller"
 	"github.com/ceph/ceph-csi/internal/rbd"
@@ -130,6 +131,14 @@ func checkStaticVolume(pv *corev1.PersistentVolume) bool {
 	return pv.Spec.CSI.VolumeAttributes["staticVolume"] == "true"
 }
 
+// checkJournalLessVolume returns whether the volume is not reserved in the
+// journal, it has no journal to regenerate.
+func checkJournalLessVolume(pv *corev1.PersistentVolume) bool {
+	journalLess, err := strconv.ParseBool(pv.Spec.CSI.VolumeAttributes["journalLess"])
+
+	return err == nil && journalLess
+}
+
 // reconcilePV will extract the image details from the pv spec and regenerates
 // the omap data.
 func (r *ReconcilePersistentVolume) reconcilePV(ctx context.Context, obj runtime.Object) error {
@@ -156,6 +165,10 @@ func (r *ReconcilePersistentVolume) reconcilePV(ctx context.Context, obj runtime
 	if static {
 		return nil
 	}
+	// journal-less volumes are found without OMAP data
+	if checkJournalLessVolume(pv) {
+		return nil
+	}
 	if pv.Spec.CSI.ControllerExpandSecretRef != nil {
 		secretName = pv.Spec.CSI.ControllerExpandSecretRef.Name
 		secretNamespace = pv.Spec.CSI.ControllerExpandSecretRef.Namespace
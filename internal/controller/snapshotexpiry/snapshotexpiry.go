@@ -0,0 +1,224 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshotexpiry
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// annotations of a VolumeSnapshotContent with the secret that the
+	// external-snapshotter deletes the snapshot with
+	deletionSecretNameKey      = "snapshot.storage.kubernetes.io/deletion-secret-name"
+	deletionSecretNamespaceKey = "snapshot.storage.kubernetes.io/deletion-secret-namespace"
+)
+
+// ReconcileSnapshotExpiry deletes the VolumeSnapshots of the driver once the
+// expiry that is stored in the metadata of their snapshot has passed.
+type ReconcileSnapshotExpiry struct {
+	client client.Client
+	config ctrl.Config
+	// getExpiry returns the expiry that is stored in the metadata of the
+	// snapshot with the ID
+	getExpiry func(ctx context.Context, snapshotID string, secrets map[string]string) (time.Time, bool, error)
+}
+
+var (
+	_ reconcile.Reconciler = &ReconcileSnapshotExpiry{}
+	_ ctrl.Manager         = &ReconcileSnapshotExpiry{}
+)
+
+// Init will add the ReconcileSnapshotExpiry to the list.
+func Init() {
+	ctrl.ControllerList = append(ctrl.ControllerList, &ReconcileSnapshotExpiry{})
+}
+
+// Add adds the newSnapshotExpiryReconciler, if the expiry of snapshots is
+// enforced. The VolumeSnapshot CRDs are only watched when it is enforced.
+func (r *ReconcileSnapshotExpiry) Add(mgr manager.Manager, config ctrl.Config) error {
+	if !config.EnforceSnapshotExpiry {
+		return nil
+	}
+	err := snapapi.AddToScheme(mgr.GetScheme())
+	if err != nil {
+		return fmt.Errorf("failed to add VolumeSnapshot types to scheme: %w", err)
+	}
+
+	return add(mgr, newSnapshotExpiryReconciler(mgr, config), config.DriverName)
+}
+
+// newSnapshotExpiryReconciler returns a ReconcileSnapshotExpiry.
+func newSnapshotExpiryReconciler(mgr manager.Manager, config ctrl.Config) reconcile.Reconciler {
+	return &ReconcileSnapshotExpiry{
+		client:    mgr.GetClient(),
+		config:    config,
+		getExpiry: rbd.GetSnapshotExpiry,
+	}
+}
+
+func add(mgr manager.Manager, r reconcile.Reconciler, driverName string) error {
+	c, err := controller.New(
+		"snapshotexpiry-controller",
+		mgr,
+		controller.Options{MaxConcurrentReconciles: 1, Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	isDriverContent := func(obj client.Object) bool {
+		content, ok := obj.(*snapapi.VolumeSnapshotContent)
+
+		return ok && content.Spec.Driver == driverName
+	}
+	// Watch for changes to VolumeSnapshotContents of the driver
+	err = c.Watch(
+		&source.Kind{Type: &snapapi.VolumeSnapshotContent{}},
+		&handler.EnqueueRequestForObject{},
+		predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isDriverContent(e.Object) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isDriverContent(e.ObjectNew) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return false },
+			GenericFunc: func(e event.GenericEvent) bool { return isDriverContent(e.Object) },
+		})
+	if err != nil {
+		return fmt.Errorf("failed to watch the changes: %w", err)
+	}
+
+	return nil
+}
+
+// snapshotOf returns the ID of the snapshot of the content and the secret
+// to read its metadata with, false if the snapshot has not been taken yet or
+// the content has no deletion secret.
+func snapshotOf(content *snapapi.VolumeSnapshotContent) (string, types.NamespacedName, bool) {
+	if content.Status == nil || content.Status.SnapshotHandle == nil || *content.Status.SnapshotHandle == "" {
+		return "", types.NamespacedName{}, false
+	}
+	secret := types.NamespacedName{
+		Name:      content.GetAnnotations()[deletionSecretNameKey],
+		Namespace: content.GetAnnotations()[deletionSecretNamespaceKey],
+	}
+	if secret.Name == "" || secret.Namespace == "" {
+		return "", types.NamespacedName{}, false
+	}
+
+	return *content.Status.SnapshotHandle, secret, true
+}
+
+// Reconcile deletes the VolumeSnapshot of the VolumeSnapshotContent when its
+// snapshot expired, and reconciles the content again when it expires
+// otherwise. The expiry is read from the metadata of the snapshot, where it
+// was stored when the snapshot was created, so later changes of the
+// retention of the VolumeSnapshotClass do not apply. The snapshot in the
+// Ceph cluster is deleted by the external-snapshotter, following the
+// deletionPolicy of the content.
+func (r *ReconcileSnapshotExpiry) Reconcile(ctx context.Context,
+	request reconcile.Request,
+) (reconcile.Result, error) {
+	content := &snapapi.VolumeSnapshotContent{}
+	err := r.client.Get(ctx, request.NamespacedName, content)
+	if err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	if content.Spec.Driver != r.config.DriverName || !content.GetDeletionTimestamp().IsZero() {
+		return reconcile.Result{}, nil
+	}
+	snapshotID, secretName, ok := snapshotOf(content)
+	if !ok {
+		// the content is updated once the snapshot is taken
+		return reconcile.Result{}, nil
+	}
+
+	secrets, err := r.getSecrets(ctx, secretName)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	expiry, ok, err := r.getExpiry(ctx, snapshotID, secrets)
+	if err != nil {
+		log.ErrorLogMsg("failed to get the expiry of snapshot %s of VolumeSnapshotContent %s: %v",
+			snapshotID, content.Name, err)
+
+		return reconcile.Result{}, err
+	}
+	if !ok {
+		return reconcile.Result{}, nil
+	}
+	if remaining := time.Until(expiry); remaining > 0 {
+		return reconcile.Result{RequeueAfter: remaining}, nil
+	}
+
+	return reconcile.Result{}, r.deleteSnapshot(ctx, content)
+}
+
+// getSecrets returns the data of the secret.
+func (r *ReconcileSnapshotExpiry) getSecrets(ctx context.Context, name types.NamespacedName) (map[string]string, error) {
+	secret := &corev1.Secret{}
+	err := r.client.Get(ctx, name, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s in namespace %s: %w", name.Name, name.Namespace, err)
+	}
+
+	secrets := map[string]string{}
+	for key, value := range secret.Data {
+		secrets[key] = string(value)
+	}
+
+	return secrets, nil
+}
+
+// deleteSnapshot deletes the VolumeSnapshot that the content is bound to.
+// A VolumeSnapshot that was created again with the same name is not deleted.
+func (r *ReconcileSnapshotExpiry) deleteSnapshot(ctx context.Context, content *snapapi.VolumeSnapshotContent) error {
+	ref := content.Spec.VolumeSnapshotRef
+	vs := &snapapi.VolumeSnapshot{}
+	err := r.client.Get(ctx, types.NamespacedName{Namespace: ref.Namespace, Name: ref.Name}, vs)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if ref.UID != "" && vs.UID != ref.UID {
+		return nil
+	}
+	if !vs.GetDeletionTimestamp().IsZero() {
+		return nil
+	}
+	log.DebugLogMsg("deleting expired VolumeSnapshot %s/%s of VolumeSnapshotContent %s",
+		vs.Namespace, vs.Name, content.Name)
+
+	return client.IgnoreNotFound(r.client.Delete(ctx, vs, client.Preconditions{UID: &vs.UID}))
+}
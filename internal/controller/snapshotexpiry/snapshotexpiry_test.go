@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snapshotexpiry
+
+import (
+	"testing"
+
+	snapapi "github.com/kubernetes-csi/external-snapshotter/client/v6/apis/volumesnapshot/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestSnapshotOf(t *testing.T) {
+	t.Parallel()
+	handle := "0001-0009-rook-ceph-0000000000000002-b0285c6c-3b4f-11ec-ab9e-0242ac110007"
+	empty := ""
+	secret := map[string]string{
+		deletionSecretNameKey:      "csi-rbd-secret",
+		deletionSecretNamespaceKey: "default",
+	}
+	tests := []struct {
+		name       string
+		content    *snapapi.VolumeSnapshotContent
+		wantID     string
+		wantSecret types.NamespacedName
+		wantOK     bool
+	}{
+		{
+			name:    "no status",
+			content: &snapapi.VolumeSnapshotContent{ObjectMeta: metav1.ObjectMeta{Annotations: secret}},
+			wantOK:  false,
+		},
+		{
+			name: "not taken yet",
+			content: &snapapi.VolumeSnapshotContent{
+				ObjectMeta: metav1.ObjectMeta{Annotations: secret},
+				Status:     &snapapi.VolumeSnapshotContentStatus{SnapshotHandle: &empty},
+			},
+			wantOK: false,
+		},
+		{
+			name: "no deletion secret",
+			content: &snapapi.VolumeSnapshotContent{
+				Status: &snapapi.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+			},
+			wantOK: false,
+		},
+		{
+			name: "taken",
+			content: &snapapi.VolumeSnapshotContent{
+				ObjectMeta: metav1.ObjectMeta{Annotations: secret},
+				Status:     &snapapi.VolumeSnapshotContentStatus{SnapshotHandle: &handle},
+			},
+			wantID:     handle,
+			wantSecret: types.NamespacedName{Name: "csi-rbd-secret", Namespace: "default"},
+			wantOK:     true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			id, secret, ok := snapshotOf(ts.content)
+			if ok != ts.wantOK {
+				t.Errorf("snapshotOf() ok = %v, want %v", ok, ts.wantOK)
+			}
+			if id != ts.wantID || secret != ts.wantSecret {
+				t.Errorf("snapshotOf() = %q, %v, want %q, %v", id, secret, ts.wantID, ts.wantSecret)
+			}
+		})
+	}
+}
@@ -0,0 +1,303 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalevolume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+)
+
+// uidLength is the length of the UID of a PVC at the end of the request names
+// of the csi-provisioner.
+const uidLength = 36
+
+// errNoClusterName is returned when stale volumes should be deleted, but the
+// volumes of the cluster can not be told apart from the volumes of other
+// clusters.
+var errNoClusterName = errors.New("deleting stale volumes needs --clustername and --setmetadata")
+
+// StaleVolumeReaper periodically lists the volumes in the journals of the
+// pools and reports the volumes that no PersistentVolume refers to, like the
+// volumes of PVs that vanished with a restore of etcd. Stale volumes are
+// deleted once they have been stale for the grace period, if one is set and
+// their last PV had the Delete reclaim policy.
+type StaleVolumeReaper struct {
+	reader client.Reader
+	config ctrl.Config
+	// firstSeen is the time at which the volumes were first found stale
+	firstSeen map[string]time.Time
+}
+
+var (
+	_ ctrl.Manager     = &StaleVolumeReaper{}
+	_ manager.Runnable = &StaleVolumeReaper{}
+)
+
+// Init will add the StaleVolumeReaper to the list.
+func Init() {
+	ctrl.ControllerList = append(ctrl.ControllerList, &StaleVolumeReaper{})
+}
+
+// Add adds the newStaleVolumeReaper to the manager, if an interval for
+// listing the volumes is set. The reaper only runs on the leader. A grace
+// period is only accepted with the name of the cluster in the metadata of the
+// volumes, other Kubernetes clusters may use the same pools.
+func (r *StaleVolumeReaper) Add(mgr manager.Manager, config ctrl.Config) error {
+	if config.StaleVolumeInterval == 0 {
+		return nil
+	}
+	if config.StaleVolumeGracePeriod != 0 && (config.ClusterName == "" || !config.SetMetadata) {
+		return errNoClusterName
+	}
+	rbd.InitJournals(config.InstanceID)
+
+	return mgr.Add(newStaleVolumeReaper(mgr, config))
+}
+
+// newStaleVolumeReaper returns a StaleVolumeReaper that reads the
+// PersistentVolumes and PersistentVolumeClaims from the API server, the cache
+// of the manager may not be synced yet.
+func newStaleVolumeReaper(mgr manager.Manager, config ctrl.Config) *StaleVolumeReaper {
+	return &StaleVolumeReaper{
+		reader:    mgr.GetAPIReader(),
+		config:    config,
+		firstSeen: map[string]time.Time{},
+	}
+}
+
+// Start lists the stale volumes every interval, until the context is done.
+func (r *StaleVolumeReaper) Start(ctx context.Context) error {
+	wait.UntilWithContext(ctx, r.reap, r.config.StaleVolumeInterval)
+
+	return nil
+}
+
+// reap reports the volumes that became stale, and deletes the volumes that
+// have been stale for the grace period. The journals are listed before the
+// PVs and PVCs, so that volumes that are created in between have their PVC
+// listed. With a grace period, the reclaim policies of the PVs are stored in
+// the metadata of their images, as the policy is gone with the PV.
+func (r *StaleVolumeReaper) reap(ctx context.Context) {
+	clusterIDs, err := util.GetClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		log.ErrorLogMsg("failed to get the clusters of the CSI config file: %v", err)
+
+		return
+	}
+	volumes, err := rbd.ListJournalVolumes(ctx, clusterIDs)
+	if err != nil {
+		log.ErrorLogMsg("failed to list the volumes in the journals: %v", err)
+
+		return
+	}
+	refs, err := r.listReferences(ctx)
+	if err != nil {
+		log.ErrorLogMsg("failed to list PersistentVolumes and PersistentVolumeClaims: %v", err)
+
+		return
+	}
+
+	now := time.Now()
+	stale := staleVolumes(volumes, refs, r.config.ClusterName)
+	added := trackStale(r.firstSeen, stale, now)
+	for i := range added {
+		vol := &added[i]
+		log.WarningLogMsg("volume %s (image %s/%s, request name %s, owner %q, cluster name %q) has no PersistentVolume",
+			vol.VolumeID, vol.Pool, vol.ImageName, vol.RequestName, vol.Owner, vol.ClusterName)
+	}
+	if r.config.StaleVolumeGracePeriod == 0 {
+		return
+	}
+	for volID, policy := range reclaimPolicyUpdates(volumes, refs, r.config.ClusterName) {
+		err = rbd.SetReclaimPolicy(ctx, volID, policy)
+		if err != nil {
+			log.ErrorLogMsg("failed to store reclaim policy %s of volume %s: %v", policy, volID, err)
+		}
+	}
+	for i := range stale {
+		vol := &stale[i]
+		if !deletable(vol, r.config.ClusterName) {
+			continue
+		}
+		staleFor := now.Sub(r.firstSeen[vol.VolumeID])
+		if staleFor < r.config.StaleVolumeGracePeriod {
+			continue
+		}
+		log.WarningLogMsg("deleting volume %s (image %s/%s, request name %s) without PersistentVolume for %s",
+			vol.VolumeID, vol.Pool, vol.ImageName, vol.RequestName, staleFor.Round(time.Second))
+		err = rbd.DeleteStaleVolume(ctx, vol.VolumeID, r.config.ClusterName)
+		if err != nil {
+			log.ErrorLogMsg("failed to delete stale volume %s: %v", vol.VolumeID, err)
+
+			continue
+		}
+		delete(r.firstSeen, vol.VolumeID)
+	}
+}
+
+// references are the volume handles and request names that Kubernetes still
+// refers to.
+type references struct {
+	volumeIDs    map[string]bool
+	requestNames map[string]bool
+	// reclaimPolicies are the reclaim policies of the PVs by volume handle
+	reclaimPolicies map[string]corev1.PersistentVolumeReclaimPolicy
+	// claimUIDs are the UIDs of the PVCs, which the csi-provisioner uses in
+	// the request name of the volume before the PV is created
+	claimUIDs map[string]bool
+}
+
+// listReferences lists the PVs of the driver and all PVCs.
+func (r *StaleVolumeReaper) listReferences(ctx context.Context) (references, error) {
+	refs := references{
+		volumeIDs:       map[string]bool{},
+		requestNames:    map[string]bool{},
+		reclaimPolicies: map[string]corev1.PersistentVolumeReclaimPolicy{},
+		claimUIDs:       map[string]bool{},
+	}
+
+	pvs := &corev1.PersistentVolumeList{}
+	err := r.reader.List(ctx, pvs)
+	if err != nil {
+		return refs, fmt.Errorf("failed to list PersistentVolumes: %w", err)
+	}
+	for i := range pvs.Items {
+		refs.addPV(&pvs.Items[i], r.config.DriverName)
+	}
+
+	pvcs := &corev1.PersistentVolumeClaimList{}
+	err = r.reader.List(ctx, pvcs)
+	if err != nil {
+		return refs, fmt.Errorf("failed to list PersistentVolumeClaims: %w", err)
+	}
+	for i := range pvcs.Items {
+		refs.claimUIDs[string(pvcs.Items[i].UID)] = true
+	}
+
+	return refs, nil
+}
+
+// addPV adds the volume handle and name of the PV, if it is a volume of the
+// driver.
+func (refs references) addPV(pv *corev1.PersistentVolume, driverName string) {
+	if pv.Spec.CSI == nil || pv.Spec.CSI.Driver != driverName {
+		return
+	}
+	refs.volumeIDs[pv.Spec.CSI.VolumeHandle] = true
+	refs.requestNames[pv.Name] = true
+	refs.reclaimPolicies[pv.Spec.CSI.VolumeHandle] = pv.Spec.PersistentVolumeReclaimPolicy
+}
+
+// referenced returns whether a PV refers to the volume, or a PVC that the
+// volume is being provisioned for exists.
+func (refs references) referenced(vol *rbd.JournalVolume) bool {
+	if refs.volumeIDs[vol.VolumeID] || refs.requestNames[vol.RequestName] {
+		return true
+	}
+	if len(vol.RequestName) < uidLength {
+		return false
+	}
+
+	return refs.claimUIDs[vol.RequestName[len(vol.RequestName)-uidLength:]]
+}
+
+// staleVolumes returns the volumes that are not referenced. Volumes with the
+// name of another Kubernetes cluster in their metadata are skipped, when the
+// name of the cluster is set.
+func staleVolumes(volumes []rbd.JournalVolume, refs references, clusterName string) []rbd.JournalVolume {
+	stale := []rbd.JournalVolume{}
+	for i := range volumes {
+		vol := &volumes[i]
+		if clusterName != "" && vol.ClusterName != "" && vol.ClusterName != clusterName {
+			continue
+		}
+		if !refs.referenced(vol) {
+			stale = append(stale, *vol)
+		}
+	}
+
+	return stale
+}
+
+// deletable returns whether the stale volume can be deleted, only volumes
+// with the name of the cluster in their metadata are deleted. Volumes without
+// metadata may belong to other Kubernetes clusters, they are only reported.
+// Volumes whose last PV had the Retain reclaim policy are kept on purpose,
+// and volumes without a stored reclaim policy may have been, neither are
+// deleted.
+func deletable(vol *rbd.JournalVolume, clusterName string) bool {
+	return clusterName != "" && vol.ClusterName == clusterName &&
+		vol.ReclaimPolicy == string(corev1.PersistentVolumeReclaimDelete)
+}
+
+// reclaimPolicyUpdates returns the reclaim policies of the PVs of the volumes
+// of the cluster, by volume ID, that are not stored in the metadata of their
+// images yet.
+func reclaimPolicyUpdates(
+	volumes []rbd.JournalVolume,
+	refs references,
+	clusterName string,
+) map[string]corev1.PersistentVolumeReclaimPolicy {
+	updates := map[string]corev1.PersistentVolumeReclaimPolicy{}
+	for i := range volumes {
+		vol := &volumes[i]
+		if clusterName == "" || vol.ClusterName != clusterName {
+			continue
+		}
+		policy, ok := refs.reclaimPolicies[vol.VolumeID]
+		if ok && policy != "" && string(policy) != vol.ReclaimPolicy {
+			updates[vol.VolumeID] = policy
+		}
+	}
+
+	return updates
+}
+
+// trackStale records the time at which the stale volumes were first seen,
+// and forgets the volumes that are not stale anymore. The volumes that became
+// stale are returned.
+func trackStale(firstSeen map[string]time.Time, stale []rbd.JournalVolume, now time.Time) []rbd.JournalVolume {
+	current := make(map[string]bool, len(stale))
+	added := []rbd.JournalVolume{}
+	for i := range stale {
+		volID := stale[i].VolumeID
+		current[volID] = true
+		if _, ok := firstSeen[volID]; !ok {
+			firstSeen[volID] = now
+			added = append(added, stale[i])
+		}
+	}
+	for volID := range firstSeen {
+		if !current[volID] {
+			delete(firstSeen, volID)
+		}
+	}
+
+	return added
+}
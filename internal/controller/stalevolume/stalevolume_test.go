@@ -0,0 +1,274 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package stalevolume
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/rbd"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	testDriverName = "rbd.csi.ceph.com"
+	testClaimUID   = "4d9b0e3c-7b55-4d0a-a4a4-1c2f5d6a8e01"
+)
+
+func csiPV(name, driver, handle string) *corev1.PersistentVolume {
+	return &corev1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: corev1.PersistentVolumeSpec{
+			PersistentVolumeSource: corev1.PersistentVolumeSource{
+				CSI: &corev1.CSIPersistentVolumeSource{
+					Driver:       driver,
+					VolumeHandle: handle,
+				},
+			},
+		},
+	}
+}
+
+func TestStaleVolumes(t *testing.T) {
+	t.Parallel()
+	refs := references{
+		volumeIDs:       map[string]bool{},
+		requestNames:    map[string]bool{},
+		reclaimPolicies: map[string]corev1.PersistentVolumeReclaimPolicy{},
+		claimUIDs:       map[string]bool{testClaimUID: true},
+	}
+	refs.addPV(csiPV("pvc-bound", testDriverName, "vol-bound"), testDriverName)
+	refs.addPV(csiPV("pvc-imported", testDriverName, "vol-imported"), testDriverName)
+	refs.addPV(csiPV("pvc-other", "cephfs.csi.ceph.com", "vol-other"), testDriverName)
+	refs.addPV(&corev1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pvc-hostpath"}}, testDriverName)
+
+	tests := []struct {
+		name        string
+		volume      rbd.JournalVolume
+		clusterName string
+		stale       bool
+	}{
+		{
+			name:   "bound volume",
+			volume: rbd.JournalVolume{VolumeID: "vol-bound", RequestName: "pvc-bound"},
+			stale:  false,
+		},
+		{
+			name:   "PV with another handle",
+			volume: rbd.JournalVolume{VolumeID: "vol-restored", RequestName: "pvc-imported"},
+			stale:  false,
+		},
+		{
+			name:   "PVC being provisioned",
+			volume: rbd.JournalVolume{VolumeID: "vol-new", RequestName: "pvc-" + testClaimUID},
+			stale:  false,
+		},
+		{
+			name:   "PV of another driver",
+			volume: rbd.JournalVolume{VolumeID: "vol-other", RequestName: "pvc-other"},
+			stale:  true,
+		},
+		{
+			name:   "PV without CSI source",
+			volume: rbd.JournalVolume{VolumeID: "vol-hostpath", RequestName: "pvc-hostpath"},
+			stale:  true,
+		},
+		{
+			name:   "vanished PV",
+			volume: rbd.JournalVolume{VolumeID: "vol-lost", RequestName: "pvc-9f0c5bd2-0a5e-4c43-8f5e-3a7d0b1c2d3e"},
+			stale:  true,
+		},
+		{
+			name:   "short request name",
+			volume: rbd.JournalVolume{VolumeID: "vol-short", RequestName: "short"},
+			stale:  true,
+		},
+		{
+			name: "volume of another cluster",
+			volume: rbd.JournalVolume{
+				VolumeID:    "vol-lost",
+				RequestName: "pvc-lost",
+				ClusterName: "cluster-b",
+			},
+			clusterName: "cluster-a",
+			stale:       false,
+		},
+		{
+			name: "volume of the cluster",
+			volume: rbd.JournalVolume{
+				VolumeID:    "vol-lost",
+				RequestName: "pvc-lost",
+				ClusterName: "cluster-a",
+			},
+			clusterName: "cluster-a",
+			stale:       true,
+		},
+		{
+			name:        "volume without cluster name",
+			volume:      rbd.JournalVolume{VolumeID: "vol-lost", RequestName: "pvc-lost"},
+			clusterName: "cluster-a",
+			stale:       true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			stale := staleVolumes([]rbd.JournalVolume{ts.volume}, refs, ts.clusterName)
+			if got := len(stale) == 1; got != ts.stale {
+				t.Errorf("staleVolumes() stale = %t, want %t", got, ts.stale)
+			}
+		})
+	}
+}
+
+func TestDeletable(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name        string
+		volume      rbd.JournalVolume
+		clusterName string
+		want        bool
+	}{
+		{
+			name: "volume of the cluster",
+			volume: rbd.JournalVolume{
+				VolumeID:      "vol-lost",
+				ClusterName:   "cluster-a",
+				ReclaimPolicy: "Delete",
+			},
+			clusterName: "cluster-a",
+			want:        true,
+		},
+		{
+			name: "volume with Retain reclaim policy",
+			volume: rbd.JournalVolume{
+				VolumeID:      "vol-lost",
+				ClusterName:   "cluster-a",
+				ReclaimPolicy: "Retain",
+			},
+			clusterName: "cluster-a",
+			want:        false,
+		},
+		{
+			name:        "volume without reclaim policy",
+			volume:      rbd.JournalVolume{VolumeID: "vol-lost", ClusterName: "cluster-a"},
+			clusterName: "cluster-a",
+			want:        false,
+		},
+		{
+			name:        "volume without cluster name",
+			volume:      rbd.JournalVolume{VolumeID: "vol-lost"},
+			clusterName: "cluster-a",
+			want:        false,
+		},
+		{
+			name: "volume of another cluster",
+			volume: rbd.JournalVolume{
+				VolumeID:      "vol-lost",
+				ClusterName:   "cluster-b",
+				ReclaimPolicy: "Delete",
+			},
+			clusterName: "cluster-a",
+			want:        false,
+		},
+		{
+			name:        "no cluster name configured",
+			volume:      rbd.JournalVolume{VolumeID: "vol-lost"},
+			clusterName: "",
+			want:        false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := deletable(&ts.volume, ts.clusterName); got != ts.want {
+				t.Errorf("deletable() = %t, want %t", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestReclaimPolicyUpdates(t *testing.T) {
+	t.Parallel()
+	refs := references{
+		volumeIDs:       map[string]bool{},
+		requestNames:    map[string]bool{},
+		reclaimPolicies: map[string]corev1.PersistentVolumeReclaimPolicy{},
+		claimUIDs:       map[string]bool{},
+	}
+	retained := csiPV("pvc-retained", testDriverName, "vol-retained")
+	retained.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimRetain
+	refs.addPV(retained, testDriverName)
+	deleted := csiPV("pvc-deleted", testDriverName, "vol-deleted")
+	deleted.Spec.PersistentVolumeReclaimPolicy = corev1.PersistentVolumeReclaimDelete
+	refs.addPV(deleted, testDriverName)
+	refs.addPV(csiPV("pvc-stored", testDriverName, "vol-stored"), testDriverName)
+	refs.reclaimPolicies["vol-stored"] = corev1.PersistentVolumeReclaimDelete
+	refs.addPV(csiPV("pvc-other", testDriverName, "vol-other"), testDriverName)
+	refs.reclaimPolicies["vol-other"] = corev1.PersistentVolumeReclaimDelete
+
+	volumes := []rbd.JournalVolume{
+		{VolumeID: "vol-retained", ClusterName: "cluster-a", ReclaimPolicy: "Delete"},
+		{VolumeID: "vol-deleted", ClusterName: "cluster-a"},
+		{VolumeID: "vol-stored", ClusterName: "cluster-a", ReclaimPolicy: "Delete"},
+		{VolumeID: "vol-other", ClusterName: "cluster-b"},
+		{VolumeID: "vol-lost", ClusterName: "cluster-a"},
+	}
+	want := map[string]corev1.PersistentVolumeReclaimPolicy{
+		"vol-retained": corev1.PersistentVolumeReclaimRetain,
+		"vol-deleted":  corev1.PersistentVolumeReclaimDelete,
+	}
+	got := reclaimPolicyUpdates(volumes, refs, "cluster-a")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("reclaimPolicyUpdates() = %v, want %v", got, want)
+	}
+	if got = reclaimPolicyUpdates(volumes, refs, ""); len(got) != 0 {
+		t.Errorf("reclaimPolicyUpdates() without cluster name = %v, want none", got)
+	}
+}
+
+func TestTrackStale(t *testing.T) {
+	t.Parallel()
+	first := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	later := first.Add(time.Hour)
+	firstSeen := map[string]time.Time{}
+
+	added := trackStale(firstSeen, []rbd.JournalVolume{{VolumeID: "a"}, {VolumeID: "b"}}, first)
+	if len(added) != 2 {
+		t.Fatalf("trackStale() added %d volumes, want 2", len(added))
+	}
+
+	// b is not stale anymore, c became stale
+	added = trackStale(firstSeen, []rbd.JournalVolume{{VolumeID: "a"}, {VolumeID: "c"}}, later)
+	if len(added) != 1 || added[0].VolumeID != "c" {
+		t.Errorf("trackStale() added %v, want only c", added)
+	}
+	want := map[string]time.Time{"a": first, "c": later}
+	if len(firstSeen) != len(want) {
+		t.Fatalf("trackStale() tracks %v, want %v", firstSeen, want)
+	}
+	for volID, seen := range want {
+		if !firstSeen[volID].Equal(seen) {
+			t.Errorf("trackStale() first seen %s at %v, want %v", volID, firstSeen[volID], seen)
+		}
+	}
+}
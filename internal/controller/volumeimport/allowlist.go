@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// dialTimeout is the time to connect to the source of a VolumeImport.
+	dialTimeout = 30 * time.Second
+	// responseHeaderTimeout is the time to wait for the response headers of
+	// the source of a VolumeImport.
+	responseHeaderTimeout = time.Minute
+)
+
+// errForbiddenAddress is returned when the source of a VolumeImport is not
+// allowed by the allow-list.
+var errForbiddenAddress = errors.New("address not allowed for VolumeImports")
+
+// allowList holds the hosts and networks that VolumeImports can be
+// downloaded from. An empty allow-list allows all addresses except loopback,
+// private, link-local and unspecified addresses.
+type allowList struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+// parseAllowList parses the comma separated list of host names, IP
+// addresses and CIDRs.
+func parseAllowList(list string) (*allowList, error) {
+	a := &allowList{hosts: map[string]bool{}}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			_, network, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid VolumeImport allow-list entry %q: %w", entry, err)
+			}
+			a.networks = append(a.networks, network)
+
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			a.networks = append(a.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+
+			continue
+		}
+		a.hosts[strings.ToLower(entry)] = true
+	}
+
+	return a, nil
+}
+
+// empty returns whether no hosts or networks are configured.
+func (a *allowList) empty() bool {
+	return len(a.hosts) == 0 && len(a.networks) == 0
+}
+
+// allowsHost returns whether the host name is in the allow-list, all
+// addresses of allowed host names can be connected to.
+func (a *allowList) allowsHost(host string) bool {
+	return a.hosts[strings.ToLower(host)]
+}
+
+// allowsIP returns whether a connection to the IP address is allowed. With
+// an allow-list only its networks are allowed, otherwise all addresses that
+// are not restricted.
+func (a *allowList) allowsIP(ip net.IP) bool {
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return a.empty() && !restrictedIP(ip)
+}
+
+// restrictedIP returns whether the IP address is a loopback, private,
+// link-local or unspecified address, which can only be connected to when
+// the allow-list contains it.
+func restrictedIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast()
+}
+
+// dialContext connects to the address if the allow-list allows it. The IP
+// address is checked once it is resolved, so that a host name can not
+// resolve to another address after it was checked.
+func (a *allowList) dialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	if !a.allowsHost(host) {
+		dialer.Control = func(_, resolved string, _ syscall.RawConn) error {
+			ipStr, _, err := net.SplitHostPort(resolved)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(ipStr)
+			if ip == nil || !a.allowsIP(ip) {
+				return fmt.Errorf("%w: %s (%s)", errForbiddenAddress, host, ipStr)
+			}
+
+			return nil
+		}
+	}
+
+	return dialer.DialContext(ctx, network, address)
+}
+
+// newHTTPClient returns a client that only connects to addresses that the
+// allow-list allows, and that gives up on a download after the timeout.
+// Proxies are not used, as the allow-list would only apply to them.
+func newHTTPClient(a *allowList, timeout time.Duration) *http.Client {
+	transport, ok := http.DefaultTransport.(*http.Transport)
+	if ok {
+		transport = transport.Clone()
+	} else {
+		transport = &http.Transport{}
+	}
+	transport.Proxy = nil
+	transport.DialContext = a.dialContext
+	transport.ResponseHeaderTimeout = responseHeaderTimeout
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+	}
+}
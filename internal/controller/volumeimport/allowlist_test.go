@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeimport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestParseAllowList(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		list    string
+		hosts   int
+		nets    int
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			list: "",
+		},
+		{
+			name:  "hosts, addresses and CIDRs",
+			list:  "minio.minio.svc, 10.0.8.0/24,fd00::1,,S3.example.com",
+			hosts: 2,
+			nets:  2,
+		},
+		{
+			name:    "invalid CIDR",
+			list:    "10.0.8.0/33",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			a, err := parseAllowList(ts.list)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("parseAllowList() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(a.hosts) != ts.hosts || len(a.networks) != ts.nets {
+				t.Errorf("parseAllowList() = %d hosts and %d networks, want %d and %d",
+					len(a.hosts), len(a.networks), ts.hosts, ts.nets)
+			}
+		})
+	}
+}
+
+func TestAllowsIP(t *testing.T) {
+	t.Parallel()
+	restricted, err := parseAllowList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := parseAllowList("s3.example.com,10.0.8.0/24,fd00::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		list  *allowList
+		ip    string
+		want  bool
+		wantH bool
+	}{
+		{name: "public address", list: restricted, ip: "203.0.113.10", want: true},
+		{name: "loopback", list: restricted, ip: "127.0.0.1", want: false},
+		{name: "private", list: restricted, ip: "10.0.8.1", want: false},
+		{name: "link-local metadata service", list: restricted, ip: "169.254.169.254", want: false},
+		{name: "unspecified", list: restricted, ip: "0.0.0.0", want: false},
+		{name: "IPv6 unique local", list: restricted, ip: "fd00::1", want: false},
+		{name: "IPv6 link-local", list: restricted, ip: "fe80::1", want: false},
+		{name: "allowed network", list: allowed, ip: "10.0.8.1", want: true},
+		{name: "allowed address", list: allowed, ip: "fd00::1", want: true},
+		{name: "public address not in allow-list", list: allowed, ip: "203.0.113.10", want: false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ts.list.allowsIP(net.ParseIP(ts.ip)); got != ts.want {
+				t.Errorf("allowsIP(%s) = %v, want %v", ts.ip, got, ts.want)
+			}
+		})
+	}
+
+	if !allowed.allowsHost("S3.Example.com") {
+		t.Error("allowsHost() = false for a host of the allow-list")
+	}
+	if restricted.allowsHost("s3.example.com") {
+		t.Error("allowsHost() = true with an empty allow-list")
+	}
+}
+
+func TestDialContextForbidden(t *testing.T) {
+	t.Parallel()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	a, err := parseAllowList("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = a.dialContext(context.TODO(), "tcp", listener.Addr().String())
+	if !errors.Is(err, errForbiddenAddress) {
+		t.Fatalf("dialContext() error = %v, want %v", err, errForbiddenAddress)
+	}
+
+	a, err = parseAllowList("127.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := a.dialContext(context.TODO(), "tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dialContext() error = %v", err)
+	}
+	conn.Close()
+}
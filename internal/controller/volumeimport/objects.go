@@ -0,0 +1,145 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeimport
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"net/url"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// volumeImportGroup is the API group of the VolumeImport CRD.
+	volumeImportGroup = "rbd.csi.ceph.com"
+	// volumeImportKind is the kind of the VolumeImport CRD.
+	volumeImportKind = "VolumeImport"
+
+	// selectedNodeAnnotation is set on PVCs of StorageClasses with the
+	// WaitForFirstConsumer binding mode, once the scheduler selected a node
+	// for the consumer of the PVC.
+	selectedNodeAnnotation = "volume.kubernetes.io/selected-node"
+	// importForAnnotation is the namespace/name of the PVC of a prime PVC.
+	importForAnnotation = "rbd.csi.ceph.com/import-for"
+	// importUIDAnnotation is the UID of the PVC of a prime PVC, a prime PVC
+	// of a deleted PVC with the same name is not used.
+	importUIDAnnotation = "rbd.csi.ceph.com/import-uid"
+	// populatedAnnotation is set on a prime PVC once its volume is
+	// populated.
+	populatedAnnotation = "rbd.csi.ceph.com/populated"
+)
+
+// errInvalidImport is returned for a VolumeImport without a valid URL.
+var errInvalidImport = errors.New("invalid VolumeImport")
+
+// volumeImportGVK is the GroupVersionKind of the VolumeImport CRD.
+var volumeImportGVK = schema.GroupVersionKind{
+	Group:   volumeImportGroup,
+	Version: "v1alpha1",
+	Kind:    volumeImportKind,
+}
+
+// isVolumeImport returns whether the data source is a VolumeImport.
+func isVolumeImport(ref *corev1.TypedLocalObjectReference) bool {
+	return ref != nil && ref.APIGroup != nil && *ref.APIGroup == volumeImportGroup && ref.Kind == volumeImportKind
+}
+
+// importURL returns the URL in the spec of the VolumeImport, only http and
+// https URLs are supported.
+func importURL(vi *unstructured.Unstructured) (string, error) {
+	rawURL, _, err := unstructured.NestedString(vi.Object, "spec", "url")
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %v", errInvalidImport, vi.GetName(), err)
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %v", errInvalidImport, vi.GetName(), err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w %s: unsupported URL %q", errInvalidImport, vi.GetName(), rawURL)
+	}
+
+	return rawURL, nil
+}
+
+// waitsForConsumer returns whether volumes of the StorageClass are only
+// provisioned once a node is selected for their consumer.
+func waitsForConsumer(sc *storagev1.StorageClass) bool {
+	return sc.VolumeBindingMode != nil && *sc.VolumeBindingMode == storagev1.VolumeBindingWaitForFirstConsumer
+}
+
+// primeName returns the name of the prime PVC of the PVC. The prime PVCs of
+// all namespaces are in the namespace of the driver, the name is derived of
+// the namespace and name of the PVC, so that it can be found once the PVC is
+// deleted.
+func primeName(pvc types.NamespacedName) string {
+	return fmt.Sprintf("import-%x", sha256.Sum256([]byte(pvc.String())))[:len("import-")+32]
+}
+
+// primePVCName returns the namespaced name of the prime PVC of the PVC.
+func primePVCName(namespace string, pvc *corev1.PersistentVolumeClaim) types.NamespacedName {
+	return types.NamespacedName{
+		Namespace: namespace,
+		Name:      primeName(types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}),
+	}
+}
+
+// newPrimePVC returns the prime PVC of the PVC in the namespace, which has
+// the same StorageClass, size and volume mode, and is provisioned on the
+// node that was selected for the PVC.
+func newPrimePVC(namespace string, pvc *corev1.PersistentVolumeClaim) *corev1.PersistentVolumeClaim {
+	key := primePVCName(namespace, pvc)
+	prime := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: key.Namespace,
+			Name:      key.Name,
+			Annotations: map[string]string{
+				importForAnnotation: types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Name}.String(),
+				importUIDAnnotation: string(pvc.UID),
+			},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      pvc.Spec.AccessModes,
+			Resources:        pvc.Spec.Resources,
+			StorageClassName: pvc.Spec.StorageClassName,
+			VolumeMode:       pvc.Spec.VolumeMode,
+		},
+	}
+	if node := pvc.Annotations[selectedNodeAnnotation]; node != "" {
+		prime.Annotations[selectedNodeAnnotation] = node
+	}
+
+	return prime
+}
+
+// claimRef returns the reference of a PV that is bound to the PVC.
+func claimRef(pvc *corev1.PersistentVolumeClaim) *corev1.ObjectReference {
+	return &corev1.ObjectReference{
+		Kind:       "PersistentVolumeClaim",
+		APIVersion: "v1",
+		Namespace:  pvc.Namespace,
+		Name:       pvc.Name,
+		UID:        pvc.UID,
+	}
+}
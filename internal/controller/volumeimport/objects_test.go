@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeimport
+
+import (
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestIsVolumeImport(t *testing.T) {
+	t.Parallel()
+	group := volumeImportGroup
+	other := "example.com"
+	tests := []struct {
+		name string
+		ref  *corev1.TypedLocalObjectReference
+		want bool
+	}{
+		{
+			name: "no data source",
+			ref:  nil,
+			want: false,
+		},
+		{
+			name: "PVC",
+			ref:  &corev1.TypedLocalObjectReference{Kind: "PersistentVolumeClaim", Name: "pvc"},
+			want: false,
+		},
+		{
+			name: "other group",
+			ref:  &corev1.TypedLocalObjectReference{APIGroup: &other, Kind: volumeImportKind, Name: "import"},
+			want: false,
+		},
+		{
+			name: "VolumeImport",
+			ref:  &corev1.TypedLocalObjectReference{APIGroup: &group, Kind: volumeImportKind, Name: "import"},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := isVolumeImport(ts.ref); got != ts.want {
+				t.Errorf("isVolumeImport() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestImportURL(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		spec    map[string]interface{}
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "https",
+			spec: map[string]interface{}{"url": "https://s3.example.com/backups/image.raw?X-Amz-Signature=abc"},
+			want: "https://s3.example.com/backups/image.raw?X-Amz-Signature=abc",
+		},
+		{
+			name:    "missing URL",
+			spec:    map[string]interface{}{},
+			wantErr: true,
+		},
+		{
+			name:    "unsupported scheme",
+			spec:    map[string]interface{}{"url": "file:///etc/passwd"},
+			wantErr: true,
+		},
+		{
+			name:    "not a string",
+			spec:    map[string]interface{}{"url": int64(1)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			vi := &unstructured.Unstructured{Object: map[string]interface{}{"spec": ts.spec}}
+			got, err := importURL(vi)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("importURL() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidImport) {
+				t.Errorf("importURL() error = %v, want %v", err, errInvalidImport)
+			}
+			if got != ts.want {
+				t.Errorf("importURL() = %q, want %q", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestNewPrimePVC(t *testing.T) {
+	t.Parallel()
+	sc := "rbd"
+	block := corev1.PersistentVolumeBlock
+	pvc := &corev1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "app",
+			Name:        "data",
+			UID:         types.UID("1234"),
+			Annotations: map[string]string{selectedNodeAnnotation: "node1"},
+		},
+		Spec: corev1.PersistentVolumeClaimSpec{
+			AccessModes:      []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce},
+			StorageClassName: &sc,
+			VolumeMode:       &block,
+		},
+	}
+
+	prime := newPrimePVC("ceph-csi", pvc)
+	if prime.Namespace != "ceph-csi" || prime.Name != primeName(types.NamespacedName{Namespace: "app", Name: "data"}) {
+		t.Errorf("newPrimePVC() = %s/%s", prime.Namespace, prime.Name)
+	}
+	if len(prime.Name) > 63 {
+		t.Errorf("name %q of prime PVC is not a valid label value", prime.Name)
+	}
+	if prime.Annotations[importForAnnotation] != "app/data" || prime.Annotations[importUIDAnnotation] != "1234" {
+		t.Errorf("newPrimePVC() annotations = %v", prime.Annotations)
+	}
+	if prime.Annotations[selectedNodeAnnotation] != "node1" {
+		t.Errorf("newPrimePVC() is not provisioned on the selected node: %v", prime.Annotations)
+	}
+	if *prime.Spec.StorageClassName != sc || *prime.Spec.VolumeMode != block || prime.Spec.DataSourceRef != nil {
+		t.Errorf("newPrimePVC() spec = %v", prime.Spec)
+	}
+
+	other := primeName(types.NamespacedName{Namespace: "app-data", Name: ""})
+	if other == prime.Name {
+		t.Errorf("prime PVCs of different PVCs have the same name %s", other)
+	}
+}
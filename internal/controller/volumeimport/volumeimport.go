@@ -0,0 +1,363 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package volumeimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	ctrl "github.com/ceph/ceph-csi/internal/controller"
+	"github.com/ceph/ceph-csi/internal/rbd"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const (
+	// pollInterval is the time after which a PVC is reconciled again, while
+	// its prime PVC or its VolumeImport are not available yet.
+	pollInterval = 10 * time.Second
+	// defaultImportTimeout is the time after which a download is given up,
+	// when no timeout is configured.
+	defaultImportTimeout = time.Hour
+)
+
+// errNoSecret is returned when the PV of a volume does not reference a
+// secret with the credentials to write to its image.
+var errNoSecret = errors.New("no secret to access the volume")
+
+// ReconcileVolumeImport populates the volumes of PVCs that have a
+// VolumeImport as data source.
+type ReconcileVolumeImport struct {
+	client client.Client
+	// reader reads the VolumeImports from the API server, so that no informer
+	// is started when the CRD is not installed
+	reader     client.Reader
+	httpClient *http.Client
+	// timeout is the time after which a download is given up
+	timeout time.Duration
+	config  ctrl.Config
+}
+
+var (
+	_ reconcile.Reconciler = &ReconcileVolumeImport{}
+	_ ctrl.Manager         = &ReconcileVolumeImport{}
+)
+
+// Init will add the ReconcileVolumeImport to the list.
+func Init() {
+	ctrl.ControllerList = append(ctrl.ControllerList, &ReconcileVolumeImport{})
+}
+
+// Add adds the newVolumeImportReconciler.
+func (r *ReconcileVolumeImport) Add(mgr manager.Manager, config ctrl.Config) error {
+	reconciler, err := newVolumeImportReconciler(mgr, config)
+	if err != nil {
+		return err
+	}
+
+	return add(mgr, reconciler)
+}
+
+// newVolumeImportReconciler returns a ReconcileVolumeImport, that downloads
+// the VolumeImports from the addresses of the allow-list of the config.
+func newVolumeImportReconciler(mgr manager.Manager, config ctrl.Config) (reconcile.Reconciler, error) {
+	allowed, err := parseAllowList(config.VolumeImportAllowList)
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.VolumeImportTimeout
+	if timeout <= 0 {
+		timeout = defaultImportTimeout
+	}
+
+	return &ReconcileVolumeImport{
+		client:     mgr.GetClient(),
+		reader:     mgr.GetAPIReader(),
+		httpClient: newHTTPClient(allowed, timeout),
+		timeout:    timeout,
+		config:     config,
+	}, nil
+}
+
+func add(mgr manager.Manager, r reconcile.Reconciler) error {
+	c, err := controller.New(
+		"volumeimport-controller",
+		mgr,
+		controller.Options{MaxConcurrentReconciles: 2, Reconciler: r})
+	if err != nil {
+		return err
+	}
+
+	// Watch for changes to PVCs with a VolumeImport as data source
+	err = c.Watch(
+		&source.Kind{Type: &corev1.PersistentVolumeClaim{}},
+		&handler.EnqueueRequestForObject{},
+		predicate.Funcs{
+			CreateFunc:  func(e event.CreateEvent) bool { return isImportPVC(e.Object) },
+			UpdateFunc:  func(e event.UpdateEvent) bool { return isImportPVC(e.ObjectNew) },
+			DeleteFunc:  func(e event.DeleteEvent) bool { return isImportPVC(e.Object) },
+			GenericFunc: func(e event.GenericEvent) bool { return isImportPVC(e.Object) },
+		})
+	if err != nil {
+		return fmt.Errorf("failed to watch the changes: %w", err)
+	}
+
+	return nil
+}
+
+// isImportPVC returns whether the object is a PVC with a VolumeImport as data
+// source.
+func isImportPVC(obj client.Object) bool {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+
+	return ok && isVolumeImport(pvc.Spec.DataSourceRef)
+}
+
+// Reconcile populates the volume of the PVC from the source of its
+// VolumeImport:
+//
+//  1. a prime PVC with the StorageClass of the PVC is created in the namespace
+//     of the driver, and provisioned by the external-provisioner
+//  2. the stream of the VolumeImport is written to the image of the prime
+//     PV
+//  3. the prime PV is bound to the PVC, and the prime PVC is deleted
+func (r *ReconcileVolumeImport) Reconcile(ctx context.Context,
+	request reconcile.Request,
+) (reconcile.Result, error) {
+	pvc := &corev1.PersistentVolumeClaim{}
+	err := r.client.Get(ctx, request.NamespacedName, pvc)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// the prime PVC of a deleted PVC is deleted with its owner
+			// reference, but PVCs can not be owned by PVCs of other
+			// namespaces
+			return reconcile.Result{}, r.deletePrimePVC(ctx, request.NamespacedName)
+		}
+
+		return reconcile.Result{}, err
+	}
+	if !isVolumeImport(pvc.Spec.DataSourceRef) {
+		return reconcile.Result{}, nil
+	}
+	if !pvc.GetDeletionTimestamp().IsZero() || pvc.Spec.VolumeName != "" {
+		return reconcile.Result{}, r.deletePrimePVC(ctx, request.NamespacedName)
+	}
+
+	sc, err := r.getStorageClass(ctx, pvc)
+	if err != nil || sc == nil {
+		return reconcile.Result{}, err
+	}
+	if sc.Provisioner != r.config.DriverName {
+		return reconcile.Result{}, nil
+	}
+	if sc.Parameters["encrypted"] == "true" {
+		log.ErrorLogMsg("can not import into PVC %s with encrypted StorageClass %s", request, sc.Name)
+
+		return reconcile.Result{}, nil
+	}
+	if waitsForConsumer(sc) && pvc.Annotations[selectedNodeAnnotation] == "" {
+		// the PVC is reconciled again once the scheduler selected a node
+		return reconcile.Result{}, nil
+	}
+
+	url, err := r.getImportURL(ctx, pvc)
+	if err != nil {
+		log.ErrorLogMsg("failed to get VolumeImport of PVC %s: %v", request, err)
+
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	prime := &corev1.PersistentVolumeClaim{}
+	err = r.client.Get(ctx, primePVCName(r.config.Namespace, pvc), prime)
+	if apierrors.IsNotFound(err) {
+		prime = newPrimePVC(r.config.Namespace, pvc)
+		log.DebugLogMsg("creating prime PVC %s/%s for PVC %s", prime.Namespace, prime.Name, request)
+
+		return reconcile.Result{RequeueAfter: pollInterval}, r.client.Create(ctx, prime)
+	}
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if prime.Annotations[importUIDAnnotation] != string(pvc.UID) {
+		// the prime PVC of a deleted PVC with the same name
+		log.DebugLogMsg("deleting stale prime PVC %s/%s of PVC %s", prime.Namespace, prime.Name, request)
+
+		return reconcile.Result{RequeueAfter: pollInterval}, client.IgnoreNotFound(r.client.Delete(ctx, prime))
+	}
+	if prime.Spec.VolumeName == "" {
+		return reconcile.Result{RequeueAfter: pollInterval}, nil
+	}
+
+	pv := &corev1.PersistentVolume{}
+	err = r.client.Get(ctx, types.NamespacedName{Name: prime.Spec.VolumeName}, pv)
+	if err != nil {
+		return reconcile.Result{}, err
+	}
+	if prime.Annotations[populatedAnnotation] != "true" {
+		err = r.populate(ctx, pv, url)
+		if err != nil {
+			log.ErrorLogMsg("failed to import %s into PVC %s: %v", url, request, err)
+
+			return reconcile.Result{}, err
+		}
+		prime.Annotations[populatedAnnotation] = "true"
+		err = r.client.Update(ctx, prime)
+		if err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	return reconcile.Result{}, r.rebind(ctx, pvc, prime, pv)
+}
+
+// getStorageClass returns the StorageClass of the PVC, nil if the PVC has
+// none.
+func (r *ReconcileVolumeImport) getStorageClass(
+	ctx context.Context,
+	pvc *corev1.PersistentVolumeClaim,
+) (*storagev1.StorageClass, error) {
+	if pvc.Spec.StorageClassName == nil || *pvc.Spec.StorageClassName == "" {
+		return nil, nil
+	}
+	sc := &storagev1.StorageClass{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: *pvc.Spec.StorageClassName}, sc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get StorageClass %s: %w", *pvc.Spec.StorageClassName, err)
+	}
+
+	return sc, nil
+}
+
+// getImportURL returns the URL of the VolumeImport of the PVC.
+func (r *ReconcileVolumeImport) getImportURL(ctx context.Context, pvc *corev1.PersistentVolumeClaim) (string, error) {
+	vi := &unstructured.Unstructured{}
+	vi.SetGroupVersionKind(volumeImportGVK)
+	err := r.reader.Get(ctx, types.NamespacedName{Namespace: pvc.Namespace, Name: pvc.Spec.DataSourceRef.Name}, vi)
+	if err != nil {
+		return "", err
+	}
+
+	return importURL(vi)
+}
+
+// populate writes the stream of the URL to the image of the PV.
+func (r *ReconcileVolumeImport) populate(ctx context.Context, pv *corev1.PersistentVolume, url string) error {
+	cr, err := r.getCredentials(ctx, pv)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, http.NoBody)
+	if err != nil {
+		return err
+	}
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to get %s: %s", url, resp.Status)
+	}
+
+	return rbd.PopulateVolume(ctx, pv.Spec.CSI.VolumeHandle, cr, resp.Body)
+}
+
+// getCredentials returns the credentials of the secret that the PV
+// references, like the persistentvolume controller.
+func (r *ReconcileVolumeImport) getCredentials(
+	ctx context.Context,
+	pv *corev1.PersistentVolume,
+) (*util.Credentials, error) {
+	ref := pv.Spec.CSI.ControllerExpandSecretRef
+	if ref == nil {
+		ref = pv.Spec.CSI.NodeStageSecretRef
+	}
+	if ref == nil {
+		return nil, fmt.Errorf("%w %s", errNoSecret, pv.Name)
+	}
+	secret := &corev1.Secret{}
+	err := r.client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: ref.Namespace}, secret)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret %s in namespace %s: %w", ref.Name, ref.Namespace, err)
+	}
+
+	credentials := map[string]string{}
+	for key, value := range secret.Data {
+		credentials[key] = string(value)
+	}
+
+	return util.NewUserCredentials(credentials)
+}
+
+// rebind binds the populated PV of the prime PVC to the PVC, and deletes the
+// prime PVC. The PV keeps its name, which is the request name of the volume
+// in the journal.
+func (r *ReconcileVolumeImport) rebind(
+	ctx context.Context,
+	pvc, prime *corev1.PersistentVolumeClaim,
+	pv *corev1.PersistentVolume,
+) error {
+	if pv.Spec.ClaimRef == nil || pv.Spec.ClaimRef.UID != pvc.UID {
+		pv.Spec.ClaimRef = claimRef(pvc)
+		log.DebugLogMsg("binding PV %s to PVC %s/%s", pv.Name, pvc.Namespace, pvc.Name)
+		err := r.client.Update(ctx, pv)
+		if err != nil {
+			return fmt.Errorf("failed to bind PV %s: %w", pv.Name, err)
+		}
+	}
+
+	return client.IgnoreNotFound(r.client.Delete(ctx, prime))
+}
+
+// deletePrimePVC deletes the prime PVC of the PVC, if it exists.
+func (r *ReconcileVolumeImport) deletePrimePVC(ctx context.Context, pvc types.NamespacedName) error {
+	prime := &corev1.PersistentVolumeClaim{}
+	err := r.client.Get(ctx, types.NamespacedName{Namespace: r.config.Namespace, Name: primeName(pvc)}, prime)
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if prime.Annotations[importForAnnotation] != pvc.String() {
+		return nil
+	}
+	log.DebugLogMsg("deleting prime PVC %s/%s of PVC %s", prime.Namespace, prime.Name, pvc)
+
+	return client.IgnoreNotFound(r.client.Delete(ctx, prime))
+}
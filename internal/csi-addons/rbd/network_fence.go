@@ -67,7 +67,7 @@ func (fcs *FenceControllerServer) FenceClusterNetwork(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	cr, err := util.NewUserCredentials(util.ClusterSecrets(req.GetSecrets(), req.GetParameters()["clusterID"]))
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
 	}
@@ -96,7 +96,7 @@ func (fcs *FenceControllerServer) UnfenceClusterNetwork(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
-	cr, err := util.NewUserCredentials(req.GetSecrets())
+	cr, err := util.NewUserCredentials(util.ClusterSecrets(req.GetSecrets(), req.GetParameters()["clusterID"]))
 	if err != nil {
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
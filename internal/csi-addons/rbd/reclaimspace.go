@@ -56,17 +56,12 @@ func (rscs *ReclaimSpaceControllerServer) ControllerReclaimSpace(
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
 
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
-	rbdVol, err := rbdutil.GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := rbdutil.GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	if err != nil {
 		return nil, status.Errorf(codes.Aborted, "failed to find volume with ID %q: %s", volumeID, err.Error())
 	}
 	defer rbdVol.Destroy()
+	defer cr.DeleteCredentials()
 
 	err = rbdVol.Sparsify()
 	if err != nil {
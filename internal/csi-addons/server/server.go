@@ -17,12 +17,15 @@ limitations under the License.
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net"
 	"net/url"
 	"os"
 
+	"github.com/csi-addons/spec/lib/go/identity"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"google.golang.org/grpc"
 
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
@@ -49,6 +52,8 @@ type CSIAddonsServer struct {
 	// state of the CSIAddonsServer
 	server   *grpc.Server
 	services []CSIAddonsService
+	// health is the health service, nil without introspection
+	health *csicommon.HealthServer
 }
 
 // NewCSIAddonsServer create a new CSIAddonsServer on the given endpoint. The
@@ -84,14 +89,22 @@ func (cas *CSIAddonsServer) RegisterService(svc CSIAddonsService) {
 
 // Start creates the internal gRPC server, and registers the CSIAddonsServices.
 // The internal gRPC server is started in it's own go-routine when no error is
-// returned.
-func (cas *CSIAddonsServer) Start() error {
+// returned. When withMetrics is set, the gRPC server metrics are collected for
+// all services, see csicommon.EnableGRPCMetrics(). The health and reflection
+// services are added when csicommon.EnableIntrospection() was called, the
+// health service reports the services as serving while ready returns true.
+func (cas *CSIAddonsServer) Start(withMetrics bool, ready csicommon.ReadinessFunc) error {
 	// create the gRPC server and register services
-	cas.server = grpc.NewServer(csicommon.NewMiddlewareServerOption(false))
+	cas.server = grpc.NewServer(csicommon.NewMiddlewareServerOption(withMetrics))
 
 	for _, svc := range cas.services {
 		svc.RegisterService(cas.server)
 	}
+	cas.health = csicommon.RegisterIntrospection(cas.server, ready)
+
+	if withMetrics {
+		grpc_prometheus.Register(cas.server)
+	}
 
 	// setup the UNIX domain socket
 	if e := os.Remove(cas.path); e != nil && !os.IsNotExist(e) {
@@ -128,5 +141,21 @@ func (cas *CSIAddonsServer) Stop() {
 		return
 	}
 
+	if cas.health != nil {
+		cas.health.Shutdown()
+	}
 	cas.server.GracefulStop()
 }
+
+// ProbeReadiness returns a csicommon.ReadinessFunc that calls Probe of the
+// CSI-Addons identity server.
+func ProbeReadiness(is identity.IdentityServer) csicommon.ReadinessFunc {
+	return func(ctx context.Context) (bool, error) {
+		resp, err := is.Probe(ctx, &identity.ProbeRequest{})
+		if err != nil {
+			return false, err
+		}
+
+		return resp.GetReady().GetValue(), nil
+	}
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// auditStdout is the value for EnableAuditLog() to write the audit log to
+// stdout instead of a file.
+const auditStdout = "stdout"
+
+// auditLog is used by the auditLogger interceptor, records are only written
+// after EnableAuditLog() was called.
+var auditLog *auditWriter
+
+// auditWriter writes audit records as JSON, one record per line.
+type auditWriter struct {
+	mux     sync.Mutex
+	encoder *json.Encoder
+}
+
+// auditRecord describes a single volume lifecycle operation.
+type auditRecord struct {
+	Time      string          `json:"time"`
+	Operation string          `json:"operation"`
+	RequestID string          `json:"requestID,omitempty"`
+	VolumeID  string          `json:"volumeID,omitempty"`
+	Request   json.RawMessage `json:"request"`
+	Code      string          `json:"code"`
+	Error     string          `json:"error,omitempty"`
+	Duration  float64         `json:"durationSeconds"`
+}
+
+// EnableAuditLog makes the gRPC servers write an audit record for each
+// CreateVolume, DeleteVolume, CreateSnapshot, DeleteSnapshot and
+// ControllerExpandVolume procedure. The records are appended to the file at
+// auditPath, or written to stdout when auditPath is "stdout". This needs to
+// be called before the gRPC servers are started.
+func EnableAuditLog(auditPath string) error {
+	if auditPath == auditStdout {
+		auditLog = newAuditWriter(os.Stdout)
+
+		return nil
+	}
+
+	// #nosec:G304, the path is passed by the administrator.
+	file, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %q: %w", auditPath, err)
+	}
+	auditLog = newAuditWriter(file)
+
+	return nil
+}
+
+func newAuditWriter(w io.Writer) *auditWriter {
+	return &auditWriter{encoder: json.NewEncoder(w)}
+}
+
+func (aw *auditWriter) write(record *auditRecord) error {
+	aw.mux.Lock()
+	defer aw.mux.Unlock()
+
+	return aw.encoder.Encode(record)
+}
+
+// isAudited returns true for the requests of the volume lifecycle operations
+// that are recorded in the audit log.
+func isAudited(req interface{}) bool {
+	switch req.(type) {
+	case *csi.CreateVolumeRequest,
+		*csi.DeleteVolumeRequest,
+		*csi.CreateSnapshotRequest,
+		*csi.DeleteSnapshotRequest,
+		*csi.ControllerExpandVolumeRequest:
+		return true
+	}
+
+	return false
+}
+
+// auditVolumeID returns the ID of the volume or snapshot that the operation
+// is about, for a CreateVolume or CreateSnapshot procedure it is only known
+// from a successful response.
+func auditVolumeID(req, resp interface{}) string {
+	switch r := resp.(type) {
+	case *csi.CreateVolumeResponse:
+		return r.GetVolume().GetVolumeId()
+	case *csi.CreateSnapshotResponse:
+		return r.GetSnapshot().GetSnapshotId()
+	}
+
+	switch r := req.(type) {
+	case interface{ GetVolumeId() string }:
+		return r.GetVolumeId()
+	case *csi.DeleteSnapshotRequest:
+		return r.GetSnapshotId()
+	}
+
+	return ""
+}
+
+// auditRequest returns the request without secrets as JSON.
+func auditRequest(req interface{}) json.RawMessage {
+	stripped := protosanitizer.StripSecrets(req).String()
+	if json.Valid([]byte(stripped)) {
+		return json.RawMessage(stripped)
+	}
+
+	// protosanitizer returns a description of the error if the request can
+	// not be converted, record that as a string
+	b, err := json.Marshal(stripped)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+
+	return b
+}
+
+// auditLogger writes an audit record with the request (stripped of secrets)
+// and the result of the volume lifecycle operations, see isAudited().
+func auditLogger(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if auditLog == nil || !isAudited(req) {
+		return handler(ctx, req)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	record := &auditRecord{
+		Time:      start.UTC().Format(time.RFC3339Nano),
+		Operation: path.Base(info.FullMethod),
+		VolumeID:  auditVolumeID(req, resp),
+		Request:   auditRequest(req),
+		Code:      status.Code(err).String(),
+		Duration:  time.Since(start).Seconds(),
+	}
+	if reqID, ok := ctx.Value(log.ReqID).(string); ok {
+		record.RequestID = reqID
+	}
+	if err != nil {
+		record.Error = status.Convert(err).Message()
+	}
+
+	if aErr := auditLog.write(record); aErr != nil {
+		log.ErrorLog(ctx, "failed to write audit record: %v", aErr)
+	}
+
+	return resp, err
+}
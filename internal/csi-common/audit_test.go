@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsAudited(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, isAudited(&csi.CreateVolumeRequest{}))
+	assert.True(t, isAudited(&csi.DeleteVolumeRequest{}))
+	assert.True(t, isAudited(&csi.CreateSnapshotRequest{}))
+	assert.True(t, isAudited(&csi.DeleteSnapshotRequest{}))
+	assert.True(t, isAudited(&csi.ControllerExpandVolumeRequest{}))
+	assert.False(t, isAudited(&csi.NodeStageVolumeRequest{}))
+	assert.False(t, isAudited(&csi.ProbeRequest{}))
+}
+
+func TestAuditVolumeID(t *testing.T) {
+	t.Parallel()
+
+	resp := &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: "vol-1"}}
+	assert.Equal(t, "vol-1", auditVolumeID(&csi.CreateVolumeRequest{Name: "pvc-1"}, resp))
+	assert.Equal(t, "", auditVolumeID(&csi.CreateVolumeRequest{Name: "pvc-1"}, nil))
+	assert.Equal(t, "vol-2", auditVolumeID(&csi.DeleteVolumeRequest{VolumeId: "vol-2"}, nil))
+	assert.Equal(t, "snap-1", auditVolumeID(&csi.DeleteSnapshotRequest{SnapshotId: "snap-1"}, nil))
+}
+
+func TestAuditWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	aw := newAuditWriter(&buf)
+	req := &csi.CreateVolumeRequest{
+		Name:       "pvc-1",
+		Parameters: map[string]string{"pool": "replicapool"},
+		Secrets:    map[string]string{"userKey": "secret-key"},
+	}
+	err := aw.write(&auditRecord{
+		Operation: "CreateVolume",
+		Request:   auditRequest(req),
+		Code:      "OK",
+	})
+	require.NoError(t, err)
+
+	assert.NotContains(t, buf.String(), "secret-key")
+
+	record := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "CreateVolume", record["operation"])
+	request, ok := record["request"].(map[string]interface{})
+	require.True(t, ok)
+	assert.Equal(t, "pvc-1", request["name"])
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/metadata"
+)
+
+// correlationIDHeader is the gRPC metadata key that callers can use to pass
+// a correlation ID for the procedure.
+const correlationIDHeader = "x-correlation-id"
+
+// getCorrelationID returns the correlation ID for the request. It is taken
+// from (in order):
+//   - the x-correlation-id gRPC metadata of the caller
+//   - the volume context, for procedures on a volume that was created by
+//     CreateVolume (NodeStageVolume, NodePublishVolume, ...)
+//   - the name of a CreateVolume or CreateSnapshot request, which is the name
+//     of the PV or VolumeSnapshotContent and stays the same on retries
+//
+// A new ID is generated for other requests.
+func getCorrelationID(ctx context.Context, req interface{}) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(correlationIDHeader); len(values) != 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	if r, ok := req.(interface{ GetVolumeContext() map[string]string }); ok {
+		if id := r.GetVolumeContext()[util.CorrelationIDVolumeContextKey]; id != "" {
+			return id
+		}
+	}
+
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		return r.GetName()
+	case *csi.CreateSnapshotRequest:
+		return r.GetName()
+	}
+
+	return uuid.New().String()
+}
+
+// setCorrelationID adds the correlation ID to the volume context of a
+// CreateVolume response, so that the procedures on the node log the same
+// correlation ID.
+func setCorrelationID(resp interface{}, correlationID string) {
+	r, ok := resp.(*csi.CreateVolumeResponse)
+	if !ok || r.GetVolume() == nil {
+		return
+	}
+
+	if r.Volume.VolumeContext == nil {
+		r.Volume.VolumeContext = make(map[string]string)
+	}
+	r.Volume.VolumeContext[util.CorrelationIDVolumeContextKey] = correlationID
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGetCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	volCtx := map[string]string{util.CorrelationIDVolumeContextKey: "pvc-1"}
+
+	// the metadata of the caller has priority
+	mdCtx := metadata.NewIncomingContext(ctx, metadata.Pairs(correlationIDHeader, "from-caller"))
+	assert.Equal(t, "from-caller", getCorrelationID(mdCtx, &csi.NodeStageVolumeRequest{VolumeContext: volCtx}))
+
+	assert.Equal(t, "pvc-1", getCorrelationID(ctx, &csi.NodeStageVolumeRequest{VolumeContext: volCtx}))
+	assert.Equal(t, "pvc-1", getCorrelationID(ctx, &csi.NodePublishVolumeRequest{VolumeContext: volCtx}))
+	assert.Equal(t, "pvc-2", getCorrelationID(ctx, &csi.CreateVolumeRequest{Name: "pvc-2"}))
+	assert.Equal(t, "snapcontent-1", getCorrelationID(ctx, &csi.CreateSnapshotRequest{Name: "snapcontent-1"}))
+
+	// a new ID is generated for each request without correlation ID
+	id := getCorrelationID(ctx, &csi.DeleteVolumeRequest{VolumeId: "vol-1"})
+	assert.NotEmpty(t, id)
+	assert.NotEqual(t, id, getCorrelationID(ctx, &csi.DeleteVolumeRequest{VolumeId: "vol-1"}))
+}
+
+func TestSetCorrelationID(t *testing.T) {
+	t.Parallel()
+
+	resp := &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: "vol-1"}}
+	setCorrelationID(resp, "pvc-1")
+	assert.Equal(t, "pvc-1", resp.GetVolume().GetVolumeContext()[util.CorrelationIDVolumeContextKey])
+
+	// other responses are not modified
+	setCorrelationID(&csi.DeleteVolumeResponse{}, "pvc-1")
+	setCorrelationID(&csi.CreateVolumeResponse{}, "pvc-1")
+}
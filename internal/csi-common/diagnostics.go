@@ -0,0 +1,229 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// diagnosticsDir is set by EnableDiagnostics().
+var diagnosticsDir string
+
+const (
+	// diagnosticsMaxBundles is the number of diagnostics bundles that are
+	// kept, older bundles are removed when a new bundle is written.
+	diagnosticsMaxBundles = 10
+	// diagnosticsMaxBundleSize is the size that a diagnostics bundle is
+	// truncated to, the stacks of many go-routines can be large.
+	diagnosticsMaxBundleSize = 4 * 1024 * 1024
+	// diagnosticsMaxTotalSize is the size of all diagnostics bundles
+	// together, older bundles are removed to stay below it.
+	diagnosticsMaxTotalSize = 16 * 1024 * 1024
+	// diagnosticsBundlePattern matches the names of the diagnostics bundles,
+	// which sort by the time they were written.
+	diagnosticsBundlePattern = "panic-*.txt"
+)
+
+// inflightTracking is set when the in-flight procedures are tracked, for the
+// diagnostics bundles or the "inflight" admin command.
+var inflightTracking bool
+
+// EnableDiagnostics makes the gRPC servers write a diagnostics bundle to the
+// directory when a procedure panics. The bundle contains the stack of the
+// panic, the procedures that were in-flight, fingerprints of the
+// configuration files and the stacks of all go-routines. This needs to be
+// called before the gRPC servers are started.
+func EnableDiagnostics(dir string) error {
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return fmt.Errorf("failed to create diagnostics directory %q: %w", dir, err)
+	}
+	diagnosticsDir = dir
+	inflightTracking = true
+
+	return nil
+}
+
+// RegisterInflightCommand registers the "inflight" command of the admin
+// socket, which lists the gRPC procedures that are in progress, the longest
+// running first. This needs to be called before the gRPC servers are started.
+func RegisterInflightCommand() {
+	inflightTracking = true
+	util.RegisterAdminCommand("inflight", util.AdminCommand{
+		Usage:    "list the gRPC procedures that are in progress, the longest running first",
+		ReadOnly: true,
+		Run: func(_ context.Context, _ url.Values) (string, error) {
+			buf := &bytes.Buffer{}
+			writeInflight(buf, time.Now())
+
+			return buf.String(), nil
+		},
+	})
+}
+
+// inflightProcedure is a gRPC procedure that is in progress.
+type inflightProcedure struct {
+	method string
+	reqID  string
+	start  time.Time
+}
+
+// inflight tracks the procedures that are in progress while inflightTracking
+// is set.
+var inflight = struct {
+	sync.Mutex
+	next       uint64
+	procedures map[uint64]inflightProcedure
+}{
+	procedures: make(map[uint64]inflightProcedure),
+}
+
+// trackInflight records the procedure as in-flight until the returned
+// function is called.
+func trackInflight(method, reqID string) func() {
+	inflight.Lock()
+	id := inflight.next
+	inflight.next++
+	inflight.procedures[id] = inflightProcedure{method: method, reqID: reqID, start: time.Now()}
+	inflight.Unlock()
+
+	return func() {
+		inflight.Lock()
+		delete(inflight.procedures, id)
+		inflight.Unlock()
+	}
+}
+
+// writeInflight writes a line for each in-flight procedure, the longest
+// running first.
+func writeInflight(w io.Writer, now time.Time) {
+	inflight.Lock()
+	procedures := make([]inflightProcedure, 0, len(inflight.procedures))
+	for _, p := range inflight.procedures {
+		procedures = append(procedures, p)
+	}
+	inflight.Unlock()
+	sort.Slice(procedures, func(i, j int) bool { return procedures[i].start.Before(procedures[j].start) })
+	for _, p := range procedures {
+		fmt.Fprintf(w, "%s req-id=%q running for %s\n", p.method, p.reqID, now.Sub(p.start))
+	}
+}
+
+// diagnosticsConfigFiles are the configuration files that a fingerprint is
+// added for to the diagnostics bundle, so that it can be checked which
+// configuration the driver had when it panicked, without including the
+// contents.
+var diagnosticsConfigFiles = []string{util.CsiConfigFile, util.CephConfigPath}
+
+// writeDiagnostics writes a diagnostics bundle for the panic r that occurred
+// in the method, with the stack of the panicking go-routine. The path of the
+// bundle is returned. Old bundles are removed, see pruneDiagnostics().
+func writeDiagnostics(method string, r interface{}, stack []byte) (string, error) {
+	now := time.Now()
+	buf := &bytes.Buffer{}
+
+	fmt.Fprintf(buf, "panic: %v\n", r)
+	fmt.Fprintf(buf, "method: %s\n", method)
+	fmt.Fprintf(buf, "time: %s\n", now.UTC().Format(time.RFC3339Nano))
+	fmt.Fprintf(buf, "version: %s (git commit %s)\n", util.DriverVersion, util.GitCommit)
+	fmt.Fprintf(buf, "command-line: %s\n", log.Redact(strings.Join(os.Args, " ")))
+
+	fmt.Fprintf(buf, "\n== stack of the panic ==\n%s\n", stack)
+
+	fmt.Fprintf(buf, "== in-flight procedures ==\n")
+	writeInflight(buf, now)
+
+	fmt.Fprintf(buf, "\n== configuration fingerprints ==\n")
+	for _, file := range diagnosticsConfigFiles {
+		content, err := os.ReadFile(file) // #nosec:G304, only well-known configuration files are read.
+		if err != nil {
+			fmt.Fprintf(buf, "%s: %v\n", file, err)
+
+			continue
+		}
+		fmt.Fprintf(buf, "%s: sha256:%x (%d bytes)\n", file, sha256.Sum256(content), len(content))
+	}
+
+	fmt.Fprintf(buf, "\n== go-routines ==\n")
+	err := pprof.Lookup("goroutine").WriteTo(buf, 2)
+	if err != nil {
+		fmt.Fprintf(buf, "failed to get the stacks of the go-routines: %v\n", err)
+	}
+
+	if buf.Len() > diagnosticsMaxBundleSize {
+		buf.Truncate(diagnosticsMaxBundleSize)
+		fmt.Fprintf(buf, "\n== truncated to %d bytes ==\n", diagnosticsMaxBundleSize)
+	}
+
+	path := filepath.Join(diagnosticsDir, fmt.Sprintf("panic-%s.txt", now.UTC().Format("20060102T150405.000000000")))
+	err = os.WriteFile(path, buf.Bytes(), 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to write diagnostics bundle %q: %w", path, err)
+	}
+
+	err = pruneDiagnostics(diagnosticsDir)
+	if err != nil {
+		log.WarningLogMsg("failed to remove old diagnostics bundles: %v", err)
+	}
+
+	return path, nil
+}
+
+// pruneDiagnostics removes the oldest diagnostics bundles in the directory,
+// so that at most diagnosticsMaxBundles are kept, and their total size does
+// not exceed diagnosticsMaxTotalSize. The newest bundle is always kept.
+func pruneDiagnostics(dir string) error {
+	bundles, err := filepath.Glob(filepath.Join(dir, diagnosticsBundlePattern))
+	if err != nil {
+		return err
+	}
+	// newest first
+	sort.Sort(sort.Reverse(sort.StringSlice(bundles)))
+
+	var total int64
+	for i, bundle := range bundles {
+		info, err := os.Stat(bundle)
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		if i == 0 || (i < diagnosticsMaxBundles && total <= diagnosticsMaxTotalSize) {
+			continue
+		}
+		err = os.Remove(bundle)
+		if err != nil {
+			return fmt.Errorf("failed to remove diagnostics bundle %q: %w", bundle, err)
+		}
+	}
+
+	return nil
+}
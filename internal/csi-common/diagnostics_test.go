@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	err := EnableDiagnostics(t.TempDir())
+	if err != nil {
+		t.Fatalf("EnableDiagnostics() failed: %v", err)
+	}
+
+	done := trackInflight("/csi.v1.Node/NodeStageVolume", "csi-vol-1")
+	path, err := writeDiagnostics("/csi.v1.Node/NodeStageVolume", "runtime error", []byte("goroutine 1 [running]"))
+	done()
+	if err != nil {
+		t.Fatalf("writeDiagnostics() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path) // #nosec:G304, path of the bundle in the test directory.
+	if err != nil {
+		t.Fatalf("failed to read diagnostics bundle: %v", err)
+	}
+	for _, expected := range []string{
+		"panic: runtime error",
+		"goroutine 1 [running]",
+		`/csi.v1.Node/NodeStageVolume req-id="csi-vol-1"`,
+		"== configuration fingerprints ==",
+		"== go-routines ==",
+	} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("diagnostics bundle does not contain %q", expected)
+		}
+	}
+
+	inflight.Lock()
+	defer inflight.Unlock()
+	if len(inflight.procedures) != 0 {
+		t.Errorf("%d procedures still in-flight", len(inflight.procedures))
+	}
+}
+
+func TestPruneDiagnostics(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	bundle := func(i int) string {
+		return filepath.Join(dir, fmt.Sprintf("panic-20220301T1200%02d.000000000.txt", i))
+	}
+	for i := 0; i < diagnosticsMaxBundles+2; i++ {
+		err := os.WriteFile(bundle(i), []byte("panic"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := pruneDiagnostics(dir)
+	if err != nil {
+		t.Fatalf("pruneDiagnostics() failed: %v", err)
+	}
+	for i := 0; i < diagnosticsMaxBundles+2; i++ {
+		_, err = os.Stat(bundle(i))
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf("bundle %d kept = %v, want %v", i, kept, i >= 2)
+		}
+	}
+
+	// the newest bundles that fit in the total size are kept
+	for i := 2; i < diagnosticsMaxBundles+2; i++ {
+		err = os.Truncate(bundle(i), diagnosticsMaxTotalSize/3+1)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = pruneDiagnostics(dir)
+	if err != nil {
+		t.Fatalf("pruneDiagnostics() failed: %v", err)
+	}
+	bundles, err := filepath.Glob(filepath.Join(dir, diagnosticsBundlePattern))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 2 || bundles[1] != bundle(diagnosticsMaxBundles+1) {
+		t.Errorf("kept bundles %v, want the 2 newest", bundles)
+	}
+}
+
+// TestWriteInflight is not parallel, TestWriteDiagnostics checks that no
+// procedures are in-flight.
+func TestWriteInflight(t *testing.T) {
+	first := trackInflight("/csi.v1.Controller/CreateVolume", "pvc-1")
+	time.Sleep(time.Millisecond)
+	second := trackInflight("/csi.v1.Controller/DeleteVolume", "csi-vol-2")
+	buf := &bytes.Buffer{}
+	writeInflight(buf, time.Now())
+	first()
+	second()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("writeInflight() wrote %q, want 2 lines", buf.String())
+	}
+	if !strings.HasPrefix(lines[0], `/csi.v1.Controller/CreateVolume req-id="pvc-1" running for `) {
+		t.Errorf("first line %q is not the longest running procedure", lines[0])
+	}
+
+	buf.Reset()
+	writeInflight(buf, time.Now())
+	if buf.Len() != 0 {
+		t.Errorf("writeInflight() without procedures wrote %q", buf.String())
+	}
+}
@@ -116,3 +116,13 @@ func (d *CSIDriver) AddVolumeCapabilityAccessModes(
 func (d *CSIDriver) GetVolumeCapabilityAccessModes() []*csi.VolumeCapability_AccessMode {
 	return d.vc
 }
+
+// GetNodeID returns the ID of the node.
+func (d *CSIDriver) GetNodeID() string {
+	return d.nodeID
+}
+
+// GetTopology returns the topology that the nodeserver advertises.
+func (d *CSIDriver) GetTopology() map[string]string {
+	return d.topology
+}
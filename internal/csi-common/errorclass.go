@@ -0,0 +1,87 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Classes of the results of gRPC procedures, see errorClass().
+const (
+	classSuccess   = "success"
+	classRetryable = "retryable"
+	classTerminal  = "terminal"
+	classUserError = "user_error"
+)
+
+var procedureResults = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "csi",
+		Name:      "procedure_results_total",
+		Help:      "Number of completed gRPC procedures by class of the result (success, retryable, terminal, user_error)",
+	},
+	[]string{"method", "class"},
+)
+
+func init() {
+	prometheus.MustRegister(procedureResults)
+}
+
+// errorClass returns the class of the error that a gRPC procedure returned:
+//
+//   - retryable errors are temporary, the sidecars retry the procedure and it
+//     is expected to succeed eventually (a volume that is locked by another
+//     operation, a clone that is in progress, or a cluster that is busy),
+//   - user errors are caused by the request, like invalid parameters in the
+//     StorageClass, missing or rejected credentials, or a source volume that
+//     does not exist, these do not succeed without changes by the user,
+//   - terminal errors are all other failures, these usually point to a
+//     problem with the Ceph cluster or the driver.
+func errorClass(err error) string {
+	if err == nil {
+		return classSuccess
+	}
+
+	switch status.Code(err) {
+	case codes.Aborted, codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Canceled:
+		return classRetryable
+	case codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.OutOfRange,
+		codes.FailedPrecondition, codes.PermissionDenied, codes.Unauthenticated:
+		return classUserError
+	}
+
+	return classTerminal
+}
+
+// errorClassifier counts the results of the gRPC procedures by their class,
+// see errorClass().
+func errorClassifier(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	procedureResults.WithLabelValues(info.FullMethod, errorClass(err)).Inc()
+
+	return resp, err
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{nil, classSuccess},
+		{status.Error(codes.Aborted, "an operation with the given Volume ID already exists"), classRetryable},
+		{status.Error(codes.Unavailable, "cluster busy"), classRetryable},
+		{status.Error(codes.InvalidArgument, "missing required parameter pool"), classUserError},
+		{status.Error(codes.NotFound, "source volume not found"), classUserError},
+		{status.Error(codes.Internal, "rados: ret=-110"), classTerminal},
+		{errors.New("not a gRPC status"), classTerminal},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("errorClass(%v) = %q, want %q", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorClassifier(t *testing.T) {
+	t.Parallel()
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/csi.v1.Controller/TestErrorClassifier"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.InvalidArgument, "bad parameter")
+	}
+
+	_, err := errorClassifier(context.TODO(), nil, info, handler)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("errorClassifier() returned %v", err)
+	}
+	if v := testutil.ToFloat64(procedureResults.WithLabelValues(info.FullMethod, classUserError)); v != 1 {
+		t.Errorf("procedure_results_total = %v, want 1", v)
+	}
+}
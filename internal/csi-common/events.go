@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// eventRecorder is used by the eventEmitter interceptor, Events are only
+	// emitted after EnableEvents() was called.
+	eventRecorder *k8s.EventRecorder
+	// eventNode is the name of the Node that Events about NodeStageVolume
+	// failures are emitted on.
+	eventNode string
+)
+
+// EnableEvents makes the gRPC servers emit Kubernetes Events on the PVC (for
+// CreateVolume), the Node (for NodeStageVolume) and the Pod (for
+// NodePublishVolume) when a procedure fails with an actionable error, see
+// eventReason(). The component is the source of the Events, usually the name
+// of the driver, the nodeID is the name of the Node that the plugin runs on.
+// This needs to be called before the gRPC servers are started.
+func EnableEvents(component, nodeID string) error {
+	recorder, err := k8s.NewEventRecorder(component)
+	if err != nil {
+		return err
+	}
+	eventRecorder = recorder
+	eventNode = nodeID
+
+	return nil
+}
+
+// eventReason returns the reason for an Event about the failure, or an empty
+// string if the failure is not one that the user can act on. The errors from
+// Ceph and the KMS are mostly passed as message in the gRPC status, so they
+// are matched on their text.
+func eventReason(err error) string {
+	msg := strings.ToLower(status.Convert(err).Message())
+	contains := func(substrs ...string) bool {
+		for _, s := range substrs {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case status.Code(err) == codes.Aborted && contains("in progress", "pending"):
+		return k8s.ReasonClonePending
+	case contains("quota exceeded", "edquot"):
+		return k8s.ReasonQuotaExceeded
+	case contains("no space left", "enospc", "pool full"):
+		return k8s.ReasonPoolFull
+	case contains("kms", "passphrase", "dek") &&
+		contains("connection refused", "dial tcp", "i/o timeout", "no such host", "deadline exceeded"):
+		return k8s.ReasonKMSUnreachable
+	case contains("mount error", "ceph-fuse failed"):
+		return k8s.ReasonMountFailed
+	}
+
+	return ""
+}
+
+// eventEmitter emits a Warning Event when a CreateVolume, NodeStageVolume or
+// NodePublishVolume procedure fails with an actionable error. Other failures
+// are reported by the sidecars already. NodeStageVolume requests do not carry
+// the Pod that the volume is staged for, so the Event is emitted on the Node.
+func eventEmitter(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil || eventRecorder == nil {
+		return resp, err
+	}
+
+	reason := eventReason(err)
+	if reason == "" {
+		return resp, err
+	}
+
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		namespace, name := k8s.GetPVC(r.GetParameters())
+		eventRecorder.Warning("PersistentVolumeClaim", namespace, name, reason, status.Convert(err).Message())
+	case *csi.NodeStageVolumeRequest:
+		eventRecorder.Warning("Node", "", eventNode, reason,
+			fmt.Sprintf("failed to stage volume %s: %s", r.GetVolumeId(), status.Convert(err).Message()))
+	case *csi.NodePublishVolumeRequest:
+		namespace, name := k8s.GetPod(r.GetVolumeContext())
+		eventRecorder.Warning("Pod", namespace, name, reason, status.Convert(err).Message())
+	}
+
+	return resp, err
+}
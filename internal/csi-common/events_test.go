@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestEventReason(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{
+			name:   "flatten in progress",
+			err:    status.Error(codes.Aborted, "flatten in progress"),
+			reason: k8s.ReasonClonePending,
+		},
+		{
+			name:   "cephfs clone pending",
+			err:    status.Error(codes.Aborted, "clone from snapshot is pending"),
+			reason: k8s.ReasonClonePending,
+		},
+		{
+			name:   "pool full",
+			err:    status.Error(codes.Internal, "failed to create rbd image: rbd: ret=-28, No space left on device"),
+			reason: k8s.ReasonPoolFull,
+		},
+		{
+			name:   "quota exceeded",
+			err:    status.Error(codes.Internal, "rados: ret=-122, Disk quota exceeded"),
+			reason: k8s.ReasonQuotaExceeded,
+		},
+		{
+			name: "KMS unreachable",
+			err: status.Error(codes.Internal,
+				"failed to save encryption passphrase: dial tcp 10.0.0.1:8200: connect: connection refused"),
+			reason: k8s.ReasonKMSUnreachable,
+		},
+		{
+			name:   "cephfs mount permission denied",
+			err:    status.Error(codes.Internal, "an error (exit status 32) occurred: mount error 13 = Permission denied"),
+			reason: k8s.ReasonMountFailed,
+		},
+		{
+			name:   "not actionable",
+			err:    status.Error(codes.Internal, "failed to connect to the cluster: connection refused"),
+			reason: "",
+		},
+		{
+			name:   "aborted for other operation in progress",
+			err:    status.Error(codes.Internal, "an operation with the given Volume ID already exists"),
+			reason: "",
+		},
+		{
+			name:   "plain error",
+			err:    errors.New("no space left on device"),
+			reason: k8s.ReasonPoolFull,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.reason, eventReason(tt.err))
+		})
+	}
+}
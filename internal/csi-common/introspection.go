@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// introspection is set by EnableIntrospection().
+var introspection bool
+
+// EnableIntrospection makes the gRPC servers of the driver serve the
+// grpc.health.v1 and reflection services, so that generic tools like grpcurl
+// and gRPC health probes can be used on the CSI and CSI-Addons sockets. This
+// needs to be called before the gRPC servers are started.
+func EnableIntrospection() {
+	introspection = true
+}
+
+// ReadinessFunc returns whether the driver is ready to serve requests.
+type ReadinessFunc func(ctx context.Context) (bool, error)
+
+// ProbeReadiness returns a ReadinessFunc that calls Probe of the identity
+// server. A Probe response without readiness means that the driver is ready,
+// without identity server the driver is always ready.
+func ProbeReadiness(is csi.IdentityServer) ReadinessFunc {
+	return func(ctx context.Context) (bool, error) {
+		if is == nil {
+			return true, nil
+		}
+		resp, err := is.Probe(ctx, &csi.ProbeRequest{})
+		if err != nil {
+			return false, err
+		}
+
+		return resp.GetReady() == nil || resp.GetReady().GetValue(), nil
+	}
+}
+
+// HealthServer is the grpc.health.v1 service of a gRPC server. The serving
+// status of the services is updated by the readiness on each Check, Watch
+// streams get the status of the last Check. After Shutdown() the services are
+// reported as not serving.
+type HealthServer struct {
+	*health.Server
+	ready    ReadinessFunc
+	services []string
+}
+
+// newHealthServer returns a HealthServer for the services (and the server as
+// a whole, the empty service name), with the status of the current readiness.
+func newHealthServer(ready ReadinessFunc, services []string) *HealthServer {
+	hs := &HealthServer{
+		Server:   health.NewServer(),
+		ready:    ready,
+		services: append([]string{""}, services...),
+	}
+	hs.update(context.Background())
+
+	return hs
+}
+
+// Check updates the serving status by the readiness, and returns the status
+// of the service in the request.
+func (hs *HealthServer) Check(
+	ctx context.Context,
+	req *healthpb.HealthCheckRequest,
+) (*healthpb.HealthCheckResponse, error) {
+	hs.update(ctx)
+
+	return hs.Server.Check(ctx, req)
+}
+
+// update sets the serving status of the services by the readiness, the
+// status is not changed anymore after Shutdown().
+func (hs *HealthServer) update(ctx context.Context) {
+	status := healthpb.HealthCheckResponse_SERVING
+	ready, err := hs.ready(ctx)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to check the readiness: %v", err)
+	}
+	if err != nil || !ready {
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	for _, name := range hs.services {
+		hs.SetServingStatus(name, status)
+	}
+}
+
+// RegisterIntrospection registers the health and reflection services on the
+// server when EnableIntrospection() was called, and returns the health
+// service, or nil. It needs to be called after all other services have been
+// registered, the health service reports each of them as serving while the
+// driver is ready. The health service needs to be shut down before the
+// server is stopped.
+func RegisterIntrospection(server *grpc.Server, ready ReadinessFunc) *HealthServer {
+	if !introspection {
+		return nil
+	}
+
+	services := make([]string, 0, len(server.GetServiceInfo()))
+	for name := range server.GetServiceInfo() {
+		services = append(services, name)
+	}
+	hs := newHealthServer(ready, services)
+	healthpb.RegisterHealthServer(server, hs)
+
+	reflection.Register(server)
+
+	return hs
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// TestRegisterIntrospection is not parallel, it enables introspection for the
+// whole package.
+func TestRegisterIntrospection(t *testing.T) {
+	EnableIntrospection()
+	defer func() { introspection = false }()
+
+	server := grpc.NewServer()
+	csi.RegisterIdentityServer(server, &DefaultIdentityServer{})
+	hs := RegisterIntrospection(server, ProbeReadiness(&DefaultIdentityServer{}))
+	if hs == nil {
+		t.Fatal("RegisterIntrospection() did not return the health service")
+	}
+
+	services := server.GetServiceInfo()
+	for _, name := range []string{
+		"csi.v1.Identity",
+		"grpc.health.v1.Health",
+		"grpc.reflection.v1alpha.ServerReflection",
+	} {
+		if _, ok := services[name]; !ok {
+			t.Errorf("service %q is not registered", name)
+		}
+	}
+}
+
+func TestHealthServer(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ready    bool
+		readyErr error
+	)
+	hs := newHealthServer(func(context.Context) (bool, error) {
+		return ready, readyErr
+	}, []string{"csi.v1.Identity"})
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		resp, err := hs.Check(context.TODO(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("Check(%q) failed: %v", service, err)
+		}
+
+		return resp.GetStatus()
+	}
+
+	if status := check(""); status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status while not ready = %v, want NOT_SERVING", status)
+	}
+	ready = true
+	if status := check("csi.v1.Identity"); status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("status while ready = %v, want SERVING", status)
+	}
+	readyErr = errors.New("probe failed")
+	if status := check(""); status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status when the readiness fails = %v, want NOT_SERVING", status)
+	}
+	readyErr = nil
+	hs.Shutdown()
+	if status := check(""); status != healthpb.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("status after Shutdown() = %v, want NOT_SERVING", status)
+	}
+}
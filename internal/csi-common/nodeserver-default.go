@@ -33,6 +33,9 @@ type DefaultNodeServer struct {
 	Driver  *CSIDriver
 	Type    string
 	Mounter mount.Interface
+	// StatsCache caches the results of NodeGetVolumeStats, it is nil when
+	// the cache is not enabled
+	StatsCache *VolumeStatsCache
 }
 
 // NodeExpandVolume returns unimplemented response.
@@ -17,11 +17,16 @@ limitations under the License.
 package csicommon
 
 import (
+	"errors"
+	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 
@@ -62,12 +67,44 @@ func NewNonBlockingGRPCServer() NonBlockingGRPCServer {
 type nonBlockingGRPCServer struct {
 	wg     sync.WaitGroup
 	server *grpc.Server
+	// health is the health service, nil without introspection
+	health *HealthServer
 }
 
-// Start start service on endpoint.
+// Start start service on endpoint. The gRPC server is created before the
+// service is started in the background, so that it can be stopped at any
+// time after Start returns.
 func (s *nonBlockingGRPCServer) Start(endpoint, hstOptions string, srv Servers, metrics bool) {
+	opts := []grpc.ServerOption{
+		NewMiddlewareServerOption(metrics),
+	}
+
+	s.server = grpc.NewServer(opts...)
+
+	if srv.IS != nil {
+		csi.RegisterIdentityServer(s.server, srv.IS)
+	}
+	if srv.CS != nil {
+		csi.RegisterControllerServer(s.server, srv.CS)
+	}
+	if srv.NS != nil {
+		csi.RegisterNodeServer(s.server, srv.NS)
+	}
+	if srv.RS != nil {
+		replication.RegisterControllerServer(s.server, srv.RS)
+	}
+	s.health = RegisterIntrospection(s.server, ProbeReadiness(srv.IS))
+
+	if metrics {
+		err := EnableGRPCMetrics(hstOptions)
+		if err != nil {
+			klog.Fatal(err.Error())
+		}
+		grpc_prometheus.Register(s.server)
+	}
+
 	s.wg.Add(1)
-	go s.serve(endpoint, hstOptions, srv, metrics)
+	go s.serve(endpoint)
 }
 
 // Wait blocks until the WaitGroup counter.
@@ -77,15 +114,52 @@ func (s *nonBlockingGRPCServer) Wait() {
 
 // GracefulStop stops the gRPC server gracefully.
 func (s *nonBlockingGRPCServer) Stop() {
+	s.shutdownHealth()
 	s.server.GracefulStop()
 }
 
 // Stop stops the gRPC server.
 func (s *nonBlockingGRPCServer) ForceStop() {
+	s.shutdownHealth()
 	s.server.Stop()
 }
 
-func (s *nonBlockingGRPCServer) serve(endpoint, hstOptions string, srv Servers, metrics bool) {
+// shutdownHealth reports the services as not serving while the server stops.
+func (s *nonBlockingGRPCServer) shutdownHealth() {
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+}
+
+// StopOnSignal stops the server once the process receives SIGTERM or SIGINT.
+// The server stops accepting new RPCs and waits for the RPCs in flight to
+// finish, it is stopped forcefully when they do not finish within the
+// timeout. It needs to be called after Start().
+func StopOnSignal(s NonBlockingGRPCServer, timeout time.Duration) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	sig := <-signals
+	signal.Stop(signals)
+
+	log.DefaultLog("received signal %s, waiting up to %s for RPCs in flight", sig, timeout)
+	stopped := make(chan struct{})
+	go func() {
+		s.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		log.DefaultLog("all RPCs finished, server stopped")
+	case <-time.After(timeout):
+		log.WarningLogMsg("RPCs did not finish within %s, stopping server forcefully", timeout)
+		s.ForceStop()
+	}
+}
+
+func (s *nonBlockingGRPCServer) serve(endpoint string) {
+	defer s.wg.Done()
+
 	proto, addr, err := parseEndpoint(endpoint)
 	if err != nil {
 		klog.Fatal(err.Error())
@@ -103,52 +177,40 @@ func (s *nonBlockingGRPCServer) serve(endpoint, hstOptions string, srv Servers,
 		klog.Fatalf("Failed to listen: %v", err)
 	}
 
-	opts := []grpc.ServerOption{
-		NewMiddlewareServerOption(metrics),
+	log.DefaultLog("Listening for connections on address: %#v", listener.Addr())
+	// the server is stopped when a signal is received before it serves
+	err = s.server.Serve(listener)
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+		klog.Fatalf("Failed to server: %v", err)
 	}
+}
 
-	server := grpc.NewServer(opts...)
-	s.server = server
-
-	if srv.IS != nil {
-		csi.RegisterIdentityServer(server, srv.IS)
+// EnableGRPCMetrics enables the latency histograms of the gRPC server metrics.
+// The histogram options are comma separated values in the format
+// "start,factor,count" for exponential buckets. The interceptor returned by
+// NewMiddlewareServerOption(true) records the metrics, and
+// grpc_prometheus.Register() initializes them for all services of a server.
+func EnableGRPCMetrics(hstOptions string) error {
+	ho := strings.Split(hstOptions, ",")
+	const expectedHo = 3
+	if len(ho) != expectedHo {
+		return fmt.Errorf("invalid histogram options provided: %v", hstOptions)
 	}
-	if srv.CS != nil {
-		csi.RegisterControllerServer(server, srv.CS)
-	}
-	if srv.NS != nil {
-		csi.RegisterNodeServer(server, srv.NS)
-	}
-	if srv.RS != nil {
-		replication.RegisterControllerServer(server, srv.RS)
+	start, err := strconv.ParseFloat(ho[0], 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse histogram start value: %w", err)
 	}
-
-	log.DefaultLog("Listening for connections on address: %#v", listener.Addr())
-	if metrics {
-		ho := strings.Split(hstOptions, ",")
-		const expectedHo = 3
-		if len(ho) != expectedHo {
-			klog.Fatalf("invalid histogram options provided: %v", hstOptions)
-		}
-		start, e := strconv.ParseFloat(ho[0], 32)
-		if e != nil {
-			klog.Fatalf("failed to parse histogram start value: %v", e)
-		}
-		factor, e := strconv.ParseFloat(ho[1], 32)
-		if err != nil {
-			klog.Fatalf("failed to parse histogram factor value: %v", e)
-		}
-		count, e := strconv.Atoi(ho[2])
-		if err != nil {
-			klog.Fatalf("failed to parse histogram count value: %v", e)
-		}
-		buckets := prometheus.ExponentialBuckets(start, factor, count)
-		bktOptions := grpc_prometheus.WithHistogramBuckets(buckets)
-		grpc_prometheus.EnableHandlingTimeHistogram(bktOptions)
-		grpc_prometheus.Register(server)
+	factor, err := strconv.ParseFloat(ho[1], 32)
+	if err != nil {
+		return fmt.Errorf("failed to parse histogram factor value: %w", err)
 	}
-	err = server.Serve(listener)
+	count, err := strconv.Atoi(ho[2])
 	if err != nil {
-		klog.Fatalf("Failed to server: %v", err)
+		return fmt.Errorf("failed to parse histogram count value: %w", err)
 	}
+	buckets := prometheus.ExponentialBuckets(start, factor, count)
+	bktOptions := grpc_prometheus.WithHistogramBuckets(buckets)
+	grpc_prometheus.EnableHandlingTimeHistogram(bktOptions)
+
+	return nil
 }
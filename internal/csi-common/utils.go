@@ -20,12 +20,15 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"runtime/debug"
 	"strings"
 	"sync/atomic"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	rp "github.com/csi-addons/replication-lib-utils/protosanitizer"
@@ -33,6 +36,7 @@ import (
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/kubernetes-csi/csi-lib-utils/protosanitizer"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -62,9 +66,10 @@ func NewDefaultNodeServer(d *CSIDriver, t string, topology map[string]string) *D
 	d.topology = topology
 
 	return &DefaultNodeServer{
-		Driver:  d,
-		Type:    t,
-		Mounter: mount.NewWithoutSystemd(""),
+		Driver:     d,
+		Type:       t,
+		Mounter:    mount.NewWithoutSystemd(""),
+		StatsCache: NewVolumeStatsCache(volumeStatsCacheTTL),
 	}
 }
 
@@ -112,7 +117,16 @@ func isReplicationRequest(req interface{}) bool {
 // NewMiddlewareServerOption creates a new grpc.ServerOption that configures a
 // common format for log messages and other gRPC related handlers.
 func NewMiddlewareServerOption(withMetrics bool) grpc.ServerOption {
-	middleWare := []grpc.UnaryServerInterceptor{contextIDInjector, logGRPC, panicHandler}
+	middleWare := []grpc.UnaryServerInterceptor{
+		contextIDInjector,
+		traceGRPC,
+		auditLogger,
+		credentialsInjector,
+		eventEmitter,
+		logGRPC,
+		errorClassifier,
+		panicHandler,
+	}
 
 	if withMetrics {
 		middleWare = append(middleWare, grpc_prometheus.UnaryServerInterceptor)
@@ -169,6 +183,97 @@ func getReqID(req interface{}) string {
 	return reqID
 }
 
+// getClusterIDAndSecrets returns the clusterID the request is for, and a
+// pointer to the secrets of the request. The clusterID is taken from the
+// parameters or volume context if available, otherwise it is decoded from the
+// volume or snapshot ID. A nil pointer is returned for requests without
+// secrets.
+func getClusterIDAndSecrets(req interface{}) (string, *map[string]string) {
+	var (
+		clusterID string
+		csiID     string
+		secrets   *map[string]string
+	)
+
+	switch r := req.(type) {
+	case *csi.CreateVolumeRequest:
+		clusterID = r.GetParameters()[util.ClusterIDKey]
+		secrets = &r.Secrets
+	case *csi.DeleteVolumeRequest:
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.ControllerPublishVolumeRequest:
+		clusterID = r.GetVolumeContext()[util.ClusterIDKey]
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.ControllerUnpublishVolumeRequest:
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.ValidateVolumeCapabilitiesRequest:
+		clusterID = r.GetParameters()[util.ClusterIDKey]
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.CreateSnapshotRequest:
+		clusterID = r.GetParameters()[util.ClusterIDKey]
+		csiID = r.GetSourceVolumeId()
+		secrets = &r.Secrets
+	case *csi.DeleteSnapshotRequest:
+		csiID = r.GetSnapshotId()
+		secrets = &r.Secrets
+	case *csi.ControllerExpandVolumeRequest:
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.NodeStageVolumeRequest:
+		clusterID = r.GetVolumeContext()[util.ClusterIDKey]
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.NodePublishVolumeRequest:
+		clusterID = r.GetVolumeContext()[util.ClusterIDKey]
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	case *csi.NodeExpandVolumeRequest:
+		csiID = r.GetVolumeId()
+		secrets = &r.Secrets
+	}
+
+	if clusterID == "" && csiID != "" {
+		vi := util.CSIIdentifier{}
+		// migrated (in-tree) volume IDs can not be decomposed, these do
+		// not have a clusterID
+		if err := vi.DecomposeCSIID(csiID); err == nil {
+			clusterID = vi.ClusterID
+		}
+	}
+
+	return clusterID, secrets
+}
+
+// credentialsInjector sets the secrets of requests that do not pass any
+// secrets, to the credentials from the files in the credentials directory of
+// the cluster (if configured).
+func credentialsInjector(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	clusterID, secrets := getClusterIDAndSecrets(req)
+	if secrets == nil || len(*secrets) != 0 || clusterID == "" {
+		return handler(ctx, req)
+	}
+
+	creds, err := util.GetCredentialsFromFiles(util.CsiConfigFile, clusterID)
+	if err != nil {
+		// the request is passed on unmodified, it fails with a clear
+		// error later on if it really needs credentials
+		log.WarningLog(ctx, "failed to get credentials from files: %v", err)
+	} else if len(creds) != 0 {
+		*secrets = creds
+	}
+
+	return handler(ctx, req)
+}
+
 var id uint64
 
 func contextIDInjector(
@@ -182,8 +287,46 @@ func contextIDInjector(
 	if reqID := getReqID(req); reqID != "" {
 		ctx = context.WithValue(ctx, log.ReqID, reqID)
 	}
+	ctx = context.WithValue(ctx, log.Op, path.Base(info.FullMethod))
+	if r, ok := req.(interface{ GetVolumeId() string }); ok && r.GetVolumeId() != "" {
+		ctx = context.WithValue(ctx, log.VolumeID, r.GetVolumeId())
+	}
+	if clusterID, _ := getClusterIDAndSecrets(req); clusterID != "" {
+		ctx = context.WithValue(ctx, log.ClusterID, clusterID)
+	}
+	correlationID := getCorrelationID(ctx, req)
+	ctx = context.WithValue(ctx, log.CorrelationID, correlationID)
 
-	return handler(ctx, req)
+	resp, err := handler(ctx, req)
+	if err == nil {
+		setCorrelationID(resp, correlationID)
+	}
+
+	return resp, err
+}
+
+// traceGRPC starts a span for each gRPC procedure, as part of the trace that
+// the caller propagated (if any). The span is a no-op unless tracing has been
+// configured with tracing.Init().
+func traceGRPC(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	ctx, span := tracing.StartSpan(tracing.ExtractIncoming(ctx), info.FullMethod)
+	if reqID := getReqID(req); reqID != "" {
+		span.SetAttributes(attribute.String("csi.request_id", reqID))
+	}
+	if correlationID := util.GetCorrelationID(ctx); correlationID != "" {
+		span.SetAttributes(attribute.String("csi.correlation_id", correlationID))
+	}
+
+	resp, err := handler(ctx, req)
+	span.SetAttributes(attribute.String("rpc.grpc.status_code", status.Code(err).String()))
+	tracing.EndSpan(span, err)
+
+	return resp, err
 }
 
 func logGRPC(
@@ -205,9 +348,14 @@ func logGRPC(
 	} else {
 		log.TraceLog(ctx, "GRPC request: %s", protosanitizer.StripSecrets(req))
 	}
+	ctx = util.WithPhases(ctx)
+	start := time.Now()
 	resp, err := handler(ctx, req)
+	duration := time.Since(start)
+	ctx = context.WithValue(ctx, log.Duration, duration)
+	util.LogSlowRequest(ctx, info.FullMethod, duration)
 	if err != nil {
-		klog.Errorf(log.Log(ctx, "GRPC error: %v"), err)
+		log.ErrorLog(ctx, "GRPC error: %v", err)
 	} else {
 		log.TraceLog(ctx, "GRPC response: %s", protosanitizer.StripSecrets(resp))
 	}
@@ -222,10 +370,22 @@ func panicHandler(
 	info *grpc.UnaryServerInfo,
 	handler grpc.UnaryHandler,
 ) (resp interface{}, err error) {
+	if inflightTracking {
+		defer trackInflight(info.FullMethod, getReqID(req))()
+	}
+
 	defer func() {
 		if r := recover(); r != nil {
 			klog.Errorf("panic occurred: %v", r)
 			debug.PrintStack()
+			if diagnosticsDir != "" {
+				path, dErr := writeDiagnostics(info.FullMethod, r, debug.Stack())
+				if dErr != nil {
+					klog.Errorf("failed to capture diagnostics of the panic: %v", dErr)
+				} else {
+					klog.Errorf("diagnostics of the panic have been written to %s", path)
+				}
+			}
 			err = status.Errorf(codes.Internal, "panic %v", r)
 		}
 	}()
@@ -78,6 +78,69 @@ func TestGetReqID(t *testing.T) {
 	}
 }
 
+func TestGetClusterIDAndSecrets(t *testing.T) {
+	t.Parallel()
+
+	// volume ID of clusterID "cluster-1"
+	volumeID := "0001-0009-cluster-1-0000000000000003-b0285c97-a0ce-11eb-8c66-0242ac110002"
+
+	tests := []struct {
+		name      string
+		req       interface{}
+		clusterID string
+		secrets   bool
+	}{
+		{
+			"CreateVolume with parameters",
+			&csi.CreateVolumeRequest{Parameters: map[string]string{"clusterID": "cluster-1"}},
+			"cluster-1",
+			true,
+		},
+		{
+			"DeleteVolume with volume ID",
+			&csi.DeleteVolumeRequest{VolumeId: volumeID},
+			"cluster-1",
+			true,
+		},
+		{
+			"NodeStageVolume prefers volume context",
+			&csi.NodeStageVolumeRequest{
+				VolumeId:      volumeID,
+				VolumeContext: map[string]string{"clusterID": "cluster-2"},
+			},
+			"cluster-2",
+			true,
+		},
+		{
+			"DeleteVolume with migration volume ID",
+			&csi.DeleteVolumeRequest{VolumeId: "mig_mons-hash_image-uuid_pool-hash"},
+			"",
+			true,
+		},
+		{
+			"NodeUnstageVolume without secrets",
+			&csi.NodeUnstageVolumeRequest{VolumeId: volumeID},
+			"",
+			false,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			clusterID, secrets := getClusterIDAndSecrets(tt.req)
+			assert.Equal(t, tt.clusterID, clusterID)
+			assert.Equal(t, tt.secrets, secrets != nil)
+		})
+	}
+
+	// the returned pointer updates the secrets of the request
+	req := &csi.DeleteSnapshotRequest{SnapshotId: volumeID}
+	_, secrets := getClusterIDAndSecrets(req)
+	*secrets = map[string]string{"userID": "admin"}
+	assert.Equal(t, "admin", req.GetSecrets()["userID"])
+}
+
 func TestFilesystemNodeGetVolumeStats(t *testing.T) {
 	t.Parallel()
 
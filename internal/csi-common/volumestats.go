@@ -0,0 +1,186 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// volumeStatsCacheTTL is set by EnableVolumeStatsCache().
+var volumeStatsCacheTTL time.Duration
+
+// EnableVolumeStatsCache makes the node servers cache the results of
+// NodeGetVolumeStats for the ttl, see VolumeStatsCache. This needs to be
+// called before the node servers are created.
+func EnableVolumeStatsCache(ttl time.Duration) {
+	volumeStatsCacheTTL = ttl
+}
+
+// VolumeStatsFunc returns the stats of the volume at the path.
+type VolumeStatsFunc func(ctx context.Context, path string) (*csi.NodeGetVolumeStatsResponse, error)
+
+// VolumeStatsCache caches the stats of volumes by their volume path. Stats
+// that are younger than the ttl are returned from the cache. Stats that are
+// older, but younger than twice the ttl, are returned from the cache too,
+// while they are refreshed in the background. Older stats are fetched while
+// the caller waits. A nil *VolumeStatsCache is valid and does not cache.
+type VolumeStatsCache struct {
+	ttl time.Duration
+
+	mux     sync.Mutex
+	entries map[string]*volumeStatsEntry
+	// generation is increased by Forget(), stats that were fetched in an
+	// earlier generation are not stored, as they may be from before a resize.
+	generation uint64
+}
+
+type volumeStatsEntry struct {
+	stats      *csi.NodeGetVolumeStatsResponse
+	updated    time.Time
+	refreshing bool
+}
+
+// NewVolumeStatsCache returns a VolumeStatsCache with the ttl, or nil when
+// the ttl is 0.
+func NewVolumeStatsCache(ttl time.Duration) *VolumeStatsCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &VolumeStatsCache{
+		ttl:     ttl,
+		entries: make(map[string]*volumeStatsEntry),
+	}
+}
+
+// Get returns the stats of the volume at the path, from the cache or by
+// calling fetch. Failures are not cached.
+func (vsc *VolumeStatsCache) Get(
+	ctx context.Context,
+	path string,
+	fetch VolumeStatsFunc,
+) (*csi.NodeGetVolumeStatsResponse, error) {
+	if vsc == nil {
+		return fetch(ctx, path)
+	}
+
+	vsc.mux.Lock()
+	generation := vsc.generation
+	entry, ok := vsc.entries[path]
+	if ok {
+		age := time.Since(entry.updated)
+		switch {
+		case age < vsc.ttl:
+			vsc.mux.Unlock()
+
+			return entry.stats, nil
+		case age < 2*vsc.ttl:
+			if !entry.refreshing {
+				entry.refreshing = true
+				go vsc.refresh(path, generation, fetch)
+			}
+			vsc.mux.Unlock()
+			log.TraceLog(ctx, "returning stats of %q from %s ago, refreshing in the background", path, age)
+
+			return entry.stats, nil
+		}
+	}
+	vsc.mux.Unlock()
+
+	stats, err := fetch(ctx, path)
+	vsc.store(path, generation, stats, err)
+
+	return stats, err
+}
+
+// refresh fetches the stats of the volume at the path and updates the cache.
+func (vsc *VolumeStatsCache) refresh(path string, generation uint64, fetch VolumeStatsFunc) {
+	stats, err := fetch(context.Background(), path)
+	if err != nil {
+		log.DebugLogMsg("failed to refresh stats of %q: %v", path, err)
+	}
+	vsc.store(path, generation, stats, err)
+}
+
+// store updates the cache with the result of fetching the stats in the
+// generation. The result is dropped when Forget() was called meanwhile, so
+// that a fetch that was in progress does not add the forgotten stats again.
+func (vsc *VolumeStatsCache) store(
+	path string,
+	generation uint64,
+	stats *csi.NodeGetVolumeStatsResponse,
+	err error,
+) {
+	vsc.mux.Lock()
+	defer vsc.mux.Unlock()
+	if vsc.generation != generation {
+		return
+	}
+	vsc.update(path, stats, err)
+}
+
+// update sets the entry of the path. The entry is removed on failure, so that
+// the next caller gets the error.
+//
+// Requires: locked vsc.mux.
+func (vsc *VolumeStatsCache) update(path string, stats *csi.NodeGetVolumeStatsResponse, err error) {
+	if err != nil {
+		delete(vsc.entries, path)
+
+		return
+	}
+
+	vsc.entries[path] = &volumeStatsEntry{
+		stats:   stats,
+		updated: time.Now(),
+	}
+}
+
+// Forget removes the stats of the volume at the path from the cache. This
+// needs to be called when the volume is unpublished or resized.
+func (vsc *VolumeStatsCache) Forget(path string) {
+	if vsc == nil {
+		return
+	}
+
+	vsc.mux.Lock()
+	delete(vsc.entries, path)
+	vsc.generation++
+	vsc.mux.Unlock()
+}
+
+// Purge removes the stats of all volumes from the cache, and returns the
+// number of removed entries.
+func (vsc *VolumeStatsCache) Purge() int {
+	if vsc == nil {
+		return 0
+	}
+
+	vsc.mux.Lock()
+	defer vsc.mux.Unlock()
+	purged := len(vsc.entries)
+	vsc.entries = make(map[string]*volumeStatsEntry)
+	vsc.generation++
+
+	return purged
+}
@@ -0,0 +1,123 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package csicommon
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestVolumeStatsCache(t *testing.T) {
+	t.Parallel()
+
+	var calls int32
+	fetch := func(ctx context.Context, path string) (*csi.NodeGetVolumeStatsResponse, error) {
+		n := atomic.AddInt32(&calls, 1)
+
+		return &csi.NodeGetVolumeStatsResponse{
+			Usage: []*csi.VolumeUsage{{Used: int64(n)}},
+		}, nil
+	}
+	used := func(resp *csi.NodeGetVolumeStatsResponse) int64 {
+		return resp.GetUsage()[0].GetUsed()
+	}
+
+	ttl := 100 * time.Millisecond
+	vsc := NewVolumeStatsCache(ttl)
+	ctx := context.TODO()
+
+	resp, err := vsc.Get(ctx, "/test", fetch)
+	if err != nil || used(resp) != 1 {
+		t.Fatalf("Get() = %v, %v, want fetched stats", resp, err)
+	}
+	resp, _ = vsc.Get(ctx, "/test", fetch)
+	if used(resp) != 1 {
+		t.Errorf("Get() within ttl fetched the stats again")
+	}
+
+	// stale stats are returned, and refreshed in the background
+	time.Sleep(ttl)
+	resp, _ = vsc.Get(ctx, "/test", fetch)
+	if used(resp) != 1 {
+		t.Errorf("Get() of stale stats did not return the cached stats")
+	}
+	deadline := time.Now().Add(ttl / 2)
+	for atomic.LoadInt32(&calls) != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	resp, _ = vsc.Get(ctx, "/test", fetch)
+	if used(resp) != 2 {
+		t.Errorf("Get() after refresh = %d, want 2", used(resp))
+	}
+
+	// forgotten stats are fetched again
+	vsc.Forget("/test")
+	resp, _ = vsc.Get(ctx, "/test", fetch)
+	if used(resp) != 3 {
+		t.Errorf("Get() after Forget() = %d, want 3", used(resp))
+	}
+
+	// stats that are fetched while Forget() is called are not cached
+	forgetting := func(ctx context.Context, path string) (*csi.NodeGetVolumeStatsResponse, error) {
+		vsc.Forget(path)
+
+		return fetch(ctx, path)
+	}
+	resp, _ = vsc.Get(ctx, "/forgotten", forgetting)
+	if used(resp) != 4 {
+		t.Errorf("Get() while forgetting = %d, want 4", used(resp))
+	}
+	resp, _ = vsc.Get(ctx, "/forgotten", fetch)
+	if used(resp) != 5 {
+		t.Errorf("Get() after Forget() during fetch = %d, want 5", used(resp))
+	}
+
+	// purged stats are fetched again
+	if purged := vsc.Purge(); purged != 2 {
+		t.Errorf("Purge() = %d, want 2", purged)
+	}
+	resp, _ = vsc.Get(ctx, "/forgotten", fetch)
+	if used(resp) != 6 {
+		t.Errorf("Get() after Purge() = %d, want 6", used(resp))
+	}
+
+	// failures are not cached
+	errFailed := errors.New("failed")
+	failing := func(ctx context.Context, path string) (*csi.NodeGetVolumeStatsResponse, error) {
+		return nil, errFailed
+	}
+	if _, err = vsc.Get(ctx, "/failing", failing); !errors.Is(err, errFailed) {
+		t.Errorf("Get() error = %v, want %v", err, errFailed)
+	}
+	if _, err = vsc.Get(ctx, "/failing", fetch); err != nil {
+		t.Errorf("Get() after failure error = %v", err)
+	}
+
+	// a nil cache always fetches the stats
+	var disabled *VolumeStatsCache
+	before := atomic.LoadInt32(&calls)
+	_, _ = disabled.Get(ctx, "/test", fetch)
+	_, _ = disabled.Get(ctx, "/test", fetch)
+	if atomic.LoadInt32(&calls) != before+2 {
+		t.Error("Get() of disabled cache did not fetch the stats")
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/google/uuid"
+)
+
+// ProblemKind is the kind of an inconsistency between a journal and the
+// images or subvolumes of its reservations.
+type ProblemKind string
+
+const (
+	// OrphanedEntry is a reservation in the journal without its image,
+	// snapshot or subvolume.
+	OrphanedEntry = ProblemKind("orphaned-entry")
+	// DanglingImage is an image or subvolume that is named like the images
+	// of the journal, but is not reserved in it.
+	DanglingImage = ProblemKind("dangling-image")
+)
+
+// Problem is an inconsistency that is found by the journal check of
+// cephcsi.
+type Problem struct {
+	Kind ProblemKind `json:"kind"`
+	// Pool is the pool of the image, or the metadata pool of the
+	// filesystem of the subvolume
+	Pool string `json:"pool"`
+	// JournalPool is the pool of the csiDirectory of the reservation
+	JournalPool string `json:"journalPool,omitempty"`
+	RequestName string `json:"requestName,omitempty"`
+	UUID        string `json:"uuid,omitempty"`
+	// Name is the name of the image, snapshot or subvolume, if it is known
+	Name     string `json:"name,omitempty"`
+	Snapshot bool   `json:"snapshot,omitempty"`
+	// Repaired is set when the problem has been repaired
+	Repaired bool `json:"repaired"`
+	// Skipped is the reason why the problem was not repaired, when it
+	// should have been
+	Skipped string `json:"skipped,omitempty"`
+}
+
+// CheckOptions are the options of the journal check of cephcsi.
+type CheckOptions struct {
+	// Repair is set to repair the problems
+	Repair bool
+	// MinAge is the age that reservations and images need to have to be
+	// checked, younger ones may still be created or deleted
+	MinAge time.Duration
+	// Trash are the dangling images, as pool/name, that are confirmed to be
+	// moved to the trash
+	Trash map[string]bool
+}
+
+// ParseTrashList returns the confirmed dangling images of the comma
+// separated list of pool/name pairs.
+func ParseTrashList(list string) (map[string]bool, error) {
+	trash := map[string]bool{}
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pool, name, ok := strings.Cut(entry, "/")
+		if !ok || pool == "" || name == "" || strings.Contains(name, "/") {
+			return nil, fmt.Errorf("invalid image %q, should be <pool>/<name>", entry)
+		}
+		trash[entry] = true
+	}
+
+	return trash, nil
+}
+
+// Young returns whether something that was modified at the given time is
+// younger than the minimum age, and should not be checked yet.
+func (o *CheckOptions) Young(modified, now time.Time) bool {
+	return now.Sub(modified) < o.MinAge
+}
+
+// TrashConfirmed returns whether moving the dangling image to the trash was
+// confirmed.
+func (o *CheckOptions) TrashConfirmed(pool, name string) bool {
+	return o.Trash[pool+"/"+name]
+}
+
+// ReservationModTime returns the time at which the UUID directory of the
+// reservation in the pool was last modified. When the UUID directory does not
+// exist, the modification time of the csiDirectory in the journalPool is
+// returned, which is the latest time at which the reservation could have been
+// changed.
+func (conn *Connection) ReservationModTime(journalPool, pool, objectUUID string) (time.Time, error) {
+	cj := conn.config
+	if pool != "" {
+		modTime, err := conn.objectModTime(pool, cj.cephUUIDDirectoryPrefix+objectUUID)
+		if err == nil || !errors.Is(err, util.ErrKeyNotFound) {
+			return modTime, err
+		}
+	}
+
+	return conn.objectModTime(journalPool, cj.csiDirectory)
+}
+
+// objectModTime returns the time at which the object in the pool was last
+// modified, util.ErrKeyNotFound or util.ErrPoolNotFound is returned when it
+// does not exist.
+func (conn *Connection) objectModTime(pool, oid string) (time.Time, error) {
+	ioctx, err := conn.conn.GetIoctx(pool)
+	if err != nil {
+		return time.Time{}, omapPoolError(err)
+	}
+	defer ioctx.Destroy()
+
+	if conn.config.namespace != "" {
+		ioctx.SetNamespace(conn.config.namespace)
+	}
+	stat, err := ioctx.Stat(oid)
+	if errors.Is(err, rados.ErrNotFound) {
+		return time.Time{}, fmt.Errorf("%w: object %s in pool %s", util.ErrKeyNotFound, oid, pool)
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return stat.ModTime, nil
+}
+
+// ReservedNamePrefixes are the default prefixes of the names of the images,
+// snapshots and subvolumes of reservations.
+var ReservedNamePrefixes = []string{defaultVolumeNamingPrefix, defaultSnapshotNamingPrefix}
+
+// IsReservedName returns whether the name is formed like the name of an
+// image or subvolume of a reservation, one of the prefixes followed by a
+// UUID.
+func IsReservedName(name string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if !strings.HasPrefix(name, prefix) || len(name) != len(prefix)+uuidEncodedLength {
+			continue
+		}
+		if _, err := uuid.Parse(name[len(prefix):]); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsReservedName(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: "csi-vol-b0285c97-a0ce-11eb-8c66-0242ac110002", want: true},
+		{name: "csi-snap-b0285c97-a0ce-11eb-8c66-0242ac110002", want: true},
+		{name: "csi-vol-b0285c97-a0ce-11eb-8c66-0242ac110002-temp", want: false},
+		{name: "csi-vol-not-a-uuid-a0ce-11eb-8c66-0242ac110002", want: false},
+		{name: "image-b0285c97-a0ce-11eb-8c66-0242ac110002", want: false},
+		{name: "csi-vol-", want: false},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsReservedName(ts.name, ReservedNamePrefixes); got != ts.want {
+				t.Errorf("IsReservedName(%q) = %v, want %v", ts.name, got, ts.want)
+			}
+		})
+	}
+}
+
+func TestParseTrashList(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		list    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty", list: "", want: []string{}},
+		{
+			name: "images",
+			list: "replicapool/csi-vol-a, ec-pool/csi-snap-b,",
+			want: []string{"replicapool/csi-vol-a", "ec-pool/csi-snap-b"},
+		},
+		{name: "no pool", list: "csi-vol-a", wantErr: true},
+		{name: "empty name", list: "replicapool/", wantErr: true},
+		{name: "namespace", list: "replicapool/ns/csi-vol-a", wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			trash, err := ParseTrashList(ts.list)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("ParseTrashList() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if len(trash) != len(ts.want) {
+				t.Errorf("ParseTrashList() = %v, want %v", trash, ts.want)
+			}
+			for _, image := range ts.want {
+				if !trash[image] {
+					t.Errorf("ParseTrashList() = %v, missing %s", trash, image)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckOptions(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	opts := CheckOptions{
+		MinAge: time.Hour,
+		Trash:  map[string]bool{"replicapool/csi-vol-a": true},
+	}
+	if !opts.Young(now.Add(-time.Minute), now) {
+		t.Error("Young() = false for a minute old reservation")
+	}
+	if opts.Young(now.Add(-2*time.Hour), now) {
+		t.Error("Young() = true for a two hours old reservation")
+	}
+	if !opts.TrashConfirmed("replicapool", "csi-vol-a") {
+		t.Error("TrashConfirmed() = false for a confirmed image")
+	}
+	if opts.TrashConfirmed("replicapool", "csi-vol-b") {
+		t.Error("TrashConfirmed() = true for an image that is not confirmed")
+	}
+}
@@ -0,0 +1,244 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/reftracker/radoswrapper"
+
+	"github.com/ceph/go-ceph/rados"
+)
+
+// counterRetries is the number of times an update of a counter is tried,
+// when other updates change the object map at the same time.
+const counterRetries = 10
+
+// counterLocks serialize the updates of a counter in a pool by the
+// operations of the process.
+var counterLocks = util.NewCounterLocks()
+
+/*
+CounterUpdate returns the new value of a counter, like the usage of a tenant in a pool. The current
+value is passed with whether it is counted yet, a counter is counted from the first update that
+stores it, which initializes the counter.
+
+Return values:
+  - int64: the new value of the counter
+  - bool: false when the value does not need to be stored, like for counters that are not counted
+  - error: the update is not stored, and the error is returned by the update of the counter
+*/
+type CounterUpdate func(value int64, counted bool) (int64, bool, error)
+
+// UpdateTenantUsage updates the bytes that the tenant uses in the pool, which
+// are stored in the tenantUsageDirectory of the pool.
+func (conn *Connection) UpdateTenantUsage(ctx context.Context, pool, tenant string, update CounterUpdate) error {
+	err := conn.updateCounter(ctx, pool, conn.config.tenantUsageDirectory, tenant, update)
+	if err != nil {
+		return fmt.Errorf("failed to update the usage of tenant %s in pool %s: %w", tenant, pool, err)
+	}
+
+	return nil
+}
+
+// GetTenantUsage returns the bytes that the tenant uses in the pool, and
+// whether the usage of the tenant is counted. The usage is not modified.
+func (conn *Connection) GetTenantUsage(ctx context.Context, pool, tenant string) (int64, bool, error) {
+	used, counted, err := conn.getCounter(pool, conn.config.tenantUsageDirectory, tenant)
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get the usage of tenant %s in pool %s: %w", tenant, pool, err)
+	}
+
+	return used, counted, nil
+}
+
+// AddTenantUsage adds delta bytes to the usage of the tenant in the pool, if
+// the usage of the tenant is counted.
+func (conn *Connection) AddTenantUsage(ctx context.Context, pool, tenant string, delta int64) error {
+	return conn.UpdateTenantUsage(ctx, pool, tenant, addCounter(delta))
+}
+
+// UpdateSnapshotCount updates the number of snapshots of the source image in
+// the pool, which are stored in the snapshotCountDirectory of the pool.
+func (conn *Connection) UpdateSnapshotCount(ctx context.Context, pool, source string, update CounterUpdate) error {
+	err := conn.updateCounter(ctx, pool, conn.config.snapshotCountDirectory, source, update)
+	if err != nil {
+		return fmt.Errorf("failed to update the number of snapshots of %s in pool %s: %w", source, pool, err)
+	}
+
+	return nil
+}
+
+// AddSnapshotCount adds delta to the number of snapshots of the source image
+// in the pool, if the snapshots of the source are counted.
+func (conn *Connection) AddSnapshotCount(ctx context.Context, pool, source string, delta int64) error {
+	return conn.UpdateSnapshotCount(ctx, pool, source, addCounter(delta))
+}
+
+// addCounter returns the update that adds delta to a counter that is
+// counted.
+func addCounter(delta int64) CounterUpdate {
+	return func(value int64, counted bool) (int64, bool, error) {
+		return value + delta, counted, nil
+	}
+}
+
+/*
+updateCounter updates the counter with the key in the object map oid of the pool. The updates of a
+counter are serialized by a lock of the counter, and an update is retried when the object map was
+modified by another process since it was read, so that concurrent updates of the provisioner and
+the controller are not lost.
+*/
+func (conn *Connection) updateCounter(
+	ctx context.Context,
+	pool, oid, key string,
+	update CounterUpdate,
+) error {
+	lockID := pool + "/" + conn.config.namespace + "/" + oid + "/" + key
+	if !counterLocks.Acquire(ctx, lockID) {
+		return fmt.Errorf("failed to lock the counter: %w", ctx.Err())
+	}
+	defer counterLocks.Release(lockID)
+
+	ioctx, err := conn.counterIOContext(pool)
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+
+	return updateCounterValue(ctx, radoswrapper.NewIOContext(ioctx), pool, oid, key, update)
+}
+
+// getCounter returns the value of the counter with the key in the object map
+// oid of the pool, and whether it is counted.
+func (conn *Connection) getCounter(pool, oid, key string) (int64, bool, error) {
+	ioctx, err := conn.counterIOContext(pool)
+	if err != nil {
+		return 0, false, err
+	}
+	defer ioctx.Destroy()
+
+	value, counted, _, err := readCounter(radoswrapper.NewIOContext(ioctx), oid, key)
+	countOMapOperation(pool, omapGet, 1, err)
+
+	return value, counted, err
+}
+
+// counterIOContext returns the IOContext for the pool in the namespace of the
+// journal, in which the counters are stored.
+func (conn *Connection) counterIOContext(pool string) (*rados.IOContext, error) {
+	ioctx, err := conn.conn.GetIoctx(pool)
+	if err != nil {
+		return nil, omapPoolError(err)
+	}
+	if conn.config.namespace != "" {
+		ioctx.SetNamespace(conn.config.namespace)
+	}
+
+	return ioctx, nil
+}
+
+// updateCounterValue stores the value that update returns in the object map,
+// and tries again when the object map was modified after it was read. The
+// value does not drop below zero.
+func updateCounterValue(
+	ctx context.Context,
+	ioctx radoswrapper.IOContextW,
+	pool, oid, key string,
+	update CounterUpdate,
+) error {
+	for attempt := 1; ; attempt++ {
+		value, counted, ver, err := readCounter(ioctx, oid, key)
+		countOMapOperation(pool, omapGet, 1, err)
+		if err != nil {
+			return err
+		}
+		newValue, store, err := update(value, counted)
+		if err != nil || !store {
+			return err
+		}
+		if newValue < 0 {
+			newValue = 0
+		}
+
+		err = writeCounter(ioctx, oid, key, newValue, ver)
+		countOMapOperation(pool, omapSet, 1, err)
+		if err == nil {
+			log.DebugLog(ctx, "counter %s of %s is %d, was %d", key, oid, newValue, value)
+
+			return nil
+		}
+		if attempt == counterRetries {
+			return err
+		}
+		log.DebugLog(ctx, "retrying update of counter %s of %s: %v", key, oid, err)
+	}
+}
+
+// readCounter returns the value of the counter in the object map, whether it
+// is counted, and the version of the object. The version is 0 when the
+// object does not exist.
+func readCounter(ioctx radoswrapper.IOContextW, oid, key string) (int64, bool, uint64, error) {
+	op := ioctx.CreateReadOp()
+	defer op.Release()
+	step := op.GetOmapValuesByKeys([]string{key})
+	err := op.Operate(oid)
+	if errors.Is(err, rados.ErrNotFound) {
+		return 0, false, 0, nil
+	}
+	if err != nil {
+		return 0, false, 0, err
+	}
+	ver, err := ioctx.GetLastVersion()
+	if err != nil {
+		return 0, false, 0, err
+	}
+
+	kv, err := step.Next()
+	if err != nil {
+		return 0, false, 0, err
+	}
+	if kv == nil {
+		return 0, false, ver, nil
+	}
+	value, err := strconv.ParseInt(string(kv.Value), 10, 64)
+	if err != nil {
+		return 0, false, 0, fmt.Errorf("invalid value %q of counter %s: %w", kv.Value, key, err)
+	}
+
+	return value, true, ver, nil
+}
+
+// writeCounter stores the value of the counter in the object map, if the
+// object still has the version, or is created when the version is 0.
+func writeCounter(ioctx radoswrapper.IOContextW, oid, key string, value int64, ver uint64) error {
+	w := ioctx.CreateWriteOp()
+	defer w.Release()
+	if ver == 0 {
+		w.Create(rados.CreateExclusive)
+	} else {
+		w.AssertVersion(ver)
+	}
+	w.SetOmap(map[string][]byte{key: []byte(strconv.FormatInt(value, 10))})
+
+	return w.Operate(oid)
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util/reftracker/radoswrapper"
+)
+
+const counterOid = "csi.tenants.default"
+
+func TestUpdateCounterValue(t *testing.T) {
+	t.Parallel()
+	ctx := context.TODO()
+	ioctx := radoswrapper.NewFakeIOContext(radoswrapper.NewFakeRados())
+
+	count := func(initial, delta int64) CounterUpdate {
+		return func(used int64, counted bool) (int64, bool, error) {
+			if !counted {
+				used = initial
+			}
+
+			return used + delta, true, nil
+		}
+	}
+	assertUsage := func(tenant string, wantUsed int64, wantCounted bool) {
+		t.Helper()
+		used, counted, _, err := readCounter(ioctx, counterOid, tenant)
+		if err != nil {
+			t.Fatalf("readCounter() error = %v", err)
+		}
+		if used != wantUsed || counted != wantCounted {
+			t.Errorf("readCounter() = %d, %v, want %d, %v", used, counted, wantUsed, wantCounted)
+		}
+	}
+
+	// counters are not counted until the first update that stores them
+	if err := updateCounterValue(ctx, ioctx, "pool", counterOid, "tenant-a", addCounter(10)); err != nil {
+		t.Fatalf("updateCounterValue() error = %v", err)
+	}
+	assertUsage("tenant-a", 0, false)
+
+	// the first counted update creates the object
+	if err := updateCounterValue(ctx, ioctx, "pool", counterOid, "tenant-a", count(100, 10)); err != nil {
+		t.Fatalf("updateCounterValue() error = %v", err)
+	}
+	assertUsage("tenant-a", 110, true)
+
+	if err := updateCounterValue(ctx, ioctx, "pool", counterOid, "tenant-b", count(5, 5)); err != nil {
+		t.Fatalf("updateCounterValue() error = %v", err)
+	}
+	assertUsage("tenant-b", 10, true)
+
+	if err := updateCounterValue(ctx, ioctx, "pool", counterOid, "tenant-a", addCounter(-200)); err != nil {
+		t.Fatalf("updateCounterValue() error = %v", err)
+	}
+	assertUsage("tenant-a", 0, true)
+	assertUsage("tenant-b", 10, true)
+
+	// failed updates are not stored
+	errQuota := errors.New("quota exceeded")
+	err := updateCounterValue(ctx, ioctx, "pool", counterOid, "tenant-b", func(int64, bool) (int64, bool, error) {
+		return 0, true, errQuota
+	})
+	if !errors.Is(err, errQuota) {
+		t.Errorf("updateCounterValue() error = %v, want %v", err, errQuota)
+	}
+	assertUsage("tenant-b", 10, true)
+}
+
+func TestWriteCounterVersion(t *testing.T) {
+	t.Parallel()
+	ioctx := radoswrapper.NewFakeIOContext(radoswrapper.NewFakeRados())
+
+	if err := writeCounter(ioctx, counterOid, "tenant", 1, 0); err != nil {
+		t.Fatalf("writeCounter() error = %v", err)
+	}
+	_, _, ver, err := readCounter(ioctx, counterOid, "tenant")
+	if err != nil {
+		t.Fatalf("readCounter() error = %v", err)
+	}
+
+	// another process created the object, or modified it since it was read
+	if err = writeCounter(ioctx, counterOid, "tenant", 2, 0); err == nil {
+		t.Error("writeCounter() of a new object succeeded for an existing object")
+	}
+	if err = writeCounter(ioctx, counterOid, "tenant", 2, ver); err != nil {
+		t.Fatalf("writeCounter() error = %v", err)
+	}
+	if err = writeCounter(ioctx, counterOid, "tenant", 3, ver); err == nil {
+		t.Error("writeCounter() succeeded with an old version")
+	}
+}
@@ -0,0 +1,171 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// listChunkSize is the number of reservations that are fetched at once while
+// filling a page of a listing.
+const listChunkSize = 100
+
+// ErrInvalidListToken is returned when the starting token of a listing was not
+// returned by a previous listing.
+var ErrInvalidListToken = errors.New("invalid starting token")
+
+// ListLocation is a pool of a cluster with a csiDirectory that is listed.
+type ListLocation struct {
+	ClusterID string `json:"clusterID"`
+	Pool      string `json:"pool"`
+}
+
+// listPosition is the last reservation of a page, encoded in the token of the
+// next page.
+type listPosition struct {
+	ListLocation
+	RequestName string `json:"requestName"`
+}
+
+// encodeListToken returns the token for the listing to continue after the
+// position.
+func encodeListToken(pos listPosition) (string, error) {
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode list token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeListToken returns the position that is encoded in the token.
+func decodeListToken(token string) (listPosition, error) {
+	pos := listPosition{}
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return pos, fmt.Errorf("%w %q: %v", ErrInvalidListToken, token, err)
+	}
+	err = json.Unmarshal(data, &pos)
+	if err != nil || pos.ClusterID == "" || pos.Pool == "" || pos.RequestName == "" {
+		return pos, fmt.Errorf("%w %q", ErrInvalidListToken, token)
+	}
+
+	return pos, nil
+}
+
+// SortListLocations sorts the locations in the order they are listed by
+// ListPages.
+func SortListLocations(locations []ListLocation) {
+	sort.Slice(locations, func(i, j int) bool {
+		return locationBefore(locations[i], locations[j])
+	})
+}
+
+// locationBefore returns whether location a is listed before b.
+func locationBefore(a, b ListLocation) bool {
+	if a.ClusterID != b.ClusterID {
+		return a.ClusterID < b.ClusterID
+	}
+
+	return a.Pool < b.Pool
+}
+
+/*
+ListPages lists a page of the reservations in the csiDirectories of the locations, which need to
+be sorted with SortListLocations. The page starts after the reservation of the startingToken, an
+empty token starts with the first location. A location which no longer exists is skipped, so that
+the listing continues when pools are added or removed.
+
+The reservations of a location are listed with list, see Connection.ListReservations, and are
+converted to the entries of the page with entry. The reservations that entry does not return an
+entry for (false) are skipped, like reservations of volumes that are being created or deleted.
+
+Return values:
+  - []T: at most maxEntries entries (0 lists all entries at once)
+  - string: token to pass as startingToken to list the next page, empty if there are no more
+    entries
+  - error: ErrInvalidListToken if the startingToken can not be decoded, or the error of list or
+    entry
+*/
+func ListPages[T any](
+	locations []ListLocation,
+	startingToken string,
+	maxEntries int,
+	list func(loc ListLocation, startAfter string, maxEntries int) ([]Reservation, string, error),
+	entry func(loc ListLocation, rsv Reservation) (T, bool, error),
+) ([]T, string, error) {
+	if maxEntries < 0 {
+		return nil, "", fmt.Errorf("invalid maximum number of entries: %d", maxEntries)
+	}
+
+	start := listPosition{}
+	if startingToken != "" {
+		var err error
+		start, err = decodeListToken(startingToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	entries := []T{}
+	last := listPosition{}
+	for _, loc := range locations {
+		startAfter := ""
+		if startingToken != "" {
+			if locationBefore(loc, start.ListLocation) {
+				continue
+			}
+			if loc == start.ListLocation {
+				startAfter = start.RequestName
+			}
+		}
+
+		for {
+			reservations, next, err := list(loc, startAfter, listChunkSize)
+			if err != nil {
+				return nil, "", err
+			}
+			for _, rsv := range reservations {
+				e, ok, err := entry(loc, rsv)
+				if err != nil {
+					return nil, "", err
+				}
+				if !ok {
+					continue
+				}
+				// the page is full and there is at least one more entry
+				if maxEntries > 0 && len(entries) == maxEntries {
+					token, err := encodeListToken(last)
+
+					return entries, token, err
+				}
+				entries = append(entries, e)
+				last = listPosition{ListLocation: loc, RequestName: rsv.RequestName}
+			}
+			if next == "" {
+				break
+			}
+			startAfter = next
+		}
+	}
+
+	return entries, "", nil
+}
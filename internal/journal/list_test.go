@@ -0,0 +1,222 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"errors"
+	"sort"
+	"testing"
+)
+
+// fakeJournals are the request names of the reservations in the
+// csiDirectories of the locations.
+type fakeJournals map[ListLocation][]string
+
+// list lists the reservations of the location after startAfter, at most
+// maxEntries at a time.
+func (fj fakeJournals) list(loc ListLocation, startAfter string, maxEntries int) ([]Reservation, string, error) {
+	names := fj[loc]
+	i := sort.SearchStrings(names, startAfter)
+	if i < len(names) && names[i] == startAfter {
+		i++
+	}
+	reservations := []Reservation{}
+	for ; i < len(names) && len(reservations) < maxEntries; i++ {
+		reservations = append(reservations, Reservation{RequestName: names[i]})
+	}
+	next := ""
+	if i < len(names) {
+		next = reservations[len(reservations)-1].RequestName
+	}
+
+	return reservations, next, nil
+}
+
+// entry returns the request name of the reservation, and skips the
+// reservations of requests that start with "skip".
+func entry(loc ListLocation, rsv Reservation) (string, bool, error) {
+	if len(rsv.RequestName) >= 4 && rsv.RequestName[:4] == "skip" {
+		return "", false, nil
+	}
+
+	return loc.Pool + "/" + rsv.RequestName, true, nil
+}
+
+// listAll lists all pages of the locations.
+func listAll(t *testing.T, fj fakeJournals, locations []ListLocation, maxEntries int) []string {
+	t.Helper()
+
+	all := []string{}
+	token := ""
+	for pages := 0; ; pages++ {
+		if pages > 100 {
+			t.Fatalf("listing did not end, last token %q", token)
+		}
+		entries, next, err := ListPages(locations, token, maxEntries, fj.list, entry)
+		if err != nil {
+			t.Fatalf("ListPages() error = %v", err)
+		}
+		if maxEntries > 0 && len(entries) > maxEntries {
+			t.Errorf("ListPages() returned %d entries, max %d", len(entries), maxEntries)
+		}
+		all = append(all, entries...)
+		if next == "" {
+			return all
+		}
+		if len(entries) == 0 {
+			t.Fatalf("ListPages() returned an empty page with token %q", next)
+		}
+		token = next
+	}
+}
+
+func TestListPages(t *testing.T) {
+	t.Parallel()
+	a1 := ListLocation{ClusterID: "a", Pool: "pool1"}
+	a2 := ListLocation{ClusterID: "a", Pool: "pool2"}
+	b1 := ListLocation{ClusterID: "b", Pool: "pool1"}
+	locations := []ListLocation{b1, a2, a1}
+	SortListLocations(locations)
+
+	many := []string{}
+	for i := 0; i < 2*listChunkSize+1; i++ {
+		many = append(many, string(rune('a'+i/26/26))+string(rune('a'+i/26%26))+string(rune('a'+i%26)))
+	}
+	manyEntries := []string{}
+	for _, name := range many {
+		manyEntries = append(manyEntries, "pool2/"+name)
+	}
+
+	tests := []struct {
+		name       string
+		journals   fakeJournals
+		maxEntries int
+		want       []string
+	}{
+		{
+			name:       "empty",
+			journals:   fakeJournals{},
+			maxEntries: 2,
+			want:       []string{},
+		},
+		{
+			name: "all at once",
+			journals: fakeJournals{
+				a1: {"x", "y"},
+				b1: {"z"},
+			},
+			maxEntries: 0,
+			want:       []string{"pool1/x", "pool1/y", "pool1/z"},
+		},
+		{
+			name: "pages across locations",
+			journals: fakeJournals{
+				a1: {"x", "y", "z"},
+				a2: {"x"},
+				b1: {"w", "x"},
+			},
+			maxEntries: 2,
+			want:       []string{"pool1/x", "pool1/y", "pool1/z", "pool2/x", "pool1/w", "pool1/x"},
+		},
+		{
+			name: "exact pages",
+			journals: fakeJournals{
+				a1: {"x", "y"},
+				b1: {"x", "y"},
+			},
+			maxEntries: 2,
+			want:       []string{"pool1/x", "pool1/y", "pool1/x", "pool1/y"},
+		},
+		{
+			name: "skipped reservations",
+			journals: fakeJournals{
+				a1: {"skip1", "x", "skip2"},
+				a2: {"skip3"},
+				b1: {"skip4", "y", "z"},
+			},
+			maxEntries: 1,
+			want:       []string{"pool1/x", "pool1/y", "pool1/z"},
+		},
+		{
+			name: "more reservations than a chunk",
+			journals: fakeJournals{
+				a2: many,
+			},
+			maxEntries: listChunkSize + 1,
+			want:       manyEntries,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := listAll(t, ts.journals, locations, ts.maxEntries)
+			if len(got) != len(ts.want) {
+				t.Fatalf("listed %v, want %v", got, ts.want)
+			}
+			for i := range got {
+				if got[i] != ts.want[i] {
+					t.Errorf("listed %v, want %v", got, ts.want)
+
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestListPagesToken(t *testing.T) {
+	t.Parallel()
+	a1 := ListLocation{ClusterID: "a", Pool: "pool1"}
+	a2 := ListLocation{ClusterID: "a", Pool: "pool2"}
+	b1 := ListLocation{ClusterID: "b", Pool: "pool1"}
+	fj := fakeJournals{
+		a1: {"x"},
+		a2: {"x", "y"},
+		b1: {"x"},
+	}
+
+	entries, token, err := ListPages([]ListLocation{a1, a2, b1}, "", 2, fj.list, entry)
+	if err != nil {
+		t.Fatalf("ListPages() error = %v", err)
+	}
+	if len(entries) != 2 || token == "" {
+		t.Fatalf("ListPages() = %v, %q, want 2 entries and a token", entries, token)
+	}
+
+	// the pool of the token was removed, the listing continues with the next
+	// pool
+	entries, token, err = ListPages([]ListLocation{a1, b1}, token, 2, fj.list, entry)
+	if err != nil {
+		t.Fatalf("ListPages() error = %v", err)
+	}
+	if len(entries) != 1 || entries[0] != "pool1/x" || token != "" {
+		t.Errorf("ListPages() = %v, %q, want [pool1/x] and no token", entries, token)
+	}
+
+	for _, invalid := range []string{"not base64!", "bm90IGpzb24", "e30"} {
+		_, _, err = ListPages([]ListLocation{a1}, invalid, 2, fj.list, entry)
+		if !errors.Is(err, ErrInvalidListToken) {
+			t.Errorf("ListPages() with token %q error = %v, want %v", invalid, err, ErrInvalidListToken)
+		}
+	}
+
+	_, _, err = ListPages([]ListLocation{a1}, "", -1, fj.list, entry)
+	if err == nil {
+		t.Error("ListPages() with negative maxEntries did not fail")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journal
+
+import (
+	"errors"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// operations on omaps, used as label for the metrics.
+const (
+	omapGet    = "get"
+	omapList   = "list"
+	omapSet    = "set"
+	omapRemove = "remove"
+)
+
+// kinds of reservation conflicts, used as label for the metrics.
+const (
+	// conflictUUID is a generated UUID that is in use already.
+	conflictUUID = "uuid"
+	// conflictSnapName is a snapshot name that is reserved for a different
+	// source volume.
+	conflictSnapName = "snapname"
+)
+
+var (
+	omapOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Subsystem: "journal",
+			Name:      "omap_operations_total",
+			Help:      "Number of omap operations on the journal by pool and operation (get, list, set, remove)",
+		},
+		[]string{"pool", "operation"},
+	)
+	omapKeys = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Subsystem: "journal",
+			Name:      "omap_keys_total",
+			Help:      "Number of omap keys read, written or removed on the journal by pool and operation",
+		},
+		[]string{"pool", "operation"},
+	)
+	omapErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Subsystem: "journal",
+			Name:      "omap_errors_total",
+			Help:      "Number of failed omap operations on the journal by pool and operation, missing omaps are not counted",
+		},
+		[]string{"pool", "operation"},
+	)
+	reservationConflicts = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Subsystem: "journal",
+			Name:      "reservation_conflicts_total",
+			Help:      "Number of conflicts while reserving names in the journal by kind (uuid, snapname)",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(omapOperations, omapKeys, omapErrors, reservationConflicts)
+}
+
+// countOMapOperation records an omap operation on the pool that touched the
+// number of keys. A missing omap is part of the normal lookup of reservations
+// and not counted as an error.
+func countOMapOperation(pool, operation string, keys int, err error) {
+	if !util.RecordMetricLabel(util.MetricLabelPool, pool) {
+		return
+	}
+
+	omapOperations.WithLabelValues(pool, operation).Inc()
+	if err != nil && !errors.Is(err, rados.ErrNotFound) {
+		omapErrors.WithLabelValues(pool, operation).Inc()
+
+		return
+	}
+	omapKeys.WithLabelValues(pool, operation).Add(float64(keys))
+}
@@ -22,6 +22,7 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/rados"
 )
@@ -36,6 +37,9 @@ func getOMapValues(
 	conn *Connection,
 	poolName, namespace, oid, prefix string, keys []string,
 ) (map[string]string, error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.getOMapValues")
+	defer span.End()
+
 	// fetch and configure the rados ioctx
 	ioctx, err := conn.conn.GetIoctx(poolName)
 	if err != nil {
@@ -73,6 +77,7 @@ func getOMapValues(
 			break
 		}
 	}
+	countOMapOperation(poolName, omapGet, len(results), err)
 
 	if err != nil {
 		if errors.Is(err, rados.ErrNotFound) {
@@ -91,11 +96,95 @@ func getOMapValues(
 	return results, nil
 }
 
+// omapEntry is a single key-value pair as stored in an omap.
+type omapEntry struct {
+	key   string
+	value string
+}
+
+// listOMapValues returns the key-value pairs with the given prefix that are
+// stored in the omap after the startAfter key, in the (sorted) order RADOS
+// returns them. At most maxEntries pairs are returned, when maxEntries is 0
+// the whole omap is listed. The returned key is non-empty when more entries
+// are available, and can be passed as startAfter to fetch the next page.
+func listOMapValues(
+	ctx context.Context,
+	conn *Connection,
+	poolName, namespace, oid, prefix, startAfter string, maxEntries int64,
+) ([]omapEntry, string, error) {
+	ctx, span := tracing.StartSpan(ctx, "journal.listOMapValues")
+	defer span.End()
+
+	// fetch and configure the rados ioctx
+	ioctx, err := conn.conn.GetIoctx(poolName)
+	if err != nil {
+		return nil, "", omapPoolError(err)
+	}
+	defer ioctx.Destroy()
+
+	if namespace != "" {
+		ioctx.SetNamespace(namespace)
+	}
+
+	entries := []omapEntry{}
+	for {
+		// fetch one entry more than needed, so that we know if there is
+		// a next page to be listed
+		fetch := chunkSize
+		if maxEntries > 0 && maxEntries-int64(len(entries))+1 < fetch {
+			fetch = maxEntries - int64(len(entries)) + 1
+		}
+
+		seen := int64(0)
+		err = ioctx.ListOmapValues(
+			oid, startAfter, prefix, fetch,
+			func(key string, value []byte) {
+				seen++
+				startAfter = key
+				entries = append(entries, omapEntry{key: key, value: string(value)})
+			},
+		)
+		// if we hit an error, or the omap has no more keys, exit the loop
+		if err != nil || seen < fetch {
+			break
+		}
+		if maxEntries > 0 && int64(len(entries)) > maxEntries {
+			break
+		}
+	}
+	countOMapOperation(poolName, omapList, len(entries), err)
+
+	if err != nil {
+		if errors.Is(err, rados.ErrNotFound) {
+			log.ErrorLog(ctx, "omap not found (pool=%q, namespace=%q, name=%q): %v",
+				poolName, namespace, oid, err)
+
+			return nil, "", util.JoinErrors(util.ErrKeyNotFound, err)
+		}
+
+		return nil, "", err
+	}
+
+	next := ""
+	if maxEntries > 0 && int64(len(entries)) > maxEntries {
+		entries = entries[:maxEntries]
+		next = entries[maxEntries-1].key
+	}
+
+	log.DebugLog(ctx, "listed %d omap values: (pool=%q, namespace=%q, name=%q, next=%q)",
+		len(entries), poolName, namespace, oid, next)
+
+	return entries, next, nil
+}
+
 func removeMapKeys(
 	ctx context.Context,
 	conn *Connection,
 	poolName, namespace, oid string, keys []string,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "journal.removeMapKeys")
+	defer span.End()
+
 	// fetch and configure the rados ioctx
 	ioctx, err := conn.conn.GetIoctx(poolName)
 	if err != nil {
@@ -108,6 +197,7 @@ func removeMapKeys(
 	}
 
 	err = ioctx.RmOmapKeys(oid, keys)
+	countOMapOperation(poolName, omapRemove, len(keys), err)
 	if err != nil {
 		if errors.Is(err, rados.ErrNotFound) {
 			// the previous implementation of removing omap keys (via the cli)
@@ -133,6 +223,9 @@ func setOMapKeys(
 	conn *Connection,
 	poolName, namespace, oid string, pairs map[string]string,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "journal.setOMapKeys")
+	defer span.End()
+
 	// fetch and configure the rados ioctx
 	ioctx, err := conn.conn.GetIoctx(poolName)
 	if err != nil {
@@ -149,6 +242,7 @@ func setOMapKeys(
 		bpairs[k] = []byte(v)
 	}
 	err = ioctx.SetOmap(oid, bpairs)
+	countOMapOperation(poolName, omapSet, len(pairs), err)
 	if err != nil {
 		log.ErrorLog(ctx, "failed setting omap keys (pool=%q, namespace=%q, name=%q, pairs=%+v): %v",
 			poolName, namespace, oid, pairs, err)
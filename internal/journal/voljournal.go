@@ -157,6 +157,14 @@ type Config struct {
 
 	// commonPrefix is the prefix common to all omap keys for this Config
 	commonPrefix string
+
+	// tenantUsageDirectory is the name of the object map with the bytes
+	// that the tenants use in a pool, keyed by tenant
+	tenantUsageDirectory string
+
+	// snapshotCountDirectory is the name of the object map with the number
+	// of snapshots of the images in a pool, keyed by source image name
+	snapshotCountDirectory string
 }
 
 // NewCSIVolumeJournal returns an instance of CSIJournal for volumes.
@@ -175,6 +183,7 @@ func NewCSIVolumeJournal(suffix string) *Config {
 		ownerKey:                "csi.volume.owner",
 		backingSnapshotIDKey:    "csi.volume.backingsnapshotid",
 		commonPrefix:            "csi.",
+		tenantUsageDirectory:    "csi.tenants." + suffix,
 	}
 }
 
@@ -193,6 +202,7 @@ func NewCSISnapshotJournal(suffix string) *Config {
 		encryptKMSKey:           "csi.volume.encryptKMS",
 		ownerKey:                "csi.volume.owner",
 		commonPrefix:            "csi.",
+		snapshotCountDirectory:  "csi.snaps.counts." + suffix,
 	}
 }
 
@@ -321,22 +331,15 @@ func (conn *Connection) CheckReservation(ctx context.Context,
 		return nil, nil
 	}
 
-	// check UUID only encoded value
-	if len(objUUIDAndPool) == uuidEncodedLength {
-		objUUID = objUUIDAndPool
-		savedImagePool = journalPool
-	} else { // check poolID/UUID encoding; extract the vol UUID and pool name
-		var buf64 []byte
-		components := strings.Split(objUUIDAndPool, "/")
-		objUUID = components[1]
-		savedImagePoolIDStr := components[0]
-
-		buf64, err = hex.DecodeString(savedImagePoolIDStr)
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode string: %w", err)
-		}
-		savedImagePoolID = int64(binary.BigEndian.Uint64(buf64))
+	objUUID, savedImagePoolID, err = decodeNameKeyValue(objUUIDAndPool)
+	if err != nil {
+		return nil, err
+	}
 
+	if savedImagePoolID == util.InvalidPoolID {
+		// UUID only encoded value, the image is in the journal pool
+		savedImagePool = journalPool
+	} else {
 		savedImagePool, err = util.GetPoolName(conn.monitors, conn.cr, savedImagePoolID)
 		if err != nil {
 			if errors.Is(err, util.ErrPoolNotFound) {
@@ -386,6 +389,7 @@ func (conn *Connection) CheckReservation(ctx context.Context,
 		if savedImageAttributes.SourceName != snapParentName {
 			// NOTE: This can happen if there is a snapname conflict, and we already have a snapshot
 			// with the same name pointing to a different UUID as the source
+			reservationConflicts.WithLabelValues(conflictSnapName).Inc()
 			err = fmt.Errorf("%w: snapname points to different volume, request name (%s)"+
 				" source name (%s) : saved source name (%s)", util.ErrSnapNameConflict,
 				reqName, snapParentName, savedImageAttributes.SourceName)
@@ -404,6 +408,143 @@ func (conn *Connection) CheckReservation(ctx context.Context,
 	return imageData, nil
 }
 
+// decodeNameKeyValue decodes the value of a request name key in the
+// csiDirectory. The value is either the UUID of the volume, or the ID of the
+// pool holding the volume (hex encoded, in big endian format) and the UUID,
+// separated by a "/". The returned pool ID is util.InvalidPoolID when the
+// value contains only the UUID.
+func decodeNameKeyValue(value string) (string, int64, error) {
+	if len(value) == uuidEncodedLength {
+		return value, util.InvalidPoolID, nil
+	}
+
+	components := strings.Split(value, "/")
+	if len(components) != 2 {
+		return "", util.InvalidPoolID, fmt.Errorf("failed to parse journal value %q", value)
+	}
+
+	buf64, err := hex.DecodeString(components[0])
+	if err != nil {
+		return "", util.InvalidPoolID, fmt.Errorf("failed to decode string: %w", err)
+	}
+
+	return components[1], int64(binary.BigEndian.Uint64(buf64)), nil
+}
+
+// Reservation describes a request name that is reserved in the csiDirectory.
+type Reservation struct {
+	// RequestName is the CO generated name of the volume or snapshot
+	RequestName string
+	// ImageUUID is the UUID of the reserved volume or snapshot
+	ImageUUID string
+	// ImagePoolID is the ID of the pool the volume or snapshot is stored
+	// in, util.InvalidPoolID if it is stored in the journal pool
+	ImagePoolID int64
+}
+
+/*
+ListReservations lists the reservations stored in the csiDirectory of the journalPool, ordered by
+request name.
+
+As the directory may contain a large number of reservations, it can be listed page by page. The
+listing starts after the passed startingToken (an empty token lists from the beginning), and
+returns at most maxEntries reservations (0 lists all reservations at once).
+
+Return values:
+	- []Reservation: the reservations of the requested page
+	- string: token to pass as startingToken to list the next page, empty if there are no more
+	  reservations
+	- error: non-nil in case of any errors
+*/
+func (conn *Connection) ListReservations(ctx context.Context,
+	journalPool, startingToken string, maxEntries int,
+) ([]Reservation, string, error) {
+	cj := conn.config
+
+	if maxEntries < 0 {
+		return nil, "", fmt.Errorf("invalid maximum number of entries: %d", maxEntries)
+	}
+
+	startAfter := ""
+	if startingToken != "" {
+		startAfter = cj.csiNameKeyPrefix + startingToken
+	}
+
+	entries, next, err := listOMapValues(
+		ctx, conn, journalPool, cj.namespace, cj.csiDirectory,
+		cj.csiNameKeyPrefix, startAfter, int64(maxEntries))
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			// pool or omap (oid) was not present, nothing has been
+			// reserved yet
+			return []Reservation{}, "", nil
+		}
+
+		return nil, "", err
+	}
+
+	reservations := make([]Reservation, 0, len(entries))
+	for _, entry := range entries {
+		uid, poolID, err := decodeNameKeyValue(entry.value)
+		if err != nil {
+			// the directory also stores the volume handle mappings of
+			// ReserveNewUUIDMapping, these are not reservations
+			log.DebugLog(ctx, "skipping journal entry %q: %v", entry.key, err)
+
+			continue
+		}
+
+		reservations = append(reservations, Reservation{
+			RequestName: strings.TrimPrefix(entry.key, cj.csiNameKeyPrefix),
+			ImageUUID:   uid,
+			ImagePoolID: poolID,
+		})
+	}
+
+	if next != "" {
+		next = strings.TrimPrefix(next, cj.csiNameKeyPrefix)
+	}
+
+	return reservations, next, nil
+}
+
+/*
+LookupReservation returns the reservation of the request name in the csiDirectory, or nil if the
+request name is not reserved. Unlike CheckReservation it only reads the csiDirectory, stale
+reservations are not cleaned up, so it can be called without holding the lock of the request name.
+*/
+func (conn *Connection) LookupReservation(ctx context.Context,
+	journalPool, reqName string,
+) (*Reservation, error) {
+	cj := conn.config
+
+	values, err := getOMapValues(
+		ctx, conn, journalPool, cj.namespace, cj.csiDirectory,
+		cj.commonPrefix, []string{cj.csiNameKeyPrefix + reqName})
+	if err != nil {
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+	objUUIDAndPool, found := values[cj.csiNameKeyPrefix+reqName]
+	if !found {
+		return nil, nil
+	}
+
+	uid, poolID, err := decodeNameKeyValue(objUUIDAndPool)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Reservation{
+		RequestName: reqName,
+		ImageUUID:   uid,
+		ImagePoolID: poolID,
+	}, nil
+}
+
 /*
 UndoReservation undoes a reservation, in the reverse order of ReserveName
 - The UUID directory is cleaned up before the VolName key in the csiDirectory is cleaned up
@@ -492,6 +633,7 @@ func reserveOMapName(
 			// if the volUUID is empty continue with retry as consumer of this
 			// function didn't request to create object with specific value.
 			if volUUID == "" && errors.Is(err, util.ErrObjectExists) {
+				reservationConflicts.WithLabelValues(conflictUUID).Inc()
 				attempt++
 				// try again with a different uuid, for maxAttempts tries
 				log.DebugLog(ctx, "uuid (%s) conflict detected, retrying (attempt %d of %d)",
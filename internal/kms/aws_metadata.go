@@ -63,6 +63,7 @@ const (
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeAWSMetadata,
 	Initializer: initAWSMetadataKMS,
+	Validator:   requireOptions(awsRegionKey),
 })
 
 type awsMetadataKMS struct {
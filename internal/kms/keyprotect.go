@@ -59,6 +59,7 @@ const (
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeKeyProtectMetadata,
 	Initializer: initKeyProtectKMS,
+	Validator:   requireOptions(keyProtectServiceInstanceID),
 })
 
 // KeyProtectKMS store the KMS connection information retrieved from the kms configmap.
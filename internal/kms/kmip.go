@@ -79,6 +79,7 @@ const (
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeKMIP,
 	Initializer: initKMIPKMS,
+	Validator:   requireOptions(kmipEndpoint),
 })
 
 type kmipKMS struct {
@@ -19,11 +19,13 @@ package kms
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/ceph/ceph-csi/internal/util/k8s"
 
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -91,42 +93,108 @@ func GetKMS(tenant, kmsID string, secrets map[string]string) (EncryptionKMS, err
 // that fails the ConfigMap directly. The returned map contains all the KMS
 // configuration sections, each keyed by its own kmsID.
 func getKMSConfiguration() (map[string]interface{}, error) {
+	config, err := readKMSConfigFile(kmsConfigPath)
+	if !errors.Is(err, os.ErrNotExist) {
+		return config, err
+	}
+
+	// If the configmap is not mounted to the CSI pods read the
+	// configmap the kubernetes.
+	return getKMSConfigMap()
+}
+
+// readKMSConfigFile reads the KMS configuration file at the path, the error
+// wraps os.ErrNotExist when the file does not exist.
+func readKMSConfigFile(path string) (map[string]interface{}, error) {
 	var config map[string]interface{}
 	// #nosec
-	content, err := os.ReadFile(kmsConfigPath)
-	if err == nil {
-		// kmsConfigPath exists and was successfully read
-		err = json.Unmarshal(content, &config)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse KMS "+
-				"configuration: %w", err)
-		}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read KMS "+
+			"configuration from %s: %w", path, err)
+	}
+
+	err = json.Unmarshal(content, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse KMS "+
+			"configuration: %w", err)
+	}
+
+	return config, nil
+}
+
+// ValidateConfiguration reads the KMS configuration like GetKMS, from the
+// configuration file or the ConfigMap, and checks that each section names a
+// registered provider and has the options that the provider requires. With a
+// path, only the configuration file at the path is read. The providers are
+// not initialized, that may need the secrets of a tenant. The errors of the
+// sections are returned by kmsID, nil is returned when there is no KMS
+// configuration, like when the ConfigMap or the namespace of the pod does not
+// exist.
+func ValidateConfiguration(path string) (map[string]error, error) {
+	var (
+		config map[string]interface{}
+		err    error
+	)
+	if path != "" {
+		config, err = readKMSConfigFile(path)
 	} else {
-		// an error occurred while reading kmsConfigPath
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to read KMS "+
-				"configuration from %s: %w", kmsConfigPath,
-				err)
-		}
+		config, err = getKMSConfiguration()
+	}
+	if apierrors.IsNotFound(err) || errors.Is(err, errPodNamespaceNotSet) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return validateConfiguration(config), nil
+}
+
+// validateConfiguration returns the errors of the sections of the KMS
+// configuration, by kmsID.
+func validateConfiguration(config map[string]interface{}) map[string]error {
+	errs := map[string]error{}
+	for kmsID, section := range config {
+		kmsConfig, ok := section.(map[string]interface{})
+		if !ok {
+			errs[kmsID] = fmt.Errorf("failed to convert KMS configuration section: %s", kmsID)
 
-		// If the configmap is not mounted to the CSI pods read the
-		// configmap the kubernetes.
-		config, err = getKMSConfigMap()
+			continue
+		}
+		providerName, err := getProvider(kmsConfig)
 		if err != nil {
-			return nil, err
+			errs[kmsID] = err
+
+			continue
+		}
+		provider, ok := kmsManager.providers[providerName]
+		if !ok {
+			errs[kmsID] = fmt.Errorf("could not find KMS provider %q", providerName)
+
+			continue
+		}
+		if provider.Validator != nil {
+			if err = provider.Validator(kmsConfig); err != nil {
+				errs[kmsID] = err
+			}
 		}
 	}
 
-	return config, nil
+	return errs
 }
 
+// errPodNamespaceNotSet is returned when the namespace of the pod is not set
+// in the environment.
+var errPodNamespaceNotSet = errors.New("namespace of the pod is not set")
+
 // getPodNamespace reads the `podNamespaceEnv` from the environment and returns
 // its value. In case the namespace can not be detected, an error is returned.
 func getPodNamespace() (string, error) {
 	ns := os.Getenv(podNamespaceEnv)
 	if ns == "" {
-		return "", fmt.Errorf("%q is not set in the environment",
-			podNamespaceEnv)
+		return "", fmt.Errorf("%w: %q is not set in the environment",
+			errPodNamespaceNotSet, podNamespaceEnv)
 	}
 
 	return ns, nil
@@ -228,9 +296,17 @@ type ProviderInitArgs struct {
 // instantiated.
 type ProviderInitFunc func(args ProviderInitArgs) (EncryptionKMS, error)
 
+// ProviderValidateFunc checks the configuration section of the Provider
+// without connecting to the KMS, it returns an error when a required option
+// is missing.
+type ProviderValidateFunc func(config map[string]interface{}) error
+
 type Provider struct {
 	UniqueID    string
 	Initializer ProviderInitFunc
+	// Validator is optional, without it only the provider of the
+	// configuration is checked
+	Validator ProviderValidateFunc
 }
 
 type kmsProviderList struct {
@@ -295,7 +371,12 @@ func (kf *kmsProviderList) buildKMS(
 		kmsInitArgs.Namespace = ns
 	}
 
-	return provider.Initializer(kmsInitArgs)
+	ekms, err := provider.Initializer(kmsInitArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return instrument(providerName, ekms), nil
 }
 
 func GetDefaultKMS(secrets map[string]string) (EncryptionKMS, error) {
@@ -308,7 +389,12 @@ func GetDefaultKMS(secrets map[string]string) (EncryptionKMS, error) {
 		Secrets: secrets,
 	}
 
-	return provider.Initializer(kmsInitArgs)
+	ekms, err := provider.Initializer(kmsInitArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	return instrument(DefaultKMSType, ekms), nil
 }
 
 // EncryptionKMS provides external Key Management System for encryption
@@ -377,6 +463,29 @@ func (i integratedDEK) DecryptDEK(volumeID, encyptedDEK string) (string, error)
 	return encyptedDEK, nil
 }
 
+// CheckConnection checks that the KMS can be used for the volume, without
+// storing anything in it. A KMS that stores the DEKs is asked for the DEK of
+// the volume, which does not need to exist, other KMS providers encrypt a new
+// DEK.
+func CheckConnection(ekms EncryptionKMS, volumeID string) error {
+	if ekms.RequiresDEKStore() != DEKStoreIntegrated {
+		_, err := ekms.EncryptDEK(volumeID, "dry-run")
+
+		return err
+	}
+
+	dekStore, ok := ekms.(DEKStore)
+	if !ok {
+		return fmt.Errorf("KMS %T does not implement the DEKStore interface", ekms)
+	}
+	_, err := dekStore.FetchDEK(volumeID)
+	if err != nil && errorClass(err) != resultNotFound {
+		return err
+	}
+
+	return nil
+}
+
 // getKeys takes a map that uses strings for keys and returns a slice with the
 // keys.
 func getKeys(m map[string]interface{}) []string {
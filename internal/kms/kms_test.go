@@ -17,6 +17,9 @@ limitations under the License.
 package kms
 
 import (
+	"errors"
+	"fmt"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -53,3 +56,132 @@ func TestRegisterProvider(t *testing.T) {
 		}
 	}
 }
+
+// TestValidateConfiguration does not run in parallel, TestRegisterProvider
+// registers providers concurrently otherwise.
+func TestValidateConfiguration(t *testing.T) {
+	config := map[string]interface{}{
+		"secrets-metadata": map[string]interface{}{
+			kmsTypeKey: kmsTypeSecretsMetadata,
+		},
+		"legacy": map[string]interface{}{
+			kmsProviderKey: kmsTypeSecretsMetadata,
+		},
+		"unknown-type": map[string]interface{}{
+			kmsTypeKey: "no-such-kms",
+		},
+		"no-type": map[string]interface{}{
+			"vaultAddress": "https://vault.example.com",
+		},
+		"not-a-section": "vault",
+		"vault": map[string]interface{}{
+			kmsTypeKey:     kmsTypeVault,
+			"vaultAddress": "https://vault.example.com",
+		},
+		"vault-no-address": map[string]interface{}{
+			kmsTypeKey: kmsTypeVault,
+		},
+		"vault-tokens-configmap": map[string]interface{}{
+			kmsProviderKey: kmsTypeVaultTokens,
+			"VAULT_ADDR":   "https://vault.example.com",
+		},
+		"vault-tokens-configmap-no-address": map[string]interface{}{
+			kmsProviderKey: kmsTypeVaultTokens,
+		},
+		"kmip-no-endpoint": map[string]interface{}{
+			kmsProviderKey: kmsTypeKMIP,
+		},
+	}
+
+	errs := validateConfiguration(config)
+	assert.Len(t, errs, 6)
+	for _, kmsID := range []string{"unknown-type", "no-type", "not-a-section"} {
+		assert.Error(t, errs[kmsID], kmsID)
+	}
+	for _, kmsID := range []string{"vault-no-address", "vault-tokens-configmap-no-address", "kmip-no-endpoint"} {
+		assert.ErrorIs(t, errs[kmsID], errConfigOptionMissing, kmsID)
+	}
+}
+
+// TestValidateConfigurationFile does not run in parallel, like
+// TestValidateConfiguration.
+func TestValidateConfigurationFile(t *testing.T) {
+	path := t.TempDir() + "/config.json"
+
+	_, err := ValidateConfiguration(path)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	err = os.WriteFile(path, []byte(`{"vault": {"encryptionKMSType": "vault"}}`), 0o600)
+	assert.NoError(t, err)
+	errs, err := ValidateConfiguration(path)
+	assert.NoError(t, err)
+	assert.ErrorIs(t, errs["vault"], errConfigOptionMissing)
+}
+
+// fakeDEKStoreKMS stores the DEKs itself, FetchDEK returns fetchErr.
+type fakeDEKStoreKMS struct {
+	integratedDEK
+
+	fetchErr error
+}
+
+func (f fakeDEKStoreKMS) Destroy() {}
+
+func (f fakeDEKStoreKMS) StoreDEK(volumeID, dek string) error {
+	return errors.New("StoreDEK should not be called")
+}
+
+func (f fakeDEKStoreKMS) FetchDEK(volumeID string) (string, error) {
+	return "", f.fetchErr
+}
+
+func (f fakeDEKStoreKMS) RemoveDEK(volumeID string) error {
+	return errors.New("RemoveDEK should not be called")
+}
+
+// fakeMetadataKMS needs a DEKStore, EncryptDEK returns encryptErr.
+type fakeMetadataKMS struct {
+	encryptErr error
+}
+
+func (f fakeMetadataKMS) Destroy() {}
+
+func (f fakeMetadataKMS) RequiresDEKStore() DEKStoreType {
+	return DEKStoreMetadata
+}
+
+func (f fakeMetadataKMS) EncryptDEK(volumeID, plainDEK string) (string, error) {
+	return plainDEK, f.encryptErr
+}
+
+func (f fakeMetadataKMS) DecryptDEK(volumeID, encryptedDEK string) (string, error) {
+	return encryptedDEK, nil
+}
+
+func TestCheckConnection(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		kms     EncryptionKMS
+		wantErr bool
+	}{
+		{"DEK found", fakeDEKStoreKMS{}, false},
+		{"DEK not found", fakeDEKStoreKMS{fetchErr: fmt.Errorf("fetch: %w", errors.New("secret not found"))}, false},
+		{"KMS unreachable", fakeDEKStoreKMS{fetchErr: errors.New("dial tcp: connection refused")}, true},
+		{"DEK encrypted", fakeMetadataKMS{}, false},
+		{"encryption failed", fakeMetadataKMS{encryptErr: errors.New("access denied")}, true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckConnection(ts.kms, "csi-vol-1")
+			if ts.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
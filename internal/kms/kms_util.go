@@ -41,3 +41,22 @@ func setConfigInt(option *int, config map[string]interface{}, key string) error
 
 	return nil
 }
+
+// requireOptions returns a ProviderValidateFunc that checks that the options
+// are set to a non-empty string in the configuration.
+func requireOptions(keys ...string) ProviderValidateFunc {
+	return func(config map[string]interface{}) error {
+		for _, key := range keys {
+			value := ""
+			err := setConfigString(&value, config, key)
+			if err != nil {
+				return err
+			}
+			if value == "" {
+				return fmt.Errorf("%w: %s", errConfigOptionMissing, key)
+			}
+		}
+
+		return nil
+	}
+}
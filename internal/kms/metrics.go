@@ -0,0 +1,233 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/hashicorp/vault/api"
+	loss "github.com/libopenstorage/secrets"
+	"github.com/prometheus/client_golang/prometheus"
+	apierrs "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// operations of the KMS, used as label for the metrics.
+const (
+	opEncryptDEK = "encrypt_dek"
+	opDecryptDEK = "decrypt_dek"
+	opFetchDEK   = "fetch_dek"
+	opStoreDEK   = "store_dek"
+	opRemoveDEK  = "remove_dek"
+)
+
+// results of the KMS operations, used as label for the metrics.
+const (
+	resultSuccess  = "success"
+	resultAuth     = "auth"
+	resultNetwork  = "network"
+	resultNotFound = "not_found"
+	resultOther    = "other"
+)
+
+var (
+	kmsOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Subsystem: "kms",
+			Name:      "operations_total",
+			Help:      "Number of KMS operations by provider, operation and result (success, auth, network, not_found, other)",
+		},
+		[]string{"provider", "operation", "result"},
+	)
+	kmsOperationDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "csi",
+			Subsystem: "kms",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of KMS operations by provider and operation",
+			// 1ms up to ~30s
+			Buckets: prometheus.ExponentialBuckets(0.001, 2, 16),
+		},
+		[]string{"provider", "operation"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(kmsOperations, kmsOperationDuration)
+}
+
+// observeOperation records the duration and the result of the operation of
+// the KMS provider.
+func observeOperation(provider, operation string, start time.Time, err error) {
+	kmsOperationDuration.WithLabelValues(provider, operation).Observe(time.Since(start).Seconds())
+	kmsOperations.WithLabelValues(provider, operation, errorClass(err)).Inc()
+}
+
+// errorClass returns the class of the error that a KMS operation returned.
+// The providers use different client libraries, the typed errors of these are
+// checked first, and the message of the error if none matches.
+func errorClass(err error) string {
+	if err == nil {
+		return resultSuccess
+	}
+
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		if c := httpStatusClass(respErr.StatusCode); c != "" {
+			return c
+		}
+	}
+
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		if c := httpStatusClass(reqErr.StatusCode()); c != "" {
+			return c
+		}
+	}
+
+	switch {
+	case errors.Is(err, loss.ErrNotAuthenticated),
+		apierrs.IsUnauthorized(err), apierrs.IsForbidden(err):
+		return resultAuth
+	case errors.Is(err, loss.ErrInvalidSecretId), apierrs.IsNotFound(err):
+		return resultNotFound
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return resultNetwork
+	}
+
+	msg := strings.ToLower(err.Error())
+	contains := func(substrs ...string) bool {
+		for _, s := range substrs {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	switch {
+	case contains("permission denied", "unauthorized", "forbidden", "access denied", "accessdenied",
+		"code: 401", "code: 403", "invalid token"):
+		return resultAuth
+	case contains("connection refused", "no such host", "i/o timeout", "connection reset",
+		"deadline exceeded", "tls handshake"):
+		return resultNetwork
+	case contains("not found", "no secret data found"):
+		return resultNotFound
+	}
+
+	return resultOther
+}
+
+// httpStatusClass returns the class for a HTTP status code returned by a KMS,
+// or an empty string if the status code does not point to a specific class.
+func httpStatusClass(code int) string {
+	switch code {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return resultAuth
+	case http.StatusNotFound:
+		return resultNotFound
+	case http.StatusRequestTimeout, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resultNetwork
+	}
+
+	return ""
+}
+
+// instrumentedKMS records metrics for the operations of an EncryptionKMS.
+type instrumentedKMS struct {
+	EncryptionKMS
+
+	provider string
+}
+
+// instrumentedDEKStoreKMS records metrics for the operations of an
+// EncryptionKMS that stores the DEKs itself.
+type instrumentedDEKStoreKMS struct {
+	*instrumentedKMS
+
+	dekStore DEKStore
+}
+
+// instrument returns an EncryptionKMS that records metrics for the operations
+// of the KMS provider. The returned EncryptionKMS implements the DEKStore
+// interface only if the passed KMS does.
+func instrument(provider string, ekms EncryptionKMS) EncryptionKMS {
+	ik := &instrumentedKMS{
+		EncryptionKMS: ekms,
+		provider:      provider,
+	}
+
+	if dekStore, ok := ekms.(DEKStore); ok {
+		return &instrumentedDEKStoreKMS{
+			instrumentedKMS: ik,
+			dekStore:        dekStore,
+		}
+	}
+
+	return ik
+}
+
+func (ik *instrumentedKMS) EncryptDEK(volumeID, plainDEK string) (string, error) {
+	start := time.Now()
+	encryptedDEK, err := ik.EncryptionKMS.EncryptDEK(volumeID, plainDEK)
+	observeOperation(ik.provider, opEncryptDEK, start, err)
+
+	return encryptedDEK, err
+}
+
+func (ik *instrumentedKMS) DecryptDEK(volumeID, encryptedDEK string) (string, error) {
+	start := time.Now()
+	plainDEK, err := ik.EncryptionKMS.DecryptDEK(volumeID, encryptedDEK)
+	observeOperation(ik.provider, opDecryptDEK, start, err)
+
+	return plainDEK, err
+}
+
+func (ik *instrumentedDEKStoreKMS) StoreDEK(volumeID, dek string) error {
+	start := time.Now()
+	err := ik.dekStore.StoreDEK(volumeID, dek)
+	observeOperation(ik.provider, opStoreDEK, start, err)
+
+	return err
+}
+
+func (ik *instrumentedDEKStoreKMS) FetchDEK(volumeID string) (string, error) {
+	start := time.Now()
+	dek, err := ik.dekStore.FetchDEK(volumeID)
+	observeOperation(ik.provider, opFetchDEK, start, err)
+
+	return dek, err
+}
+
+func (ik *instrumentedDEKStoreKMS) RemoveDEK(volumeID string) error {
+	start := time.Now()
+	err := ik.dekStore.RemoveDEK(volumeID)
+	observeOperation(ik.provider, opRemoveDEK, start, err)
+
+	return err
+}
@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package kms
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/hashicorp/vault/api"
+	loss "github.com/libopenstorage/secrets"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorClass(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"no error", nil, resultSuccess},
+		{"vault forbidden", &api.ResponseError{StatusCode: 403}, resultAuth},
+		{"vault not found", fmt.Errorf("fetching: %w", &api.ResponseError{StatusCode: 404}), resultNotFound},
+		{"aws access denied", awserr.NewRequestFailure(awserr.New("AccessDeniedException", "denied", nil), 400, "id"),
+			resultAuth},
+		{"aws unavailable", awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "down", nil), 503, "id"),
+			resultNetwork},
+		{"secrets not authenticated", loss.ErrNotAuthenticated, resultAuth},
+		{"secrets not found", fmt.Errorf("get: %w", loss.ErrInvalidSecretId), resultNotFound},
+		{"dial error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, resultNetwork},
+		{"message permission denied", errors.New("Error making API request. Code: 403. permission denied"), resultAuth},
+		{"message connection refused", errors.New("dial tcp 10.0.0.1:8200: connect: connection refused"), resultNetwork},
+		{"other", errors.New("failed parsing passphrase"), resultOther},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tt.want, errorClass(tt.err))
+		})
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	t.Parallel()
+
+	// secretsKMS stores the DEK itself, the DEKStore interface is kept
+	ekms := instrument(DefaultKMSType, secretsKMS{})
+	_, ok := ekms.(DEKStore)
+	assert.True(t, ok)
+
+	// the DEKs for AWS are stored in the metadata of the volume
+	ekms = instrument(kmsTypeAWSMetadata, &awsMetadataKMS{})
+	_, ok = ekms.(DEKStore)
+	assert.False(t, ok)
+}
@@ -330,6 +330,7 @@ func (vc *vaultConnection) getDeleteKeyContext() map[string]string {
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeVault,
 	Initializer: initVaultKMS,
+	Validator:   requireOptions("vaultAddress"),
 })
 
 // InitVaultKMS returns an interface to HashiCorp Vault KMS.
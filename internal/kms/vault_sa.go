@@ -24,6 +24,7 @@ import (
 	"os"
 
 	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/libopenstorage/secrets/vault"
 	authenticationv1 "k8s.io/api/authentication/v1"
@@ -87,6 +88,7 @@ type vaultTenantSA struct {
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeVaultTenantSA,
 	Initializer: initVaultTenantSA,
+	Validator:   validateVaultTokensConfig,
 })
 
 // initVaultTenantSA returns an interface to HashiCorp Vault KMS where Tenants
@@ -326,6 +328,7 @@ func (kms *vaultTenantSA) getTokenPath() (string, error) {
 	if err != nil {
 		return "", err
 	}
+	log.RegisterSecret(token)
 
 	err = os.WriteFile(dir+"/token", []byte(token), 0o600)
 	if err != nil {
@@ -25,6 +25,7 @@ import (
 	"strconv"
 
 	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
 
 	"github.com/hashicorp/vault/api"
 	loss "github.com/libopenstorage/secrets"
@@ -213,8 +214,24 @@ type vaultTokensKMS struct {
 var _ = RegisterProvider(Provider{
 	UniqueID:    kmsTypeVaultTokens,
 	Initializer: initVaultTokensKMS,
+	Validator:   validateVaultTokensConfig,
 })
 
+// validateVaultTokensConfig checks that the configuration has the address of
+// Vault, the configuration of the ConfigMap is converted like in
+// initVaultTokensKMS.
+func validateVaultTokensConfig(config map[string]interface{}) error {
+	if _, ok := config[kmsProviderKey]; ok {
+		var err error
+		config, err = transformConfig(config)
+		if err != nil {
+			return fmt.Errorf("failed to convert configuration: %w", err)
+		}
+	}
+
+	return requireOptions("vaultAddress")(config)
+}
+
 // InitVaultTokensKMS returns an interface to HashiCorp Vault KMS.
 func initVaultTokensKMS(args ProviderInitArgs) (EncryptionKMS, error) {
 	var err error
@@ -517,6 +534,7 @@ func (kms *vaultTokensKMS) getToken() (string, error) {
 	if !ok {
 		return "", errors.New("failed to parse token")
 	}
+	log.RegisterSecret(string(token))
 
 	return string(token), nil
 }
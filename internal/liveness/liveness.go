@@ -18,6 +18,7 @@ package liveness
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
@@ -36,6 +37,41 @@ var liveness = prometheus.NewGauge(prometheus.GaugeOpts{
 	Help:      "Liveness Probe",
 })
 
+var (
+	clusterReachable = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Name:      "cluster_reachable",
+			Help:      "Whether the monitors of the Ceph cluster responded (1 reachable, 0 not)",
+		},
+		[]string{"cluster_id"},
+	)
+	clusterAuthenticated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Name:      "cluster_authenticated",
+			Help:      "Whether the Ceph cluster accepted the credentials from the CSI config file (1 accepted, 0 not)",
+		},
+		[]string{"cluster_id"},
+	)
+	clusterQuorumSize = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Name:      "cluster_mon_quorum_size",
+			Help:      "Number of monitors in quorum of the Ceph cluster, 0 when the quorum status could not be fetched",
+		},
+		[]string{"cluster_id"},
+	)
+	clusterLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Name:      "cluster_last_success_timestamp_seconds",
+			Help:      "Unix time of the last successful health check of the Ceph cluster",
+		},
+		[]string{"cluster_id"},
+	)
+)
+
 func getLiveness(timeout time.Duration, csiConn *grpc.ClientConn) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
@@ -59,13 +95,78 @@ func getLiveness(timeout time.Duration, csiConn *grpc.ClientConn) {
 	log.ExtendedLogMsg("Health check succeeded")
 }
 
-func recordLiveness(endpoint, drivername string, pollTime, timeout time.Duration) {
+// getClusterHealth connects to each cluster in the CSI config file that has
+// a credentials directory configured, and records whether the cluster
+// responded, accepted the credentials and has monitors in quorum. Clusters
+// without credentials can not be checked and are skipped.
+func getClusterHealth(timeout time.Duration) {
+	clusterIDs, err := util.GetClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		log.ErrorLogMsg("failed to get clusters for health check: %v", err)
+
+		return
+	}
+
+	for _, clusterID := range clusterIDs {
+		health, err := checkClusterHealth(clusterID, timeout)
+		if errors.Is(err, util.ErrNoCredentials) {
+			log.TraceLogMsg("skipping health check of cluster %q: %v", clusterID, err)
+
+			continue
+		}
+
+		record := util.RecordMetricLabel(util.MetricLabelClusterID, clusterID)
+		if record {
+			clusterReachable.WithLabelValues(clusterID).Set(util.BoolToFloat(health.Reachable))
+			clusterAuthenticated.WithLabelValues(clusterID).Set(util.BoolToFloat(health.Authenticated))
+			clusterQuorumSize.WithLabelValues(clusterID).Set(float64(health.QuorumSize))
+		}
+		if err != nil {
+			log.ErrorLogMsg("health check of cluster %q failed: %v", clusterID, err)
+
+			continue
+		}
+		if record {
+			clusterLastSuccess.WithLabelValues(clusterID).SetToCurrentTime()
+		}
+		log.ExtendedLogMsg("cluster %q is healthy, %d monitors in quorum", clusterID, health.QuorumSize)
+	}
+}
+
+// checkClusterHealth checks the health of the cluster with the credentials
+// from the credentials directory in the CSI config file.
+func checkClusterHealth(clusterID string, timeout time.Duration) (util.ClusterHealth, error) {
+	cr, err := util.NewCredentialsFromFiles(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return util.ClusterHealth{}, err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, err := util.Mons(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return util.ClusterHealth{}, err
+	}
+
+	return util.CheckClusterHealth(monitors, cr, timeout)
+}
+
+func recordLiveness(endpoint, drivername string, pollTime, timeout time.Duration, clusterPing bool) {
 	liveMetricsManager := metrics.NewCSIMetricsManager(drivername)
 	// register prometheus metrics
 	err := prometheus.Register(liveness)
 	if err != nil {
 		log.FatalLogMsg(err.Error())
 	}
+	if clusterPing {
+		for _, c := range []prometheus.Collector{
+			clusterReachable, clusterAuthenticated, clusterQuorumSize, clusterLastSuccess,
+		} {
+			err = prometheus.Register(c)
+			if err != nil {
+				log.FatalLogMsg(err.Error())
+			}
+		}
+	}
 
 	csiConn, err := connlib.Connect(endpoint, liveMetricsManager)
 	if err != nil {
@@ -79,6 +180,9 @@ func recordLiveness(endpoint, drivername string, pollTime, timeout time.Duration
 	defer ticker.Stop()
 	for range ticker.C {
 		getLiveness(timeout, csiConn)
+		if clusterPing {
+			getClusterHealth(timeout)
+		}
 	}
 }
 
@@ -87,7 +191,7 @@ func Run(conf *util.Config) {
 	log.ExtendedLogMsg("Liveness Running")
 
 	// start liveness collection
-	go recordLiveness(conf.Endpoint, conf.DriverName, conf.PollTime, conf.PoolTimeout)
+	go recordLiveness(conf.Endpoint, conf.DriverName, conf.PollTime, conf.PoolTimeout, conf.LivenessClusterPing)
 
 	// start up prometheus endpoint
 	util.StartMetricsServer(conf)
@@ -69,25 +69,39 @@ func (fs *Driver) Run(conf *util.Config) {
 
 	switch {
 	case conf.IsNodeServer:
-		srv.NS = nodeserver.NewNodeServer(cd, conf.Vtype)
+		srv.NS = newNodeServer(cd, conf)
 	case conf.IsControllerServer:
 		srv.CS = controller.NewControllerServer(cd)
 	default:
-		srv.NS = nodeserver.NewNodeServer(cd, conf.Vtype)
+		srv.NS = newNodeServer(cd, conf)
 		srv.CS = controller.NewControllerServer(cd)
 	}
 
-	server.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableGRPCMetrics)
-	if conf.EnableGRPCMetrics {
-		log.WarningLogMsg("EnableGRPCMetrics is deprecated")
+	server.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableMetrics)
+	if conf.EnableMetrics {
 		go util.StartMetricsServer(conf)
 	}
 	if conf.EnableProfiling {
-		if !conf.EnableGRPCMetrics {
+		if !conf.EnableMetrics {
 			go util.StartMetricsServer(conf)
 		}
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
+	go csicommon.StopOnSignal(server, conf.ShutdownTimeout)
 	server.Wait()
+	util.CloseConnections()
+}
+
+// newNodeServer creates the node server with the mount options policy of the
+// configuration.
+func newNodeServer(cd *csicommon.CSIDriver, conf *util.Config) *nodeserver.NodeServer {
+	ns := nodeserver.NewNodeServer(cd, conf.Vtype)
+	policy, err := util.LoadMountOptionsPolicy(conf.MountOptionsPolicy)
+	if err != nil {
+		log.FatalLogMsg(err.Error())
+	}
+	ns.MountOptionsPolicy = policy
+
+	return ns
 }
@@ -46,6 +46,9 @@ const (
 // node server spec.
 type NodeServer struct {
 	csicommon.DefaultNodeServer
+	// MountOptionsPolicy adds default mount options to the volumes, and
+	// rejects denied options, nil when there is no policy
+	MountOptionsPolicy *util.MountOptionsPolicy
 }
 
 // NewNodeServer initialize a node server for ceph CSI driver.
@@ -71,7 +74,10 @@ func (ns *NodeServer) NodePublishVolume(
 	volumeID := req.GetVolumeId()
 	volCap := req.GetVolumeCapability()
 	targetPath := req.GetTargetPath()
-	mountOptions := volCap.GetMount().GetMountFlags()
+	mountOptions, err := ns.MountOptionsPolicy.Apply("nfs", volCap.GetMount().GetMountFlags())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
 	if req.GetReadonly() {
 		mountOptions = append(mountOptions, "ro")
 	}
@@ -126,6 +132,7 @@ func (ns *NodeServer) NodeUnpublishVolume(
 
 	volumeID := req.GetVolumeId()
 	targetPath := req.GetTargetPath()
+	ns.StatsCache.Forget(targetPath)
 	log.DebugLog(ctx, "nfs: unmounting volume %s on %s", volumeID, targetPath)
 	err = mount.CleanupMountPoint(targetPath, ns.Mounter, true)
 	if err != nil {
@@ -168,13 +175,21 @@ func (ns *NodeServer) NodeGetVolumeStats(
 	ctx context.Context,
 	req *csi.NodeGetVolumeStatsRequest,
 ) (*csi.NodeGetVolumeStatsResponse, error) {
-	var err error
 	targetPath := req.GetVolumePath()
 	if targetPath == "" {
 		return nil, status.Error(codes.InvalidArgument,
 			fmt.Sprintf("targetpath %v is empty", targetPath))
 	}
 
+	return ns.StatsCache.Get(ctx, targetPath, ns.getVolumeStats)
+}
+
+// getVolumeStats returns the stats of the NFS export that is mounted on the
+// targetPath.
+func (ns *NodeServer) getVolumeStats(
+	ctx context.Context,
+	targetPath string,
+) (*csi.NodeGetVolumeStatsResponse, error) {
 	stat, err := os.Stat(targetPath)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument,
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// adminVolumeIDParam is the parameter of the admin commands with the ID of
+// the volume.
+const adminVolumeIDParam = "volume-id"
+
+// RegisterAdminCommands registers the "flatten" and "resync" commands of the
+// admin socket. The commands take the lock of the volume like the CSI
+// procedures, and use the credentials directory of the cluster of the volume.
+// Journals need to be initialized with InitJournals.
+func RegisterAdminCommands(locks *util.VolumeLocks) {
+	util.RegisterAdminCommand("flatten", util.AdminCommand{
+		Usage: "flatten the image of the volume-id now, like a clone that reached the hard clone depth",
+		Run: func(ctx context.Context, params url.Values) (string, error) {
+			return runAdminVolumeCommand(ctx, params, locks, flattenNow)
+		},
+	})
+	util.RegisterAdminCommand("resync", util.AdminCommand{
+		Usage: "force a resync of the secondary mirrored image of the volume-id, which discards its local changes",
+		Run: func(ctx context.Context, params url.Values) (string, error) {
+			return runAdminVolumeCommand(ctx, params, locks, forceResync)
+		},
+	})
+}
+
+// runAdminVolumeCommand runs the command for the volume of the volume-id
+// parameter, while holding the lock of the volume.
+func runAdminVolumeCommand(
+	ctx context.Context,
+	params url.Values,
+	locks *util.VolumeLocks,
+	command func(context.Context, *rbdVolume) (string, error),
+) (string, error) {
+	volumeID := params.Get(adminVolumeIDParam)
+	if volumeID == "" {
+		return "", status.Errorf(codes.InvalidArgument, "missing %s parameter", adminVolumeIDParam)
+	}
+	var vi util.CSIIdentifier
+	err := vi.DecomposeCSIID(volumeID)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "invalid volume ID %q: %v", volumeID, err)
+	}
+
+	if acquired := locks.TryAcquire(volumeID); !acquired {
+		return "", status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
+	}
+	defer locks.Release(volumeID)
+
+	cr, err := listCredentials(vi.ClusterID, nil)
+	if errors.Is(err, util.ErrNoCredentials) {
+		return "", status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	defer cr.DeleteCredentials()
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	defer rbdVol.Destroy()
+	if errors.Is(err, ErrImageNotFound) || errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		return "", status.Errorf(codes.NotFound, "volume %s not found: %v", volumeID, err)
+	}
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+
+	return command(ctx, rbdVol)
+}
+
+// flattenNow flattens the image of the volume, or adds a task to the Ceph
+// manager to flatten it.
+func flattenNow(ctx context.Context, rbdVol *rbdVolume) (string, error) {
+	if rbdVol.ParentName == "" {
+		return fmt.Sprintf("image %s has no parent, it does not need to be flattened\n", rbdVol), nil
+	}
+
+	err := rbdVol.flattenRbdImage(ctx, true, rbdHardMaxCloneDepth, rbdSoftMaxCloneDepth)
+	if errors.Is(err, ErrFlattenInProgress) {
+		return fmt.Sprintf("added a task to flatten image %s\n", rbdVol), nil
+	}
+	if err != nil {
+		return "", status.Errorf(codes.Internal, "failed to flatten image %s: %v", rbdVol, err)
+	}
+	log.DebugLog(ctx, "flattened image %s on request of the admin socket", rbdVol)
+
+	return fmt.Sprintf("flattened image %s\n", rbdVol), nil
+}
+
+// forceResync requests a resync of the secondary mirrored image of the
+// volume. RBD mirroring deletes the local image and syncs it again from the
+// primary image.
+func forceResync(ctx context.Context, rbdVol *rbdVolume) (string, error) {
+	mirroringInfo, err := rbdVol.getImageMirroringInfo()
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	if mirroringInfo.State != librbd.MirrorImageEnabled {
+		return "", status.Errorf(codes.FailedPrecondition, "mirroring is not enabled for image %s", rbdVol)
+	}
+	if mirroringInfo.Primary {
+		return "", status.Errorf(codes.FailedPrecondition, "image %s is primary, only secondary images can be resynced",
+			rbdVol)
+	}
+
+	err = rbdVol.resyncImage()
+	if err != nil {
+		return "", status.Error(codes.Internal, err.Error())
+	}
+	log.DebugLog(ctx, "requested resync of image %s on request of the admin socket", rbdVol)
+
+	return fmt.Sprintf("requested a resync of image %s\n", rbdVol), nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// clusterSource is the source of the findings of the checks against a
+// cluster.
+const clusterSource = "cluster"
+
+// ValidateClusterPools connects to the cluster with the credentials, and
+// checks that the pools exist, and that the RADOS namespace of the cluster
+// exists in each of them.
+func ValidateClusterPools(cluster *util.ClusterInfo, pools []string, cr *util.Credentials) util.ConfigFindings {
+	var findings util.ConfigFindings
+	conn := &util.ClusterConnection{}
+	err := conn.Connect(strings.Join(cluster.Monitors, ","), cr)
+	if err != nil {
+		findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "failed to connect: %v", err)
+
+		return findings
+	}
+	defer conn.Destroy()
+
+	radosNamespace := cluster.RBD.RadosNamespace
+	if radosNamespace == "" {
+		radosNamespace = cluster.RadosNamespace
+	}
+	for _, pool := range pools {
+		ioctx, err := conn.GetIoctx(pool)
+		if errors.Is(err, util.ErrPoolNotFound) {
+			findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "pool %q does not exist", pool)
+
+			continue
+		}
+		if err != nil {
+			findings.Add(util.FindingError, clusterSource, cluster.ClusterID, "%v", err)
+
+			continue
+		}
+		if radosNamespace != "" {
+			exists, err := librbd.NamespaceExists(ioctx, radosNamespace)
+			switch {
+			case err != nil:
+				findings.Add(util.FindingError, clusterSource, cluster.ClusterID,
+					"failed to check RADOS namespace %q in pool %q: %v", radosNamespace, pool, err)
+			case !exists:
+				findings.Add(util.FindingError, clusterSource, cluster.ClusterID,
+					"RADOS namespace %q does not exist in pool %q", radosNamespace, pool)
+			}
+		}
+		ioctx.Destroy()
+	}
+
+	return findings
+}
@@ -20,9 +20,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"os/exec"
 	"strconv"
 
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
+	"github.com/ceph/ceph-csi/internal/journal"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/k8s"
 	"github.com/ceph/ceph-csi/internal/util/log"
@@ -50,14 +52,29 @@ type ControllerServer struct {
 	// for that same snapshot (as defined by SnapshotID/snapshot name) return an Aborted error
 	SnapshotLocks *util.VolumeLocks
 
+	// A map storing all source volumes with an ongoing CreateSnapshot, so
+	// that snapshots of the same volume are created one after another
+	SnapshotSourceLocks *util.VolumeLocks
+
 	// A map storing all volumes/snapshots with ongoing operations.
 	OperationLocks *util.OperationLock
 
+	// MaxSnapshotsPerVolume is the default maximum number of snapshots of a
+	// volume, 0 is unlimited
+	MaxSnapshotsPerVolume uint
+
+	// A cache of recent CreateVolume responses, used to answer retries of
+	// completed requests without checking the reservation again
+	CreateVolumeCache *util.CreateVolumeCache
+
 	// Cluster name
 	ClusterName string
 
 	// Set metadata on volume
 	SetMetadata bool
+
+	// StrictParameters rejects requests with unknown parameters
+	StrictParameters bool
 }
 
 func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.CreateVolumeRequest) error {
@@ -91,6 +108,12 @@ func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.Crea
 	if value, ok := options["volumeNamePrefix"]; ok && value == "" {
 		return status.Error(codes.InvalidArgument, "empty volume name prefix to provision volume from")
 	}
+	if err := util.ValidateNamePrefix("volumeNamePrefix", options["volumeNamePrefix"]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := validateMounter(options["mounter"]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 
 	// Allow readonly access mode for volume with content source
 	err := util.CheckReadOnlyManyIsSupported(req)
@@ -103,9 +126,47 @@ func (cs *ControllerServer) validateVolumeReq(ctx context.Context, req *csi.Crea
 		return status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	err = validateXfsOptions(req.GetParameters(), req.GetVolumeCapabilities())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = validateMkfsOptions(req.GetParameters(), req.GetVolumeCapabilities())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = validateFsType(req.GetVolumeCapabilities(), exec.LookPath)
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	err = validateMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	if cs.StrictParameters {
+		err = checkVolumeParameters(req.GetParameters())
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
 	return nil
 }
 
+// validateMounter checks that the mounter parameter is empty, or one of the
+// mounters that the nodeplugin can map images with.
+func validateMounter(mounter string) error {
+	switch mounter {
+	case "", rbdDefaultMounter, rbdNbdMounter:
+		return nil
+	}
+
+	return fmt.Errorf("unknown mounter %q, valid options are %q and %q", mounter, rbdDefaultMounter, rbdNbdMounter)
+}
+
 func validateStriping(parameters map[string]string) error {
 	stripeUnit := parameters["stripeUnit"]
 	stripeCount := parameters["stripeCount"]
@@ -198,6 +259,29 @@ func (cs *ControllerServer) parseVolCreateRequest(
 
 	rbdVol.RequestName = req.GetName()
 
+	rbdVol.JournalLess, err = isJournalLess(req.GetParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if rbdVol.JournalLess {
+		err = validateJournalLess(rbdVol, req)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	if val, ok := req.GetParameters()[stageLockKey]; ok {
+		stageLock, pErr := strconv.ParseBool(val)
+		if pErr != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "failed to parse %s %q: %v", stageLockKey, val, pErr)
+		}
+		if stageLock {
+			err = checkStageLockCredentials(rbdVol.ClusterID)
+			if err != nil {
+				return nil, status.Error(codes.InvalidArgument, err.Error())
+			}
+		}
+	}
+
 	// Volume Size - Default is 1 GiB
 	volSizeBytes := int64(oneGB)
 	if req.GetCapacityRange() != nil {
@@ -237,6 +321,7 @@ func buildCreateVolumeResponse(req *csi.CreateVolumeRequest, rbdVol *rbdVolume)
 	if rbdVol.DataPool != "" {
 		volumeContext["dataPool"] = rbdVol.DataPool
 	}
+	util.AddTopologySegment(volumeContext, rbdVol.Topology)
 
 	volume := &csi.Volume{
 		VolumeId:      rbdVol.VolID,
@@ -273,6 +358,11 @@ func checkValidCreateVolumeRequest(rbdVol, parentVol *rbdVolume, rbdSnap *rbdSna
 	var err error
 	switch {
 	case rbdSnap != nil:
+		err = util.CheckContentSourceSize(rbdVol.VolSize, rbdSnap.VolSize, "snapshot "+rbdSnap.String())
+		if err != nil {
+			return err
+		}
+
 		err = rbdSnap.isCompatibleEncryption(&rbdVol.rbdImage)
 		if err != nil {
 			return status.Errorf(codes.InvalidArgument, "cannot restore from snapshot %s: %s", rbdSnap, err.Error())
@@ -284,6 +374,11 @@ func checkValidCreateVolumeRequest(rbdVol, parentVol *rbdVolume, rbdSnap *rbdSna
 		}
 
 	case parentVol != nil:
+		err = util.CheckContentSourceSize(rbdVol.VolSize, parentVol.VolSize, "volume "+parentVol.String())
+		if err != nil {
+			return err
+		}
+
 		err = parentVol.isCompatibleEncryption(&rbdVol.rbdImage)
 		if err != nil {
 			return status.Errorf(codes.InvalidArgument, "cannot clone from volume %s: %s", parentVol, err.Error())
@@ -308,6 +403,12 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, err
 	}
 
+	if resp := cs.CreateVolumeCache.Get(req); resp != nil {
+		log.DebugLog(ctx, "returning cached response for request name %s", req.GetName())
+
+		return resp, nil
+	}
+
 	// TODO: create/get a connection from the the ConnPool, and do not pass
 	// the credentials to any of the utility functions.
 
@@ -336,7 +437,16 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
-	parentVol, rbdSnap, err := checkContentSource(ctx, req, cr)
+	if rbdVol.JournalLess {
+		resp, jErr := cs.createJournalLessVolume(ctx, req, cr, rbdVol)
+		if jErr == nil {
+			cs.CreateVolumeCache.Add(req, resp)
+		}
+
+		return resp, jErr
+	}
+
+	parentVol, rbdSnap, err := checkContentSource(ctx, req, cr, false)
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +455,12 @@ func (cs *ControllerServer) CreateVolume(
 	if err != nil {
 		return nil, getGRPCErrorForCreateVolume(err)
 	} else if found {
-		return cs.repairExistingVolume(ctx, req, cr, rbdVol, rbdSnap)
+		resp, rErr := cs.repairExistingVolume(ctx, req, cr, rbdVol, rbdSnap)
+		if rErr == nil {
+			cs.CreateVolumeCache.Add(req, resp)
+		}
+
+		return resp, rErr
 	}
 
 	err = checkValidCreateVolumeRequest(rbdVol, parentVol, rbdSnap)
@@ -358,6 +473,20 @@ func (cs *ControllerServer) CreateVolume(
 		return nil, err
 	}
 
+	err = reserveTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
+	if err != nil {
+		if errors.Is(err, util.ErrTenantQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	defer func() {
+		if err != nil {
+			releaseTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
+		}
+	}()
+
 	err = reserveVol(ctx, rbdVol, rbdSnap, cr)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -381,13 +510,21 @@ func (cs *ControllerServer) CreateVolume(
 	}
 
 	// Set Metadata on PV Create
-	metadata := k8s.GetVolumeMetadata(req.GetParameters())
+	metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetVolumeMetadata(req.GetParameters()))
 	err = rbdVol.setAllMetadata(metadata)
 	if err != nil {
 		return nil, err
 	}
 
-	return buildCreateVolumeResponse(req, rbdVol), nil
+	err = rbdVol.setMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := buildCreateVolumeResponse(req, rbdVol)
+	cs.CreateVolumeCache.Add(req, resp)
+
+	return resp, nil
 }
 
 // flattenParentImage is to be called before proceeding with creating volume,
@@ -507,12 +644,17 @@ func (cs *ControllerServer) repairExistingVolume(ctx context.Context, req *csi.C
 	}
 
 	// Set metadata on restart of provisioner pod when image exist
-	metadata := k8s.GetVolumeMetadata(req.GetParameters())
+	metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetVolumeMetadata(req.GetParameters()))
 	err := rbdVol.setAllMetadata(metadata)
 	if err != nil {
 		return nil, err
 	}
 
+	err = rbdVol.setMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
 	return buildCreateVolumeResponse(req, rbdVol), nil
 }
 
@@ -744,10 +886,14 @@ func (cs *ControllerServer) createBackingImage(
 	return nil
 }
 
+// checkContentSource returns the volume or snapshot that the volume is
+// cloned or restored from. With readOnly, nothing is modified in the cluster
+// while the source is looked up.
 func checkContentSource(
 	ctx context.Context,
 	req *csi.CreateVolumeRequest,
 	cr *util.Credentials,
+	readOnly bool,
 ) (*rbdVolume, *rbdSnapshot, error) {
 	if req.VolumeContentSource == nil {
 		return nil, nil, nil
@@ -772,6 +918,18 @@ func checkContentSource(
 
 			return nil, nil, status.Errorf(codes.NotFound, "%s snapshot does not exist", snapshotID)
 		}
+		err := k8s.CheckDataSourceReferenceGrant(ctx, req.GetParameters())
+		if err != nil {
+			log.ErrorLog(ctx, "restoring snapshot %s is not allowed: %v", snapshotID, err)
+			if errors.Is(err, k8s.ErrNoReferenceGrant) {
+				return nil, nil, status.Error(codes.PermissionDenied, err.Error())
+			}
+			if errors.Is(err, k8s.ErrNoPVCMetadata) {
+				return nil, nil, status.Error(codes.FailedPrecondition, err.Error())
+			}
+
+			return nil, nil, status.Error(codes.Internal, err.Error())
+		}
 
 		return nil, rbdSnap, nil
 	case *csi.VolumeContentSource_Volume:
@@ -783,7 +941,7 @@ func checkContentSource(
 		if volID == "" {
 			return nil, nil, status.Errorf(codes.NotFound, "volume ID cannot be empty")
 		}
-		rbdvol, err := GenVolFromVolID(ctx, volID, cr, req.GetSecrets())
+		rbdvol, err := genVolFromVolID(ctx, volID, cr, req.GetSecrets(), readOnly)
 		if err != nil {
 			log.ErrorLog(ctx, "failed to get backend image for %s: %v", volID, err)
 			if !errors.Is(err, ErrImageNotFound) {
@@ -894,6 +1052,9 @@ func (cs *ControllerServer) DeleteVolume(
 	}
 	defer cs.OperationLocks.ReleaseDeleteLock(volumeID)
 
+	// the volume may not be returned for new CreateVolume requests anymore
+	cs.CreateVolumeCache.Forget(volumeID)
+
 	// if this is a migration request volID, delete the volume in backend
 	if isMigrationVolID(volumeID) {
 		pmVolID, pErr := parseMigrationVolID(volumeID)
@@ -1008,6 +1169,7 @@ func cleanupRBDImage(ctx context.Context,
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	releaseTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
 
 	if err = undoVolReservation(ctx, rbdVol, cr); err != nil {
 		log.ErrorLog(ctx, "failed to remove reservation for volume (%s) with backing image (%s) (%s)",
@@ -1090,7 +1252,7 @@ func (cs *ControllerServer) CreateSnapshot(
 
 	rbdSnap, err := genSnapFromOptions(ctx, rbdVol, req.GetParameters())
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, status.Error(util.ParameterErrorCode(err), err.Error())
 	}
 	rbdSnap.RbdImageName = rbdVol.RbdImageName
 	rbdSnap.VolSize = rbdVol.VolSize
@@ -1104,6 +1266,16 @@ func (cs *ControllerServer) CreateSnapshot(
 	}
 	defer cs.SnapshotLocks.Release(req.GetName())
 
+	// Snapshots of the same image are created one after another, the
+	// existence check below finds the snapshot of a retried request once the
+	// one in flight completed
+	if acquired := cs.SnapshotSourceLocks.Acquire(ctx, rbdSnap.SourceVolumeID); !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, rbdSnap.SourceVolumeID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, rbdSnap.SourceVolumeID)
+	}
+	defer cs.SnapshotSourceLocks.Release(rbdSnap.SourceVolumeID)
+
 	// Take lock on parent rbd image
 	if err = cs.OperationLocks.GetSnapshotCreateLock(rbdSnap.SourceVolumeID); err != nil {
 		log.ErrorLog(ctx, err.Error())
@@ -1131,8 +1303,19 @@ func (cs *ControllerServer) CreateSnapshot(
 		return nil, err
 	}
 
+	err = cs.reserveSnapshotCount(ctx, rbdVol, rbdSnap, req.GetParameters(), cr)
+	if err != nil {
+		if errors.Is(err, util.ErrSnapshotLimitExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
 	err = reserveSnap(ctx, rbdSnap, rbdVol, cr)
 	if err != nil {
+		releaseSnapshotCount(ctx, rbdSnap, cr)
+
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 	defer func() {
@@ -1169,7 +1352,8 @@ func (cs *ControllerServer) CreateSnapshot(
 	}
 	// Set snapshot-name/snapshot-namespace/snapshotcontent-name details
 	// on RBD backend image as metadata on create
-	metadata := k8s.GetSnapshotMetadata(req.GetParameters())
+	metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetSnapshotMetadata(req.GetParameters()))
+	metadata = k8s.AddSnapshotExpiryMetadata(metadata, req.GetParameters(), vol.CreatedAt.AsTime())
 	err = rbdVol.setAllMetadata(metadata)
 	if err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -1228,7 +1412,8 @@ func cloneFromSnapshot(
 	// Update snapshot-name/snapshot-namespace/snapshotcontent-name details on
 	// RBD backend image as metadata on restart of provisioner pod when image exist
 	if len(parameters) != 0 {
-		metadata := k8s.GetSnapshotMetadata(parameters)
+		metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetSnapshotMetadata(parameters))
+		metadata = k8s.AddSnapshotExpiryMetadata(metadata, parameters, rbdSnap.CreatedAt.AsTime())
 		err = rbdVol.setAllMetadata(metadata)
 		if err != nil {
 			return nil, status.Error(codes.Internal, err.Error())
@@ -1266,9 +1451,23 @@ func (cs *ControllerServer) validateSnapshotReq(ctx context.Context, req *csi.Cr
 	if value, ok := options["snapshotNamePrefix"]; ok && value == "" {
 		return status.Error(codes.InvalidArgument, "empty snapshot name prefix to provision snapshot from")
 	}
+	if err := util.ValidateNamePrefix("snapshotNamePrefix", options["snapshotNamePrefix"]); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
 	if value, ok := options["pool"]; ok && value == "" {
 		return status.Error(codes.InvalidArgument, "empty pool name in which rbd image will be created")
 	}
+	if _, err := k8s.GetSnapshotRetention(options); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if _, err := util.GetMaxSnapshotsPerVolume(options, cs.MaxSnapshotsPerVolume); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if cs.StrictParameters {
+		if err := k8s.CheckParameters(options, snapshotParameters); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
 
 	return nil
 }
@@ -1449,6 +1648,7 @@ func (cs *ControllerServer) DeleteSnapshot(
 
 	rbdVol.ImageID = rbdSnap.ImageID
 	// update parent name to delete the snapshot
+	sourceName := rbdSnap.RbdImageName
 	rbdSnap.RbdImageName = rbdVol.RbdImageName
 	err = cleanUpSnapshot(ctx, rbdVol, rbdSnap, rbdVol)
 	if err != nil {
@@ -1456,6 +1656,9 @@ func (cs *ControllerServer) DeleteSnapshot(
 
 		return nil, status.Error(codes.Internal, err.Error())
 	}
+	// the snapshot counts for its source image until the reservation is
+	// undone
+	rbdSnap.RbdImageName = sourceName
 	err = undoSnapReservation(ctx, rbdSnap, cr)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to remove reservation for snapname (%s) with backing snap (%s) on image (%s) (%s)",
@@ -1573,10 +1776,21 @@ func (cs *ControllerServer) ControllerExpandVolume(
 
 	// resize volume if required
 	if rbdVol.VolSize < volSize {
+		delta := volSize - rbdVol.VolSize
+		err = reserveTenantQuota(ctx, rbdVol, cr, delta)
+		if err != nil {
+			if errors.Is(err, util.ErrTenantQuotaExceeded) {
+				return nil, status.Error(codes.ResourceExhausted, err.Error())
+			}
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
 		log.DebugLog(ctx, "rbd volume %s size is %v,resizing to %v", rbdVol, rbdVol.VolSize, volSize)
 		err = rbdVol.resize(volSize)
 		if err != nil {
 			log.ErrorLog(ctx, "failed to resize rbd image: %s with error: %v", rbdVol, err)
+			releaseTenantQuota(ctx, rbdVol, cr, delta)
 
 			return nil, status.Error(codes.Internal, err.Error())
 		}
@@ -1588,6 +1802,363 @@ func (cs *ControllerServer) ControllerExpandVolume(
 	}, nil
 }
 
+// ControllerModifyVolume sets the mutable parameters of a
+// VolumeAttributesClass on the image of the volume, see
+// validateMutableParameters().
+func (cs *ControllerServer) ControllerModifyVolume(
+	ctx context.Context,
+	req *csi.ControllerModifyVolumeRequest,
+) (*csi.ControllerModifyVolumeResponse, error) {
+	err := cs.Driver.ValidateControllerServiceRequest(csi.ControllerServiceCapability_RPC_MODIFY_VOLUME)
+	if err != nil {
+		log.ErrorLog(ctx, "invalid modify volume req: %v", protosanitizer.StripSecrets(req))
+
+		return nil, err
+	}
+
+	volID := req.GetVolumeId()
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID cannot be empty")
+	}
+
+	err = validateMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	// lock out parallel requests against the same volume ID
+	if acquired := cs.VolumeLocks.TryAcquire(volID); !acquired {
+		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volID)
+
+		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volID)
+	}
+	defer cs.VolumeLocks.Release(volID)
+
+	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	defer cr.DeleteCredentials()
+	rbdVol, err := genVolFromVolIDWithMigration(ctx, volID, cr, req.GetSecrets())
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrImageNotFound):
+			err = status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+		case errors.Is(err, util.ErrPoolNotFound):
+			log.ErrorLog(ctx, "failed to get backend volume for %s: %v", volID, err)
+			err = status.Errorf(codes.NotFound, err.Error())
+		default:
+			err = status.Errorf(codes.Internal, err.Error())
+		}
+
+		return nil, err
+	}
+	defer rbdVol.Destroy()
+
+	err = rbdVol.setMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		log.ErrorLog(ctx, "failed to modify volume %s: %v", rbdVol, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.ControllerModifyVolumeResponse{}, nil
+}
+
+// GetCapacity returns the space that is available in the pool that stores the
+// data of volumes with the parameters, see getCapacityPool(). The request does
+// not contain secrets, so the credentials of the cluster need to be configured
+// in the credentials directory of the CSI config file.
+func (cs *ControllerServer) GetCapacity(
+	ctx context.Context,
+	req *csi.GetCapacityRequest,
+) (*csi.GetCapacityResponse, error) {
+	clusterID := req.GetParameters()["clusterID"]
+	if clusterID == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing required parameter clusterID")
+	}
+	pool, err := getCapacityPool(req)
+	if err != nil {
+		return nil, err
+	}
+	if pool == "" {
+		log.DebugLog(ctx, "no topology constrained pool is accessible from %v", req.GetAccessibleTopology())
+
+		return &csi.GetCapacityResponse{}, nil
+	}
+
+	available, err := util.GetPoolAvailableBytes(clusterID, pool)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get available capacity of pool %s in cluster %s: %v", pool, clusterID, err)
+		if errors.Is(err, util.ErrNoCredentials) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, util.ErrPoolNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.GetCapacityResponse{
+		AvailableCapacity: available,
+	}, nil
+}
+
+// getCapacityPool returns the pool that the data of volumes with the
+// parameters of the request is stored in, which is the data pool of the
+// image, if one is set. When the request contains a topology, the external-
+// provisioner reports the capacity per topology segment, and the pool is the
+// one of the topologyConstrainedPools that CreateVolume picks for the
+// segment. An empty pool is returned if none of those pools is accessible from
+// the segment. Without a topology, CreateVolume uses the pool parameter.
+func getCapacityPool(req *csi.GetCapacityRequest) (string, error) {
+	params := req.GetParameters()
+	if params["topologyConstrainedPools"] != "" && req.GetAccessibleTopology() != nil {
+		topologyPools, err := util.ParseTopologyConstrainedPools(params["topologyConstrainedPools"])
+		if err != nil {
+			return "", status.Error(codes.InvalidArgument, err.Error())
+		}
+		pool, dataPool := util.FindPoolForTopology(topologyPools, req.GetAccessibleTopology())
+		if dataPool != "" {
+			return dataPool, nil
+		}
+
+		return pool, nil
+	}
+
+	pool := params["pool"]
+	if pool == "" {
+		return "", status.Error(codes.InvalidArgument, "missing required parameter pool")
+	}
+	if params["dataPool"] != "" {
+		return params["dataPool"], nil
+	}
+
+	return pool, nil
+}
+
+// ControllerGetVolume returns the volume with its condition, which the
+// external-health-monitor reports as events on the PV. The request does not
+// contain secrets, the credentials directory of the cluster in the CSI config
+// file is used. The volume is abnormal when its image is missing, its pool is
+// full, or its mirrored image is in split-brain.
+func (cs *ControllerServer) ControllerGetVolume(
+	ctx context.Context,
+	req *csi.ControllerGetVolumeRequest,
+) (*csi.ControllerGetVolumeResponse, error) {
+	volID := req.GetVolumeId()
+	if volID == "" {
+		return nil, status.Error(codes.InvalidArgument, "volume ID cannot be empty")
+	}
+	vi := util.CSIIdentifier{}
+	err := vi.DecomposeCSIID(volID)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to decode volume ID %s: %v", volID, err)
+
+		return nil, status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+	}
+
+	l, err := newJournalLister(ctx, volJournal, []string{vi.ClusterID}, nil)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to connect to cluster %s: %v", vi.ClusterID, err)
+		if errors.Is(err, util.ErrNoCredentials) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	defer l.destroy()
+
+	pool, attrs, ok, err := l.reservedAttributes(
+		ctx,
+		journal.ListLocation{ClusterID: vi.ClusterID},
+		journal.Reservation{ImageUUID: vi.ObjectUUID, ImagePoolID: vi.LocationID},
+		false)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return getJournalLessVolume(ctx, l, vi, volID)
+	}
+
+	volume := &csi.Volume{VolumeId: volID}
+	var condition *csi.VolumeCondition
+	ri, ok, err := l.listedImage(ctx, vi.ClusterID, pool, attrs.ImageName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if ok {
+		defer ri.Destroy()
+		volume.CapacityBytes = ri.VolSize
+		condition, err = l.imageCondition(ri)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to get condition of volume %s: %v", volID, err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	} else {
+		condition = missingImageCondition(&rbdImage{
+			Pool:           pool,
+			RadosNamespace: l.clusters[vi.ClusterID].radosNamespace,
+			RbdImageName:   attrs.ImageName,
+		})
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: volume,
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
+
+// ListVolumes lists the volumes in the journals of the pools of the clusters
+// in the CSI config file, and the journal-less volumes of the pools, page by
+// page in the order of the pools and request names. The request does not contain secrets, so only the clusters with a
+// credentials directory in the CSI config file are listed.
+func (cs *ControllerServer) ListVolumes(
+	ctx context.Context,
+	req *csi.ListVolumesRequest,
+) (*csi.ListVolumesResponse, error) {
+	if req.GetMaxEntries() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max_entries %d", req.GetMaxEntries())
+	}
+	clusterIDs, err := util.GetClusterIDs(util.CsiConfigFile)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	l, err := newJournalLister(ctx, volJournal, clusterIDs, nil)
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+	defer l.destroy()
+
+	entries, next, err := journal.ListPages(
+		l.locations,
+		req.GetStartingToken(),
+		int(req.GetMaxEntries()),
+		l.listVolumes(ctx),
+		func(loc journal.ListLocation, rsv journal.Reservation) (*csi.ListVolumesResponse_Entry, bool, error) {
+			return l.volumeEntry(ctx, loc, rsv)
+		})
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+
+	return &csi.ListVolumesResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
+}
+
+// ListSnapshots lists the snapshot with the ID, or the snapshots of the source
+// volume, or all snapshots in the journals of the pools of the clusters in
+// the CSI config file. The snapshots are listed page by page, in the order of
+// the pools and request names. The secrets of the request are used to list
+// the clusters, or the credentials directories in the CSI config file when
+// the request does not contain secrets.
+func (cs *ControllerServer) ListSnapshots(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest,
+) (*csi.ListSnapshotsResponse, error) {
+	if req.GetMaxEntries() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max_entries %d", req.GetMaxEntries())
+	}
+	if req.GetSnapshotId() != "" {
+		return cs.getListedSnapshot(ctx, req)
+	}
+
+	var filter snapshotFilter
+	var clusterIDs []string
+	if req.GetSourceVolumeId() != "" {
+		vi := util.CSIIdentifier{}
+		err := vi.DecomposeCSIID(req.GetSourceVolumeId())
+		if err != nil {
+			// a volume that was not created by this driver has no snapshots
+			log.DebugLog(ctx, "no snapshots of invalid volume ID %q: %v", req.GetSourceVolumeId(), err)
+
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		filter = sourceVolumeFilter(vi)
+		clusterIDs = []string{vi.ClusterID}
+	} else {
+		var err error
+		clusterIDs, err = util.GetClusterIDs(util.CsiConfigFile)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+	l, err := newJournalLister(ctx, snapJournal, clusterIDs, req.GetSecrets())
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+	defer l.destroy()
+
+	entries, next, err := journal.ListPages(
+		l.locations,
+		req.GetStartingToken(),
+		int(req.GetMaxEntries()),
+		l.list(ctx),
+		func(loc journal.ListLocation, rsv journal.Reservation) (*csi.ListSnapshotsResponse_Entry, bool, error) {
+			return l.snapshotEntry(ctx, loc, rsv, filter)
+		})
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries:   entries,
+		NextToken: next,
+	}, nil
+}
+
+// getListedSnapshot returns the snapshot with the ID of the request, if it
+// exists and is a snapshot of the source volume of the request, if set.
+func (cs *ControllerServer) getListedSnapshot(
+	ctx context.Context,
+	req *csi.ListSnapshotsRequest,
+) (*csi.ListSnapshotsResponse, error) {
+	vi := util.CSIIdentifier{}
+	err := vi.DecomposeCSIID(req.GetSnapshotId())
+	if err != nil {
+		log.DebugLog(ctx, "no snapshot with invalid ID %q: %v", req.GetSnapshotId(), err)
+
+		return &csi.ListSnapshotsResponse{}, nil
+	}
+	var filter snapshotFilter
+	if req.GetSourceVolumeId() != "" {
+		source := util.CSIIdentifier{}
+		err = source.DecomposeCSIID(req.GetSourceVolumeId())
+		if err != nil {
+			return &csi.ListSnapshotsResponse{}, nil
+		}
+		filter = sourceVolumeFilter(source)
+	}
+
+	l, err := newJournalLister(ctx, snapJournal, []string{vi.ClusterID}, req.GetSecrets())
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+	defer l.destroy()
+
+	entry, ok, err := l.snapshotEntry(
+		ctx,
+		journal.ListLocation{ClusterID: vi.ClusterID},
+		journal.Reservation{ImageUUID: vi.ObjectUUID, ImagePoolID: vi.LocationID},
+		filter)
+	if err != nil {
+		return nil, listError(ctx, err)
+	}
+	if !ok {
+		return &csi.ListSnapshotsResponse{}, nil
+	}
+
+	return &csi.ListSnapshotsResponse{
+		Entries: []*csi.ListSnapshotsResponse_Entry{entry},
+	}, nil
+}
+
 // ControllerPublishVolume is a dummy publish implementation to mimic a successful attach operation being a NOOP.
 func (cs *ControllerServer) ControllerPublishVolume(
 	ctx context.Context,
@@ -16,7 +16,11 @@ limitations under the License.
 
 package rbd
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
 
 func TestValidateStriping(t *testing.T) {
 	t.Parallel()
@@ -86,3 +90,103 @@ func TestValidateStriping(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateMounter(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		mounter string
+		wantErr bool
+	}{
+		{mounter: "", wantErr: false},
+		{mounter: "rbd", wantErr: false},
+		{mounter: "rbd-nbd", wantErr: false},
+		{mounter: "nbd", wantErr: true},
+		{mounter: "fuse", wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.mounter, func(t *testing.T) {
+			t.Parallel()
+			if err := validateMounter(ts.mounter); (err != nil) != ts.wantErr {
+				t.Errorf("validateMounter(%q) error = %v, wantErr %v", ts.mounter, err, ts.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetCapacityPool(t *testing.T) {
+	t.Parallel()
+	topologyPools := `[{"poolName":"zone-a-pool","domainSegments":[{"domainLabel":"zone","value":"a"}]},` +
+		`{"poolName":"zone-b-pool","dataPool":"zone-b-ec","domainSegments":[{"domainLabel":"zone","value":"b"}]}]`
+	zone := func(name string) *csi.Topology {
+		return &csi.Topology{Segments: map[string]string{"topology.rbd.csi.ceph.com/zone": name}}
+	}
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		topology   *csi.Topology
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "pool",
+			parameters: map[string]string{"pool": "rbd"},
+			want:       "rbd",
+		},
+		{
+			name:       "data pool",
+			parameters: map[string]string{"pool": "rbd", "dataPool": "ec"},
+			want:       "ec",
+		},
+		{
+			name:       "missing pool",
+			parameters: map[string]string{},
+			wantErr:    true,
+		},
+		{
+			name:       "topology constrained pool",
+			parameters: map[string]string{"pool": "rbd", "topologyConstrainedPools": topologyPools},
+			topology:   zone("a"),
+			want:       "zone-a-pool",
+		},
+		{
+			name:       "topology constrained data pool",
+			parameters: map[string]string{"topologyConstrainedPools": topologyPools},
+			topology:   zone("b"),
+			want:       "zone-b-ec",
+		},
+		{
+			name:       "no topology constrained pool in the zone",
+			parameters: map[string]string{"pool": "rbd", "topologyConstrainedPools": topologyPools},
+			topology:   zone("c"),
+			want:       "",
+		},
+		{
+			name:       "topology constrained pools without topology",
+			parameters: map[string]string{"pool": "rbd", "topologyConstrainedPools": topologyPools},
+			want:       "rbd",
+		},
+		{
+			name:       "invalid topology constrained pools",
+			parameters: map[string]string{"pool": "rbd", "topologyConstrainedPools": "[{"},
+			topology:   zone("a"),
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := getCapacityPool(&csi.GetCapacityRequest{
+				Parameters:         ts.parameters,
+				AccessibleTopology: ts.topology,
+			})
+			if (err != nil) != ts.wantErr {
+				t.Errorf("getCapacityPool() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("getCapacityPool() = %q, want %q", got, ts.want)
+			}
+		})
+	}
+}
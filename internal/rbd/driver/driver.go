@@ -61,11 +61,34 @@ func NewControllerServer(d *csicommon.CSIDriver) *rbd.ControllerServer {
 	return &rbd.ControllerServer{
 		DefaultControllerServer: csicommon.NewDefaultControllerServer(d),
 		VolumeLocks:             util.NewVolumeLocks(),
-		SnapshotLocks:           util.NewVolumeLocks(),
+		SnapshotLocks:           util.NewSnapshotLocks(),
+		SnapshotSourceLocks:     util.NewSnapshotSourceLocks(),
 		OperationLocks:          util.NewOperationLock(),
 	}
 }
 
+// NewDryRunControllerServer returns a controller server for dry-runs of
+// CreateVolume, configured like the controller server of a driver that is
+// started with conf. The journals need to be initialized with
+// rbd.InitJournals().
+func NewDryRunControllerServer(conf *util.Config) (*rbd.ControllerServer, error) {
+	// the controller server does not use the node ID
+	cd := csicommon.NewCSIDriver(conf.DriverName, util.DriverVersion, "dry-run")
+	if cd == nil {
+		return nil, errors.New("failed to initialize CSI Driver")
+	}
+	cd.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+		csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
+	})
+
+	cs := NewControllerServer(cd)
+	cs.ClusterName = conf.ClusterName
+	cs.SetMetadata = conf.SetMetadata
+	cs.StrictParameters = conf.StrictParameters
+
+	return cs, nil
+}
+
 func NewReplicationServer(c *rbd.ControllerServer) *rbd.ReplicationServer {
 	return &rbd.ReplicationServer{ControllerServer: c}
 }
@@ -108,12 +131,25 @@ func (r *Driver) Run(conf *util.Config) {
 		log.FatalLogMsg("Failed to initialize CSI Driver.")
 	}
 	if conf.IsControllerServer || !conf.IsNodeServer {
-		r.cd.AddControllerServiceCapabilities([]csi.ControllerServiceCapability_RPC_Type{
+		capabilities := []csi.ControllerServiceCapability_RPC_Type{
 			csi.ControllerServiceCapability_RPC_CREATE_DELETE_VOLUME,
 			csi.ControllerServiceCapability_RPC_CREATE_DELETE_SNAPSHOT,
 			csi.ControllerServiceCapability_RPC_CLONE_VOLUME,
 			csi.ControllerServiceCapability_RPC_EXPAND_VOLUME,
-		})
+			csi.ControllerServiceCapability_RPC_MODIFY_VOLUME,
+			csi.ControllerServiceCapability_RPC_GET_CAPACITY,
+		}
+		// ListVolumes, ListSnapshots and ControllerGetVolume requests do
+		// not contain secrets, and fail without a credentialsDir
+		if hasCredentialsDir() {
+			capabilities = append(capabilities,
+				csi.ControllerServiceCapability_RPC_LIST_VOLUMES,
+				csi.ControllerServiceCapability_RPC_LIST_SNAPSHOTS,
+				csi.ControllerServiceCapability_RPC_GET_VOLUME,
+				csi.ControllerServiceCapability_RPC_VOLUME_CONDITION,
+			)
+		}
+		r.cd.AddControllerServiceCapabilities(capabilities)
 		// We only support the multi-writer option when using block, but it's a supported capability for the plugin in
 		// general
 		// In addition, we want to add the remaining modes like MULTI_NODE_READER_ONLY,
@@ -153,12 +189,21 @@ func (r *Driver) Run(conf *util.Config) {
 		rbd.SetGlobalInt("krbdFeatures", krbdFeatures)
 
 		rbd.SetRbdNbdToolFeatures()
+		r.ns.MaxVolumesPerNode = rbd.NodeVolumeLimit(conf.MaxVolumesPerNode)
+		log.DefaultLog("node can map %d volumes (0 is unlimited)", r.ns.MaxVolumesPerNode)
+		r.ns.MountOptionsPolicy, err = util.LoadMountOptionsPolicy(conf.MountOptionsPolicy)
+		if err != nil {
+			log.FatalLogMsg(err.Error())
+		}
 	}
 
 	if conf.IsControllerServer {
 		r.cs = NewControllerServer(r.cd)
 		r.cs.ClusterName = conf.ClusterName
 		r.cs.SetMetadata = conf.SetMetadata
+		r.cs.StrictParameters = conf.StrictParameters
+		r.cs.MaxSnapshotsPerVolume = conf.MaxSnapshotsPerVolume
+		r.cs.CreateVolumeCache = util.NewCreateVolumeCache(conf.CreateVolumeCacheTTL)
 		log.WarningLogMsg("replication service running on controller server is deprecated " +
 			"and replaced by CSI-Addons, see https://github.com/ceph/ceph-csi/issues/3314 for more details")
 		r.rs = NewReplicationServer(r.cs)
@@ -174,6 +219,9 @@ func (r *Driver) Run(conf *util.Config) {
 		}
 		r.cs = NewControllerServer(r.cd)
 	}
+	if conf.AdminSocket != "" {
+		r.registerAdminCommands()
+	}
 
 	s := csicommon.NewNonBlockingGRPCServer()
 	srv := csicommon.Servers{
@@ -184,14 +232,20 @@ func (r *Driver) Run(conf *util.Config) {
 		// operations.
 		RS: r.rs,
 	}
-	s.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableGRPCMetrics)
-	if conf.EnableGRPCMetrics {
-		log.WarningLogMsg("EnableGRPCMetrics is deprecated")
+	s.Start(conf.Endpoint, conf.HistogramOption, srv, conf.EnableMetrics)
+	if conf.EnableMetrics {
 		go util.StartMetricsServer(conf)
 	}
 
 	r.startProfiling(conf)
 
+	if conf.IsControllerServer && conf.CephHealthInterval > 0 {
+		go util.StartCephHealthCollector(conf.CephHealthInterval, conf.DriverName)
+	}
+	if conf.IsNodeServer && conf.MountHealthInterval > 0 {
+		go util.StartMountHealthProbe(conf.DriverName, conf.MountHealthInterval)
+	}
+
 	if conf.IsNodeServer {
 		go func() {
 			// TODO: move the healer to csi-addons
@@ -201,7 +255,9 @@ func (r *Driver) Run(conf *util.Config) {
 			}
 		}()
 	}
+	go csicommon.StopOnSignal(s, conf.ShutdownTimeout)
 	s.Wait()
+	util.CloseConnections()
 }
 
 // setupCSIAddonsServer creates a new CSI-Addons Server on the given (URL)
@@ -236,7 +292,7 @@ func (r *Driver) setupCSIAddonsServer(conf *util.Config) error {
 	}
 
 	// start the server, this does not block, it runs a new go-routine
-	err = r.cas.Start()
+	err = r.cas.Start(conf.EnableMetrics, csiaddons.ProbeReadiness(is))
 	if err != nil {
 		return fmt.Errorf("failed to start CSI-Addons server: %w", err)
 	}
@@ -248,10 +304,50 @@ func (r *Driver) setupCSIAddonsServer(conf *util.Config) error {
 // starts the required profiling services.
 func (r *Driver) startProfiling(conf *util.Config) {
 	if conf.EnableProfiling {
-		if !conf.EnableGRPCMetrics {
+		if !conf.EnableMetrics {
 			go util.StartMetricsServer(conf)
 		}
 		log.DebugLogMsg("Registering profiling handler")
 		go util.EnableProfiling()
 	}
 }
+
+// registerAdminCommands registers the commands of the admin socket, which take
+// the volume locks of the controller server if it runs, so that they do not
+// run concurrently with CSI procedures for the same volume.
+func (r *Driver) registerAdminCommands() {
+	var (
+		cache      *util.CreateVolumeCache
+		statsCache *csicommon.VolumeStatsCache
+	)
+	locks := util.NewVolumeLocks()
+	switch {
+	case r.cs != nil:
+		locks = r.cs.VolumeLocks
+		cache = r.cs.CreateVolumeCache
+	case r.ns != nil:
+		locks = r.ns.VolumeLocks
+	}
+	if r.ns != nil {
+		statsCache = r.ns.StatsCache
+	}
+	rbd.RegisterAdminCommands(locks)
+	util.RegisterAdminCommand("invalidate-cache", util.NewInvalidateCacheCommand(cache, statsCache))
+}
+
+// hasCredentialsDir returns true when a cluster in the CSI config file has a
+// credentialsDir, the capabilities of the RPCs that need it are only
+// advertised then.
+func hasCredentialsDir() bool {
+	configured, err := util.HasCredentialsDir(util.CsiConfigFile)
+	if err != nil {
+		log.WarningLogMsg("not advertising the capabilities that need a credentialsDir: %v", err)
+
+		return false
+	}
+	if !configured {
+		log.DefaultLog("not advertising the capabilities that need a credentialsDir, no cluster has a credentialsDir")
+	}
+
+	return configured
+}
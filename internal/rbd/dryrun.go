@@ -0,0 +1,296 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/kms"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DryRunCreateVolume walks the decisions of CreateVolume for the request,
+// without reserving, creating or repairing anything, and returns a report of
+// the steps that were checked, and what CreateVolume would do. The lock of
+// the request name is not taken, a parallel CreateVolume of the same request
+// name may change the outcome.
+func (cs *ControllerServer) DryRunCreateVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
+) *util.DryRunReport {
+	report := util.NewDryRunReport(req.GetName())
+
+	err := cs.validateVolumeReq(ctx, req)
+	if err != nil {
+		report.Fail("validate-request", err)
+
+		return report
+	}
+	report.Pass("validate-request", "the name, capabilities and parameters are valid")
+
+	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
+	if err != nil {
+		report.Fail("credentials", status.Error(codes.InvalidArgument, err.Error()))
+
+		return report
+	}
+	defer cr.DeleteCredentials()
+	report.Pass("credentials", "user %s", cr.ID)
+
+	rbdVol, err := cs.parseVolCreateRequest(ctx, req)
+	if err != nil {
+		report.Fail("parse-parameters", err)
+
+		return report
+	}
+	defer rbdVol.Destroy()
+	report.Pass("parse-parameters", "%s", describeDryRunVolume(rbdVol))
+
+	err = rbdVol.Connect(cr)
+	if err != nil {
+		report.Fail("connect", status.Error(codes.Internal, err.Error()))
+
+		return report
+	}
+	report.Pass("connect", "connected to cluster %s", rbdVol.ClusterID)
+
+	parentVol, rbdSnap, err := checkContentSource(ctx, req, cr, true)
+	if err != nil {
+		report.Fail("content-source", err)
+
+		return report
+	}
+	if parentVol != nil {
+		defer parentVol.Destroy()
+	}
+	err = checkValidCreateVolumeRequest(rbdVol, parentVol, rbdSnap)
+	if err != nil {
+		report.Fail("content-source", err)
+
+		return report
+	}
+	switch {
+	case rbdSnap != nil:
+		report.Pass("content-source", "restore snapshot %s", rbdSnap)
+	case parentVol != nil:
+		report.Pass("content-source", "clone volume %s", parentVol)
+	}
+
+	if !rbdVol.JournalLess && dryRunReservation(ctx, report, rbdVol) {
+		return report
+	}
+
+	err = updateTopologyConstraints(rbdVol, rbdSnap)
+	if err != nil {
+		report.Fail("topology", status.Error(codes.Internal, err.Error()))
+
+		return report
+	}
+	if rbdVol.Topology != nil {
+		report.Pass("topology", "pool %s for topology %v", rbdVol.Pool, rbdVol.Topology)
+	}
+
+	if !dryRunPools(report, rbdVol) {
+		return report
+	}
+
+	err = checkTenantQuota(ctx, rbdVol, cr)
+	switch {
+	case errors.Is(err, util.ErrTenantQuotaExceeded):
+		report.Fail("tenant-quota", status.Error(codes.ResourceExhausted, err.Error()))
+
+		return report
+	case err != nil:
+		report.Fail("tenant-quota", status.Error(codes.Internal, err.Error()))
+
+		return report
+	case rbdVol.Owner != "":
+		report.Pass("tenant-quota", "the volume fits in the quota of tenant %s", rbdVol.Owner)
+	}
+
+	dryRunCapacity(report, rbdVol)
+
+	if rbdVol.isEncrypted() {
+		err = kms.CheckConnection(rbdVol.encryption.KMS, "csi-dry-run-"+rbdVol.RequestName)
+		if err != nil {
+			report.Fail("kms", status.Errorf(codes.Internal, "KMS %s can not be used: %v",
+				rbdVol.encryption.GetID(), err))
+
+			return report
+		}
+		report.Pass("kms", "KMS %s is reachable", rbdVol.encryption.GetID())
+	}
+
+	if rbdVol.JournalLess {
+		dryRunJournalLessImage(report, rbdVol)
+
+		return report
+	}
+
+	namePrefix := rbdVol.NamePrefix
+	if namePrefix == "" {
+		namePrefix = "csi-vol-"
+	}
+	report.Succeed("CreateVolume would reserve the request name, and create image %s<UUID> in pool %s",
+		namePrefix, rbdVol.Pool)
+
+	return report
+}
+
+// describeDryRunVolume returns the properties of the image that CreateVolume
+// would create for the parameters.
+func describeDryRunVolume(rbdVol *rbdVolume) string {
+	props := []string{
+		"cluster " + rbdVol.ClusterID,
+		"pool " + rbdVol.Pool,
+		fmt.Sprintf("size %d bytes", rbdVol.VolSize),
+	}
+	if rbdVol.DataPool != "" {
+		props = append(props, "data pool "+rbdVol.DataPool)
+	}
+	if rbdVol.RadosNamespace != "" {
+		props = append(props, "RADOS namespace "+rbdVol.RadosNamespace)
+	}
+	if features := rbdVol.ImageFeatureSet.Names(); len(features) != 0 {
+		props = append(props, "image features "+strings.Join(features, ","))
+	}
+	if rbdVol.isEncrypted() {
+		props = append(props, "encrypted with KMS "+rbdVol.encryption.GetID())
+	}
+	if rbdVol.JournalLess {
+		props = append(props, "journal-less")
+	}
+
+	return strings.Join(props, ", ")
+}
+
+// dryRunReservation checks whether the request name is reserved in the
+// journal already. CreateVolume would verify, repair and return the volume of
+// the reservation, the outcome is set and true is returned in that case.
+func dryRunReservation(ctx context.Context, report *util.DryRunReport, rbdVol *rbdVolume) bool {
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, rbdVol.conn.Creds)
+	if err != nil {
+		report.Fail("reservation", status.Error(codes.Internal, err.Error()))
+
+		return true
+	}
+	defer j.Destroy()
+
+	reservation, err := j.LookupReservation(ctx, rbdVol.JournalPool, rbdVol.RequestName)
+	if err != nil {
+		report.Fail("reservation", status.Error(codes.Internal, err.Error()))
+
+		return true
+	}
+	if reservation == nil {
+		report.Pass("reservation", "the request name is not reserved in pool %s", rbdVol.JournalPool)
+
+		return false
+	}
+
+	report.Pass("reservation", "the request name is reserved with UUID %s in pool %s",
+		reservation.ImageUUID, rbdVol.JournalPool)
+	report.Succeed("CreateVolume would verify the image of the reservation (UUID %s), and return it, "+
+		"or undo the reservation and create a new image when the image is missing", reservation.ImageUUID)
+
+	return true
+}
+
+// dryRunPools checks that the pool, data pool and RADOS namespace of the
+// image exist. The outcome is set and false is returned when one does not.
+func dryRunPools(report *util.DryRunReport, rbdVol *rbdVolume) bool {
+	err := rbdVol.openIoctx()
+	if err != nil {
+		report.Fail("pool", status.Errorf(codes.Internal, "pool %s: %v", rbdVol.Pool, err))
+
+		return false
+	}
+	if rbdVol.RadosNamespace != "" {
+		exists, nsErr := librbd.NamespaceExists(rbdVol.ioctx, rbdVol.RadosNamespace)
+		if nsErr == nil && !exists {
+			nsErr = fmt.Errorf("RADOS namespace %s does not exist in pool %s", rbdVol.RadosNamespace, rbdVol.Pool)
+		}
+		if nsErr != nil {
+			report.Fail("pool", status.Error(codes.Internal, nsErr.Error()))
+
+			return false
+		}
+	}
+	if rbdVol.DataPool != "" {
+		ioctx, dpErr := rbdVol.conn.GetIoctx(rbdVol.DataPool)
+		if dpErr != nil {
+			report.Fail("pool", status.Errorf(codes.Internal, "data pool %s: %v", rbdVol.DataPool, dpErr))
+
+			return false
+		}
+		ioctx.Destroy()
+	}
+	report.Pass("pool", "pool %s exists", rbdVol.Pool)
+
+	return true
+}
+
+// dryRunCapacity warns when the pool that stores the data of the image can
+// not store the size of the image. Images are thin provisioned, CreateVolume
+// does not check the capacity, the writes to the image fail once the pool is
+// full.
+func dryRunCapacity(report *util.DryRunReport, rbdVol *rbdVolume) {
+	pool := rbdVol.Pool
+	if rbdVol.DataPool != "" {
+		pool = rbdVol.DataPool
+	}
+	available, err := rbdVol.conn.PoolAvailableBytes(pool)
+	switch {
+	case err != nil:
+		report.Warn("capacity", "failed to get the available capacity of pool %s: %v", pool, err)
+	case available < rbdVol.VolSize:
+		report.Warn("capacity", "pool %s has %d bytes available, less than the size of the image",
+			pool, available)
+	default:
+		report.Pass("capacity", "pool %s has %d bytes available", pool, available)
+	}
+}
+
+// dryRunJournalLessImage sets the outcome for a journal-less volume, which
+// depends on the image that is named after the request name.
+func dryRunJournalLessImage(report *util.DryRunReport, rbdVol *rbdVolume) {
+	rbdVol.ReservedID = journalLessUUID(CSIInstanceID, rbdVol.RequestName)
+	rbdVol.RbdImageName = journalLessImageName(rbdVol.ReservedID)
+
+	requestName, err := rbdVol.GetMetadata(journalLessMetaKey)
+	switch {
+	case err == nil && requestName != rbdVol.RequestName:
+		report.Fail("image", status.Errorf(codes.AlreadyExists, "image %s belongs to request name %s",
+			rbdVol, requestName))
+	case err == nil:
+		report.Succeed("CreateVolume would return the existing image %s", rbdVol)
+	case errors.Is(err, ErrImageNotFound):
+		report.Succeed("CreateVolume would create image %s", rbdVol)
+	case errors.Is(err, librbd.ErrNotFound):
+		report.Succeed("CreateVolume would complete the unmarked image %s", rbdVol)
+	default:
+		report.Fail("image", status.Error(codes.Internal, err.Error()))
+	}
+}
@@ -21,10 +21,12 @@ import (
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 
 	kmsapi "github.com/ceph/ceph-csi/internal/kms"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	librbd "github.com/ceph/go-ceph/rbd"
 )
@@ -100,6 +102,9 @@ func (ri *rbdImage) isEncrypted() bool {
 // - the Data-Encryption-Key (DEK) will be generated stored for use by the KMS;
 // - the RBD image will be marked to support encryption in its metadata.
 func (ri *rbdImage) setupEncryption(ctx context.Context) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.setupEncryption")
+	defer span.End()
+
 	err := ri.encryption.StoreNewCryptoPassphrase(ri.VolID)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to save encryption passphrase for "+
@@ -197,6 +202,9 @@ func (ri *rbdImage) repairEncryptionConfig(dest *rbdImage) error {
 }
 
 func (ri *rbdImage) encryptDevice(ctx context.Context, devicePath string) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.encryptDevice")
+	defer span.End()
+
 	passphrase, err := ri.encryption.GetCryptoPassphrase(ri.VolID)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get crypto passphrase for %s: %v",
@@ -223,6 +231,10 @@ func (ri *rbdImage) encryptDevice(ctx context.Context, devicePath string) error
 }
 
 func (rv *rbdVolume) openEncryptedDevice(ctx context.Context, devicePath string) (string, error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.openEncryptedDevice")
+	defer span.End()
+	defer util.ObserveOperation(ctx, "rbd", rv.ClusterID, util.OpCryptsetupOpen, time.Now())
+
 	passphrase, err := rv.encryption.GetCryptoPassphrase(rv.VolID)
 	if err != nil {
 		log.ErrorLog(ctx, "failed to get passphrase for encrypted device %s: %v",
@@ -255,6 +267,9 @@ func (rv *rbdVolume) openEncryptedDevice(ctx context.Context, devicePath string)
 }
 
 func (ri *rbdImage) initKMS(ctx context.Context, volOptions, credentials map[string]string) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.initKMS")
+	defer span.End()
+
 	kmsID, err := ri.ParseEncryptionOpts(ctx, volOptions)
 	if err != nil {
 		return err
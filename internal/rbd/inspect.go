@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// InspectHandle looks up the image of a volume handle, or the image of a
+// snapshot handle, in the journal of its cluster and describes it. Volume
+// handles that are not in the journal are looked up as journal-less volumes.
+// The journals need to be initialized with InitJournals.
+func InspectHandle(
+	ctx context.Context,
+	handle string,
+	snapshot bool,
+	cr *util.Credentials,
+) (*util.HandleInfo, error) {
+	info, err := util.NewHandleInfo(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	ri := &rbdImage{ClusterID: info.ClusterID}
+	ri.Monitors, _, err = util.GetMonsAndClusterID(ctx, ri.ClusterID, false)
+	if err != nil {
+		return info, err
+	}
+	ri.RadosNamespace, err = util.GetRadosNamespace(util.CsiConfigFile, ri.ClusterID)
+	if err != nil {
+		return info, err
+	}
+	ri.Pool, err = util.GetPoolName(ri.Monitors, cr, info.LocationID)
+	if err != nil {
+		return info, err
+	}
+	info.Pool = ri.Pool
+	info.RadosNamespace = ri.RadosNamespace
+
+	jc := volJournal
+	if snapshot {
+		jc = snapJournal
+	}
+	j, err := jc.Connect(ri.Monitors, ri.RadosNamespace, cr)
+	if err != nil {
+		return info, err
+	}
+	defer j.Destroy()
+
+	err = ri.Connect(cr)
+	if err != nil {
+		return info, err
+	}
+	defer ri.Destroy()
+
+	attrs, err := j.GetImageAttributes(ctx, ri.Pool, info.UUID, snapshot)
+	if errors.Is(err, util.ErrKeyNotFound) && !snapshot {
+		attrs, err = inspectJournalLess(ri, info.UUID)
+		if err == nil {
+			info.JournalLess = true
+		}
+	}
+	if err != nil {
+		return info, fmt.Errorf("failed to find %s in the journal: %w", handle, err)
+	}
+	info.Name = attrs.ImageName
+	info.Source = attrs.SourceName
+	info.RequestName = attrs.RequestName
+	info.Owner = attrs.Owner
+	info.KmsID = attrs.KmsID
+	// snapshots are images that are named like the snapshot
+	ri.RbdImageName = attrs.ImageName
+
+	info.Encryption, err = inspectEncryption(ri)
+	if err != nil {
+		return info, err
+	}
+
+	if !snapshot {
+		mirror, mErr := ri.getImageMirroringInfo()
+		if mErr != nil {
+			return info, mErr
+		}
+		info.Mirroring = mirror.State.String()
+		if mirror.State == librbd.MirrorImageEnabled {
+			role := "secondary"
+			if mirror.Primary {
+				role = "primary"
+			}
+			info.Mirroring += ", " + role
+		}
+	}
+
+	return info, nil
+}
+
+// inspectJournalLess returns the attributes of the journal-less volume with
+// the UUID, util.ErrKeyNotFound is returned when its image does not exist or
+// is not marked as journal-less.
+func inspectJournalLess(ri *rbdImage, objectUUID string) (*journal.ImageAttributes, error) {
+	ri.RbdImageName = journalLessImageName(objectUUID)
+	requestName, err := ri.GetMetadata(journalLessMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil, fmt.Errorf("%w: no journal-less image %s: %v", util.ErrKeyNotFound, ri, err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &journal.ImageAttributes{RequestName: requestName, ImageName: ri.RbdImageName}, nil
+}
+
+// inspectEncryption returns the encryption state from the metadata of the
+// image. Unlike checkRbdImageEncrypted it does not migrate the metadata, the
+// image is not modified.
+func inspectEncryption(ri *rbdImage) (string, error) {
+	for _, key := range []string{encryptionMetaKey, oldEncryptionMetaKey} {
+		value, err := ri.GetMetadata(key)
+		if errors.Is(err, librbd.ErrNotFound) {
+			continue
+		} else if err != nil {
+			return "", fmt.Errorf("failed to get the encryption state of %q: %w", ri, err)
+		}
+		if state := strings.TrimSpace(value); state != "" {
+			return state, nil
+		}
+	}
+
+	return "none", nil
+}
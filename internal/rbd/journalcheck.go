@@ -0,0 +1,343 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// journalChecker compares the journals of the pools of a cluster with the
+// images in the pools.
+type journalChecker struct {
+	clusterID      string
+	monitors       string
+	radosNamespace string
+	cr             *util.Credentials
+	conn           *util.ClusterConnection
+	opts           journal.CheckOptions
+	// now is the time the check started, to compare the ages with
+	now time.Time
+	// reserved are the names of the images of the reservations, per pool
+	reserved map[string]map[string]bool
+	problems []journal.Problem
+}
+
+// CheckJournal checks the volume and snapshot journals of all pools of the
+// cluster against the images in the pools. Reservations without an image are
+// orphaned entries, images that are named like the images of reservations
+// but that are not reserved in a journal are dangling images. When the
+// options repair the problems, orphaned entries are removed from the journal,
+// and dangling images are moved to the trash, from where they can be
+// restored. The journals need to be initialized with InitJournals.
+//
+// Reservations and images that are younger than the minimum age of the
+// options are skipped, they may still be created or deleted. Dangling images
+// are only moved to the trash when the options confirm them, and never when
+// they are non-primary images of a mirrored pool.
+func CheckJournal(
+	ctx context.Context,
+	clusterID string,
+	cr *util.Credentials,
+	opts journal.CheckOptions,
+) ([]journal.Problem, error) {
+	c := &journalChecker{
+		clusterID: clusterID,
+		cr:        cr,
+		opts:      opts,
+		now:       time.Now(),
+		reserved:  map[string]map[string]bool{},
+		problems:  []journal.Problem{},
+	}
+	var err error
+	c.monitors, _, err = util.GetMonsAndClusterID(ctx, clusterID, false)
+	if err != nil {
+		return nil, err
+	}
+	c.radosNamespace, err = util.GetRadosNamespace(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	c.conn = &util.ClusterConnection{}
+	err = c.conn.Connect(c.monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.conn.Destroy()
+
+	pools, err := util.ListPools(c.monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+	for _, jc := range []*journal.Config{volJournal, snapJournal} {
+		err = c.checkJournal(ctx, jc, pools, jc == snapJournal)
+		if err != nil {
+			return c.problems, err
+		}
+	}
+	// all reservations need to be known to find the dangling images, the
+	// images of a journal can be in other pools
+	for _, pool := range pools {
+		err = c.checkImages(pool)
+		if err != nil {
+			return c.problems, err
+		}
+	}
+
+	return c.problems, nil
+}
+
+// checkJournal checks the reservations of the journal in each of the pools.
+func (c *journalChecker) checkJournal(ctx context.Context, jc *journal.Config, pools []string, snapshot bool) error {
+	j, err := jc.Connect(c.monitors, c.radosNamespace, c.cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	for _, pool := range pools {
+		reservations, _, err := j.ListReservations(ctx, pool, "", 0)
+		if err != nil {
+			return err
+		}
+		for _, rsv := range reservations {
+			err = c.checkReservation(ctx, j, pool, rsv, snapshot)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkReservation adds an orphaned entry when the image of the reservation
+// in the journal of journalPool does not exist, or the attributes of the
+// reservation are missing.
+func (c *journalChecker) checkReservation(
+	ctx context.Context,
+	j *journal.Connection,
+	journalPool string,
+	rsv journal.Reservation,
+	snapshot bool,
+) error {
+	pool := journalPool
+	if rsv.ImagePoolID != util.InvalidPoolID {
+		var err error
+		pool, err = util.GetPoolName(c.monitors, c.cr, rsv.ImagePoolID)
+		if errors.Is(err, util.ErrPoolNotFound) {
+			// the image was in a deleted pool, only the request
+			// name key of the reservation is left to remove
+			return c.orphaned(ctx, j, journal.Problem{
+				JournalPool: journalPool,
+				RequestName: rsv.RequestName,
+				UUID:        rsv.ImageUUID,
+				Snapshot:    snapshot,
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	problem := journal.Problem{
+		Pool:        pool,
+		JournalPool: journalPool,
+		RequestName: rsv.RequestName,
+		UUID:        rsv.ImageUUID,
+		Snapshot:    snapshot,
+	}
+	attrs, err := j.GetImageAttributes(ctx, pool, rsv.ImageUUID, snapshot)
+	if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		return c.orphaned(ctx, j, problem)
+	}
+	if err != nil {
+		return err
+	}
+
+	problem.Name = attrs.ImageName
+	if c.reserved[pool] == nil {
+		c.reserved[pool] = map[string]bool{}
+	}
+	c.reserved[pool][attrs.ImageName] = true
+
+	exists, err := c.imageExists(pool, attrs.ImageName)
+	if err != nil || exists {
+		return err
+	}
+
+	return c.orphaned(ctx, j, problem)
+}
+
+// orphaned adds the orphaned entry, and removes it from the journal when
+// the problems are repaired. Reservations that were modified within the
+// minimum age are skipped, their image may not be created yet.
+func (c *journalChecker) orphaned(ctx context.Context, j *journal.Connection, problem journal.Problem) error {
+	modTime, err := j.ReservationModTime(problem.JournalPool, problem.Pool, problem.UUID)
+	if err != nil {
+		return err
+	}
+	if c.opts.Young(modTime, c.now) {
+		log.DebugLog(ctx, "skipping reservation %q modified at %v", problem.RequestName, modTime)
+
+		return nil
+	}
+	problem.Kind = journal.OrphanedEntry
+	if c.opts.Repair {
+		// the UUID is enough to remove the omap of the reservation,
+		// which is not there when the pool was deleted
+		volName := problem.UUID
+		if problem.Pool == "" {
+			volName = ""
+		}
+		err := j.UndoReservation(ctx, problem.JournalPool, problem.Pool, volName, problem.RequestName)
+		if err != nil {
+			return err
+		}
+		log.DefaultLog("removed reservation %q from the journal of pool %s", problem.RequestName, problem.JournalPool)
+		problem.Repaired = true
+	}
+	c.problems = append(c.problems, problem)
+
+	return nil
+}
+
+// imageExists returns whether the image exists in the pool.
+func (c *journalChecker) imageExists(pool, name string) (bool, error) {
+	ri := &rbdImage{
+		ClusterID:      c.clusterID,
+		Monitors:       c.monitors,
+		Pool:           pool,
+		RadosNamespace: c.radosNamespace,
+		RbdImageName:   name,
+		conn:           c.conn.Copy(),
+	}
+	defer ri.Destroy()
+
+	image, err := ri.open()
+	if errors.Is(err, ErrImageNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	image.Close()
+
+	return true, nil
+}
+
+// checkImages adds a dangling image for each image in the pool that is
+// named like the image of a reservation, but is not reserved. Images of
+// journal-less volumes are not reserved, and are skipped, like images that
+// are younger than the minimum age.
+func (c *journalChecker) checkImages(pool string) error {
+	ioctx, err := c.conn.GetIoctx(pool)
+	if errors.Is(err, util.ErrPoolNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer ioctx.Destroy()
+	ioctx.SetNamespace(c.radosNamespace)
+
+	names, err := librbd.GetImageNames(ioctx)
+	if errors.Is(err, librbd.ErrNotFound) {
+		// not a pool for RBD images
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		if c.reserved[pool][name] || !journal.IsReservedName(name, journal.ReservedNamePrefixes) {
+			continue
+		}
+		dangling, secondary, err := c.danglingImage(ioctx, name)
+		if err != nil {
+			return err
+		}
+		if !dangling {
+			continue
+		}
+
+		problem := journal.Problem{Kind: journal.DanglingImage, Pool: pool, Name: name}
+		switch {
+		case !c.opts.Repair:
+		case secondary:
+			// the image is deleted with the primary image
+			problem.Skipped = "non-primary mirrored image"
+		case !c.opts.TrashConfirmed(pool, name):
+			problem.Skipped = "not confirmed to be moved to the trash"
+		default:
+			err = librbd.GetImage(ioctx, name).Trash(0)
+			if err != nil {
+				return err
+			}
+			log.DefaultLog("moved dangling image %s/%s to the trash", pool, name)
+			problem.Repaired = true
+		}
+		c.problems = append(c.problems, problem)
+	}
+
+	return nil
+}
+
+// danglingImage returns whether the unreserved image is dangling, images of
+// journal-less volumes and images that are younger than the minimum age are
+// not. It also returns whether the image is a non-primary image of a mirrored
+// pool.
+func (c *journalChecker) danglingImage(ioctx *rados.IOContext, name string) (bool, bool, error) {
+	image, err := librbd.OpenImageReadOnly(ioctx, name, librbd.NoSnapshot)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+	defer image.Close()
+
+	_, err = image.GetMetadata(journalLessMetaKey)
+	if err == nil {
+		return false, false, nil
+	}
+	if !errors.Is(err, librbd.ErrNotFound) {
+		return false, false, err
+	}
+	created, err := image.GetCreateTimestamp()
+	if err != nil {
+		return false, false, err
+	}
+	if c.opts.Young(time.Unix(created.Sec, created.Nsec), c.now) {
+		return false, false, nil
+	}
+	info, err := image.GetMirrorImageInfo()
+	if err != nil {
+		return false, false, err
+	}
+
+	return true, info.State == librbd.MirrorImageEnabled && !info.Primary, nil
+}
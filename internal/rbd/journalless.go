@@ -0,0 +1,431 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// journalLessKey is the parameter of the StorageClass that provisions
+	// volumes without reserving them in the journal, for volumes that are
+	// created and deleted often, like generic ephemeral volumes.
+	journalLessKey = "journalLess"
+
+	// journalLessMetaKey is set on the images of journal-less volumes, the
+	// value is the request name of the volume.
+	journalLessMetaKey = "rbd.csi.ceph.com/journal-less"
+
+	// journalLessOwnerMetaKey is set on the images of journal-less volumes
+	// with an owner, the value is the owner that the image counts for in
+	// the tenant quota.
+	journalLessOwnerMetaKey = "rbd.csi.ceph.com/journal-less-owner"
+
+	// journalLessImagePrefix is the prefix of the images of journal-less
+	// volumes, the same as the default of journaled volumes.
+	journalLessImagePrefix = "csi-vol-"
+)
+
+// journalLessNamespace is the namespace of the name based UUIDs of
+// journal-less volumes.
+var journalLessNamespace = uuid.NewSHA1(uuid.NameSpaceOID, []byte("rbd.csi.ceph.com/journal-less"))
+
+// journalLessUUID returns the UUID of the journal-less volume with the
+// request name, for the instance of the driver. Retries of CreateVolume get
+// the same UUID, which makes the image name and the volume ID derivable
+// without a journal.
+func journalLessUUID(instanceID, requestName string) string {
+	return uuid.NewSHA1(journalLessNamespace, []byte(instanceID+"/"+requestName)).String()
+}
+
+// journalLessImageName returns the name of the image of the journal-less
+// volume with the UUID.
+func journalLessImageName(objectUUID string) string {
+	return journalLessImagePrefix + objectUUID
+}
+
+// isJournalLess returns whether the parameters request a journal-less volume.
+func isJournalLess(parameters map[string]string) (bool, error) {
+	val, ok := parameters[journalLessKey]
+	if !ok {
+		return false, nil
+	}
+
+	journalLess, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, fmt.Errorf("failed to parse %s %q: %w", journalLessKey, val, err)
+	}
+
+	return journalLess, nil
+}
+
+// validateJournalLess checks that the journal-less volume does not need any
+// of the features that store their state in the journal.
+func validateJournalLess(rbdVol *rbdVolume, req *csi.CreateVolumeRequest) error {
+	switch {
+	case rbdVol.isEncrypted():
+		return fmt.Errorf("%s volumes can not be encrypted", journalLessKey)
+	case rbdVol.NamePrefix != "":
+		return fmt.Errorf("%s volumes can not have a volumeNamePrefix", journalLessKey)
+	case req.GetVolumeContentSource() != nil:
+		return fmt.Errorf("%s volumes can not be created from a snapshot or a volume", journalLessKey)
+	}
+
+	return nil
+}
+
+// createJournalLessVolume creates the image of the journal-less volume, or
+// returns the existing image of a previous attempt. Instead of a reservation
+// in the journal, the image is marked with its request name.
+func (cs *ControllerServer) createJournalLessVolume(
+	ctx context.Context,
+	req *csi.CreateVolumeRequest,
+	cr *util.Credentials,
+	rbdVol *rbdVolume,
+) (*csi.CreateVolumeResponse, error) {
+	err := updateTopologyConstraints(rbdVol, nil)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	imagePoolID, err := util.GetPoolID(rbdVol.Monitors, cr, rbdVol.Pool)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	rbdVol.ReservedID = journalLessUUID(CSIInstanceID, rbdVol.RequestName)
+	rbdVol.RbdImageName = journalLessImageName(rbdVol.ReservedID)
+	rbdVol.VolID, err = util.GenerateVolID(ctx, rbdVol.Monitors, cr, imagePoolID, rbdVol.Pool,
+		rbdVol.ClusterID, rbdVol.ReservedID, volIDVersion)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	// reserved is set when this attempt reserved the quota of the image,
+	// only then it is released when the image is deleted again
+	reserved := false
+	requestName, err := rbdVol.GetMetadata(journalLessMetaKey)
+	switch {
+	case err == nil:
+		if requestName != rbdVol.RequestName {
+			return nil, status.Errorf(codes.AlreadyExists, "image %s belongs to request name %s",
+				rbdVol, requestName)
+		}
+		err = rbdVol.getImageInfo()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if rbdVol.VolSize < rbdVol.RequestedVolSize {
+			return nil, status.Errorf(codes.AlreadyExists, "image %s with size %d is smaller than requested %d",
+				rbdVol, rbdVol.VolSize, rbdVol.RequestedVolSize)
+		}
+		log.DebugLog(ctx, "found existing image %s of journal-less request name %s", rbdVol, rbdVol.RequestName)
+		err = rbdVol.setMutableParameters(req.GetMutableParameters())
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+
+		return buildCreateVolumeResponse(req, rbdVol), nil
+	case errors.Is(err, ErrImageNotFound):
+		err = reserveTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
+		if errors.Is(err, util.ErrTenantQuotaExceeded) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		err = createImage(ctx, rbdVol, cr)
+		if err != nil {
+			log.ErrorLog(ctx, "failed to create volume: %v", err)
+			releaseTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		reserved = true
+	case errors.Is(err, librbd.ErrNotFound):
+		// a previous attempt failed to mark the image, the name is derived
+		// from the request name, so the image is not of another volume. Its
+		// quota was reserved by that attempt, not by this one.
+		err = rbdVol.getImageInfo()
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		if rbdVol.VolSize < rbdVol.RequestedVolSize {
+			return nil, status.Errorf(codes.AlreadyExists, "image %s with size %d is smaller than requested %d",
+				rbdVol, rbdVol.VolSize, rbdVol.RequestedVolSize)
+		}
+		log.DebugLog(ctx, "found unmarked image %s of journal-less request name %s", rbdVol, rbdVol.RequestName)
+	default:
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	defer func() {
+		if err != nil {
+			if deleteErr := rbdVol.deleteImage(ctx); deleteErr != nil {
+				log.ErrorLog(ctx, "failed to delete rbd image: %s with error: %v", rbdVol, deleteErr)
+			} else if reserved {
+				releaseTenantQuota(ctx, rbdVol, cr, rbdVol.VolSize)
+			}
+		}
+	}()
+
+	// the owner is set before the image is marked, so that marked images
+	// always count for the quota of their owner
+	if rbdVol.Owner != "" {
+		err = rbdVol.SetMetadata(journalLessOwnerMetaKey, rbdVol.Owner)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
+	err = rbdVol.SetMetadata(journalLessMetaKey, rbdVol.RequestName)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	metadata := util.AddCorrelationIDMetadata(ctx, k8s.GetVolumeMetadata(req.GetParameters()))
+	err = rbdVol.setAllMetadata(metadata)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	err = rbdVol.setMutableParameters(req.GetMutableParameters())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	log.DebugLog(ctx, "created journal-less image %s for request name %s", rbdVol, rbdVol.RequestName)
+
+	return buildCreateVolumeResponse(req, rbdVol), nil
+}
+
+// openJournalLessVolume fills the volume with the details of the image of
+// the journal-less volume with the UUID. ErrImageNotFound is returned when
+// the image does not exist, and librbd.ErrNotFound when the image is not of
+// a journal-less volume.
+func (rv *rbdVolume) openJournalLessVolume(objectUUID string) error {
+	rv.RbdImageName = journalLessImageName(objectUUID)
+	requestName, err := rv.GetMetadata(journalLessMetaKey)
+	if err != nil {
+		return err
+	}
+
+	owner, err := rv.GetMetadata(journalLessOwnerMetaKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return err
+	}
+
+	rv.RequestName = requestName
+	rv.ReservedID = objectUUID
+	rv.Owner = owner
+	rv.JournalLess = true
+
+	return rv.getImageInfo()
+}
+
+// getJournalLessVolume returns the volume for ControllerGetVolume if the ID
+// is of an existing journal-less volume.
+func getJournalLessVolume(
+	ctx context.Context,
+	l *journalLister,
+	vi util.CSIIdentifier,
+	volID string,
+) (*csi.ControllerGetVolumeResponse, error) {
+	c := l.clusters[vi.ClusterID]
+	pool, err := util.GetPoolName(c.monitors, c.cr, vi.LocationID)
+	if errors.Is(err, util.ErrPoolNotFound) {
+		return nil, status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	ri, ok, err := l.listedImage(ctx, vi.ClusterID, pool, journalLessImageName(vi.ObjectUUID))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+	}
+	defer ri.Destroy()
+
+	_, err = ri.GetMetadata(journalLessMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return nil, status.Errorf(codes.NotFound, "volume ID %s not found", volID)
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	condition, err := l.imageCondition(ri)
+	if err != nil {
+		log.ErrorLog(ctx, "failed to get condition of volume %s: %v", volID, err)
+
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &csi.ControllerGetVolumeResponse{
+		Volume: &csi.Volume{VolumeId: volID, CapacityBytes: ri.VolSize},
+		Status: &csi.ControllerGetVolumeResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, nil
+}
+
+// journalLessPool holds the journal-less volumes of a pool as reservations,
+// so that they are listed together with the reservations in the journal.
+type journalLessPool struct {
+	// reservations are ordered by request name
+	reservations []journal.Reservation
+	// uuids are the UUIDs of the volumes by request name
+	uuids map[string]string
+}
+
+// journalLessVolumes returns the journal-less volumes in the pool of the
+// location, the images of the pool are listed once per listing.
+func (l *journalLister) journalLessVolumes(ctx context.Context, loc journal.ListLocation) (*journalLessPool, error) {
+	if jlp, ok := l.journalLess[loc]; ok {
+		return jlp, nil
+	}
+
+	c := l.clusters[loc.ClusterID]
+	conn := &util.ClusterConnection{}
+	err := conn.Connect(c.monitors, c.cr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Destroy()
+
+	jlp := &journalLessPool{uuids: map[string]string{}}
+	ioctx, err := conn.GetIoctx(loc.Pool)
+	if errors.Is(err, util.ErrPoolNotFound) {
+		l.journalLess[loc] = jlp
+
+		return jlp, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer ioctx.Destroy()
+	ioctx.SetNamespace(c.radosNamespace)
+
+	names, err := librbd.GetImageNames(ioctx)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return nil, err
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, journalLessImagePrefix) {
+			continue
+		}
+		requestName, ok, err := journalLessRequestName(ioctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if image %s/%s is journal-less: %w", loc.Pool, name, err)
+		}
+		if !ok {
+			continue
+		}
+		objectUUID := strings.TrimPrefix(name, journalLessImagePrefix)
+		jlp.reservations = append(jlp.reservations, journal.Reservation{
+			RequestName: requestName,
+			ImageUUID:   objectUUID,
+			ImagePoolID: util.InvalidPoolID,
+		})
+		jlp.uuids[requestName] = objectUUID
+	}
+	sort.Slice(jlp.reservations, func(i, j int) bool {
+		return jlp.reservations[i].RequestName < jlp.reservations[j].RequestName
+	})
+	log.DebugLog(ctx, "found %d journal-less volumes in pool %s of cluster %s",
+		len(jlp.reservations), loc.Pool, loc.ClusterID)
+	l.journalLess[loc] = jlp
+
+	return jlp, nil
+}
+
+// isJournalLess returns whether the reservation is of a journal-less volume
+// of the location that journalLessVolumes listed.
+func (l *journalLister) isJournalLess(loc journal.ListLocation, rsv journal.Reservation) bool {
+	jlp, ok := l.journalLess[loc]
+
+	return ok && rsv.ImagePoolID == util.InvalidPoolID && jlp.uuids[rsv.RequestName] == rsv.ImageUUID
+}
+
+// journalLessRequestName returns the request name of the image, false is
+// returned when the image does not exist (anymore) or is not of a
+// journal-less volume.
+func journalLessRequestName(ioctx *rados.IOContext, name string) (string, bool, error) {
+	image, err := librbd.OpenImageReadOnly(ioctx, name, librbd.NoSnapshot)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer image.Close()
+
+	requestName, err := image.GetMetadata(journalLessMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return requestName, true, nil
+}
+
+// mergeReservations merges the journal-less reservations into a chunk of
+// the reservations of the journal, which starts after startAfter and ends
+// with next when more reservations follow. Both are ordered by request name,
+// journal-less reservations are added when they fall in the chunk.
+func mergeReservations(reservations, journalLess []journal.Reservation, startAfter, next string) []journal.Reservation {
+	merged := make([]journal.Reservation, 0, len(reservations))
+	i := 0
+	for j := range journalLess {
+		rsv := journalLess[j]
+		if rsv.RequestName <= startAfter {
+			continue
+		}
+		if next != "" && rsv.RequestName > next {
+			break
+		}
+		for i < len(reservations) && reservations[i].RequestName < rsv.RequestName {
+			merged = append(merged, reservations[i])
+			i++
+		}
+		merged = append(merged, rsv)
+	}
+
+	return append(merged, reservations[i:]...)
+}
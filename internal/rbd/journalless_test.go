@@ -0,0 +1,165 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+
+	"github.com/google/uuid"
+)
+
+func TestJournalLessUUID(t *testing.T) {
+	t.Parallel()
+
+	id := journalLessUUID("default", "pvc-1")
+	if _, err := uuid.Parse(id); err != nil {
+		t.Errorf("journalLessUUID() = %q is not a UUID: %v", id, err)
+	}
+	if again := journalLessUUID("default", "pvc-1"); again != id {
+		t.Errorf("journalLessUUID() = %q, the same request name had %q", again, id)
+	}
+	if other := journalLessUUID("default", "pvc-2"); other == id {
+		t.Errorf("journalLessUUID() = %q for different request names", id)
+	}
+	if other := journalLessUUID("other", "pvc-1"); other == id {
+		t.Errorf("journalLessUUID() = %q for different instances", id)
+	}
+	if name := journalLessImageName(id); name != "csi-vol-"+id {
+		t.Errorf("journalLessImageName() = %q, want csi-vol-%s", name, id)
+	}
+}
+
+func TestIsJournalLess(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       bool
+		wantErr    bool
+	}{
+		{
+			name:       "not set",
+			parameters: map[string]string{},
+			want:       false,
+		},
+		{
+			name:       "enabled",
+			parameters: map[string]string{journalLessKey: "true"},
+			want:       true,
+		},
+		{
+			name:       "disabled",
+			parameters: map[string]string{journalLessKey: "false"},
+			want:       false,
+		},
+		{
+			name:       "invalid",
+			parameters: map[string]string{journalLessKey: "yes"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := isJournalLess(ts.parameters)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("isJournalLess() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("isJournalLess() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestMergeReservations(t *testing.T) {
+	t.Parallel()
+	rsv := func(names ...string) []journal.Reservation {
+		reservations := []journal.Reservation{}
+		for _, name := range names {
+			reservations = append(reservations, journal.Reservation{RequestName: name})
+		}
+
+		return reservations
+	}
+	requestNames := func(reservations []journal.Reservation) []string {
+		names := []string{}
+		for i := range reservations {
+			names = append(names, reservations[i].RequestName)
+		}
+
+		return names
+	}
+
+	tests := []struct {
+		name         string
+		reservations []journal.Reservation
+		journalLess  []journal.Reservation
+		startAfter   string
+		next         string
+		want         []string
+	}{
+		{
+			name:         "no journal-less volumes",
+			reservations: rsv("pvc-a", "pvc-c"),
+			journalLess:  rsv(),
+			want:         []string{"pvc-a", "pvc-c"},
+		},
+		{
+			name:         "only journal-less volumes",
+			reservations: rsv(),
+			journalLess:  rsv("pvc-b", "pvc-d"),
+			want:         []string{"pvc-b", "pvc-d"},
+		},
+		{
+			name:         "merged in order",
+			reservations: rsv("pvc-a", "pvc-c", "pvc-e"),
+			journalLess:  rsv("pvc-b", "pvc-d", "pvc-f"),
+			want:         []string{"pvc-a", "pvc-b", "pvc-c", "pvc-d", "pvc-e", "pvc-f"},
+		},
+		{
+			name:         "chunk in the middle",
+			reservations: rsv("pvc-c", "pvc-e"),
+			journalLess:  rsv("pvc-a", "pvc-b", "pvc-d", "pvc-f"),
+			startAfter:   "pvc-b",
+			next:         "pvc-e",
+			want:         []string{"pvc-c", "pvc-d", "pvc-e"},
+		},
+		{
+			name:         "last chunk",
+			reservations: rsv("pvc-c"),
+			journalLess:  rsv("pvc-b", "pvc-d"),
+			startAfter:   "pvc-b",
+			want:         []string{"pvc-c", "pvc-d"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := requestNames(mergeReservations(ts.reservations, ts.journalLess, ts.startAfter, ts.next))
+			if !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("mergeReservations() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uuidLength is the length of the UUID at the end of the image names.
+const uuidLength = 36
+
+// listCluster is a cluster with the journal connection to list its
+// reservations.
+type listCluster struct {
+	id             string
+	monitors       string
+	radosNamespace string
+	cr             *util.Credentials
+	journal        *journal.Connection
+}
+
+// journalLister lists the images of the reservations in the journals of the
+// pools of clusters.
+type journalLister struct {
+	clusters  map[string]*listCluster
+	locations []journal.ListLocation
+	// available are the bytes that can still be stored in the pools, per
+	// cluster, fetched once for the conditions of the volumes
+	available map[string]map[string]int64
+	// journalLess are the journal-less volumes of the locations, listed
+	// once per listing
+	journalLess map[journal.ListLocation]*journalLessPool
+}
+
+// listCredentials returns the credentials for listing the journals of the
+// cluster, which are the secrets of the request, or those in the credentials
+// directory of the cluster.
+func listCredentials(clusterID string, secrets map[string]string) (*util.Credentials, error) {
+	if len(secrets) != 0 {
+		return util.NewUserCredentials(secrets)
+	}
+
+	return util.NewCredentialsFromFiles(util.CsiConfigFile, clusterID)
+}
+
+// newJournalLister connects to the journals of the clusters, and lists their
+// pools, which are the locations of the listing. Clusters without
+// credentials are skipped, util.ErrNoCredentials is returned if there are no
+// credentials for any of the clusters.
+func newJournalLister(
+	ctx context.Context,
+	jc *journal.Config,
+	clusterIDs []string,
+	secrets map[string]string,
+) (*journalLister, error) {
+	l := &journalLister{
+		clusters:    map[string]*listCluster{},
+		available:   map[string]map[string]int64{},
+		journalLess: map[journal.ListLocation]*journalLessPool{},
+	}
+	var err error
+	defer func() {
+		if err != nil {
+			l.destroy()
+		}
+	}()
+
+	for _, id := range clusterIDs {
+		var cr *util.Credentials
+		cr, err = listCredentials(id, secrets)
+		if errors.Is(err, util.ErrNoCredentials) {
+			log.DebugLog(ctx, "not listing cluster %s: %v", id, err)
+			err = nil
+
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := &listCluster{id: id, cr: cr}
+		l.clusters[id] = c
+
+		c.monitors, _, err = util.GetMonsAndClusterID(ctx, id, false)
+		if err != nil {
+			return nil, err
+		}
+		c.radosNamespace, err = util.GetRadosNamespace(util.CsiConfigFile, id)
+		if err != nil {
+			return nil, err
+		}
+		c.journal, err = jc.Connect(c.monitors, c.radosNamespace, cr)
+		if err != nil {
+			return nil, err
+		}
+		var pools []string
+		pools, err = util.ListPools(c.monitors, cr)
+		if err != nil {
+			return nil, err
+		}
+		for _, pool := range pools {
+			l.locations = append(l.locations, journal.ListLocation{ClusterID: id, Pool: pool})
+		}
+	}
+	if len(clusterIDs) != 0 && len(l.clusters) == 0 {
+		err = util.ErrNoCredentials
+
+		return nil, err
+	}
+	journal.SortListLocations(l.locations)
+
+	return l, nil
+}
+
+// destroy closes the journal connections and removes the credentials.
+func (l *journalLister) destroy() {
+	for _, c := range l.clusters {
+		if c.journal != nil {
+			c.journal.Destroy()
+		}
+		c.cr.DeleteCredentials()
+	}
+}
+
+// list returns the function to list the reservations of a location for
+// journal.ListPages.
+func (l *journalLister) list(
+	ctx context.Context,
+) func(journal.ListLocation, string, int) ([]journal.Reservation, string, error) {
+	return func(loc journal.ListLocation, startAfter string, maxEntries int) ([]journal.Reservation, string, error) {
+		return l.clusters[loc.ClusterID].journal.ListReservations(ctx, loc.Pool, startAfter, maxEntries)
+	}
+}
+
+// listVolumes returns the function to list the reservations of a location
+// and the journal-less volumes in its pool, ordered by request name, for
+// journal.ListPages.
+func (l *journalLister) listVolumes(
+	ctx context.Context,
+) func(journal.ListLocation, string, int) ([]journal.Reservation, string, error) {
+	return func(loc journal.ListLocation, startAfter string, maxEntries int) ([]journal.Reservation, string, error) {
+		reservations, next, err := l.clusters[loc.ClusterID].journal.ListReservations(
+			ctx, loc.Pool, startAfter, maxEntries)
+		if err != nil {
+			return nil, "", err
+		}
+		jlp, err := l.journalLessVolumes(ctx, loc)
+		if err != nil {
+			return nil, "", err
+		}
+
+		return mergeReservations(reservations, jlp.reservations, startAfter, next), next, nil
+	}
+}
+
+// reservedAttributes returns the pool of the image of the reservation in the
+// journal of the location, and the attributes of the image. false is
+// returned when the attributes are not stored (yet, or anymore). The
+// attributes of journal-less volumes are derived from their reservation.
+func (l *journalLister) reservedAttributes(
+	ctx context.Context,
+	loc journal.ListLocation,
+	rsv journal.Reservation,
+	isSnapshot bool,
+) (string, *journal.ImageAttributes, bool, error) {
+	if !isSnapshot && l.isJournalLess(loc, rsv) {
+		return loc.Pool, &journal.ImageAttributes{
+			RequestName: rsv.RequestName,
+			ImageName:   journalLessImageName(rsv.ImageUUID),
+		}, true, nil
+	}
+
+	c := l.clusters[loc.ClusterID]
+	pool := loc.Pool
+	if rsv.ImagePoolID != util.InvalidPoolID {
+		var err error
+		pool, err = util.GetPoolName(c.monitors, c.cr, rsv.ImagePoolID)
+		if errors.Is(err, util.ErrPoolNotFound) {
+			log.DebugLog(ctx, "skipping reservation %q of deleted pool: %v", rsv.RequestName, err)
+
+			return "", nil, false, nil
+		}
+		if err != nil {
+			return "", nil, false, err
+		}
+	}
+
+	attrs, err := c.journal.GetImageAttributes(ctx, pool, rsv.ImageUUID, isSnapshot)
+	if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		log.DebugLog(ctx, "skipping reservation %q without attributes: %v", rsv.RequestName, err)
+
+		return "", nil, false, nil
+	}
+	if err != nil {
+		return "", nil, false, err
+	}
+
+	return pool, attrs, true, nil
+}
+
+// listedImage returns the connected image of the cluster with its size and
+// creation time, false is returned when the image does not exist. The caller
+// needs to destroy the image.
+func (l *journalLister) listedImage(ctx context.Context, clusterID, pool, name string) (*rbdImage, bool, error) {
+	c := l.clusters[clusterID]
+	ri := &rbdImage{
+		ClusterID:      clusterID,
+		Monitors:       c.monitors,
+		Pool:           pool,
+		RadosNamespace: c.radosNamespace,
+		RbdImageName:   name,
+	}
+	err := ri.Connect(c.cr)
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = ri.getImageInfo()
+	if errors.Is(err, ErrImageNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		log.DebugLog(ctx, "skipping image %s that does not exist: %v", ri, err)
+		ri.Destroy()
+
+		return nil, false, nil
+	}
+	if err != nil {
+		ri.Destroy()
+
+		return nil, false, err
+	}
+
+	return ri, true, nil
+}
+
+// poolAvailableBytes returns the bytes that can still be stored in the pool
+// of the cluster. The pools of a cluster are only queried once.
+func (l *journalLister) poolAvailableBytes(clusterID, pool string) (int64, error) {
+	pools, ok := l.available[clusterID]
+	if !ok {
+		var err error
+		pools, err = util.GetPoolsAvailableBytes(clusterID)
+		if err != nil {
+			return 0, err
+		}
+		l.available[clusterID] = pools
+	}
+	available, ok := pools[pool]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", util.ErrPoolNotFound, pool)
+	}
+
+	return available, nil
+}
+
+// imageCondition returns the condition of the volume with the connected
+// image, see volumeCondition.
+func (l *journalLister) imageCondition(ri *rbdImage) (*csi.VolumeCondition, error) {
+	available, err := l.poolAvailableBytes(ri.ClusterID, ri.Pool)
+	if err != nil {
+		return nil, err
+	}
+	mirrorStatus, err := ri.getLocalMirroringStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	return volumeCondition(ri.Pool, available, mirrorStatus), nil
+}
+
+// reservedID returns the CSI ID of the volume or snapshot with the UUID, in
+// the pool with the ID. The ID of the pool is looked up when it is
+// util.InvalidPoolID.
+func (l *journalLister) reservedID(
+	ctx context.Context,
+	clusterID string,
+	poolID int64,
+	pool, uuid string,
+) (string, error) {
+	c := l.clusters[clusterID]
+
+	return util.GenerateVolID(ctx, c.monitors, c.cr, poolID, pool, clusterID, uuid, volIDVersion)
+}
+
+// volumeEntry returns the entry of ListVolumes for the reservation, false is
+// returned for volumes that are being created or deleted.
+func (l *journalLister) volumeEntry(
+	ctx context.Context,
+	loc journal.ListLocation,
+	rsv journal.Reservation,
+) (*csi.ListVolumesResponse_Entry, bool, error) {
+	pool, attrs, ok, err := l.reservedAttributes(ctx, loc, rsv, false)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	ri, ok, err := l.listedImage(ctx, loc.ClusterID, pool, attrs.ImageName)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	defer ri.Destroy()
+	volID, err := l.reservedID(ctx, loc.ClusterID, rsv.ImagePoolID, pool, rsv.ImageUUID)
+	if err != nil {
+		return nil, false, err
+	}
+	condition, err := l.imageCondition(ri)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &csi.ListVolumesResponse_Entry{
+		Volume: &csi.Volume{
+			VolumeId:      volID,
+			CapacityBytes: ri.VolSize,
+		},
+		Status: &csi.ListVolumesResponse_VolumeStatus{
+			VolumeCondition: condition,
+		},
+	}, true, nil
+}
+
+// snapshotFilter returns whether the snapshot of the source image is
+// listed, images are compared by the UUID at the end of their name.
+type snapshotFilter func(clusterID string, poolID int64, sourceName string) bool
+
+// snapshotEntry returns the entry of ListSnapshots for the reservation, if
+// the filter accepts the snapshot. false is returned for snapshots that are
+// filtered, or that are being created or deleted.
+func (l *journalLister) snapshotEntry(
+	ctx context.Context,
+	loc journal.ListLocation,
+	rsv journal.Reservation,
+	filter snapshotFilter,
+) (*csi.ListSnapshotsResponse_Entry, bool, error) {
+	pool, attrs, ok, err := l.reservedAttributes(ctx, loc, rsv, true)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	c := l.clusters[loc.ClusterID]
+	poolID := rsv.ImagePoolID
+	if poolID == util.InvalidPoolID {
+		poolID, err = util.GetPoolID(c.monitors, c.cr, pool)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	if filter != nil && !filter(loc.ClusterID, poolID, attrs.SourceName) {
+		return nil, false, nil
+	}
+
+	ri, ok, err := l.listedImage(ctx, loc.ClusterID, pool, attrs.ImageName)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	defer ri.Destroy()
+	snapID, err := l.reservedID(ctx, loc.ClusterID, poolID, pool, rsv.ImageUUID)
+	if err != nil {
+		return nil, false, err
+	}
+	// the source volume is in the pool of the snapshot
+	sourceID := ""
+	if len(attrs.SourceName) >= uuidLength {
+		sourceID, err = l.reservedID(ctx, loc.ClusterID, poolID, pool,
+			attrs.SourceName[len(attrs.SourceName)-uuidLength:])
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	return &csi.ListSnapshotsResponse_Entry{
+		Snapshot: &csi.Snapshot{
+			SizeBytes:      ri.VolSize,
+			SnapshotId:     snapID,
+			SourceVolumeId: sourceID,
+			CreationTime:   ri.CreatedAt,
+			ReadyToUse:     true,
+		},
+	}, true, nil
+}
+
+// sourceVolumeFilter returns the filter for the snapshots of the volume.
+func sourceVolumeFilter(vi util.CSIIdentifier) snapshotFilter {
+	return func(clusterID string, poolID int64, sourceName string) bool {
+		return clusterID == vi.ClusterID && poolID == vi.LocationID &&
+			strings.HasSuffix(sourceName, vi.ObjectUUID)
+	}
+}
+
+// listError returns the gRPC error for a failed listing.
+func listError(ctx context.Context, err error) error {
+	log.ErrorLog(ctx, "listing failed: %v", err)
+	switch {
+	case errors.Is(err, journal.ErrInvalidListToken):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, util.ErrNoCredentials):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
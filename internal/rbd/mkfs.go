@@ -0,0 +1,209 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	// mkfsOptionsKey is the parameter of the StorageClass with the
+	// arguments of mkfs that replace the default arguments for the fsType.
+	mkfsOptionsKey = "mkfsOptions"
+	// xfsReflinkKey is the parameter of the StorageClass that enables
+	// reflink for xfs filesystems, so that files can be copied without
+	// copying their data.
+	xfsReflinkKey = "xfsReflink"
+	// xfsProjectQuotaKey is the parameter of the StorageClass that mounts
+	// xfs filesystems with project quotas, for quotas of directories in the
+	// volume.
+	xfsProjectQuotaKey = "xfsProjectQuota"
+
+	// mkfsBtrfs formats btrfs volumes, it is part of btrfs-progs, which is
+	// not installed in the cephcsi image.
+	mkfsBtrfs = "mkfs.btrfs"
+)
+
+// errXfsReflinkNotSupported is returned when reflink is enabled for a volume,
+// and mkfs.xfs on the node does not support reflink.
+var errXfsReflinkNotSupported = errors.New("mkfs.xfs does not support reflink")
+
+// errBtrfsNotSupported is returned when a volume is mounted with the btrfs
+// fsType, and the image of the plugin has no mkfs.btrfs.
+var errBtrfsNotSupported = errors.New("fsType btrfs needs " + mkfsBtrfs + ", which is not installed")
+
+// xfsOptions are the options of the StorageClass for xfs filesystems.
+type xfsOptions struct {
+	reflink      bool
+	projectQuota bool
+}
+
+// getXfsOptions returns the xfs options of the parameters or volume context.
+func getXfsOptions(parameters map[string]string) (xfsOptions, error) {
+	var (
+		opts xfsOptions
+		err  error
+	)
+	if val, ok := parameters[xfsReflinkKey]; ok {
+		opts.reflink, err = strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("failed to parse %s %q: %w", xfsReflinkKey, val, err)
+		}
+	}
+	if val, ok := parameters[xfsProjectQuotaKey]; ok {
+		opts.projectQuota, err = strconv.ParseBool(val)
+		if err != nil {
+			return opts, fmt.Errorf("failed to parse %s %q: %w", xfsProjectQuotaKey, val, err)
+		}
+	}
+
+	return opts, nil
+}
+
+// validateXfsOptions returns an error when the xfs options of the parameters
+// are invalid, or enabled for volumes that are mounted with another
+// filesystem type.
+func validateXfsOptions(parameters map[string]string, volCaps []*csi.VolumeCapability) error {
+	opts, err := getXfsOptions(parameters)
+	if err != nil || (!opts.reflink && !opts.projectQuota) {
+		return err
+	}
+
+	for _, volCap := range volCaps {
+		mnt := volCap.GetMount()
+		if mnt != nil && mnt.GetFsType() != "xfs" {
+			return fmt.Errorf("%s and %s need fsType xfs, not %q", xfsReflinkKey, xfsProjectQuotaKey, mnt.GetFsType())
+		}
+	}
+
+	return nil
+}
+
+// validateMkfsOptions returns an error when the parameters have mkfsOptions,
+// and the volume is mounted without an explicit fsType, as the arguments of
+// mkfs depend on the filesystem type.
+func validateMkfsOptions(parameters map[string]string, volCaps []*csi.VolumeCapability) error {
+	if _, ok := parameters[mkfsOptionsKey]; !ok {
+		return nil
+	}
+
+	for _, volCap := range volCaps {
+		mnt := volCap.GetMount()
+		if mnt != nil && mnt.GetFsType() == "" {
+			return fmt.Errorf("%s needs an explicit fsType", mkfsOptionsKey)
+		}
+	}
+
+	return nil
+}
+
+// validateFsType returns an error when a volume is mounted with the btrfs
+// fsType, and mkfs.btrfs is not found with lookPath. The controller and node
+// plugins run the same image, volumes that can not be formatted by
+// NodeStageVolume are not created.
+func validateFsType(volCaps []*csi.VolumeCapability, lookPath func(string) (string, error)) error {
+	for _, volCap := range volCaps {
+		if volCap.GetMount().GetFsType() != "btrfs" {
+			continue
+		}
+		if _, err := lookPath(mkfsBtrfs); err != nil {
+			return errBtrfsNotSupported
+		}
+	}
+
+	return nil
+}
+
+// mkfsArgs returns the arguments of mkfs.<fsType> to format a new volume
+// with, without the device. The mkfsOptions of the volume context replace the
+// default arguments of the fsType. With the default arguments, xfs is aligned
+// to the stripeUnit and stripeCount of the image, and has reflink enabled when
+// the xfsReflink of the volume context is set. No arguments are returned
+// for filesystem types that are not formatted with custom arguments, or
+// without a fsType.
+func mkfsArgs(fsType string, volContext map[string]string, xfsSupportsReflink bool) ([]string, error) {
+	if fsType == "" {
+		return nil, nil
+	}
+	if options, ok := volContext[mkfsOptionsKey]; ok {
+		return strings.Fields(options), nil
+	}
+
+	switch fsType {
+	case "ext4":
+		return []string{"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1"}, nil
+	case "xfs":
+		opts, err := getXfsOptions(volContext)
+		if err != nil {
+			return nil, err
+		}
+		if opts.reflink && !xfsSupportsReflink {
+			return nil, errXfsReflinkNotSupported
+		}
+		args := []string{"-K"}
+		// reflink is disabled, unless the StorageClass enables it
+		if xfsSupportsReflink {
+			reflink := "reflink=0"
+			if opts.reflink {
+				reflink = "reflink=1"
+			}
+			args = append(args, "-m", reflink)
+		}
+		stripe, err := xfsStripeAlignment(volContext)
+		if err != nil {
+			return nil, err
+		}
+		if stripe != "" {
+			args = append(args, "-d", stripe)
+		}
+
+		return args, nil
+	case "btrfs":
+		return []string{"-K"}, nil
+	}
+
+	return nil, nil
+}
+
+// xfsStripeAlignment returns the data section options of mkfs.xfs that align
+// the filesystem to the striping of the image, or an empty string for images
+// without a stripeUnit.
+func xfsStripeAlignment(volContext map[string]string) (string, error) {
+	val, ok := volContext["stripeUnit"]
+	if !ok {
+		return "", nil
+	}
+	stripeUnit, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse stripeUnit %s: %w", val, err)
+	}
+
+	stripeCount := uint64(1)
+	if val, ok = volContext["stripeCount"]; ok {
+		stripeCount, err = strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse stripeCount %s: %w", val, err)
+		}
+	}
+
+	return fmt.Sprintf("su=%d,sw=%d", stripeUnit, stripeCount), nil
+}
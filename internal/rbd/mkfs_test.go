@@ -0,0 +1,324 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestMkfsArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		fsType     string
+		volContext map[string]string
+		reflink    bool
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:       "ext4 defaults",
+			fsType:     "ext4",
+			volContext: map[string]string{},
+			want:       []string{"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1"},
+		},
+		{
+			name:       "xfs defaults",
+			fsType:     "xfs",
+			volContext: map[string]string{},
+			want:       []string{"-K"},
+		},
+		{
+			name:       "xfs with reflink support",
+			fsType:     "xfs",
+			volContext: map[string]string{},
+			reflink:    true,
+			want:       []string{"-K", "-m", "reflink=0"},
+		},
+		{
+			name:       "xfs with reflink enabled",
+			fsType:     "xfs",
+			volContext: map[string]string{xfsReflinkKey: "true"},
+			reflink:    true,
+			want:       []string{"-K", "-m", "reflink=1"},
+		},
+		{
+			name:       "xfs with reflink enabled, not supported by mkfs.xfs",
+			fsType:     "xfs",
+			volContext: map[string]string{xfsReflinkKey: "true"},
+			wantErr:    true,
+		},
+		{
+			name:       "xfs with invalid xfsReflink",
+			fsType:     "xfs",
+			volContext: map[string]string{xfsReflinkKey: "maybe"},
+			reflink:    true,
+			wantErr:    true,
+		},
+		{
+			name:       "xfs aligned to the stripes",
+			fsType:     "xfs",
+			volContext: map[string]string{"stripeUnit": "65536", "stripeCount": "16"},
+			want:       []string{"-K", "-d", "su=65536,sw=16"},
+		},
+		{
+			name:       "xfs with stripeUnit only",
+			fsType:     "xfs",
+			volContext: map[string]string{"stripeUnit": "65536"},
+			want:       []string{"-K", "-d", "su=65536,sw=1"},
+		},
+		{
+			name:       "xfs with invalid stripeCount",
+			fsType:     "xfs",
+			volContext: map[string]string{"stripeUnit": "65536", "stripeCount": "many"},
+			wantErr:    true,
+		},
+		{
+			name:       "btrfs defaults",
+			fsType:     "btrfs",
+			volContext: map[string]string{},
+			want:       []string{"-K"},
+		},
+		{
+			name:   "mkfsOptions replace the defaults",
+			fsType: "xfs",
+			volContext: map[string]string{
+				mkfsOptionsKey: " -K  -d agcount=8,su=4m,sw=1",
+				"stripeUnit":   "65536",
+			},
+			reflink: true,
+			want:    []string{"-K", "-d", "agcount=8,su=4m,sw=1"},
+		},
+		{
+			name:       "mkfsOptions without a fsType",
+			fsType:     "",
+			volContext: map[string]string{mkfsOptionsKey: "-K"},
+			want:       nil,
+		},
+		{
+			name:       "unknown filesystem type",
+			fsType:     "ext3",
+			volContext: map[string]string{},
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := mkfsArgs(ts.fsType, ts.volContext, ts.reflink)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("mkfsArgs() error = %v, wantErr %v", err, ts.wantErr)
+
+				return
+			}
+			if !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("mkfsArgs() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestValidateXfsOptions(t *testing.T) {
+	t.Parallel()
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+			},
+		}
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		volCaps    []*csi.VolumeCapability
+		wantErr    bool
+	}{
+		{
+			name:       "no xfs options",
+			parameters: map[string]string{},
+			volCaps:    []*csi.VolumeCapability{mountCap("ext4")},
+		},
+		{
+			name:       "disabled xfs options",
+			parameters: map[string]string{xfsReflinkKey: "false", xfsProjectQuotaKey: "false"},
+			volCaps:    []*csi.VolumeCapability{mountCap("ext4")},
+		},
+		{
+			name:       "xfs options for xfs",
+			parameters: map[string]string{xfsReflinkKey: "true", xfsProjectQuotaKey: "true"},
+			volCaps:    []*csi.VolumeCapability{mountCap("xfs")},
+		},
+		{
+			name:       "xfs options for block volumes",
+			parameters: map[string]string{xfsProjectQuotaKey: "true"},
+			volCaps:    []*csi.VolumeCapability{blockCap},
+		},
+		{
+			name:       "xfs options for ext4",
+			parameters: map[string]string{xfsProjectQuotaKey: "true"},
+			volCaps:    []*csi.VolumeCapability{mountCap("ext4")},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid xfsProjectQuota",
+			parameters: map[string]string{xfsProjectQuotaKey: "yes please"},
+			volCaps:    []*csi.VolumeCapability{mountCap("xfs")},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateXfsOptions(ts.parameters, ts.volCaps)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("validateXfsOptions() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateMkfsOptions(t *testing.T) {
+	t.Parallel()
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+			},
+		}
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		volCaps    []*csi.VolumeCapability
+		wantErr    bool
+	}{
+		{
+			name:       "no mkfsOptions",
+			parameters: map[string]string{},
+			volCaps:    []*csi.VolumeCapability{mountCap("")},
+		},
+		{
+			name:       "mkfsOptions with a fsType",
+			parameters: map[string]string{mkfsOptionsKey: "-K"},
+			volCaps:    []*csi.VolumeCapability{mountCap("xfs")},
+		},
+		{
+			name:       "mkfsOptions for block volumes",
+			parameters: map[string]string{mkfsOptionsKey: "-K"},
+			volCaps:    []*csi.VolumeCapability{blockCap},
+		},
+		{
+			name:       "mkfsOptions without a fsType",
+			parameters: map[string]string{mkfsOptionsKey: "-K"},
+			volCaps:    []*csi.VolumeCapability{mountCap("")},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateMkfsOptions(ts.parameters, ts.volCaps)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("validateMkfsOptions() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateFsType(t *testing.T) {
+	t.Parallel()
+	mountCap := func(fsType string) *csi.VolumeCapability {
+		return &csi.VolumeCapability{
+			AccessType: &csi.VolumeCapability_Mount{
+				Mount: &csi.VolumeCapability_MountVolume{FsType: fsType},
+			},
+		}
+	}
+	blockCap := &csi.VolumeCapability{
+		AccessType: &csi.VolumeCapability_Block{
+			Block: &csi.VolumeCapability_BlockVolume{},
+		},
+	}
+	installed := func(file string) (string, error) {
+		return "/usr/sbin/" + file, nil
+	}
+	missing := func(file string) (string, error) {
+		return "", exec.ErrNotFound
+	}
+
+	tests := []struct {
+		name     string
+		volCaps  []*csi.VolumeCapability
+		lookPath func(string) (string, error)
+		wantErr  bool
+	}{
+		{
+			name:     "ext4 without mkfs.btrfs",
+			volCaps:  []*csi.VolumeCapability{mountCap("ext4")},
+			lookPath: missing,
+		},
+		{
+			name:     "block without mkfs.btrfs",
+			volCaps:  []*csi.VolumeCapability{blockCap},
+			lookPath: missing,
+		},
+		{
+			name:     "btrfs with mkfs.btrfs",
+			volCaps:  []*csi.VolumeCapability{mountCap("btrfs")},
+			lookPath: installed,
+		},
+		{
+			name:     "btrfs without mkfs.btrfs",
+			volCaps:  []*csi.VolumeCapability{mountCap("btrfs")},
+			lookPath: missing,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateFsType(ts.volCaps, ts.lookPath)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("validateFsType() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if ts.wantErr && !errors.Is(err, errBtrfsNotSupported) {
+				t.Errorf("validateFsType() error = %v, want %v", err, errBtrfsNotSupported)
+			}
+		})
+	}
+}
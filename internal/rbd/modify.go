@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// imageConfigMetadataPrefix is the prefix of the image metadata keys that
+// override the librbd configuration of an image, like `rbd config image set`
+// stores them.
+const imageConfigMetadataPrefix = "conf_"
+
+// qosParameters are the mutable parameters of a VolumeAttributesClass, with
+// the librbd QoS options of the image that they set. The limits are only
+// applied by librbd clients (rbd-nbd), krbd ignores them.
+var qosParameters = map[string]string{
+	"qosIopsLimit":      "rbd_qos_iops_limit",
+	"qosReadIopsLimit":  "rbd_qos_read_iops_limit",
+	"qosWriteIopsLimit": "rbd_qos_write_iops_limit",
+	"qosBpsLimit":       "rbd_qos_bps_limit",
+	"qosReadBpsLimit":   "rbd_qos_read_bps_limit",
+	"qosWriteBpsLimit":  "rbd_qos_write_bps_limit",
+}
+
+// validateMutableParameters returns an error when the mutable parameters of
+// a CreateVolume or ControllerModifyVolume request contain a parameter that
+// can not be modified, or a limit that is not a number. A limit of 0 removes
+// the limit.
+func validateMutableParameters(parameters map[string]string) error {
+	for key, val := range parameters {
+		if _, ok := qosParameters[key]; !ok {
+			keys := make([]string, 0, len(qosParameters))
+			for k := range qosParameters {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			return fmt.Errorf("parameter %q can not be modified, the mutable parameters are %s",
+				key, strings.Join(keys, ", "))
+		}
+		if _, err := strconv.ParseUint(val, 10, 64); err != nil {
+			return fmt.Errorf("failed to parse %s %q: %w", key, val, err)
+		}
+	}
+
+	return nil
+}
+
+// setMutableParameters sets the QoS options of the mutable parameters on the
+// image. Setting the same parameters again does not change the image.
+func (rv *rbdVolume) setMutableParameters(parameters map[string]string) error {
+	for key, val := range parameters {
+		option := imageConfigMetadataPrefix + qosParameters[key]
+		err := rv.SetMetadata(option, val)
+		if err != nil {
+			return fmt.Errorf("failed to set %s to %q on image %s: %w", option, val, rv, err)
+		}
+	}
+
+	return nil
+}
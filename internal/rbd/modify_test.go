@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+)
+
+func TestValidateMutableParameters(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		wantErr    bool
+	}{
+		{
+			name:       "no parameters",
+			parameters: nil,
+		},
+		{
+			name:       "QoS limits",
+			parameters: map[string]string{"qosReadIopsLimit": "1000", "qosWriteBpsLimit": "10485760"},
+		},
+		{
+			name:       "removed limit",
+			parameters: map[string]string{"qosIopsLimit": "0"},
+		},
+		{
+			name:       "immutable parameter",
+			parameters: map[string]string{"pool": "replicapool"},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid limit",
+			parameters: map[string]string{"qosIopsLimit": "fast"},
+			wantErr:    true,
+		},
+		{
+			name:       "negative limit",
+			parameters: map[string]string{"qosBpsLimit": "-1"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := validateMutableParameters(ts.parameters)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("validateMutableParameters() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
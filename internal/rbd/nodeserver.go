@@ -23,11 +23,13 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	csicommon "github.com/ceph/ceph-csi/internal/csi-common"
 	"github.com/ceph/ceph-csi/internal/journal"
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	librbd "github.com/ceph/go-ceph/rbd"
 	"github.com/container-storage-interface/spec/lib/go/csi"
@@ -45,6 +47,12 @@ type NodeServer struct {
 	// A map storing all volumes with ongoing operations so that additional operations
 	// for that same volume (as defined by VolumeID) return an Aborted error
 	VolumeLocks *util.VolumeLocks
+	// MaxVolumesPerNode is the number of volumes that can be mapped on the
+	// node, 0 if there is no limit
+	MaxVolumesPerNode int64
+	// MountOptionsPolicy adds default mount options to the volumes, and
+	// rejects denied options, nil when there is no policy
+	MountOptionsPolicy *util.MountOptionsPolicy
 }
 
 // stageTransaction struct represents the state a transaction was when it either completed
@@ -301,6 +309,9 @@ func (ns *NodeServer) NodeStageVolume(
 	if err = util.ValidateNodeStageVolumeRequest(req); err != nil {
 		return nil, err
 	}
+	if err = ns.MountOptionsPolicy.CheckVolumeCapability(req.GetVolumeCapability()); err != nil {
+		return nil, err
+	}
 
 	volID := req.GetVolumeId()
 	cr, err := util.NewUserCredentialsWithMigration(req.GetSecrets())
@@ -330,6 +341,15 @@ func (ns *NodeServer) NodeStageVolume(
 
 			return &csi.NodeStageVolumeResponse{}, nil
 		}
+
+		// the pool of a topology constrained volume is only accessible
+		// from the topology segment that CreateVolume picked it for
+		err = util.CheckTopologySegment(req.GetVolumeContext(), ns.Driver.GetTopology())
+		if err != nil {
+			log.ErrorLog(ctx, "rbd: can not stage volume %s on this node: %v", volID, err)
+
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
 	}
 
 	isStaticVol := parseBoolOption(ctx, req.GetVolumeContext(), staticVol, false)
@@ -352,6 +372,33 @@ func (ns *NodeServer) NodeStageVolume(
 		return &csi.NodeStageVolumeResponse{}, nil
 	}
 
+	if needsStageLock(ctx, req.GetVolumeContext(), req.GetVolumeCapability()) {
+		err = checkStageLockCredentials(rv.ClusterID)
+		if err != nil {
+			log.ErrorLog(ctx, "rbd: can not lock volume %s: %v", volID, err)
+
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		err = rv.acquireStageLock(ctx, ns.Driver.GetNodeID())
+		if errors.Is(err, ErrStageLocked) {
+			log.ErrorLog(ctx, "rbd: can not stage volume %s: %v", volID, err)
+
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		rv.StageLock = true
+		defer func() {
+			if err != nil {
+				rErr := rv.releaseStageLock(ns.Driver.GetNodeID())
+				if rErr != nil {
+					log.ErrorLog(ctx, "rbd: failed to release lock of volume %s: %v", volID, rErr)
+				}
+			}
+		}()
+	}
+
 	// Stash image details prior to mapping the image (useful during Unstage as it has no
 	// voloptions passed to the RPC as per the CSI spec)
 	err = stashRBDImageMetadata(rv, stagingParentPath)
@@ -415,14 +462,12 @@ func (ns *NodeServer) stageTransaction(
 		volOptions, devicePath)
 
 	// userspace mounters like nbd need the device path as a reference while
-	// restarting the userspace processes on a nodeplugin restart. For kernel
-	// mounter(krbd) we don't need it as there won't be any process running
-	// in userspace, hence we don't store the device path for krbd devices.
-	if volOptions.Mounter == rbdNbdMounter {
-		err = updateRBDImageMetadataStash(req.GetStagingTargetPath(), devicePath)
-		if err != nil {
-			return transaction, err
-		}
+	// restarting the userspace processes on a nodeplugin restart. The device
+	// of krbd images is stored as well, so that a restarted nodeplugin does
+	// not need to list the mapped devices to find it again.
+	err = updateRBDImageMetadataStash(req.GetStagingTargetPath(), devicePath)
+	if err != nil {
+		return transaction, err
 	}
 
 	if volOptions.isEncrypted() {
@@ -672,6 +717,10 @@ func (ns *NodeServer) NodePublishVolume(
 	if err != nil {
 		return nil, err
 	}
+	err = ns.MountOptionsPolicy.CheckVolumeCapability(req.GetVolumeCapability())
+	if err != nil {
+		return nil, err
+	}
 	targetPath := req.GetTargetPath()
 	isBlock := req.GetVolumeCapability().GetBlock() != nil
 	stagingPath := req.GetStagingTargetPath()
@@ -708,6 +757,10 @@ func (ns *NodeServer) mountVolumeToStagePath(
 	staticVol bool,
 	stagingPath, devicePath string,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.mountVolumeToStagePath")
+	defer span.End()
+	defer util.ObserveOperation(ctx, "rbd", req.GetVolumeContext()["clusterID"], util.OpMount, time.Now())
+
 	readOnly := false
 	fsType := req.GetVolumeCapability().GetMount().GetFsType()
 	diskMounter := &mount.SafeFormatAndMount{Interface: ns.Mounter, Exec: utilexec.New()}
@@ -745,22 +798,24 @@ func (ns *NodeServer) mountVolumeToStagePath(
 
 	if fsType == "xfs" {
 		opt = append(opt, "nouuid")
+		xfsOpts, xfsErr := getXfsOptions(req.GetVolumeContext())
+		if xfsErr != nil {
+			return xfsErr
+		}
+		if xfsOpts.projectQuota {
+			opt = append(opt, "prjquota")
+		}
 	}
 
-	if existingFormat == "" && !staticVol && !readOnly {
-		args := []string{}
-		switch fsType {
-		case "ext4":
-			args = []string{"-m0", "-Enodiscard,lazy_itable_init=1,lazy_journal_init=1", devicePath}
-		case "xfs":
-			args = []string{"-K", devicePath}
-			// always disable reflink
-			// TODO: make enabling an option, see ceph/ceph-csi#1256
-			if ns.xfsSupportsReflink() {
-				args = append(args, "-m", "reflink=0")
-			}
+	// block volumes and volumes without a fsType are not formatted with
+	// custom arguments
+	if existingFormat == "" && !staticVol && !readOnly && !isBlock && fsType != "" {
+		args, argsErr := mkfsArgs(fsType, req.GetVolumeContext(), fsType == "xfs" && ns.xfsSupportsReflink())
+		if argsErr != nil {
+			return argsErr
 		}
 		if len(args) > 0 {
+			args = append(args, devicePath)
 			cmdOut, cmdErr := diskMounter.Exec.Command("mkfs."+fsType, args...).CombinedOutput()
 			if cmdErr != nil {
 				log.ErrorLog(ctx, "failed to run mkfs error: %v, output: %v", cmdErr, string(cmdOut))
@@ -774,6 +829,12 @@ func (ns *NodeServer) mountVolumeToStagePath(
 		opt = append(opt, "bind")
 		err = diskMounter.MountSensitiveWithoutSystemd(devicePath, stagingPath, fsType, opt, nil)
 	} else {
+		policyFsType := fsType
+		if policyFsType == "" {
+			// FormatAndMount formats volumes without fsType with ext4
+			policyFsType = "ext4"
+		}
+		opt = ns.MountOptionsPolicy.WithDefaults(policyFsType, opt)
 		err = diskMounter.FormatAndMount(devicePath, stagingPath, fsType, opt)
 	}
 	if err != nil {
@@ -856,6 +917,7 @@ func (ns *NodeServer) NodeUnpublishVolume(
 	}
 
 	targetPath := req.GetTargetPath()
+	ns.StatsCache.Forget(targetPath)
 	// considering kubelet make sure node operations like unpublish/unstage...etc can not be called
 	// at same time, an explicit locking at time of nodeunpublish is not required.
 	isMnt, err := ns.Mounter.IsMountPoint(targetPath)
@@ -1001,6 +1063,17 @@ func (ns *NodeServer) NodeUnstageVolume(
 
 	log.DebugLog(ctx, "successfully unmapped volume (%s)", req.GetVolumeId())
 
+	// the stash is kept when the lock can not be released, so that the
+	// retry of the request releases it
+	if imgInfo.StageLock {
+		err = releaseStashedStageLock(ctx, &imgInfo, ns.Driver.GetNodeID())
+		if err != nil {
+			log.ErrorLog(ctx, "failed to release lock of volume (%s): %v", req.GetVolumeId(), err)
+
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+	}
+
 	if err = cleanupRBDImageMetadataStash(stagingParentPath); err != nil {
 		log.ErrorLog(ctx, "failed to cleanup image metadata stash (%v)", err)
 
@@ -1044,12 +1117,7 @@ func (ns *NodeServer) NodeExpandVolume(
 	if err != nil {
 		log.ErrorLog(ctx, "failed to find image metadata: %v", err)
 	}
-	devicePath, found := findDeviceMappingImage(
-		ctx,
-		imgInfo.Pool,
-		imgInfo.RadosNamespace,
-		imgInfo.ImageName,
-		imgInfo.NbdAccess)
+	devicePath, found := findStashedDevice(ctx, &imgInfo)
 	if !found {
 		return nil, status.Errorf(codes.Internal,
 			"failed to get device for stagingtarget path %v", volumePath)
@@ -1081,10 +1149,77 @@ func (ns *NodeServer) NodeExpandVolume(
 				"rbd: resize failed on path %s, error: %v", req.GetVolumePath(), err)
 		}
 	}
+	// the stats are requested for the published path, not the staging path
+	ns.StatsCache.Forget(req.GetVolumePath())
 
 	return &csi.NodeExpandVolumeResponse{}, nil
 }
 
+// findStashedDevice returns the device of the image in the stash, when it
+// still maps the image of the stash; device numbers are reused once an image
+// is unmapped. Stashes of krbd images that were staged by older versions do
+// not have the device, it is looked up in the mapped devices then.
+func findStashedDevice(ctx context.Context, imgInfo *rbdImageMetadataStash) (string, bool) {
+	if imgInfo.DevicePath != "" {
+		maps, err := stashedDeviceMapsImage(ctx, imgInfo)
+		if err == nil && maps {
+			return imgInfo.DevicePath, true
+		}
+		log.WarningLog(ctx, "stashed device %s of image %s is not available (mapped: %t, error: %v)",
+			imgInfo.DevicePath, imgInfo, maps, err)
+	}
+
+	return findDeviceMappingImage(
+		ctx,
+		imgInfo.Pool,
+		imgInfo.RadosNamespace,
+		imgInfo.ImageName,
+		imgInfo.NbdAccess)
+}
+
+// stashedDeviceMapsImage returns whether the stashed device maps the image of
+// the stash. krbd devices are checked in sysfs, rbd-nbd devices in the list
+// of the images that rbd-nbd mapped.
+func stashedDeviceMapsImage(ctx context.Context, imgInfo *rbdImageMetadataStash) (bool, error) {
+	if !imgInfo.NbdAccess {
+		return krbdDeviceMapsImage(
+			rbdSysfsDevices,
+			imgInfo.DevicePath,
+			imgInfo.Pool,
+			imgInfo.RadosNamespace,
+			imgInfo.ImageName)
+	}
+
+	devices, err := rbdGetDeviceList(ctx, accessTypeNbd)
+	if err != nil {
+		return false, err
+	}
+	for _, device := range devices {
+		if device.Device == imgInfo.DevicePath {
+			return device.Pool == imgInfo.Pool && device.RadosNamespace == imgInfo.RadosNamespace &&
+				device.Name == imgInfo.ImageName, nil
+		}
+	}
+
+	return false, nil
+}
+
+// NodeGetInfo returns the node ID and topology, and the number of volumes
+// that can be mapped on the node, so that the scheduler does not place more
+// pods with volumes on the node.
+func (ns *NodeServer) NodeGetInfo(
+	ctx context.Context,
+	req *csi.NodeGetInfoRequest,
+) (*csi.NodeGetInfoResponse, error) {
+	resp, err := ns.DefaultNodeServer.NodeGetInfo(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.MaxVolumesPerNode = ns.MaxVolumesPerNode
+
+	return resp, nil
+}
+
 // NodeGetCapabilities returns the supported capabilities of the node server.
 func (ns *NodeServer) NodeGetCapabilities(
 	ctx context.Context,
@@ -1234,6 +1369,15 @@ func (ns *NodeServer) NodeGetVolumeStats(
 		return nil, status.Error(codes.InvalidArgument, err.Error())
 	}
 
+	return ns.StatsCache.Get(ctx, targetPath, ns.getVolumeStats)
+}
+
+// getVolumeStats returns the stats of the filesystem or block device that is
+// published on the targetPath.
+func (ns *NodeServer) getVolumeStats(
+	ctx context.Context,
+	targetPath string,
+) (*csi.NodeGetVolumeStatsResponse, error) {
 	stat, err := os.Stat(targetPath)
 	if err != nil {
 		return nil, status.Errorf(codes.InvalidArgument, "failed to get stat for targetpath %q: %v", targetPath, err)
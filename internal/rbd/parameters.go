@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+)
+
+// volumeParameters are the parameters of a StorageClass that CreateVolume
+// accepts with strict parameter validation.
+var volumeParameters = []string{
+	"clusterID",
+	"pool",
+	"dataPool",
+	"volumeNamePrefix",
+	"snapshotNamePrefix",
+	"imageFeatures",
+	"mounter",
+	"tryOtherMounters",
+	"mapOptions",
+	"unmapOptions",
+	"cephLogDir",
+	"cephLogStrategy",
+	"encrypted",
+	"encryptionKMSID",
+	"stripeUnit",
+	"stripeCount",
+	"objectSize",
+	mkfsOptionsKey,
+	xfsReflinkKey,
+	xfsProjectQuotaKey,
+	"topologyConstrainedPools",
+	journalLessKey,
+	stageLockKey,
+}
+
+// snapshotParameters are the parameters of a VolumeSnapshotClass that
+// CreateSnapshot accepts with strict parameter validation.
+var snapshotParameters = []string{
+	"clusterID",
+	"pool",
+	"snapshotNamePrefix",
+	k8s.SnapshotRetentionKey,
+	util.MaxSnapshotsPerVolumeKey,
+}
+
+// checkVolumeParameters returns an error for parameters of the StorageClass
+// that CreateVolume does not know. The parameters of StorageClasses that are
+// migrated from the in-tree driver are not checked, they contain the
+// parameters of the in-tree driver.
+func checkVolumeParameters(parameters map[string]string) error {
+	if parameters[intreeMigrationKey] == intreeMigrationLabel {
+		return nil
+	}
+
+	return k8s.CheckParameters(parameters, volumeParameters)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// populateChunkSize is the size of the writes to the image while populating
+// it, which is the default object size of RBD images.
+const populateChunkSize = 4 * 1024 * 1024
+
+// ErrPopulateEncrypted is returned when populating an encrypted volume, the
+// stream would need to be written through the encryption of the nodeplugin.
+var ErrPopulateEncrypted = errors.New("encrypted volumes can not be populated")
+
+// PopulateVolume writes the stream to the image of the new volume with the
+// ID. The stream is the raw data of an image, like the output of "rbd export"
+// with the default export format 1, and may not be larger than the volume.
+func PopulateVolume(ctx context.Context, volumeID string, cr *util.Credentials, stream io.Reader) error {
+	rbdVol, err := genVolFromVolIDWithMigration(ctx, volumeID, cr, nil)
+	if err != nil {
+		return err
+	}
+	defer rbdVol.Destroy()
+	if rbdVol.isEncrypted() {
+		return fmt.Errorf("%w: %s", ErrPopulateEncrypted, rbdVol)
+	}
+
+	image, err := rbdVol.open()
+	if err != nil {
+		return err
+	}
+	defer image.Close()
+
+	written, err := copyToImage(image, stream, rbdVol.VolSize)
+	if err != nil {
+		return fmt.Errorf("failed to populate image %s: %w", rbdVol, err)
+	}
+	err = image.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to flush image %s: %w", rbdVol, err)
+	}
+	log.DebugLog(ctx, "populated image %s with %d bytes", rbdVol, written)
+
+	return nil
+}
+
+// copyToImage copies the stream to the start of the image of the size, and
+// returns the number of bytes of the stream. Chunks that only contain zeros
+// are not written, a new image reads as zeros already, and stays sparse. An
+// error is returned when the stream is larger than the image.
+func copyToImage(image io.WriterAt, stream io.Reader, size int64) (int64, error) {
+	buf := make([]byte, populateChunkSize)
+	var offset int64
+	for {
+		n, err := io.ReadFull(stream, buf)
+		if n > 0 {
+			if offset+int64(n) > size {
+				return offset, fmt.Errorf("stream is larger than the image of %d bytes", size)
+			}
+			if !isZeros(buf[:n]) {
+				_, wErr := image.WriteAt(buf[:n], offset)
+				if wErr != nil {
+					return offset, fmt.Errorf("failed to write at offset %d: %w", offset, wErr)
+				}
+			}
+			offset += int64(n)
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return offset, nil
+		}
+		if err != nil {
+			return offset, fmt.Errorf("failed to read stream at offset %d: %w", offset, err)
+		}
+	}
+}
+
+// isZeros returns whether the chunk only contains zeros.
+func isZeros(chunk []byte) bool {
+	for _, b := range chunk {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// fakeImage records the writes to an image.
+type fakeImage struct {
+	data   []byte
+	writes int
+}
+
+func (fi *fakeImage) WriteAt(p []byte, off int64) (int, error) {
+	fi.writes++
+
+	return copy(fi.data[off:], p), nil
+}
+
+func TestCopyToImage(t *testing.T) {
+	t.Parallel()
+	data := func(chunks ...byte) []byte {
+		d := []byte{}
+		for _, c := range chunks {
+			d = append(d, bytes.Repeat([]byte{c}, populateChunkSize)...)
+		}
+
+		return d
+	}
+	tests := []struct {
+		name    string
+		stream  []byte
+		size    int64
+		writes  int
+		wantErr bool
+	}{
+		{
+			name:   "empty stream",
+			stream: []byte{},
+			size:   populateChunkSize,
+			writes: 0,
+		},
+		{
+			name:   "zero chunks are skipped",
+			stream: data(1, 0, 2),
+			size:   3 * populateChunkSize,
+			writes: 2,
+		},
+		{
+			name:   "partial last chunk",
+			stream: append(data(1), []byte("tail")...),
+			size:   2 * populateChunkSize,
+			writes: 2,
+		},
+		{
+			name:    "stream larger than the image",
+			stream:  data(1, 2),
+			size:    populateChunkSize + 1,
+			writes:  1,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			image := &fakeImage{data: make([]byte, ts.size)}
+			written, err := copyToImage(image, bytes.NewReader(ts.stream), ts.size)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("copyToImage() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if image.writes != ts.writes {
+				t.Errorf("copyToImage() wrote %d chunks, want %d", image.writes, ts.writes)
+			}
+			if ts.wantErr {
+				return
+			}
+			if written != int64(len(ts.stream)) {
+				t.Errorf("copyToImage() = %d, want %d", written, len(ts.stream))
+			}
+			if !bytes.Equal(image.data[:written], ts.stream) {
+				t.Error("copyToImage() did not copy the stream")
+			}
+		})
+	}
+}
+
+func TestCopyToImageReadError(t *testing.T) {
+	t.Parallel()
+	image := &fakeImage{data: make([]byte, populateChunkSize)}
+	_, err := copyToImage(image, &failingReader{}, populateChunkSize)
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("copyToImage() error = %v, want the read error", err)
+	}
+}
+
+// failingReader returns some data, and then fails.
+type failingReader struct {
+	read bool
+}
+
+func (fr *failingReader) Read(p []byte) (int, error) {
+	if fr.read {
+		return 0, errors.New("connection reset")
+	}
+	fr.read = true
+
+	return copy(p, "data"), nil
+}
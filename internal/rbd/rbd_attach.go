@@ -22,12 +22,14 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"k8s.io/apimachinery/pkg/util/wait"
@@ -42,6 +44,10 @@ const (
 
 	rbd = "rbd"
 
+	// rbdSysfsDevices is the sysfs directory with the attributes of the
+	// krbd devices, by device ID.
+	rbdSysfsDevices = "/sys/bus/rbd/devices"
+
 	// Output strings returned during invocation of "rbd unmap --device-type... <imageSpec>" when
 	// image is not found to be mapped. Used to ignore errors when attempting to unmap such images.
 	// The %s format specifier should contain the <imageSpec> string
@@ -196,6 +202,34 @@ func findDeviceMappingImage(ctx context.Context, pool, namespace, image string,
 	return "", false
 }
 
+// krbdDeviceMapsImage returns whether the krbd device (/dev/rbd<ID>) maps
+// the image, by reading the attributes of the device in the sysfs directory.
+// Kernels without rados namespace support have no pool_ns attribute.
+func krbdDeviceMapsImage(sysfsDir, device, pool, namespace, image string) (bool, error) {
+	id := strings.TrimPrefix(filepath.Base(device), "rbd")
+	if id == "" || id == filepath.Base(device) {
+		return false, fmt.Errorf("%s is not a krbd device", device)
+	}
+	attrs := map[string]string{"pool": pool, "pool_ns": namespace, "name": image}
+	for attr, want := range attrs {
+		data, err := os.ReadFile(filepath.Join(sysfsDir, id, attr))
+		if errors.Is(err, os.ErrNotExist) && attr == "pool_ns" && namespace == "" {
+			continue
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if strings.TrimSpace(string(data)) != want {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
 // Stat a path, if it doesn't exist, retry maxRetries times.
 func waitForPath(ctx context.Context, pool, namespace, image string, maxRetries int, useNbdDriver bool) (string, bool) {
 	for i := 0; i < maxRetries; i++ {
@@ -317,6 +351,9 @@ func getMapOptions(req *csi.NodeStageVolumeRequest, rv *rbdVolume) error {
 }
 
 func attachRBDImage(ctx context.Context, volOptions *rbdVolume, device string, cr *util.Credentials) (string, error) {
+	ctx, span := tracing.StartSpan(ctx, "rbd.attachRBDImage")
+	defer span.End()
+
 	var err error
 
 	image := volOptions.RbdImageName
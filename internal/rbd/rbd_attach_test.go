@@ -17,6 +17,8 @@ limitations under the License.
 package rbd
 
 import (
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -104,3 +106,55 @@ func TestParseMapOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestKrbdDeviceMapsImage(t *testing.T) {
+	t.Parallel()
+	sysfs := t.TempDir()
+	writeDevice := func(id string, attrs map[string]string) {
+		t.Helper()
+		dir := filepath.Join(sysfs, id)
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for attr, value := range attrs {
+			if err := os.WriteFile(filepath.Join(dir, attr), []byte(value+"\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	writeDevice("0", map[string]string{"pool": "replicapool", "pool_ns": "", "name": "csi-vol-1"})
+	writeDevice("1", map[string]string{"pool": "replicapool", "pool_ns": "tenant", "name": "csi-vol-2"})
+	// kernels without rados namespaces
+	writeDevice("2", map[string]string{"pool": "replicapool", "name": "csi-vol-3"})
+
+	tests := []struct {
+		name      string
+		device    string
+		namespace string
+		image     string
+		want      bool
+		wantErr   bool
+	}{
+		{name: "mapped image", device: "/dev/rbd0", image: "csi-vol-1", want: true},
+		{name: "mapped image in namespace", device: "/dev/rbd1", namespace: "tenant", image: "csi-vol-2", want: true},
+		{name: "reused device", device: "/dev/rbd0", image: "csi-vol-2", want: false},
+		{name: "other namespace", device: "/dev/rbd1", image: "csi-vol-2", want: false},
+		{name: "no pool_ns attribute", device: "/dev/rbd2", image: "csi-vol-3", want: true},
+		{name: "no pool_ns attribute with namespace", device: "/dev/rbd2", namespace: "tenant", image: "csi-vol-3"},
+		{name: "unmapped device", device: "/dev/rbd3", image: "csi-vol-1", want: false},
+		{name: "not a krbd device", device: "/dev/nbd0", image: "csi-vol-1", wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := krbdDeviceMapsImage(sysfs, ts.device, "replicapool", ts.namespace, ts.image)
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("krbdDeviceMapsImage() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("krbdDeviceMapsImage() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -20,6 +20,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/journal"
 	"github.com/ceph/ceph-csi/internal/util"
@@ -448,6 +449,8 @@ func updateTopologyConstraints(rbdVol *rbdVolume, rbdSnap *rbdSnapshot) error {
 // reserveVol is a helper routine to request a rbdVolume name reservation and generate the
 // volume ID for the generated name.
 func reserveVol(ctx context.Context, rbdVol *rbdVolume, rbdSnap *rbdSnapshot, cr *util.Credentials) error {
+	defer util.ObserveOperation(ctx, "rbd", rbdVol.ClusterID, util.OpJournalReserve, time.Now())
+
 	var err error
 
 	err = updateTopologyConstraints(rbdVol, rbdSnap)
@@ -501,12 +504,20 @@ func undoSnapReservation(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Cre
 	err = j.UndoReservation(
 		ctx, rbdSnap.JournalPool, rbdSnap.Pool, rbdSnap.RbdSnapName,
 		rbdSnap.RequestName)
+	if err != nil {
+		return err
+	}
+	releaseSnapshotCount(ctx, rbdSnap, cr)
 
-	return err
+	return nil
 }
 
 // undoVolReservation is a helper routine to undo a name reservation for rbdVolume.
 func undoVolReservation(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials) error {
+	if rbdVol.JournalLess {
+		return nil
+	}
+
 	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
 	if err != nil {
 		return err
@@ -30,6 +30,8 @@ import (
 
 	"github.com/ceph/ceph-csi/internal/util"
 	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/reftracker/radoswrapper"
+	"github.com/ceph/ceph-csi/internal/util/tracing"
 
 	"github.com/ceph/go-ceph/rados"
 	librbd "github.com/ceph/go-ceph/rbd"
@@ -171,6 +173,11 @@ type rbdVolume struct {
 	RequestedVolSize   int64
 	DisableInUseChecks bool
 	readOnly           bool
+	// JournalLess is set for volumes that are not reserved in the journal,
+	// their image is found by the UUID of the volume ID.
+	JournalLess bool
+	// StageLock is set when NodeStageVolume locked the image to the node.
+	StageLock bool
 }
 
 // rbdSnapshot represents a CSI snapshot and its RBD snapshot specifics.
@@ -409,6 +416,10 @@ func (rs *rbdSnapshot) String() string {
 
 // createImage creates a new ceph image with provision and volume options.
 func createImage(ctx context.Context, pOpts *rbdVolume, cr *util.Credentials) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.createImage")
+	defer span.End()
+	defer util.ObserveOperation(ctx, "rbd", pOpts.ClusterID, util.OpVolumeCreate, time.Now())
+
 	volSzMiB := fmt.Sprintf("%dM", util.RoundOffVolSize(pOpts.VolSize))
 
 	log.DebugLog(ctx, "rbd: create %s size %s (features: %s) using mon %s",
@@ -614,6 +625,9 @@ func (ri *rbdImage) ensureImageCleanup(ctx context.Context) error {
 
 // deleteImage deletes a ceph image with provision and volume options.
 func (ri *rbdImage) deleteImage(ctx context.Context) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.deleteImage")
+	defer span.End()
+
 	image := ri.RbdImageName
 
 	log.DebugLog(ctx, "rbd: delete %s using mon %s, pool %s", image, ri.Monitors, ri.Pool)
@@ -644,6 +658,11 @@ func (ri *rbdImage) deleteImage(ctx context.Context) error {
 		return err
 	}
 
+	err = removeStageLock(radoswrapper.NewIOContext(ri.ioctx), image)
+	if err != nil {
+		log.WarningLog(ctx, "failed to remove stage lock of rbd image %s: %v", ri, err)
+	}
+
 	return ri.trashRemoveImage(ctx)
 }
 
@@ -1044,12 +1063,15 @@ func updateSnapshotDetails(rbdSnap *rbdSnapshot) error {
 }
 
 // generateVolumeFromVolumeID generates a rbdVolume structure from the provided identifier.
+// A missing image ID is stored in the journal, unless readOnly is set, then
+// nothing is modified in the cluster.
 func generateVolumeFromVolumeID(
 	ctx context.Context,
 	volumeID string,
 	vi util.CSIIdentifier,
 	cr *util.Credentials,
 	secrets map[string]string,
+	readOnly bool,
 ) (*rbdVolume, error) {
 	var (
 		rbdVol *rbdVolume
@@ -1094,6 +1116,19 @@ func generateVolumeFromVolumeID(
 
 	imageAttributes, err := j.GetImageAttributes(
 		ctx, rbdVol.Pool, vi.ObjectUUID, false)
+	if errors.Is(err, util.ErrKeyNotFound) {
+		// only an image that is marked as journal-less is the volume,
+		// without it the volume ID is not found
+		jErr := rbdVol.openJournalLessVolume(vi.ObjectUUID)
+		if jErr == nil {
+			return rbdVol, nil
+		}
+		if !errors.Is(jErr, ErrImageNotFound) && !errors.Is(jErr, librbd.ErrNotFound) {
+			return rbdVol, jErr
+		}
+		log.DebugLog(ctx, "no journal-less image for volume ID %s: %v", volumeID, jErr)
+		rbdVol.RbdImageName = ""
+	}
 	if err != nil {
 		return rbdVol, err
 	}
@@ -1118,7 +1153,7 @@ func generateVolumeFromVolumeID(
 		}
 	}
 
-	if rbdVol.ImageID == "" {
+	if rbdVol.ImageID == "" && !readOnly {
 		err = rbdVol.storeImageID(ctx, j)
 		if err != nil {
 			return rbdVol, err
@@ -1138,6 +1173,19 @@ func GenVolFromVolID(
 	volumeID string,
 	cr *util.Credentials,
 	secrets map[string]string,
+) (*rbdVolume, error) {
+	return genVolFromVolID(ctx, volumeID, cr, secrets, false)
+}
+
+// genVolFromVolID generates a rbdVolume structure like GenVolFromVolID, with
+// readOnly nothing is modified in the cluster, see
+// generateVolumeFromVolumeID().
+func genVolFromVolID(
+	ctx context.Context,
+	volumeID string,
+	cr *util.Credentials,
+	secrets map[string]string,
+	readOnly bool,
 ) (*rbdVolume, error) {
 	var (
 		vi  util.CSIIdentifier
@@ -1150,7 +1198,7 @@ func GenVolFromVolID(
 			ErrInvalidVolID, err, volumeID)
 	}
 
-	vol, err = generateVolumeFromVolumeID(ctx, volumeID, vi, cr, secrets)
+	vol, err = generateVolumeFromVolumeID(ctx, volumeID, vi, cr, secrets, readOnly)
 	if !errors.Is(err, util.ErrKeyNotFound) && !errors.Is(err, util.ErrPoolNotFound) &&
 		!errors.Is(err, ErrImageNotFound) {
 		return vol, err
@@ -1162,7 +1210,7 @@ func GenVolFromVolID(
 		return vol, mErr
 	}
 	if mapping != nil {
-		rbdVol, vErr := generateVolumeFromMapping(ctx, mapping, volumeID, vi, cr, secrets)
+		rbdVol, vErr := generateVolumeFromMapping(ctx, mapping, volumeID, vi, cr, secrets, readOnly)
 		if !errors.Is(vErr, util.ErrKeyNotFound) && !errors.Is(vErr, util.ErrPoolNotFound) &&
 			!errors.Is(vErr, ErrImageNotFound) {
 			return rbdVol, vErr
@@ -1171,6 +1219,87 @@ func GenVolFromVolID(
 	return vol, err
 }
 
+// GenVolFromVolIDWithSecrets generates a rbdVolume structure from the
+// volumeID like GenVolFromVolID, with secrets that can carry the credentials
+// of several clusters (see util.ClusterSecrets). The volume is looked up in
+// the cluster of the volumeID and in the clusters that it is mapped to, with
+// the credentials of each cluster. The credentials of the cluster that the
+// volume is found in are returned, the caller needs to delete them.
+func GenVolFromVolIDWithSecrets(
+	ctx context.Context,
+	volumeID string,
+	secrets map[string]string,
+) (*rbdVolume, *util.Credentials, error) {
+	var vi util.CSIIdentifier
+
+	err := vi.DecomposeCSIID(volumeID)
+	if err != nil {
+		return &rbdVolume{}, nil, fmt.Errorf("%w: error decoding volume ID (%s) (%s)",
+			ErrInvalidVolID, err, volumeID)
+	}
+
+	cr, err := util.NewUserCredentials(util.ClusterSecrets(secrets, vi.ClusterID))
+	if err != nil {
+		return &rbdVolume{}, nil, err
+	}
+	vol, err := generateVolumeFromVolumeID(ctx, volumeID, vi, cr, secrets, false)
+	if !isVolumeNotFound(err) {
+		if err != nil {
+			cr.DeleteCredentials()
+
+			return vol, nil, err
+		}
+
+		return vol, cr, nil
+	}
+	cr.DeleteCredentials()
+
+	mapping, mErr := util.GetClusterMappingInfo(vi.ClusterID)
+	if mErr != nil {
+		return vol, nil, mErr
+	}
+	if mapping == nil {
+		return vol, nil, err
+	}
+	for _, cm := range *mapping {
+		for key, val := range cm.ClusterIDMapping {
+			mappedClusterID := util.GetMappedID(key, val, vi.ClusterID)
+			if mappedClusterID == "" {
+				continue
+			}
+
+			mappedCr, crErr := util.NewUserCredentials(util.ClusterSecrets(secrets, mappedClusterID))
+			if crErr != nil {
+				return vol, nil, crErr
+			}
+			// only look the volume up in the cluster of the credentials
+			clusterMapping := cm
+			clusterMapping.ClusterIDMapping = map[string]string{key: val}
+			rbdVol, vErr := generateVolumeFromMapping(ctx, &[]util.ClusterMappingInfo{clusterMapping},
+				volumeID, vi, mappedCr, secrets, false)
+			if !isVolumeNotFound(vErr) {
+				if vErr != nil {
+					mappedCr.DeleteCredentials()
+
+					return rbdVol, nil, vErr
+				}
+
+				return rbdVol, mappedCr, nil
+			}
+			mappedCr.DeleteCredentials()
+		}
+	}
+
+	return vol, nil, err
+}
+
+// isVolumeNotFound returns whether err is about a volume that does not exist
+// in the cluster, so that it can be looked up in a mapped cluster.
+func isVolumeNotFound(err error) bool {
+	return errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) ||
+		errors.Is(err, ErrImageNotFound)
+}
+
 // generateVolumeFromMapping checks the clusterID and poolID mapping and
 // generates retrieves the OMAP information from the poolID got from the
 // mapping.
@@ -1181,6 +1310,7 @@ func generateVolumeFromMapping(
 	vi util.CSIIdentifier,
 	cr *util.Credentials,
 	secrets map[string]string,
+	readOnly bool,
 ) (*rbdVolume, error) {
 	nvi := vi
 	vol := &rbdVolume{}
@@ -1215,7 +1345,7 @@ func generateVolumeFromMapping(
 					}
 					// Add mapping poolID to Identifier
 					nvi.LocationID = pID
-					vol, err = generateVolumeFromVolumeID(ctx, volumeID, nvi, cr, secrets)
+					vol, err = generateVolumeFromVolumeID(ctx, volumeID, nvi, cr, secrets, readOnly)
 					if !errors.Is(err, util.ErrKeyNotFound) && !errors.Is(err, util.ErrPoolNotFound) &&
 						!errors.Is(err, ErrImageNotFound) {
 						return vol, err
@@ -1418,6 +1548,10 @@ func (rv *rbdVolume) cloneRbdImageFromSnapshot(
 	pSnapOpts *rbdSnapshot,
 	parentVol *rbdVolume,
 ) error {
+	ctx, span := tracing.StartSpan(ctx, "rbd.cloneRbdImageFromSnapshot")
+	defer span.End()
+	defer util.ObserveOperation(ctx, "rbd", rv.ClusterID, util.OpClone, time.Now())
+
 	var err error
 	log.DebugLog(ctx, "rbd: clone %s %s (features: %s) using mon %s",
 		pSnapOpts, rv, rv.ImageFeatureSet.Names(), rv.Monitors)
@@ -1655,9 +1789,11 @@ type rbdImageMetadataStash struct {
 	UnmapOptions   string `json:"unmapOptions"`
 	NbdAccess      bool   `json:"accessType"`
 	Encrypted      bool   `json:"encrypted"`
-	DevicePath     string `json:"device"`          // holds NBD device path for now
+	DevicePath     string `json:"device"`          // holds the mapped device path
 	LogDir         string `json:"logDir"`          // holds the client log path
 	LogStrategy    string `json:"logFileStrategy"` // ceph client log strategy
+	ClusterID      string `json:"clusterID"`
+	StageLock      bool   `json:"stageLock"` // the image is locked to the node
 }
 
 // file name in which image metadata is stashed.
@@ -1683,6 +1819,8 @@ func stashRBDImageMetadata(volOptions *rbdVolume, metaDataPath string) error {
 		ImageName:      volOptions.RbdImageName,
 		Encrypted:      volOptions.isEncrypted(),
 		UnmapOptions:   volOptions.UnmapOptions,
+		ClusterID:      volOptions.ClusterID,
+		StageLock:      volOptions.StageLock,
 	}
 
 	imgMeta.NbdAccess = false
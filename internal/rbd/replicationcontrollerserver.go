@@ -222,13 +222,7 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
-	err = validateSchedulingDetails(ctx, req.GetParameters())
+	err := validateSchedulingDetails(ctx, req.GetParameters())
 	if err != nil {
 		return nil, err
 	}
@@ -240,7 +234,7 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 	}
 	defer rs.VolumeLocks.Release(volumeID)
 
-	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	defer rbdVol.Destroy()
 	if err != nil {
 		switch {
@@ -254,6 +248,8 @@ func (rs *ReplicationServer) EnableVolumeReplication(ctx context.Context,
 
 		return nil, err
 	}
+	defer cr.DeleteCredentials()
+
 	// extract the mirroring mode
 	mirroringMode, err := getMirroringMode(ctx, req.GetParameters())
 	if err != nil {
@@ -405,12 +401,6 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
 	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
@@ -418,7 +408,7 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 	}
 	defer rs.VolumeLocks.Release(volumeID)
 
-	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	defer rbdVol.Destroy()
 	if err != nil {
 		switch {
@@ -432,6 +422,8 @@ func (rs *ReplicationServer) DisableVolumeReplication(ctx context.Context,
 
 		return nil, err
 	}
+	defer cr.DeleteCredentials()
+
 	// extract the force option
 	force, err := getForceOption(ctx, req.GetParameters())
 	if err != nil {
@@ -518,12 +510,6 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
 	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
@@ -531,7 +517,7 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 	}
 	defer rs.VolumeLocks.Release(volumeID)
 
-	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	defer rbdVol.Destroy()
 	if err != nil {
 		switch {
@@ -545,6 +531,7 @@ func (rs *ReplicationServer) PromoteVolume(ctx context.Context,
 
 		return nil, err
 	}
+	defer cr.DeleteCredentials()
 
 	mirroringInfo, err := rbdVol.getImageMirroringInfo()
 	if err != nil {
@@ -626,12 +613,6 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
 	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
@@ -639,7 +620,7 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 	}
 	defer rs.VolumeLocks.Release(volumeID)
 
-	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	defer rbdVol.Destroy()
 	if err != nil {
 		switch {
@@ -653,6 +634,7 @@ func (rs *ReplicationServer) DemoteVolume(ctx context.Context,
 
 		return nil, err
 	}
+	defer cr.DeleteCredentials()
 	mirroringInfo, err := rbdVol.getImageMirroringInfo()
 	if err != nil {
 		log.ErrorLog(ctx, err.Error())
@@ -718,19 +700,13 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 	if volumeID == "" {
 		return nil, status.Error(codes.InvalidArgument, "empty volume ID in request")
 	}
-	cr, err := util.NewUserCredentials(req.GetSecrets())
-	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
-	}
-	defer cr.DeleteCredentials()
-
 	if acquired := rs.VolumeLocks.TryAcquire(volumeID); !acquired {
 		log.ErrorLog(ctx, util.VolumeOperationAlreadyExistsFmt, volumeID)
 
 		return nil, status.Errorf(codes.Aborted, util.VolumeOperationAlreadyExistsFmt, volumeID)
 	}
 	defer rs.VolumeLocks.Release(volumeID)
-	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, req.GetSecrets())
+	rbdVol, cr, err := GenVolFromVolIDWithSecrets(ctx, volumeID, req.GetSecrets())
 	defer rbdVol.Destroy()
 	if err != nil {
 		switch {
@@ -744,6 +720,7 @@ func (rs *ReplicationServer) ResyncVolume(ctx context.Context,
 
 		return nil, err
 	}
+	defer cr.DeleteCredentials()
 
 	mirroringInfo, err := rbdVol.getImageMirroringInfo()
 	if err != nil {
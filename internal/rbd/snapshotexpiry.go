@@ -0,0 +1,74 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// GetSnapshotExpiry returns the time at which the snapshot with the ID
+// expires, as stored in the metadata of its image when the snapshot was
+// created. False is returned when no expiry is stored, or when the snapshot
+// does not exist anymore. The secrets are those to delete the snapshot with.
+func GetSnapshotExpiry(ctx context.Context, snapshotID string, secrets map[string]string) (time.Time, bool, error) {
+	cr, err := util.NewUserCredentials(secrets)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer cr.DeleteCredentials()
+
+	rbdSnap := &rbdSnapshot{}
+	err = genSnapFromSnapID(ctx, rbdSnap, snapshotID, cr, secrets)
+	if errors.Is(err, util.ErrPoolNotFound) || errors.Is(err, util.ErrKeyNotFound) ||
+		errors.Is(err, ErrImageNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer rbdSnap.Destroy()
+
+	vol := generateVolFromSnap(rbdSnap)
+	err = vol.Connect(cr)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer vol.Destroy()
+
+	value, err := vol.GetMetadata(k8s.SnapshotExpiryMetadataKey)
+	if errors.Is(err, librbd.ErrNotFound) || errors.Is(err, ErrImageNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("failed to get the expiry of snapshot %s: %w", rbdSnap, err)
+	}
+
+	expiry, err := k8s.ParseSnapshotExpiry(value)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return expiry, true, nil
+}
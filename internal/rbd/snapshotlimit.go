@@ -0,0 +1,133 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// scanSnapshots returns the number of snapshots of the image that are
+// reserved in the snapshot journal of the pool of rbdSnap. The snapshots of an
+// image are clones that do not need to be children of it anymore, so they are
+// counted by the source image name in the journal. The journal is scanned once
+// per image, to initialize the number of snapshots that is counted in the
+// journal after that.
+func scanSnapshots(ctx context.Context, j *journal.Connection, rbdSnap *rbdSnapshot, imageName string,
+	cr *util.Credentials,
+) (int64, error) {
+	reservations, _, err := j.ListReservations(ctx, rbdSnap.JournalPool, "", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+	for _, rsv := range reservations {
+		pool := rbdSnap.JournalPool
+		if rsv.ImagePoolID != util.InvalidPoolID {
+			pool, err = util.GetPoolName(rbdSnap.Monitors, cr, rsv.ImagePoolID)
+			if errors.Is(err, util.ErrPoolNotFound) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		attrs, err := j.GetImageAttributes(ctx, pool, rsv.ImageUUID, true)
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			// the reservation is being created or deleted
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if attrs.SourceName == imageName {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// reserveSnapshotCount adds the new snapshot rbdSnap to the number of
+// snapshots of the image, and returns util.ErrSnapshotLimitExceeded when the
+// image has the maximum number of snapshots of the parameters already. The
+// snapshots of an image are counted from the first snapshot that is created
+// with a limit, until then nothing is stored. undoSnapReservation subtracts
+// the snapshot again.
+func (cs *ControllerServer) reserveSnapshotCount(
+	ctx context.Context,
+	rbdVol *rbdVolume,
+	rbdSnap *rbdSnapshot,
+	parameters map[string]string,
+	cr *util.Credentials,
+) error {
+	limit, err := util.GetMaxSnapshotsPerVolume(parameters, cs.MaxSnapshotsPerVolume)
+	if err != nil {
+		return err
+	}
+
+	j, err := snapJournal.Connect(rbdSnap.Monitors, rbdSnap.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	source := rbdVol.RbdImageName
+
+	return j.UpdateSnapshotCount(ctx, rbdSnap.Pool, source, func(count int64, counted bool) (int64, bool, error) {
+		if !counted {
+			if limit == 0 {
+				return 0, false, nil
+			}
+			var err error
+			count, err = scanSnapshots(ctx, j, rbdSnap, source, cr)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+		if limit != 0 {
+			log.DebugLog(ctx, "image %s has %d snapshots, the limit is %d", rbdVol, count, limit)
+			err := util.CheckSnapshotLimit(rbdSnap.SourceVolumeID, int(count), limit)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		return count + 1, true, nil
+	})
+}
+
+// releaseSnapshotCount subtracts the snapshot rbdSnap from the number of
+// snapshots of its source image. Failures are logged, as the snapshot is gone
+// already.
+func releaseSnapshotCount(ctx context.Context, rbdSnap *rbdSnapshot, cr *util.Credentials) {
+	j, err := snapJournal.Connect(rbdSnap.Monitors, rbdSnap.RadosNamespace, cr)
+	if err == nil {
+		defer j.Destroy()
+		err = j.AddSnapshotCount(ctx, rbdSnap.Pool, rbdSnap.RbdImageName, -1)
+	}
+	if err != nil {
+		log.WarningLog(ctx, "failed to release snapshot %s of image %s: %v", rbdSnap.RequestName,
+			rbdSnap.RbdImageName, err)
+	}
+}
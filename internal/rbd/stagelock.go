@@ -0,0 +1,270 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+	"github.com/ceph/ceph-csi/internal/util/reftracker/radoswrapper"
+
+	"github.com/ceph/go-ceph/rados"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+const (
+	// stageLockKey is the parameter of the StorageClass that makes
+	// NodeStageVolume lock ReadWriteOncePod volumes to the node that stages
+	// them, until they are unstaged.
+	stageLockKey = "stageLock"
+
+	// stageLockObjectPrefix is the prefix of the RADOS objects, next to the
+	// image, that contain the ID of the node that holds the lock of the image.
+	stageLockObjectPrefix = "csi.stagelock."
+
+	// maxNodeIDLength is the length of the buffer that the ID of the node is
+	// read in, the names of Kubernetes nodes are at most 253 characters.
+	maxNodeIDLength = 256
+
+	// stageLockTakeoverAge is the time that the lock of another node needs
+	// to be unchanged, before it can be taken over when the image is not
+	// mapped anymore. It is longer than NodeStageVolume takes to map the
+	// image after acquiring the lock.
+	stageLockTakeoverAge = 5 * time.Minute
+)
+
+var (
+	// ErrStageLocked is returned when the image is locked by another node.
+	ErrStageLocked = errors.New("volume is staged on another node")
+
+	// errNoStageLockCredentials is returned for volumes with stageLock of
+	// clusters without credentials directory, their lock can not be
+	// released on NodeUnstageVolume.
+	errNoStageLockCredentials = errors.New("stageLock needs the credentialsDir of the cluster in the CSI config file")
+)
+
+// needsStageLock returns whether the volume needs to be locked to the node
+// that stages it, which is the case for ReadWriteOncePod volumes of
+// StorageClasses with stageLock enabled.
+func needsStageLock(ctx context.Context, volCtx map[string]string, volCap *csi.VolumeCapability) bool {
+	return volCap.GetAccessMode().GetMode() == csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER &&
+		parseBoolOption(ctx, volCtx, stageLockKey, false)
+}
+
+// stageLockObject returns the name of the object with the lock of the image.
+func stageLockObject(imageName string) string {
+	return stageLockObjectPrefix + imageName
+}
+
+// checkStageLockCredentials returns an error when the cluster has no
+// credentials directory to release the locks of its volumes with.
+func checkStageLockCredentials(clusterID string) error {
+	dir, err := util.GetCredentialsDir(util.CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+	if dir == "" {
+		return fmt.Errorf("%w: cluster %s has none", errNoStageLockCredentials, clusterID)
+	}
+
+	return nil
+}
+
+// acquireStageLock locks the image to the node by creating its lock object
+// exclusively. Acquiring the lock again on the node that holds it succeeds.
+// The lock of another node is taken over when abandoned returns true for it,
+// otherwise ErrStageLocked is returned.
+func acquireStageLock(
+	ioctx radoswrapper.IOContextW,
+	imageName, nodeID string,
+	abandoned func(owner string) (bool, error),
+) error {
+	oid := stageLockObject(imageName)
+	w := ioctx.CreateWriteOp()
+	defer w.Release()
+	w.Create(rados.CreateExclusive)
+	w.WriteFull([]byte(nodeID))
+	err := w.Operate(oid)
+	if !errors.Is(err, rados.ErrObjectExists) {
+		return err
+	}
+
+	owner, ver, err := readStageLock(ioctx, oid)
+	if err != nil {
+		return err
+	}
+	if owner == nodeID {
+		return nil
+	}
+	takeover, err := abandoned(owner)
+	if err != nil {
+		return err
+	}
+	if !takeover {
+		return fmt.Errorf("%w: image %s is locked by node %s", ErrStageLocked, imageName, owner)
+	}
+
+	// the version is asserted, so that only one node takes over the lock
+	w = ioctx.CreateWriteOp()
+	defer w.Release()
+	w.AssertVersion(ver)
+	w.WriteFull([]byte(nodeID))
+	err = w.Operate(oid)
+	if err != nil {
+		return fmt.Errorf("%w: failed to take over the lock of image %s from node %s: %v",
+			ErrStageLocked, imageName, owner, err)
+	}
+
+	return nil
+}
+
+// readStageLock returns the ID of the node in the lock object, and the
+// version of the object.
+func readStageLock(ioctx radoswrapper.IOContextW, oid string) (string, uint64, error) {
+	r := ioctx.CreateReadOp()
+	defer r.Release()
+	buf := make([]byte, maxNodeIDLength)
+	step := r.Read(0, buf)
+	err := r.Operate(oid)
+	if err != nil {
+		return "", 0, err
+	}
+	ver, err := ioctx.GetLastVersion()
+	if err != nil {
+		return "", 0, err
+	}
+
+	return string(buf[:step.BytesRead]), ver, nil
+}
+
+// releaseStageLock removes the lock object of the image, if the node holds
+// the lock. The version of the object is asserted, so that a lock that
+// another node acquired in the meantime is not removed.
+func releaseStageLock(ioctx radoswrapper.IOContextW, imageName, nodeID string) error {
+	oid := stageLockObject(imageName)
+	owner, ver, err := readStageLock(ioctx, oid)
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if owner != nodeID {
+		return nil
+	}
+
+	w := ioctx.CreateWriteOp()
+	defer w.Release()
+	w.AssertVersion(ver)
+	w.Remove()
+	err = w.Operate(oid)
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// removeStageLock removes the lock object of the image, regardless of the
+// node that holds it, when the image is deleted.
+func removeStageLock(ioctx radoswrapper.IOContextW, imageName string) error {
+	w := ioctx.CreateWriteOp()
+	defer w.Release()
+	w.Remove()
+	err := w.Operate(stageLockObject(imageName))
+	if errors.Is(err, rados.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// acquireStageLock locks the image to the node. The lock of another node is
+// taken over when it was not changed for stageLockTakeoverAge, and the image
+// has no watchers, i.e. it is not mapped on the other node anymore, like when
+// the node died and its watch timed out.
+func (ri *rbdImage) acquireStageLock(ctx context.Context, nodeID string) error {
+	err := ri.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	abandoned := func(owner string) (bool, error) {
+		stat, err := ri.ioctx.Stat(stageLockObject(ri.RbdImageName))
+		if err != nil {
+			return false, err
+		}
+		if time.Since(stat.ModTime) < stageLockTakeoverAge {
+			return false, nil
+		}
+		inUse, err := ri.isInUse()
+		if err != nil || inUse {
+			return false, err
+		}
+		log.WarningLog(ctx, "rbd: taking over lock of %s from node %s, the image is not mapped and the lock"+
+			" is unchanged since %v", ri, owner, stat.ModTime)
+
+		return true, nil
+	}
+
+	return acquireStageLock(radoswrapper.NewIOContext(ri.ioctx), ri.RbdImageName, nodeID, abandoned)
+}
+
+// releaseStageLock releases the lock of the image, if the node holds it.
+func (ri *rbdImage) releaseStageLock(nodeID string) error {
+	err := ri.openIoctx()
+	if err != nil {
+		return err
+	}
+
+	return releaseStageLock(radoswrapper.NewIOContext(ri.ioctx), ri.RbdImageName, nodeID)
+}
+
+// releaseStashedStageLock releases the lock of the image in the stash on
+// NodeUnstageVolume. The request does not contain secrets, the credentials
+// directory of the cluster in the CSI config file is used.
+func releaseStashedStageLock(ctx context.Context, imgInfo *rbdImageMetadataStash, nodeID string) error {
+	cr, err := util.NewCredentialsFromFiles(util.CsiConfigFile, imgInfo.ClusterID)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	ri := &rbdImage{
+		ClusterID:      imgInfo.ClusterID,
+		Pool:           imgInfo.Pool,
+		RadosNamespace: imgInfo.RadosNamespace,
+		RbdImageName:   imgInfo.ImageName,
+	}
+	ri.Monitors, err = util.Mons(util.CsiConfigFile, imgInfo.ClusterID)
+	if err != nil {
+		return err
+	}
+	err = ri.Connect(cr)
+	if err != nil {
+		return err
+	}
+	defer ri.Destroy()
+
+	log.DebugLog(ctx, "rbd: releasing lock of %s held by node %s", imgInfo, nodeID)
+
+	return ri.releaseStageLock(nodeID)
+}
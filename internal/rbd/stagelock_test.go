@@ -0,0 +1,172 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ceph/ceph-csi/internal/util/reftracker/radoswrapper"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// notAbandoned never takes over the lock of another node.
+func notAbandoned(string) (bool, error) {
+	return false, nil
+}
+
+func TestStageLock(t *testing.T) {
+	t.Parallel()
+	ioctx := radoswrapper.NewFakeIOContext(radoswrapper.NewFakeRados())
+
+	err := acquireStageLock(ioctx, "csi-vol-1", "node-1", notAbandoned)
+	if err != nil {
+		t.Fatalf("acquireStageLock() failed: %v", err)
+	}
+	// staging on the same node again succeeds
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-1", notAbandoned)
+	if err != nil {
+		t.Errorf("acquireStageLock() on the same node failed: %v", err)
+	}
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-10", notAbandoned)
+	if !errors.Is(err, ErrStageLocked) {
+		t.Errorf("acquireStageLock() on another node = %v, want %v", err, ErrStageLocked)
+	}
+	// other images are not locked
+	err = acquireStageLock(ioctx, "csi-vol-2", "node-10", notAbandoned)
+	if err != nil {
+		t.Errorf("acquireStageLock() of other image failed: %v", err)
+	}
+
+	// another node can not release the lock
+	err = releaseStageLock(ioctx, "csi-vol-1", "node-10")
+	if err != nil {
+		t.Errorf("releaseStageLock() on another node failed: %v", err)
+	}
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-10", notAbandoned)
+	if !errors.Is(err, ErrStageLocked) {
+		t.Errorf("acquireStageLock() after release by other node = %v, want %v", err, ErrStageLocked)
+	}
+
+	err = releaseStageLock(ioctx, "csi-vol-1", "node-1")
+	if err != nil {
+		t.Errorf("releaseStageLock() failed: %v", err)
+	}
+	// releasing again succeeds
+	err = releaseStageLock(ioctx, "csi-vol-1", "node-1")
+	if err != nil {
+		t.Errorf("releaseStageLock() of released lock failed: %v", err)
+	}
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-10", notAbandoned)
+	if err != nil {
+		t.Errorf("acquireStageLock() after release failed: %v", err)
+	}
+
+	err = removeStageLock(ioctx, "csi-vol-1")
+	if err != nil {
+		t.Errorf("removeStageLock() failed: %v", err)
+	}
+	err = removeStageLock(ioctx, "csi-vol-1")
+	if err != nil {
+		t.Errorf("removeStageLock() of removed lock failed: %v", err)
+	}
+}
+
+func TestStageLockTakeover(t *testing.T) {
+	t.Parallel()
+	ioctx := radoswrapper.NewFakeIOContext(radoswrapper.NewFakeRados())
+
+	err := acquireStageLock(ioctx, "csi-vol-1", "node-1", notAbandoned)
+	if err != nil {
+		t.Fatalf("acquireStageLock() failed: %v", err)
+	}
+	abandonedBy := ""
+	abandoned := func(owner string) (bool, error) {
+		abandonedBy = owner
+
+		return true, nil
+	}
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-2", abandoned)
+	if err != nil {
+		t.Fatalf("acquireStageLock() of abandoned lock failed: %v", err)
+	}
+	if abandonedBy != "node-1" {
+		t.Errorf("abandoned() called for %q, want node-1", abandonedBy)
+	}
+	// the lock belongs to node-2 now
+	err = acquireStageLock(ioctx, "csi-vol-1", "node-1", notAbandoned)
+	if !errors.Is(err, ErrStageLocked) {
+		t.Errorf("acquireStageLock() after takeover = %v, want %v", err, ErrStageLocked)
+	}
+	err = releaseStageLock(ioctx, "csi-vol-1", "node-2")
+	if err != nil {
+		t.Errorf("releaseStageLock() of taken over lock failed: %v", err)
+	}
+
+	errCheck := errors.New("check failed")
+	err = acquireStageLock(ioctx, "csi-vol-2", "node-1", notAbandoned)
+	if err != nil {
+		t.Fatalf("acquireStageLock() failed: %v", err)
+	}
+	err = acquireStageLock(ioctx, "csi-vol-2", "node-2", func(string) (bool, error) { return false, errCheck })
+	if !errors.Is(err, errCheck) {
+		t.Errorf("acquireStageLock() with failing check = %v, want %v", err, errCheck)
+	}
+}
+
+func TestNeedsStageLock(t *testing.T) {
+	t.Parallel()
+	volCap := func(mode csi.VolumeCapability_AccessMode_Mode) *csi.VolumeCapability {
+		return &csi.VolumeCapability{AccessMode: &csi.VolumeCapability_AccessMode{Mode: mode}}
+	}
+	tests := []struct {
+		name   string
+		volCtx map[string]string
+		volCap *csi.VolumeCapability
+		want   bool
+	}{
+		{
+			name:   "ReadWriteOncePod with stageLock",
+			volCtx: map[string]string{stageLockKey: "true"},
+			volCap: volCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER),
+			want:   true,
+		},
+		{
+			name:   "ReadWriteOncePod without stageLock",
+			volCtx: map[string]string{},
+			volCap: volCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_SINGLE_WRITER),
+			want:   false,
+		},
+		{
+			name:   "ReadWriteOnce with stageLock",
+			volCtx: map[string]string{stageLockKey: "true"},
+			volCap: volCap(csi.VolumeCapability_AccessMode_SINGLE_NODE_WRITER),
+			want:   false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := needsStageLock(context.TODO(), ts.volCtx, ts.volCap); got != ts.want {
+				t.Errorf("needsStageLock() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ceph/ceph-csi/internal/journal"
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// reclaimPolicyKey is the key of the reclaim policy of the last PV of the
+// volume in the metadata of the image, it is set by the stale volume reaper.
+const reclaimPolicyKey = "csi.ceph.com/reclaim-policy"
+
+var (
+	// ErrOtherCluster is returned by DeleteStaleVolume for volumes without
+	// the name of the Kubernetes cluster in their metadata.
+	ErrOtherCluster = errors.New("volume does not belong to the cluster")
+	// ErrNotReclaimable is returned by DeleteStaleVolume for volumes whose
+	// last PV did not have the Delete reclaim policy.
+	ErrNotReclaimable = errors.New("volume does not have the Delete reclaim policy")
+)
+
+// JournalVolume is a volume with a reservation in the journal of a pool and
+// an image that exists.
+type JournalVolume struct {
+	VolumeID    string
+	RequestName string
+	ClusterID   string
+	Pool        string
+	ImageName   string
+	// Owner is the namespace of the PVC, when the csi-provisioner passes it
+	Owner string
+	// ClusterName is the name of the Kubernetes cluster that is stored in
+	// the metadata of the image with --setmetadata
+	ClusterName string
+	// ReclaimPolicy is the reclaim policy of the last PV of the volume that
+	// SetReclaimPolicy stored in the metadata of the image
+	ReclaimPolicy string
+}
+
+// ListJournalVolumes returns the volumes that are reserved in the journals of
+// the pools of the clusters, and the journal-less volumes of the pools, using
+// the credentials directories of the clusters. Volumes that are being created
+// or deleted are not listed, journals need to be initialized with
+// InitJournals.
+func ListJournalVolumes(ctx context.Context, clusterIDs []string) ([]JournalVolume, error) {
+	l, err := newJournalLister(ctx, volJournal, clusterIDs, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer l.destroy()
+
+	volumes, _, err := journal.ListPages(
+		l.locations,
+		"",
+		0,
+		l.listVolumes(ctx),
+		func(loc journal.ListLocation, rsv journal.Reservation) (JournalVolume, bool, error) {
+			return l.journalVolume(ctx, loc, rsv)
+		})
+
+	return volumes, err
+}
+
+// journalVolume returns the JournalVolume of the reservation, false is
+// returned for volumes that are being created or deleted.
+func (l *journalLister) journalVolume(
+	ctx context.Context,
+	loc journal.ListLocation,
+	rsv journal.Reservation,
+) (JournalVolume, bool, error) {
+	pool, attrs, ok, err := l.reservedAttributes(ctx, loc, rsv, false)
+	if err != nil || !ok {
+		return JournalVolume{}, false, err
+	}
+	ri, ok, err := l.listedImage(ctx, loc.ClusterID, pool, attrs.ImageName)
+	if err != nil || !ok {
+		return JournalVolume{}, false, err
+	}
+	defer ri.Destroy()
+	volID, err := l.reservedID(ctx, loc.ClusterID, rsv.ImagePoolID, pool, rsv.ImageUUID)
+	if err != nil {
+		return JournalVolume{}, false, err
+	}
+	clusterName, err := ri.GetMetadata(clusterNameKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return JournalVolume{}, false, fmt.Errorf("failed to get cluster name of %s: %w", ri, err)
+	}
+	reclaimPolicy, err := ri.GetMetadata(reclaimPolicyKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return JournalVolume{}, false, fmt.Errorf("failed to get reclaim policy of %s: %w", ri, err)
+	}
+
+	return JournalVolume{
+		VolumeID:      volID,
+		RequestName:   rsv.RequestName,
+		ClusterID:     loc.ClusterID,
+		Pool:          pool,
+		ImageName:     attrs.ImageName,
+		Owner:         attrs.Owner,
+		ClusterName:   clusterName,
+		ReclaimPolicy: reclaimPolicy,
+	}, true, nil
+}
+
+// SetReclaimPolicy stores the reclaim policy of the PV of the volume in the
+// metadata of its image, using the credentials directory of the cluster.
+// DeleteStaleVolume only deletes volumes whose last PV had the Delete reclaim
+// policy. A volume that does not exist anymore is not an error.
+func SetReclaimPolicy(ctx context.Context, volumeID string, policy corev1.PersistentVolumeReclaimPolicy) error {
+	rbdVol, cr, err := openStaleVolume(ctx, volumeID)
+	if rbdVol == nil || err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+	defer rbdVol.Destroy()
+
+	return rbdVol.SetMetadata(reclaimPolicyKey, string(policy))
+}
+
+// DeleteStaleVolume deletes the image of the volume and its reservation in
+// the journal like DeleteVolume, using the credentials directory of the
+// cluster. Only images with the name of the Kubernetes cluster in their
+// metadata are deleted, ErrOtherCluster is returned for other images. Images
+// whose last PV did not have the Delete reclaim policy are not deleted,
+// ErrNotReclaimable is returned for them. Images that are still in use are
+// not deleted, a volume that does not exist anymore is not an error. Journals
+// need to be initialized with InitJournals.
+func DeleteStaleVolume(ctx context.Context, volumeID, clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("%w: no cluster name to compare volume %s with", ErrOtherCluster, volumeID)
+	}
+	rbdVol, cr, err := openStaleVolume(ctx, volumeID)
+	if rbdVol == nil || err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+	defer rbdVol.Destroy()
+
+	// the metadata is checked again, it may have changed since the volume
+	// was listed
+	owner, err := rbdVol.GetMetadata(clusterNameKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to get cluster name of %s: %w", rbdVol, err)
+	}
+	if owner != clusterName {
+		return fmt.Errorf("%w: volume %s has cluster name %q, not %q", ErrOtherCluster, volumeID, owner, clusterName)
+	}
+	policy, err := rbdVol.GetMetadata(reclaimPolicyKey)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return fmt.Errorf("failed to get reclaim policy of %s: %w", rbdVol, err)
+	}
+	if policy != string(corev1.PersistentVolumeReclaimDelete) {
+		return fmt.Errorf("%w: volume %s has reclaim policy %q", ErrNotReclaimable, volumeID, policy)
+	}
+	_, err = cleanupRBDImage(ctx, rbdVol, cr)
+
+	return err
+}
+
+// openStaleVolume returns the volume with the credentials of its cluster,
+// the volume is nil when it does not exist anymore.
+func openStaleVolume(ctx context.Context, volumeID string) (*rbdVolume, *util.Credentials, error) {
+	var vi util.CSIIdentifier
+	err := vi.DecomposeCSIID(volumeID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: error decoding volume ID (%s) (%s)", ErrInvalidVolID, err, volumeID)
+	}
+	cr, err := listCredentials(vi.ClusterID, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rbdVol, err := GenVolFromVolID(ctx, volumeID, cr, nil)
+	if errors.Is(err, ErrImageNotFound) || errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+		log.DebugLog(ctx, "stale volume %s does not exist anymore: %v", volumeID, err)
+		rbdVol.Destroy()
+		cr.DeleteCredentials()
+
+		return nil, nil, nil
+	}
+	if err != nil {
+		rbdVol.Destroy()
+		cr.DeleteCredentials()
+
+		return nil, nil, err
+	}
+
+	return rbdVol, cr, nil
+}
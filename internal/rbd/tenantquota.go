@@ -0,0 +1,291 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/ceph/go-ceph/rados"
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+// scanTenantUsage returns the total size of the images of the owner of rbdVol
+// in its pool. The owner of an image is stored in the volume journal, only
+// the images that are reserved in the journal pool of rbdVol are counted, in
+// addition to the journal-less images of the owner. The images are scanned
+// once per tenant and pool, to initialize the usage that is counted in the
+// journal after that.
+func scanTenantUsage(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials) (int64, error) {
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
+	if err != nil {
+		return 0, err
+	}
+	defer j.Destroy()
+
+	reservations, _, err := j.ListReservations(ctx, rbdVol.JournalPool, "", 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var used int64
+	for _, rsv := range reservations {
+		pool := rbdVol.JournalPool
+		if rsv.ImagePoolID != util.InvalidPoolID {
+			pool, err = util.GetPoolName(rbdVol.Monitors, cr, rsv.ImagePoolID)
+			if errors.Is(err, util.ErrPoolNotFound) {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+		}
+		if pool != rbdVol.Pool {
+			continue
+		}
+
+		attrs, err := j.GetImageAttributes(ctx, pool, rsv.ImageUUID, false)
+		if errors.Is(err, util.ErrKeyNotFound) || errors.Is(err, util.ErrPoolNotFound) {
+			// the reservation is being created or deleted
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		if attrs.Owner != rbdVol.Owner {
+			continue
+		}
+
+		size, err := imageSize(rbdVol, pool, attrs.ImageName)
+		if errors.Is(err, ErrImageNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		used += size
+	}
+
+	journalLess, err := journalLessTenantUsage(rbdVol)
+	if err != nil {
+		return 0, err
+	}
+
+	return used + journalLess, nil
+}
+
+// journalLessTenantUsage returns the total size of the journal-less images of
+// the owner of rbdVol in its pool.
+func journalLessTenantUsage(rbdVol *rbdVolume) (int64, error) {
+	err := rbdVol.openIoctx()
+	if err != nil {
+		return 0, err
+	}
+
+	names, err := librbd.GetImageNames(rbdVol.ioctx)
+	if err != nil && !errors.Is(err, librbd.ErrNotFound) {
+		return 0, err
+	}
+
+	var used int64
+	for _, name := range names {
+		if !strings.HasPrefix(name, journalLessImagePrefix) {
+			continue
+		}
+		size, err := journalLessImageUsage(rbdVol.ioctx, name, rbdVol.Owner)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get the usage of image %s/%s: %w", rbdVol.Pool, name, err)
+		}
+		used += size
+	}
+
+	return used, nil
+}
+
+// journalLessImageUsage returns the size of the image if it is a
+// journal-less image of the owner, and 0 otherwise.
+func journalLessImageUsage(ioctx *rados.IOContext, name, owner string) (int64, error) {
+	image, err := librbd.OpenImageReadOnly(ioctx, name, librbd.NoSnapshot)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer image.Close()
+
+	_, err = image.GetMetadata(journalLessMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	imageOwner, err := image.GetMetadata(journalLessOwnerMetaKey)
+	if errors.Is(err, librbd.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	if imageOwner != owner {
+		return 0, nil
+	}
+
+	size, err := image.GetSize()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(size), nil
+}
+
+// imageSize returns the size of the image in the pool, in the cluster and
+// rados namespace of rbdVol.
+func imageSize(rbdVol *rbdVolume, pool, imageName string) (int64, error) {
+	ri := &rbdImage{
+		Monitors:       rbdVol.Monitors,
+		Pool:           pool,
+		RadosNamespace: rbdVol.RadosNamespace,
+		RbdImageName:   imageName,
+		conn:           rbdVol.conn.Copy(),
+	}
+	defer ri.Destroy()
+
+	image, err := ri.open()
+	if err != nil {
+		return 0, err
+	}
+	defer image.Close()
+
+	size, err := image.GetSize()
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(size), nil
+}
+
+// tenantQuota returns the quota of the owner of rbdVol in its pool, and
+// whether the usage of the owner needs to be looked up. Volumes without an
+// owner are not limited.
+func tenantQuota(rbdVol *rbdVolume) (int64, bool, error) {
+	if rbdVol.Owner == "" {
+		return 0, false, nil
+	}
+
+	quota, err := util.GetTenantQuota(util.CsiConfigFile, rbdVol.ClusterID, rbdVol.Owner, rbdVol.Pool)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return quota, true, nil
+}
+
+// checkTenantQuota returns util.ErrTenantQuotaExceeded when the new image of
+// rbdVol does not fit in the quota of its owner in the pool. The usage of the
+// owner is not modified, reserveTenantQuota needs to be called to create the
+// image.
+func checkTenantQuota(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials) error {
+	quota, ok, err := tenantQuota(rbdVol)
+	if err != nil || !ok || quota == 0 {
+		return err
+	}
+
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	used, counted, err := j.GetTenantUsage(ctx, rbdVol.Pool, rbdVol.Owner)
+	if err != nil {
+		return err
+	}
+	if !counted {
+		used, err = scanTenantUsage(ctx, rbdVol, cr)
+		if err != nil {
+			return err
+		}
+	}
+	log.DebugLog(ctx, "tenant %s uses %d of %d bytes in pool %s", rbdVol.Owner, used, quota, rbdVol.Pool)
+
+	return util.CheckTenantQuota(rbdVol.Owner, rbdVol.Pool, used, rbdVol.VolSize, quota)
+}
+
+// reserveTenantQuota adds size bytes to the usage of the owner of rbdVol in
+// its pool, and returns util.ErrTenantQuotaExceeded when they do not fit in
+// the quota of the owner. The usage of an owner is counted from the first
+// reservation while the owner has a quota, until then nothing is stored.
+func reserveTenantQuota(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials, size int64) error {
+	quota, ok, err := tenantQuota(rbdVol)
+	if err != nil || !ok {
+		return err
+	}
+
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
+	if err != nil {
+		return err
+	}
+	defer j.Destroy()
+
+	return j.UpdateTenantUsage(ctx, rbdVol.Pool, rbdVol.Owner, func(used int64, counted bool) (int64, bool, error) {
+		if !counted {
+			if quota == 0 {
+				return 0, false, nil
+			}
+			var err error
+			used, err = scanTenantUsage(ctx, rbdVol, cr)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+		if quota != 0 {
+			log.DebugLog(ctx, "tenant %s uses %d of %d bytes in pool %s", rbdVol.Owner, used, quota, rbdVol.Pool)
+			err := util.CheckTenantQuota(rbdVol.Owner, rbdVol.Pool, used, size, quota)
+			if err != nil {
+				return 0, false, err
+			}
+		}
+
+		return used + size, true, nil
+	})
+}
+
+// releaseTenantQuota subtracts size bytes from the usage of the owner of
+// rbdVol in its pool, after its image was deleted or failed to be created or
+// resized. Failures are logged, as the image is gone already.
+func releaseTenantQuota(ctx context.Context, rbdVol *rbdVolume, cr *util.Credentials, size int64) {
+	if rbdVol.Owner == "" {
+		return
+	}
+
+	j, err := volJournal.Connect(rbdVol.Monitors, rbdVol.RadosNamespace, cr)
+	if err == nil {
+		defer j.Destroy()
+		err = j.AddTenantUsage(ctx, rbdVol.Pool, rbdVol.Owner, -size)
+	}
+	if err != nil {
+		log.WarningLog(ctx, "failed to release %d bytes of tenant %s in pool %s: %v",
+			size, rbdVol.Owner, rbdVol.Pool, err)
+	}
+}
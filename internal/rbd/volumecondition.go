@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"fmt"
+	"strings"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// healthyCondition is the condition of a volume without problems.
+var healthyCondition = &csi.VolumeCondition{
+	Abnormal: false,
+	Message:  "volume is healthy",
+}
+
+// missingImageCondition returns the condition of a volume whose image was
+// deleted, while the volume is still reserved in the journal.
+func missingImageCondition(ri *rbdImage) *csi.VolumeCondition {
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message:  fmt.Sprintf("image %s does not exist", ri),
+	}
+}
+
+// volumeCondition returns the condition of the volume with the image in the
+// pool, from the bytes that can still be stored in the pool, and the local
+// mirroring status of the image, which is nil when the image is not
+// mirrored. A full pool, and a split-brain of the mirrored image are
+// abnormal.
+func volumeCondition(
+	pool string,
+	available int64,
+	mirrorStatus *librbd.SiteMirrorImageStatus,
+) *csi.VolumeCondition {
+	problems := []string{}
+	if available <= 0 {
+		problems = append(problems, fmt.Sprintf("pool %s is full", pool))
+	}
+	if mirrorStatus != nil && resyncRequired(*mirrorStatus) {
+		problems = append(problems, fmt.Sprintf("mirroring of the image is in state %q and needs a resync: %s",
+			mirrorStatus.State, mirrorStatus.Description))
+	}
+	if len(problems) == 0 {
+		return healthyCondition
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: true,
+		Message:  strings.Join(problems, ", "),
+	}
+}
+
+// getLocalMirroringStatus returns the local mirroring status of the image,
+// nil is returned when mirroring is not enabled for the image.
+func (ri *rbdImage) getLocalMirroringStatus() (*librbd.SiteMirrorImageStatus, error) {
+	info, err := ri.getImageMirroringInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.State != librbd.MirrorImageEnabled {
+		return nil, nil
+	}
+	localStatus, err := ri.getLocalState()
+	if err != nil {
+		return nil, err
+	}
+
+	return &localStatus, nil
+}
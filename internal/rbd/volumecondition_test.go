@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"testing"
+
+	librbd "github.com/ceph/go-ceph/rbd"
+)
+
+func TestVolumeCondition(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name         string
+		available    int64
+		mirrorStatus *librbd.SiteMirrorImageStatus
+		abnormal     bool
+		message      string
+	}{
+		{
+			name:      "healthy",
+			available: 1024,
+			abnormal:  false,
+			message:   "volume is healthy",
+		},
+		{
+			name:      "pool full",
+			available: 0,
+			abnormal:  true,
+			message:   "pool rbd is full",
+		},
+		{
+			name:      "replaying",
+			available: 1024,
+			mirrorStatus: &librbd.SiteMirrorImageStatus{
+				State:       librbd.MirrorImageStatusStateReplaying,
+				Description: "replaying",
+				Up:          true,
+			},
+			abnormal: false,
+			message:  "volume is healthy",
+		},
+		{
+			name:      "split-brain",
+			available: 1024,
+			mirrorStatus: &librbd.SiteMirrorImageStatus{
+				State:       librbd.MirrorImageStatusStateStoppingReplay,
+				Description: "split-brain",
+				Up:          true,
+			},
+			abnormal: true,
+			message:  `mirroring of the image is in state "stopping_replay" and needs a resync: split-brain`,
+		},
+		{
+			name:      "pool full and mirroring error",
+			available: 0,
+			mirrorStatus: &librbd.SiteMirrorImageStatus{
+				State:       librbd.MirrorImageStatusStateError,
+				Description: "failed to bootstrap",
+				Up:          true,
+			},
+			abnormal: true,
+			message: `pool rbd is full, ` +
+				`mirroring of the image is in state "error" and needs a resync: failed to bootstrap`,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := volumeCondition("rbd", ts.available, ts.mirrorStatus)
+			if got.GetAbnormal() != ts.abnormal || got.GetMessage() != ts.message {
+				t.Errorf("volumeCondition() = %v, %q, want %v, %q",
+					got.GetAbnormal(), got.GetMessage(), ts.abnormal, ts.message)
+			}
+		})
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ceph/ceph-csi/internal/util"
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// krbdSingleMajorDevices is the number of devices that krbd can map with
+	// the single_major parameter of the rbd module, each device uses 16 of
+	// the 20 bits of minor numbers.
+	krbdSingleMajorDevices = 1 << (20 - 4)
+	// dynamicBlockMajors is the number of block device majors that the kernel
+	// can allocate dynamically, without single_major each krbd device uses
+	// one of them.
+	dynamicBlockMajors = 254
+
+	rbdSingleMajorParam = "/sys/module/rbd/parameters/single_major"
+	nbdsMaxParam        = "/sys/module/nbd/parameters/nbds_max"
+	procDevices         = "/proc/devices"
+)
+
+// kernelNbdNetlinkSupport are the kernels with the netlink interface of nbd,
+// which rbd-nbd uses to create devices on demand, so that nbds_max is not a
+// limit.
+var kernelNbdNetlinkSupport = []util.KernelVersion{
+	{
+		Version:      4,
+		PatchLevel:   12,
+		SubLevel:     0,
+		ExtraVersion: 0,
+		Distribution: "",
+		Backport:     false,
+	}, // standard 4.12+ versions
+}
+
+// NodeVolumeLimit returns the number of volumes that can be mapped on the
+// node, which is the smallest of the configured limit and the limits of krbd
+// and rbd-nbd that are detected on the node. The mounter of the volumes is not
+// known in advance, so the smallest limit is used. 0 is returned if there is
+// no limit.
+func NodeVolumeLimit(configured int64) int64 {
+	return minVolumeLimit(configured, krbdDeviceLimit(), nbdDeviceLimit())
+}
+
+// minVolumeLimit returns the smallest of the limits that is set, a limit of 0
+// or less is not set.
+func minVolumeLimit(limits ...int64) int64 {
+	var limit int64
+	for _, l := range limits {
+		if l > 0 && (limit == 0 || l < limit) {
+			limit = l
+		}
+	}
+
+	return limit
+}
+
+// krbdDeviceLimit returns the number of devices that krbd can map, or 0 when
+// the rbd module is not loaded.
+func krbdDeviceLimit() int64 {
+	singleMajor, err := os.ReadFile(rbdSingleMajorParam)
+	if err != nil {
+		log.DebugLogMsg("failed to read %s, not limiting krbd devices: %v", rbdSingleMajorParam, err)
+
+		return 0
+	}
+	if strings.TrimSpace(string(singleMajor)) == "Y" {
+		return krbdSingleMajorDevices
+	}
+
+	devices, err := os.Open(procDevices)
+	if err != nil {
+		log.WarningLogMsg("failed to open %s, not limiting krbd devices: %v", procDevices, err)
+
+		return 0
+	}
+	defer devices.Close()
+
+	return freeBlockMajors(devices)
+}
+
+// freeBlockMajors returns the number of dynamic block device majors that are
+// not used by other drivers than rbd, in the /proc/devices format. The majors
+// of the devices that krbd already mapped are free for the volumes.
+func freeBlockMajors(devices io.Reader) int64 {
+	used := int64(0)
+	block := false
+	scanner := bufio.NewScanner(devices)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "Block devices:" {
+			block = true
+
+			continue
+		}
+		fields := strings.Fields(line)
+		if !block || len(fields) != 2 || strings.HasPrefix(fields[1], "rbd") {
+			continue
+		}
+		major, err := strconv.Atoi(fields[0])
+		if err == nil && major > 0 && major <= dynamicBlockMajors {
+			used++
+		}
+	}
+	if used >= dynamicBlockMajors {
+		return 0
+	}
+
+	return dynamicBlockMajors - used
+}
+
+// nbdDeviceLimit returns the number of nbd devices when rbd-nbd can not
+// create devices on demand, or 0 when there is no limit. SetRbdNbdToolFeatures
+// needs to be called first.
+func nbdDeviceLimit() int64 {
+	if !hasNBD {
+		return 0
+	}
+	release, err := util.GetKernelVersion()
+	if err != nil {
+		log.WarningLogMsg("failed to get kernel version, not limiting nbd devices: %v", err)
+
+		return 0
+	}
+	if util.CheckKernelSupport(release, kernelNbdNetlinkSupport) {
+		return 0
+	}
+
+	nbdsMax, err := os.ReadFile(nbdsMaxParam)
+	if err != nil {
+		log.WarningLogMsg("failed to read %s, not limiting nbd devices: %v", nbdsMaxParam, err)
+
+		return 0
+	}
+	limit, err := strconv.ParseInt(strings.TrimSpace(string(nbdsMax)), 10, 64)
+	if err != nil {
+		log.WarningLogMsg("failed to parse %s %q: %v", nbdsMaxParam, string(nbdsMax), err)
+
+		return 0
+	}
+
+	return limit
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package rbd
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMinVolumeLimit(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		limits []int64
+		want   int64
+	}{
+		{"no limits", nil, 0},
+		{"unset limits", []int64{0, 0, -1}, 0},
+		{"configured limit", []int64{100, 0, 0}, 100},
+		{"detected limit below configured", []int64{100, 65536, 16}, 16},
+		{"configured limit below detected", []int64{10, 65536, 16}, 10},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := minVolumeLimit(ts.limits...); got != ts.want {
+				t.Errorf("minVolumeLimit(%v) = %d, want %d", ts.limits, got, ts.want)
+			}
+		})
+	}
+}
+
+func TestFreeBlockMajors(t *testing.T) {
+	t.Parallel()
+	devices := `Character devices:
+  1 mem
+  4 tty
+254 gpiochip
+
+Block devices:
+  7 loop
+  8 sd
+  9 md
+252 rbd0
+253 device-mapper
+254 virtblk
+259 blkext
+`
+	// loop, sd, md, device-mapper and virtblk occupy majors that can not be
+	// allocated anymore, the character devices, rbd0 and blkext (above 254)
+	// do not count
+	if got := freeBlockMajors(strings.NewReader(devices)); got != dynamicBlockMajors-5 {
+		t.Errorf("freeBlockMajors() = %d, want %d", got, dynamicBlockMajors-5)
+	}
+	if got := freeBlockMajors(strings.NewReader("")); got != dynamicBlockMajors {
+		t.Errorf("freeBlockMajors() of no devices = %d, want %d", got, dynamicBlockMajors)
+	}
+}
@@ -0,0 +1,205 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// AdminCommand is a command that operators can run on the admin socket, see
+// StartAdminServer.
+type AdminCommand struct {
+	// Usage describes the command and its parameters
+	Usage string
+	// ReadOnly commands can be run with GET requests as well
+	ReadOnly bool
+	// Run runs the command with the query or form parameters of the
+	// request, and returns its output. Errors with a gRPC status are
+	// returned with the matching HTTP status.
+	Run func(ctx context.Context, params url.Values) (string, error)
+}
+
+// adminCommands are the commands that have been registered with
+// RegisterAdminCommand.
+var adminCommands = struct {
+	sync.RWMutex
+	commands map[string]AdminCommand
+}{
+	commands: make(map[string]AdminCommand),
+}
+
+// RegisterAdminCommand makes the command available as /<name> on the admin
+// socket. Registering a name again replaces the command.
+func RegisterAdminCommand(name string, cmd AdminCommand) {
+	adminCommands.Lock()
+	defer adminCommands.Unlock()
+
+	adminCommands.commands[name] = cmd
+}
+
+// StartAdminServer starts a HTTP server on the unix domain socket at
+// socketPath, that runs the registered admin commands. Only the user that
+// runs the process can connect to the socket. The commands are listed on
+// GET /, and run with POST requests. For example:
+//
+//	curl --unix-socket <socketPath> http://localhost/
+//	curl --unix-socket <socketPath> -X POST 'http://localhost/flatten?volume-id=<volume-id>'
+func StartAdminServer(socketPath string) {
+	listener, err := listenLocal("unix://" + socketPath)
+	if err != nil {
+		log.FatalLogMsg("failed to listen on socket %q: %v", socketPath, err)
+	}
+
+	log.DefaultLog("serving admin commands on %s", socketPath)
+	// #nosec:G114, the socket is only accessible locally.
+	err = http.Serve(listener, adminHandler())
+	if err != nil {
+		log.FatalLogMsg("failed to serve admin commands on %q: %v", socketPath, err)
+	}
+}
+
+// adminHandler returns the usage of the registered commands for /, and runs
+// the command of the path otherwise.
+func adminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.Trim(r.URL.Path, "/")
+		if name == "" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+				return
+			}
+			writeAdminUsage(w)
+
+			return
+		}
+
+		adminCommands.RLock()
+		cmd, ok := adminCommands.commands[name]
+		adminCommands.RUnlock()
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown command %q", name), http.StatusNotFound)
+
+			return
+		}
+		switch r.Method {
+		case http.MethodPost, http.MethodPut:
+		case http.MethodGet:
+			if !cmd.ReadOnly {
+				http.Error(w, fmt.Sprintf("command %q needs a POST request", name), http.StatusMethodNotAllowed)
+
+				return
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if !cmd.ReadOnly {
+			log.DefaultLog("running admin command %s %s", name, r.Form.Encode())
+		}
+		out, err := cmd.Run(r.Context(), r.Form)
+		if err != nil {
+			log.ErrorLogMsg("admin command %s failed: %v", name, err)
+			http.Error(w, err.Error(), adminErrorStatus(err))
+
+			return
+		}
+		fmt.Fprint(w, out)
+	})
+}
+
+// writeAdminUsage writes the names and usage of the registered commands,
+// sorted by name.
+func writeAdminUsage(w http.ResponseWriter) {
+	adminCommands.RLock()
+	defer adminCommands.RUnlock()
+
+	names := make([]string, 0, len(adminCommands.commands))
+	for name := range adminCommands.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "%s: %s\n", name, adminCommands.commands[name].Usage)
+	}
+}
+
+// adminErrorStatus returns the HTTP status for the gRPC status of the error
+// of a command.
+func adminErrorStatus(err error) int {
+	switch status.Code(err) {
+	case codes.InvalidArgument, codes.FailedPrecondition:
+		return http.StatusBadRequest
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.Aborted:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CachePurger is a cache of which the "invalidate-cache" command drops all
+// entries.
+type CachePurger interface {
+	// Purge removes all entries, and returns the number of removed entries.
+	Purge() int
+}
+
+// NewInvalidateCacheCommand returns the "invalidate-cache" command, which
+// closes the unused connections to the Ceph clusters and drops the cached
+// CreateVolume responses and NodeGetVolumeStats results, so that changed
+// monitors, credentials or volumes are picked up by the next requests. The
+// caches may be nil when the driver does not run the controller or node
+// server. GetCapacity results and the CSI config file are not cached.
+func NewInvalidateCacheCommand(responses, stats CachePurger) AdminCommand {
+	return AdminCommand{
+		Usage: "close the unused connections to the Ceph clusters and drop the cached CreateVolume responses " +
+			"and NodeGetVolumeStats results",
+		Run: func(ctx context.Context, _ url.Values) (string, error) {
+			conns, inUse := connPool.closeUnused()
+			purged := func(cache CachePurger) int {
+				if cache == nil {
+					return 0
+				}
+
+				return cache.Purge()
+			}
+
+			return fmt.Sprintf("closed %d unused connections (%d in use), dropped %d cached responses and %d cached "+
+				"volume stats\n", conns, inUse, purged(responses), purged(stats)), nil
+		},
+	}
+}
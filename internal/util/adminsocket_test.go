@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdminHandler(t *testing.T) {
+	t.Parallel()
+
+	RegisterAdminCommand("test-echo", AdminCommand{
+		Usage: "echo the volume-id parameter",
+		Run: func(_ context.Context, params url.Values) (string, error) {
+			if params.Get("volume-id") == "" {
+				return "", status.Error(codes.InvalidArgument, "missing volume-id parameter")
+			}
+
+			return "volume " + params.Get("volume-id") + "\n", nil
+		},
+	})
+	RegisterAdminCommand("test-status", AdminCommand{
+		Usage:    "report the status",
+		ReadOnly: true,
+		Run: func(_ context.Context, _ url.Values) (string, error) {
+			return "ok\n", nil
+		},
+	})
+	handler := adminHandler()
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		code     int
+		contains string
+	}{
+		{
+			name:     "list commands",
+			method:   http.MethodGet,
+			target:   "/",
+			code:     http.StatusOK,
+			contains: "test-echo: echo the volume-id parameter",
+		},
+		{
+			name:     "run command",
+			method:   http.MethodPost,
+			target:   "/test-echo?volume-id=vol-1",
+			code:     http.StatusOK,
+			contains: "volume vol-1",
+		},
+		{
+			name:     "invalid parameters",
+			method:   http.MethodPost,
+			target:   "/test-echo",
+			code:     http.StatusBadRequest,
+			contains: "missing volume-id parameter",
+		},
+		{
+			name:   "GET of command",
+			method: http.MethodGet,
+			target: "/test-echo?volume-id=vol-1",
+			code:   http.StatusMethodNotAllowed,
+		},
+		{
+			name:     "GET of read-only command",
+			method:   http.MethodGet,
+			target:   "/test-status",
+			code:     http.StatusOK,
+			contains: "ok",
+		},
+		{
+			name:   "unknown command",
+			method: http.MethodPost,
+			target: "/test-unknown",
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "unsupported method",
+			method: http.MethodDelete,
+			target: "/test-status",
+			code:   http.StatusMethodNotAllowed,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(ts.method, ts.target, nil))
+			if rec.Code != ts.code {
+				t.Errorf("status code = %d, want %d (%s)", rec.Code, ts.code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), ts.contains) {
+				t.Errorf("body %q does not contain %q", rec.Body.String(), ts.contains)
+			}
+		})
+	}
+}
+
+func TestAdminErrorStatus(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{status.Error(codes.InvalidArgument, "invalid"), http.StatusBadRequest},
+		{status.Error(codes.FailedPrecondition, "not mirrored"), http.StatusBadRequest},
+		{status.Error(codes.NotFound, "not found"), http.StatusNotFound},
+		{status.Error(codes.Aborted, "locked"), http.StatusConflict},
+		{status.Error(codes.Internal, "failed"), http.StatusInternalServerError},
+		{context.Canceled, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := adminErrorStatus(tt.err); got != tt.want {
+			t.Errorf("adminErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+
+	ca "github.com/ceph/go-ceph/cephfs/admin"
+)
+
+// GetPoolAvailableBytes returns the number of bytes that can still be stored
+// in the pool. This is the "max_avail" of the pool in "ceph df", which takes
+// the replication or erasure coding of the pool into account, limited by the
+// quota of the pool. A GetCapacity request does not contain secrets, the
+// credentials are read from the credentials directory of the cluster in the
+// CSI config file. ErrNoCredentials is returned if no credentials directory
+// is configured.
+func GetPoolAvailableBytes(clusterID, pool string) (int64, error) {
+	cc, err := connectWithCredentialsDir(clusterID)
+	if err != nil {
+		return 0, err
+	}
+	defer cc.Destroy()
+
+	return cc.PoolAvailableBytes(pool)
+}
+
+// GetPoolsAvailableBytes returns the number of bytes that can still be stored
+// in each pool of the cluster, like GetPoolAvailableBytes, with a single
+// "ceph df" for all pools.
+func GetPoolsAvailableBytes(clusterID string) (map[string]int64, error) {
+	cc, err := connectWithCredentialsDir(clusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer cc.Destroy()
+
+	df, err := cc.dfDetail()
+	if err != nil {
+		return nil, err
+	}
+
+	return df.poolsAvailableBytes(), nil
+}
+
+// GetFilesystemAvailableBytes returns the number of bytes that can still be
+// stored in the data pool of the CephFS filesystem, like
+// GetPoolAvailableBytes. When no pool is passed, the default data pool of the
+// filesystem is used, which is the pool for subvolumes without a pool
+// layout.
+func GetFilesystemAvailableBytes(clusterID, fsName, pool string) (int64, error) {
+	cc, err := connectWithCredentialsDir(clusterID)
+	if err != nil {
+		return 0, err
+	}
+	defer cc.Destroy()
+
+	return cc.FilesystemAvailableBytes(fsName, pool)
+}
+
+// connectWithCredentialsDir connects to the cluster with the credentials in
+// the credentials directory of the cluster in the CSI config file.
+func connectWithCredentialsDir(clusterID string) (*ClusterConnection, error) {
+	cr, err := NewCredentialsFromFiles(CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, err := Mons(CsiConfigFile, clusterID)
+	if err != nil {
+		return nil, err
+	}
+
+	cc := &ClusterConnection{}
+	err = cc.Connect(monitors, cr)
+	if err != nil {
+		return nil, err
+	}
+
+	return cc, nil
+}
+
+// PoolAvailableBytes returns the bytes that can still be stored in the pool,
+// as reported by "ceph df detail".
+func (cc *ClusterConnection) PoolAvailableBytes(pool string) (int64, error) {
+	df, err := cc.dfDetail()
+	if err != nil {
+		return 0, err
+	}
+
+	return df.poolAvailableBytes(pool)
+}
+
+// FilesystemAvailableBytes returns the bytes that can still be stored in the
+// pool of the filesystem, or its default data pool when no pool is passed.
+func (cc *ClusterConnection) FilesystemAvailableBytes(fsName, pool string) (int64, error) {
+	var err error
+	if pool == "" {
+		pool, err = cc.defaultDataPool(fsName)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return cc.PoolAvailableBytes(pool)
+}
+
+// dfDetail returns the report of "ceph df detail", which includes the quotas
+// of the pools.
+func (cc *ClusterConnection) dfDetail() (*cephDFReport, error) {
+	df := &cephDFReport{}
+	err := cc.monCommandJSON("df", map[string]string{"detail": "detail"}, df)
+	if err != nil {
+		return nil, err
+	}
+
+	return df, nil
+}
+
+// defaultDataPool returns the first data pool of the filesystem.
+func (cc *ClusterConnection) defaultDataPool(fsName string) (string, error) {
+	fsa, err := cc.GetFSAdmin()
+	if err != nil {
+		return "", err
+	}
+	fsPoolInfos, err := fsa.ListFileSystems()
+	if err != nil {
+		return "", fmt.Errorf("failed to list filesystems: %w", err)
+	}
+
+	return findDefaultDataPool(fsPoolInfos, fsName)
+}
+
+// findDefaultDataPool returns the first data pool of the filesystem in the
+// list.
+func findDefaultDataPool(fsPoolInfos []ca.FSPoolInfo, fsName string) (string, error) {
+	for i := range fsPoolInfos {
+		if fsPoolInfos[i].Name != fsName {
+			continue
+		}
+		if len(fsPoolInfos[i].DataPools) == 0 {
+			return "", fmt.Errorf("%w: filesystem %s has no data pool", ErrPoolNotFound, fsName)
+		}
+
+		return fsPoolInfos[i].DataPools[0], nil
+	}
+
+	return "", fmt.Errorf("%w: could not find data pool for filesystem %s", ErrPoolNotFound, fsName)
+}
+
+// poolAvailableBytes returns the "max_avail" of the pool in the report, or
+// the bytes that are left of the quota of the pool when that is less.
+func (df *cephDFReport) poolAvailableBytes(pool string) (int64, error) {
+	available, ok := df.poolsAvailableBytes()[pool]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", ErrPoolNotFound, pool)
+	}
+
+	return available, nil
+}
+
+// poolsAvailableBytes returns the available bytes of each pool in the
+// report, see poolAvailableBytes.
+func (df *cephDFReport) poolsAvailableBytes() map[string]int64 {
+	pools := make(map[string]int64, len(df.Pools))
+	for i := range df.Pools {
+		stats := df.Pools[i].Stats
+		available := stats.MaxAvail
+		if stats.QuotaBytes > 0 {
+			left := stats.QuotaBytes - stats.Stored
+			if left < 0 {
+				left = 0
+			}
+			if left < available {
+				available = left
+			}
+		}
+		pools[df.Pools[i].Name] = available
+	}
+
+	return pools
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	ca "github.com/ceph/go-ceph/cephfs/admin"
+)
+
+func TestPoolAvailableBytes(t *testing.T) {
+	t.Parallel()
+
+	df := cephDFReport{}
+	err := json.Unmarshal([]byte(`{"pools":[
+		{"name":"rbd","stats":{"percent_used":0.25,"max_avail":1073741824}},
+		{"name":"quota","stats":{"max_avail":1073741824,"stored":104857600,"quota_bytes":209715200}},
+		{"name":"large-quota","stats":{"max_avail":1073741824,"stored":104857600,"quota_bytes":10737418240}},
+		{"name":"over-quota","stats":{"max_avail":1073741824,"stored":314572800,"quota_bytes":209715200}}
+	]}`), &df)
+	if err != nil {
+		t.Fatalf("failed to parse df report: %v", err)
+	}
+
+	tests := []struct {
+		pool string
+		want int64
+	}{
+		{"rbd", 1073741824},
+		{"quota", 104857600},
+		{"large-quota", 1073741824},
+		{"over-quota", 0},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.pool, func(t *testing.T) {
+			t.Parallel()
+			avail, err := df.poolAvailableBytes(ts.pool)
+			if err != nil {
+				t.Errorf("poolAvailableBytes() failed: %v", err)
+			}
+			if avail != ts.want {
+				t.Errorf("poolAvailableBytes() = %d, want %d", avail, ts.want)
+			}
+		})
+	}
+
+	_, err = df.poolAvailableBytes("missing")
+	if !errors.Is(err, ErrPoolNotFound) {
+		t.Errorf("poolAvailableBytes() of missing pool returned %v, want ErrPoolNotFound", err)
+	}
+}
+
+func TestFindDefaultDataPool(t *testing.T) {
+	t.Parallel()
+
+	fsPoolInfos := []ca.FSPoolInfo{
+		{Name: "myfs", DataPools: []string{"myfs-replicated", "myfs-ec"}},
+		{Name: "empty"},
+	}
+
+	pool, err := findDefaultDataPool(fsPoolInfos, "myfs")
+	if err != nil {
+		t.Errorf("findDefaultDataPool() failed: %v", err)
+	}
+	if pool != "myfs-replicated" {
+		t.Errorf("findDefaultDataPool() = %q, want %q", pool, "myfs-replicated")
+	}
+
+	for _, fsName := range []string{"empty", "missing"} {
+		_, err = findDefaultDataPool(fsPoolInfos, fsName)
+		if !errors.Is(err, ErrPoolNotFound) {
+			t.Errorf("findDefaultDataPool() of %s returned %v, want ErrPoolNotFound", fsName, err)
+		}
+	}
+}
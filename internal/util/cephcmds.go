@@ -54,21 +54,23 @@ func ExecuteCommandWithNSEnter(ctx context.Context, netPath, program string, arg
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
+	start := time.Now()
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
 	stderr := stderrBuf.String()
+	logCtx, duration := observeCommand(ctx, program, start, err)
 
 	if err != nil {
 		err = fmt.Errorf("an error (%w) occurred while running %s args: %v", err, nsenter, sanitizedArgs)
 		if ctx != context.TODO() {
-			log.UsefulLog(ctx, "%s", err)
+			log.UsefulLog(logCtx, "%s (took %s)", err, duration)
 		}
 
 		return stdout, stderr, err
 	}
 
 	if ctx != context.TODO() {
-		log.UsefulLog(ctx, "command succeeded: %s %v", nsenter, sanitizedArgs)
+		log.UsefulLog(logCtx, "command succeeded: %s %v (took %s)", nsenter, sanitizedArgs, duration)
 	}
 
 	return stdout, stderr, nil
@@ -88,21 +90,23 @@ func ExecCommand(ctx context.Context, program string, args ...string) (string, s
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
+	start := time.Now()
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
 	stderr := stderrBuf.String()
+	logCtx, duration := observeCommand(ctx, program, start, err)
 
 	if err != nil {
 		err = fmt.Errorf("an error (%w) occurred while running %s args: %v", err, program, sanitizedArgs)
 		if ctx != context.TODO() {
-			log.UsefulLog(ctx, "%s", err)
+			log.UsefulLog(logCtx, "%s (took %s)", err, duration)
 		}
 
 		return stdout, stderr, err
 	}
 
 	if ctx != context.TODO() {
-		log.UsefulLog(ctx, "command succeeded: %s %v", program, sanitizedArgs)
+		log.UsefulLog(logCtx, "command succeeded: %s %v (took %s)", program, sanitizedArgs, duration)
 	}
 
 	return stdout, stderr, nil
@@ -134,14 +138,16 @@ func ExecCommandWithTimeout(
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
 
+	start := time.Now()
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
 	stderr := stderrBuf.String()
+	// if its a timeout log return context deadline exceeded error message
+	if err != nil && errors.Is(cctx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("timeout: %w", cctx.Err())
+	}
+	logCtx, duration := observeCommand(ctx, program, start, err)
 	if err != nil {
-		// if its a timeout log return context deadline exceeded error message
-		if errors.Is(cctx.Err(), context.DeadlineExceeded) {
-			err = fmt.Errorf("timeout: %w", cctx.Err())
-		}
 		err = fmt.Errorf("an error (%w) and stderror (%s) occurred while running %s args: %v",
 			err,
 			stderr,
@@ -149,14 +155,14 @@ func ExecCommandWithTimeout(
 			sanitizedArgs)
 
 		if ctx != context.TODO() {
-			log.ErrorLog(ctx, "%s", err)
+			log.ErrorLog(logCtx, "%s (took %s)", err, duration)
 		}
 
 		return stdout, stderr, err
 	}
 
 	if ctx != context.TODO() {
-		log.UsefulLog(ctx, "command succeeded: %s %v", program, sanitizedArgs)
+		log.UsefulLog(logCtx, "command succeeded: %s %v (took %s)", program, sanitizedArgs, duration)
 	}
 
 	return stdout, stderr, nil
@@ -202,6 +208,22 @@ func GetPoolName(monitors string, cr *Credentials, poolID int64) (string, error)
 	return name, nil
 }
 
+// ListPools returns the names of the pools in the cluster.
+func ListPools(monitors string, cr *Credentials) ([]string, error) {
+	conn, err := connPool.Get(monitors, cr.ID, cr.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer connPool.Put(conn)
+
+	pools, err := conn.ListPools()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools: %w", err)
+	}
+
+	return pools, nil
+}
+
 // GetPoolIDs searches a list of pools in a cluster and returns the IDs of the pools that matches
 // the passed in pools
 // TODO this should take in a list and return a map[string(poolname)]int64(poolID).
@@ -19,8 +19,11 @@ package util
 import (
 	"context"
 	"errors"
+	"path/filepath"
 	"testing"
 	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestExecCommandWithTimeout(t *testing.T) {
@@ -87,3 +90,36 @@ func TestExecCommandWithTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestExecCommandMetrics(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		program  string
+		args     []string
+		exitCode string
+	}{
+		{"true", nil, "0"},
+		{"false", nil, "1"},
+		{"/does/not/exist", nil, "error"},
+	}
+	for _, tt := range tests {
+		before := testutil.ToFloat64(commandsTotal.WithLabelValues(filepath.Base(tt.program), tt.exitCode))
+		_, _, err := ExecCommand(context.TODO(), tt.program, tt.args...)
+		if (err != nil) != (tt.exitCode != "0") {
+			t.Errorf("ExecCommand(%q) error = %v", tt.program, err)
+		}
+		after := testutil.ToFloat64(commandsTotal.WithLabelValues(filepath.Base(tt.program), tt.exitCode))
+		if after != before+1 {
+			t.Errorf("commands_total of %q with exit code %s = %v, want %v", tt.program, tt.exitCode, after, before+1)
+		}
+	}
+
+	_, _, err := ExecCommandWithTimeout(context.TODO(), 10*time.Millisecond, "sleep", "1")
+	if err == nil {
+		t.Fatal("ExecCommandWithTimeout() did not time out")
+	}
+	if v := testutil.ToFloat64(commandsTotal.WithLabelValues("sleep", "timeout")); v < 1 {
+		t.Errorf("commands_total of sleep with exit code timeout = %v, want >= 1", v)
+	}
+}
@@ -0,0 +1,320 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/k8s"
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/client-go/kubernetes"
+)
+
+// capacityHealthChecks are the Ceph health checks about the fullness of the
+// OSDs and pools, these are exported even when they are not raised so that
+// alerts can be set on them.
+var capacityHealthChecks = []string{
+	"OSD_NEARFULL", "OSD_BACKFILLFULL", "OSD_FULL", "POOL_NEARFULL", "POOL_FULL",
+}
+
+// cephHealthStatus maps the overall health of a Ceph cluster to the value
+// of the csi_ceph_health_status gauge.
+var cephHealthStatus = map[string]float64{
+	"HEALTH_OK":   0,
+	"HEALTH_WARN": 1,
+	"HEALTH_ERR":  2,
+}
+
+var (
+	cephHealth = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Subsystem: "ceph",
+			Name:      "health_status",
+			Help:      "Health of the Ceph cluster (0 = HEALTH_OK, 1 = HEALTH_WARN, 2 = HEALTH_ERR)",
+		},
+		[]string{"cluster_id"},
+	)
+	cephHealthCheck = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Subsystem: "ceph",
+			Name:      "health_check",
+			Help:      "Set to 1 when the capacity related health check is raised on the Ceph cluster",
+		},
+		[]string{"cluster_id", "check"},
+	)
+	cephPoolUsedRatio = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Subsystem: "ceph",
+			Name:      "pool_used_ratio",
+			Help:      "Fraction of the available capacity of the Ceph pool that is used",
+		},
+		[]string{"cluster_id", "pool"},
+	)
+)
+
+// cephHealthReport contains the parts of the "health" mon command output that
+// are used.
+type cephHealthReport struct {
+	Status string                     `json:"status"`
+	Checks map[string]json.RawMessage `json:"checks"`
+}
+
+// cephDFReport contains the parts of the "df" mon command output that are
+// used.
+type cephDFReport struct {
+	Pools []struct {
+		Name  string `json:"name"`
+		Stats struct {
+			PercentUsed float64 `json:"percent_used"`
+			MaxAvail    int64   `json:"max_avail"`
+			Stored      int64   `json:"stored"`
+			// QuotaBytes is only reported by "df detail", 0 means no quota
+			QuotaBytes int64 `json:"quota_bytes"`
+		} `json:"stats"`
+	} `json:"pools"`
+}
+
+// monCommandJSON sends the mon command with the prefix and the optional
+// arguments, and stores the JSON formatted output in v.
+func (cc *ClusterConnection) monCommandJSON(prefix string, args map[string]string, v interface{}) error {
+	if cc.conn == nil {
+		return errors.New("cluster is not connected yet")
+	}
+
+	fields := map[string]string{"prefix": prefix, "format": "json"}
+	for key, value := range args {
+		fields[key] = value
+	}
+	cmd, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s command: %w", prefix, err)
+	}
+	buf, _, err := cc.conn.MonCommand(cmd)
+	if err != nil {
+		return fmt.Errorf("mon command %s failed: %w", prefix, err)
+	}
+	err = json.Unmarshal(buf, v)
+	if err != nil {
+		return fmt.Errorf("failed to parse output of mon command %s %q: %w", prefix, string(buf), err)
+	}
+
+	return nil
+}
+
+// cephHealthCollector exports the health of the Ceph clusters in the CSI
+// config file.
+type cephHealthCollector struct {
+	// driverName is the provisioner of the StorageClasses of which the pools
+	// are exported
+	driverName string
+	// client lists the StorageClasses, it is nil when the driver does not
+	// run in Kubernetes
+	client kubernetes.Interface
+	// pools contains the pools per cluster ID that were exported on the
+	// previous run, so that the metrics of deleted pools can be removed
+	pools map[string]map[string]bool
+}
+
+// StartCephHealthCollector exports the overall health, the capacity related
+// health checks and the usage of the pools of each Ceph cluster in the CSI
+// config file that has a credentials directory configured, every interval.
+// Only the pools that the StorageClasses of the driver or the tenant quotas
+// in the CSI config file refer to are exported, other pools of the cluster are
+// not used by the driver. The pooled connections of the driver are used, so
+// that no additional connections to the monitors are made. This function does
+// not return.
+func StartCephHealthCollector(interval time.Duration, driverName string) {
+	prometheus.MustRegister(cephHealth, cephHealthCheck, cephPoolUsedRatio)
+
+	hc := &cephHealthCollector{
+		driverName: driverName,
+		pools:      make(map[string]map[string]bool),
+	}
+	client, err := k8s.NewK8sClient()
+	if err != nil {
+		log.WarningLogMsg("only exporting the usage of pools in the CSI config file, StorageClasses can not "+
+			"be listed: %v", err)
+	} else {
+		hc.client = client
+	}
+	for {
+		clusterIDs, err := GetClusterIDs(CsiConfigFile)
+		if err != nil {
+			log.ErrorLogMsg("failed to get clusters for collecting the Ceph health: %v", err)
+		}
+		refs := hc.storageClassPools()
+		for _, clusterID := range clusterIDs {
+			err = hc.collect(clusterID, refs[clusterID])
+			if errors.Is(err, ErrNoCredentials) {
+				log.TraceLogMsg("skipping Ceph health of cluster %q: %v", clusterID, err)
+
+				continue
+			}
+			if err != nil {
+				log.ErrorLogMsg("failed to collect Ceph health of cluster %q: %v", clusterID, err)
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// storageClassPools returns the pools per cluster ID that the StorageClasses
+// of the driver refer to.
+func (hc *cephHealthCollector) storageClassPools() map[string][]k8s.PoolReference {
+	clusterRefs := make(map[string][]k8s.PoolReference)
+	if hc.client == nil {
+		return clusterRefs
+	}
+
+	refs, err := k8s.ListStorageClassPools(context.TODO(), hc.client, hc.driverName)
+	if err != nil {
+		log.ErrorLogMsg("failed to get the pools of the StorageClasses: %v", err)
+
+		return clusterRefs
+	}
+	for _, ref := range refs {
+		clusterRefs[ref.ClusterID] = append(clusterRefs[ref.ClusterID], ref)
+	}
+
+	return clusterRefs
+}
+
+// collect updates the metrics of the cluster, with the usage of the pools that
+// the StorageClasses refer to.
+func (hc *cephHealthCollector) collect(clusterID string, refs []k8s.PoolReference) error {
+	cr, err := NewCredentialsFromFiles(CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+	defer cr.DeleteCredentials()
+
+	monitors, err := Mons(CsiConfigFile, clusterID)
+	if err != nil {
+		return err
+	}
+
+	cc := &ClusterConnection{}
+	err = cc.Connect(monitors, cr)
+	if err != nil {
+		return err
+	}
+	defer cc.Destroy()
+
+	health := cephHealthReport{}
+	err = cc.monCommandJSON("health", nil, &health)
+	if err != nil {
+		return err
+	}
+	hc.setHealth(clusterID, &health)
+
+	df := cephDFReport{}
+	err = cc.monCommandJSON("df", nil, &df)
+	if err != nil {
+		return err
+	}
+	hc.setPoolUsage(clusterID, &df, referencedPools(cc, clusterID, refs))
+
+	return nil
+}
+
+// referencedPools returns the pools of the references and of the tenant
+// quotas of the cluster in the CSI config file. The default data pool of the
+// filesystem is looked up for references without a pool.
+func referencedPools(cc *ClusterConnection, clusterID string, refs []k8s.PoolReference) map[string]bool {
+	pools := make(map[string]bool)
+	for _, ref := range refs {
+		pool := ref.Pool
+		if pool == "" {
+			var err error
+			pool, err = cc.defaultDataPool(ref.FsName)
+			if err != nil {
+				log.ErrorLogMsg("failed to get the data pool of filesystem %q of cluster %q: %v",
+					ref.FsName, clusterID, err)
+
+				continue
+			}
+		}
+		pools[pool] = true
+	}
+
+	cluster, err := readClusterInfo(CsiConfigFile, clusterID)
+	if err != nil {
+		log.ErrorLogMsg("failed to get the tenant quotas of cluster %q: %v", clusterID, err)
+
+		return pools
+	}
+	for _, quota := range cluster.TenantQuotas {
+		if quota.Pool != "" {
+			pools[quota.Pool] = true
+		}
+	}
+
+	return pools
+}
+
+// setHealth updates the metrics for the health report of the cluster.
+func (hc *cephHealthCollector) setHealth(clusterID string, health *cephHealthReport) {
+	if !RecordMetricLabel(MetricLabelClusterID, clusterID) {
+		return
+	}
+
+	status, ok := cephHealthStatus[health.Status]
+	if !ok {
+		log.WarningLogMsg("unknown health status %q of cluster %q", health.Status, clusterID)
+		status = cephHealthStatus["HEALTH_ERR"]
+	}
+	cephHealth.WithLabelValues(clusterID).Set(status)
+
+	for _, check := range capacityHealthChecks {
+		_, raised := health.Checks[check]
+		cephHealthCheck.WithLabelValues(clusterID, check).Set(BoolToFloat(raised))
+	}
+}
+
+// setPoolUsage updates the metrics for the referenced pools of the cluster,
+// and removes the metrics of pools that do not exist or are not referenced
+// anymore.
+func (hc *cephHealthCollector) setPoolUsage(clusterID string, df *cephDFReport, referenced map[string]bool) {
+	pools := make(map[string]bool, len(referenced))
+	for _, pool := range df.Pools {
+		if !referenced[pool.Name] {
+			continue
+		}
+		if !RecordMetricLabel(MetricLabelClusterID, clusterID) || !RecordMetricLabel(MetricLabelPool, pool.Name) {
+			continue
+		}
+		cephPoolUsedRatio.WithLabelValues(clusterID, pool.Name).Set(pool.Stats.PercentUsed)
+		pools[pool.Name] = true
+	}
+
+	for pool := range hc.pools[clusterID] {
+		if !pools[pool] {
+			cephPoolUsedRatio.DeleteLabelValues(clusterID, pool)
+		}
+	}
+	hc.pools[clusterID] = pools
+}
@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCephHealthCollector(t *testing.T) {
+	t.Parallel()
+
+	hc := &cephHealthCollector{
+		pools: make(map[string]map[string]bool),
+	}
+
+	health := cephHealthReport{}
+	err := json.Unmarshal([]byte(`{"status":"HEALTH_WARN","checks":{"POOL_NEARFULL":{"severity":"HEALTH_WARN"}}}`),
+		&health)
+	if err != nil {
+		t.Fatalf("failed to parse health report: %v", err)
+	}
+	hc.setHealth("test-health", &health)
+
+	if v := testutil.ToFloat64(cephHealth.WithLabelValues("test-health")); v != 1 {
+		t.Errorf("health status = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(cephHealthCheck.WithLabelValues("test-health", "POOL_NEARFULL")); v != 1 {
+		t.Errorf("POOL_NEARFULL = %v, want 1", v)
+	}
+	if v := testutil.ToFloat64(cephHealthCheck.WithLabelValues("test-health", "OSD_FULL")); v != 0 {
+		t.Errorf("OSD_FULL = %v, want 0", v)
+	}
+
+	df := cephDFReport{}
+	err = json.Unmarshal([]byte(`{"pools":[{"name":"rbd","stats":{"percent_used":0.25}},`+
+		`{"name":"old","stats":{"percent_used":0.5}}]}`), &df)
+	if err != nil {
+		t.Fatalf("failed to parse df report: %v", err)
+	}
+	referenced := map[string]bool{"rbd": true, "old": true}
+	hc.setPoolUsage("test-health", &df, referenced)
+	if v := testutil.ToFloat64(cephPoolUsedRatio.WithLabelValues("test-health", "rbd")); v != 0.25 {
+		t.Errorf("used ratio of pool rbd = %v, want 0.25", v)
+	}
+
+	// the deleted pool should not be reported anymore
+	df.Pools = df.Pools[:1]
+	hc.setPoolUsage("test-health", &df, referenced)
+	if cephPoolUsedRatio.DeleteLabelValues("test-health", "old") {
+		t.Error("used ratio of deleted pool is still reported")
+	}
+
+	// pools that are not referenced are not reported
+	hc.setPoolUsage("test-health", &df, map[string]bool{"other": true})
+	if cephPoolUsedRatio.DeleteLabelValues("test-health", "rbd") {
+		t.Error("used ratio of pool that is not referenced is reported")
+	}
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	// FindingError is the severity of a configuration that makes requests
+	// fail.
+	FindingError = "error"
+	// FindingWarning is the severity of a configuration that works, but
+	// is likely not intended, or deprecated.
+	FindingWarning = "warning"
+)
+
+// ConfigFinding is a problem in the configuration of the driver, as reported
+// by the validate-config command of cephcsi.
+type ConfigFinding struct {
+	Severity string `json:"severity"`
+	// Source is the configuration with the problem, like "csi-config",
+	// "kms-config", or "cluster" for the checks against the cluster
+	Source    string `json:"source"`
+	ClusterID string `json:"clusterID,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ConfigFindings are the results of the validation of the configuration.
+type ConfigFindings []ConfigFinding
+
+// Add adds a finding with the formatted message.
+func (cf *ConfigFindings) Add(severity, source, clusterID, format string, args ...interface{}) {
+	*cf = append(*cf, ConfigFinding{
+		Severity:  severity,
+		Source:    source,
+		ClusterID: clusterID,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Valid returns whether there are no findings with the error severity.
+func (cf ConfigFindings) Valid() bool {
+	for i := range cf {
+		if cf[i].Severity == FindingError {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Write writes a line for each finding in the text format, or a JSON object
+// with the findings and whether the configuration is valid in the json
+// format.
+func (cf ConfigFindings) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		findings := cf
+		if findings == nil {
+			findings = ConfigFindings{}
+		}
+
+		return json.NewEncoder(w).Encode(struct {
+			Valid    bool           `json:"valid"`
+			Findings ConfigFindings `json:"findings"`
+		}{cf.Valid(), findings})
+	case "text":
+	default:
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", format)
+	}
+
+	for i := range cf {
+		f := &cf[i]
+		source := f.Source
+		if f.ClusterID != "" {
+			source += " (cluster " + f.ClusterID + ")"
+		}
+		_, err := fmt.Fprintf(w, "%s: %s: %s\n", f.Severity, source, f.Message)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// configSource is the source of the findings of ValidateCSIConfig.
+const configSource = "csi-config"
+
+// ValidateCSIConfig checks the clusters in the CSI config file, without
+// connecting to them. The clusters are returned for further checks, nil when
+// the file can not be read.
+func ValidateCSIConfig(pathToConfig string) ([]ClusterInfo, ConfigFindings) {
+	var findings ConfigFindings
+	clusters, err := readClusterInfos(pathToConfig)
+	if err != nil {
+		findings.Add(FindingError, configSource, "", "failed to read %s: %v", pathToConfig, err)
+
+		return nil, findings
+	}
+	if len(clusters) == 0 {
+		findings.Add(FindingWarning, configSource, "", "no clusters are configured in %s", pathToConfig)
+	}
+
+	seen := map[string]bool{}
+	for i := range clusters {
+		c := &clusters[i]
+		switch {
+		case c.ClusterID == "":
+			findings.Add(FindingError, configSource, "", "cluster %d has no clusterID", i)
+		case seen[c.ClusterID]:
+			findings.Add(FindingError, configSource, c.ClusterID,
+				"clusterID is configured more than once, only the first configuration is used")
+		case knownFieldSize+len(c.ClusterID) > maxVolIDLen:
+			findings.Add(FindingError, configSource, c.ClusterID,
+				"clusterID is longer than %d characters, it does not fit in volume IDs",
+				maxVolIDLen-knownFieldSize)
+		}
+		seen[c.ClusterID] = true
+
+		validateClusterInfo(c, &findings)
+	}
+
+	return clusters, findings
+}
+
+// validateClusterInfo adds the findings of the configuration of the cluster.
+func validateClusterInfo(c *ClusterInfo, findings *ConfigFindings) {
+	if len(c.Monitors) == 0 {
+		findings.Add(FindingError, configSource, c.ClusterID, "no monitors are configured")
+	}
+	for _, mon := range c.Monitors {
+		if mon == "" || strings.ContainsAny(mon, " \t\n") {
+			findings.Add(FindingError, configSource, c.ClusterID, "invalid monitor address %q", mon)
+		}
+	}
+
+	if c.RadosNamespace != "" {
+		findings.Add(FindingWarning, configSource, c.ClusterID,
+			"radosNamespace is deprecated, use rbd.radosNamespace instead")
+	}
+	for _, path := range []string{c.CephFS.NetNamespaceFilePath, c.RBD.NetNamespaceFilePath, c.NFS.NetNamespaceFilePath} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			findings.Add(FindingError, configSource, c.ClusterID, "netNamespaceFilePath: %v", err)
+		}
+	}
+
+	if c.CredentialsDir != "" {
+		secrets, err := ReadCredentialsDir(c.CredentialsDir)
+		switch {
+		case err != nil:
+			findings.Add(FindingError, configSource, c.ClusterID, "credentialsDir: %v", err)
+		case !hasCredentials(secrets, credUserID, credUserKey) && !hasCredentials(secrets, credAdminID, credAdminKey):
+			findings.Add(FindingError, configSource, c.ClusterID,
+				"credentialsDir %s needs the %s and %s, or the %s and %s files",
+				c.CredentialsDir, credUserID, credUserKey, credAdminID, credAdminKey)
+		}
+	}
+
+	quotas := map[string]bool{}
+	for _, q := range c.TenantQuotas {
+		if q.Pool == "" {
+			findings.Add(FindingError, configSource, c.ClusterID, "tenant quota for %q has no pool", q.Tenant)
+		}
+		if q.MaxBytes < 0 {
+			findings.Add(FindingError, configSource, c.ClusterID,
+				"tenant quota for %q in pool %q has a negative maxBytes", q.Tenant, q.Pool)
+		}
+		key := q.Tenant + "/" + q.Pool
+		if quotas[key] {
+			findings.Add(FindingWarning, configSource, c.ClusterID,
+				"tenant quota for %q in pool %q is configured more than once, only the first is used",
+				q.Tenant, q.Pool)
+		}
+		quotas[key] = true
+	}
+}
+
+// hasCredentials returns whether the secrets have a non-empty ID and key.
+func hasCredentials(secrets map[string]string, idField, keyField string) bool {
+	return secrets[idField] != "" && secrets[keyField] != ""
+}
+
+// TenantQuotaPools returns the pools (RBD) or filesystems (CephFS) that are
+// referenced by the tenant quotas of the cluster.
+func (ci *ClusterInfo) TenantQuotaPools() []string {
+	pools := []string{}
+	seen := map[string]bool{}
+	for _, q := range ci.TenantQuotas {
+		if q.Pool != "" && !seen[q.Pool] {
+			pools = append(pools, q.Pool)
+			seen[q.Pool] = true
+		}
+	}
+
+	return pools
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestValidateCSIConfig(t *testing.T) {
+	t.Parallel()
+
+	basePath := t.TempDir()
+	credDir := filepath.Join(basePath, "creds")
+	if err := os.Mkdir(credDir, 0o700); err != nil {
+		t.Fatalf("failed to create credentials directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(credDir, "userID"), []byte("csi-rbd"), 0o600); err != nil {
+		t.Fatalf("failed to write userID: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		config   string
+		errors   int
+		warnings int
+	}{
+		{
+			name:   "valid",
+			config: `[{"clusterID":"cluster-1","monitors":["mon1:6789"],"tenantQuotas":[{"pool":"rbd","maxBytes":0}]}]`,
+		},
+		{
+			name:   "not json",
+			config: `{"clusterID":`,
+			errors: 1,
+		},
+		{
+			name:     "no clusters",
+			config:   `[]`,
+			warnings: 1,
+		},
+		{
+			name:   "missing clusterID and monitors",
+			config: `[{"monitors":[]}]`,
+			errors: 2,
+		},
+		{
+			name:   "duplicate clusterID",
+			config: `[{"clusterID":"cluster-1","monitors":["mon1"]},{"clusterID":"cluster-1","monitors":["mon2"]}]`,
+			errors: 1,
+		},
+		{
+			name:     "deprecated radosNamespace",
+			config:   `[{"clusterID":"cluster-1","monitors":["mon1"],"radosNamespace":"ns"}]`,
+			warnings: 1,
+		},
+		{
+			name:   "incomplete credentials",
+			config: `[{"clusterID":"cluster-1","monitors":["mon1"],"credentialsDir":"` + credDir + `"}]`,
+			errors: 1,
+		},
+		{
+			name: "invalid tenant quotas",
+			config: `[{"clusterID":"cluster-1","monitors":["mon1"],"tenantQuotas":[` +
+				`{"tenant":"a","maxBytes":1},{"tenant":"b","pool":"rbd","maxBytes":-1},` +
+				`{"tenant":"c","pool":"rbd","maxBytes":1},{"tenant":"c","pool":"rbd","maxBytes":2}]}]`,
+			errors:   2,
+			warnings: 1,
+		},
+	}
+	for i, tt := range tests {
+		ts := tt
+		pathToConfig := filepath.Join(basePath, "config-"+strconv.Itoa(i)+".json")
+		if err := os.WriteFile(pathToConfig, []byte(ts.config), 0o600); err != nil {
+			t.Fatalf("failed to write config: %v", err)
+		}
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			_, findings := ValidateCSIConfig(pathToConfig)
+			errors, warnings := 0, 0
+			for _, f := range findings {
+				if f.Severity == FindingError {
+					errors++
+				} else {
+					warnings++
+				}
+			}
+			if errors != ts.errors || warnings != ts.warnings {
+				t.Errorf("ValidateCSIConfig() = %+v, want %d errors and %d warnings", findings, ts.errors, ts.warnings)
+			}
+			if findings.Valid() != (ts.errors == 0) {
+				t.Errorf("Valid() = %v with %d errors", findings.Valid(), ts.errors)
+			}
+		})
+	}
+}
+
+func TestConfigFindingsWrite(t *testing.T) {
+	t.Parallel()
+
+	var findings ConfigFindings
+	findings.Add(FindingWarning, "csi-config", "cluster-1", "radosNamespace is deprecated")
+
+	var text bytes.Buffer
+	if err := findings.Write(&text, "text"); err != nil {
+		t.Fatalf("Write(text) error = %v", err)
+	}
+	if want := "warning: csi-config (cluster cluster-1): radosNamespace is deprecated\n"; text.String() != want {
+		t.Errorf("Write(text) = %q, want %q", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	if err := findings.Write(&out, "json"); err != nil {
+		t.Fatalf("Write(json) error = %v", err)
+	}
+	var result struct {
+		Valid    bool            `json:"valid"`
+		Findings []ConfigFinding `json:"findings"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &result); err != nil {
+		t.Fatalf("failed to decode %q: %v", out.String(), err)
+	}
+	if !result.Valid || len(result.Findings) != 1 || result.Findings[0] != findings[0] {
+		t.Errorf("Write(json) = %+v, want valid with %+v", result, findings)
+	}
+}
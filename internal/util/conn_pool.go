@@ -94,6 +94,39 @@ func (cp *ConnPool) Destroy() {
 	}
 }
 
+// CloseUnused stops the garbage collector and destroys the connections in
+// the pool that are not in use. It returns the number of connections that
+// still have users, those are not destroyed.
+func (cp *ConnPool) CloseUnused() int {
+	cp.timer.Stop()
+	_, inUse := cp.closeUnused()
+
+	return inUse
+}
+
+// closeUnused destroys the connections in the pool that are not in use. It
+// returns the number of destroyed connections, and of connections that still
+// have users.
+func (cp *ConnPool) closeUnused() (int, int) {
+	cp.lock.Lock()
+	defer cp.lock.Unlock()
+
+	closed, inUse := 0, 0
+	for key, ce := range cp.conns {
+		if ce.users != 0 {
+			inUse++
+
+			continue
+		}
+
+		ce.destroy()
+		delete(cp.conns, key)
+		closed++
+	}
+
+	return closed, inUse
+}
+
 func (cp *ConnPool) generateUniqueKey(monitors, user, keyfile string) (string, error) {
 	// the keyfile can be unique for operations, contents will be the same
 	key, err := os.ReadFile(keyfile) // #nosec:G304, file inclusion via variable.
@@ -174,6 +207,20 @@ func (cp *ConnPool) Get(monitors, user, keyfile string) (*rados.Conn, error) {
 	return conn, nil
 }
 
+// Len returns the number of connections in the pool, and the number of
+// users of these connections.
+func (cp *ConnPool) Len() (int, int) {
+	cp.lock.RLock()
+	defer cp.lock.RUnlock()
+
+	users := 0
+	for _, ce := range cp.conns {
+		users += ce.users
+	}
+
+	return len(cp.conns), users
+}
+
 // Copy adds an extra reference count to the used ConnEntry and returns the
 // *rados.Conn if it was found.
 func (cp *ConnPool) Copy(conn *rados.Conn) *rados.Conn {
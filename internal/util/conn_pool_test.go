@@ -147,6 +147,16 @@ func TestConnPool(t *testing.T) {
 		}
 	})
 
+	// the conn of "fakeGet" is still in use
+	t.Run("closeUnused", func(t *testing.T) {
+		if inUse := cp.CloseUnused(); inUse != 1 {
+			t.Errorf("CloseUnused() should report one conn in use: %v", inUse)
+		}
+		if len(cp.conns) != 1 {
+			t.Errorf("CloseUnused() should not have removed the conn in use: %v", len(cp.conns))
+		}
+	})
+
 	// there is still one conn in cp.conns after "doubleFakeGet"
 	t.Run("garbageCollection", func(t *testing.T) {
 		// timeout has not occurred yet, so number of conns in the list should stay the same
@@ -17,10 +17,16 @@ limitations under the License.
 package util
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
+	"syscall"
 	"time"
 
+	"github.com/ceph/ceph-csi/internal/util/log"
+
 	ca "github.com/ceph/go-ceph/cephfs/admin"
 	"github.com/ceph/go-ceph/common/admin/nfs"
 	"github.com/ceph/go-ceph/rados"
@@ -47,6 +53,14 @@ var (
 	connPool   = NewConnPool(cpInterval, cpExpiry)
 )
 
+// CloseConnections closes the connections to the Ceph clusters that are not
+// in use anymore, it is called when the driver stops.
+func CloseConnections() {
+	if inUse := connPool.CloseUnused(); inUse != 0 {
+		log.WarningLogMsg("%d connections to Ceph clusters are still in use", inUse)
+	}
+}
+
 // rbdVol.Connect() connects to the Ceph cluster and sets rbdVol.conn for further usage.
 func (cc *ClusterConnection) Connect(monitors string, cr *Credentials) error {
 	if cc.conn == nil {
@@ -151,3 +165,88 @@ func (cc *ClusterConnection) GetNFSAdmin() (*nfs.Admin, error) {
 
 	return nfs.NewFromConn(cc.conn), nil
 }
+
+// ClusterHealth is the result of CheckClusterHealth.
+type ClusterHealth struct {
+	// Reachable is set when the monitors responded, even if the
+	// credentials were rejected.
+	Reachable bool
+	// Authenticated is set when the monitors accepted the credentials.
+	Authenticated bool
+	// QuorumSize is the number of monitors in quorum.
+	QuorumSize int
+}
+
+// quorumStatus contains the parts of the "quorum_status" mon command output
+// that are used.
+type quorumStatus struct {
+	QuorumNames []string `json:"quorum_names"`
+}
+
+// CheckClusterHealth checks that the Ceph cluster is reachable with the
+// credentials, by connecting to the monitors and fetching the quorum status.
+// Unlike Connect(), a new connection is created and closed on each call, so
+// that a cluster that became unreachable is detected even when a pooled
+// connection still exists. The timeout limits the time for connecting and for
+// the monitor command. The returned ClusterHealth is valid when an error is
+// returned too, it tells which of the checks failed.
+func CheckClusterHealth(monitors string, cr *Credentials, timeout time.Duration) (ClusterHealth, error) {
+	health := ClusterHealth{}
+
+	conn, err := rados.NewConnWithUser(cr.ID)
+	if err != nil {
+		return health, fmt.Errorf("creating a new connection failed: %w", err)
+	}
+	defer conn.Shutdown()
+
+	args := []string{"-m", monitors, "--keyfile=" + cr.KeyFile}
+	err = conn.ParseCmdLineArgs(args)
+	if err != nil {
+		return health, fmt.Errorf("parsing cmdline args (%v) failed: %w", args, err)
+	}
+
+	if err = conn.ReadConfigFile(CephConfigPath); err != nil {
+		return health, fmt.Errorf("failed to read config file %q: %w", CephConfigPath, err)
+	}
+
+	// a value of 0 disables the timeout, round up to full seconds
+	seconds := strconv.Itoa(int(math.Ceil(timeout.Seconds())))
+	for _, option := range []string{"client_mount_timeout", "rados_mon_op_timeout"} {
+		err = conn.SetConfigOption(option, seconds)
+		if err != nil {
+			return health, fmt.Errorf("failed to set %s to %s: %w", option, seconds, err)
+		}
+	}
+
+	err = conn.Connect()
+	if err != nil {
+		// the monitors reject the credentials with EACCES or EPERM
+		var errno interface{ ErrorCode() int }
+		if errors.As(err, &errno) &&
+			(errno.ErrorCode() == -int(syscall.EACCES) || errno.ErrorCode() == -int(syscall.EPERM)) {
+			health.Reachable = true
+		}
+
+		return health, fmt.Errorf("connecting failed: %w", err)
+	}
+	health.Reachable = true
+	health.Authenticated = true
+
+	cmd, err := json.Marshal(map[string]string{"prefix": "quorum_status", "format": "json"})
+	if err != nil {
+		return health, fmt.Errorf("failed to marshal quorum_status command: %w", err)
+	}
+	buf, _, err := conn.MonCommand(cmd)
+	if err != nil {
+		return health, fmt.Errorf("failed to get quorum status: %w", err)
+	}
+
+	status := quorumStatus{}
+	err = json.Unmarshal(buf, &status)
+	if err != nil {
+		return health, fmt.Errorf("failed to parse quorum status %q: %w", string(buf), err)
+	}
+	health.QuorumSize = len(status.QuorumNames)
+
+	return health, nil
+}
@@ -0,0 +1,54 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// CorrelationIDVolumeContextKey is the key in the volume context that
+	// passes the correlation ID of a volume from CreateVolume to the
+	// procedures on the node.
+	CorrelationIDVolumeContextKey = "correlationID"
+
+	// correlationIDMetadataKey is the key of the image or subvolume
+	// metadata that stores the correlation ID of the volume.
+	correlationIDMetadataKey = "csi.ceph.com/correlation-id"
+)
+
+// GetCorrelationID returns the correlation ID of the operation in the
+// context, or an empty string if there is none.
+func GetCorrelationID(ctx context.Context) string {
+	if id, ok := ctx.Value(log.CorrelationID).(string); ok {
+		return id
+	}
+
+	return ""
+}
+
+// AddCorrelationIDMetadata adds the correlation ID of the operation in the
+// context to the metadata that is set on an image or subvolume.
+func AddCorrelationIDMetadata(ctx context.Context, metadata map[string]string) map[string]string {
+	if id := GetCorrelationID(ctx); id != "" {
+		metadata[correlationIDMetadataKey] = id
+	}
+
+	return metadata
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
 const (
@@ -104,6 +106,34 @@ func (cr *Credentials) DeleteCredentials() {
 	_ = os.Remove(cr.KeyFile)
 }
 
+// ClusterSecrets returns the secrets of the clusterID from secrets that can
+// carry the credentials of several clusters, like those of both clusters of a
+// mirrored pair. The keys for a cluster are prefixed with its clusterID and a
+// dot ("<clusterID>.userID", "<clusterID>.userKey"). The secrets are returned
+// unchanged when there are no keys for the clusterID.
+func ClusterSecrets(secrets map[string]string, clusterID string) map[string]string {
+	if clusterID == "" {
+		return secrets
+	}
+
+	prefix := clusterID + "."
+	var clusterSecrets map[string]string
+	for key, value := range secrets {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if clusterSecrets == nil {
+			clusterSecrets = make(map[string]string)
+		}
+		clusterSecrets[strings.TrimPrefix(key, prefix)] = value
+	}
+	if clusterSecrets == nil {
+		return secrets
+	}
+
+	return clusterSecrets
+}
+
 // NewUserCredentials creates new user credentials from secret.
 func NewUserCredentials(secrets map[string]string) (*Credentials, error) {
 	return newCredentialsFromSecret(credUserID, credUserKey, secrets)
@@ -114,6 +144,97 @@ func NewAdminCredentials(secrets map[string]string) (*Credentials, error) {
 	return newCredentialsFromSecret(credAdminID, credAdminKey, secrets)
 }
 
+// credentialFiles are the names of the files that can be placed in the
+// credentials directory of a cluster, these match the keys in the secrets.
+var credentialFiles = []string{credUserID, credUserKey, credAdminID, credAdminKey}
+
+// GetCredentialsFromFiles reads the credentials for the clusterID from the
+// credentials directory configured in the CSI config file, and returns them
+// as a secrets map. The files are read on each call, so that credentials that
+// are rotated by an external agent are used without restarting the driver.
+// An empty map is returned if no credentials directory is configured.
+func GetCredentialsFromFiles(pathToConfig, clusterID string) (map[string]string, error) {
+	dir, err := GetCredentialsDir(pathToConfig, clusterID)
+	if err != nil || dir == "" {
+		return make(map[string]string), err
+	}
+
+	secrets, err := ReadCredentialsDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for cluster ID %q: %w", clusterID, err)
+	}
+
+	return secrets, nil
+}
+
+// ReadCredentialsDir reads the credential files in the directory into a
+// secrets map.
+func ReadCredentialsDir(dir string) (map[string]string, error) {
+	secrets := make(map[string]string)
+	for _, name := range credentialFiles {
+		content, err := os.ReadFile(filepath.Join(dir, name)) // #nosec:G304, file inclusion via variable.
+		if err != nil {
+			// not all files need to be present, either the user or
+			// the admin credentials are sufficient
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, fmt.Errorf("failed to read credentials: %w", err)
+		}
+
+		secrets[name] = strings.TrimSpace(string(content))
+	}
+
+	if len(secrets) == 0 {
+		return nil, fmt.Errorf("no credentials found in %q", dir)
+	}
+
+	return secrets, nil
+}
+
+// NewCredentialsFromFiles creates credentials for the clusterID from the
+// credentials directory configured in the CSI config file, see
+// GetCredentialsFromFiles(). The user credentials are used when present,
+// otherwise the admin credentials. ErrNoCredentials is returned if no
+// credentials directory is configured. The caller needs to call
+// DeleteCredentials() on the returned Credentials.
+func NewCredentialsFromFiles(pathToConfig, clusterID string) (*Credentials, error) {
+	secrets, err := GetCredentialsFromFiles(pathToConfig, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	if len(secrets) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	return newUserOrAdminCredentials(secrets)
+}
+
+// NewCredentialsFromDir creates credentials from the files in the directory,
+// like a mounted Secret with the userID and userKey, or adminID and adminKey
+// keys. The caller needs to call DeleteCredentials() on the returned
+// Credentials.
+func NewCredentialsFromDir(dir string) (*Credentials, error) {
+	secrets, err := ReadCredentialsDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return newUserOrAdminCredentials(secrets)
+}
+
+// newUserOrAdminCredentials creates the user credentials from the secrets
+// when present, otherwise the admin credentials.
+func newUserOrAdminCredentials(secrets map[string]string) (*Credentials, error) {
+	cr, err := NewUserCredentials(secrets)
+	if err != nil {
+		cr, err = NewAdminCredentials(secrets)
+	}
+
+	return cr, err
+}
+
 // GetMonValFromSecret returns monitors from secret.
 func GetMonValFromSecret(secrets map[string]string) (string, error) {
 	if mons, ok := secrets[credMonitors]; ok {
@@ -16,6 +16,8 @@ limitations under the License.
 package util
 
 import (
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -98,3 +100,103 @@ func TestParseAndSetSecretMapFromMigSecret(t *testing.T) {
 		})
 	}
 }
+
+func TestGetCredentialsFromFiles(t *testing.T) {
+	t.Parallel()
+
+	basePath := t.TempDir()
+	credDir := filepath.Join(basePath, "creds")
+	if err := os.Mkdir(credDir, 0o700); err != nil {
+		t.Fatalf("failed to create credentials directory: %v", err)
+	}
+	for name, value := range map[string]string{"userID": "csi-rbd\n", "userKey": "c2VjcmV0"} {
+		if err := os.WriteFile(filepath.Join(credDir, name), []byte(value), 0o600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	pathToConfig := filepath.Join(basePath, "config.json")
+	data := `[{"clusterID":"cluster-1","monitors":["mon1"],"credentialsDir":"` + credDir + `"},` +
+		`{"clusterID":"cluster-2","monitors":["mon2"]},` +
+		`{"clusterID":"cluster-3","monitors":["mon3"],"credentialsDir":"` + basePath + `"}]`
+	if err := os.WriteFile(pathToConfig, []byte(data), 0o600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	got, err := GetCredentialsFromFiles(pathToConfig, "cluster-1")
+	if err != nil {
+		t.Errorf("GetCredentialsFromFiles() failed: %v", err)
+	}
+	want := map[string]string{"userID": "csi-rbd", "userKey": "c2VjcmV0"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetCredentialsFromFiles() = %v, want %v", got, want)
+	}
+
+	// no credentials directory configured
+	got, err = GetCredentialsFromFiles(pathToConfig, "cluster-2")
+	if err != nil || len(got) != 0 {
+		t.Errorf("GetCredentialsFromFiles() = %v, %v, want empty map", got, err)
+	}
+
+	// credentials directory without credentials
+	_, err = GetCredentialsFromFiles(pathToConfig, "cluster-3")
+	if err == nil {
+		t.Errorf("GetCredentialsFromFiles() expected to fail for directory without credentials")
+	}
+
+	// unknown cluster
+	_, err = GetCredentialsFromFiles(pathToConfig, "cluster-4")
+	if err == nil {
+		t.Errorf("GetCredentialsFromFiles() expected to fail for missing cluster ID")
+	}
+}
+
+func TestClusterSecrets(t *testing.T) {
+	t.Parallel()
+	secrets := map[string]string{
+		"userID":            "local",
+		"userKey":           "local-key",
+		"cluster-b.userID":  "peer",
+		"cluster-b.userKey": "peer-key",
+	}
+	tests := []struct {
+		name      string
+		secrets   map[string]string
+		clusterID string
+		want      map[string]string
+	}{
+		{
+			name:      "keys of the cluster",
+			secrets:   secrets,
+			clusterID: "cluster-b",
+			want:      map[string]string{"userID": "peer", "userKey": "peer-key"},
+		},
+		{
+			name:      "no keys of the cluster",
+			secrets:   secrets,
+			clusterID: "cluster-a",
+			want:      secrets,
+		},
+		{
+			name:      "empty clusterID",
+			secrets:   secrets,
+			clusterID: "",
+			want:      secrets,
+		},
+		{
+			name:      "plain secrets",
+			secrets:   map[string]string{"userID": "local", "userKey": "local-key"},
+			clusterID: "cluster-b",
+			want:      map[string]string{"userID": "local", "userKey": "local-key"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ClusterSecrets(ts.secrets, ts.clusterID); !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("ClusterSecrets() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -161,6 +161,7 @@ func (ve *VolumeEncryption) StoreNewCryptoPassphrase(volumeID string) error {
 	if err != nil {
 		return fmt.Errorf("failed to generate passphrase for %s: %w", volumeID, err)
 	}
+	log.RegisterSecret(passphrase)
 
 	return ve.StoreCryptoPassphrase(volumeID, passphrase)
 }
@@ -172,7 +173,13 @@ func (ve *VolumeEncryption) GetCryptoPassphrase(volumeID string) (string, error)
 		return "", err
 	}
 
-	return ve.KMS.DecryptDEK(volumeID, passphrase)
+	passphrase, err = ve.KMS.DecryptDEK(volumeID, passphrase)
+	if err != nil {
+		return "", err
+	}
+	log.RegisterSecret(passphrase)
+
+	return passphrase, nil
 }
 
 // generateNewEncryptionPassphrase generates a random passphrase for encryption.
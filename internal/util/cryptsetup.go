@@ -18,9 +18,11 @@ package util
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 	"strings"
+	"time"
 )
 
 // LuksFormat sets up volume as an encrypted LUKS partition.
@@ -74,9 +76,12 @@ func execCryptsetupCommand(stdin *string, args ...string) (string, string, error
 	if stdin != nil {
 		cmd.Stdin = strings.NewReader(*stdin)
 	}
+	start := time.Now()
 	err := cmd.Run()
 	stdout := stdoutBuf.String()
 	stderr := stderrBuf.String()
+	// the result is logged by the callers
+	observeCommand(context.TODO(), program, start, err)
 
 	if err != nil {
 		return stdout, stderr, fmt.Errorf("an error (%v)"+
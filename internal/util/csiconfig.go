@@ -64,6 +64,12 @@ type ClusterInfo struct {
 		// symlink filepath for the network namespace where we need to execute commands.
 		NetNamespaceFilePath string `json:"netNamespaceFilePath"`
 	} `json:"nfs"`
+	// CredentialsDir is the directory that contains the cephx credentials
+	// for the cluster, one file per secret key (userID, userKey, adminID,
+	// adminKey). These are used for requests that do not pass secrets.
+	CredentialsDir string `json:"credentialsDir"`
+	// TenantQuotas limit the total size of the volumes of tenants in a pool
+	TenantQuotas []TenantQuota `json:"tenantQuotas"`
 }
 
 // Expected JSON structure in the passed in config file is,
@@ -80,17 +86,40 @@ type ClusterInfo struct {
 	],
 	"cephFS": {
 		"subvolumeGroup": "<subvolumegroup for cephfs volumes>"
-	}
+	},
+	"credentialsDir": "<directory with credential files>",
+	"tenantQuotas": [
+		{
+			"tenant": "<kubernetes namespace>",
+			"pool": "<rbd pool or cephfs filesystem>",
+			"maxBytes": <total size of the volumes>
+		}
+	]
 }]
 */
 func readClusterInfo(pathToConfig, clusterID string) (*ClusterInfo, error) {
+	config, err := readClusterInfos(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
+	}
+
+	for i := range config {
+		if config[i].ClusterID == clusterID {
+			return &config[i], nil
+		}
+	}
+
+	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+}
+
+// readClusterInfos returns the configuration of all clusters in the CSI
+// config file.
+func readClusterInfos(pathToConfig string) ([]ClusterInfo, error) {
 	var config []ClusterInfo
 
 	// #nosec
 	content, err := os.ReadFile(pathToConfig)
 	if err != nil {
-		err = fmt.Errorf("error fetching configuration for cluster ID %q: %w", clusterID, err)
-
 		return nil, err
 	}
 
@@ -100,13 +129,39 @@ func readClusterInfo(pathToConfig, clusterID string) (*ClusterInfo, error) {
 			err, string(content))
 	}
 
+	return config, nil
+}
+
+// GetClusterIDs returns the IDs of all clusters in the CSI config file.
+func GetClusterIDs(pathToConfig string) ([]string, error) {
+	config, err := readClusterInfos(pathToConfig)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching cluster IDs: %w", err)
+	}
+
+	ids := make([]string, 0, len(config))
 	for i := range config {
-		if config[i].ClusterID == clusterID {
-			return &config[i], nil
+		ids = append(ids, config[i].ClusterID)
+	}
+
+	return ids, nil
+}
+
+// HasCredentialsDir returns true when at least one cluster in the CSI config
+// file has a credentialsDir configured.
+func HasCredentialsDir(pathToConfig string) (bool, error) {
+	config, err := readClusterInfos(pathToConfig)
+	if err != nil {
+		return false, fmt.Errorf("error fetching cluster credentials directories: %w", err)
+	}
+
+	for i := range config {
+		if config[i].CredentialsDir != "" {
+			return true, nil
 		}
 	}
 
-	return nil, fmt.Errorf("missing configuration for cluster ID %q", clusterID)
+	return false, nil
 }
 
 // Mons returns a comma separated MON list from the csi config for the given clusterID.
@@ -144,11 +199,17 @@ func CephFSSubvolumeGroup(pathToConfig, clusterID string) (string, error) {
 		return "", err
 	}
 
-	if cluster.CephFS.SubvolumeGroup == "" {
-		return defaultCsiSubvolumeGroup, nil
+	return cluster.SubvolumeGroup(), nil
+}
+
+// SubvolumeGroup returns the subvolumeGroup for CephFS volumes of the
+// cluster, the default "csi" if it is not set.
+func (ci *ClusterInfo) SubvolumeGroup() string {
+	if ci.CephFS.SubvolumeGroup == "" {
+		return defaultCsiSubvolumeGroup
 	}
 
-	return cluster.CephFS.SubvolumeGroup, nil
+	return ci.CephFS.SubvolumeGroup
 }
 
 // GetMonsAndClusterID returns monitors and clusterID information read from
@@ -200,6 +261,17 @@ func GetCephFSNetNamespaceFilePath(pathToConfig, clusterID string) (string, erro
 	return cluster.CephFS.NetNamespaceFilePath, nil
 }
 
+// GetCredentialsDir returns the directory that contains the credential files
+// for the given clusterID.
+func GetCredentialsDir(pathToConfig, clusterID string) (string, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return "", err
+	}
+
+	return cluster.CredentialsDir, nil
+}
+
 // GetNFSNetNamespaceFilePath returns the netNamespaceFilePath for NFS volumes.
 func GetNFSNetNamespaceFilePath(pathToConfig, clusterID string) (string, error) {
 	cluster, err := readClusterInfo(pathToConfig, clusterID)
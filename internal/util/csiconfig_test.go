@@ -19,6 +19,7 @@ package util
 import (
 	"encoding/json"
 	"os"
+	"reflect"
 	"testing"
 )
 
@@ -365,3 +366,84 @@ func TestGetNFSNetNamespaceFilePath(t *testing.T) {
 		})
 	}
 }
+
+func TestGetClusterIDs(t *testing.T) {
+	t.Parallel()
+	csiConfig := []ClusterInfo{
+		{ClusterID: "cluster-1", Monitors: []string{"ip-1", "ip-2"}},
+		{ClusterID: "cluster-2", Monitors: []string{"ip-3", "ip-4"}},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	got, err := GetClusterIDs(tmpConfPath)
+	if err != nil {
+		t.Errorf("GetClusterIDs() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"cluster-1", "cluster-2"}) {
+		t.Errorf("GetClusterIDs() = %v, want [cluster-1 cluster-2]", got)
+	}
+
+	_, err = GetClusterIDs(t.TempDir() + "/missing.json")
+	if err == nil {
+		t.Errorf("GetClusterIDs() expected error for missing config file")
+	}
+}
+
+func TestHasCredentialsDir(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name   string
+		config []ClusterInfo
+		want   bool
+	}{
+		{
+			name:   "no credentialsDir",
+			config: []ClusterInfo{{ClusterID: "cluster-1"}, {ClusterID: "cluster-2"}},
+			want:   false,
+		},
+		{
+			name: "one cluster with credentialsDir",
+			config: []ClusterInfo{
+				{ClusterID: "cluster-1"},
+				{ClusterID: "cluster-2", CredentialsDir: "/etc/ceph-csi/cluster-2"},
+			},
+			want: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			content, err := json.Marshal(ts.config)
+			if err != nil {
+				t.Fatalf("failed to marshal csi config info %v", err)
+			}
+			tmpConfPath := t.TempDir() + "/ceph-csi.json"
+			err = os.WriteFile(tmpConfPath, content, 0o600)
+			if err != nil {
+				t.Fatalf("failed to write %s file content: %v", CsiConfigFile, err)
+			}
+
+			got, err := HasCredentialsDir(tmpConfPath)
+			if err != nil {
+				t.Errorf("HasCredentialsDir() error = %v", err)
+			}
+			if got != ts.want {
+				t.Errorf("HasCredentialsDir() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+
+	_, err := HasCredentialsDir(t.TempDir() + "/missing.json")
+	if err == nil {
+		t.Errorf("HasCredentialsDir() expected error for missing config file")
+	}
+}
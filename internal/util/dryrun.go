@@ -0,0 +1,127 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DryRunResult is the result of a step of a dry-run.
+type DryRunResult string
+
+const (
+	// DryRunPassed is the result of a step that CreateVolume would pass.
+	DryRunPassed = DryRunResult("passed")
+	// DryRunWarning is the result of a step that CreateVolume would pass,
+	// but that likely causes problems later, like a pool that is too full.
+	DryRunWarning = DryRunResult("warning")
+	// DryRunFailed is the result of the step that CreateVolume would fail
+	// in, it is the last step of a report.
+	DryRunFailed = DryRunResult("failed")
+)
+
+// DryRunStep is a step of CreateVolume that was checked by a dry-run.
+type DryRunStep struct {
+	Name    string       `json:"name"`
+	Result  DryRunResult `json:"result"`
+	Message string       `json:"message,omitempty"`
+}
+
+// DryRunReport is the report of a dry-run of CreateVolume, the steps that
+// were checked, and what CreateVolume would do.
+type DryRunReport struct {
+	RequestName string       `json:"requestName"`
+	Steps       []DryRunStep `json:"steps"`
+	// Code is the gRPC status code that CreateVolume would return
+	Code string `json:"code"`
+	// Outcome describes what CreateVolume would do, or why it would fail
+	Outcome string `json:"outcome"`
+}
+
+// NewDryRunReport returns an empty report for the request name.
+func NewDryRunReport(requestName string) *DryRunReport {
+	return &DryRunReport{
+		RequestName: requestName,
+		Steps:       []DryRunStep{},
+	}
+}
+
+// Pass adds a step that CreateVolume would pass.
+func (r *DryRunReport) Pass(step, format string, args ...interface{}) {
+	r.Steps = append(r.Steps, DryRunStep{Name: step, Result: DryRunPassed, Message: fmt.Sprintf(format, args...)})
+}
+
+// Warn adds a step that CreateVolume would pass, with a problem that is
+// likely to cause a failure later.
+func (r *DryRunReport) Warn(step, format string, args ...interface{}) {
+	r.Steps = append(r.Steps, DryRunStep{Name: step, Result: DryRunWarning, Message: fmt.Sprintf(format, args...)})
+}
+
+// Fail adds the step that CreateVolume would fail in with the gRPC error,
+// which is the outcome of the report.
+func (r *DryRunReport) Fail(step string, err error) {
+	st := status.Convert(err)
+	r.Steps = append(r.Steps, DryRunStep{Name: step, Result: DryRunFailed, Message: st.Message()})
+	r.Code = st.Code().String()
+	r.Outcome = fmt.Sprintf("CreateVolume would fail with %s: %s", st.Code(), st.Message())
+}
+
+// Succeed sets the outcome of a report without a failed step.
+func (r *DryRunReport) Succeed(format string, args ...interface{}) {
+	r.Code = codes.OK.String()
+	r.Outcome = fmt.Sprintf(format, args...)
+}
+
+// Failed returns whether CreateVolume would fail.
+func (r *DryRunReport) Failed() bool {
+	return r.Code != codes.OK.String()
+}
+
+// Write writes the report in the format, which is "text" or "json".
+func (r *DryRunReport) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(r)
+	case "text":
+	default:
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", format)
+	}
+
+	_, err := fmt.Fprintf(w, "request name: %s\n", r.RequestName)
+	if err != nil {
+		return err
+	}
+	for i := range r.Steps {
+		s := &r.Steps[i]
+		line := fmt.Sprintf("%-8s %s", s.Result, s.Name)
+		if s.Message != "" {
+			line += ": " + s.Message
+		}
+		_, err = fmt.Fprintln(w, line)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "outcome: %s\n", r.Outcome)
+
+	return err
+}
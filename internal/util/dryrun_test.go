@@ -0,0 +1,90 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDryRunReport(t *testing.T) {
+	t.Parallel()
+
+	failed := NewDryRunReport("pvc-1")
+	failed.Pass("validate-request", "the request is valid")
+	failed.Warn("capacity", "pool is full")
+	failed.Fail("tenant-quota", status.Error(codes.ResourceExhausted, "quota exceeded"))
+
+	succeeded := NewDryRunReport("pvc-2")
+	succeeded.Pass("validate-request", "")
+	succeeded.Succeed("a new image would be created")
+
+	tests := []struct {
+		name       string
+		report     *DryRunReport
+		wantFailed bool
+		wantCode   string
+		wantText   string
+	}{
+		{
+			name:       "failed",
+			report:     failed,
+			wantFailed: true,
+			wantCode:   "ResourceExhausted",
+			wantText: "request name: pvc-1\n" +
+				"passed   validate-request: the request is valid\n" +
+				"warning  capacity: pool is full\n" +
+				"failed   tenant-quota: quota exceeded\n" +
+				"outcome: CreateVolume would fail with ResourceExhausted: quota exceeded\n",
+		},
+		{
+			name:       "succeeded",
+			report:     succeeded,
+			wantFailed: false,
+			wantCode:   "OK",
+			wantText: "request name: pvc-2\n" +
+				"passed   validate-request\n" +
+				"outcome: a new image would be created\n",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, ts.wantFailed, ts.report.Failed())
+			assert.Equal(t, ts.wantCode, ts.report.Code)
+
+			var text bytes.Buffer
+			require.NoError(t, ts.report.Write(&text, "text"))
+			assert.Equal(t, ts.wantText, text.String())
+
+			var out bytes.Buffer
+			require.NoError(t, ts.report.Write(&out, "json"))
+			decoded := &DryRunReport{}
+			require.NoError(t, json.Unmarshal(out.Bytes(), decoded))
+			assert.Equal(t, ts.report, decoded)
+		})
+	}
+
+	assert.Error(t, failed.Write(&bytes.Buffer{}, "yaml"))
+}
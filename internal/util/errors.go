@@ -35,8 +35,26 @@ var (
 	ErrPoolNotFound = errors.New("pool not found")
 	// ErrClusterIDNotSet is returned when cluster id is not set.
 	ErrClusterIDNotSet = errors.New("clusterID must be set")
+	// ErrInvalidNamePrefix is returned when the volumeNamePrefix or
+	// snapshotNamePrefix parameter is invalid.
+	ErrInvalidNamePrefix = errors.New("invalid name prefix")
 	// ErrMissingConfigForMonitor is returned when clusterID is not found for the mon.
 	ErrMissingConfigForMonitor = errors.New("missing configuration of cluster ID for monitor")
+	// ErrNoCredentials is returned when no credentials directory is configured
+	// for the cluster ID.
+	ErrNoCredentials = errors.New("no credentials directory configured")
+	// ErrTopologyMismatch is returned when a volume is staged on a node that
+	// is not in the topology segment of the pool of the volume.
+	ErrTopologyMismatch = errors.New("node is not in the topology segment of the volume")
+	// ErrSnapshotLimitExceeded is returned when a volume has the maximum
+	// number of snapshots already.
+	ErrSnapshotLimitExceeded = errors.New("maximum number of snapshots of the volume reached")
+	// ErrTenantQuotaExceeded is returned when a new volume does not fit in
+	// the quota of the tenant in the pool.
+	ErrTenantQuotaExceeded = errors.New("quota of the tenant exceeded")
+	// ErrMountOptionDenied is returned when a volume is mounted with an
+	// option that the mount options policy denies.
+	ErrMountOptionDenied = errors.New("mount option is denied by policy")
 )
 
 type pairError struct {
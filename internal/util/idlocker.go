@@ -14,12 +14,15 @@ limitations under the License.
 package util
 
 import (
+	"context"
 	"fmt"
+	"hash/fnv"
 	"sync"
+	"time"
 
 	"github.com/ceph/ceph-csi/internal/util/log"
 
-	"k8s.io/apimachinery/pkg/util/sets"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 const (
@@ -30,38 +33,223 @@ const (
 	SnapshotOperationAlreadyExistsFmt = "an operation with the given Snapshot ID %s already exists"
 )
 
+// volumeLocksShards is the number of shards the VolumeLocks are split into.
+// Volume IDs are distributed over the shards by their hash, so that
+// operations on different volumes rarely contend on the same mutex.
+const volumeLocksShards = 32
+
+// kinds of VolumeLocks, used as label for the metrics.
+const (
+	volumeLocksKind         = "volume"
+	snapshotLocksKind       = "snapshot"
+	snapshotSourceLocksKind = "snapshot_source"
+	counterLocksKind        = "counter"
+)
+
+var (
+	// volumeLocksContention counts the attempts to acquire a lock on a
+	// volume ID that already has an ongoing operation, only for the locks of
+	// the volume kind. It is deprecated in favour of locksContention.
+	volumeLocksContention = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "csi",
+		Name:      "volume_locks_contention_total",
+		Help: "Number of failed attempts to lock a volume ID that has an ongoing operation " +
+			"(deprecated, use csi_locks_contention_total)",
+	})
+	locksContention = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Name:      "locks_contention_total",
+			Help:      "Number of attempts to lock an ID that has an ongoing operation, by kind of ID",
+		},
+		[]string{"kind"},
+	)
+	locksWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "csi",
+			Name:      "locks_acquire_wait_seconds",
+			Help:      "Time spent waiting to take a lock on an ID, by kind of ID",
+			// 1µs up to ~18m, Acquire waits until the lock is released
+			Buckets: prometheus.ExponentialBuckets(0.000001, 4, 16),
+		},
+		[]string{"kind"},
+	)
+	locksHeld = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "csi",
+			Name:      "locks_held_seconds",
+			Help:      "Time a lock on an ID was held by an operation, by kind of ID",
+			// 5ms up to ~160s
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 16),
+		},
+		[]string{"kind"},
+	)
+	locksHolders = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Name:      "locks_holders",
+			Help:      "Number of IDs that are currently locked by an operation, by kind of ID",
+		},
+		[]string{"kind"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(volumeLocksContention, locksContention, locksWait, locksHeld, locksHolders)
+}
+
+// volumeLock is a lock on a volume ID that is held by an operation.
+type volumeLock struct {
+	// acquired is the time the lock was acquired
+	acquired time.Time
+	// released is closed when the lock is released, it is only created
+	// when another operation waits for the lock
+	released chan struct{}
+}
+
+// volumeLocksShard is a part of the VolumeLocks, holding the locks on the
+// volume IDs that hash to it.
+type volumeLocksShard struct {
+	locks map[string]*volumeLock
+	mux   sync.Mutex
+}
+
 // VolumeLocks implements a map with atomic operations. It stores a set of all volume IDs
 // with an ongoing operation.
 type VolumeLocks struct {
-	locks sets.String
-	mux   sync.Mutex
+	shards [volumeLocksShards]volumeLocksShard
+
+	// kind is used as label for the metrics
+	kind string
 }
 
 // NewVolumeLocks returns new VolumeLocks.
 func NewVolumeLocks() *VolumeLocks {
-	return &VolumeLocks{
-		locks: sets.NewString(),
+	return newVolumeLocks(volumeLocksKind)
+}
+
+// NewSnapshotLocks returns new VolumeLocks for locking snapshot IDs, these
+// are reported separately in the metrics.
+func NewSnapshotLocks() *VolumeLocks {
+	return newVolumeLocks(snapshotLocksKind)
+}
+
+// NewSnapshotSourceLocks returns new VolumeLocks for locking the source
+// volume IDs of snapshots that are being created.
+func NewSnapshotSourceLocks() *VolumeLocks {
+	return newVolumeLocks(snapshotSourceLocksKind)
+}
+
+// NewCounterLocks returns new VolumeLocks for locking the keys of counters
+// that are being updated.
+func NewCounterLocks() *VolumeLocks {
+	return newVolumeLocks(counterLocksKind)
+}
+
+func newVolumeLocks(kind string) *VolumeLocks {
+	vl := &VolumeLocks{kind: kind}
+	for i := range vl.shards {
+		vl.shards[i].locks = make(map[string]*volumeLock)
 	}
+
+	return vl
+}
+
+// getShard returns the shard that holds the lock for volumeID.
+func (vl *VolumeLocks) getShard(volumeID string) *volumeLocksShard {
+	h := fnv.New32a()
+	// writing to a hash.Hash never returns an error
+	_, _ = h.Write([]byte(volumeID))
+
+	return &vl.shards[h.Sum32()%volumeLocksShards]
 }
 
 // TryAcquire tries to acquire the lock for operating on volumeID and returns true if successful.
-// If another operation is already using volumeID, returns false.
+// If another operation is already using volumeID, returns false. It does not
+// wait for the release of the lock, only for checking it.
 func (vl *VolumeLocks) TryAcquire(volumeID string) bool {
-	vl.mux.Lock()
-	defer vl.mux.Unlock()
-	if vl.locks.Has(volumeID) {
+	shard := vl.getShard(volumeID)
+	start := time.Now()
+	shard.mux.Lock()
+	defer shard.mux.Unlock()
+	locksWait.WithLabelValues(vl.kind).Observe(time.Since(start).Seconds())
+	if _, ok := shard.locks[volumeID]; ok {
+		vl.contended()
+
 		return false
 	}
-	vl.locks.Insert(volumeID)
+	vl.take(shard, volumeID)
 
 	return true
 }
 
+// Acquire waits until the lock for operating on volumeID is acquired and
+// returns true. It returns false when the context is done before the other
+// operation on volumeID releases the lock. Waiting for a lock is counted as
+// a single contention, however often the lock is passed to other waiters.
+func (vl *VolumeLocks) Acquire(ctx context.Context, volumeID string) bool {
+	shard := vl.getShard(volumeID)
+	start := time.Now()
+	defer func() {
+		locksWait.WithLabelValues(vl.kind).Observe(time.Since(start).Seconds())
+	}()
+	contended := false
+	for {
+		shard.mux.Lock()
+		lock, ok := shard.locks[volumeID]
+		if !ok {
+			vl.take(shard, volumeID)
+			shard.mux.Unlock()
+
+			return true
+		}
+		if !contended {
+			vl.contended()
+			contended = true
+		}
+		if lock.released == nil {
+			lock.released = make(chan struct{})
+		}
+		released := lock.released
+		shard.mux.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-released:
+		}
+	}
+}
+
+// take locks volumeID, the shard needs to be locked by the caller.
+func (vl *VolumeLocks) take(shard *volumeLocksShard, volumeID string) {
+	shard.locks[volumeID] = &volumeLock{acquired: time.Now()}
+	locksHolders.WithLabelValues(vl.kind).Inc()
+}
+
+// contended counts an attempt to lock an ID that has an ongoing operation.
+func (vl *VolumeLocks) contended() {
+	if vl.kind == volumeLocksKind {
+		volumeLocksContention.Inc()
+	}
+	locksContention.WithLabelValues(vl.kind).Inc()
+}
+
 // Release deletes the lock on volumeID.
 func (vl *VolumeLocks) Release(volumeID string) {
-	vl.mux.Lock()
-	defer vl.mux.Unlock()
-	vl.locks.Delete(volumeID)
+	shard := vl.getShard(volumeID)
+	shard.mux.Lock()
+	defer shard.mux.Unlock()
+	lock, ok := shard.locks[volumeID]
+	if !ok {
+		return
+	}
+	delete(shard.locks, volumeID)
+	if lock.released != nil {
+		close(lock.released)
+	}
+	locksHeld.WithLabelValues(vl.kind).Observe(time.Since(lock.acquired).Seconds())
+	locksHolders.WithLabelValues(vl.kind).Dec()
 }
 
 type operation string
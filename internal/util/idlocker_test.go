@@ -17,7 +17,16 @@ limitations under the License.
 package util
 
 import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 // very basic tests for the moment.
@@ -52,6 +61,153 @@ func TestIDLocker(t *testing.T) {
 	}
 }
 
+func TestSnapshotLocksMetrics(t *testing.T) {
+	t.Parallel()
+	// the snapshot kind is not used in other tests, so that the metrics
+	// are not changed concurrently
+	locks := NewSnapshotLocks()
+	holders := locksHolders.WithLabelValues(snapshotLocksKind)
+	contention := locksContention.WithLabelValues(snapshotLocksKind)
+
+	if !locks.TryAcquire("snap-1") || !locks.TryAcquire("snap-2") {
+		t.Fatal("TryAcquire failed for unlocked snapshot IDs")
+	}
+	if got := testutil.ToFloat64(holders); got != 2 {
+		t.Errorf("holders = %v, want 2", got)
+	}
+
+	if locks.TryAcquire("snap-1") {
+		t.Error("TryAcquire succeeded for a locked snapshot ID")
+	}
+	if got := testutil.ToFloat64(contention); got != 1 {
+		t.Errorf("contention = %v, want 1", got)
+	}
+
+	locks.Release("snap-1")
+	locks.Release("snap-2")
+	// releasing an ID that is not locked does not change the holders
+	locks.Release("snap-3")
+	if got := testutil.ToFloat64(holders); got != 0 {
+		t.Errorf("holders after release = %v, want 0", got)
+	}
+}
+
+func TestVolumeLocksConcurrent(t *testing.T) {
+	t.Parallel()
+	locks := NewVolumeLocks()
+	const workers = 64
+
+	// every worker locks its own volume ID, all of them should succeed
+	var wg sync.WaitGroup
+	var acquired int32
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if locks.TryAcquire(fmt.Sprintf("vol-%d", i)) {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if acquired != workers {
+		t.Errorf("TryAcquire of distinct IDs failed: want (%d), got (%d)", workers, acquired)
+	}
+
+	// all workers lock the same volume ID, only one of them should succeed
+	acquired = 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if locks.TryAcquire("shared-vol") {
+				atomic.AddInt32(&acquired, 1)
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired != 1 {
+		t.Errorf("TryAcquire of the same ID failed: want (%d), got (%d)", 1, acquired)
+	}
+
+	for i := 0; i < workers; i++ {
+		locks.Release(fmt.Sprintf("vol-%d", i))
+	}
+	if !locks.TryAcquire("vol-0") {
+		t.Errorf("TryAcquire after Release failed: want (%v), got (%v)", true, false)
+	}
+}
+
+func TestVolumeLocksAcquire(t *testing.T) {
+	t.Parallel()
+	// the counter kind is not used in other tests, so that the metrics are
+	// not changed concurrently
+	locks := NewCounterLocks()
+	contention := locksContention.WithLabelValues(counterLocksKind)
+	base := testutil.ToFloat64(contention)
+	const volumeID = "vol-1"
+
+	if !locks.Acquire(context.TODO(), volumeID) {
+		t.Fatalf("Acquire of unlocked ID failed: want (%v), got (%v)", true, false)
+	}
+
+	// the lock is held, Acquire gives up once the context is done, the
+	// whole time it waited is observed
+	wait := &dto.Metric{}
+	histogram, ok := locksWait.WithLabelValues(counterLocksKind).(prometheus.Metric)
+	if !ok {
+		t.Fatal("locksWait does not return a metric")
+	}
+	if err := histogram.Write(wait); err != nil {
+		t.Fatal(err)
+	}
+	waited := wait.GetHistogram().GetSampleSum()
+	ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond)
+	defer cancel()
+	if locks.Acquire(ctx, volumeID) {
+		t.Errorf("Acquire of locked ID succeeded: want (%v), got (%v)", false, true)
+	}
+	if err := histogram.Write(wait); err != nil {
+		t.Fatal(err)
+	}
+	if got := wait.GetHistogram().GetSampleSum() - waited; got < 0.1 {
+		t.Errorf("wait = %vs, want at least 0.1s", got)
+	}
+	if got := testutil.ToFloat64(contention) - base; got != 1 {
+		t.Errorf("contention = %v, want 1", got)
+	}
+
+	// Acquire waits until the lock is released by the other operation, the
+	// lock is passed on to the next waiter on every release, but each
+	// waiter is counted once
+	const waiters = 8
+	var wg sync.WaitGroup
+	var acquired int32
+	for i := 0; i < waiters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if locks.Acquire(context.TODO(), volumeID) {
+				atomic.AddInt32(&acquired, 1)
+				time.Sleep(time.Millisecond)
+				locks.Release(volumeID)
+			}
+		}()
+	}
+	// release the lock once all waiters are blocked
+	for testutil.ToFloat64(contention)-base < 1+waiters {
+		time.Sleep(time.Millisecond)
+	}
+	locks.Release(volumeID)
+	wg.Wait()
+	if acquired != waiters {
+		t.Errorf("Acquire after Release failed: want (%d), got (%d)", waiters, acquired)
+	}
+	if got := testutil.ToFloat64(contention) - base; got != 1+waiters {
+		t.Errorf("contention = %v, want %d", got, 1+waiters)
+	}
+}
+
 func TestOperationLocks(t *testing.T) {
 	t.Parallel()
 	volumeID := "test-vol"
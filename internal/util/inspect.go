@@ -0,0 +1,124 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// HandleInfo describes the image, snapshot or subvolume of a volume or
+// snapshot handle, as printed by "cephcsi inspect".
+type HandleInfo struct {
+	Handle          string `json:"handle"`
+	EncodingVersion uint16 `json:"encodingVersion"`
+	ClusterID       string `json:"clusterID"`
+	// LocationID is the ID of the pool (RBD) or of the filesystem (CephFS)
+	LocationID     int64  `json:"locationID"`
+	UUID           string `json:"uuid"`
+	Pool           string `json:"pool,omitempty"`
+	RadosNamespace string `json:"radosNamespace,omitempty"`
+	FsName         string `json:"fsName,omitempty"`
+	SubvolumeGroup string `json:"subvolumeGroup,omitempty"`
+	// Name is the name of the image, snapshot or subvolume
+	Name string `json:"name,omitempty"`
+	// Source is the image or subvolume of a snapshot, or the backing
+	// snapshot of a CephFS volume
+	Source      string `json:"source,omitempty"`
+	RequestName string `json:"requestName,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	KmsID       string `json:"kmsID,omitempty"`
+	Encryption  string `json:"encryption,omitempty"`
+	Mirroring   string `json:"mirroring,omitempty"`
+	// JournalLess is set for RBD volumes that are not in the journal
+	JournalLess bool `json:"journalLess,omitempty"`
+}
+
+// NewHandleInfo returns the HandleInfo with the fields that are encoded in
+// the handle, the other fields are filled in from the journal.
+func NewHandleInfo(handle string) (*HandleInfo, error) {
+	var vi CSIIdentifier
+	err := vi.DecomposeCSIID(handle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode handle %q: %w", handle, err)
+	}
+
+	return &HandleInfo{
+		Handle:          handle,
+		EncodingVersion: vi.EncodingVersion,
+		ClusterID:       vi.ClusterID,
+		LocationID:      vi.LocationID,
+		UUID:            vi.ObjectUUID,
+	}, nil
+}
+
+// Write writes the HandleInfo as "name: value" lines in the text format,
+// or as a JSON object in the json format. Empty fields are left out.
+func (hi *HandleInfo) Write(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		return json.NewEncoder(w).Encode(hi)
+	case "text":
+	default:
+		return fmt.Errorf("invalid output format %q, should be 'text' or 'json'", format)
+	}
+
+	fields := []struct {
+		name  string
+		value string
+	}{
+		{"handle", hi.Handle},
+		{"encoding version", fmt.Sprint(hi.EncodingVersion)},
+		{"cluster ID", hi.ClusterID},
+		{"location ID", fmt.Sprint(hi.LocationID)},
+		{"UUID", hi.UUID},
+		{"pool", hi.Pool},
+		{"RADOS namespace", hi.RadosNamespace},
+		{"filesystem", hi.FsName},
+		{"subvolume group", hi.SubvolumeGroup},
+		{"name", hi.Name},
+		{"source", hi.Source},
+		{"request name", hi.RequestName},
+		{"owner", hi.Owner},
+		{"KMS ID", hi.KmsID},
+		{"encryption", hi.Encryption},
+		{"mirroring", hi.Mirroring},
+		{"journal-less", journalLessField(hi.JournalLess)},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		_, err := fmt.Fprintf(w, "%s: %s\n", f.name, f.value)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// journalLessField returns the text of the journal-less field, which is
+// left out for volumes in the journal.
+func journalLessField(journalLess bool) string {
+	if !journalLess {
+		return ""
+	}
+
+	return "true"
+}
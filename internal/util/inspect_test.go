@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+)
+
+const testHandle = "ffff-0024-01616094-9d93-4178-bf45-c7eac19e8b15-000000000000ffff-00000000-1111-2222-bbbb-cacacacacaca"
+
+func TestNewHandleInfo(t *testing.T) {
+	t.Parallel()
+
+	hi, err := NewHandleInfo(testHandle)
+	if err != nil {
+		t.Fatalf("NewHandleInfo() error = %v", err)
+	}
+	if hi.ClusterID != "01616094-9d93-4178-bf45-c7eac19e8b15" {
+		t.Errorf("ClusterID = %q", hi.ClusterID)
+	}
+	if hi.LocationID != 0xffff {
+		t.Errorf("LocationID = %d, want %d", hi.LocationID, 0xffff)
+	}
+	if hi.UUID != "00000000-1111-2222-bbbb-cacacacacaca" {
+		t.Errorf("UUID = %q", hi.UUID)
+	}
+
+	_, err = NewHandleInfo("pvc-0b4b0b6c-b8e8-4d1e-9c3e-8b6f0bfa0e4b")
+	if err == nil {
+		t.Error("NewHandleInfo() of a handle that is not a CSI ID did not fail")
+	}
+}
+
+func TestHandleInfoWrite(t *testing.T) {
+	t.Parallel()
+
+	hi := &HandleInfo{
+		Handle:          testHandle,
+		EncodingVersion: 1,
+		ClusterID:       "cluster-1",
+		LocationID:      3,
+		UUID:            "00000000-1111-2222-bbbb-cacacacacaca",
+		Pool:            "replicapool",
+		Name:            "csi-vol-00000000-1111-2222-bbbb-cacacacacaca",
+		JournalLess:     true,
+	}
+
+	var text bytes.Buffer
+	err := hi.Write(&text, "text")
+	if err != nil {
+		t.Fatalf("Write(text) error = %v", err)
+	}
+	want := "handle: " + testHandle + "\n" +
+		"encoding version: 1\n" +
+		"cluster ID: cluster-1\n" +
+		"location ID: 3\n" +
+		"UUID: 00000000-1111-2222-bbbb-cacacacacaca\n" +
+		"pool: replicapool\n" +
+		"name: csi-vol-00000000-1111-2222-bbbb-cacacacacaca\n" +
+		"journal-less: true\n"
+	if text.String() != want {
+		t.Errorf("Write(text) = %q, want %q", text.String(), want)
+	}
+
+	var out bytes.Buffer
+	err = hi.Write(&out, "json")
+	if err != nil {
+		t.Fatalf("Write(json) error = %v", err)
+	}
+	decoded := &HandleInfo{}
+	err = json.Unmarshal(out.Bytes(), decoded)
+	if err != nil {
+		t.Fatalf("failed to decode %q: %v", out.String(), err)
+	}
+	if *decoded != *hi {
+		t.Errorf("Write(json) = %+v, want %+v", decoded, hi)
+	}
+
+	err = hi.Write(&out, "yaml")
+	if err == nil {
+		t.Error("Write(yaml) did not fail")
+	}
+}
@@ -19,7 +19,9 @@ package k8s
 import (
 	"fmt"
 	"os"
+	"sync"
 
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -27,24 +29,73 @@ import (
 
 // NewK8sClient create kubernetes client.
 func NewK8sClient() (*kubernetes.Clientset, error) {
-	var cfg *rest.Config
-	var err error
+	cfg, err := clusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client: %w", err)
+	}
+
+	return client, nil
+}
+
+// NewDynamicClient creates a kubernetes client for resources without typed
+// clients, like the CRDs of other projects.
+func NewDynamicClient() (dynamic.Interface, error) {
+	cfg, err := clusterConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := dynamic.NewForConfig(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	return client, nil
+}
+
+var (
+	sharedDynamicClientLock sync.Mutex
+	sharedDynamicClient     dynamic.Interface
+)
+
+// getSharedDynamicClient returns a dynamic client that is created on the
+// first call and shared by the later calls, creating it is retried when it
+// failed.
+func getSharedDynamicClient() (dynamic.Interface, error) {
+	sharedDynamicClientLock.Lock()
+	defer sharedDynamicClientLock.Unlock()
+
+	if sharedDynamicClient != nil {
+		return sharedDynamicClient, nil
+	}
+	client, err := NewDynamicClient()
+	if err != nil {
+		return nil, err
+	}
+	sharedDynamicClient = client
+
+	return client, nil
+}
+
+// clusterConfig returns the configuration to connect to the cluster, from the
+// kubeconfig in KUBERNETES_CONFIG_PATH, or the in-cluster configuration.
+func clusterConfig() (*rest.Config, error) {
 	cPath := os.Getenv("KUBERNETES_CONFIG_PATH")
 	if cPath != "" {
-		cfg, err = clientcmd.BuildConfigFromFlags("", cPath)
+		cfg, err := clientcmd.BuildConfigFromFlags("", cPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get cluster config from %q: %w", cPath, err)
 		}
-	} else {
-		cfg, err = rest.InClusterConfig()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get cluster config: %w", err)
-		}
+
+		return cfg, nil
 	}
-	client, err := kubernetes.NewForConfig(cfg)
+	cfg, err := rest.InClusterConfig()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create client: %w", err)
+		return nil, fmt.Errorf("failed to get cluster config: %w", err)
 	}
 
-	return client, nil
+	return cfg, nil
 }
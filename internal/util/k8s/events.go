@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Reasons of the Events that the driver emits for actionable failures.
+const (
+	// ReasonPoolFull is used when the Ceph pool has no space left.
+	ReasonPoolFull = "PoolFull"
+	// ReasonQuotaExceeded is used when a Ceph quota does not allow the
+	// operation.
+	ReasonQuotaExceeded = "QuotaExceeded"
+	// ReasonKMSUnreachable is used when the KMS for encryption can not be
+	// reached.
+	ReasonKMSUnreachable = "KMSUnreachable"
+	// ReasonClonePending is used when a volume can not be provisioned yet,
+	// because cloning (or flattening) of the source is still in progress.
+	ReasonClonePending = "ClonePending"
+	// ReasonMountFailed is used when the Ceph client on the node can not
+	// mount a volume, like for missing permissions of the Ceph user.
+	ReasonMountFailed = "MountFailed"
+)
+
+// EventRecorder emits Kubernetes Events about objects that the driver does
+// not own, like PersistentVolumeClaims and Pods. A nil *EventRecorder is valid
+// and does not emit any Events.
+type EventRecorder struct {
+	recorder record.EventRecorder
+}
+
+// NewEventRecorder returns an EventRecorder that emits Events with the
+// component as source.
+func NewEventRecorder(component string) (*EventRecorder, error) {
+	client, err := NewK8sClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client for emitting events: %w", err)
+	}
+
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+
+	return &EventRecorder{
+		recorder: broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: component}),
+	}, nil
+}
+
+// Warning emits a Warning Event for the object of the kind (like
+// "PersistentVolumeClaim" or "Pod") with the namespace and name. The
+// namespace is empty for cluster scoped objects like Nodes.
+func (er *EventRecorder) Warning(kind, namespace, name, reason, message string) {
+	if er == nil || name == "" || (namespace == "" && kind != "Node") {
+		return
+	}
+
+	ref := &v1.ObjectReference{
+		APIVersion: "v1",
+		Kind:       kind,
+		Namespace:  namespace,
+		Name:       name,
+	}
+	er.recorder.Event(ref, v1.EventTypeWarning, reason, message)
+}
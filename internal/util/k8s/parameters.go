@@ -16,6 +16,8 @@ limitations under the License.
 package k8s
 
 import (
+	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -30,12 +32,21 @@ const (
 	pvcNamespaceKey = csiParameterPrefix + "pvc/namespace"
 	pvNameKey       = csiParameterPrefix + "pv/name"
 
+	// Pod metadata keys passed in the volume context of NodePublishVolume
+	// requests, when podInfoOnMount is set for the CSIDriver.
+	podNameKey      = csiParameterPrefix + "pod.name"
+	podNamespaceKey = csiParameterPrefix + "pod.namespace"
+
 	// snapshot metadata keys.
 	volSnapNameKey        = csiParameterPrefix + "volumesnapshot/name"
 	volSnapNamespaceKey   = csiParameterPrefix + "volumesnapshot/namespace"
 	volSnapContentNameKey = csiParameterPrefix + "volumesnapshotcontent/name"
 )
 
+// VolumeSnapshotNameKey is the key of the metadata of a snapshot that contains
+// the name of its VolumeSnapshot.
+const VolumeSnapshotNameKey = volSnapNameKey
+
 // RemoveCSIPrefixedParameters removes parameters prefixed with csiParameterPrefix.
 func RemoveCSIPrefixedParameters(param map[string]string) map[string]string {
 	newParam := map[string]string{}
@@ -54,6 +65,16 @@ func GetOwner(param map[string]string) string {
 	return param[pvcNamespaceKey]
 }
 
+// GetPVC returns the namespace and name of the PVC from the parameters.
+func GetPVC(param map[string]string) (string, string) {
+	return param[pvcNamespaceKey], param[pvcNameKey]
+}
+
+// GetPod returns the namespace and name of the Pod from the volume context.
+func GetPod(volCtx map[string]string) (string, string) {
+	return volCtx[podNamespaceKey], volCtx[podNameKey]
+}
+
 // GetVolumeMetadata filter parameters, only return PV/PVC/PVCNamespace metadata.
 func GetVolumeMetadata(parameters map[string]string) map[string]string {
 	keys := []string{pvcNameKey, pvcNamespaceKey, pvNameKey}
@@ -116,5 +137,40 @@ func GetSnapshotMetadataKeys() []string {
 		volSnapNameKey,
 		volSnapNamespaceKey,
 		volSnapContentNameKey,
+		SnapshotExpiryMetadataKey,
 	}
 }
+
+// CheckParameters returns an error when the parameters contain keys that are
+// not accepted, like misspelled ones. The error names the unknown keys and
+// lists the accepted keys. Parameters prefixed with csiParameterPrefix are
+// set by the sidecars, and are not checked.
+func CheckParameters(param map[string]string, accepted []string) error {
+	unknown := []string{}
+	for k := range param {
+		if strings.HasPrefix(k, csiParameterPrefix) {
+			continue
+		}
+		found := false
+		for _, key := range accepted {
+			if k == key {
+				found = true
+
+				break
+			}
+		}
+		if !found {
+			unknown = append(unknown, k)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	keys := append([]string{}, accepted...)
+	sort.Strings(keys)
+
+	return fmt.Errorf("unknown parameters %s, accepted parameters are %s",
+		strings.Join(unknown, ", "), strings.Join(keys, ", "))
+}
@@ -93,3 +93,51 @@ func TestGetOwner(t *testing.T) {
 		})
 	}
 }
+
+func TestCheckParameters(t *testing.T) {
+	t.Parallel()
+	accepted := []string{"pool", "clusterID"}
+	tests := []struct {
+		name    string
+		param   map[string]string
+		wantErr string
+	}{
+		{
+			name: "accepted parameters",
+			param: map[string]string{
+				"clusterID": "foo",
+				"pool":      "bar",
+			},
+		},
+		{
+			name: "with csi.storage.k8s.io prefix",
+			param: map[string]string{
+				"pool":                             "bar",
+				"csi.storage.k8s.io/pvc/namespace": "bar",
+				"csi.storage.k8s.io/fstype":        "ext4",
+			},
+		},
+		{
+			name: "misspelled parameters",
+			param: map[string]string{
+				"pool":      "bar",
+				"clusterId": "foo",
+				"Pool":      "baz",
+			},
+			wantErr: "unknown parameters Pool, clusterId, accepted parameters are clusterID, pool",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckParameters(ts.param, accepted)
+			if ts.wantErr == "" && err != nil {
+				t.Errorf("CheckParameters() error = %v", err)
+			}
+			if ts.wantErr != "" && (err == nil || err.Error() != ts.wantErr) {
+				t.Errorf("CheckParameters() error = %v, want %s", err, ts.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// ErrNoReferenceGrant is returned when no ReferenceGrant allows PVCs to use a
+// VolumeSnapshot of another namespace as data source.
+var ErrNoReferenceGrant = errors.New("no ReferenceGrant allows the data source")
+
+// ErrNoPVCMetadata is returned when the data source of a PVC can not be
+// checked, as the csi-provisioner does not pass the metadata of the PVC.
+var ErrNoPVCMetadata = errors.New("the PVC metadata is missing, the csi-provisioner needs --extra-create-metadata")
+
+// referenceGrantsResource is the resource of the ReferenceGrants of the
+// Gateway API, that the CrossNamespaceVolumeDataSource feature uses.
+var referenceGrantsResource = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1beta1",
+	Resource: "referencegrants",
+}
+
+// pvcResource is the resource of PVCs, which are read with the dynamic client
+// as the namespace of their dataSourceRef is not in the vendored API.
+var pvcResource = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "persistentvolumeclaims",
+}
+
+// referenceGrant is the part of a ReferenceGrant that is needed to validate
+// data sources.
+type referenceGrant struct {
+	Spec struct {
+		From []struct {
+			Group     string `json:"group"`
+			Kind      string `json:"kind"`
+			Namespace string `json:"namespace"`
+		} `json:"from"`
+		To []struct {
+			Group string  `json:"group"`
+			Kind  string  `json:"kind"`
+			Name  *string `json:"name,omitempty"`
+		} `json:"to"`
+	} `json:"spec"`
+}
+
+// CheckDataSourceReferenceGrant checks that a ReferenceGrant allows the PVC
+// of the CreateVolume parameters to use its data source, when the PVC has a
+// dataSourceRef in another namespace (the CrossNamespaceVolumeDataSource
+// feature). Other PVCs are not checked, like PVCs that restore a snapshot of
+// another namespace through a pre-provisioned VolumeSnapshotContent. The PVC
+// is only known when the csi-provisioner runs with --extra-create-metadata,
+// ErrNoPVCMetadata is returned without the metadata of the PVC.
+func CheckDataSourceReferenceGrant(ctx context.Context, parameters map[string]string) error {
+	pvcNamespace, pvcName := GetPVC(parameters)
+	if pvcNamespace == "" || pvcName == "" {
+		return ErrNoPVCMetadata
+	}
+	c, err := getSharedDynamicClient()
+	if err != nil {
+		return err
+	}
+	pvc, err := c.Resource(pvcResource).Namespace(pvcNamespace).Get(ctx, pvcName, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get PersistentVolumeClaim %s/%s: %w", pvcNamespace, pvcName, err)
+	}
+	namespace, name, ok := crossNamespaceDataSource(pvc)
+	if !ok {
+		return nil
+	}
+
+	return checkReferenceGrant(ctx, pvcNamespace, namespace, name)
+}
+
+// crossNamespaceDataSource returns the namespace and name of the
+// dataSourceRef of the PVC, when it is a VolumeSnapshot in another namespace.
+func crossNamespaceDataSource(pvc *unstructured.Unstructured) (string, string, bool) {
+	ref, ok, err := unstructured.NestedStringMap(pvc.Object, "spec", "dataSourceRef")
+	if err != nil || !ok {
+		return "", "", false
+	}
+	namespace := ref["namespace"]
+	if namespace == "" || namespace == pvc.GetNamespace() ||
+		ref["apiGroup"] != "snapshot.storage.k8s.io" || ref["kind"] != "VolumeSnapshot" {
+		return "", "", false
+	}
+
+	return namespace, ref["name"], true
+}
+
+// checkReferenceGrant checks that a ReferenceGrant in the namespace of the
+// VolumeSnapshot allows PVCs of the namespace to use the VolumeSnapshot as
+// data source. Without the ReferenceGrant CRD, no ReferenceGrant allows it.
+func checkReferenceGrant(ctx context.Context, pvcNamespace, snapshotNamespace, snapshotName string) error {
+	c, err := getSharedDynamicClient()
+	if err != nil {
+		return err
+	}
+	list, err := c.Resource(referenceGrantsResource).Namespace(snapshotNamespace).List(ctx, metav1.ListOptions{})
+	if apierrors.IsNotFound(err) {
+		return fmt.Errorf("%w: the ReferenceGrant CRD is not installed", ErrNoReferenceGrant)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to list ReferenceGrants in namespace %s: %w", snapshotNamespace, err)
+	}
+
+	grants := make([]referenceGrant, 0, len(list.Items))
+	for i := range list.Items {
+		grant := referenceGrant{}
+		err = runtime.DefaultUnstructuredConverter.FromUnstructured(list.Items[i].Object, &grant)
+		if err != nil {
+			return fmt.Errorf("failed to parse ReferenceGrant %s/%s: %w",
+				snapshotNamespace, list.Items[i].GetName(), err)
+		}
+		grants = append(grants, grant)
+	}
+	if !grantsAllow(grants, pvcNamespace, snapshotName) {
+		return fmt.Errorf("%w: PVCs in namespace %s can not use VolumeSnapshot %q in namespace %s",
+			ErrNoReferenceGrant, pvcNamespace, snapshotName, snapshotNamespace)
+	}
+
+	return nil
+}
+
+// grantsAllow returns whether one of the ReferenceGrants allows PVCs of the
+// namespace to use the VolumeSnapshot as data source.
+func grantsAllow(grants []referenceGrant, pvcNamespace, snapshotName string) bool {
+	for i := range grants {
+		from := false
+		for _, f := range grants[i].Spec.From {
+			if f.Group == "" && f.Kind == "PersistentVolumeClaim" && f.Namespace == pvcNamespace {
+				from = true
+
+				break
+			}
+		}
+		if !from {
+			continue
+		}
+		for _, t := range grants[i].Spec.To {
+			if t.Group != "snapshot.storage.k8s.io" || t.Kind != "VolumeSnapshot" {
+				continue
+			}
+			if t.Name == nil || *t.Name == "" || *t.Name == snapshotName {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,226 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGrantsAllow(t *testing.T) {
+	t.Parallel()
+	grant := func(spec string) referenceGrant {
+		t.Helper()
+
+		g := referenceGrant{}
+		err := json.Unmarshal([]byte(`{"spec": `+spec+`}`), &g)
+		if err != nil {
+			t.Fatalf("invalid ReferenceGrant %s: %v", spec, err)
+		}
+
+		return g
+	}
+	anySnapshot := grant(`{
+		"from": [{"group": "", "kind": "PersistentVolumeClaim", "namespace": "restore"}],
+		"to": [{"group": "snapshot.storage.k8s.io", "kind": "VolumeSnapshot"}]
+	}`)
+	namedSnapshot := grant(`{
+		"from": [{"group": "", "kind": "PersistentVolumeClaim", "namespace": "restore"}],
+		"to": [{"group": "snapshot.storage.k8s.io", "kind": "VolumeSnapshot", "name": "backup"}]
+	}`)
+	otherKind := grant(`{
+		"from": [{"group": "", "kind": "PersistentVolumeClaim", "namespace": "restore"}],
+		"to": [{"group": "", "kind": "PersistentVolumeClaim"}]
+	}`)
+	gateway := grant(`{
+		"from": [{"group": "gateway.networking.k8s.io", "kind": "HTTPRoute", "namespace": "restore"}],
+		"to": [{"group": "snapshot.storage.k8s.io", "kind": "VolumeSnapshot"}]
+	}`)
+
+	tests := []struct {
+		name         string
+		grants       []referenceGrant
+		pvcNamespace string
+		snapshotName string
+		want         bool
+	}{
+		{
+			name:         "no grants",
+			grants:       nil,
+			pvcNamespace: "restore",
+			snapshotName: "backup",
+			want:         false,
+		},
+		{
+			name:         "any snapshot",
+			grants:       []referenceGrant{anySnapshot},
+			pvcNamespace: "restore",
+			snapshotName: "backup",
+			want:         true,
+		},
+		{
+			name:         "other namespace",
+			grants:       []referenceGrant{anySnapshot},
+			pvcNamespace: "other",
+			snapshotName: "backup",
+			want:         false,
+		},
+		{
+			name:         "named snapshot",
+			grants:       []referenceGrant{namedSnapshot},
+			pvcNamespace: "restore",
+			snapshotName: "backup",
+			want:         true,
+		},
+		{
+			name:         "other snapshot",
+			grants:       []referenceGrant{namedSnapshot},
+			pvcNamespace: "restore",
+			snapshotName: "other",
+			want:         false,
+		},
+		{
+			name:         "other kinds",
+			grants:       []referenceGrant{otherKind, gateway},
+			pvcNamespace: "restore",
+			snapshotName: "backup",
+			want:         false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := grantsAllow(ts.grants, ts.pvcNamespace, ts.snapshotName); got != ts.want {
+				t.Errorf("grantsAllow() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCrossNamespaceDataSource(t *testing.T) {
+	t.Parallel()
+	pvc := func(dataSourceRef map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{
+			"metadata": map[string]interface{}{"namespace": "restore", "name": "restored"},
+			"spec":     map[string]interface{}{},
+		}}
+		if dataSourceRef != nil {
+			obj.Object["spec"].(map[string]interface{})["dataSourceRef"] = dataSourceRef
+		}
+
+		return obj
+	}
+	snapshotRef := func(namespace string) map[string]interface{} {
+		ref := map[string]interface{}{
+			"apiGroup": "snapshot.storage.k8s.io",
+			"kind":     "VolumeSnapshot",
+			"name":     "backup",
+		}
+		if namespace != "" {
+			ref["namespace"] = namespace
+		}
+
+		return ref
+	}
+
+	tests := []struct {
+		name      string
+		pvc       *unstructured.Unstructured
+		namespace string
+		ok        bool
+	}{
+		{
+			name: "no dataSourceRef",
+			pvc:  pvc(nil),
+			ok:   false,
+		},
+		{
+			name: "VolumeSnapshot of the namespace",
+			pvc:  pvc(snapshotRef("")),
+			ok:   false,
+		},
+		{
+			name: "VolumeSnapshot with the namespace of the PVC",
+			pvc:  pvc(snapshotRef("restore")),
+			ok:   false,
+		},
+		{
+			name:      "VolumeSnapshot of another namespace",
+			pvc:       pvc(snapshotRef("backups")),
+			namespace: "backups",
+			ok:        true,
+		},
+		{
+			name: "PVC of another namespace",
+			pvc: pvc(map[string]interface{}{
+				"kind":      "PersistentVolumeClaim",
+				"name":      "data",
+				"namespace": "backups",
+			}),
+			ok: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			namespace, name, ok := crossNamespaceDataSource(ts.pvc)
+			if ok != ts.ok || namespace != ts.namespace {
+				t.Errorf("crossNamespaceDataSource() = %q, %q, %v, want %q, %v", namespace, name, ok, ts.namespace, ts.ok)
+			}
+			if ok && name != "backup" {
+				t.Errorf("crossNamespaceDataSource() name = %q, want backup", name)
+			}
+		})
+	}
+}
+
+func TestCheckDataSourceReferenceGrantWithoutMetadata(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+	}{
+		{
+			name:       "no metadata",
+			parameters: map[string]string{"pool": "replicapool"},
+		},
+		{
+			name:       "no PVC name",
+			parameters: map[string]string{pvcNamespaceKey: "restore"},
+		},
+		{
+			name:       "no PVC namespace",
+			parameters: map[string]string{pvcNameKey: "restored"},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckDataSourceReferenceGrant(context.TODO(), ts.parameters)
+			if !errors.Is(err, ErrNoPVCMetadata) {
+				t.Errorf("CheckDataSourceReferenceGrant() error = %v, want %v", err, ErrNoPVCMetadata)
+			}
+		})
+	}
+}
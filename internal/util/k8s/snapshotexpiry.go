@@ -0,0 +1,76 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// SnapshotRetentionKey is the parameter of a VolumeSnapshotClass with
+	// the duration after which its snapshots expire.
+	SnapshotRetentionKey = "snapshotRetention"
+
+	// SnapshotExpiryMetadataKey is the metadata key of a snapshot with the
+	// time at which it expires, in RFC 3339 format.
+	SnapshotExpiryMetadataKey = "csi.ceph.com/expires-at"
+)
+
+// GetSnapshotRetention returns the retention of snapshots in the parameters,
+// 0 is returned when the parameters have no retention.
+func GetSnapshotRetention(param map[string]string) (time.Duration, error) {
+	val, ok := param[SnapshotRetentionKey]
+	if !ok {
+		return 0, nil
+	}
+
+	retention, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse %s %q: %w", SnapshotRetentionKey, val, err)
+	}
+	if retention <= 0 {
+		return 0, fmt.Errorf("%s %q needs to be a positive duration", SnapshotRetentionKey, val)
+	}
+
+	return retention, nil
+}
+
+// AddSnapshotExpiryMetadata adds the time at which the snapshot that was
+// created at the time expires to the metadata that is set on the snapshot,
+// if the parameters have a valid retention.
+func AddSnapshotExpiryMetadata(
+	metadata, param map[string]string,
+	created time.Time,
+) map[string]string {
+	if retention, err := GetSnapshotRetention(param); err == nil && retention > 0 {
+		metadata[SnapshotExpiryMetadataKey] = created.Add(retention).UTC().Format(time.RFC3339)
+	}
+
+	return metadata
+}
+
+// ParseSnapshotExpiry parses the value of the SnapshotExpiryMetadataKey
+// metadata of a snapshot.
+func ParseSnapshotExpiry(value string) (time.Time, error) {
+	expiry, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse %s %q: %w", SnapshotExpiryMetadataKey, value, err)
+	}
+
+	return expiry, nil
+}
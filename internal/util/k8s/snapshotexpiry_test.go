@@ -0,0 +1,117 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetSnapshotRetention(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		param   map[string]string
+		want    time.Duration
+		wantErr bool
+	}{
+		{
+			name:  "no retention",
+			param: map[string]string{"clusterID": "foo"},
+			want:  0,
+		},
+		{
+			name:  "retention",
+			param: map[string]string{SnapshotRetentionKey: "720h"},
+			want:  720 * time.Hour,
+		},
+		{
+			name:    "invalid retention",
+			param:   map[string]string{SnapshotRetentionKey: "30d"},
+			wantErr: true,
+		},
+		{
+			name:    "negative retention",
+			param:   map[string]string{SnapshotRetentionKey: "-1h"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetSnapshotRetention(ts.param)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("GetSnapshotRetention() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("GetSnapshotRetention() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestAddSnapshotExpiryMetadata(t *testing.T) {
+	t.Parallel()
+	created := time.Date(2022, time.March, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		param map[string]string
+		want  map[string]string
+	}{
+		{
+			name:  "no retention",
+			param: map[string]string{},
+			want:  map[string]string{"foo": "bar"},
+		},
+		{
+			name:  "retention",
+			param: map[string]string{SnapshotRetentionKey: "36h"},
+			want: map[string]string{
+				"foo":                     "bar",
+				"csi.ceph.com/expires-at": "2022-03-03T00:00:00Z",
+			},
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got := AddSnapshotExpiryMetadata(map[string]string{"foo": "bar"}, ts.param, created)
+			if !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("AddSnapshotExpiryMetadata() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestParseSnapshotExpiry(t *testing.T) {
+	t.Parallel()
+
+	got, err := ParseSnapshotExpiry("2022-03-03T00:00:00Z")
+	if err != nil {
+		t.Fatalf("ParseSnapshotExpiry() failed: %v", err)
+	}
+	if want := time.Date(2022, time.March, 3, 0, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("ParseSnapshotExpiry() = %v, want %v", got, want)
+	}
+
+	if _, err = ParseSnapshotExpiry("720h"); err == nil {
+		t.Error("ParseSnapshotExpiry() of a duration succeeded")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// PoolReference is a pool of a cluster that a StorageClass provisions volumes
+// in. CephFS StorageClasses without a pool parameter have the FsName set and
+// an empty Pool, their volumes are in the default data pool of the
+// filesystem.
+type PoolReference struct {
+	ClusterID string
+	Pool      string
+	FsName    string
+}
+
+// StorageClassPools returns the pools that the parameters of a StorageClass
+// refer to, which are the "pool" and "dataPool" parameters and the pools of
+// the "topologyConstrainedPools" parameter.
+func StorageClassPools(parameters map[string]string) ([]PoolReference, error) {
+	clusterID := parameters["clusterID"]
+	if clusterID == "" {
+		return nil, nil
+	}
+
+	var refs []PoolReference
+	add := func(pool string) {
+		if pool != "" {
+			refs = append(refs, PoolReference{ClusterID: clusterID, Pool: pool})
+		}
+	}
+	add(parameters["pool"])
+	add(parameters["dataPool"])
+	if fsName := parameters["fsName"]; fsName != "" && parameters["pool"] == "" {
+		refs = append(refs, PoolReference{ClusterID: clusterID, FsName: fsName})
+	}
+
+	if value := parameters["topologyConstrainedPools"]; value != "" {
+		var pools []struct {
+			PoolName     string `json:"poolName"`
+			DataPoolName string `json:"dataPool"`
+		}
+		err := json.Unmarshal([]byte(value), &pools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse topologyConstrainedPools %q: %w", value, err)
+		}
+		for _, pool := range pools {
+			add(pool.PoolName)
+			add(pool.DataPoolName)
+		}
+	}
+
+	return refs, nil
+}
+
+// ListStorageClassPools returns the pools that the StorageClasses of the
+// provisioner refer to, see StorageClassPools. StorageClasses with invalid
+// parameters are skipped, CreateVolume fails for them anyway.
+func ListStorageClassPools(
+	ctx context.Context,
+	client kubernetes.Interface,
+	provisioner string,
+) ([]PoolReference, error) {
+	scs, err := client.StorageV1().StorageClasses().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list StorageClasses: %w", err)
+	}
+
+	var refs []PoolReference
+	for i := range scs.Items {
+		if scs.Items[i].Provisioner != provisioner {
+			continue
+		}
+		scRefs, err := StorageClassPools(scs.Items[i].Parameters)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, scRefs...)
+	}
+
+	return refs, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package k8s
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStorageClassPools(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		param   map[string]string
+		want    []PoolReference
+		wantErr bool
+	}{
+		{
+			name:  "no clusterID",
+			param: map[string]string{"pool": "replicapool"},
+		},
+		{
+			name:  "rbd pool and data pool",
+			param: map[string]string{"clusterID": "foo", "pool": "replicapool", "dataPool": "ecpool"},
+			want: []PoolReference{
+				{ClusterID: "foo", Pool: "replicapool"},
+				{ClusterID: "foo", Pool: "ecpool"},
+			},
+		},
+		{
+			name: "topology constrained pools",
+			param: map[string]string{
+				"clusterID":                "foo",
+				"topologyConstrainedPools": `[{"poolName":"pool-zone1","dataPool":"ec-zone1"},{"poolName":"pool-zone2"}]`,
+			},
+			want: []PoolReference{
+				{ClusterID: "foo", Pool: "pool-zone1"},
+				{ClusterID: "foo", Pool: "ec-zone1"},
+				{ClusterID: "foo", Pool: "pool-zone2"},
+			},
+		},
+		{
+			name:  "cephfs pool",
+			param: map[string]string{"clusterID": "foo", "fsName": "myfs", "pool": "myfs-replicated"},
+			want:  []PoolReference{{ClusterID: "foo", Pool: "myfs-replicated"}},
+		},
+		{
+			name:  "cephfs default data pool",
+			param: map[string]string{"clusterID": "foo", "fsName": "myfs"},
+			want:  []PoolReference{{ClusterID: "foo", FsName: "myfs"}},
+		},
+		{
+			name:    "invalid topology constrained pools",
+			param:   map[string]string{"clusterID": "foo", "topologyConstrainedPools": "pool-zone1"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := StorageClassPools(ts.param)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("StorageClassPools() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("StorageClassPools() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// leakWatchSamples is the number of consecutive checks in which a resource
+// needs to grow before it is reported as a possible leak.
+const leakWatchSamples = 6
+
+var (
+	leakWatchResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Subsystem: "leakwatch",
+			Name:      "resources",
+			Help:      "Number of go-routines, rados connections and users, and mapped devices of the process",
+		},
+		[]string{"resource"},
+	)
+	leakWatchSuspected = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "csi",
+			Subsystem: "leakwatch",
+			Name:      "suspected",
+			Help:      "Set to 1 when the number of the resource grew on each of the recent checks",
+		},
+		[]string{"resource"},
+	)
+)
+
+// leakWatchResource is a resource that is watched for leaks.
+type leakWatchResource struct {
+	name  string
+	count func() (int, error)
+
+	// baseline is the first count after the start of the watchdog
+	baseline int
+	samples  []int
+}
+
+// StartLeakWatch counts the go-routines, the connections in the rados
+// connection pool and their users, and the mapped RBD devices every interval.
+// The counts are exported as metrics, and a warning is logged when a count
+// grew on each of the last leakWatchSamples checks, which is a strong hint
+// for a leak in a long running process. This function does not return.
+func StartLeakWatch(interval time.Duration) {
+	prometheus.MustRegister(leakWatchResources, leakWatchSuspected)
+
+	resources := []*leakWatchResource{
+		{name: "goroutines", count: countGoroutines},
+		{name: "rados_connections", count: countRadosConnections},
+		{name: "rados_connection_users", count: countRadosConnectionUsers},
+		{name: "mapped_devices", count: countMappedDevices},
+	}
+	for {
+		for _, r := range resources {
+			r.check()
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// check counts the resource and updates the metrics.
+func (r *leakWatchResource) check() {
+	count, err := r.count()
+	if err != nil {
+		log.ErrorLogMsg("failed to count %s for leak detection: %v", r.name, err)
+
+		return
+	}
+
+	if r.samples == nil {
+		r.baseline = count
+	}
+	r.samples = append(r.samples, count)
+	if len(r.samples) > leakWatchSamples {
+		r.samples = r.samples[1:]
+	}
+
+	leakWatchResources.WithLabelValues(r.name).Set(float64(count))
+	suspected := growing(r.samples, leakWatchSamples)
+	leakWatchSuspected.WithLabelValues(r.name).Set(BoolToFloat(suspected))
+	if suspected {
+		log.WarningLogMsg("%s grew on each of the last %d checks from %d to %d (baseline %d), possible leak",
+			r.name, len(r.samples), r.samples[0], count, r.baseline)
+	}
+}
+
+// growing returns true if there are at least n samples, and each sample is
+// larger than the previous one.
+func growing(samples []int, n int) bool {
+	if len(samples) < n {
+		return false
+	}
+	for i := 1; i < len(samples); i++ {
+		if samples[i] <= samples[i-1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func countGoroutines() (int, error) {
+	return runtime.NumGoroutine(), nil
+}
+
+func countRadosConnections() (int, error) {
+	conns, _ := connPool.Len()
+
+	return conns, nil
+}
+
+func countRadosConnectionUsers() (int, error) {
+	_, users := connPool.Len()
+
+	return users, nil
+}
+
+// countMappedDevices returns the number of RBD images that are mapped with
+// krbd or rbd-nbd on the node.
+func countMappedDevices() (int, error) {
+	krbd, err := filepath.Glob("/sys/bus/rbd/devices/*")
+	if err != nil {
+		return 0, err
+	}
+
+	// only NBD devices that are connected have a pid file
+	nbd, err := filepath.Glob("/sys/block/nbd*/pid")
+	if err != nil {
+		return 0, err
+	}
+
+	return len(krbd) + len(nbd), nil
+}
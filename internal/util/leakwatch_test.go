@@ -0,0 +1,69 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGrowing(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		samples []int
+		want    bool
+	}{
+		{[]int{1, 2, 3}, true},
+		{[]int{1, 2}, false},
+		{[]int{1, 2, 2}, false},
+		{[]int{3, 2, 1}, false},
+		{[]int{10, 20, 15}, false},
+	}
+	for _, tt := range tests {
+		if got := growing(tt.samples, 3); got != tt.want {
+			t.Errorf("growing(%v, 3) = %v, want %v", tt.samples, got, tt.want)
+		}
+	}
+}
+
+func TestLeakWatchResource(t *testing.T) {
+	t.Parallel()
+
+	n := 0
+	r := &leakWatchResource{
+		name: "test_growing",
+		count: func() (int, error) {
+			n++
+
+			return n, nil
+		},
+	}
+	for i := 0; i < leakWatchSamples; i++ {
+		if v := testutil.ToFloat64(leakWatchSuspected.WithLabelValues(r.name)); v != 0 {
+			t.Fatalf("leak suspected after %d checks", i)
+		}
+		r.check()
+	}
+	if v := testutil.ToFloat64(leakWatchSuspected.WithLabelValues(r.name)); v != 1 {
+		t.Errorf("leak not suspected after %d growing checks", leakWatchSamples)
+	}
+	if r.baseline != 1 || len(r.samples) != leakWatchSamples {
+		t.Errorf("baseline = %d with %d samples, want 1 with %d", r.baseline, len(r.samples), leakWatchSamples)
+	}
+}
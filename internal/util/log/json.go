@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"k8s.io/klog/v2"
+)
+
+// jsonFormat is set when the logs are written as JSON objects, the fields
+// stored in the context are then passed as key-value pairs instead of being
+// prefixed to the message.
+var jsonFormat bool
+
+// SetJSONFormat configures klog to write each log entry as a single line JSON
+// object to w. This needs to be called before any logging is done.
+func SetJSONFormat(w io.Writer) {
+	jsonFormat = true
+	klog.SetLogger(logr.New(&jsonSink{out: w, mux: &sync.Mutex{}}))
+}
+
+// jsonSink is a logr.LogSink that writes JSON objects.
+type jsonSink struct {
+	out    io.Writer
+	mux    *sync.Mutex
+	name   string
+	values []interface{}
+	depth  int
+}
+
+var (
+	_ logr.LogSink          = &jsonSink{}
+	_ logr.CallDepthLogSink = &jsonSink{}
+)
+
+func (s *jsonSink) Init(info logr.RuntimeInfo) {
+	s.depth += info.CallDepth
+}
+
+// Enabled returns true, the verbosity is checked by klog already.
+func (s *jsonSink) Enabled(level int) bool {
+	return true
+}
+
+func (s *jsonSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.write("info", nil, msg, keysAndValues)
+}
+
+func (s *jsonSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.write("error", err, msg, keysAndValues)
+}
+
+func (s *jsonSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	c := *s
+	c.values = append(append([]interface{}{}, s.values...), keysAndValues...)
+
+	return &c
+}
+
+func (s *jsonSink) WithName(name string) logr.LogSink {
+	c := *s
+	if c.name != "" {
+		name = c.name + "/" + name
+	}
+	c.name = name
+
+	return &c
+}
+
+func (s *jsonSink) WithCallDepth(depth int) logr.LogSink {
+	c := *s
+	c.depth += depth
+
+	return &c
+}
+
+func (s *jsonSink) write(severity string, err error, msg string, keysAndValues []interface{}) {
+	entry := map[string]interface{}{
+		"ts":       time.Now().UTC().Format(time.RFC3339Nano),
+		"severity": severity,
+		"msg":      Redact(strings.TrimSuffix(msg, "\n")),
+	}
+	// skip write(), Info()/Error() and the logr.Logger function
+	if _, file, line, ok := runtime.Caller(s.depth + 2); ok {
+		entry["caller"] = fmt.Sprintf("%s:%d", filepath.Base(file), line)
+	}
+	if s.name != "" {
+		entry["logger"] = s.name
+	}
+	if err != nil {
+		entry["err"] = Redact(err.Error())
+	}
+	addValues(entry, s.values)
+	addValues(entry, keysAndValues)
+
+	data, mErr := json.Marshal(entry)
+	if mErr != nil {
+		data, _ = json.Marshal(map[string]interface{}{
+			"severity": "error",
+			"msg":      fmt.Sprintf("failed to marshal log entry %q: %v", msg, mErr),
+		})
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	_, _ = s.out.Write(append(data, '\n'))
+}
+
+// addValues adds the key-value pairs to the entry. Values that do not have a
+// useful JSON representation are converted to strings.
+func addValues(entry map[string]interface{}, keysAndValues []interface{}) {
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := fmt.Sprint(keysAndValues[i])
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.Seconds()
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			value = v.String()
+		}
+		entry[key] = value
+	}
+}
+
+// contextFields returns the key-value pairs for the values that are stored in
+// the context.
+func contextFields(ctx context.Context) []interface{} {
+	fields := []struct {
+		key  contextKey
+		name string
+	}{
+		{CtxKey, "id"},
+		{ReqID, "reqID"},
+		{CorrelationID, "correlationID"},
+		{Op, "op"},
+		{VolumeID, "volumeID"},
+		{ClusterID, "clusterID"},
+		{Duration, "duration"},
+		{ExitCode, "exitCode"},
+	}
+
+	keysAndValues := []interface{}{}
+	for _, f := range fields {
+		if v := ctx.Value(f.key); v != nil && v != "" {
+			keysAndValues = append(keysAndValues, f.name, v)
+		}
+	}
+
+	return keysAndValues
+}
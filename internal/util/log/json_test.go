@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+func TestJSONSink(t *testing.T) {
+	t.Parallel()
+
+	buf := &bytes.Buffer{}
+	logger := logr.New(&jsonSink{out: buf, mux: &sync.Mutex{}})
+
+	ctx := context.WithValue(context.Background(), ReqID, "pvc-1")
+	ctx = context.WithValue(ctx, Op, "CreateVolume")
+	ctx = context.WithValue(ctx, Duration, 1500*time.Millisecond)
+	logger.Error(errors.New("pool full"), "GRPC error\n", contextFields(ctx)...)
+
+	entry := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("failed to parse log entry %q: %v", buf.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"severity": "error",
+		"msg":      "GRPC error",
+		"err":      "pool full",
+		"reqID":    "pvc-1",
+		"op":       "CreateVolume",
+		"duration": 1.5,
+	}
+	for k, v := range expected {
+		if entry[k] != v {
+			t.Errorf("entry[%q] = %v, want %v", k, entry[k], v)
+		}
+	}
+	for _, k := range []string{"volumeID", "clusterID"} {
+		if _, ok := entry[k]; ok {
+			t.Errorf("entry has unexpected field %q", k)
+		}
+	}
+	if _, ok := entry["caller"]; !ok {
+		t.Errorf("entry has no caller: %v", entry)
+	}
+}
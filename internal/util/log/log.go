@@ -37,120 +37,177 @@ var CtxKey = contextKey("ID")
 // ReqID for logging request ID.
 var ReqID = contextKey("Req-ID")
 
+// CorrelationID for logging the ID that correlates the operations on a
+// volume across the controller and node plugins.
+var CorrelationID = contextKey("Correlation-ID")
+
+// Op for logging the name of the operation (gRPC procedure).
+var Op = contextKey("Op")
+
+// VolumeID for logging the ID of the volume the operation is done on.
+var VolumeID = contextKey("Volume-ID")
+
+// ClusterID for logging the ID of the Ceph cluster.
+var ClusterID = contextKey("Cluster-ID")
+
+// Duration for logging the time an operation took.
+var Duration = contextKey("Duration")
+
+// ExitCode for logging the exit code of an executed command.
+var ExitCode = contextKey("Exit-Code")
+
 // Log helps in context based logging.
 func Log(ctx context.Context, format string) string {
+	if jsonFormat {
+		// the values are logged as separate fields
+		return format
+	}
+
 	id := ctx.Value(CtxKey)
 	if id == nil {
 		return format
 	}
 	a := fmt.Sprintf("ID: %v ", id)
-	reqID := ctx.Value(ReqID)
-	if reqID == nil {
-		return a + format
+	if reqID := ctx.Value(ReqID); reqID != nil {
+		a += fmt.Sprintf("Req-ID: %v ", reqID)
+	}
+	if correlationID := ctx.Value(CorrelationID); correlationID != nil {
+		a += fmt.Sprintf("Correlation-ID: %v ", correlationID)
 	}
-	a += fmt.Sprintf("Req-ID: %v ", reqID)
 
 	return a + format
 }
 
 // FatalLog helps in logging fatal errors.
 func FatalLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
+	logMessage := redactf(message, args...)
 	klog.FatalDepth(1, logMessage)
 }
 
 // ErrorLogMsg helps in logging errors with message.
 func ErrorLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
+	logMessage := redactf(message, args...)
 	klog.ErrorDepth(1, logMessage)
 }
 
 // ErrorLog helps in logging errors with context.
 func ErrorLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
-	klog.ErrorDepth(1, logMessage)
+	logMessage := redactf(Log(ctx, message), args...)
+	errorDepth(ctx, 1, logMessage)
 }
 
 // WarningLogMsg helps in logging warnings with message.
 func WarningLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
+	logMessage := redactf(message, args...)
 	klog.WarningDepth(1, logMessage)
 }
 
 // WarningLog helps in logging warnings with context.
 func WarningLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
-	klog.WarningDepth(1, logMessage)
+	logMessage := redactf(Log(ctx, message), args...)
+	warningDepth(ctx, 1, logMessage)
 }
 
 // DefaultLog helps in logging with klog.level 1.
 func DefaultLog(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Default).Enabled() {
+		logMessage := redactf(message, args...)
 		klog.InfoDepth(1, logMessage)
 	}
 }
 
 // UsefulLog helps in logging with klog.level 2.
 func UsefulLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Useful).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		logMessage := redactf(Log(ctx, message), args...)
+		infoDepth(ctx, 1, logMessage)
 	}
 }
 
 // ExtendedLogMsg helps in logging a message with klog.level 3.
 func ExtendedLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Extended).Enabled() {
+		logMessage := redactf(message, args...)
 		klog.InfoDepth(1, logMessage)
 	}
 }
 
 // ExtendedLog helps in logging with klog.level 3.
 func ExtendedLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Extended).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		logMessage := redactf(Log(ctx, message), args...)
+		infoDepth(ctx, 1, logMessage)
 	}
 }
 
 // DebugLogMsg helps in logging a message with klog.level 4.
 func DebugLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Debug).Enabled() {
+		logMessage := redactf(message, args...)
 		klog.InfoDepth(1, logMessage)
 	}
 }
 
 // DebugLog helps in logging with klog.level 4.
 func DebugLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Debug).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		logMessage := redactf(Log(ctx, message), args...)
+		infoDepth(ctx, 1, logMessage)
 	}
 }
 
 // TraceLogMsg helps in logging a message with klog.level 5.
 func TraceLogMsg(message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(message, args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Trace).Enabled() {
+		logMessage := redactf(message, args...)
 		klog.InfoDepth(1, logMessage)
 	}
 }
 
 // TraceLog helps in logging with klog.level 5.
 func TraceLog(ctx context.Context, message string, args ...interface{}) {
-	logMessage := fmt.Sprintf(Log(ctx, message), args...)
 	// If logging is disabled, don't evaluate the arguments
 	if klog.V(Trace).Enabled() {
-		klog.InfoDepth(1, logMessage)
+		logMessage := redactf(Log(ctx, message), args...)
+		infoDepth(ctx, 1, logMessage)
+	}
+}
+
+// infoDepth logs the message at info severity, and adds the values stored in
+// the context as fields when JSON logging is enabled.
+func infoDepth(ctx context.Context, depth int, message string) {
+	if jsonFormat {
+		klog.InfoSDepth(depth+1, message, contextFields(ctx)...)
+
+		return
+	}
+	klog.InfoDepth(depth+1, message)
+}
+
+// warningDepth logs the message at warning severity, see infoDepth().
+func warningDepth(ctx context.Context, depth int, message string) {
+	if jsonFormat {
+		// klog does not pass the warning severity on to the logger
+		klog.InfoSDepth(depth+1, message, append(contextFields(ctx), "severity", "warning")...)
+
+		return
+	}
+	klog.WarningDepth(depth+1, message)
+}
+
+// errorDepth logs the message at error severity, see infoDepth().
+func errorDepth(ctx context.Context, depth int, message string) {
+	if jsonFormat {
+		klog.ErrorSDepth(depth+1, nil, message, contextFields(ctx)...)
+
+		return
 	}
+	klog.ErrorDepth(depth+1, message)
 }
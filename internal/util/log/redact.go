@@ -0,0 +1,135 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Stripped replaces the secrets in log messages and command-lines.
+const Stripped = "***stripped***"
+
+// maxSecrets is the number of secrets that are remembered by
+// RegisterSecret(), the oldest one is forgotten when more are registered.
+const maxSecrets = 1024
+
+// secretPatterns match secrets that can be recognized by their format or by
+// the option they are passed with. The text that matches the first group is
+// kept, the remainder of the match is replaced.
+var secretPatterns = []*regexp.Regexp{
+	// command-line options of the ceph and rbd tools
+	regexp.MustCompile(`(--key(?:file)?=)[^\s,]+`),
+	// mount option of the kernel CephFS client
+	regexp.MustCompile(`(secret=)[^\s,]+`),
+	// cephx keys are 40 characters of base64 that start with "AQ"
+	regexp.MustCompile(`()AQ[A-Za-z0-9+/]{36}==`),
+	// Vault tokens and the header they are passed with
+	regexp.MustCompile(`()\bhv[bsr]\.[A-Za-z0-9_-]{20,}`),
+	regexp.MustCompile(`(?i)(X-Vault-Token["']?[:=]\s*[\["']?)[^\s"',\]]+`),
+	// key=value pairs of options and URL query parameters, with a key that
+	// is passphrase, password or token, or ends with it after a separator
+	// like access_token
+	regexp.MustCompile(`(?i)((?:^|[\s?&,;({\[])(?:[\w.-]*[_.-])?(?:passphrase|password|token)=)[^\s"',&;)\]}]+`),
+	// JSON fields with these keys
+	regexp.MustCompile(`(?i)("(?:[\w.-]*[_.-])?(?:passphrase|password|token)"\s*:\s*")[^"]+`),
+}
+
+// registeredSecrets contains secrets that can not be recognized by their
+// format, like the passphrases of encrypted volumes. The replacer is built by
+// Redact() when it is used for the first time after a secret was registered.
+var registeredSecrets = struct {
+	sync.RWMutex
+	// values are the secrets in the order they were registered
+	values   []string
+	set      map[string]struct{}
+	replacer *strings.Replacer
+}{set: make(map[string]struct{})}
+
+// RegisterSecret makes Redact() strip the secret from all log messages. This
+// should be called when a secret is read that has no recognizable format,
+// like a passphrase for encrypting a volume or a token to access a KMS.
+func RegisterSecret(secret string) {
+	// short values would strip unrelated parts of messages
+	const minLength = 8
+	if len(secret) < minLength {
+		return
+	}
+
+	registeredSecrets.Lock()
+	defer registeredSecrets.Unlock()
+
+	if _, ok := registeredSecrets.set[secret]; ok {
+		return
+	}
+	if len(registeredSecrets.values) >= maxSecrets {
+		delete(registeredSecrets.set, registeredSecrets.values[0])
+		registeredSecrets.values = registeredSecrets.values[1:]
+	}
+	registeredSecrets.values = append(registeredSecrets.values, secret)
+	registeredSecrets.set[secret] = struct{}{}
+	registeredSecrets.replacer = nil
+}
+
+// secretReplacer returns the replacer of the registered secrets, or nil when
+// no secrets are registered.
+func secretReplacer() *strings.Replacer {
+	registeredSecrets.RLock()
+	replacer := registeredSecrets.replacer
+	empty := len(registeredSecrets.values) == 0
+	registeredSecrets.RUnlock()
+	if replacer != nil || empty {
+		return replacer
+	}
+
+	registeredSecrets.Lock()
+	defer registeredSecrets.Unlock()
+
+	// another caller may have built it in the meantime
+	if registeredSecrets.replacer == nil {
+		pairs := make([]string, 0, 2*len(registeredSecrets.values))
+		for _, s := range registeredSecrets.values {
+			pairs = append(pairs, s, Stripped)
+		}
+		registeredSecrets.replacer = strings.NewReplacer(pairs...)
+	}
+
+	return registeredSecrets.replacer
+}
+
+// Redact returns the message with all secrets that are recognized replaced by
+// Stripped. All log functions of this package redact their messages, others
+// that write messages somewhere else (like into errors that are returned to
+// the Container Orchestrator) should call Redact() themselves.
+func Redact(message string) string {
+	if replacer := secretReplacer(); replacer != nil {
+		message = replacer.Replace(message)
+	}
+
+	for _, re := range secretPatterns {
+		message = re.ReplaceAllString(message, "${1}"+Stripped)
+	}
+
+	return message
+}
+
+// redactf formats the message with the args, and redacts the result.
+func redactf(message string, args ...interface{}) string {
+	return Redact(fmt.Sprintf(message, args...))
+}
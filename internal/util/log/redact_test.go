@@ -0,0 +1,140 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package log
+
+import (
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	RegisterSecret("my-luks-passphrase")
+
+	tests := []struct {
+		name    string
+		message string
+		want    string
+	}{
+		{
+			name:    "command-line key",
+			message: "rbd map pool/image --id admin --key=AQBhbGxvd2VkLW5vdC1hLXJlYWwta2V5LTEyMw==",
+			want:    "rbd map pool/image --id admin --key=***stripped***",
+		},
+		{
+			name:    "command-line keyfile",
+			message: "rbd map pool/image --keyfile=/tmp/csi/keys/keyfile-123 -m mon1",
+			want:    "rbd map pool/image --keyfile=***stripped*** -m mon1",
+		},
+		{
+			name:    "mount option",
+			message: "mount -t ceph mon1:/ /mnt -o name=admin,secret=AQBkey,noatime",
+			want:    "mount -t ceph mon1:/ /mnt -o name=admin,secret=***stripped***,noatime",
+		},
+		{
+			name:    "cephx key in a map",
+			message: "secrets: map[userID:admin userKey:AQBhbGxvd2VkLW5vdC1hLXJlYWwta2V5LTEyMw==]",
+			want:    "secrets: map[userID:admin userKey:***stripped***]",
+		},
+		{
+			name:    "vault token",
+			message: `{"X-Vault-Token":"hvs.CAESIJlWh2lYJtYdTIEnQ1A0aLF3cG1K","path":"secret/"}`,
+			want:    `{"X-Vault-Token":"***stripped***","path":"secret/"}`,
+		},
+		{
+			name:    "passphrase in JSON",
+			message: `{"passphrase":"c2VjcmV0","volumeID":"csi-vol-1"}`,
+			want:    `{"passphrase":"***stripped***","volumeID":"csi-vol-1"}`,
+		},
+		{
+			name:    "registered secret",
+			message: "cryptsetup failed for my-luks-passphrase on /dev/rbd0",
+			want:    "cryptsetup failed for ***stripped*** on /dev/rbd0",
+		},
+		{
+			name:    "error description is kept",
+			message: "failed to get passphrase: pool full",
+			want:    "failed to get passphrase: pool full",
+		},
+		{
+			name:    "token in a URL query",
+			message: "GET https://kms.example.com/v1/keys?token=c2VjcmV0&name=vol-1",
+			want:    "GET https://kms.example.com/v1/keys?token=***stripped***&name=vol-1",
+		},
+		{
+			name:    "key ending with token",
+			message: "kms options: access_token=c2VjcmV0,region=eu",
+			want:    "kms options: access_token=***stripped***,region=eu",
+		},
+		{
+			name:    "password in JSON with spaces",
+			message: `{"password" : "my secret", "user": "admin"}`,
+			want:    `{"password" : "***stripped***", "user": "admin"}`,
+		},
+		{
+			name:    "key containing token is kept",
+			message: "bucket notoken=true maxTokens=4 tokens=5",
+			want:    "bucket notoken=true maxTokens=4 tokens=5",
+		},
+		{
+			name:    "key starting with password is kept",
+			message: "reading password_file=/etc/ceph/pw, passwordless=false",
+			want:    "reading password_file=/etc/ceph/pw, passwordless=false",
+		},
+		{
+			name:    "value after a colon is kept",
+			message: "invalid token:expired, keytoken:abc",
+			want:    "invalid token:expired, keytoken:abc",
+		},
+		{
+			name:    "JSON field containing token is kept",
+			message: `{"tokenTTL":"1h","passwords":"none"}`,
+			want:    `{"tokenTTL":"1h","passwords":"none"}`,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			if got := Redact(tt.message); got != tt.want {
+				t.Errorf("Redact(%q) = %q, want %q", tt.message, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterSecret(t *testing.T) {
+	t.Parallel()
+
+	RegisterSecret("first-kms-token")
+	if got := Redact("using first-kms-token"); got != "using "+Stripped {
+		t.Errorf("Redact() = %q, want the first secret stripped", got)
+	}
+
+	// the replacer is built again after another secret is registered
+	RegisterSecret("second-kms-token")
+	got := Redact("using first-kms-token and second-kms-token")
+	if want := "using " + Stripped + " and " + Stripped; got != want {
+		t.Errorf("Redact() = %q, want %q", got, want)
+	}
+
+	// short secrets are not registered
+	RegisterSecret("short")
+	if got := Redact("a short message"); got != "a short message" {
+		t.Errorf("Redact() = %q, want the short secret kept", got)
+	}
+}
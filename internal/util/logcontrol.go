@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// logLevelFlags are the klog flags that can be changed at runtime. "v" sets
+// the global verbosity, "vmodule" sets the verbosity per file pattern (like
+// "rbd_util=5,omap=4"), which allows debugging of a single component.
+var logLevelFlags = []string{"v", "vmodule"}
+
+// StartLogControlServer starts a HTTP server on the unix domain socket at
+// socketPath, that changes the log verbosity at runtime. Only the user that
+// runs the process can connect to the socket. For example:
+//
+//	curl --unix-socket <socketPath> -X PUT 'http://localhost/loglevel?v=5'
+//	curl --unix-socket <socketPath> -X PUT 'http://localhost/loglevel?vmodule=omap=5'
+func StartLogControlServer(socketPath string) {
+	listener, err := listenLocal("unix://" + socketPath)
+	if err != nil {
+		log.FatalLogMsg("failed to listen on socket %q: %v", socketPath, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/loglevel", logLevelHandler(flag.CommandLine))
+	// #nosec:G114, the socket is only accessible locally.
+	err = http.Serve(listener, mux)
+	if err != nil {
+		log.FatalLogMsg("failed to serve log control requests on %q: %v", socketPath, err)
+	}
+}
+
+// logLevelHandler returns the current log verbosity on GET requests, and sets
+// the flags passed as query or form parameters on PUT or POST requests.
+func logLevelHandler(flags *flag.FlagSet) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPut, http.MethodPost:
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+
+				return
+			}
+			for _, name := range logLevelFlags {
+				if !r.Form.Has(name) {
+					continue
+				}
+				value := r.Form.Get(name)
+				if err := flags.Set(name, value); err != nil {
+					http.Error(w, fmt.Sprintf("invalid value %q for %s: %v", value, name, err), http.StatusBadRequest)
+
+					return
+				}
+				log.DefaultLog("log level changed: %s=%q", name, value)
+			}
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+			return
+		}
+
+		for _, name := range logLevelFlags {
+			f := flags.Lookup(name)
+			if f == nil {
+				http.Error(w, fmt.Sprintf("flag %s is not registered", name), http.StatusInternalServerError)
+
+				return
+			}
+			fmt.Fprintf(w, "%s=%s\n", name, f.Value.String())
+		}
+	})
+}
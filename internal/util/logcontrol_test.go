@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/klog/v2"
+)
+
+func TestLogLevelHandler(t *testing.T) {
+	t.Parallel()
+
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	klog.InitFlags(flags)
+	handler := logLevelHandler(flags)
+	defer func() {
+		_ = flags.Set("vmodule", "")
+	}()
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		code     int
+		contains string
+	}{
+		{
+			name:     "set vmodule",
+			method:   http.MethodPut,
+			target:   "/loglevel?vmodule=omap=5",
+			code:     http.StatusOK,
+			contains: "vmodule=omap=5",
+		},
+		{
+			name:     "get current levels",
+			method:   http.MethodGet,
+			target:   "/loglevel",
+			code:     http.StatusOK,
+			contains: "vmodule=omap=5",
+		},
+		{
+			name:   "invalid level",
+			method: http.MethodPut,
+			target: "/loglevel?v=verbose",
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "unsupported method",
+			method: http.MethodDelete,
+			target: "/loglevel",
+			code:   http.StatusMethodNotAllowed,
+		},
+	}
+	// the test cases depend on each other, do not run them in parallel
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(tt.method, tt.target, nil))
+		if rec.Code != tt.code {
+			t.Errorf("%s: status code = %d, want %d (%s)", tt.name, rec.Code, tt.code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), tt.contains) {
+			t.Errorf("%s: response %q does not contain %q", tt.name, rec.Body.String(), tt.contains)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Operations that are measured with ObserveOperation.
+const (
+	// OpJournalReserve is the reservation of a name in the journal.
+	OpJournalReserve = "journal_reserve"
+	// OpVolumeCreate is the creation of an RBD image or CephFS subvolume.
+	OpVolumeCreate = "volume_create"
+	// OpClone is the cloning of a volume from a snapshot or other volume.
+	OpClone = "clone"
+	// OpMount is the mounting of a volume on the staging path.
+	OpMount = "mount"
+	// OpCryptsetupOpen is the opening of an encrypted device.
+	OpCryptsetupOpen = "cryptsetup_open"
+)
+
+var operationDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Namespace: "csi",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of internal operations while provisioning and attaching volumes",
+		// 5ms up to ~160s
+		Buckets: prometheus.ExponentialBuckets(0.005, 2, 16),
+	},
+	[]string{"driver", "cluster_id", "operation"},
+)
+
+var (
+	commandDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "csi",
+			Name:      "command_duration_seconds",
+			Help:      "Duration of the external commands (like rbd, mount, cryptsetup or ceph-fuse) that were executed",
+			// 5ms up to ~160s
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 16),
+		},
+		[]string{"command"},
+	)
+	commandsTotal = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "csi",
+			Name:      "commands_total",
+			Help:      "Number of external commands that were executed by exit code",
+		},
+		[]string{"command", "exit_code"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(operationDuration, commandDuration, commandsTotal)
+}
+
+// ObserveOperation records the time since start as the duration of the
+// operation for the driver ("rbd", "cephfs") and cluster, and as a phase of
+// the gRPC procedure in the context, see RecordPhase(). It is intended to be
+// deferred at the start of the operation:
+//
+//	defer util.ObserveOperation(ctx, "rbd", clusterID, util.OpVolumeCreate, time.Now())
+func ObserveOperation(ctx context.Context, driver, clusterID, operation string, start time.Time) {
+	if RecordMetricLabel(MetricLabelClusterID, clusterID) {
+		operationDuration.WithLabelValues(driver, clusterID, operation).Observe(time.Since(start).Seconds())
+	}
+	RecordPhase(ctx, operation, start)
+}
+
+// commandExitCode returns the value of the exit_code label for the error of
+// an executed command. Commands that were killed after a timeout have the
+// exit code "timeout", commands that could not be started at all "error".
+func commandExitCode(err error) string {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return "0"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &exitErr):
+		return strconv.Itoa(exitErr.ExitCode())
+	}
+
+	return "error"
+}
+
+// observeCommand records the time since start as the duration of the executed
+// program, and counts its exit code. It returns the duration, and a context
+// with the duration and exit code for logging the result of the command.
+func observeCommand(ctx context.Context, program string, start time.Time, err error) (context.Context, time.Duration) {
+	duration := time.Since(start)
+	command := filepath.Base(program)
+	exitCode := commandExitCode(err)
+
+	commandDuration.WithLabelValues(command).Observe(duration.Seconds())
+	commandsTotal.WithLabelValues(command, exitCode).Inc()
+	RecordPhase(ctx, program, start)
+
+	ctx = context.WithValue(ctx, log.Duration, duration)
+
+	return context.WithValue(ctx, log.ExitCode, exitCode), duration
+}
+
+// BoolToFloat returns 1 for true and 0 for false, the value of gauges that
+// are set when a condition holds.
+func BoolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+
+	return 0
+}
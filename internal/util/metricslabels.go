@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// Labels of metrics that have a value for each pool or cluster, the number of
+// series with these labels grows with the size of the deployment.
+const (
+	MetricLabelClusterID = "cluster_id"
+	MetricLabelPool      = "pool"
+)
+
+// metricsCardinality is set by SetMetricsCardinality().
+var metricsCardinality = struct {
+	disabled    map[string]bool
+	sampleRatio uint32
+}{
+	sampleRatio: 1,
+}
+
+// SetMetricsCardinality limits the number of series of the metrics with a
+// high cardinality label. Metrics with one of the disabledLabels are not
+// recorded at all. For the other high cardinality labels, only one of every
+// sampleRatio values is recorded. Values are sampled by their hash, so that a
+// pool or cluster is either always or never recorded. A sampleRatio of 1
+// records all values. This needs to be called before metrics are recorded.
+func SetMetricsCardinality(disabledLabels []string, sampleRatio int) error {
+	if sampleRatio < 1 {
+		return fmt.Errorf("invalid metrics sample ratio %d, needs to be 1 or larger", sampleRatio)
+	}
+
+	disabled := make(map[string]bool, len(disabledLabels))
+	for _, label := range disabledLabels {
+		label = strings.TrimSpace(label)
+		switch label {
+		case "":
+			continue
+		case MetricLabelClusterID, MetricLabelPool:
+			disabled[label] = true
+		default:
+			return fmt.Errorf("metrics label %q can not be disabled, only %q and %q are supported",
+				label, MetricLabelClusterID, MetricLabelPool)
+		}
+	}
+
+	metricsCardinality.disabled = disabled
+	metricsCardinality.sampleRatio = uint32(sampleRatio)
+
+	return nil
+}
+
+// RecordMetricLabel returns true when a metric with the value for the high
+// cardinality label should be recorded, see SetMetricsCardinality().
+func RecordMetricLabel(label, value string) bool {
+	if metricsCardinality.disabled[label] {
+		return false
+	}
+	if metricsCardinality.sampleRatio == 1 {
+		return true
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(value))
+
+	return h.Sum32()%metricsCardinality.sampleRatio == 0
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"testing"
+)
+
+// nolint:paralleltest // modifies the global settings for recording metrics
+func TestSetMetricsCardinality(t *testing.T) {
+	defer func() {
+		_ = SetMetricsCardinality(nil, 1)
+	}()
+
+	if err := SetMetricsCardinality([]string{"volume_id"}, 1); err == nil {
+		t.Error("disabling an unsupported label did not fail")
+	}
+	if err := SetMetricsCardinality(nil, 0); err == nil {
+		t.Error("sample ratio 0 did not fail")
+	}
+
+	if err := SetMetricsCardinality([]string{""}, 1); err != nil {
+		t.Fatalf("SetMetricsCardinality() failed: %v", err)
+	}
+	if !RecordMetricLabel(MetricLabelPool, "replicapool") {
+		t.Error("pool not recorded without limits")
+	}
+
+	if err := SetMetricsCardinality([]string{MetricLabelPool}, 1); err != nil {
+		t.Fatalf("SetMetricsCardinality() failed: %v", err)
+	}
+	if RecordMetricLabel(MetricLabelPool, "replicapool") {
+		t.Error("disabled pool label recorded")
+	}
+	if !RecordMetricLabel(MetricLabelClusterID, "cluster-1") {
+		t.Error("cluster not recorded with pool label disabled")
+	}
+
+	if err := SetMetricsCardinality(nil, 4); err != nil {
+		t.Fatalf("SetMetricsCardinality() failed: %v", err)
+	}
+	recorded := 0
+	for i := 0; i < 1000; i++ {
+		pool := fmt.Sprintf("pool-%d", i)
+		record := RecordMetricLabel(MetricLabelPool, pool)
+		if record != RecordMetricLabel(MetricLabelPool, pool) {
+			t.Fatalf("sampling of %q is not stable", pool)
+		}
+		if record {
+			recorded++
+		}
+	}
+	if recorded < 150 || recorded > 350 {
+		t.Errorf("recorded %d of 1000 pools with sample ratio 4", recorded)
+	}
+}
@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"github.com/prometheus/client_golang/prometheus"
+	mount "k8s.io/mount-utils"
+)
+
+const (
+	mountHealthy   = "healthy"
+	mountStale     = "stale"
+	mountCorrupted = "corrupted"
+
+	// mountProbeTimeout is the time a stat() of a mount point may take
+	// before the mount is considered stale.
+	mountProbeTimeout = 10 * time.Second
+
+	// stagingDirName is the last element of the staging paths of kubelet.
+	stagingDirName = "globalmount"
+)
+
+var stagedMounts = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "csi",
+		Name:      "staged_mounts",
+		Help:      "Number of staged volume mounts on the node by state (healthy, stale, corrupted)",
+	},
+	[]string{"driver", "state"},
+)
+
+func init() {
+	prometheus.MustRegister(stagedMounts)
+}
+
+// volumeProber probes the mount points of NodeGetVolumeStats requests.
+var volumeProber = &mountProber{
+	timeout: mountProbeTimeout,
+	pending: make(map[string]bool),
+}
+
+// mountProber checks the staged mount points of a driver.
+type mountProber struct {
+	driverName string
+	timeout    time.Duration
+
+	// pending contains the mount points that have a stat() in progress,
+	// these are not probed again until the stat() returns
+	mux     sync.Mutex
+	pending map[string]bool
+}
+
+// StartMountHealthProbe checks the staged mount points of the driver every
+// interval, and exports the number of healthy, stale (not responding) and
+// corrupted mounts as the csi_staged_mounts gauge. This function does not
+// return.
+func StartMountHealthProbe(driverName string, interval time.Duration) {
+	mp := &mountProber{
+		driverName: driverName,
+		timeout:    mountProbeTimeout,
+		pending:    make(map[string]bool),
+	}
+
+	for {
+		mis, err := ReadMountInfoForProc("self")
+		if err != nil {
+			log.ErrorLogMsg("failed to read mountinfo for probing staged mounts: %v", err)
+		} else {
+			counts := map[string]float64{mountHealthy: 0, mountStale: 0, mountCorrupted: 0}
+			for _, mountPoint := range mp.stagingPaths(mis) {
+				state := mp.probe(mountPoint)
+				if state != mountHealthy {
+					log.WarningLogMsg("staged mount %q is %s", mountPoint, state)
+				}
+				counts[state]++
+			}
+			for state, count := range counts {
+				stagedMounts.WithLabelValues(driverName, state).Set(count)
+			}
+		}
+
+		time.Sleep(interval)
+	}
+}
+
+// stagingPaths returns the mount points that the driver staged volumes on.
+// Kubelet passes <kubelet-dir>/plugins/kubernetes.io/csi/<driver>/<hash>/globalmount
+// as the staging path, CephFS mounts the volume there, RBD mounts it on
+// <staging path>/<volume ID>.
+func (mp *mountProber) stagingPaths(mis []mount.MountInfo) []string {
+	dir := "/plugins/kubernetes.io/csi/" + mp.driverName + "/"
+	paths := []string{}
+	for i := range mis {
+		mountPoint := mis[i].MountPoint
+		if !strings.Contains(mountPoint, dir) {
+			continue
+		}
+		if path.Base(mountPoint) == stagingDirName || path.Base(path.Dir(mountPoint)) == stagingDirName {
+			paths = append(paths, mountPoint)
+		}
+	}
+
+	return paths
+}
+
+// probe returns the state of the mount point. A stat() of a stale mount (like
+// a CephFS mount where the MDS is not reachable) can block forever, it is run
+// in its own go-routine so that the other mount points can still be probed.
+func (mp *mountProber) probe(mountPoint string) string {
+	mp.mux.Lock()
+	if mp.pending[mountPoint] {
+		mp.mux.Unlock()
+
+		return mountStale
+	}
+	mp.pending[mountPoint] = true
+	mp.mux.Unlock()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := os.Stat(mountPoint)
+		mp.mux.Lock()
+		delete(mp.pending, mountPoint)
+		mp.mux.Unlock()
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		if err != nil && IsCorruptedMountError(err) {
+			return mountCorrupted
+		}
+
+		return mountHealthy
+	case <-time.After(mp.timeout):
+		return mountStale
+	}
+}
+
+// MountCondition returns the condition of the volume that is mounted on the
+// mount point. A stale or corrupted mount is abnormal, the volume needs to be
+// unpublished and published again to recover.
+func MountCondition(mountPoint string) *csi.VolumeCondition {
+	state := volumeProber.probe(mountPoint)
+	if state != mountHealthy {
+		return &csi.VolumeCondition{
+			Abnormal: true,
+			Message:  fmt.Sprintf("mount %s is %s", mountPoint, state),
+		}
+	}
+
+	return &csi.VolumeCondition{
+		Abnormal: false,
+		Message:  "volume is healthy",
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	mount "k8s.io/mount-utils"
+)
+
+func TestMountProberStagingPaths(t *testing.T) {
+	t.Parallel()
+
+	rbdVolume := "/var/lib/kubelet/plugins/kubernetes.io/csi/rbd.csi.ceph.com/0123abcd/globalmount/" +
+		"0001-0009-rook-ceph-0000000000000002-b0285c97-a0ce-11eb-8c66-0242ac110002"
+	cephfsVolume := "/var/lib/kubelet/plugins/kubernetes.io/csi/cephfs.csi.ceph.com/4567ef01/globalmount"
+	mis := []mount.MountInfo{
+		{MountPoint: "/"},
+		{MountPoint: rbdVolume},
+		{MountPoint: cephfsVolume},
+		{MountPoint: "/var/lib/kubelet/plugins/kubernetes.io/csi/rbd.csi.ceph.com/0123abcd/globalmount/a/b"},
+		{MountPoint: "/var/lib/kubelet/pods/pod-uid/volumes/kubernetes.io~csi/pvc-1/mount"},
+	}
+
+	tests := []struct {
+		driverName string
+		expected   []string
+	}{
+		{driverName: "rbd.csi.ceph.com", expected: []string{rbdVolume}},
+		{driverName: "cephfs.csi.ceph.com", expected: []string{cephfsVolume}},
+	}
+	for _, tt := range tests {
+		mp := &mountProber{driverName: tt.driverName}
+		if got := mp.stagingPaths(mis); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("stagingPaths() of %s = %v, want %v", tt.driverName, got, tt.expected)
+		}
+	}
+}
+
+func TestMountProberProbe(t *testing.T) {
+	t.Parallel()
+
+	mp := &mountProber{
+		timeout: time.Second,
+		pending: make(map[string]bool),
+	}
+
+	dir := t.TempDir()
+	if state := mp.probe(dir); state != mountHealthy {
+		t.Errorf("probe(%q) = %q, want %q", dir, state, mountHealthy)
+	}
+
+	// a mount point that is still being probed is reported stale
+	mp.pending[dir] = true
+	if state := mp.probe(dir); state != mountStale {
+		t.Errorf("probe(%q) with pending stat = %q, want %q", dir, state, mountStale)
+	}
+}
+
+func TestMountCondition(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	if condition := MountCondition(dir); condition.GetAbnormal() {
+		t.Errorf("MountCondition(%q) is abnormal: %s", dir, condition.GetMessage())
+	}
+}
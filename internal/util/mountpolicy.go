@@ -0,0 +1,164 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// exclusiveMountOptions are groups of mount options of which only one can be
+// set, a default of a group is not added when the volume sets another one.
+var exclusiveMountOptions = [][]string{
+	{"atime", "noatime", "relatime", "strictatime"},
+	{"ro", "rw"},
+}
+
+// MountOptionsPolicy contains the mount options that are added to the volumes
+// of a filesystem type by default, and the mount options that volumes can not
+// be mounted with. The filesystem types are the fsType of RBD volumes (ext4,
+// xfs), "ceph" and "ceph-fuse" for the CephFS mounters, and "nfs".
+type MountOptionsPolicy struct {
+	// Defaults are the mount options per filesystem type that are added,
+	// unless the volume sets the option, or a conflicting one, itself.
+	Defaults map[string][]string `json:"defaults"`
+	// Deny are the mount options that are rejected for all filesystem
+	// types. An option without value also denies the option with any value,
+	// "context" denies "context=<label>".
+	Deny []string `json:"deny"`
+}
+
+// LoadMountOptionsPolicy reads the MountOptionsPolicy from the JSON file at
+// path. An empty path returns a nil policy, which does not change any mount
+// options.
+func LoadMountOptionsPolicy(path string) (*MountOptionsPolicy, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	// #nosec
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mount options policy: %w", err)
+	}
+
+	policy := &MountOptionsPolicy{}
+	err = json.Unmarshal(content, policy)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mount options policy %s: %w", path, err)
+	}
+
+	return policy, nil
+}
+
+// mountOptionName returns the name of the option, without its value.
+func mountOptionName(option string) string {
+	name, _, _ := strings.Cut(option, "=")
+
+	return name
+}
+
+// Check returns an ErrMountOptionDenied error for the first of the options
+// that is denied by the policy.
+func (p *MountOptionsPolicy) Check(options []string) error {
+	if p == nil {
+		return nil
+	}
+
+	for _, option := range options {
+		for _, denied := range p.Deny {
+			if option == denied || mountOptionName(option) == denied {
+				return fmt.Errorf("%w: %s", ErrMountOptionDenied, option)
+			}
+		}
+	}
+
+	return nil
+}
+
+// CheckVolumeCapability checks the mount flags of the capability against the
+// deny-list of the policy, and returns an InvalidArgument error for denied
+// options.
+func (p *MountOptionsPolicy) CheckVolumeCapability(volCap *csi.VolumeCapability) error {
+	err := p.Check(volCap.GetMount().GetMountFlags())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return nil
+}
+
+// conflictsWith returns whether the option can not be set together with
+// other. Options conflict with themselves, and with their negation (dev and
+// nodev).
+func conflictsWith(option, other string) bool {
+	name := mountOptionName(option)
+	otherName := mountOptionName(other)
+	if name == otherName || "no"+name == otherName || name == "no"+otherName {
+		return true
+	}
+
+	for _, group := range exclusiveMountOptions {
+		if contains(group, name) && contains(group, otherName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithDefaults returns the options with the default mount options of the
+// fsType added, that do not conflict with any of the options.
+func (p *MountOptionsPolicy) WithDefaults(fsType string, options []string) []string {
+	if p == nil {
+		return options
+	}
+
+	result := append([]string{}, options...)
+	for _, def := range p.Defaults[fsType] {
+		conflict := false
+		for _, option := range options {
+			if conflictsWith(def, option) {
+				conflict = true
+
+				break
+			}
+		}
+		if !conflict {
+			result = append(result, def)
+		}
+	}
+
+	return result
+}
+
+// Apply checks the options against the deny-list of the policy, and returns
+// them with the default mount options of the fsType added.
+func (p *MountOptionsPolicy) Apply(fsType string, options []string) ([]string, error) {
+	err := p.Check(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.WithDefaults(fsType, options), nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMountOptionsPolicy(t *testing.T) {
+	t.Parallel()
+
+	policy, err := LoadMountOptionsPolicy("")
+	if err != nil || policy != nil {
+		t.Errorf("LoadMountOptionsPolicy(\"\") = %v, %v, want nil policy", policy, err)
+	}
+
+	path := t.TempDir() + "/policy.json"
+	content := `{"defaults": {"ext4": ["noatime"]}, "deny": ["suid"]}`
+	err = os.WriteFile(path, []byte(content), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	policy, err = LoadMountOptionsPolicy(path)
+	if err != nil {
+		t.Fatalf("LoadMountOptionsPolicy() error = %v", err)
+	}
+	want := &MountOptionsPolicy{
+		Defaults: map[string][]string{"ext4": {"noatime"}},
+		Deny:     []string{"suid"},
+	}
+	if !reflect.DeepEqual(policy, want) {
+		t.Errorf("LoadMountOptionsPolicy() = %v, want %v", policy, want)
+	}
+}
+
+func TestMountOptionsPolicyApply(t *testing.T) {
+	t.Parallel()
+	policy := &MountOptionsPolicy{
+		Defaults: map[string][]string{
+			"ext4": {"noatime", "dirsync"},
+			"nfs":  {"nosuid"},
+		},
+		Deny: []string{"suid", "context"},
+	}
+
+	tests := []struct {
+		name    string
+		policy  *MountOptionsPolicy
+		fsType  string
+		options []string
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "nil policy",
+			policy:  nil,
+			fsType:  "ext4",
+			options: []string{"suid"},
+			want:    []string{"suid"},
+		},
+		{
+			name:    "defaults are added",
+			policy:  policy,
+			fsType:  "ext4",
+			options: []string{"_netdev"},
+			want:    []string{"_netdev", "noatime", "dirsync"},
+		},
+		{
+			name:    "conflicting defaults are not added",
+			policy:  policy,
+			fsType:  "ext4",
+			options: []string{"relatime", "dirsync"},
+			want:    []string{"relatime", "dirsync"},
+		},
+		{
+			name:    "negated defaults are not added",
+			policy:  policy,
+			fsType:  "nfs",
+			options: []string{"nodev"},
+			want:    []string{"nodev", "nosuid"},
+		},
+		{
+			name:    "no defaults for the filesystem type",
+			policy:  policy,
+			fsType:  "xfs",
+			options: []string{"nouuid"},
+			want:    []string{"nouuid"},
+		},
+		{
+			name:    "denied option",
+			policy:  policy,
+			fsType:  "ext4",
+			options: []string{"suid"},
+			wantErr: true,
+		},
+		{
+			name:    "denied option with value",
+			policy:  policy,
+			fsType:  "ceph",
+			options: []string{"context=system_u:object_r:container_file_t:s0"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := ts.policy.Apply(ts.fsType, ts.options)
+			if ts.wantErr != errors.Is(err, ErrMountOptionDenied) {
+				t.Errorf("Apply() error = %v, wantErr %v", err, ts.wantErr)
+
+				return
+			}
+			if !ts.wantErr && !reflect.DeepEqual(got, ts.want) {
+				t.Errorf("Apply() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	runtime_pprof "runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+const (
+	// goroutineCheckInterval is the interval for checking the number of
+	// go-routines against the threshold.
+	goroutineCheckInterval = time.Minute
+	// goroutineStackLines is the number of lines of the go-routine profile
+	// that are logged when the threshold is exceeded.
+	goroutineStackLines = 50
+)
+
+// listenLocal returns a listener for the address, which is either a path to a
+// unix domain socket ("unix:///path/to/socket") or a TCP address on the
+// loopback interface ("localhost:6060", "127.0.0.1:6060").
+func listenLocal(address string) (net.Listener, error) {
+	if strings.HasPrefix(address, "unix://") {
+		socketPath := strings.TrimPrefix(address, "unix://")
+		// remove a stale socket of a previous run
+		err := os.Remove(socketPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to remove socket %q: %w", socketPath, err)
+		}
+
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return nil, err
+		}
+		err = os.Chmod(socketPath, 0o600)
+		if err != nil {
+			listener.Close()
+
+			return nil, fmt.Errorf("failed to set permissions of socket %q: %w", socketPath, err)
+		}
+
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("address %q is not on the loopback interface", address)
+	}
+
+	return net.Listen("tcp", address)
+}
+
+// StartProfilingServer serves the pprof profiles (heap, goroutine, CPU and
+// others) under /debug/pprof/ on the local address, see listenLocal(). For
+// example:
+//
+//	go tool pprof http://localhost:6060/debug/pprof/heap
+func StartProfilingServer(address string) {
+	listener, err := listenLocal(address)
+	if err != nil {
+		log.FatalLogMsg("failed to listen on profiling address %q: %v", address, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	log.DefaultLog("serving profiles on %s/debug/pprof/", address)
+	// #nosec:G114, the address is only accessible locally.
+	err = http.Serve(listener, mux)
+	if err != nil {
+		log.FatalLogMsg("failed to serve profiles on %q: %v", address, err)
+	}
+}
+
+// WatchGoroutines logs a warning with the most common go-routine stacks when
+// the number of go-routines exceeds the threshold. A steady growth of
+// go-routines in a long running process is usually a leak, the logged stacks
+// point to the code that starts them. This function does not return.
+func WatchGoroutines(threshold int) {
+	for {
+		time.Sleep(goroutineCheckInterval)
+
+		count := runtime.NumGoroutine()
+		if count <= threshold {
+			continue
+		}
+
+		var buf bytes.Buffer
+		// debug=1 aggregates the go-routines with the same stack
+		err := runtime_pprof.Lookup("goroutine").WriteTo(&buf, 1)
+		if err != nil {
+			log.WarningLogMsg("%d go-routines running, exceeding the threshold of %d (failed to get stacks: %v)",
+				count, threshold, err)
+
+			continue
+		}
+		lines := strings.SplitN(buf.String(), "\n", goroutineStackLines+1)
+		if len(lines) > goroutineStackLines {
+			lines = lines[:goroutineStackLines]
+		}
+		log.WarningLogMsg("%d go-routines running, exceeding the threshold of %d, possible leak:\n%s",
+			count, threshold, strings.Join(lines, "\n"))
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestListenLocal(t *testing.T) {
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "pprof.sock")
+	tests := []struct {
+		name    string
+		address string
+		wantErr bool
+	}{
+		{"unix socket", "unix://" + socketPath, false},
+		{"localhost", "localhost:0", false},
+		{"loopback IP", "127.0.0.1:0", false},
+		{"all interfaces", "0.0.0.0:0", true},
+		{"empty host", ":0", true},
+		{"missing port", "localhost", true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			listener, err := listenLocal(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("listenLocal(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+			if listener != nil {
+				listener.Close()
+			}
+		})
+	}
+}
+
+func TestListenLocalStaleSocket(t *testing.T) {
+	t.Parallel()
+
+	socketPath := filepath.Join(t.TempDir(), "pprof.sock")
+	stale, err := os.Create(socketPath)
+	if err != nil {
+		t.Fatalf("failed to create stale socket: %v", err)
+	}
+	stale.Close()
+
+	listener, err := listenLocal("unix://" + socketPath)
+	if err != nil {
+		t.Fatalf("listenLocal() with stale socket failed: %v", err)
+	}
+	defer listener.Close()
+	fi, err := os.Stat(socketPath)
+	if err != nil {
+		t.Fatalf("failed to stat socket: %v", err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("socket permissions = %v, want 0600", fi.Mode().Perm())
+	}
+}
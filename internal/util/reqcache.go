@@ -0,0 +1,167 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+// CreateVolumeCache is a short-lived cache of successful CreateVolume
+// responses. The CO retries CreateVolume requests until it receives a
+// response, retries of a request that has already completed can be answered
+// from the cache, without going through the journal reservation again.
+//
+// A nil *CreateVolumeCache is valid and caches nothing.
+type CreateVolumeCache struct {
+	ttl     time.Duration
+	mux     sync.Mutex
+	entries map[string]createVolumeCacheEntry
+}
+
+type createVolumeCacheEntry struct {
+	resp    *csi.CreateVolumeResponse
+	expires time.Time
+}
+
+// NewCreateVolumeCache returns a new CreateVolumeCache that keeps responses
+// for the ttl duration. If ttl is not positive, nil is returned and caching
+// is disabled.
+func NewCreateVolumeCache(ttl time.Duration) *CreateVolumeCache {
+	if ttl <= 0 {
+		return nil
+	}
+
+	return &CreateVolumeCache{
+		ttl:     ttl,
+		entries: make(map[string]createVolumeCacheEntry),
+	}
+}
+
+// createVolumeFingerprint returns a key that identifies the request by its
+// name, requested capacity, parameters and content source. Secrets are not
+// part of the fingerprint, they may be rotated between retries.
+func createVolumeFingerprint(req *csi.CreateVolumeRequest) string {
+	h := sha256.New()
+	write := func(s string) {
+		// include the length so that the concatenation is unambiguous
+		_, _ = h.Write([]byte(strconv.Itoa(len(s)) + ":" + s))
+	}
+
+	write(req.GetName())
+	write(strconv.FormatInt(req.GetCapacityRange().GetRequiredBytes(), 10))
+	write(strconv.FormatInt(req.GetCapacityRange().GetLimitBytes(), 10))
+
+	params := req.GetParameters()
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		write(k)
+		write(params[k])
+	}
+
+	write(req.GetVolumeContentSource().GetSnapshot().GetSnapshotId())
+	write(req.GetVolumeContentSource().GetVolume().GetVolumeId())
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the cached response for the request, or nil if there is none.
+func (c *CreateVolumeCache) Get(req *csi.CreateVolumeRequest) *csi.CreateVolumeResponse {
+	if c == nil {
+		return nil
+	}
+
+	key := createVolumeFingerprint(req)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(entry.expires) {
+		delete(c.entries, key)
+
+		return nil
+	}
+
+	return entry.resp
+}
+
+// Add caches the successful response for the request.
+func (c *CreateVolumeCache) Add(req *csi.CreateVolumeRequest, resp *csi.CreateVolumeResponse) {
+	if c == nil || resp == nil {
+		return
+	}
+
+	key := createVolumeFingerprint(req)
+	now := time.Now()
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	// drop the expired entries while the lock is held anyway, this keeps
+	// the cache small without a background routine
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = createVolumeCacheEntry{
+		resp:    resp,
+		expires: now.Add(c.ttl),
+	}
+}
+
+// Forget removes the cached responses for the volumeID. It needs to be called
+// when the volume is deleted, so that a new CreateVolume request with the
+// same name is not answered with the deleted volume.
+func (c *CreateVolumeCache) Forget(volumeID string) {
+	if c == nil {
+		return
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for k, entry := range c.entries {
+		if entry.resp.GetVolume().GetVolumeId() == volumeID {
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Purge removes all cached responses, and returns the number of removed
+// responses.
+func (c *CreateVolumeCache) Purge() int {
+	if c == nil {
+		return 0
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	purged := len(c.entries)
+	c.entries = make(map[string]createVolumeCacheEntry)
+
+	return purged
+}
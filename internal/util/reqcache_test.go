@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+	"time"
+
+	"github.com/container-storage-interface/spec/lib/go/csi"
+)
+
+func TestCreateVolumeCache(t *testing.T) {
+	t.Parallel()
+
+	req := &csi.CreateVolumeRequest{
+		Name:          "pvc-1",
+		CapacityRange: &csi.CapacityRange{RequiredBytes: 1024},
+		Parameters:    map[string]string{"clusterID": "cluster-1", "pool": "rbd"},
+		Secrets:       map[string]string{"userKey": "secret"},
+	}
+	resp := &csi.CreateVolumeResponse{
+		Volume: &csi.Volume{VolumeId: "vol-1", CapacityBytes: 1024},
+	}
+
+	cache := NewCreateVolumeCache(time.Minute)
+	if got := cache.Get(req); got != nil {
+		t.Errorf("Get() on empty cache = %v, want nil", got)
+	}
+
+	cache.Add(req, resp)
+	if got := cache.Get(req); got != resp {
+		t.Errorf("Get() = %v, want %v", got, resp)
+	}
+
+	// secrets are not part of the fingerprint
+	retry := *req
+	retry.Secrets = map[string]string{"userKey": "rotated"}
+	if got := cache.Get(&retry); got != resp {
+		t.Errorf("Get() with other secrets = %v, want %v", got, resp)
+	}
+
+	// a different capacity is a different request
+	other := *req
+	other.CapacityRange = &csi.CapacityRange{RequiredBytes: 2048}
+	if got := cache.Get(&other); got != nil {
+		t.Errorf("Get() with other capacity = %v, want nil", got)
+	}
+
+	// a different parameter is a different request
+	other = *req
+	other.Parameters = map[string]string{"clusterID": "cluster-1", "pool": "replicapool"}
+	if got := cache.Get(&other); got != nil {
+		t.Errorf("Get() with other parameters = %v, want nil", got)
+	}
+
+	cache.Forget("vol-1")
+	if got := cache.Get(req); got != nil {
+		t.Errorf("Get() after Forget() = %v, want nil", got)
+	}
+
+	cache.Add(req, resp)
+	cache.Add(&other, resp)
+	if purged := cache.Purge(); purged != 2 {
+		t.Errorf("Purge() = %d, want 2", purged)
+	}
+	if got := cache.Get(req); got != nil {
+		t.Errorf("Get() after Purge() = %v, want nil", got)
+	}
+}
+
+func TestCreateVolumeCacheExpiry(t *testing.T) {
+	t.Parallel()
+
+	req := &csi.CreateVolumeRequest{Name: "pvc-1"}
+	resp := &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: "vol-1"}}
+
+	cache := NewCreateVolumeCache(time.Millisecond)
+	cache.Add(req, resp)
+	time.Sleep(10 * time.Millisecond)
+	if got := cache.Get(req); got != nil {
+		t.Errorf("Get() of expired entry = %v, want nil", got)
+	}
+}
+
+func TestCreateVolumeCacheDisabled(t *testing.T) {
+	t.Parallel()
+
+	req := &csi.CreateVolumeRequest{Name: "pvc-1"}
+	resp := &csi.CreateVolumeResponse{Volume: &csi.Volume{VolumeId: "vol-1"}}
+
+	cache := NewCreateVolumeCache(0)
+	if cache != nil {
+		t.Fatalf("NewCreateVolumeCache(0) = %v, want nil", cache)
+	}
+
+	// all functions are usable on a nil cache
+	cache.Add(req, resp)
+	if got := cache.Get(req); got != nil {
+		t.Errorf("Get() on disabled cache = %v, want nil", got)
+	}
+	cache.Forget("vol-1")
+	if purged := cache.Purge(); purged != 0 {
+		t.Errorf("Purge() on disabled cache = %d, want 0", purged)
+	}
+}
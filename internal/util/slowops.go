@@ -0,0 +1,129 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ceph/ceph-csi/internal/util/log"
+)
+
+// slowOperationThreshold is the duration after which operations are logged
+// as slow, logging is disabled when it is 0.
+var slowOperationThreshold time.Duration
+
+// SetSlowOperationThreshold enables logging of a warning for gRPC procedures
+// and internal operations that take longer than threshold. A threshold of 0
+// disables the logging.
+func SetSlowOperationThreshold(threshold time.Duration) {
+	slowOperationThreshold = threshold
+}
+
+type phasesKey struct{}
+
+// phase is the total duration of all calls of an internal operation.
+type phase struct {
+	name     string
+	calls    int
+	duration time.Duration
+}
+
+// phases collects the internal operations of a single gRPC procedure, in the
+// order they were started.
+type phases struct {
+	mux    sync.Mutex
+	phases []*phase
+	index  map[string]*phase
+}
+
+// WithPhases returns a context that collects the durations of the internal
+// operations that are recorded with RecordPhase(), so that they can be logged
+// with LogSlowRequest().
+func WithPhases(ctx context.Context) context.Context {
+	return context.WithValue(ctx, phasesKey{}, &phases{index: make(map[string]*phase)})
+}
+
+// RecordPhase records the time since start as a phase of the gRPC procedure
+// in the context, and logs a warning if the operation itself was slow. It is
+// intended to be deferred at the start of the operation:
+//
+//	defer util.RecordPhase(ctx, "rbd map", time.Now())
+func RecordPhase(ctx context.Context, name string, start time.Time) {
+	duration := time.Since(start)
+
+	if p, ok := ctx.Value(phasesKey{}).(*phases); ok {
+		p.add(name, duration)
+	}
+
+	if slowOperationThreshold != 0 && duration > slowOperationThreshold {
+		log.WarningLog(context.WithValue(ctx, log.Duration, duration),
+			"slow operation %s took %s (threshold %s)", name, duration, slowOperationThreshold)
+	}
+}
+
+// LogSlowRequest logs a warning with the breakdown of the recorded phases if
+// the duration of the gRPC procedure exceeds the threshold.
+func LogSlowRequest(ctx context.Context, method string, duration time.Duration) {
+	if slowOperationThreshold == 0 || duration <= slowOperationThreshold {
+		return
+	}
+
+	breakdown := "none recorded"
+	if p, ok := ctx.Value(phasesKey{}).(*phases); ok {
+		if s := p.String(); s != "" {
+			breakdown = s
+		}
+	}
+	log.WarningLog(context.WithValue(ctx, log.Duration, duration),
+		"slow request %s took %s (threshold %s), phases: %s", method, duration, slowOperationThreshold, breakdown)
+}
+
+func (p *phases) add(name string, duration time.Duration) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	ph, ok := p.index[name]
+	if !ok {
+		ph = &phase{name: name}
+		p.index[name] = ph
+		p.phases = append(p.phases, ph)
+	}
+	ph.calls++
+	ph.duration += duration
+}
+
+// String returns the phases as "name=duration" pairs, the number of calls is
+// added for phases that were recorded more than once.
+func (p *phases) String() string {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+
+	parts := make([]string, 0, len(p.phases))
+	for _, ph := range p.phases {
+		if ph.calls > 1 {
+			parts = append(parts, fmt.Sprintf("%s=%s (%d calls)", ph.name, ph.duration, ph.calls))
+		} else {
+			parts = append(parts, fmt.Sprintf("%s=%s", ph.name, ph.duration))
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,63 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPhases(t *testing.T) {
+	t.Parallel()
+
+	p := &phases{index: make(map[string]*phase)}
+	if s := p.String(); s != "" {
+		t.Errorf("String() of empty phases = %q, want empty string", s)
+	}
+
+	p.add(OpJournalReserve, 2*time.Second)
+	p.add("rbd", time.Second)
+	p.add("rbd", 500*time.Millisecond)
+
+	expected := "journal_reserve=2s, rbd=1.5s (2 calls)"
+	if s := p.String(); s != expected {
+		t.Errorf("String() = %q, want %q", s, expected)
+	}
+}
+
+func TestRecordPhase(t *testing.T) {
+	t.Parallel()
+
+	// without phases in the context, recording is a no-op
+	RecordPhase(context.Background(), OpMount, time.Now())
+
+	ctx := WithPhases(context.Background())
+	RecordPhase(ctx, OpMount, time.Now().Add(-time.Second))
+
+	p, ok := ctx.Value(phasesKey{}).(*phases)
+	if !ok {
+		t.Fatal("WithPhases() did not add phases to the context")
+	}
+	ph, ok := p.index[OpMount]
+	if !ok {
+		t.Fatalf("phase %q was not recorded", OpMount)
+	}
+	if ph.calls != 1 || ph.duration < time.Second {
+		t.Errorf("phase %q has %d calls and duration %s, want 1 call and at least 1s", OpMount, ph.calls, ph.duration)
+	}
+}
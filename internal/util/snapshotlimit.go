@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// MaxSnapshotsPerVolumeKey is the parameter of the snapshot class that limits
+// the number of snapshots of a volume, it overrides --maxsnapshotspervolume.
+const MaxSnapshotsPerVolumeKey = "maxSnapshotsPerVolume"
+
+// GetMaxSnapshotsPerVolume returns the maximum number of snapshots of a volume
+// in the parameters, or defaultLimit when the parameters do not set it. 0
+// does not limit the number of snapshots.
+func GetMaxSnapshotsPerVolume(parameters map[string]string, defaultLimit uint) (uint, error) {
+	val, ok := parameters[MaxSnapshotsPerVolumeKey]
+	if !ok {
+		return defaultLimit, nil
+	}
+	limit, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", MaxSnapshotsPerVolumeKey, val, err)
+	}
+
+	return uint(limit), nil
+}
+
+// CheckSnapshotLimit returns ErrSnapshotLimitExceeded when the volume has the
+// maximum number of snapshots of the limit already.
+func CheckSnapshotLimit(volID string, snapshots int, limit uint) error {
+	if limit == 0 || snapshots < int(limit) {
+		return nil
+	}
+
+	return fmt.Errorf("%w: volume %s has %d snapshots, the limit is %d",
+		ErrSnapshotLimitExceeded, volID, snapshots, limit)
+}
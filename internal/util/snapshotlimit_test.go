@@ -0,0 +1,114 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGetMaxSnapshotsPerVolume(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		parameters map[string]string
+		want       uint
+		wantErr    bool
+	}{
+		{
+			name:       "unset",
+			parameters: map[string]string{},
+			want:       10,
+		},
+		{
+			name:       "set",
+			parameters: map[string]string{MaxSnapshotsPerVolumeKey: "5"},
+			want:       5,
+		},
+		{
+			name:       "unlimited",
+			parameters: map[string]string{MaxSnapshotsPerVolumeKey: "0"},
+			want:       0,
+		},
+		{
+			name:       "negative",
+			parameters: map[string]string{MaxSnapshotsPerVolumeKey: "-1"},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid",
+			parameters: map[string]string{MaxSnapshotsPerVolumeKey: "many"},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetMaxSnapshotsPerVolume(ts.parameters, 10)
+			if (err != nil) != ts.wantErr {
+				t.Errorf("GetMaxSnapshotsPerVolume() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if got != ts.want {
+				t.Errorf("GetMaxSnapshotsPerVolume() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCheckSnapshotLimit(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name      string
+		snapshots int
+		limit     uint
+		exceeded  bool
+	}{
+		{
+			name:      "unlimited",
+			snapshots: 1000,
+			limit:     0,
+		},
+		{
+			name:      "below limit",
+			snapshots: 4,
+			limit:     5,
+		},
+		{
+			name:      "at limit",
+			snapshots: 5,
+			limit:     5,
+			exceeded:  true,
+		},
+		{
+			name:      "above limit",
+			snapshots: 6,
+			limit:     5,
+			exceeded:  true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckSnapshotLimit("vol", ts.snapshots, ts.limit)
+			if errors.Is(err, ErrSnapshotLimitExceeded) != ts.exceeded {
+				t.Errorf("CheckSnapshotLimit() error = %v, exceeded %v", err, ts.exceeded)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"fmt"
+)
+
+// TenantQuota limits the total size of the volumes of a tenant, the
+// Kubernetes Namespace of the PVCs, in a pool. For CephFS the pool is the
+// name of the filesystem. A quota without tenant applies to all tenants that
+// do not have a quota of their own in the pool.
+type TenantQuota struct {
+	Tenant   string `json:"tenant"`
+	Pool     string `json:"pool"`
+	MaxBytes int64  `json:"maxBytes"`
+}
+
+// GetTenantQuota returns the maximum total size of the volumes of the tenant
+// in the pool, from the configuration of the clusterID. 0 does not limit the
+// size.
+func GetTenantQuota(pathToConfig, clusterID, tenant, pool string) (int64, error) {
+	cluster, err := readClusterInfo(pathToConfig, clusterID)
+	if err != nil {
+		return 0, err
+	}
+
+	var quota int64
+	for _, tq := range cluster.TenantQuotas {
+		if tq.Pool != pool {
+			continue
+		}
+		if tq.Tenant == tenant {
+			return tq.MaxBytes, nil
+		}
+		if tq.Tenant == "" {
+			quota = tq.MaxBytes
+		}
+	}
+
+	return quota, nil
+}
+
+// CheckTenantQuota returns ErrTenantQuotaExceeded when a new volume of size
+// does not fit in the quota of the tenant, which uses used bytes of the pool
+// already.
+func CheckTenantQuota(tenant, pool string, used, size, quota int64) error {
+	if quota == 0 || used+size <= quota {
+		return nil
+	}
+
+	return fmt.Errorf("%w: tenant %s uses %d of %d bytes in pool %s, a volume of %d bytes does not fit",
+		ErrTenantQuotaExceeded, tenant, used, quota, pool, size)
+}
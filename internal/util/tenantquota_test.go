@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestGetTenantQuota(t *testing.T) {
+	t.Parallel()
+	csiConfig := []ClusterInfo{
+		{
+			ClusterID: "cluster-1",
+			Monitors:  []string{"ip-1", "ip-2"},
+			TenantQuotas: []TenantQuota{
+				{Tenant: "tenant-a", Pool: "replicapool", MaxBytes: 10},
+				{Pool: "replicapool", MaxBytes: 5},
+				{Tenant: "tenant-a", Pool: "myfs", MaxBytes: 20},
+			},
+		},
+		{
+			ClusterID: "cluster-2",
+			Monitors:  []string{"ip-3", "ip-4"},
+		},
+	}
+	csiConfigFileContent, err := json.Marshal(csiConfig)
+	if err != nil {
+		t.Errorf("failed to marshal csi config info %v", err)
+	}
+	tmpConfPath := t.TempDir() + "/ceph-csi.json"
+	err = os.WriteFile(tmpConfPath, csiConfigFileContent, 0o600)
+	if err != nil {
+		t.Errorf("failed to write %s file content: %v", CsiConfigFile, err)
+	}
+
+	tests := []struct {
+		name      string
+		clusterID string
+		tenant    string
+		pool      string
+		want      int64
+	}{
+		{
+			name:      "quota of the tenant",
+			clusterID: "cluster-1",
+			tenant:    "tenant-a",
+			pool:      "replicapool",
+			want:      10,
+		},
+		{
+			name:      "quota of the tenant in another pool",
+			clusterID: "cluster-1",
+			tenant:    "tenant-a",
+			pool:      "myfs",
+			want:      20,
+		},
+		{
+			name:      "default quota of the pool",
+			clusterID: "cluster-1",
+			tenant:    "tenant-b",
+			pool:      "replicapool",
+			want:      5,
+		},
+		{
+			name:      "no quota in the pool",
+			clusterID: "cluster-1",
+			tenant:    "tenant-b",
+			pool:      "myfs",
+			want:      0,
+		},
+		{
+			name:      "no quotas for the cluster",
+			clusterID: "cluster-2",
+			tenant:    "tenant-a",
+			pool:      "replicapool",
+			want:      0,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			got, err := GetTenantQuota(tmpConfPath, ts.clusterID, ts.tenant, ts.pool)
+			if err != nil {
+				t.Errorf("GetTenantQuota() error = %v", err)
+
+				return
+			}
+			if got != ts.want {
+				t.Errorf("GetTenantQuota() = %v, want %v", got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCheckTenantQuota(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		used    int64
+		size    int64
+		quota   int64
+		wantErr bool
+	}{
+		{
+			name:  "no quota",
+			used:  100,
+			size:  100,
+			quota: 0,
+		},
+		{
+			name:  "fits in the quota",
+			used:  50,
+			size:  50,
+			quota: 100,
+		},
+		{
+			name:    "exceeds the quota",
+			used:    50,
+			size:    51,
+			quota:   100,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckTenantQuota("tenant", "pool", ts.used, ts.size, ts.quota)
+			if ts.wantErr != errors.Is(err, ErrTenantQuotaExceeded) {
+				t.Errorf("CheckTenantQuota() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
@@ -32,6 +32,11 @@ import (
 const (
 	keySeparator   rune   = '/'
 	labelSeparator string = ","
+
+	// TopologySegmentKey is the key of the volume context with the JSON
+	// encoded topology segment that the pool of the volume was picked from
+	// the topologyConstrainedPools for.
+	TopologySegmentKey = "topologySegment"
 )
 
 func k8sGetNodeLabels(nodeName string) (map[string]string, error) {
@@ -143,8 +148,6 @@ type TopologyConstrainedPool struct {
 func GetTopologyFromRequest(
 	req *csi.CreateVolumeRequest,
 ) (*[]TopologyConstrainedPool, *csi.TopologyRequirement, error) {
-	var topologyPools []TopologyConstrainedPool
-
 	// check if parameters have pool configuration pertaining to topology
 	topologyPoolsStr := req.GetParameters()["topologyConstrainedPools"]
 	if topologyPoolsStr == "" {
@@ -158,15 +161,41 @@ func GetTopologyFromRequest(
 	}
 
 	// extract topology based pools configuration
+	topologyPools, err := ParseTopologyConstrainedPools(topologyPoolsStr)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return topologyPools, accessibilityRequirements, nil
+}
+
+// ParseTopologyConstrainedPools parses the JSON encoded topologyConstrainedPools
+// parameter.
+func ParseTopologyConstrainedPools(topologyPoolsStr string) (*[]TopologyConstrainedPool, error) {
+	var topologyPools []TopologyConstrainedPool
+
 	err := json.Unmarshal([]byte(strings.Replace(topologyPoolsStr, "\n", " ", -1)), &topologyPools)
 	if err != nil {
-		return nil, nil, fmt.Errorf(
+		return nil, fmt.Errorf(
 			"failed to parse JSON encoded topology constrained pools parameter (%s): %w",
 			topologyPoolsStr,
 			err)
 	}
 
-	return &topologyPools, accessibilityRequirements, nil
+	return &topologyPools, nil
+}
+
+// FindPoolForTopology returns the image pool and data pool of the first of the
+// topologyPools that is accessible from the topology, like FindPoolAndTopology
+// does for a single topology constraint. Empty pool names are returned if none
+// of the pools matches the topology.
+func FindPoolForTopology(topologyPools *[]TopologyConstrainedPool, topology *csi.Topology) (string, string) {
+	if topologyPools == nil || topology == nil {
+		return "", ""
+	}
+	topologyPool := matchPoolToTopology(topologyPools, topology)
+
+	return topologyPool.PoolName, topologyPool.DataPoolName
 }
 
 // MatchPoolAndTopology returns the topology map, if the passed in pool matches any
@@ -268,3 +297,38 @@ func extractDomainsFromlabels(topology *csi.Topology) map[string]string {
 
 	return domainMap
 }
+
+// AddTopologySegment records the topology segment of a topology constrained
+// volume in its volume context, so that NodeStage can check that the node is
+// in the segment with CheckTopologySegment.
+func AddTopologySegment(volumeContext, segments map[string]string) {
+	if len(segments) == 0 {
+		return
+	}
+	// encoding a map of strings does not fail
+	encoded, _ := json.Marshal(segments)
+	volumeContext[TopologySegmentKey] = string(encoded)
+}
+
+// CheckTopologySegment returns ErrTopologyMismatch when the topology of the
+// node does not match all domains of the topology segment in the volume
+// context. Volumes without a topology segment can be staged on any node.
+func CheckTopologySegment(volumeContext, nodeTopology map[string]string) error {
+	encoded := volumeContext[TopologySegmentKey]
+	if encoded == "" {
+		return nil
+	}
+	var segments map[string]string
+	err := json.Unmarshal([]byte(encoded), &segments)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s %q: %w", TopologySegmentKey, encoded, err)
+	}
+	for domain, value := range segments {
+		if nodeTopology[domain] != value {
+			return fmt.Errorf("%w: volume is in %s=%s, node has %q",
+				ErrTopologyMismatch, domain, value, nodeTopology[domain])
+		}
+	}
+
+	return nil
+}
@@ -332,6 +332,120 @@ func TestFindPoolAndTopology(t *testing.T) {
 	checkAndReportError(t, "expected success got:", err)
 }
 
+func TestFindPoolForTopology(t *testing.T) {
+	t.Parallel()
+
+	topologyPools, err := ParseTopologyConstrainedPools(`[
+		{"poolName":"pool-a","domainSegments":[{"domainLabel":"zone","value":"Z1"}]},
+		{"poolName":"pool-b","dataPool":"ec-pool-b","domainSegments":[{"domainLabel":"zone","value":"Z2"}]}
+	]`)
+	if err != nil {
+		t.Fatalf("ParseTopologyConstrainedPools() failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		topology *csi.Topology
+		pool     string
+		dataPool string
+	}{
+		{
+			name:     "first zone",
+			topology: &csi.Topology{Segments: map[string]string{"prefix/region": "R1", "prefix/zone": "Z1"}},
+			pool:     "pool-a",
+		},
+		{
+			name:     "zone with data pool",
+			topology: &csi.Topology{Segments: map[string]string{"prefix/zone": "Z2"}},
+			pool:     "pool-b",
+			dataPool: "ec-pool-b",
+		},
+		{
+			name:     "zone without pool",
+			topology: &csi.Topology{Segments: map[string]string{"prefix/zone": "Z3"}},
+		},
+		{
+			name: "no topology",
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			pool, dataPool := FindPoolForTopology(topologyPools, ts.topology)
+			if pool != ts.pool || dataPool != ts.dataPool {
+				t.Errorf("FindPoolForTopology() = %q, %q, want %q, %q", pool, dataPool, ts.pool, ts.dataPool)
+			}
+		})
+	}
+
+	_, err = ParseTopologyConstrainedPools("[{")
+	if err == nil {
+		t.Error("ParseTopologyConstrainedPools() of invalid JSON succeeded")
+	}
+}
+
+func TestCheckTopologySegment(t *testing.T) {
+	t.Parallel()
+
+	volumeContext := map[string]string{}
+	AddTopologySegment(volumeContext, map[string]string{
+		"topology.rbd.csi.ceph.com/region": "R1",
+		"topology.rbd.csi.ceph.com/zone":   "Z1",
+	})
+
+	tests := []struct {
+		name          string
+		volumeContext map[string]string
+		nodeTopology  map[string]string
+		wantErr       bool
+	}{
+		{
+			name:          "node in segment",
+			volumeContext: volumeContext,
+			nodeTopology: map[string]string{
+				"topology.rbd.csi.ceph.com/region": "R1",
+				"topology.rbd.csi.ceph.com/zone":   "Z1",
+				"topology.rbd.csi.ceph.com/rack":   "A",
+			},
+		},
+		{
+			name:          "node in other zone",
+			volumeContext: volumeContext,
+			nodeTopology: map[string]string{
+				"topology.rbd.csi.ceph.com/region": "R1",
+				"topology.rbd.csi.ceph.com/zone":   "Z2",
+			},
+			wantErr: true,
+		},
+		{
+			name:          "node without topology",
+			volumeContext: volumeContext,
+			wantErr:       true,
+		},
+		{
+			name:          "volume without segment",
+			volumeContext: map[string]string{"pool": "rbd"},
+			nodeTopology:  map[string]string{"topology.rbd.csi.ceph.com/zone": "Z2"},
+		},
+		{
+			name:          "invalid segment",
+			volumeContext: map[string]string{TopologySegmentKey: "{"},
+			wantErr:       true,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			cErr := CheckTopologySegment(ts.volumeContext, ts.nodeTopology)
+			if (cErr != nil) != ts.wantErr {
+				t.Errorf("CheckTopologySegment() error = %v, wantErr %v", cErr, ts.wantErr)
+			}
+		})
+	}
+}
+
 /*
 // TODO: To test GetTopologyFromDomainLabels we need it to accept a k8s client interface, to mock k8sGetNdeLabels output
 func TestGetTopologyFromDomainLabels(t *testing.T) {
@@ -98,31 +98,86 @@ type Config struct {
 	MetricsPath     string // path of prometheus endpoint where metrics will be available
 	HistogramOption string // Histogram option for grpc metrics, should be comma separated value,
 	// ex:= "0.5,2,6" where start=0.5 factor=2, count=6
-	MetricsIP string // TCP port for liveness/ metrics requests
+	MetricsIP             string // TCP port for liveness/ metrics requests
+	MetricsDisabledLabels string // comma separated labels, metrics with these labels are not recorded
+	MetricsSampleRatio    int    // record metrics for one of every ratio pools and clusters
+
+	// logging related flags
+	LogFormat        string // format of the log messages, "text" or "json"
+	LogControlSocket string // unix domain socket for changing the log verbosity at runtime
+	AuditLog         string // file to append audit records of volume lifecycle operations to
+
+	// tracing related flags
+	TracingEndpoint string // OTLP gRPC endpoint (host:port) to export traces to
 
 	// mount option related flags
 	KernelMountOptions string // Comma separated string of mount options accepted by cephfs kernel mounter
 	FuseMountOptions   string // Comma separated string of mount options accepted by ceph-fuse mounter
+	MountOptionsPolicy string // JSON file with the default and denied mount options of the node plugin
+	// apply the fsGroup of pods to the volume instead of the kubelet
+	EnableVolumeMountGroup bool
 
 	PidLimit          int           // PID limit to configure through cgroups")
 	MetricsPort       int           // TCP port for liveness/grpc metrics requests
 	PollTime          time.Duration // time interval in seconds between each poll
 	PoolTimeout       time.Duration // probe timeout in seconds
-	EnableGRPCMetrics bool          // option to enable grpc metrics
-
-	EnableProfiling    bool // flag to enable profiling
-	IsControllerServer bool // if set to true start provisioner server
-	IsNodeServer       bool // if set to true start node server
-	Version            bool // cephcsi version
+	EnableGRPCMetrics bool          // option to enable grpc metrics (deprecated, implies EnableMetrics)
+	EnableMetrics     bool          // option to enable metrics and start the metrics server
+
+	MountHealthInterval time.Duration // time interval between probes of the staged mounts on the node
+	VolumeStatsCacheTTL time.Duration // time the results of NodeGetVolumeStats are cached
+	LivenessClusterPing bool          // check the health of the Ceph clusters in the liveness probe
+	// time interval between collecting the health of the Ceph clusters
+	CephHealthInterval time.Duration
+
+	// profiling related flags
+	PprofAddress           string        // local address to serve pprof profiles on
+	AdminSocket            string        // unix domain socket for the admin commands
+	GoroutineThreshold     int           // number of go-routines that triggers a warning
+	LeakWatchInterval      time.Duration // time interval between checks for leaked resources
+	SlowOperationThreshold time.Duration // duration after which operations are logged as slow
+	DiagnosticsDir         string        // directory for diagnostics bundles of panics
+
+	EnableProfiling     bool // flag to enable profiling
+	EnableEvents        bool // emit Kubernetes Events for actionable failures
+	EnableIntrospection bool // serve the gRPC health and reflection services
+	IsControllerServer  bool // if set to true start provisioner server
+	IsNodeServer        bool // if set to true start node server
+	Version             bool // cephcsi version
 
 	// SkipForceFlatten is set to false if the kernel supports mounting of
 	// rbd image or the image chain has the deep-flatten feature.
 	SkipForceFlatten bool
 
+	// MaxVolumesPerNode is the maximum number of RBD volumes that can be
+	// mapped on the node, along with the limits that are detected, 0 only
+	// uses the detected limits
+	MaxVolumesPerNode int64
+
 	// cephfs related flags
 	ForceKernelCephFS bool // force to use the ceph kernel client even if the kernel is < 4.17
 
-	SetMetadata bool // set metadata on the volume
+	SetMetadata      bool // set metadata on the volume
+	StrictParameters bool // reject CreateVolume and CreateSnapshot requests with unknown parameters
+
+	// EnforceSnapshotExpiry is set to delete VolumeSnapshots once the
+	// expiry stored in the metadata of their snapshot has passed, by the
+	// controller
+	EnforceSnapshotExpiry bool
+
+	// StaleVolumeInterval is the time between listings of the volumes in
+	// the journals by the controller, to find volumes without PV
+	StaleVolumeInterval time.Duration
+	// StaleVolumeGracePeriod is the time after which the controller deletes
+	// volumes without PV, they are only reported when 0
+	StaleVolumeGracePeriod time.Duration
+
+	// VolumeImportAllowList is the comma separated list of hosts, IP
+	// addresses and CIDRs that the controller downloads VolumeImports from
+	VolumeImportAllowList string
+	// VolumeImportTimeout is the time after which the controller gives up
+	// the download of a VolumeImport
+	VolumeImportTimeout time.Duration
 
 	// RbdHardMaxCloneDepth is the hard limit for maximum number of nested volume clones that are taken before a flatten
 	// occurs
@@ -142,6 +197,20 @@ type Config struct {
 	// reached cephcsi will start flattening the older rbd images.
 	MinSnapshotsOnImage uint
 
+	// MaxSnapshotsPerVolume is the maximum number of snapshots of a volume,
+	// CreateSnapshot fails once it is reached. 0 does not limit the number
+	// of snapshots.
+	MaxSnapshotsPerVolume uint
+
+	// CreateVolumeCacheTTL is the duration for which CreateVolume responses
+	// are cached to answer retries of completed requests, 0 disables the
+	// cache
+	CreateVolumeCacheTTL time.Duration
+
+	// ShutdownTimeout is the time that RPCs in flight are waited for when
+	// the driver receives SIGTERM, before the driver stops forcefully
+	ShutdownTimeout time.Duration
+
 	// CSI-Addons endpoint
 	CSIAddonsEndpoint string
 
@@ -335,9 +404,10 @@ func IsMountPoint(mounter mount.Interface, p string) (bool, error) {
 }
 
 // IsCorruptedMountError checks if the given error is a result of a corrupted
-// mountpoint.
+// mountpoint. A CephFS kernel client that was evicted (blocklisted) fails all
+// operations with ESHUTDOWN.
 func IsCorruptedMountError(err error) bool {
-	return mount.IsCorruptedMnt(err)
+	return mount.IsCorruptedMnt(err) || errors.Is(err, unix.ESHUTDOWN)
 }
 
 // ReadMountInfoForProc reads /proc/<PID>/mountpoint and marshals it into
@@ -16,8 +16,12 @@ limitations under the License.
 package util
 
 import (
+	"fmt"
+	"os"
 	"strings"
 	"testing"
+
+	"golang.org/x/sys/unix"
 )
 
 func TestRoundOffBytes(t *testing.T) {
@@ -401,3 +405,46 @@ func TestRoundOffCephFSVolSize(t *testing.T) {
 		})
 	}
 }
+
+func TestIsCorruptedMountError(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{
+			name: "not connected",
+			err:  &os.PathError{Op: "stat", Path: "/mnt", Err: unix.ENOTCONN},
+			want: true,
+		},
+		{
+			name: "evicted CephFS kernel client",
+			err:  &os.PathError{Op: "stat", Path: "/mnt", Err: unix.ESHUTDOWN},
+			want: true,
+		},
+		{
+			name: "wrapped evicted CephFS kernel client",
+			err:  fmt.Errorf("failed to stat: %w", &os.PathError{Op: "stat", Path: "/mnt", Err: unix.ESHUTDOWN}),
+			want: true,
+		},
+		{
+			name: "missing mount point",
+			err:  &os.PathError{Op: "stat", Path: "/mnt", Err: unix.ENOENT},
+			want: false,
+		},
+		{
+			name: "no error",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := IsCorruptedMountError(ts.err); got != ts.want {
+				t.Errorf("IsCorruptedMountError(%v) = %v, want %v", ts.err, got, ts.want)
+			}
+		})
+	}
+}
@@ -1,11 +1,41 @@
 package util
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/container-storage-interface/spec/lib/go/csi"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// MaxNamePrefixLength is the longest volumeNamePrefix or snapshotNamePrefix.
+// The prefix and a UUID form the name of an image, subvolume or snapshot,
+// which needs to fit in a single path component of 255 bytes.
+const MaxNamePrefixLength = 255 - 36
+
+// ValidateNamePrefix validates the value of the volumeNamePrefix or
+// snapshotNamePrefix parameter.
+func ValidateNamePrefix(parameter, prefix string) error {
+	if len(prefix) > MaxNamePrefixLength {
+		return fmt.Errorf("%w: %s is %d characters long, it can not be longer than %d characters",
+			ErrInvalidNamePrefix, parameter, len(prefix), MaxNamePrefixLength)
+	}
+
+	return nil
+}
+
+// ParameterErrorCode returns codes.InvalidArgument for errors of invalid
+// parameters, and codes.Internal for other errors, like failures to read the
+// configuration or to connect to the cluster.
+func ParameterErrorCode(err error) codes.Code {
+	if errors.Is(err, ErrClusterIDNotSet) || errors.Is(err, ErrInvalidNamePrefix) {
+		return codes.InvalidArgument
+	}
+
+	return codes.Internal
+}
+
 // ValidateNodeStageVolumeRequest validates the node stage request.
 func ValidateNodeStageVolumeRequest(req *csi.NodeStageVolumeRequest) error {
 	if req.GetVolumeCapability() == nil {
@@ -97,3 +127,16 @@ func CheckReadOnlyManyIsSupported(req *csi.CreateVolumeRequest) error {
 
 	return nil
 }
+
+// CheckContentSourceSize returns an OutOfRange error when the size of a new
+// volume is smaller than the size of the snapshot or volume it is created
+// from, volumes can not be shrunk while they are restored or cloned. Volumes
+// of the same size as their source are valid.
+func CheckContentSourceSize(size, sourceSize int64, source string) error {
+	if size >= sourceSize {
+		return nil
+	}
+
+	return status.Errorf(codes.OutOfRange, "requested size %d is smaller than the size %d of %s",
+		size, sourceSize, source)
+}
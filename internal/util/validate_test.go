@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Ceph-CSI Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateNamePrefix(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		prefix  string
+		wantErr bool
+	}{
+		{name: "no prefix", prefix: "", wantErr: false},
+		{name: "default prefix", prefix: "csi-vol-", wantErr: false},
+		{name: "longest prefix", prefix: strings.Repeat("a", MaxNamePrefixLength), wantErr: false},
+		{name: "too long prefix", prefix: strings.Repeat("a", MaxNamePrefixLength+1), wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if err := ValidateNamePrefix("volumeNamePrefix", ts.prefix); (err != nil) != ts.wantErr {
+				t.Errorf("ValidateNamePrefix() error = %v, wantErr %v", err, ts.wantErr)
+			}
+		})
+	}
+}
+
+func TestParameterErrorCode(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{name: "missing clusterID", err: ErrClusterIDNotSet, want: codes.InvalidArgument},
+		{
+			name: "too long prefix",
+			err:  ValidateNamePrefix("snapshotNamePrefix", strings.Repeat("a", MaxNamePrefixLength+1)),
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "missing monitors",
+			err:  fmt.Errorf("failed to fetch monitor list using clusterID (%s): %w", "ceph", ErrMissingConfigForMonitor),
+			want: codes.Internal,
+		},
+		{name: "connection failure", err: errors.New("connection timed out"), want: codes.Internal},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			if got := ParameterErrorCode(ts.err); got != ts.want {
+				t.Errorf("ParameterErrorCode(%v) = %v, want %v", ts.err, got, ts.want)
+			}
+		})
+	}
+}
+
+func TestCheckContentSourceSize(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name       string
+		size       int64
+		sourceSize int64
+		wantErr    bool
+	}{
+		{name: "larger than source", size: 2048, sourceSize: 1024, wantErr: false},
+		{name: "same size as source", size: 1024, sourceSize: 1024, wantErr: false},
+		{name: "smaller than source", size: 1023, sourceSize: 1024, wantErr: true},
+	}
+	for _, tt := range tests {
+		ts := tt
+		t.Run(ts.name, func(t *testing.T) {
+			t.Parallel()
+			err := CheckContentSourceSize(ts.size, ts.sourceSize, "snapshot snap-1")
+			if (err != nil) != ts.wantErr {
+				t.Fatalf("CheckContentSourceSize() error = %v, wantErr %v", err, ts.wantErr)
+			}
+			if err != nil && status.Code(err) != codes.OutOfRange {
+				t.Errorf("CheckContentSourceSize() code = %v, want %v", status.Code(err), codes.OutOfRange)
+			}
+		})
+	}
+}
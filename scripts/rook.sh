@@ -6,6 +6,7 @@ ROOK_URL="https://raw.githubusercontent.com/rook/rook/${ROOK_VERSION}/"
 ROOK_DEPLOYMENT_PATH="cluster/examples/kubernetes/ceph"
 ROOK_BLOCK_POOL_NAME=${ROOK_BLOCK_POOL_NAME:-"newrbdpool"}
 ROOK_BLOCK_EC_POOL_NAME=${ROOK_BLOCK_EC_POOL_NAME:-"ec-pool"}
+ROOK_PEER_NAMESPACE=${ROOK_PEER_NAMESPACE:-"rook-ceph-peer"}
 
 SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" >/dev/null 2>&1 && pwd)"
 # shellcheck disable=SC1091
@@ -63,16 +64,11 @@ function deploy_rook() {
 
 	kubectl_retry create -f "${TEMP_DIR}/operator.yaml"
 	# Override the ceph version which rook installs by default.
-	if [ -z "${ROOK_CEPH_CLUSTER_IMAGE}" ]; then
+	if [ -z "${ROOK_CEPH_CLUSTER_IMAGE}" ] && [ -z "${ROOK_DEVICE_FILTER}" ]; then
 		kubectl_retry create -f "${ROOK_URL}/cluster-test.yaml"
 	else
-		ROOK_CEPH_CLUSTER_VERSION_IMAGE_PATH="image: ${ROOK_CEPH_CLUSTER_IMAGE}"
-
 		curl -o "${TEMP_DIR}"/cluster-test.yaml "${ROOK_URL}/cluster-test.yaml"
-		sed -i "s|image.*|${ROOK_CEPH_CLUSTER_VERSION_IMAGE_PATH}|g" "${TEMP_DIR}"/cluster-test.yaml
-		sed -i "s/config: |/config: |\n    \[mon\]\n    mon_warn_on_insecure_global_id_reclaim_allowed = false/g" "${TEMP_DIR}"/cluster-test.yaml
-		sed -i "s/healthCheck:/healthCheck:\n    livenessProbe:\n      mon:\n        disabled: true\n      mgr:\n        disabled: true\n      mds:\n        disabled: true\n    startupProbe:\n      mon:\n        disabled: true\n      mgr:\n        disabled: true\n      mds:\n        disabled: true/g" "${TEMP_DIR}"/cluster-test.yaml
-		cat "${TEMP_DIR}"/cluster-test.yaml
+		customize_cluster "${TEMP_DIR}"/cluster-test.yaml "${ROOK_DEVICE_FILTER}"
 		kubectl_retry create -f "${TEMP_DIR}/cluster-test.yaml"
 	fi
 	rm -rf "${TEMP_DIR}"
@@ -100,6 +96,74 @@ function deploy_rook() {
 	fi
 }
 
+# customize_cluster overrides the Ceph image of the CephCluster in the file
+# with ROOK_CEPH_CLUSTER_IMAGE, and makes it only use the devices that match
+# the filter in the 2nd parameter, so that two clusters can share the nodes.
+function customize_cluster() {
+	if [ -n "${ROOK_CEPH_CLUSTER_IMAGE}" ]; then
+		ROOK_CEPH_CLUSTER_VERSION_IMAGE_PATH="image: ${ROOK_CEPH_CLUSTER_IMAGE}"
+
+		sed -i "s|image.*|${ROOK_CEPH_CLUSTER_VERSION_IMAGE_PATH}|g" "${1}"
+		sed -i "s/config: |/config: |\n    \[mon\]\n    mon_warn_on_insecure_global_id_reclaim_allowed = false/g" "${1}"
+		sed -i "s/healthCheck:/healthCheck:\n    livenessProbe:\n      mon:\n        disabled: true\n      mgr:\n        disabled: true\n      mds:\n        disabled: true\n    startupProbe:\n      mon:\n        disabled: true\n      mgr:\n        disabled: true\n      mds:\n        disabled: true/g" "${1}"
+	fi
+	if [ -n "${2}" ]; then
+		sed -i "s|useAllDevices: true|useAllDevices: false\n    deviceFilter: \"${2}\"|g" "${1}"
+	fi
+	cat "${1}"
+}
+
+# deploy_rook_peer deploys a second Ceph cluster in ROOK_PEER_NAMESPACE that
+# is managed by the Rook operator of the first cluster. It needs a device that
+# is not used by the first cluster, set with ROOK_PEER_DEVICE_FILTER (and
+# ROOK_DEVICE_FILTER for the first cluster). The pool of pool-test.yaml gets
+# mirroring enabled in both clusters, and an rbd-mirror daemon is started in
+# each of them. The e2e tests bootstrap the peers, see --peer-rook-namespace.
+function deploy_rook_peer() {
+	if [ -z "${ROOK_PEER_DEVICE_FILTER}" ]; then
+		echo "ROOK_PEER_DEVICE_FILTER needs to be set to the devices for the peer cluster" >&2
+		return 1
+	fi
+
+	TEMP_DIR="$(mktemp -d)"
+	for manifest in common-second-cluster.yaml cluster-test.yaml toolbox.yaml pool-test.yaml rbdmirror.yaml; do
+		curl -o "${TEMP_DIR}/${manifest}" "${ROOK_URL}/${manifest}"
+	done
+	sed -i "s|\$NAMESPACE|${ROOK_PEER_NAMESPACE}|g" "${TEMP_DIR}/common-second-cluster.yaml"
+	sed -i "s|namespace: rook-ceph\b|namespace: ${ROOK_PEER_NAMESPACE}|g" "${TEMP_DIR}"/*.yaml
+	sed -i "s|dataDirHostPath: /var/lib/rook|dataDirHostPath: /var/lib/${ROOK_PEER_NAMESPACE}|g" "${TEMP_DIR}/cluster-test.yaml"
+	customize_cluster "${TEMP_DIR}/cluster-test.yaml" "${ROOK_PEER_DEVICE_FILTER}"
+
+	kubectl_retry create -f "${TEMP_DIR}/common-second-cluster.yaml"
+	kubectl_retry create -f "${TEMP_DIR}/cluster-test.yaml"
+	kubectl_retry create -f "${TEMP_DIR}/toolbox.yaml"
+	kubectl_retry create -f "${TEMP_DIR}/pool-test.yaml"
+	kubectl_retry create -f "${TEMP_DIR}/rbdmirror.yaml"
+	# the rbd-mirror daemon of the first cluster
+	kubectl_retry create -f "${ROOK_URL}/rbdmirror.yaml"
+	rm -rf "${TEMP_DIR}"
+
+	for ns in rook-ceph "${ROOK_PEER_NAMESPACE}"; do
+		kubectl_retry -n "${ns}" patch cephblockpool replicapool --type merge \
+			-p '{"spec":{"mirroring":{"enabled":true,"mode":"image"}}}'
+	done
+
+	check_ceph_cluster_health "${ROOK_PEER_NAMESPACE}"
+	check_rbd_stat replicapool "${ROOK_PEER_NAMESPACE}"
+}
+
+function teardown_rook_peer() {
+	kubectl delete -f "${ROOK_URL}/rbdmirror.yaml"
+	for manifest in rbdmirror.yaml pool-test.yaml toolbox.yaml cluster-test.yaml; do
+		curl -s "${ROOK_URL}/${manifest}" |
+			sed "s|namespace: rook-ceph\b|namespace: ${ROOK_PEER_NAMESPACE}|g" |
+			kubectl delete -f -
+	done
+	curl -s "${ROOK_URL}/common-second-cluster.yaml" |
+		sed "s|\$NAMESPACE|${ROOK_PEER_NAMESPACE}|g" |
+		kubectl delete -f -
+}
+
 function teardown_rook() {
 	kubectl delete -f "${ROOK_URL}/pool-test.yaml"
 	kubectl delete -f "${ROOK_URL}/filesystem-test.yaml"
@@ -148,11 +212,12 @@ function delete_block_ec_pool() {
 }
 
 function check_ceph_cluster_health() {
+	local namespace="${1:-rook-ceph}"
 	for ((retry = 0; retry <= ROOK_DEPLOY_TIMEOUT; retry = retry + 5)); do
 		echo "Wait for rook deploy... ${retry}s" && sleep 5
 
-		CEPH_STATE=$(kubectl_retry -n rook-ceph get cephclusters -o jsonpath='{.items[0].status.state}')
-		CEPH_HEALTH=$(kubectl_retry -n rook-ceph get cephclusters -o jsonpath='{.items[0].status.ceph.health}')
+		CEPH_STATE=$(kubectl_retry -n "${namespace}" get cephclusters -o jsonpath='{.items[0].status.state}')
+		CEPH_HEALTH=$(kubectl_retry -n "${namespace}" get cephclusters -o jsonpath='{.items[0].status.ceph.health}')
 		echo "Checking CEPH cluster state: [$CEPH_STATE]"
 		if [ "$CEPH_STATE" = "Created" ]; then
 			if [ "$CEPH_HEALTH" = "HEALTH_OK" ]; then
@@ -212,9 +277,10 @@ function check_mds_stat() {
 }
 
 function check_rbd_stat() {
+	local namespace="${2:-rook-ceph}"
 	for ((retry = 0; retry <= ROOK_DEPLOY_TIMEOUT; retry = retry + 5)); do
 		if [ -z "$1" ]; then
-			RBD_POOL_NAME=$(kubectl_retry -n rook-ceph get cephblockpools -ojsonpath='{.items[0].metadata.name}')
+			RBD_POOL_NAME=$(kubectl_retry -n "${namespace}" get cephblockpools -ojsonpath='{.items[0].metadata.name}')
 		else
 			RBD_POOL_NAME=$1
 		fi
@@ -231,15 +297,15 @@ function check_rbd_stat() {
 
 		echo "Checking RBD ($RBD_POOL_NAME) stats... ${retry}s" && sleep 5
 
-		TOOLBOX_POD=$(kubectl_retry -n rook-ceph get pods -l app=rook-ceph-tools -o jsonpath='{.items[0].metadata.name}')
-		TOOLBOX_POD_STATUS=$(kubectl_retry -n rook-ceph get pod "$TOOLBOX_POD" -ojsonpath='{.status.phase}')
+		TOOLBOX_POD=$(kubectl_retry -n "${namespace}" get pods -l app=rook-ceph-tools -o jsonpath='{.items[0].metadata.name}')
+		TOOLBOX_POD_STATUS=$(kubectl_retry -n "${namespace}" get pod "$TOOLBOX_POD" -ojsonpath='{.status.phase}')
 		[[ "$TOOLBOX_POD_STATUS" != "Running" ]] &&
 			{
 				echo "Toolbox POD ($TOOLBOX_POD) status: [$TOOLBOX_POD_STATUS]"
 				continue
 			}
 
-		if kubectl_retry exec -n rook-ceph "$TOOLBOX_POD" -it -- rbd pool stats "$RBD_POOL_NAME" &>/dev/null; then
+		if kubectl_retry exec -n "${namespace}" "$TOOLBOX_POD" -it -- rbd pool stats "$RBD_POOL_NAME" &>/dev/null; then
 			echo "RBD ($RBD_POOL_NAME) is successfully created..."
 			break
 		fi
@@ -262,6 +328,12 @@ deploy)
 teardown)
 	teardown_rook
 	;;
+deploy-peer)
+	deploy_rook_peer
+	;;
+teardown-peer)
+	teardown_rook_peer
+	;;
 create-block-pool)
 	create_block_pool
 	;;
@@ -279,6 +351,8 @@ delete-block-ec-pool)
 Available Commands:
   deploy             Deploy a rook
   teardown           Teardown a rook
+  deploy-peer        Deploy a second Ceph cluster that pools are mirrored to
+  teardown-peer      Teardown the second Ceph cluster
   create-block-pool  Create a rook block pool
   delete-block-pool  Delete a rook block pool
   create-block-ec-pool Creates a rook erasure coded block pool